@@ -20,6 +20,7 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/dominikschlosser/oid4vc-dev/internal/did"
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
 	"github.com/dominikschlosser/oid4vc-dev/internal/mdoc"
 	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
@@ -33,6 +34,7 @@ var (
 	decodeQRSource string
 	decodeQRScreen bool
 	decodeFormat   string
+	decodeResolve  bool
 )
 
 var decodeCmd = &cobra.Command{
@@ -54,7 +56,10 @@ Accepts:
   - Stdin (pipe or use -)
   - QR code from image file (--qr) or screen capture (--screen)
 
-Auto-detects the format. Use --format to override detection.`,
+Auto-detects the format. Use --format to override detection. With --resolve-dids,
+the DIDs the input refers to (issuer, subject, kid, decentralized_identifier
+client_id) are resolved and their DID documents shown; did:web resolution
+fetches the document over HTTPS.`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: runDecode,
 }
@@ -63,6 +68,7 @@ func init() {
 	decodeCmd.Flags().StringVar(&decodeQRSource, "qr", "", "scan QR code from image file")
 	decodeCmd.Flags().BoolVar(&decodeQRScreen, "screen", false, "scan QR code from screen capture")
 	decodeCmd.Flags().StringVarP(&decodeFormat, "format", "f", "", "pin format: sdjwt, jwt, mdoc, vci, vp, trustlist")
+	decodeCmd.Flags().BoolVar(&decodeResolve, "resolve-dids", false, "resolve did:key, did:jwk and did:web DIDs in the input and show their DID documents")
 	rootCmd.AddCommand(decodeCmd)
 }
 
@@ -136,6 +142,7 @@ func runDecode(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	var dids []string
 	switch detected {
 	case format.FormatSDJWT:
 		token, err := sdjwt.Parse(raw)
@@ -143,6 +150,7 @@ func runDecode(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("parsing SD-JWT: %w", err)
 		}
 		output.PrintSDJWT(token, opts)
+		dids = tokenDIDs(token)
 
 	case format.FormatJWT:
 		token, err := sdjwt.Parse(raw)
@@ -150,6 +158,7 @@ func runDecode(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("parsing JWT: %w", err)
 		}
 		output.PrintJWT(token, opts)
+		dids = tokenDIDs(token)
 
 	case format.FormatMDOC:
 		doc, err := mdoc.Parse(raw)
@@ -159,7 +168,10 @@ func runDecode(cmd *cobra.Command, args []string) error {
 		output.PrintMDOC(doc, opts)
 
 	case format.FormatOID4VCI, format.FormatOID4VP:
-		return decodeOID4(raw, opts)
+		dids, err = decodeOID4(raw, opts)
+		if err != nil {
+			return err
+		}
 
 	case format.FormatTrustList:
 		return decodeTrustList(raw, opts)
@@ -168,31 +180,76 @@ func runDecode(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("unable to auto-detect format (not a credential, OpenID4VCI/VP request, or trust list)")
 	}
 
+	if decodeResolve {
+		output.PrintDIDDocuments(resolveDIDs(dids), opts)
+	}
 	return nil
 }
 
-func decodeOID4(raw string, opts output.Options) error {
+// decodeOID4 prints an OpenID4VCI/VP request and returns the DIDs it refers to.
+func decodeOID4(raw string, opts output.Options) ([]string, error) {
 	reqType, result, err := oid4vc.Parse(raw)
 	if err != nil {
-		return fmt.Errorf("parsing OpenID request: %w", err)
+		return nil, fmt.Errorf("parsing OpenID request: %w", err)
 	}
 
 	switch reqType {
 	case oid4vc.TypeVCI:
 		offer, ok := result.(*oid4vc.CredentialOffer)
 		if !ok {
-			return fmt.Errorf("unexpected result type for VCI: %T", result)
+			return nil, fmt.Errorf("unexpected result type for VCI: %T", result)
 		}
 		output.PrintCredentialOffer(offer, opts)
 	case oid4vc.TypeVP:
 		req, ok := result.(*oid4vc.AuthorizationRequest)
 		if !ok {
-			return fmt.Errorf("unexpected result type for VP: %T", result)
+			return nil, fmt.Errorf("unexpected result type for VP: %T", result)
 		}
 		output.PrintAuthorizationRequest(req, opts)
+		dids := []string{strings.TrimPrefix(req.ClientID, "decentralized_identifier:")}
+		if req.RequestObject != nil {
+			dids = append(dids, stringClaim(req.RequestObject.Header, "kid"))
+		}
+		return dids, nil
 	}
 
-	return nil
+	return nil, nil
+}
+
+// tokenDIDs returns the DIDs a JWT or SD-JWT refers to: the kid of its header
+// and its iss and sub, and the kid of a key binding JWT.
+func tokenDIDs(token *sdjwt.Token) []string {
+	dids := []string{
+		stringClaim(token.Header, "kid"),
+		stringClaim(token.Payload, "iss"),
+		stringClaim(token.Payload, "sub"),
+	}
+	if token.KeyBindingJWT != nil {
+		dids = append(dids, stringClaim(token.KeyBindingJWT.Header, "kid"))
+	}
+	return dids
+}
+
+func stringClaim(m map[string]any, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+// resolveDIDs resolves the distinct DIDs among values, ignoring values that
+// are not DIDs and DID URL fragments.
+func resolveDIDs(values []string) []output.DIDResolution {
+	var results []output.DIDResolution
+	seen := make(map[string]bool)
+	for _, v := range values {
+		d, _, _ := strings.Cut(v, "#")
+		if _, _, err := did.Split(d); err != nil || seen[d] {
+			continue
+		}
+		seen[d] = true
+		doc, err := did.Resolve(d, nil)
+		results = append(results, output.DIDResolution{DID: d, Document: doc, Err: err})
+	}
+	return results
 }
 
 func decodeTrustList(raw string, opts output.Options) error {
@@ -15,7 +15,10 @@
 package cmd
 
 import (
+	"bytes"
 	"crypto"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
@@ -67,6 +70,70 @@ func TestCredLabel(t *testing.T) {
 	}
 }
 
+func TestInstancesLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		cred wallet.StoredCredential
+		want string
+	}{
+		{"single credential", wallet.StoredCredential{}, "1"},
+		{"batch instances", wallet.StoredCredential{Instances: []wallet.CredentialInstance{{Used: true}, {}, {}}}, "2/3 unused"},
+		{"exhausted instances", wallet.StoredCredential{Instances: []wallet.CredentialInstance{{Used: true}, {Used: true}}}, "0/2 unused (exhausted)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := instancesLabel(tt.cred)
+			if got != tt.want {
+				t.Errorf("instancesLabel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisplayLabel(t *testing.T) {
+	tests := []struct {
+		name    string
+		display *wallet.CredentialDisplay
+		want    string
+	}{
+		{"no display data", nil, "-"},
+		{"credential name only", &wallet.CredentialDisplay{Name: "PID"}, "PID"},
+		{"issuer name only", &wallet.CredentialDisplay{IssuerName: "Issuer"}, "Issuer"},
+		{"signed", &wallet.CredentialDisplay{Name: "PID", IssuerName: "Issuer", SignedMetadata: wallet.SignedMetadataSelfSigned}, "PID (Issuer) [self-signed]"},
+		{"rejected signed metadata", &wallet.CredentialDisplay{Name: "PID", SignedMetadata: "expired"}, "PID"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := displayLabel(wallet.StoredCredential{Display: tt.display})
+			if got != tt.want {
+				t.Errorf("displayLabel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintCredentials(t *testing.T) {
+	var buf bytes.Buffer
+	printCredentials(&buf, []wallet.StoredCredential{{
+		ID:     "c1",
+		Format: "dc+sd-jwt",
+		VCT:    "urn:eudi:pid:1",
+		Display: &wallet.CredentialDisplay{
+			Name:   "PID",
+			Issues: []string{"text_color \"white\" is not a numerical CSS color"},
+		},
+	}})
+
+	out := buf.String()
+	for _, want := range []string{"NAME", "c1", "PID", "Issuer metadata issues for c1", "text_color"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
 func TestTruncate(t *testing.T) {
 	tests := []struct {
 		input string
@@ -143,6 +210,32 @@ func TestApplySessionTranscriptMode(t *testing.T) {
 	}
 }
 
+func TestApplyDraftMode(t *testing.T) {
+	tests := []struct {
+		draft   int
+		wantErr bool
+	}{
+		{0, false},
+		{20, false},
+		{24, false},
+		{19, true},
+		{25, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("draft=%d", tt.draft), func(t *testing.T) {
+			w := &wallet.Wallet{}
+			err := applyDraftMode(w, tt.draft)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyDraftMode(%d) error = %v, wantErr %v", tt.draft, err, tt.wantErr)
+			}
+			if !tt.wantErr && w.Draft != tt.draft {
+				t.Errorf("got draft %d, want %d", w.Draft, tt.draft)
+			}
+		})
+	}
+}
+
 func TestApplyValidationMode(t *testing.T) {
 	tests := []struct {
 		mode    string
@@ -169,6 +262,101 @@ func TestApplyValidationMode(t *testing.T) {
 	}
 }
 
+func TestApplyCredentialEncryptionMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    wallet.CredentialEncryptionMode
+		wantErr bool
+	}{
+		{"", wallet.CredentialEncryptionAuto, false},
+		{"force", wallet.CredentialEncryptionForce, false},
+		{"off", wallet.CredentialEncryptionOff, false},
+		{"always", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run("mode="+tt.mode, func(t *testing.T) {
+			w := &wallet.Wallet{}
+			err := applyCredentialEncryptionMode(w, tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyCredentialEncryptionMode(%q) error = %v, wantErr %v", tt.mode, err, tt.wantErr)
+			}
+			if !tt.wantErr && w.CredentialEncryption != tt.want {
+				t.Errorf("got credential encryption mode %q, want %q", w.CredentialEncryption, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyProofType(t *testing.T) {
+	tests := []struct {
+		proofType string
+		want      string
+		wantErr   bool
+	}{
+		{"auto", "", false},
+		{"jwt", wallet.ProofTypeJWT, false},
+		{"attestation", wallet.ProofTypeAttestation, false},
+		{"di_vp", wallet.ProofTypeDIVP, false},
+		{"ldp_vp", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run("proof-type="+tt.proofType, func(t *testing.T) {
+			w := &wallet.Wallet{}
+			err := applyProofType(w, tt.proofType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyProofType(%q) error = %v, wantErr %v", tt.proofType, err, tt.wantErr)
+			}
+			if w.ProofType != tt.want {
+				t.Errorf("got proof type %q, want %q", w.ProofType, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientAttestationFlagsApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		flags   clientAttestationFlags
+		wantErr bool
+	}{
+		{"defaults", clientAttestationFlags{}, false},
+		{"force with overrides", clientAttestationFlags{mode: "force", claims: `{"wallet_name":"X","wallet_link":null}`, defects: []string{"pop-aud"}}, false},
+		{"invalid mode", clientAttestationFlags{mode: "sometimes"}, true},
+		{"invalid claims", clientAttestationFlags{claims: "{"}, true},
+		{"invalid defect", clientAttestationFlags{defects: []string{"nope"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &wallet.Wallet{}
+			err := tt.flags.apply(w)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	w := &wallet.Wallet{}
+	f := clientAttestationFlags{mode: "force", claims: `{"wallet_name":"X","wallet_link":null}`, defects: []string{"pop-aud"}}
+	if err := f.apply(w); err != nil {
+		t.Fatal(err)
+	}
+	if w.ClientAttestation.Mode != wallet.ClientAttestationForce {
+		t.Errorf("mode = %q, want force", w.ClientAttestation.Mode)
+	}
+	if w.ClientAttestation.Claims["wallet_name"] != "X" {
+		t.Errorf("wallet_name override = %v", w.ClientAttestation.Claims["wallet_name"])
+	}
+	if v, ok := w.ClientAttestation.Claims["wallet_link"]; !ok || v != nil {
+		t.Errorf("wallet_link should be present with nil value, got %v (present=%v)", v, ok)
+	}
+	if len(w.ClientAttestation.Defects) != 1 || w.ClientAttestation.Defects[0] != wallet.AttestationDefectPoPAudience {
+		t.Errorf("defects = %v", w.ClientAttestation.Defects)
+	}
+}
+
 func TestIsHTTPURL(t *testing.T) {
 	tests := []struct {
 		input string
@@ -279,3 +467,21 @@ func TestVerifyWithBestKey(t *testing.T) {
 		}
 	})
 }
+
+func TestPrintPendingIssuances(t *testing.T) {
+	var buf bytes.Buffer
+	printPendingIssuances(&buf, []wallet.PendingIssuance{{
+		ID:            "p1",
+		Issuer:        "https://issuer.example",
+		TransactionID: "tx-1",
+		Attempts:      2,
+		LastError:     "timeout",
+	}})
+
+	out := buf.String()
+	for _, want := range []string{"TRANSACTION", "p1", "https://issuer.example", "tx-1", "timeout"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
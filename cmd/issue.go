@@ -15,7 +15,7 @@
 package cmd
 
 import (
-	"crypto/ecdsa"
+	"crypto"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -32,6 +32,7 @@ import (
 var (
 	issueClaims        string
 	issueKeyPath       string
+	issueAlg           string
 	issueIssuer        string
 	issueVCT           string
 	issueExpires       string
@@ -54,21 +55,21 @@ var issueCmd = &cobra.Command{
 var issueSDJWTCmd = &cobra.Command{
 	Use:   "sdjwt",
 	Short: "Generate a test SD-JWT credential",
-	Long:  "Generate a signed SD-JWT credential with selectively disclosable claims. Uses an ephemeral P-256 key by default.",
+	Long:  "Generate a signed SD-JWT credential with selectively disclosable claims. Uses an ephemeral key for --alg (ES256 by default) unless --key is given.",
 	RunE:  runIssueSDJWT,
 }
 
 var issueJWTCmd = &cobra.Command{
 	Use:   "jwt",
 	Short: "Generate a test JWT VC credential",
-	Long:  "Generate a signed JWT VC credential with claims directly in the payload (no selective disclosure). Uses an ephemeral P-256 key by default.",
+	Long:  "Generate a signed JWT VC credential with claims directly in the payload (no selective disclosure). Uses an ephemeral key for --alg (ES256 by default) unless --key is given.",
 	RunE:  runIssueJWT,
 }
 
 var issueMDOCCmd = &cobra.Command{
 	Use:   "mdoc",
 	Short: "Generate a test mDOC credential",
-	Long:  "Generate a signed mDOC (IssuerSigned) credential. Uses an ephemeral P-256 key by default.",
+	Long:  "Generate a signed mDOC (IssuerSigned) credential. Uses an ephemeral key for --alg (ES256 by default) unless --key is given.",
 	RunE:  runIssueMDOC,
 }
 
@@ -80,7 +81,8 @@ func init() {
 
 	// SD-JWT flags
 	issueSDJWTCmd.Flags().StringVar(&issueClaims, "claims", "", "Claims as JSON string or @filepath")
-	issueSDJWTCmd.Flags().StringVar(&issueKeyPath, "key", "", "Private key file (PEM or JWK); ephemeral P-256 if omitted")
+	issueSDJWTCmd.Flags().StringVar(&issueKeyPath, "key", "", "Private key file (PEM or JWK); ephemeral key for --alg if omitted")
+	issueSDJWTCmd.Flags().StringVar(&issueAlg, "alg", "", "Signing algorithm: ES256, ES384, ES512, EdDSA, RS256, or PS256 (default: ES256, or the --key's algorithm)")
 	issueSDJWTCmd.Flags().StringVar(&issueIssuer, "iss", "https://issuer.example", "Issuer URL")
 	issueSDJWTCmd.Flags().StringVar(&issueVCT, "vct", mock.DefaultPIDVCT, "Verifiable Credential Type")
 	issueSDJWTCmd.Flags().StringVar(&issueExpires, "exp", "720h", "Expiration duration (e.g. 720h, 24h)")
@@ -93,7 +95,8 @@ func init() {
 
 	// JWT flags
 	issueJWTCmd.Flags().StringVar(&issueClaims, "claims", "", "Claims as JSON string or @filepath")
-	issueJWTCmd.Flags().StringVar(&issueKeyPath, "key", "", "Private key file (PEM or JWK); ephemeral P-256 if omitted")
+	issueJWTCmd.Flags().StringVar(&issueKeyPath, "key", "", "Private key file (PEM or JWK); ephemeral key for --alg if omitted")
+	issueJWTCmd.Flags().StringVar(&issueAlg, "alg", "", "Signing algorithm: ES256, ES384, ES512, EdDSA, RS256, or PS256 (default: ES256, or the --key's algorithm)")
 	issueJWTCmd.Flags().StringVar(&issueIssuer, "iss", "https://issuer.example", "Issuer URL")
 	issueJWTCmd.Flags().StringVar(&issueVCT, "vct", mock.DefaultPIDVCT, "Verifiable Credential Type")
 	issueJWTCmd.Flags().StringVar(&issueExpires, "exp", "720h", "Expiration duration (e.g. 720h, 24h)")
@@ -106,7 +109,8 @@ func init() {
 
 	// mDOC flags
 	issueMDOCCmd.Flags().StringVar(&issueClaims, "claims", "", "Claims as JSON string or @filepath")
-	issueMDOCCmd.Flags().StringVar(&issueKeyPath, "key", "", "Private key file (PEM or JWK); ephemeral P-256 if omitted")
+	issueMDOCCmd.Flags().StringVar(&issueKeyPath, "key", "", "Private key file (PEM or JWK); ephemeral key for --alg if omitted")
+	issueMDOCCmd.Flags().StringVar(&issueAlg, "alg", "", "Signing algorithm: ES256, ES384, ES512, EdDSA, RS256, or PS256 (default: ES256, or the --key's algorithm)")
 	issueMDOCCmd.Flags().StringVar(&issueDocType, "doc-type", "eu.europa.ec.eudi.pid.1", "Document type")
 	issueMDOCCmd.Flags().StringVar(&issueNamespace, "namespace", "eu.europa.ec.eudi.pid.1", "Namespace")
 	issueMDOCCmd.Flags().StringVar(&issueExpires, "exp", "720h", "Expiration duration (e.g. 720h, 24h)")
@@ -119,7 +123,7 @@ func init() {
 }
 
 func runIssueSDJWT(cmd *cobra.Command, args []string) error {
-	key, err := loadOrGenerateIssueKey()
+	key, alg, err := loadOrGenerateIssueKey()
 	if err != nil {
 		return err
 	}
@@ -146,6 +150,7 @@ func runIssueSDJWT(cmd *cobra.Command, args []string) error {
 		NotBefore:     nbf,
 		Claims:        claims,
 		Key:           key,
+		Alg:           alg,
 		StatusListURI: issueStatusListURI,
 		StatusListIdx: issueStatusListIdx,
 	}
@@ -164,7 +169,7 @@ func runIssueSDJWT(cmd *cobra.Command, args []string) error {
 }
 
 func runIssueJWT(cmd *cobra.Command, args []string) error {
-	key, err := loadOrGenerateIssueKey()
+	key, alg, err := loadOrGenerateIssueKey()
 	if err != nil {
 		return err
 	}
@@ -191,6 +196,7 @@ func runIssueJWT(cmd *cobra.Command, args []string) error {
 		NotBefore:     nbf,
 		Claims:        claims,
 		Key:           key,
+		Alg:           alg,
 		StatusListURI: issueStatusListURI,
 		StatusListIdx: issueStatusListIdx,
 	}
@@ -209,7 +215,7 @@ func runIssueJWT(cmd *cobra.Command, args []string) error {
 }
 
 func runIssueMDOC(cmd *cobra.Command, args []string) error {
-	key, err := loadOrGenerateIssueKey()
+	key, alg, err := loadOrGenerateIssueKey()
 	if err != nil {
 		return err
 	}
@@ -234,6 +240,7 @@ func runIssueMDOC(cmd *cobra.Command, args []string) error {
 		Namespace:     issueNamespace,
 		Claims:        claims,
 		Key:           key,
+		Alg:           alg,
 		ExpiresIn:     expDuration,
 		ValidFrom:     nbf,
 		StatusListURI: issueStatusListURI,
@@ -253,27 +260,37 @@ func runIssueMDOC(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func loadOrGenerateIssueKey() (*ecdsa.PrivateKey, error) {
+// loadOrGenerateIssueKey returns the --key signing key, or an ephemeral key
+// for --alg. The returned algorithm is empty when --alg is not set, so a
+// loaded key signs with its own default algorithm.
+func loadOrGenerateIssueKey() (crypto.Signer, keys.Algorithm, error) {
+	alg, err := keys.ParseAlgorithm(issueAlg)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid --alg: %w", err)
+	}
+
 	if issueKeyPath != "" {
-		privKey, err := keys.LoadPrivateKey(issueKeyPath)
+		key, err := keys.LoadSigner(issueKeyPath)
 		if err != nil {
-			return nil, fmt.Errorf("loading key: %w", err)
+			return nil, "", fmt.Errorf("loading key: %w", err)
+		}
+		if issueAlg == "" {
+			return key, "", nil
 		}
-		ecKey, ok := privKey.(*ecdsa.PrivateKey)
-		if !ok {
-			return nil, fmt.Errorf("--key must be an EC private key (P-256)")
+		if !keys.SupportsAlgorithm(key.Public(), alg) {
+			return nil, "", fmt.Errorf("--key cannot sign %s (supports %v)", alg, keys.KeyAlgorithms(key.Public()))
 		}
-		return ecKey, nil
+		return key, alg, nil
 	}
 
-	key, err := mock.GenerateKey()
+	key, err := keys.GenerateKey(alg)
 	if err != nil {
-		return nil, fmt.Errorf("generating ephemeral key: %w", err)
+		return nil, "", fmt.Errorf("generating ephemeral key: %w", err)
 	}
 
 	fmt.Fprintln(os.Stderr, "Ephemeral signing key (public JWK):")
-	fmt.Fprintln(os.Stderr, mock.PublicKeyJWK(&key.PublicKey))
-	return key, nil
+	fmt.Fprintln(os.Stderr, mock.PublicKeyJWK(key.Public()))
+	return key, alg, nil
 }
 
 func resolveIssueClaimsForFormat(format string) (map[string]any, error) {
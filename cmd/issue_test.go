@@ -355,6 +355,60 @@ func TestIssueSDJWT_InvalidExpDuration(t *testing.T) {
 	}
 }
 
+func TestIssue_WithAlg(t *testing.T) {
+	defer func() { issueAlg = "" }()
+	for _, sub := range []string{"sdjwt", "jwt", "mdoc"} {
+		for _, alg := range []string{"ES512", "EdDSA", "PS256"} {
+			t.Run(sub+"/"+alg, func(t *testing.T) {
+				issueClaims = ""
+				issueKeyPath = ""
+				issueOmit = nil
+				issuePID = false
+				issueExpires = "24h"
+
+				rootCmd.SetArgs([]string{"issue", sub, "--alg", alg})
+				if err := rootCmd.Execute(); err != nil {
+					t.Fatalf("issue %s --alg %s: %v", sub, alg, err)
+				}
+			})
+		}
+	}
+}
+
+func TestIssueSDJWT_AlgNotSupportedByKeyFile(t *testing.T) {
+	defer func() { issueAlg = "" }()
+	key, err := mock.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "key.jwk")
+	if err := os.WriteFile(keyFile, []byte(mock.PrivateKeyJWK(key)), 0600); err != nil {
+		t.Fatalf("writing key file: %v", err)
+	}
+
+	issueClaims = ""
+	issueOmit = nil
+	issuePID = false
+	issueExpires = "24h"
+
+	rootCmd.SetArgs([]string{"issue", "sdjwt", "--key", keyFile, "--alg", "RS256"})
+	err = rootCmd.Execute()
+	issueKeyPath = ""
+	if err == nil || !strings.Contains(err.Error(), "cannot sign RS256") {
+		t.Errorf("expected an RS256 error for a P-256 key, got %v", err)
+	}
+}
+
+func TestIssueSDJWT_InvalidAlg(t *testing.T) {
+	defer func() { issueAlg = "" }()
+	issueKeyPath = ""
+
+	rootCmd.SetArgs([]string{"issue", "sdjwt", "--alg", "HS256"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("expected error for --alg HS256")
+	}
+}
+
 func TestIssueMDOC_EndToEnd(t *testing.T) {
 	buf := new(bytes.Buffer)
 	rootCmd.SetOut(buf)
@@ -15,9 +15,12 @@
 package cmd
 
 import (
-	"crypto/ecdsa"
+	"crypto"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"runtime"
@@ -29,7 +32,6 @@ import (
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
 	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 	"github.com/dominikschlosser/oid4vc-dev/internal/mdoc"
-	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
 	"github.com/dominikschlosser/oid4vc-dev/internal/output"
 	"github.com/dominikschlosser/oid4vc-dev/internal/sdjwt"
 	"github.com/dominikschlosser/oid4vc-dev/internal/wallet"
@@ -37,6 +39,7 @@ import (
 
 var walletDir string
 var walletValidationMode string
+var walletAlg string
 
 var walletCmd = &cobra.Command{
 	Use:   "wallet",
@@ -47,11 +50,15 @@ var walletCmd = &cobra.Command{
 func init() {
 	walletCmd.PersistentFlags().StringVar(&walletDir, "wallet-dir", "", "Wallet storage directory (default ~/.oid4vc-dev/wallet/)")
 	walletCmd.PersistentFlags().StringVar(&walletValidationMode, "mode", string(wallet.ValidationModeDebug), "Wallet validation mode: 'debug' (default) or 'strict'")
+	walletCmd.PersistentFlags().StringVar(&walletAlg, "alg", string(keys.ES256), "Signing algorithm of the holder and issuer keys: ES256, ES384, ES512, EdDSA, RS256, or PS256")
 	walletCmd.AddCommand(walletServeCmd())
 	walletCmd.AddCommand(walletListCmd())
 	walletCmd.AddCommand(walletShowCmd())
+	walletCmd.AddCommand(walletPendingCmd())
 	walletCmd.AddCommand(walletImportCmd())
 	walletCmd.AddCommand(walletRemoveCmd())
+	walletCmd.AddCommand(walletNotifyCmd())
+	walletCmd.AddCommand(walletRefreshCmd())
 	walletCmd.AddCommand(walletGeneratePIDCmd())
 	walletCmd.AddCommand(walletAcceptCmd())
 	walletCmd.AddCommand(walletScanCmd())
@@ -91,14 +98,23 @@ func init() {
 	rootCmd.AddCommand(walletCmd)
 }
 
-// loadStore creates a WalletStore from the --wallet-dir flag.
-func loadStore() *wallet.WalletStore {
-	return wallet.NewWalletStore(walletDir)
+// loadStore creates a WalletStore from the --wallet-dir and --alg flags.
+func loadStore() (*wallet.WalletStore, error) {
+	alg, err := keys.ParseAlgorithm(walletAlg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --alg: %w", err)
+	}
+	store := wallet.NewWalletStore(walletDir)
+	store.Alg = alg
+	return store, nil
 }
 
 // loadWallet loads the wallet from the store, creating it if needed.
 func loadWallet() (*wallet.Wallet, *wallet.WalletStore, error) {
-	store := loadStore()
+	store, err := loadStore()
+	if err != nil {
+		return nil, nil, err
+	}
 	w, err := store.LoadOrCreate()
 	if err != nil {
 		return nil, nil, fmt.Errorf("loading wallet: %w", err)
@@ -118,6 +134,89 @@ func applyValidationMode(w *wallet.Wallet, raw string) error {
 	return nil
 }
 
+func applyDPoPMode(w *wallet.Wallet, raw string) error {
+	mode, err := wallet.ParseDPoPMode(raw)
+	if err != nil {
+		return err
+	}
+	w.DPoPMode = mode
+	return nil
+}
+
+func applyCredentialEncryptionMode(w *wallet.Wallet, raw string) error {
+	mode, err := wallet.ParseCredentialEncryptionMode(raw)
+	if err != nil {
+		return err
+	}
+	w.CredentialEncryption = mode
+	return nil
+}
+
+func applyProofType(w *wallet.Wallet, raw string) error {
+	proofType, err := wallet.ParseProofType(raw)
+	if err != nil {
+		return err
+	}
+	w.ProofType = proofType
+	return nil
+}
+
+// clientAttestationFlags holds the OAuth Client Attestation flags shared by
+// wallet accept and wallet serve.
+type clientAttestationFlags struct {
+	mode    string
+	claims  string
+	defects []string
+}
+
+func (f *clientAttestationFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.mode, "client-attestation", string(wallet.ClientAttestationAuto), "OAuth Client Attestation at the token/PAR endpoints: 'auto' (when attest_jwt_client_auth is supported), 'force', or 'off'")
+	cmd.Flags().StringVar(&f.claims, "attestation-claims", "", "Wallet Instance Attestation claim overrides as JSON; null removes a claim (e.g. '{\"wallet_name\":\"X\"}')")
+	cmd.Flags().StringSliceVar(&f.defects, "attestation-defect", nil, "Deliberately break the client attestation: expired, signature, cnf, pop-missing, pop-signature, pop-aud, pop-stale (repeatable)")
+}
+
+func (f clientAttestationFlags) apply(w *wallet.Wallet) error {
+	mode, err := wallet.ParseClientAttestationMode(f.mode)
+	if err != nil {
+		return err
+	}
+	defects, err := wallet.ParseAttestationDefects(f.defects)
+	if err != nil {
+		return err
+	}
+	var claims map[string]any
+	if f.claims != "" {
+		if err := json.Unmarshal([]byte(f.claims), &claims); err != nil {
+			return fmt.Errorf("parsing --attestation-claims JSON: %w", err)
+		}
+	}
+	w.ClientAttestation = wallet.ClientAttestationConfig{
+		Mode:    mode,
+		Claims:  claims,
+		Defects: defects,
+	}
+	return nil
+}
+
+// keyAttestationFlags holds the key attestation level flags shared by wallet
+// accept and wallet serve.
+type keyAttestationFlags struct {
+	keyStorage         []string
+	userAuthentication []string
+}
+
+func (f *keyAttestationFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&f.keyStorage, "key-storage", nil, "key_storage levels claimed in key attestations: high, moderate, enhanced-basic, basic, or a custom value (default: first level the issuer accepts)")
+	cmd.Flags().StringSliceVar(&f.userAuthentication, "user-authentication", nil, "user_authentication levels claimed in key attestations: high, moderate, enhanced-basic, basic, or a custom value (default: first level the issuer accepts)")
+}
+
+func (f keyAttestationFlags) apply(w *wallet.Wallet) {
+	w.KeyAttestation = wallet.KeyAttestationConfig{
+		KeyStorage:         wallet.ParseKeyAttestationLevels(f.keyStorage),
+		UserAuthentication: wallet.ParseKeyAttestationLevels(f.userAuthentication),
+	}
+}
+
 // --- wallet list ---
 
 func walletListCmd() *cobra.Command {
@@ -131,7 +230,8 @@ func walletListCmd() *cobra.Command {
 			}
 
 			creds := w.GetCredentials()
-			if len(creds) == 0 {
+			pending := w.GetPendingIssuances()
+			if len(creds) == 0 && len(pending) == 0 {
 				fmt.Println("No credentials stored.")
 				return nil
 			}
@@ -145,12 +245,12 @@ func walletListCmd() *cobra.Command {
 				return nil
 			}
 
-			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(tw, "ID\tFORMAT\tTYPE\tCLAIMS")
-			for _, c := range creds {
-				fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", c.ID, c.Format, credLabel(c), len(c.Claims))
+			printCredentials(os.Stdout, creds)
+
+			if len(pending) > 0 {
+				fmt.Printf("\nPending issuances (%d):\n", len(pending))
+				printPendingIssuances(os.Stdout, pending)
 			}
-			tw.Flush()
 			return nil
 		},
 	}
@@ -256,7 +356,7 @@ func walletRemoveCmd() *cobra.Command {
 				return err
 			}
 
-			if !w.RemoveCredential(args[0]) {
+			if !w.DeleteCredential(args[0]) {
 				return fmt.Errorf("credential %s not found", args[0])
 			}
 
@@ -270,6 +370,66 @@ func walletRemoveCmd() *cobra.Command {
 	}
 }
 
+// --- wallet notify ---
+
+func walletNotifyCmd() *cobra.Command {
+	var description string
+
+	cmd := &cobra.Command{
+		Use:   "notify <id> <event>",
+		Short: "Send an OID4VCI notification event for a credential to its issuer",
+		Long: `Send a notification event to the issuer's notification_endpoint for a
+credential that was issued with a notification_id. The wallet sends
+credential_accepted, credential_failure, and credential_deleted on its own;
+this command sends any event, including non-standard ones, to test how the
+issuer handles them.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w, _, err := loadWallet()
+			if err != nil {
+				return err
+			}
+			if err := w.SendNotification(args[0], args[1], description); err != nil {
+				return err
+			}
+			fmt.Printf("Sent %s for credential %s\n", args[1], args[0])
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&description, "description", "", "event_description sent with the event")
+	return cmd
+}
+
+func walletRefreshCmd() *cobra.Command {
+	var opts dispatchOID4Opts
+
+	cmd := &cobra.Command{
+		Use:   "refresh <id>",
+		Short: "Fetch a fresh copy of an OID4VCI credential from its issuer",
+		Long: `Fetch a fresh copy of a credential that was issued via OID4VCI and replace
+the stored credential, keeping its ID. The wallet uses the refresh token the
+issuer granted, otherwise the access token if it is still valid, otherwise it
+runs the original credential offer again (which may require logging in at the
+issuer, with the redirect received on http://localhost:<port>/callback).`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.mode = walletValidationMode
+			return refreshCredential(args[0], opts)
+		},
+	}
+
+	cmd.Flags().IntVar(&opts.port, "port", config.DefaultWalletPort, "Port of the OID4VCI authorization callback")
+	cmd.Flags().StringVar(&opts.clientID, "client-id", wallet.DefaultIssuanceClientID, "OAuth client_id for the OID4VCI authorization code flow if the offer is run again")
+	cmd.Flags().StringVar(&opts.dpop, "dpop", string(wallet.DPoPModeAuto), "DPoP-bound OID4VCI access tokens: 'auto' (when the authorization server supports it), 'force', or 'off'")
+	cmd.Flags().StringVar(&opts.encryption, "credential-encryption", string(wallet.CredentialEncryptionAuto), "Encrypted OID4VCI credential responses: 'auto' (when the issuer supports it), 'force', or 'off'")
+	cmd.Flags().StringVar(&opts.proofType, "proof-type", "auto", "OID4VCI proof type: 'auto' (from the issuer's proof_types_supported), 'jwt', 'attestation', or 'di_vp'")
+	cmd.Flags().StringVar(&opts.locale, "locale", "", "Preferred locale for issuer display data, e.g. 'de-DE' (default: the issuer's first entry)")
+	opts.attestation.register(cmd)
+	opts.keyAttestation.register(cmd)
+	return cmd
+}
+
 // --- wallet register ---
 
 func walletRegisterCmd() *cobra.Command {
@@ -367,6 +527,61 @@ func credLabel(c wallet.StoredCredential) string {
 	return typeLabel(c.VCT, c.DocType, c.Format)
 }
 
+// printCredentials writes credentials as a table with the issuer's display
+// name, followed by the problems found in the issuers' display metadata.
+func printCredentials(out io.Writer, creds []wallet.StoredCredential) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tFORMAT\tNAME\tTYPE\tCLAIMS\tINSTANCES")
+	for _, c := range creds {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", c.ID, c.Format, displayLabel(c), credLabel(c), len(c.Claims), instancesLabel(c))
+	}
+	tw.Flush()
+
+	for _, c := range creds {
+		if c.Display == nil || len(c.Display.Issues) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "\nIssuer metadata issues for %s:\n", c.ID)
+		for _, issue := range c.Display.Issues {
+			fmt.Fprintf(out, "  - %s\n", issue)
+		}
+	}
+}
+
+// displayLabel returns the issuer's display name of a credential, with the
+// issuer name and a mark for verified signed metadata, or "-" without
+// display data.
+func displayLabel(c wallet.StoredCredential) string {
+	d := c.Display
+	if d == nil || (d.Name == "" && d.IssuerName == "") {
+		return "-"
+	}
+	label := d.Name
+	switch {
+	case label == "":
+		label = d.IssuerName
+	case d.IssuerName != "":
+		label += " (" + d.IssuerName + ")"
+	}
+	if d.SignedMetadata == wallet.SignedMetadataSelfSigned {
+		label += " [self-signed]"
+	}
+	return label
+}
+
+// instancesLabel summarizes batch-issued instances as "unused/total unused",
+// or "1" for a credential without batch instances. Exhausted instances, which
+// further presentations reuse, are flagged.
+func instancesLabel(c wallet.StoredCredential) string {
+	if len(c.Instances) == 0 {
+		return "1"
+	}
+	if c.InstancesExhausted() {
+		return fmt.Sprintf("0/%d unused (exhausted)", len(c.Instances))
+	}
+	return fmt.Sprintf("%d/%d unused", c.UnusedInstances(), len(c.Instances))
+}
+
 func parseClaimsOverrides(flag string) (map[string]any, error) {
 	if flag == "" {
 		return nil, nil
@@ -390,6 +605,60 @@ func applySessionTranscriptMode(w *wallet.Wallet, mode string) error {
 	return nil
 }
 
+func applyDeviceAuthMode(w *wallet.Wallet, raw string) error {
+	mode, err := wallet.ParseDeviceAuthMode(raw)
+	if err != nil {
+		return err
+	}
+	w.DeviceAuth = mode
+	return nil
+}
+
+func applyDraftMode(w *wallet.Wallet, draft int) error {
+	if draft != 0 && (draft < wallet.MinDraft || draft > wallet.MaxDraft) {
+		return fmt.Errorf("invalid --draft value %d (must be %d to %d, or 0 for OID4VP 1.0)", draft, wallet.MinDraft, wallet.MaxDraft)
+	}
+	w.Draft = draft
+	return nil
+}
+
+// applyRegistrarCAs loads the registrar trust anchors of verifier_info
+// registration certificates from PEM certificate files.
+func applyRegistrarCAs(w *wallet.Wallet, paths []string) error {
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading --registrar-ca: %w", err)
+		}
+		found := false
+		for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return fmt.Errorf("parsing --registrar-ca %s: %w", path, err)
+			}
+			w.RegistrarCAs = append(w.RegistrarCAs, cert)
+			found = true
+		}
+		if !found {
+			return fmt.Errorf("--registrar-ca %s: no PEM certificate found", path)
+		}
+	}
+	return nil
+}
+
+// draftSessionTranscript returns the --session-transcript value to use: the
+// ISO 18013-7 transcript of the OID4VP drafts in draft compatibility mode,
+// unless the flag is set explicitly.
+func draftSessionTranscript(cmd *cobra.Command, draft int, sessionTranscript string) string {
+	if draft != 0 && !cmd.Flags().Changed("session-transcript") {
+		return string(wallet.SessionTranscriptISO)
+	}
+	return sessionTranscript
+}
+
 func openBrowser(url string) {
 	switch runtime.GOOS {
 	case "darwin":
@@ -399,20 +668,20 @@ func openBrowser(url string) {
 	}
 }
 
-func loadWalletECKey(path, label string) (*ecdsa.PrivateKey, error) {
+func loadWalletKey(path, label string) (crypto.Signer, error) {
 	if path != "" {
-		privKey, err := keys.LoadPrivateKey(path)
+		key, err := keys.LoadSigner(path)
 		if err != nil {
 			return nil, fmt.Errorf("loading %s key: %w", label, err)
 		}
-		ecKey, ok := privKey.(*ecdsa.PrivateKey)
-		if !ok {
-			return nil, fmt.Errorf("--%s key must be an EC private key (P-256)", label)
-		}
-		return ecKey, nil
+		return key, nil
 	}
 
-	key, err := mock.GenerateKey()
+	alg, err := keys.ParseAlgorithm(walletAlg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --alg: %w", err)
+	}
+	key, err := keys.GenerateKey(alg)
 	if err != nil {
 		return nil, fmt.Errorf("generating %s key: %w", label, err)
 	}
@@ -0,0 +1,104 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/wallet"
+)
+
+// --- wallet pending ---
+
+func walletPendingCmd() *cobra.Command {
+	var retry bool
+
+	cmd := &cobra.Command{
+		Use:   "pending [id...]",
+		Short: "List deferred issuances and retry them",
+		Long:  "List deferred credential issuances that are waiting for the issuer. With --retry, poll the deferred credential endpoint now for the given pending IDs (or all pending issuances if none are given).",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w, store, err := loadWallet()
+			if err != nil {
+				return err
+			}
+
+			if retry {
+				ids := args
+				if len(ids) == 0 {
+					for _, p := range w.GetPendingIssuances() {
+						ids = append(ids, p.ID)
+					}
+				}
+				var failed int
+				for _, id := range ids {
+					result, err := w.RetryPendingIssuance(id)
+					switch {
+					case err != nil:
+						failed++
+						fmt.Fprintf(os.Stderr, "%s: %v\n", id, err)
+					case result.PendingID != "":
+						fmt.Printf("%s: still pending\n", id)
+					default:
+						fmt.Printf("%s: received %s credential from %s (ID: %s)\n", id, result.Format, result.Issuer, result.CredentialID)
+					}
+				}
+				if err := store.Save(w); err != nil {
+					return fmt.Errorf("saving wallet: %w", err)
+				}
+				if failed > 0 {
+					return fmt.Errorf("%d of %d retries failed", failed, len(ids))
+				}
+				return nil
+			}
+
+			pending := w.GetPendingIssuances()
+			if jsonOutput {
+				data, err := json.MarshalIndent(pending, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+			if len(pending) == 0 {
+				fmt.Println("No pending issuances.")
+				return nil
+			}
+			printPendingIssuances(os.Stdout, pending)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&retry, "retry", false, "Poll the deferred credential endpoint now")
+	return cmd
+}
+
+// printPendingIssuances writes pending issuances as a table.
+func printPendingIssuances(out io.Writer, pending []wallet.PendingIssuance) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tISSUER\tTRANSACTION\tATTEMPTS\tNEXT POLL\tLAST ERROR")
+	for _, p := range pending {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", p.ID, p.Issuer, p.TransactionID, p.Attempts, p.NextAttempt.Format(time.TimeOnly), p.LastError)
+	}
+	tw.Flush()
+}
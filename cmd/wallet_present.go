@@ -34,8 +34,19 @@ type dispatchOID4Opts struct {
 	port              int
 	autoAccept        bool
 	sessionTranscript string
+	deviceAuth        string
 	txCode            string
+	clientID          string
+	dpop              string
+	encryption        string
+	proofType         string
+	locale            string
+	attestation       clientAttestationFlags
+	keyAttestation    keyAttestationFlags
 	haip              bool
+	trustAnchors      []string
+	registrarCAs      []string
+	draft             int
 	mode              string
 }
 
@@ -58,13 +69,23 @@ func dispatchURI(uri string, opts dispatchOID4Opts) error {
 		if opts.haip {
 			w.RequireHAIP = true
 		}
+		w.TrustAnchors = opts.trustAnchors
+		if err := applyRegistrarCAs(w, opts.registrarCAs); err != nil {
+			return err
+		}
 		if err := applySessionTranscriptMode(w, opts.sessionTranscript); err != nil {
 			return err
 		}
+		if err := applyDeviceAuthMode(w, opts.deviceAuth); err != nil {
+			return err
+		}
+		if err := applyDraftMode(w, opts.draft); err != nil {
+			return err
+		}
 		return runPresent(w, store, uri, opts.port)
 
 	case format.FormatOID4VCI:
-		return processCredentialOffer(uri, opts.txCode)
+		return processCredentialOffer(uri, opts)
 
 	default:
 		return fmt.Errorf("unable to detect URI type (expected openid4vp://, openid-credential-offer://, or similar): %s", format.Truncate(uri, 80))
@@ -81,31 +102,49 @@ func runPresent(w *wallet.Wallet, store *wallet.WalletStore, uri string, port in
 		return fmt.Errorf("parsing authorization request: %w", err)
 	}
 
-	findings, err := wallet.ValidatePresentationRequest(w.ValidationMode, parsed.ClientID, parsed.RequestObject, wallet.GetResponseURI(parsed))
+	responseURI := parsed.ResponseURI
+	if responseURI == "" {
+		responseURI = parsed.RedirectURI
+	}
+
+	clientID := parsed.ClientID
+	var draftFindings []string
+	if w.Draft != 0 {
+		clientID, draftFindings, err = w.ResolveDraftRequest(parsed.ClientID, &parsed.Legacy, parsed.RequestObject)
+		if err != nil {
+			sendErrorResponse(w, parsed, responseURI, wallet.ErrorInvalidRequest, err.Error())
+			return err
+		}
+	}
+	findings, err := wallet.ValidatePresentationRequest(w.ValidationMode, clientID, parsed.RequestObject, wallet.GetResponseURI(parsed), parsed.DCQLQuery, parsed.TransactionData, parsed.VerifierInfo, w.TrustAnchors, w.RegistrarCAs)
 	if err != nil {
+		sendErrorResponse(w, parsed, responseURI, wallet.ErrorCode(err), err.Error())
 		return err
 	}
+	findings = append(draftFindings, findings...)
 	for _, warning := range findings {
 		yellow := color.New(color.FgYellow)
 		yellow.Printf("  WARNING: %s\n", warning)
 		w.AddLog("presentation", fmt.Sprintf("request validation warning: %s", warning), false)
 	}
 
-	// Evaluate DCQL
+	// Evaluate DCQL, or the Presentation Exchange definition of drafts
 	var matches []wallet.CredentialMatch
+	pd := w.DraftPresentationDefinition(parsed.DCQLQuery, parsed.Legacy)
 	if parsed.DCQLQuery != nil {
-		matches = w.EvaluateDCQL(parsed.DCQLQuery)
+		matches = w.EvaluateDCQLForRequest(parsed.DCQLQuery, parsed.RequestObject)
+	} else if pd != nil {
+		matches = w.EvaluatePresentationDefinitionForRequest(pd, parsed.RequestObject)
 	}
 
 	if len(matches) == 0 {
+		sendErrorResponse(w, parsed, responseURI, w.UnmatchedErrorCode(parsed.DCQLQuery, pd, parsed.RequestObject), "no matching credentials found")
+		if parsed.DCQLQuery == nil {
+			return fmt.Errorf("no matching credentials found for the presentation_definition")
+		}
 		return fmt.Errorf("no matching credentials found for the DCQL query")
 	}
 
-	responseURI := parsed.ResponseURI
-	if responseURI == "" {
-		responseURI = parsed.RedirectURI
-	}
-
 	dim := color.New(color.Faint)
 
 	// Start server so the trust list is available during verification
@@ -119,16 +158,46 @@ func runPresent(w *wallet.Wallet, store *wallet.WalletStore, uri string, port in
 	dim.Println("───────────────────────────────────────")
 	yellow := color.New(color.FgYellow)
 	yellow.Printf("  Verifier: %s\n", parsed.ClientID)
+	verifierInfo := wallet.ParseVerifierInfo(parsed.VerifierInfo, parsed.RequestObject, parsed.DCQLQuery, w.RegistrarCAs)
+	if verifierInfo != nil {
+		if verifierInfo.Name != "" {
+			fmt.Printf("  Registered: %s (registrar %s)\n", verifierInfo.Name, verifierInfo.Registrar)
+		}
+		for _, use := range verifierInfo.IntendedUse {
+			fmt.Printf("  Purpose: %s\n", use)
+		}
+		for _, reason := range verifierInfo.Unverified {
+			fmt.Printf("  Unverified: %s\n", reason)
+		}
+		if verifierInfo.AccessCertificate != nil {
+			fmt.Printf("  Access certificate: %s\n", verifierInfo.AccessCertificate.Subject)
+		}
+	}
 	fmt.Printf("  Trust List:  %s/api/trustlist\n", addr)
 	dim.Printf("               http://host.docker.internal:%d/api/trustlist\n", port)
 	for _, m := range matches {
 		fmt.Printf("  Credential: %s (%s)\n", m.Format, typeLabel(m.VCT, m.DocType, m.Format))
 		fmt.Printf("  Disclosing: %v\n", m.SelectedKeys)
 	}
+	for _, td := range wallet.DecodeTransactionData(parsed.TransactionData) {
+		fmt.Printf("  Transaction: %s\n", td.Type)
+	}
+	for _, warning := range w.InstanceWarnings(matches) {
+		yellow.Printf("  Warning: %s\n", warning)
+	}
 
 	// Wait for consent if not auto-accepting
-	matches, submissionCh, denied := waitForConsent(w, matches, parsed, responseURI, addr, dim)
+	matches, submissionCh, denied := waitForConsent(w, matches, parsed, verifierInfo, responseURI, addr, dim)
 	if denied {
+		response := sendErrorResponse(w, parsed, responseURI, wallet.ErrorAccessDenied, "the user did not approve the presentation")
+		if submissionCh != nil {
+			submission := wallet.SubmissionResult{Error: "denied"}
+			if response != nil {
+				submission.RedirectURI = response.RedirectURI
+				submission.StatusCode = response.StatusCode
+			}
+			submissionCh <- submission
+		}
 		return nil
 	}
 
@@ -145,24 +214,28 @@ func runPresent(w *wallet.Wallet, store *wallet.WalletStore, uri string, port in
 
 // waitForConsent shows a consent UI and waits for the user's decision.
 // Returns the (potentially updated) matches, a submission channel for UI feedback,
-// and whether the presentation was denied or timed out.
-func waitForConsent(w *wallet.Wallet, matches []wallet.CredentialMatch, parsed *oid4vc.AuthorizationRequest, responseURI, addr string, dim *color.Color) ([]wallet.CredentialMatch, chan wallet.SubmissionResult, bool) {
+// and whether the presentation was denied or timed out. On deny, the channel
+// is returned for the result of the error response.
+func waitForConsent(w *wallet.Wallet, matches []wallet.CredentialMatch, parsed *oid4vc.AuthorizationRequest, verifierInfo *wallet.VerifierInfo, responseURI, addr string, dim *color.Color) ([]wallet.CredentialMatch, chan wallet.SubmissionResult, bool) {
 	if w.AutoAccept {
 		return matches, nil, false
 	}
 
 	consentReq := &wallet.ConsentRequest{
-		ID:           uuid.New().String(),
-		Type:         "presentation",
-		MatchedCreds: matches,
-		Status:       "pending",
-		ResultCh:     make(chan wallet.ConsentResult, 1),
-		SubmissionCh: make(chan wallet.SubmissionResult, 1),
-		CreatedAt:    time.Now(),
-		ClientID:     parsed.ClientID,
-		Nonce:        parsed.Nonce,
-		ResponseURI:  responseURI,
-		DCQLQuery:    parsed.DCQLQuery,
+		ID:              uuid.New().String(),
+		Type:            "presentation",
+		MatchedCreds:    matches,
+		Status:          "pending",
+		ResultCh:        make(chan wallet.ConsentResult, 1),
+		SubmissionCh:    make(chan wallet.SubmissionResult, 1),
+		CreatedAt:       time.Now(),
+		ClientID:        parsed.ClientID,
+		Nonce:           parsed.Nonce,
+		ResponseURI:     responseURI,
+		DCQLQuery:       parsed.DCQLQuery,
+		TransactionData: wallet.DecodeTransactionData(parsed.TransactionData),
+		VerifierInfo:    verifierInfo,
+		Warnings:        w.InstanceWarnings(matches),
 	}
 
 	w.CreateConsentRequest(consentReq)
@@ -177,15 +250,9 @@ func waitForConsent(w *wallet.Wallet, matches []wallet.CredentialMatch, parsed *
 	case result := <-consentReq.ResultCh:
 		if !result.Approved {
 			fmt.Println("Presentation denied.")
-			return nil, nil, true
-		}
-		if result.SelectedClaims != nil {
-			for i, m := range matches {
-				if selectedKeys, ok := result.SelectedClaims[m.CredentialID]; ok {
-					matches[i].SelectedKeys = selectedKeys
-				}
-			}
+			return nil, consentReq.SubmissionCh, true
 		}
+		w.ApplyConsent(matches, result)
 	case <-time.After(config.ConsentTimeout):
 		fmt.Println("Consent timeout.")
 		return nil, nil, true
@@ -197,15 +264,21 @@ func waitForConsent(w *wallet.Wallet, matches []wallet.CredentialMatch, parsed *
 // submitPresentation creates VP tokens, submits them to the verifier, and prints the result.
 func submitPresentation(w *wallet.Wallet, store *wallet.WalletStore, matches []wallet.CredentialMatch, parsed *oid4vc.AuthorizationRequest, responseURI string, submissionCh chan wallet.SubmissionResult, dim *color.Color) error {
 	params := wallet.PresentationParams{
-		Nonce:         parsed.Nonce,
-		ClientID:      parsed.ClientID,
-		ResponseURI:   responseURI,
-		ResponseMode:  parsed.ResponseMode,
-		RequestObject: parsed.RequestObject,
+		Nonce:           parsed.Nonce,
+		ClientID:        parsed.ClientID,
+		ResponseURI:     responseURI,
+		ResponseMode:    parsed.ResponseMode,
+		RequestObject:   parsed.RequestObject,
+		TransactionData: wallet.DecodeTransactionData(parsed.TransactionData),
+
+		PresentationDefinition: w.DraftPresentationDefinition(parsed.DCQLQuery, parsed.Legacy),
 	}
 	vpResult, err := w.CreateVPTokenMap(matches, params)
 	if err != nil {
 		w.AddLog("presentation", fmt.Sprintf("VP token creation failed: %v", err), false)
+		if code := wallet.ErrorCode(err); code == wallet.ErrorVPFormatsNotSupported {
+			sendErrorResponse(w, parsed, responseURI, code, err.Error())
+		}
 		if submissionCh != nil {
 			submissionCh <- wallet.SubmissionResult{Error: err.Error()}
 		}
@@ -216,7 +289,7 @@ func submitPresentation(w *wallet.Wallet, store *wallet.WalletStore, matches []w
 	// Create self-issued id_token if requested
 	var idToken string
 	if wallet.ResponseTypeContains(parsed.ResponseType, "id_token") {
-		idToken, err = w.CreateSelfIssuedIDToken(parsed.Nonce, parsed.ClientID)
+		idToken, err = w.CreateSelfIssuedIDToken(parsed.Nonce, parsed.ClientID, wallet.SubjectSyntaxType(parsed.RequestObject))
 		if err != nil {
 			return fmt.Errorf("creating self-issued id_token: %w", err)
 		}
@@ -235,6 +308,10 @@ func submitPresentation(w *wallet.Wallet, store *wallet.WalletStore, matches []w
 	submission := wallet.SubmissionResult{
 		RedirectURI: result.RedirectURI,
 		StatusCode:  result.StatusCode,
+		Warnings:    vpResult.Warnings,
+	}
+	for _, warning := range vpResult.Warnings {
+		color.New(color.FgYellow).Printf("  Warning: %s\n", warning)
 	}
 
 	if result.StatusCode >= 400 {
@@ -266,27 +343,154 @@ func submitPresentation(w *wallet.Wallet, store *wallet.WalletStore, matches []w
 	return nil
 }
 
+// sendErrorResponse sends an OID4VP error response to the verifier and prints
+// its reply. A failure to reach the verifier is printed rather than returned,
+// so the error that ended the flow stays the one reported.
+func sendErrorResponse(w *wallet.Wallet, parsed *oid4vc.AuthorizationRequest, responseURI, code, description string) *wallet.DirectPostResult {
+	if responseURI == "" {
+		return nil
+	}
+	params := wallet.PresentationParams{
+		Nonce:         parsed.Nonce,
+		ClientID:      parsed.ClientID,
+		ResponseURI:   responseURI,
+		RedirectURI:   parsed.RedirectURI,
+		ResponseMode:  parsed.ResponseMode,
+		RequestObject: parsed.RequestObject,
+	}
+	result, err := w.SubmitErrorResponse(code, description, parsed.State, responseURI, params)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: sending %s error response: %v\n", code, err)
+		w.AddLog("presentation", fmt.Sprintf("Sending %s to %s failed: %v", code, parsed.ClientID, err), false)
+		return nil
+	}
+
+	fmt.Printf("  Sent %s: %s\n", code, wallet.FormatDirectPostResult(result))
+	if result.StatusCode >= 400 {
+		fmt.Printf("  Body:  %s\n", result.Body)
+	}
+	w.AddLog("presentation", fmt.Sprintf("Sent %s to %s: %s", code, parsed.ClientID, wallet.FormatDirectPostResult(result)), false)
+	return result
+}
+
 // processCredentialOffer fetches and stores a credential from an OID4VCI offer URI.
-func processCredentialOffer(uri string, txCode string) error {
+// For the authorization code flow, a temporary server on opts.port receives the
+// redirect from the issuer's authorization endpoint.
+func processCredentialOffer(uri string, opts dispatchOID4Opts) error {
 	w, store, err := loadWallet()
 	if err != nil {
 		return err
 	}
-
-	if txCode != "" {
-		w.TxCode = txCode
+	shutdown, err := prepareIssuance(w, opts)
+	if err != nil {
+		return err
 	}
+	defer shutdown()
 
 	result, err := w.ProcessCredentialOffer(uri)
 	if err != nil {
 		return fmt.Errorf("processing credential offer: %w", err)
 	}
+	return finishIssuance(w, store, result, "Received")
+}
+
+// refreshCredential fetches a fresh copy of a stored credential from its
+// issuer. Like processCredentialOffer, a temporary server on opts.port
+// receives the authorization callback if the offer has to be run again.
+func refreshCredential(id string, opts dispatchOID4Opts) error {
+	w, store, err := loadWallet()
+	if err != nil {
+		return err
+	}
+	shutdown, err := prepareIssuance(w, opts)
+	if err != nil {
+		return err
+	}
+	defer shutdown()
+
+	result, err := w.RefreshCredential(id)
+	if err != nil {
+		// The failed attempt is recorded in the issuance context.
+		if saveErr := store.Save(w); saveErr != nil {
+			return fmt.Errorf("saving wallet: %w", saveErr)
+		}
+		return fmt.Errorf("refreshing credential: %w", err)
+	}
+	return finishIssuance(w, store, result, "Refreshed")
+}
+
+// prepareIssuance applies the OID4VCI options to the wallet and sets up the
+// authorization callback listener. The returned function shuts the listener
+// down.
+func prepareIssuance(w *wallet.Wallet, opts dispatchOID4Opts) (func(), error) {
+	if err := applyValidationMode(w, opts.mode); err != nil {
+		return nil, err
+	}
+	if err := applyDPoPMode(w, opts.dpop); err != nil {
+		return nil, err
+	}
+	if err := applyCredentialEncryptionMode(w, opts.encryption); err != nil {
+		return nil, err
+	}
+	if err := applyProofType(w, opts.proofType); err != nil {
+		return nil, err
+	}
+	if err := opts.attestation.apply(w); err != nil {
+		return nil, err
+	}
+	opts.keyAttestation.apply(w)
 
+	if opts.txCode != "" {
+		w.TxCode = opts.txCode
+	}
+	if opts.clientID != "" {
+		w.IssuanceClientID = opts.clientID
+	}
+	w.Locale = opts.locale
+
+	w.IssuanceRedirectURI = fmt.Sprintf("http://localhost:%d/callback", opts.port)
+	var srv *wallet.Server
+	shutdown := func() {
+		if srv != nil {
+			srv.Shutdown()
+		}
+	}
+	w.OnAuthorizationURL = func(authURL string) error {
+		srv = wallet.NewServer(w, opts.port, nil)
+		if _, err := srv.ListenAndServeBackground(); err != nil {
+			return fmt.Errorf("starting callback listener on port %d: %w", opts.port, err)
+		}
+		fmt.Println("Authorization required. Log in at the issuer to continue:")
+		fmt.Printf("  %s\n", authURL)
+		fmt.Println("Waiting for authorization callback...")
+		openBrowser(authURL)
+		return nil
+	}
+	return shutdown, nil
+}
+
+// finishIssuance saves the wallet and reports an issuance result, waiting
+// for a deferred credential if the issuer deferred it. verb describes a
+// received credential, e.g. "Received".
+func finishIssuance(w *wallet.Wallet, store *wallet.WalletStore, result *wallet.IssuanceResult, verb string) error {
 	if err := store.Save(w); err != nil {
 		return fmt.Errorf("saving wallet: %w", err)
 	}
 
-	fmt.Printf("Received %s credential from %s (ID: %s)\n", result.Format, result.Issuer, result.CredentialID)
+	if result.PendingID != "" {
+		fmt.Printf("Issuance deferred by %s (pending ID: %s)\n", result.Issuer, result.PendingID)
+		var err error
+		result, err = waitForDeferredIssuance(w, store, result.PendingID)
+		if err != nil {
+			return err
+		}
+		if result.PendingID != "" {
+			fmt.Printf("Credential not ready yet. Retry with: oid4vc-dev wallet pending --retry %s\n", result.PendingID)
+			return nil
+		}
+	}
+
+	fmt.Printf("%s %s credential from %s (ID: %s)\n", verb, result.Format, result.Issuer, result.CredentialID)
 
 	if jsonOutput {
 		data, _ := json.MarshalIndent(result, "", "  ")
@@ -295,3 +499,34 @@ func processCredentialOffer(uri string, txCode string) error {
 
 	return nil
 }
+
+// waitForDeferredIssuance polls the deferred credential endpoint until the
+// credential arrives or config.ConsentTimeout elapses. The pending entry stays
+// in the wallet if the credential is not ready in time.
+func waitForDeferredIssuance(w *wallet.Wallet, store *wallet.WalletStore, pendingID string) (*wallet.IssuanceResult, error) {
+	deadline := time.Now().Add(config.ConsentTimeout)
+	for {
+		var next time.Time
+		for _, p := range w.GetPendingIssuances() {
+			if p.ID == pendingID {
+				next = p.NextAttempt
+			}
+		}
+		if next.After(deadline) {
+			return &wallet.IssuanceResult{PendingID: pendingID}, nil
+		}
+		fmt.Printf("Polling deferred credential endpoint at %s...\n", next.Format("15:04:05"))
+		time.Sleep(time.Until(next))
+
+		result, err := w.RetryPendingIssuance(pendingID)
+		if saveErr := store.Save(w); saveErr != nil {
+			fmt.Fprintf(os.Stderr, "warning: saving wallet: %v\n", saveErr)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("deferred issuance: %w", err)
+		}
+		if result.PendingID == "" {
+			return result, nil
+		}
+	}
+}
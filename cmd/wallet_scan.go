@@ -22,6 +22,7 @@ import (
 	"github.com/dominikschlosser/oid4vc-dev/internal/config"
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
 	"github.com/dominikschlosser/oid4vc-dev/internal/qr"
+	"github.com/dominikschlosser/oid4vc-dev/internal/wallet"
 )
 
 func walletAcceptCmd() *cobra.Command {
@@ -29,8 +30,19 @@ func walletAcceptCmd() *cobra.Command {
 		port              int
 		autoAccept        bool
 		sessionTranscript string
+		deviceAuth        string
 		txCode            string
+		clientID          string
+		dpop              string
+		encryption        string
+		proofType         string
+		locale            string
+		attestation       clientAttestationFlags
+		keyAttestation    keyAttestationFlags
 		haip              bool
+		trustAnchors      []string
+		registrarCAs      []string
+		draft             int
 	)
 
 	cmd := &cobra.Command{
@@ -45,26 +57,51 @@ For OID4VP requests, the wallet evaluates the DCQL query, shows a consent UI
 (unless --auto-accept), and submits a VP token to the verifier.
 
 For OID4VCI offers, the wallet fetches the credential from the issuer and
-stores it locally. The --port, --auto-accept, and --session-transcript flags
-only apply to OID4VP flows.`,
+stores it locally. Offers with a pre-authorized code are redeemed directly;
+otherwise the wallet runs the authorization code flow with PKCE, opening the
+issuer's authorization page in the browser and receiving the redirect on
+http://localhost:<port>/callback. The --auto-accept and --session-transcript
+flags only apply to OID4VP flows.`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return dispatchURI(args[0], dispatchOID4Opts{
 				port:              port,
 				autoAccept:        autoAccept,
-				sessionTranscript: sessionTranscript,
+				sessionTranscript: draftSessionTranscript(cmd, draft, sessionTranscript),
+				deviceAuth:        deviceAuth,
 				txCode:            txCode,
+				clientID:          clientID,
+				dpop:              dpop,
+				encryption:        encryption,
+				proofType:         proofType,
+				locale:            locale,
+				attestation:       attestation,
+				keyAttestation:    keyAttestation,
 				haip:              haip,
+				trustAnchors:      trustAnchors,
+				registrarCAs:      registrarCAs,
+				draft:             draft,
 				mode:              walletValidationMode,
 			})
 		},
 	}
 
-	cmd.Flags().IntVar(&port, "port", config.DefaultWalletPort, "Server port for OID4VP (serves trust list and consent UI)")
+	cmd.Flags().IntVar(&port, "port", config.DefaultWalletPort, "Server port (OID4VP consent UI and trust list, OID4VCI authorization callback)")
 	cmd.Flags().BoolVar(&autoAccept, "auto-accept", false, "Auto-approve OID4VP presentations")
 	cmd.Flags().StringVar(&sessionTranscript, "session-transcript", "oid4vp", "mDoc session transcript mode: 'oid4vp' (OID4VP 1.0, default) or 'iso' (ISO 18013-7)")
+	cmd.Flags().StringVar(&deviceAuth, "device-auth", string(wallet.DeviceAuthSignature), "mDoc device authentication: 'signature' (deviceSignature) or 'mac' (deviceMac with the reader key of client_metadata.jwks)")
 	cmd.Flags().StringVar(&txCode, "tx-code", "", "Transaction code for OID4VCI pre-authorized code flow")
+	cmd.Flags().StringVar(&clientID, "client-id", wallet.DefaultIssuanceClientID, "OAuth client_id for the OID4VCI authorization code flow")
+	cmd.Flags().StringVar(&dpop, "dpop", string(wallet.DPoPModeAuto), "DPoP-bound OID4VCI access tokens: 'auto' (when the authorization server supports it), 'force', or 'off'")
+	cmd.Flags().StringVar(&encryption, "credential-encryption", string(wallet.CredentialEncryptionAuto), "Encrypted OID4VCI credential responses: 'auto' (when the issuer supports it), 'force', or 'off'")
+	cmd.Flags().StringVar(&proofType, "proof-type", "auto", "OID4VCI proof type: 'auto' (from the issuer's proof_types_supported), 'jwt', 'attestation', or 'di_vp'")
+	cmd.Flags().StringVar(&locale, "locale", "", "Preferred locale for issuer display data, e.g. 'de-DE' (default: the issuer's first entry)")
+	attestation.register(cmd)
+	keyAttestation.register(cmd)
 	cmd.Flags().BoolVar(&haip, "haip", false, "Enforce HAIP 1.0 compliance (x509_hash, direct_post.jwt, DCQL, JAR, ES256)")
+	cmd.Flags().StringSliceVar(&trustAnchors, "trust-anchor", nil, "OpenID Federation trust anchor for openid_federation: client IDs: entity configuration or {entity_id, jwks} file or URL (repeatable)")
+	cmd.Flags().StringSliceVar(&registrarCAs, "registrar-ca", nil, "Trust anchor of verifier_info registration certificates: PEM certificate file (repeatable)")
+	cmd.Flags().IntVar(&draft, "draft", 0, "OID4VP draft compatibility (20-24): Presentation Exchange, client_id_scheme, client_metadata_uri, ISO 18013-7 session transcript")
 	return cmd
 }
 
@@ -74,6 +111,7 @@ func walletScanCmd() *cobra.Command {
 		screen            bool
 		autoAccept        bool
 		sessionTranscript string
+		deviceAuth        string
 	)
 
 	cmd := &cobra.Command{
@@ -122,6 +160,7 @@ func walletScanCmd() *cobra.Command {
 				port:              port,
 				autoAccept:        autoAccept,
 				sessionTranscript: sessionTranscript,
+				deviceAuth:        deviceAuth,
 				mode:              walletValidationMode,
 			})
 		},
@@ -131,5 +170,6 @@ func walletScanCmd() *cobra.Command {
 	cmd.Flags().BoolVar(&screen, "screen", false, "Interactive screen capture (macOS)")
 	cmd.Flags().BoolVar(&autoAccept, "auto-accept", false, "Auto-approve presentations")
 	cmd.Flags().StringVar(&sessionTranscript, "session-transcript", "oid4vp", "mDoc session transcript mode: 'oid4vp' (OID4VP 1.0, default) or 'iso' (ISO 18013-7)")
+	cmd.Flags().StringVar(&deviceAuth, "device-auth", string(wallet.DeviceAuthSignature), "mDoc device authentication: 'signature' (deviceSignature) or 'mac' (deviceMac with the reader key of client_metadata.jwks)")
 	return cmd
 }
@@ -17,6 +17,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/fatih/color"
@@ -36,6 +37,7 @@ func walletServeCmd() *cobra.Command {
 		keyPath                 string
 		issuerKey               string
 		sessionTranscript       string
+		deviceAuth              string
 		register                bool
 		noRegister              bool
 		statusList              bool
@@ -44,6 +46,17 @@ func walletServeCmd() *cobra.Command {
 		preferredFormat         string
 		requireEncryptedRequest bool
 		haip                    bool
+		trustAnchors            []string
+		registrarCAs            []string
+		draft                   int
+		clientID                string
+		dpop                    string
+		encryption              string
+		proofType               string
+		locale                  string
+		autoRefresh             time.Duration
+		attestation             clientAttestationFlags
+		keyAttestation          keyAttestationFlags
 	)
 
 	cmd := &cobra.Command{
@@ -61,7 +74,10 @@ Capabilities:
 Use --register to also register OS URL scheme handlers (openid4vp://, haip-vp://, openid-credential-offer://, haip-vci://)
 so the wallet automatically receives incoming protocol requests.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			store := loadStore()
+			store, err := loadStore()
+			if err != nil {
+				return err
+			}
 			w, err := store.LoadOrCreate()
 			if err != nil {
 				return fmt.Errorf("loading wallet: %w", err)
@@ -72,14 +88,14 @@ so the wallet automatically receives incoming protocol requests.`,
 
 			// Override keys if explicitly provided
 			if keyPath != "" {
-				holderKey, err := loadWalletECKey(keyPath, "holder")
+				holderKey, err := loadWalletKey(keyPath, "holder")
 				if err != nil {
 					return err
 				}
 				w.HolderKey = holderKey
 			}
 			if issuerKey != "" {
-				ik, err := loadWalletECKey(issuerKey, "issuer")
+				ik, err := loadWalletKey(issuerKey, "issuer")
 				if err != nil {
 					return err
 				}
@@ -90,7 +106,13 @@ so the wallet automatically receives incoming protocol requests.`,
 				w.AutoAccept = true
 			}
 
-			if err := applySessionTranscriptMode(w, sessionTranscript); err != nil {
+			if err := applySessionTranscriptMode(w, draftSessionTranscript(cmd, draft, sessionTranscript)); err != nil {
+				return err
+			}
+			if err := applyDeviceAuthMode(w, deviceAuth); err != nil {
+				return err
+			}
+			if err := applyDraftMode(w, draft); err != nil {
 				return err
 			}
 
@@ -110,6 +132,27 @@ so the wallet automatically receives incoming protocol requests.`,
 			if haip {
 				w.RequireHAIP = true
 			}
+			w.TrustAnchors = trustAnchors
+			if err := applyRegistrarCAs(w, registrarCAs); err != nil {
+				return err
+			}
+
+			w.IssuanceClientID = clientID
+			if err := applyDPoPMode(w, dpop); err != nil {
+				return err
+			}
+			if err := applyCredentialEncryptionMode(w, encryption); err != nil {
+				return err
+			}
+			if err := applyProofType(w, proofType); err != nil {
+				return err
+			}
+			w.Locale = locale
+			w.AutoRefresh = autoRefresh
+			if err := attestation.apply(w); err != nil {
+				return err
+			}
+			keyAttestation.apply(w)
 
 			if statusList {
 				if baseURL == "" {
@@ -153,15 +196,31 @@ so the wallet automatically receives incoming protocol requests.`,
 			fmt.Printf("  Authorize:   http://localhost:%d/authorize\n", port)
 			fmt.Printf("  Trust List:  http://localhost:%d/api/trustlist\n", port)
 			dim.Printf("               http://host.docker.internal:%d/api/trustlist\n", port)
+			fmt.Printf("  Callback:    http://localhost:%d/callback (client_id %s)\n", port, w.IssuanceClientID)
 			fmt.Printf("  Credentials: %d loaded\n", len(w.GetCredentials()))
 			fmt.Printf("  Storage:     %s\n", store.Dir)
 			fmt.Printf("  Validation:  %s\n", w.ValidationMode)
+			fmt.Printf("  DPoP:        %s\n", w.DPoPMode)
+			fmt.Printf("  VCI Encrypt: %s\n", w.CredentialEncryption)
+			if w.ProofType != "" {
+				fmt.Printf("  Proof Type:  %s\n", w.ProofType)
+			}
+			if w.AutoRefresh > 0 {
+				fmt.Printf("  Refresh:     %s before expiry\n", w.AutoRefresh)
+			}
+			fmt.Printf("  Attestation: %s\n", w.ClientAttestation.Mode)
+			if len(w.ClientAttestation.Defects) > 0 {
+				yellow.Printf("               defects: %s\n", strings.Join(w.ClientAttestation.Defects, ", "))
+			}
 			if w.AutoAccept {
 				fmt.Printf("  Mode:        auto-accept\n")
 			} else {
 				fmt.Printf("  Mode:        interactive (consent UI)\n")
 			}
 			fmt.Printf("  Transcript:  %s\n", w.SessionTranscript)
+			if w.DeviceAuth == wallet.DeviceAuthMAC {
+				fmt.Printf("  Device Auth: deviceMac (when the verifier has a reader key)\n")
+			}
 			if w.PreferredFormat != "" {
 				fmt.Printf("  Preferred:   %s\n", w.PreferredFormat)
 			}
@@ -174,6 +233,15 @@ so the wallet automatically receives incoming protocol requests.`,
 			if w.RequireHAIP {
 				fmt.Printf("  HAIP:        enforced (x509_hash, direct_post.jwt, DCQL, JAR, ES256)\n")
 			}
+			for _, anchor := range w.TrustAnchors {
+				fmt.Printf("  Federation:  trust anchor %s\n", anchor)
+			}
+			for _, ca := range w.RegistrarCAs {
+				fmt.Printf("  Registrar:   trust anchor %s\n", ca.Subject)
+			}
+			if w.Draft != 0 {
+				fmt.Printf("  Draft:       OID4VP draft %d compatibility (Presentation Exchange)\n", w.Draft)
+			}
 
 			// Register URL scheme handlers if requested
 			if register && !noRegister {
@@ -232,6 +300,7 @@ so the wallet automatically receives incoming protocol requests.`,
 	cmd.Flags().StringVar(&keyPath, "key", "", "Holder private key file (PEM/JWK); uses stored key or auto-generates")
 	cmd.Flags().StringVar(&issuerKey, "issuer-key", "", "Issuer key for generated credentials (PEM/JWK)")
 	cmd.Flags().StringVar(&sessionTranscript, "session-transcript", "oid4vp", "mDoc session transcript mode: 'oid4vp' (OID4VP 1.0, default) or 'iso' (ISO 18013-7)")
+	cmd.Flags().StringVar(&deviceAuth, "device-auth", string(wallet.DeviceAuthSignature), "mDoc device authentication: 'signature' (deviceSignature) or 'mac' (deviceMac with the reader key of client_metadata.jwks)")
 	cmd.Flags().BoolVar(&register, "register", false, "Register OS URL scheme handlers (openid4vp://, haip-vp://, openid-credential-offer://, haip-vci://)")
 	cmd.Flags().BoolVar(&noRegister, "no-register", false, "Skip URL scheme registration (overrides --register)")
 	cmd.Flags().BoolVar(&statusList, "status-list", false, "Embed status list references in generated credentials")
@@ -240,5 +309,16 @@ so the wallet automatically receives incoming protocol requests.`,
 	cmd.Flags().StringVar(&preferredFormat, "preferred-format", "", "Preferred credential format when multiple match: 'dc+sd-jwt', 'mso_mdoc', or 'jwt_vc_json'")
 	cmd.Flags().BoolVar(&requireEncryptedRequest, "require-encrypted-request", false, "Require verifiers to encrypt request objects (sends encryption key in wallet_metadata)")
 	cmd.Flags().BoolVar(&haip, "haip", false, "Enforce HAIP 1.0 compliance (x509_hash, direct_post.jwt, DCQL, JAR, ES256)")
+	cmd.Flags().StringSliceVar(&trustAnchors, "trust-anchor", nil, "OpenID Federation trust anchor for openid_federation: client IDs: entity configuration or {entity_id, jwks} file or URL (repeatable)")
+	cmd.Flags().StringSliceVar(&registrarCAs, "registrar-ca", nil, "Trust anchor of verifier_info registration certificates: PEM certificate file (repeatable)")
+	cmd.Flags().IntVar(&draft, "draft", 0, "OID4VP draft compatibility (20-24): Presentation Exchange, client_id_scheme, client_metadata_uri, ISO 18013-7 session transcript")
+	cmd.Flags().StringVar(&clientID, "client-id", wallet.DefaultIssuanceClientID, "OAuth client_id for the OID4VCI authorization code flow")
+	cmd.Flags().StringVar(&dpop, "dpop", string(wallet.DPoPModeAuto), "DPoP-bound OID4VCI access tokens: 'auto' (when the authorization server supports it), 'force', or 'off'")
+	cmd.Flags().StringVar(&encryption, "credential-encryption", string(wallet.CredentialEncryptionAuto), "Encrypted OID4VCI credential responses: 'auto' (when the issuer supports it), 'force', or 'off'")
+	cmd.Flags().StringVar(&proofType, "proof-type", "auto", "OID4VCI proof type: 'auto' (from the issuer's proof_types_supported), 'jwt', 'attestation', or 'di_vp'")
+	cmd.Flags().StringVar(&locale, "locale", "", "Preferred locale for issuer display data, e.g. 'de-DE' (default: the issuer's first entry)")
+	cmd.Flags().DurationVar(&autoRefresh, "auto-refresh", 0, "Refresh OID4VCI credentials this long before they expire with their refresh or access token, e.g. '24h' (0 = off)")
+	attestation.register(cmd)
+	keyAttestation.register(cmd)
 	return cmd
 }
@@ -0,0 +1,134 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package did resolves Decentralized Identifiers (W3C DID Core) of the
+// did:key, did:jwk, and did:web methods to DID documents.
+package did
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
+)
+
+// HTTPClient fetches did:web documents.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Document is a resolved DID document.
+type Document struct {
+	Context            any                  `json:"@context,omitempty"`
+	ID                 string               `json:"id"`
+	Controller         any                  `json:"controller,omitempty"`
+	VerificationMethod []VerificationMethod `json:"verificationMethod,omitempty"`
+	Authentication     []any                `json:"authentication,omitempty"`
+	AssertionMethod    []any                `json:"assertionMethod,omitempty"`
+	KeyAgreement       []any                `json:"keyAgreement,omitempty"`
+	Service            []any                `json:"service,omitempty"`
+}
+
+// VerificationMethod is a verification method of a DID document.
+type VerificationMethod struct {
+	ID                 string         `json:"id"`
+	Type               string         `json:"type"`
+	Controller         string         `json:"controller"`
+	PublicKeyJWK       map[string]any `json:"publicKeyJwk,omitempty"`
+	PublicKeyMultibase string         `json:"publicKeyMultibase,omitempty"`
+}
+
+// Split returns the method and method-specific identifier of a DID, or an
+// error if s is not a did:method:identifier string.
+func Split(s string) (method, id string, err error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) < 3 || parts[0] != "did" || parts[1] == "" || parts[2] == "" {
+		return "", "", fmt.Errorf("%q is not a valid DID (expected did:method:identifier)", s)
+	}
+	return parts[1], parts[2], nil
+}
+
+// Resolve resolves a DID, or the DID of a DID URL, to its DID document.
+// client fetches did:web documents; nil uses http.DefaultClient.
+func Resolve(didOrURL string, client HTTPClient) (*Document, error) {
+	did, _, _ := strings.Cut(didOrURL, "#")
+	method, id, err := Split(did)
+	if err != nil {
+		return nil, err
+	}
+	switch method {
+	case "key":
+		return resolveKey(did, id)
+	case "jwk":
+		return resolveJWK(did, id)
+	case "web":
+		if client == nil {
+			client = http.DefaultClient
+		}
+		return resolveWeb(did, id, client)
+	default:
+		return nil, fmt.Errorf("unsupported DID method %q (supported: key, jwk, web)", method)
+	}
+}
+
+// FindVerificationMethod returns the verification method with the given
+// DID URL or relative "#fragment" id. Besides verificationMethod it searches
+// the methods embedded in verification relationships.
+func (d *Document) FindVerificationMethod(id string) (*VerificationMethod, bool) {
+	want := d.absoluteID(id)
+	candidates := d.VerificationMethod
+	for _, rel := range [][]any{d.Authentication, d.AssertionMethod} {
+		for _, entry := range rel {
+			if obj, ok := entry.(map[string]any); ok {
+				var vm VerificationMethod
+				if data, err := json.Marshal(obj); err == nil && json.Unmarshal(data, &vm) == nil {
+					candidates = append(candidates, vm)
+				}
+			}
+		}
+	}
+	for i := range candidates {
+		if d.absoluteID(candidates[i].ID) == want {
+			return &candidates[i], true
+		}
+	}
+	return nil, false
+}
+
+func (d *Document) absoluteID(id string) string {
+	if strings.HasPrefix(id, "#") {
+		return d.ID + id
+	}
+	return id
+}
+
+// PublicKey returns the public key of a verification method from its
+// publicKeyJwk or publicKeyMultibase.
+func (vm *VerificationMethod) PublicKey() (crypto.PublicKey, error) {
+	switch {
+	case vm.PublicKeyJWK != nil:
+		data, err := json.Marshal(vm.PublicKeyJWK)
+		if err != nil {
+			return nil, err
+		}
+		return keys.ParseJWK(data)
+	case vm.PublicKeyMultibase != "":
+		return decodeMultibaseKey(vm.PublicKeyMultibase)
+	default:
+		return nil, fmt.Errorf("verification method %s has no publicKeyJwk or publicKeyMultibase", vm.ID)
+	}
+}
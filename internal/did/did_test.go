@@ -0,0 +1,195 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package did
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+)
+
+func TestSplit(t *testing.T) {
+	method, id, err := Split("did:web:example.com:users:alice")
+	if err != nil || method != "web" || id != "example.com:users:alice" {
+		t.Errorf("Split = %q, %q, %v", method, id, err)
+	}
+	for _, s := range []string{"", "did:", "did:web", "did::x", "urn:web:x"} {
+		if _, _, err := Split(s); err == nil {
+			t.Errorf("Split(%q): expected error", s)
+		}
+	}
+}
+
+func TestResolve_Key(t *testing.T) {
+	// Ed25519 test vector from the did:key specification.
+	const ed = "did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK"
+	doc, err := Resolve(ed+"#z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK", nil)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if doc.ID != ed {
+		t.Errorf("id = %q, want %q", doc.ID, ed)
+	}
+	vm, ok := doc.FindVerificationMethod(ed + "#z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK")
+	if !ok {
+		t.Fatal("verification method not found")
+	}
+	pub, err := vm.PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey: %v", err)
+	}
+	if k, ok := pub.(ed25519.PublicKey); !ok || len(k) != ed25519.PublicKeySize {
+		t.Errorf("expected an Ed25519 key, got %T", pub)
+	}
+
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		key, _ := ecdsa.GenerateKey(curve, rand.Reader)
+		d, err := KeyDID(&key.PublicKey)
+		if err != nil {
+			t.Fatalf("KeyDID(%s): %v", curve.Params().Name, err)
+		}
+		doc, err := Resolve(d, nil)
+		if err != nil {
+			t.Fatalf("Resolve(%s): %v", d, err)
+		}
+		pub, err := doc.VerificationMethod[0].PublicKey()
+		if err != nil {
+			t.Fatalf("PublicKey: %v", err)
+		}
+		if !key.PublicKey.Equal(pub) {
+			t.Errorf("%s: resolved key does not match", curve.Params().Name)
+		}
+	}
+
+	if _, err := Resolve("did:key:zInvalid", nil); err == nil {
+		t.Error("expected error for an invalid did:key")
+	}
+}
+
+func TestResolve_JWK(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwk := map[string]any{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   format.EncodeBase64URL(key.X.FillBytes(make([]byte, 32))),
+		"y":   format.EncodeBase64URL(key.Y.FillBytes(make([]byte, 32))),
+		"use": "sig",
+	}
+	d, err := JWKDID(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := Resolve(d, nil)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	vm, ok := doc.FindVerificationMethod("#0")
+	if !ok {
+		t.Fatal("verification method #0 not found")
+	}
+	pub, err := vm.PublicKey()
+	if err != nil || !key.PublicKey.Equal(pub) {
+		t.Errorf("resolved key does not match (%v)", err)
+	}
+	if len(doc.KeyAgreement) != 0 || len(doc.AssertionMethod) != 1 {
+		t.Errorf("a signing key should only be used for authentication and assertions, got %+v", doc)
+	}
+
+	jwk["d"] = "secret"
+	d, _ = JWKDID(jwk)
+	if _, err := Resolve(d, nil); err == nil || !strings.Contains(err.Error(), "private key") {
+		t.Errorf("expected private key material to be rejected, got %v", err)
+	}
+}
+
+func TestWebURL(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"example.com", "https://example.com/.well-known/did.json"},
+		{"example.com%3A8443", "https://example.com:8443/.well-known/did.json"},
+		{"example.com:users:alice", "https://example.com/users/alice/did.json"},
+	}
+	for _, tt := range tests {
+		got, err := WebURL(tt.id)
+		if err != nil || got != tt.want {
+			t.Errorf("WebURL(%q) = %q, %v, want %q", tt.id, got, err, tt.want)
+		}
+	}
+	for _, id := range []string{"", "example.com/x", "example.com::a"} {
+		if _, err := WebURL(id); err == nil {
+			t.Errorf("WebURL(%q): expected error", id)
+		}
+	}
+}
+
+func TestResolve_Web(t *testing.T) {
+	var didValue string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/did.json":
+			json.NewEncoder(w).Encode(map[string]any{
+				"id": didValue,
+				"verificationMethod": []any{map[string]any{
+					"id":                 "#key-1",
+					"type":               "Multikey",
+					"controller":         didValue,
+					"publicKeyMultibase": "z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK",
+				}},
+			})
+		case "/other/did.json":
+			json.NewEncoder(w).Encode(map[string]any{"id": "did:web:example.com"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	host := strings.ReplaceAll(strings.TrimPrefix(srv.URL, "https://"), ":", "%3A")
+	didValue = "did:web:" + host
+
+	doc, err := Resolve(didValue+"#key-1", srv.Client())
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	vm, ok := doc.FindVerificationMethod(didValue + "#key-1")
+	if !ok {
+		t.Fatal("verification method not found")
+	}
+	if _, err := vm.PublicKey(); err != nil {
+		t.Errorf("PublicKey: %v", err)
+	}
+
+	if _, err := Resolve("did:web:"+host+":other", srv.Client()); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("expected id mismatch, got %v", err)
+	}
+	if _, err := Resolve("did:web:"+host+":missing", srv.Client()); err == nil || !strings.Contains(err.Error(), "HTTP 404") {
+		t.Errorf("expected HTTP 404, got %v", err)
+	}
+}
+
+func TestResolve_UnsupportedMethod(t *testing.T) {
+	if _, err := Resolve("did:example:123", nil); err == nil || !strings.Contains(err.Error(), "unsupported DID method") {
+		t.Errorf("expected unsupported method error, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package did
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
+)
+
+// JWKDID returns the did:jwk of a public JWK.
+func JWKDID(jwk map[string]any) (string, error) {
+	data, err := json.Marshal(jwk)
+	if err != nil {
+		return "", err
+	}
+	return "did:jwk:" + format.EncodeBase64URL(data), nil
+}
+
+// resolveJWK expands a did:jwk into its DID document with the single
+// verification method "#0".
+func resolveJWK(did, id string) (*Document, error) {
+	data, err := format.DecodeBase64URL(id)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: identifier is not base64url: %w", did, err)
+	}
+	var jwk map[string]any
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return nil, fmt.Errorf("resolving %s: identifier is not a JWK: %w", did, err)
+	}
+	if _, ok := jwk["d"]; ok {
+		return nil, fmt.Errorf("resolving %s: JWK contains private key material", did)
+	}
+	if _, err := keys.ParseJWK(data); err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", did, err)
+	}
+
+	vmID := did + "#0"
+	doc := &Document{
+		Context: []any{"https://www.w3.org/ns/did/v1", "https://w3id.org/security/suites/jws-2020/v1"},
+		ID:      did,
+		VerificationMethod: []VerificationMethod{{
+			ID:           vmID,
+			Type:         "JsonWebKey2020",
+			Controller:   did,
+			PublicKeyJWK: jwk,
+		}},
+	}
+	if use, _ := jwk["use"].(string); use != "enc" {
+		doc.Authentication = []any{vmID}
+		doc.AssertionMethod = []any{vmID}
+	}
+	if use, _ := jwk["use"].(string); use != "sig" {
+		doc.KeyAgreement = []any{vmID}
+	}
+	return doc, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package did
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"fmt"
+	"strings"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+)
+
+// multicodec prefixes (unsigned varints) of the public key types did:key supports.
+var (
+	codecEd25519 = []byte{0xed, 0x01}
+	codecP256    = []byte{0x80, 0x24}
+	codecP384    = []byte{0x81, 0x24}
+	codecP521    = []byte{0x82, 0x24}
+)
+
+// KeyDID returns the did:key of a public key: the multibase base58btc
+// encoding of the key's multicodec prefix and its raw (for EC keys:
+// compressed) bytes. EC P-256, P-384, P-521, and Ed25519 keys are supported.
+func KeyDID(pub crypto.PublicKey) (string, error) {
+	var raw []byte
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		var codec []byte
+		switch k.Curve {
+		case elliptic.P256():
+			codec = codecP256
+		case elliptic.P384():
+			codec = codecP384
+		case elliptic.P521():
+			codec = codecP521
+		default:
+			return "", fmt.Errorf("unsupported curve %s for did:key", k.Curve.Params().Name)
+		}
+		raw = append(bytes.Clone(codec), elliptic.MarshalCompressed(k.Curve, k.X, k.Y)...)
+	case ed25519.PublicKey:
+		raw = append(bytes.Clone(codecEd25519), k...)
+	default:
+		return "", fmt.Errorf("unsupported key type %T for did:key", pub)
+	}
+	return "did:key:z" + format.EncodeBase58(raw), nil
+}
+
+// resolveKey expands a did:key into its DID document with a single Multikey
+// verification method.
+func resolveKey(did, id string) (*Document, error) {
+	if _, err := decodeMultibaseKey(id); err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", did, err)
+	}
+	vmID := did + "#" + id
+	return &Document{
+		Context: []any{"https://www.w3.org/ns/did/v1", "https://w3id.org/security/multikey/v1"},
+		ID:      did,
+		VerificationMethod: []VerificationMethod{{
+			ID:                 vmID,
+			Type:               "Multikey",
+			Controller:         did,
+			PublicKeyMultibase: id,
+		}},
+		Authentication:  []any{vmID},
+		AssertionMethod: []any{vmID},
+	}, nil
+}
+
+// decodeMultibaseKey decodes a base58btc multibase public key with a
+// multicodec prefix.
+func decodeMultibaseKey(s string) (crypto.PublicKey, error) {
+	enc, ok := strings.CutPrefix(s, "z")
+	if !ok {
+		return nil, fmt.Errorf("multibase key %q is not base58btc-encoded", s)
+	}
+	raw, err := format.DecodeBase58(enc)
+	if err != nil {
+		return nil, err
+	}
+
+	var curve elliptic.Curve
+	switch {
+	case bytes.HasPrefix(raw, codecEd25519):
+		key := raw[len(codecEd25519):]
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key length %d", len(key))
+		}
+		return ed25519.PublicKey(key), nil
+	case bytes.HasPrefix(raw, codecP256):
+		curve = elliptic.P256()
+	case bytes.HasPrefix(raw, codecP384):
+		curve = elliptic.P384()
+	case bytes.HasPrefix(raw, codecP521):
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported multicodec key type %x", raw[:min(2, len(raw))])
+	}
+	x, y := elliptic.UnmarshalCompressed(curve, raw[2:])
+	if x == nil {
+		return nil, fmt.Errorf("invalid compressed %s point", curve.Params().Name)
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
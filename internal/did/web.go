@@ -0,0 +1,82 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package did
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WebURL returns the HTTPS URL of the DID document of a did:web identifier:
+// did:web:example.com becomes https://example.com/.well-known/did.json and
+// did:web:example.com%3A8443:users:alice becomes
+// https://example.com:8443/users/alice/did.json.
+func WebURL(id string) (string, error) {
+	segments := strings.Split(id, ":")
+	host, err := url.PathUnescape(segments[0])
+	if err != nil || host == "" || strings.ContainsAny(host, "/?#") {
+		return "", fmt.Errorf("invalid did:web host %q", segments[0])
+	}
+	path := "/.well-known"
+	if len(segments) > 1 {
+		path = ""
+		for _, s := range segments[1:] {
+			seg, err := url.PathUnescape(s)
+			if err != nil || seg == "" {
+				return "", fmt.Errorf("invalid did:web path segment %q", s)
+			}
+			path += "/" + url.PathEscape(seg)
+		}
+	}
+	return "https://" + host + path + "/did.json", nil
+}
+
+// resolveWeb fetches the DID document of a did:web identifier.
+func resolveWeb(did, id string, client HTTPClient) (*Document, error) {
+	docURL, err := WebURL(id)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", did, err)
+	}
+	req, err := http.NewRequest(http.MethodGet, docURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", did, err)
+	}
+	req.Header.Set("Accept", "application/did+json, application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: fetching %s: %w", did, docURL, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: reading %s: %w", did, docURL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("resolving %s: %s returned HTTP %d", did, docURL, resp.StatusCode)
+	}
+
+	var doc Document
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("resolving %s: parsing DID document: %w", did, err)
+	}
+	if doc.ID != did {
+		return nil, fmt.Errorf("resolving %s: DID document id %q does not match", did, doc.ID)
+	}
+	return &doc, nil
+}
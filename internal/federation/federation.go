@@ -0,0 +1,243 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package federation resolves and verifies OpenID Federation 1.0 trust
+// chains: it fetches entity configurations and subordinate statements, checks
+// their signatures up to a configured trust anchor, and applies the metadata
+// policies of the chain to the leaf entity's metadata.
+package federation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/jsonutil"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
+)
+
+const (
+	// EntityConfigurationPath is the well-known path of entity configurations.
+	EntityConfigurationPath = "/.well-known/openid-federation"
+
+	// VerifierEntityType is the entity type of OID4VP verifier metadata.
+	VerifierEntityType = "openid_credential_verifier"
+
+	entityStatementType = "entity-statement+jwt"
+)
+
+// HTTPClient fetches entity statements.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// EntityStatement is a decoded entity configuration (iss == sub) or
+// subordinate statement.
+type EntityStatement struct {
+	Raw                string
+	Header             map[string]any
+	Payload            map[string]any
+	Issuer             string
+	Subject            string
+	ExpiresAt          time.Time
+	JWKS               map[string]any
+	Metadata           map[string]any
+	MetadataPolicy     map[string]any
+	MetadataPolicyCrit []string
+	AuthorityHints     []string
+}
+
+// ParseEntityStatement decodes an entity statement JWT without verifying it.
+func ParseEntityStatement(raw string) (*EntityStatement, error) {
+	raw = strings.TrimSpace(raw)
+	header, payload, _, err := format.ParseJWTParts(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing entity statement: %w", err)
+	}
+	if typ := jsonutil.GetString(header, "typ"); typ != entityStatementType {
+		return nil, fmt.Errorf("entity statement has typ %q, expected %s", typ, entityStatementType)
+	}
+
+	s := &EntityStatement{
+		Raw:            raw,
+		Header:         header,
+		Payload:        payload,
+		Issuer:         jsonutil.GetString(payload, "iss"),
+		Subject:        jsonutil.GetString(payload, "sub"),
+		JWKS:           jsonutil.GetMap(payload, "jwks"),
+		Metadata:       jsonutil.GetMap(payload, "metadata"),
+		MetadataPolicy: jsonutil.GetMap(payload, "metadata_policy"),
+	}
+	if s.Issuer == "" || s.Subject == "" {
+		return nil, fmt.Errorf("entity statement is missing iss or sub")
+	}
+	exp, ok := jsonutil.GetFloat64(payload, "exp")
+	if !ok {
+		return nil, fmt.Errorf("entity statement of %s is missing exp", s.Subject)
+	}
+	s.ExpiresAt = time.Unix(int64(exp), 0)
+	if len(jsonutil.GetArray(s.JWKS, "keys")) == 0 {
+		return nil, fmt.Errorf("entity statement of %s has no jwks", s.Subject)
+	}
+	for _, v := range jsonutil.GetArray(payload, "authority_hints") {
+		if hint, ok := v.(string); ok {
+			s.AuthorityHints = append(s.AuthorityHints, hint)
+		}
+	}
+	for _, v := range jsonutil.GetArray(payload, "metadata_policy_crit") {
+		if op, ok := v.(string); ok {
+			s.MetadataPolicyCrit = append(s.MetadataPolicyCrit, op)
+		}
+	}
+	return s, nil
+}
+
+// VerifySignature checks the statement's signature with the key of jwks its
+// kid header names, or the only key if the header has no kid.
+func (s *EntityStatement) VerifySignature(jwks map[string]any) error {
+	kid := jsonutil.GetString(s.Header, "kid")
+	jwk, err := FindJWK(jwks, kid)
+	if err != nil {
+		return fmt.Errorf("entity statement of %s issued by %s: %w", s.Subject, s.Issuer, err)
+	}
+	data, err := json.Marshal(jwk)
+	if err != nil {
+		return err
+	}
+	pub, err := keys.ParseJWK(data)
+	if err != nil {
+		return fmt.Errorf("entity statement of %s issued by %s: %w", s.Subject, s.Issuer, err)
+	}
+	parts := strings.Split(s.Raw, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("entity statement of %s issued by %s: not a compact JWS", s.Subject, s.Issuer)
+	}
+	sig, err := format.DecodeBase64URL(parts[2])
+	if err != nil {
+		return fmt.Errorf("entity statement of %s issued by %s: decoding signature: %w", s.Subject, s.Issuer, err)
+	}
+	alg := keys.Algorithm(jsonutil.GetString(s.Header, "alg"))
+	if err := keys.VerifyJWS(pub, alg, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return fmt.Errorf("entity statement of %s issued by %s: signature verification failed: %w", s.Subject, s.Issuer, err)
+	}
+	return nil
+}
+
+// FetchEndpoint returns the federation_fetch_endpoint of an entity
+// configuration's federation_entity metadata.
+func (s *EntityStatement) FetchEndpoint() string {
+	return jsonutil.GetString(jsonutil.GetMap(s.Metadata, "federation_entity"), "federation_fetch_endpoint")
+}
+
+// FindJWK returns the key of a JWK Set with the given kid, or its only key
+// if kid is empty.
+func FindJWK(jwks map[string]any, kid string) (map[string]any, error) {
+	keySet := jsonutil.GetArray(jwks, "keys")
+	if kid == "" {
+		if len(keySet) != 1 {
+			return nil, fmt.Errorf("no kid header to select one of %d keys", len(keySet))
+		}
+		jwk, ok := keySet[0].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("jwks key is not an object")
+		}
+		return jwk, nil
+	}
+	for _, k := range keySet {
+		if jwk, ok := k.(map[string]any); ok && jsonutil.GetString(jwk, "kid") == kid {
+			return jwk, nil
+		}
+	}
+	return nil, fmt.Errorf("no key with kid %q in jwks", kid)
+}
+
+// TrustAnchor is a trust anchor the wallet accepts, with the keys it expects
+// the trust anchor to sign with.
+type TrustAnchor struct {
+	EntityID string
+	JWKS     map[string]any
+}
+
+// LoadTrustAnchor loads a trust anchor from a file or an http(s) URL holding
+// either the trust anchor's entity configuration JWT or a JSON object with
+// "entity_id" and "jwks". An entity configuration must be self-signed.
+func LoadTrustAnchor(source string, client HTTPClient) (*TrustAnchor, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://") {
+		data, err = fetch(source, client)
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading trust anchor %s: %w", source, err)
+	}
+
+	content := strings.TrimSpace(string(data))
+	if strings.HasPrefix(content, "{") {
+		var ta struct {
+			EntityID string         `json:"entity_id"`
+			JWKS     map[string]any `json:"jwks"`
+		}
+		if err := json.Unmarshal(data, &ta); err != nil {
+			return nil, fmt.Errorf("loading trust anchor %s: %w", source, err)
+		}
+		if ta.EntityID == "" || len(jsonutil.GetArray(ta.JWKS, "keys")) == 0 {
+			return nil, fmt.Errorf("loading trust anchor %s: entity_id and jwks are required", source)
+		}
+		return &TrustAnchor{EntityID: ta.EntityID, JWKS: ta.JWKS}, nil
+	}
+
+	ec, err := ParseEntityStatement(content)
+	if err != nil {
+		return nil, fmt.Errorf("loading trust anchor %s: %w", source, err)
+	}
+	if ec.Issuer != ec.Subject {
+		return nil, fmt.Errorf("loading trust anchor %s: not an entity configuration (iss %s, sub %s)", source, ec.Issuer, ec.Subject)
+	}
+	if err := ec.VerifySignature(ec.JWKS); err != nil {
+		return nil, fmt.Errorf("loading trust anchor %s: %w", source, err)
+	}
+	return &TrustAnchor{EntityID: ec.Subject, JWKS: ec.JWKS}, nil
+}
+
+// fetch GETs a URL and returns the body of a 200 response.
+func fetch(url string, client HTTPClient) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/"+entityStatementType)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: HTTP %d", url, resp.StatusCode)
+	}
+	return body, nil
+}
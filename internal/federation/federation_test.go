@@ -0,0 +1,275 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package federation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+)
+
+// testEntity is an entity of a stand-in federation.
+type testEntity struct {
+	key            *ecdsa.PrivateKey
+	authorityHints []string
+	metadata       map[string]any
+	// subordinates maps subordinate entity IDs to extra claims of the
+	// statements this entity issues about them.
+	subordinates map[string]map[string]any
+}
+
+// testFederation serves entity configurations at <id>/.well-known/openid-federation
+// and subordinate statements at <id>/fetch for entities named by path.
+type testFederation struct {
+	srv      *httptest.Server
+	entities map[string]*testEntity
+}
+
+func newTestFederation(t *testing.T) *testFederation {
+	t.Helper()
+	f := &testFederation{entities: map[string]*testEntity{}}
+	f.srv = httptest.NewTLSServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+// add registers an entity at path and returns its entity ID.
+func (f *testFederation) add(t *testing.T, path string, authorityHints ...string) (string, *testEntity) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := f.srv.URL + "/" + path
+	e := &testEntity{
+		key:            key,
+		authorityHints: authorityHints,
+		metadata: map[string]any{
+			"federation_entity": map[string]any{"federation_fetch_endpoint": id + "/fetch"},
+		},
+		subordinates: map[string]map[string]any{},
+	}
+	f.entities[id] = e
+	return id, e
+}
+
+func (f *testFederation) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/entity-statement+jwt")
+	if id, ok := strings.CutSuffix(f.srv.URL+r.URL.Path, EntityConfigurationPath); ok {
+		e := f.entities[id]
+		if e == nil {
+			http.NotFound(w, r)
+			return
+		}
+		claims := map[string]any{"metadata": e.metadata}
+		if len(e.authorityHints) > 0 {
+			claims["authority_hints"] = e.authorityHints
+		}
+		claims["jwks"] = testJWKS(&e.key.PublicKey)
+		w.Write([]byte(signTestStatement(e.key, id, id, claims)))
+		return
+	}
+	if id, ok := strings.CutSuffix(f.srv.URL+r.URL.Path, "/fetch"); ok {
+		sub := r.URL.Query().Get("sub")
+		e := f.entities[id]
+		if e == nil || e.subordinates[sub] == nil {
+			http.NotFound(w, r)
+			return
+		}
+		claims := e.subordinates[sub]
+		if _, ok := claims["jwks"]; !ok {
+			claims["jwks"] = testJWKS(&f.entities[sub].key.PublicKey)
+		}
+		w.Write([]byte(signTestStatement(e.key, id, sub, claims)))
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func (f *testFederation) anchor(id string) TrustAnchor {
+	return TrustAnchor{EntityID: id, JWKS: testJWKS(&f.entities[id].key.PublicKey)}
+}
+
+func testJWKS(pub *ecdsa.PublicKey) map[string]any {
+	return map[string]any{"keys": []any{map[string]any{
+		"kty": "EC",
+		"crv": "P-256",
+		"kid": "k1",
+		"x":   format.EncodeBase64URL(pub.X.FillBytes(make([]byte, 32))),
+		"y":   format.EncodeBase64URL(pub.Y.FillBytes(make([]byte, 32))),
+	}}}
+}
+
+// signTestStatement signs an entity statement about sub with key "k1".
+func signTestStatement(key *ecdsa.PrivateKey, iss, sub string, claims map[string]any) string {
+	now := time.Now()
+	payload := map[string]any{
+		"iss": iss,
+		"sub": sub,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		payload[k] = v
+	}
+	headerJSON, _ := json.Marshal(map[string]any{"alg": "ES256", "typ": "entity-statement+jwt", "kid": "k1"})
+	payloadJSON, _ := json.Marshal(payload)
+	sigInput := format.EncodeBase64URL(headerJSON) + "." + format.EncodeBase64URL(payloadJSON)
+	digest := sha256.Sum256([]byte(sigInput))
+	r, s, _ := ecdsa.Sign(rand.Reader, key, digest[:])
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return sigInput + "." + format.EncodeBase64URL(sig)
+}
+
+func TestResolveTrustChain(t *testing.T) {
+	f := newTestFederation(t)
+	taID, ta := f.add(t, "ta")
+	imID, im := f.add(t, "intermediate", taID)
+	leafID, leaf := f.add(t, "verifier", imID)
+	leaf.metadata["openid_credential_verifier"] = map[string]any{
+		"client_name":          "Test Verifier",
+		"vp_formats_supported": map[string]any{"dc+sd-jwt": map[string]any{}},
+		"response_types":       []any{"vp_token", "code"},
+	}
+	ta.subordinates[imID] = map[string]any{
+		"metadata_policy": map[string]any{
+			"openid_credential_verifier": map[string]any{
+				"response_types": map[string]any{"subset_of": []any{"vp_token", "vp_token id_token"}},
+				"contacts":       map[string]any{"add": []any{"ops@ta.example"}},
+			},
+		},
+	}
+	im.subordinates[leafID] = map[string]any{
+		"metadata": map[string]any{
+			"openid_credential_verifier": map[string]any{"organization_name": "Intermediate Org"},
+		},
+		"metadata_policy": map[string]any{
+			"openid_credential_verifier": map[string]any{
+				"client_name": map[string]any{"essential": true},
+				"contacts":    map[string]any{"add": []any{"ops@intermediate.example"}},
+			},
+		},
+	}
+
+	chain, err := ResolveTrustChain(leafID, []TrustAnchor{f.anchor(taID)}, f.srv.Client())
+	if err != nil {
+		t.Fatalf("ResolveTrustChain: %v", err)
+	}
+	if chain.TrustAnchor != taID || len(chain.Statements) != 4 {
+		t.Fatalf("unexpected chain to %s with %d statements", chain.TrustAnchor, len(chain.Statements))
+	}
+
+	verifier, _ := chain.Metadata["openid_credential_verifier"].(map[string]any)
+	want := map[string]any{
+		"client_name":          "Test Verifier",
+		"organization_name":    "Intermediate Org",
+		"vp_formats_supported": map[string]any{"dc+sd-jwt": map[string]any{}},
+		"response_types":       []any{"vp_token"},
+		"contacts":             []any{"ops@ta.example", "ops@intermediate.example"},
+	}
+	if !reflect.DeepEqual(verifier, want) {
+		t.Errorf("resolved metadata = %v, want %v", verifier, want)
+	}
+}
+
+func TestResolveTrustChain_Failures(t *testing.T) {
+	f := newTestFederation(t)
+	taID, ta := f.add(t, "ta")
+	leafID, _ := f.add(t, "verifier", taID)
+	ta.subordinates[leafID] = map[string]any{}
+	orphanID, _ := f.add(t, "orphan", taID)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	tests := []struct {
+		name    string
+		entity  string
+		anchors []TrustAnchor
+		want    string
+	}{
+		{"no anchors", leafID, nil, "no trust anchors configured"},
+		{"unknown anchor", leafID, []TrustAnchor{{EntityID: f.srv.URL + "/elsewhere", JWKS: testJWKS(&otherKey.PublicKey)}}, "is not a configured trust anchor"},
+		{"anchor key mismatch", leafID, []TrustAnchor{{EntityID: taID, JWKS: testJWKS(&otherKey.PublicKey)}}, "signature verification failed"},
+		{"no subordinate statement", orphanID, []TrustAnchor{f.anchor(taID)}, "HTTP 404"},
+		{"unknown entity", f.srv.URL + "/missing", []TrustAnchor{f.anchor(taID)}, "HTTP 404"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ResolveTrustChain(tt.entity, tt.anchors, f.srv.Client())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestResolveTrustChain_LeafKeyNotVouchedFor(t *testing.T) {
+	f := newTestFederation(t)
+	taID, ta := f.add(t, "ta")
+	leafID, _ := f.add(t, "verifier", taID)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	// The trust anchor lists a different key for the verifier.
+	ta.subordinates[leafID] = map[string]any{"jwks": testJWKS(&otherKey.PublicKey)}
+
+	_, err := ResolveTrustChain(leafID, []TrustAnchor{f.anchor(taID)}, f.srv.Client())
+	if err == nil || !strings.Contains(err.Error(), "keys from the subordinate statement") {
+		t.Errorf("expected the leaf signature to be rejected, got %v", err)
+	}
+}
+
+func TestLoadTrustAnchor(t *testing.T) {
+	f := newTestFederation(t)
+	taID, ta := f.add(t, "ta")
+
+	fromURL, err := LoadTrustAnchor(taID+EntityConfigurationPath, f.srv.Client())
+	if err != nil {
+		t.Fatalf("LoadTrustAnchor(URL): %v", err)
+	}
+	if fromURL.EntityID != taID || !reflect.DeepEqual(fromURL.JWKS, testJWKS(&ta.key.PublicKey)) {
+		t.Errorf("unexpected trust anchor %+v", fromURL)
+	}
+
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "ta.json")
+	data, _ := json.Marshal(map[string]any{"entity_id": taID, "jwks": testJWKS(&ta.key.PublicKey)})
+	os.WriteFile(jsonPath, data, 0o600)
+	fromFile, err := LoadTrustAnchor(jsonPath, nil)
+	if err != nil {
+		t.Fatalf("LoadTrustAnchor(file): %v", err)
+	}
+	if fromFile.EntityID != taID {
+		t.Errorf("entity ID = %s, want %s", fromFile.EntityID, taID)
+	}
+
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	forged := filepath.Join(dir, "forged.jwt")
+	os.WriteFile(forged, []byte(signTestStatement(otherKey, taID, taID, map[string]any{"jwks": testJWKS(&ta.key.PublicKey)})), 0o600)
+	if _, err := LoadTrustAnchor(forged, nil); err == nil {
+		t.Error("expected an entity configuration not signed with its own key to be rejected")
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package federation
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// policyOperators are the metadata policy operators of OpenID Federation 1.0
+// Section 6.1.3, in the order they are applied.
+var policyOperators = []string{"value", "add", "default", "one_of", "subset_of", "superset_of", "essential"}
+
+// resolveMetadata returns the leaf's metadata with the metadata of its
+// immediate superior's statement merged in and the combined metadata policy
+// of the subordinate statements applied. subordinates run from the statement
+// about the leaf up to the one issued by the trust anchor.
+func resolveMetadata(leaf *EntityStatement, subordinates []*EntityStatement) (map[string]any, error) {
+	metadata := cloneJSON(leaf.Metadata)
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	if len(subordinates) > 0 {
+		for entityType, v := range subordinates[0].Metadata {
+			override, _ := v.(map[string]any)
+			typed, _ := metadata[entityType].(map[string]any)
+			if typed == nil {
+				typed = map[string]any{}
+				metadata[entityType] = typed
+			}
+			for name, value := range cloneJSON(override) {
+				typed[name] = value
+			}
+		}
+	}
+
+	policy := map[string]any{}
+	for i := len(subordinates) - 1; i >= 0; i-- {
+		merged, err := MergePolicies(policy, subordinates[i].MetadataPolicy)
+		if err != nil {
+			return nil, fmt.Errorf("metadata policy of %s: %w", subordinates[i].Issuer, err)
+		}
+		policy = merged
+	}
+
+	for entityType, v := range metadata {
+		typed, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		typePolicy, _ := policy[entityType].(map[string]any)
+		if err := ApplyPolicy(typed, typePolicy); err != nil {
+			return nil, fmt.Errorf("%s metadata: %w", entityType, err)
+		}
+	}
+	return metadata, nil
+}
+
+// MergePolicies combines a superior's metadata policy with the policy of the
+// statement below it (Section 6.1.4.1). Both map entity types to parameters
+// to operators. Conflicting value or default operators and one_of operators
+// without common values are errors.
+func MergePolicies(superior, subordinate map[string]any) (map[string]any, error) {
+	merged := cloneJSON(superior)
+	if merged == nil {
+		merged = map[string]any{}
+	}
+	for entityType, v := range subordinate {
+		params, _ := v.(map[string]any)
+		typed, _ := merged[entityType].(map[string]any)
+		if typed == nil {
+			typed = map[string]any{}
+			merged[entityType] = typed
+		}
+		for name, ops := range params {
+			subOps, _ := ops.(map[string]any)
+			supOps, _ := typed[name].(map[string]any)
+			combined, err := mergeOperators(supOps, subOps)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", entityType, name, err)
+			}
+			typed[name] = combined
+		}
+	}
+	return merged, nil
+}
+
+func mergeOperators(superior, subordinate map[string]any) (map[string]any, error) {
+	merged := cloneJSON(superior)
+	if merged == nil {
+		merged = map[string]any{}
+	}
+	for op, sub := range cloneJSON(subordinate) {
+		sup, exists := merged[op]
+		if !exists {
+			merged[op] = sub
+			continue
+		}
+		switch op {
+		case "value", "default":
+			if !reflect.DeepEqual(sup, sub) {
+				return nil, fmt.Errorf("conflicting %s operators %v and %v", op, sup, sub)
+			}
+		case "add", "superset_of":
+			merged[op] = union(toArray(sup), toArray(sub))
+		case "one_of":
+			common := intersect(toArray(sup), toArray(sub))
+			if len(common) == 0 {
+				return nil, fmt.Errorf("one_of operators %v and %v have no value in common", sup, sub)
+			}
+			merged[op] = common
+		case "subset_of":
+			merged[op] = intersect(toArray(sup), toArray(sub))
+		case "essential":
+			supB, _ := sup.(bool)
+			subB, _ := sub.(bool)
+			merged[op] = supB || subB
+		default:
+			// Unknown operators are ignored unless listed in
+			// metadata_policy_crit, which resolution rejects.
+			merged[op] = sub
+		}
+	}
+	return merged, nil
+}
+
+// ApplyPolicy applies the metadata policy of one entity type to its metadata
+// in place (Section 6.1.4.2). A parameter violating one_of or superset_of, or
+// an essential parameter that ends up absent, is an error.
+func ApplyPolicy(metadata, policy map[string]any) error {
+	for name, v := range policy {
+		ops, _ := v.(map[string]any)
+		if value, ok := ops["value"]; ok {
+			if value == nil {
+				delete(metadata, name)
+			} else {
+				metadata[name] = value
+			}
+		}
+		if add, ok := ops["add"]; ok {
+			metadata[name] = union(toArray(metadata[name]), toArray(add))
+		}
+		if def, ok := ops["default"]; ok {
+			if _, present := metadata[name]; !present {
+				metadata[name] = def
+			}
+		}
+
+		current, present := metadata[name]
+		if oneOf, ok := ops["one_of"]; ok && present && !containsValue(toArray(oneOf), current) {
+			return fmt.Errorf("%s %v is not one of %v", name, current, oneOf)
+		}
+		if subsetOf, ok := ops["subset_of"]; ok && present {
+			metadata[name] = intersect(toArray(current), toArray(subsetOf))
+		}
+		if supersetOf, ok := ops["superset_of"]; ok && present {
+			for _, required := range toArray(supersetOf) {
+				if !containsValue(toArray(metadata[name]), required) {
+					return fmt.Errorf("%s %v does not contain %v", name, metadata[name], required)
+				}
+			}
+		}
+		if essential, _ := ops["essential"].(bool); essential {
+			if _, present := metadata[name]; !present {
+				return fmt.Errorf("essential parameter %s is missing", name)
+			}
+		}
+	}
+	return nil
+}
+
+func toArray(v any) []any {
+	switch a := v.(type) {
+	case nil:
+		return nil
+	case []any:
+		return a
+	default:
+		return []any{a}
+	}
+}
+
+func containsValue(values []any, v any) bool {
+	for _, candidate := range values {
+		if reflect.DeepEqual(candidate, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func union(a, b []any) []any {
+	result := append([]any{}, a...)
+	for _, v := range b {
+		if !containsValue(result, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func intersect(a, b []any) []any {
+	result := []any{}
+	for _, v := range a {
+		if containsValue(b, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// cloneJSON deep-copies a decoded JSON object.
+func cloneJSON(m map[string]any) map[string]any {
+	if m == nil {
+		return nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil
+	}
+	var out map[string]any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil
+	}
+	return out
+}
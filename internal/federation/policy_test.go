@@ -0,0 +1,101 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package federation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergePolicies(t *testing.T) {
+	superior := map[string]any{"openid_credential_verifier": map[string]any{
+		"response_types": map[string]any{"one_of": []any{"vp_token", "code"}, "essential": false},
+		"contacts":       map[string]any{"superset_of": []any{"a"}},
+	}}
+	subordinate := map[string]any{"openid_credential_verifier": map[string]any{
+		"response_types": map[string]any{"one_of": []any{"vp_token"}, "essential": true},
+		"contacts":       map[string]any{"superset_of": []any{"b"}},
+	}}
+	merged, err := MergePolicies(superior, subordinate)
+	if err != nil {
+		t.Fatalf("MergePolicies: %v", err)
+	}
+	want := map[string]any{"openid_credential_verifier": map[string]any{
+		"response_types": map[string]any{"one_of": []any{"vp_token"}, "essential": true},
+		"contacts":       map[string]any{"superset_of": []any{"a", "b"}},
+	}}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("merged = %v, want %v", merged, want)
+	}
+
+	conflicts := []struct {
+		name     string
+		sup, sub map[string]any
+		want     string
+	}{
+		{"value", map[string]any{"value": "a"}, map[string]any{"value": "b"}, "conflicting value operators"},
+		{"default", map[string]any{"default": "a"}, map[string]any{"default": "b"}, "conflicting default operators"},
+		{"one_of", map[string]any{"one_of": []any{"a"}}, map[string]any{"one_of": []any{"b"}}, "no value in common"},
+	}
+	for _, tt := range conflicts {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := MergePolicies(
+				map[string]any{"t": map[string]any{"p": tt.sup}},
+				map[string]any{"t": map[string]any{"p": tt.sub}},
+			)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestApplyPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]any
+		policy   map[string]any
+		want     map[string]any
+		err      string
+	}{
+		{"value replaces", map[string]any{"p": "a"}, map[string]any{"p": map[string]any{"value": "b"}}, map[string]any{"p": "b"}, ""},
+		{"null value removes", map[string]any{"p": "a"}, map[string]any{"p": map[string]any{"value": nil}}, map[string]any{}, ""},
+		{"add", map[string]any{"p": []any{"a"}}, map[string]any{"p": map[string]any{"add": []any{"a", "b"}}}, map[string]any{"p": []any{"a", "b"}}, ""},
+		{"default when absent", map[string]any{}, map[string]any{"p": map[string]any{"default": "d"}}, map[string]any{"p": "d"}, ""},
+		{"default keeps value", map[string]any{"p": "a"}, map[string]any{"p": map[string]any{"default": "d"}}, map[string]any{"p": "a"}, ""},
+		{"subset_of", map[string]any{"p": []any{"a", "b"}}, map[string]any{"p": map[string]any{"subset_of": []any{"b", "c"}}}, map[string]any{"p": []any{"b"}}, ""},
+		{"one_of violated", map[string]any{"p": "x"}, map[string]any{"p": map[string]any{"one_of": []any{"a"}}}, nil, "is not one of"},
+		{"superset_of violated", map[string]any{"p": []any{"a"}}, map[string]any{"p": map[string]any{"superset_of": []any{"a", "b"}}}, nil, "does not contain"},
+		{"essential missing", map[string]any{}, map[string]any{"p": map[string]any{"essential": true}}, nil, "essential parameter p is missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ApplyPolicy(tt.metadata, tt.policy)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyPolicy: %v", err)
+			}
+			if !reflect.DeepEqual(tt.metadata, tt.want) {
+				t.Errorf("metadata = %v, want %v", tt.metadata, tt.want)
+			}
+		})
+	}
+}
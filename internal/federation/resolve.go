@@ -0,0 +1,225 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package federation
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxChainLength bounds the number of superiors followed from the leaf.
+const maxChainLength = 8
+
+// TrustChain is a verified trust chain from a leaf entity to a trust anchor.
+type TrustChain struct {
+	EntityID    string
+	TrustAnchor string
+	// Statements holds the leaf's entity configuration, the subordinate
+	// statements up to the one issued by the trust anchor, and the trust
+	// anchor's entity configuration, as in the trust_chain JWS header.
+	Statements []*EntityStatement
+	// Metadata is the leaf's metadata after applying the chain's metadata
+	// policies, keyed by entity type.
+	Metadata  map[string]any
+	ExpiresAt time.Time
+}
+
+// ResolveTrustChain builds a trust chain for entityID: it fetches the entity
+// configuration, follows authority_hints through each superior's
+// federation_fetch_endpoint until a trust anchor is reached, and checks that
+// every statement is unexpired and signed by a key its superior published.
+// The trust anchor's own keys are taken from the configured anchor, not from
+// what it serves. Superiors are tried in the order of authority_hints; the
+// first chain that verifies is returned with the resolved metadata.
+func ResolveTrustChain(entityID string, anchors []TrustAnchor, client HTTPClient) (*TrustChain, error) {
+	if len(anchors) == 0 {
+		return nil, fmt.Errorf("no trust anchors configured")
+	}
+	r := &resolver{anchors: anchors, client: client, now: time.Now()}
+
+	leaf, err := r.entityConfiguration(entityID)
+	if err != nil {
+		return nil, err
+	}
+	if err := leaf.VerifySignature(leaf.JWKS); err != nil {
+		return nil, err
+	}
+
+	statements, err := r.resolve(leaf, nil)
+	if err != nil {
+		return nil, err
+	}
+	chain := &TrustChain{
+		EntityID:    entityID,
+		TrustAnchor: statements[len(statements)-1].Subject,
+		Statements:  append([]*EntityStatement{leaf}, statements...),
+	}
+	chain.ExpiresAt = leaf.ExpiresAt
+	for _, s := range chain.Statements {
+		if s.ExpiresAt.Before(chain.ExpiresAt) {
+			chain.ExpiresAt = s.ExpiresAt
+		}
+	}
+
+	chain.Metadata, err = resolveMetadata(leaf, statements[:len(statements)-1])
+	if err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+type resolver struct {
+	anchors []TrustAnchor
+	client  HTTPClient
+	now     time.Time
+}
+
+// resolve returns the statements from the subordinate statement about subject
+// up to the trust anchor's entity configuration. visited holds the entities
+// below subject to detect loops.
+func (r *resolver) resolve(subject *EntityStatement, visited []string) ([]*EntityStatement, error) {
+	visited = append(visited, subject.Subject)
+	if len(visited) > maxChainLength {
+		return nil, fmt.Errorf("no trust anchor within %d superiors of %s", maxChainLength, visited[0])
+	}
+	if len(subject.AuthorityHints) == 0 {
+		return nil, fmt.Errorf("%s has no authority_hints and is not a configured trust anchor", subject.Subject)
+	}
+
+	var errs []error
+	for _, superior := range subject.AuthorityHints {
+		if slices.Contains(visited, superior) {
+			errs = append(errs, fmt.Errorf("authority_hints of %s loop back to %s", subject.Subject, superior))
+			continue
+		}
+		statements, err := r.resolveVia(subject, superior, visited)
+		if err == nil {
+			return statements, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// resolveVia continues the chain of subject through one of its superiors.
+func (r *resolver) resolveVia(subject *EntityStatement, superiorID string, visited []string) ([]*EntityStatement, error) {
+	superior, err := r.entityConfiguration(superiorID)
+	if err != nil {
+		return nil, err
+	}
+	anchor := r.anchor(superiorID)
+	superiorKeys := superior.JWKS
+	if anchor != nil {
+		superiorKeys = anchor.JWKS
+	}
+	if err := superior.VerifySignature(superiorKeys); err != nil {
+		return nil, err
+	}
+
+	fetchEndpoint := superior.FetchEndpoint()
+	if fetchEndpoint == "" {
+		return nil, fmt.Errorf("%s has no federation_fetch_endpoint", superiorID)
+	}
+	stmt, err := r.subordinateStatement(fetchEndpoint, superiorID, subject.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if err := stmt.VerifySignature(superiorKeys); err != nil {
+		return nil, err
+	}
+	// The subject's entity configuration must be signed with a key its
+	// superior vouches for.
+	if err := subject.VerifySignature(stmt.JWKS); err != nil {
+		return nil, fmt.Errorf("%w (keys from the subordinate statement of %s)", err, superiorID)
+	}
+	for _, op := range stmt.MetadataPolicyCrit {
+		if !slices.Contains(policyOperators, op) {
+			return nil, fmt.Errorf("subordinate statement of %s by %s requires unsupported metadata policy operator %q", subject.Subject, superiorID, op)
+		}
+	}
+
+	if anchor != nil {
+		return []*EntityStatement{stmt, superior}, nil
+	}
+	rest, err := r.resolve(superior, visited)
+	if err != nil {
+		return nil, err
+	}
+	return append([]*EntityStatement{stmt}, rest...), nil
+}
+
+func (r *resolver) anchor(entityID string) *TrustAnchor {
+	for i := range r.anchors {
+		if r.anchors[i].EntityID == entityID {
+			return &r.anchors[i]
+		}
+	}
+	return nil
+}
+
+// entityConfiguration fetches and checks the entity configuration of entityID.
+func (r *resolver) entityConfiguration(entityID string) (*EntityStatement, error) {
+	body, err := fetch(strings.TrimSuffix(entityID, "/")+EntityConfigurationPath, r.client)
+	if err != nil {
+		return nil, fmt.Errorf("entity configuration of %s: %w", entityID, err)
+	}
+	ec, err := r.parse(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("entity configuration of %s: %w", entityID, err)
+	}
+	if ec.Issuer != entityID || ec.Subject != entityID {
+		return nil, fmt.Errorf("entity configuration of %s has iss %s and sub %s", entityID, ec.Issuer, ec.Subject)
+	}
+	return ec, nil
+}
+
+// subordinateStatement fetches the statement issuerID makes about subjectID.
+func (r *resolver) subordinateStatement(fetchEndpoint, issuerID, subjectID string) (*EntityStatement, error) {
+	u, err := url.Parse(fetchEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("federation_fetch_endpoint of %s: %w", issuerID, err)
+	}
+	q := u.Query()
+	q.Set("sub", subjectID)
+	u.RawQuery = q.Encode()
+
+	body, err := fetch(u.String(), r.client)
+	if err != nil {
+		return nil, fmt.Errorf("subordinate statement of %s by %s: %w", subjectID, issuerID, err)
+	}
+	stmt, err := r.parse(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("subordinate statement of %s by %s: %w", subjectID, issuerID, err)
+	}
+	if stmt.Issuer != issuerID || stmt.Subject != subjectID {
+		return nil, fmt.Errorf("subordinate statement of %s by %s has iss %s and sub %s", subjectID, issuerID, stmt.Issuer, stmt.Subject)
+	}
+	return stmt, nil
+}
+
+func (r *resolver) parse(raw string) (*EntityStatement, error) {
+	s, err := ParseEntityStatement(raw)
+	if err != nil {
+		return nil, err
+	}
+	if !s.ExpiresAt.After(r.now) {
+		return nil, fmt.Errorf("expired at %s", s.ExpiresAt.Format(time.RFC3339))
+	}
+	return s, nil
+}
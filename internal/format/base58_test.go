@@ -0,0 +1,44 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeBase58(t *testing.T) {
+	if got := EncodeBase58([]byte("Hello World!")); got != "2NEpo7TZRRrLZSi2U" {
+		t.Errorf("EncodeBase58(Hello World!) = %s", got)
+	}
+	if got := EncodeBase58([]byte{0, 0, 1}); got != "112" {
+		t.Errorf("EncodeBase58 with leading zeros = %s, want 112", got)
+	}
+}
+
+func TestDecodeBase58(t *testing.T) {
+	for _, want := range [][]byte{[]byte("Hello World!"), {0, 0, 1}, {}} {
+		got, err := DecodeBase58(EncodeBase58(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("DecodeBase58(EncodeBase58(%x)) = %x", want, got)
+		}
+	}
+	if _, err := DecodeBase58("0OIl"); err == nil {
+		t.Error("expected an error for characters outside the alphabet")
+	}
+}
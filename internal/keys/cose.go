@@ -0,0 +1,142 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/veraison/go-cose"
+)
+
+var coseAlgorithms = map[Algorithm]cose.Algorithm{
+	ES256: cose.AlgorithmES256,
+	ES384: cose.AlgorithmES384,
+	ES512: cose.AlgorithmES512,
+	EdDSA: cose.AlgorithmEdDSA,
+	RS256: cose.AlgorithmRS256,
+	PS256: cose.AlgorithmPS256,
+}
+
+// COSEAlgorithm returns the COSE algorithm identifier of alg.
+func COSEAlgorithm(alg Algorithm) (cose.Algorithm, bool) {
+	id, ok := coseAlgorithms[alg]
+	return id, ok
+}
+
+// AlgorithmFromCOSE returns the algorithm of a COSE algorithm identifier.
+func AlgorithmFromCOSE(id cose.Algorithm) (Algorithm, bool) {
+	for alg, coseID := range coseAlgorithms {
+		if coseID == id {
+			return alg, true
+		}
+	}
+	return "", false
+}
+
+// coseSigner signs COSE_Sign1 structures with SignJWS. A COSE signature over
+// the ToBeSigned bytes has the same form as a JWS signature, which also
+// covers RS256, an algorithm go-cose registers but cannot sign with.
+type coseSigner struct {
+	key crypto.Signer
+	alg Algorithm
+}
+
+func (s *coseSigner) Algorithm() cose.Algorithm { return coseAlgorithms[s.alg] }
+
+func (s *coseSigner) Sign(_ io.Reader, content []byte) ([]byte, error) {
+	return SignJWS(s.key, s.alg, content)
+}
+
+type coseVerifier struct {
+	pub crypto.PublicKey
+	alg Algorithm
+}
+
+func (v *coseVerifier) Algorithm() cose.Algorithm { return coseAlgorithms[v.alg] }
+
+func (v *coseVerifier) Verify(content, signature []byte) error {
+	return VerifyJWS(v.pub, v.alg, content, signature)
+}
+
+// COSESigner returns a COSE signer for key and alg.
+func COSESigner(key crypto.Signer, alg Algorithm) (cose.Signer, error) {
+	if _, ok := coseAlgorithms[alg]; !ok {
+		return nil, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	if !SupportsAlgorithm(key.Public(), alg) {
+		return nil, fmt.Errorf("%T key cannot sign with %s", key.Public(), alg)
+	}
+	return &coseSigner{key: key, alg: alg}, nil
+}
+
+// COSEVerifier returns a COSE verifier for a COSE algorithm identifier and a
+// public key.
+func COSEVerifier(id cose.Algorithm, pub crypto.PublicKey) (cose.Verifier, error) {
+	alg, ok := AlgorithmFromCOSE(id)
+	if !ok {
+		return nil, fmt.Errorf("unsupported COSE algorithm %v", id)
+	}
+	if !SupportsAlgorithm(pub, alg) {
+		return nil, fmt.Errorf("%T key cannot verify %s", pub, alg)
+	}
+	return &coseVerifier{pub: pub, alg: alg}, nil
+}
+
+// COSEKey encodes a public key as a COSE_Key (RFC 9052 §7) with integer
+// labels: EC2 keys with crv, x and y, OKP keys with crv and x, RSA keys with
+// n and e.
+func COSEKey(pub crypto.PublicKey) (map[any]any, error) {
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		var crv int64
+		switch key.Curve.Params().Name {
+		case "P-256":
+			crv = 1
+		case "P-384":
+			crv = 2
+		case "P-521":
+			crv = 3
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", key.Curve.Params().Name)
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		return map[any]any{
+			int64(1):  int64(2), // kty: EC2
+			int64(-1): crv,
+			int64(-2): key.X.FillBytes(make([]byte, size)),
+			int64(-3): key.Y.FillBytes(make([]byte, size)),
+		}, nil
+	case ed25519.PublicKey:
+		return map[any]any{
+			int64(1):  int64(1), // kty: OKP
+			int64(-1): int64(6), // crv: Ed25519
+			int64(-2): []byte(key),
+		}, nil
+	case *rsa.PublicKey:
+		return map[any]any{
+			int64(1):  int64(3), // kty: RSA
+			int64(-1): key.N.Bytes(),
+			int64(-2): big.NewInt(int64(key.E)).Bytes(),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+}
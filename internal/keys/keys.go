@@ -18,6 +18,7 @@ package keys
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/x509"
@@ -48,6 +49,20 @@ func LoadPrivateKey(path string) (crypto.PrivateKey, error) {
 	return ParsePrivateKey(data)
 }
 
+// LoadSigner loads a private key that can sign JWS and COSE structures: an
+// EC key on P-256, P-384 or P-521, an Ed25519 key, or an RSA key.
+func LoadSigner(path string) (crypto.Signer, error) {
+	key, err := LoadPrivateKey(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok || len(KeyAlgorithms(signer.Public())) == 0 {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
 // ParsePrivateKey parses a private key from PEM or JWK bytes.
 func ParsePrivateKey(data []byte) (crypto.PrivateKey, error) {
 	block, _ := pem.Decode(data)
@@ -86,6 +101,8 @@ func ParseJWKPrivate(data []byte) (crypto.PrivateKey, error) {
 		return parseECJWKPrivate(jwk)
 	case "RSA":
 		return parseRSAJWKPrivate(jwk)
+	case "OKP":
+		return parseOKPJWKPrivate(jwk)
 	default:
 		return nil, fmt.Errorf("unsupported JWK key type: %s", kty)
 	}
@@ -110,6 +127,29 @@ func parseECJWKPrivate(jwk map[string]any) (*ecdsa.PrivateKey, error) {
 	}, nil
 }
 
+func parseOKPJWKPrivate(jwk map[string]any) (ed25519.PrivateKey, error) {
+	pub, err := parseOKPJWK(jwk)
+	if err != nil {
+		return nil, err
+	}
+	dB64, _ := jwk["d"].(string)
+	if dB64 == "" {
+		return nil, fmt.Errorf("OKP JWK missing private key parameter 'd'")
+	}
+	seed, err := format.DecodeBase64URL(dB64)
+	if err != nil {
+		return nil, fmt.Errorf("decoding d: %w", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid Ed25519 private key length %d", len(seed))
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	if !pub.Equal(key.Public()) {
+		return nil, fmt.Errorf("OKP JWK 'd' does not match 'x'")
+	}
+	return key, nil
+}
+
 func parseRSAJWKPrivate(jwk map[string]any) (*rsa.PrivateKey, error) {
 	pub, err := parseRSAJWK(jwk)
 	if err != nil {
@@ -185,11 +225,29 @@ func ParseJWK(data []byte) (crypto.PublicKey, error) {
 		return parseECJWK(jwk)
 	case "RSA":
 		return parseRSAJWK(jwk)
+	case "OKP":
+		return parseOKPJWK(jwk)
 	default:
 		return nil, fmt.Errorf("unsupported JWK key type: %s", kty)
 	}
 }
 
+func parseOKPJWK(jwk map[string]any) (ed25519.PublicKey, error) {
+	crv, _ := jwk["crv"].(string)
+	if crv != "Ed25519" {
+		return nil, fmt.Errorf("unsupported curve: %s", crv)
+	}
+	xB64, _ := jwk["x"].(string)
+	x, err := format.DecodeBase64URL(xB64)
+	if err != nil {
+		return nil, fmt.Errorf("decoding x: %w", err)
+	}
+	if len(x) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid Ed25519 key length %d", len(x))
+	}
+	return ed25519.PublicKey(x), nil
+}
+
 func parseECJWK(jwk map[string]any) (*ecdsa.PublicKey, error) {
 	crv, _ := jwk["crv"].(string)
 	xB64, _ := jwk["x"].(string)
@@ -16,6 +16,7 @@ package keys
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
@@ -111,8 +112,25 @@ func TestParseJWK_EC(t *testing.T) {
 	}
 }
 
+func TestParseJWK_OKP(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	data, _ := json.Marshal(map[string]any{"kty": "OKP", "crv": "Ed25519", "x": format.EncodeBase64URL(pub)})
+
+	got, err := ParseJWK(data)
+	if err != nil {
+		t.Fatalf("ParseJWK() error: %v", err)
+	}
+	if !pub.Equal(got) {
+		t.Error("parsed key does not match original")
+	}
+
+	if _, err := ParseJWK([]byte(`{"kty":"OKP","crv":"X25519","x":"AAAA"}`)); err == nil {
+		t.Error("expected error for unsupported OKP curve")
+	}
+}
+
 func TestParseJWK_UnsupportedType(t *testing.T) {
-	data := []byte(`{"kty":"OKP","crv":"Ed25519"}`)
+	data := []byte(`{"kty":"oct","k":"c2VjcmV0"}`)
 	_, err := ParseJWK(data)
 	if err == nil {
 		t.Error("expected error for unsupported key type")
@@ -511,3 +529,48 @@ func TestParseJWK_InvalidJSON(t *testing.T) {
 		t.Error("expected error for invalid JSON")
 	}
 }
+
+func TestParseJWKPrivate_OKP(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, _ := json.Marshal(map[string]string{
+		"kty": "OKP",
+		"crv": "Ed25519",
+		"x":   format.EncodeBase64URL(pub),
+		"d":   format.EncodeBase64URL(priv.Seed()),
+	})
+
+	key, err := ParseJWKPrivate(jwk)
+	if err != nil {
+		t.Fatalf("ParseJWKPrivate() error: %v", err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok || !edKey.Equal(priv) {
+		t.Errorf("expected the Ed25519 private key, got %T", key)
+	}
+}
+
+func TestLoadSigner_Ed25519(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := LoadSigner(path)
+	if err != nil {
+		t.Fatalf("LoadSigner() error: %v", err)
+	}
+	if got := KeyAlgorithms(signer.Public()); len(got) != 1 || got[0] != EdDSA {
+		t.Errorf("KeyAlgorithms() = %v, want [EdDSA]", got)
+	}
+}
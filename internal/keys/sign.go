@@ -0,0 +1,268 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512" // SHA-384 and SHA-512 for ES384 and ES512
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+)
+
+// Algorithm is a JWS algorithm the tool can sign with.
+type Algorithm string
+
+const (
+	ES256 Algorithm = "ES256"
+	ES384 Algorithm = "ES384"
+	ES512 Algorithm = "ES512"
+	EdDSA Algorithm = "EdDSA"
+	RS256 Algorithm = "RS256"
+	PS256 Algorithm = "PS256"
+)
+
+// Algorithms lists the supported signing algorithms, ES256 (the default) first.
+var Algorithms = []Algorithm{ES256, ES384, ES512, EdDSA, RS256, PS256}
+
+// Algorithms VerifyJWS accepts besides the signing algorithms: RSA with
+// SHA-384 and SHA-512, and the fully-specified Ed25519 (RFC 9864).
+const (
+	RS384   Algorithm = "RS384"
+	RS512   Algorithm = "RS512"
+	PS384   Algorithm = "PS384"
+	PS512   Algorithm = "PS512"
+	Ed25519 Algorithm = "Ed25519"
+)
+
+// ParseAlgorithm parses an --alg flag value. An empty value selects ES256.
+func ParseAlgorithm(raw string) (Algorithm, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ES256, nil
+	}
+	for _, alg := range Algorithms {
+		if strings.EqualFold(raw, string(alg)) {
+			return alg, nil
+		}
+	}
+	return "", fmt.Errorf("invalid algorithm %q (expected ES256, ES384, ES512, EdDSA, RS256, or PS256)", raw)
+}
+
+// GenerateKey creates a private key for alg: an EC key on the matching
+// curve, an Ed25519 key, or a 2048-bit RSA key for RS256 and PS256.
+func GenerateKey(alg Algorithm) (crypto.Signer, error) {
+	switch alg {
+	case ES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case ES384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case ES512:
+		return ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case EdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	case RS256, PS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+}
+
+// KeyAlgorithms returns the algorithms a public key can be used with. EC
+// keys are bound to the algorithm of their curve; RSA keys sign with RS256
+// or PS256.
+func KeyAlgorithms(pub crypto.PublicKey) []Algorithm {
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return []Algorithm{ES256}
+		case elliptic.P384():
+			return []Algorithm{ES384}
+		case elliptic.P521():
+			return []Algorithm{ES512}
+		}
+	case ed25519.PublicKey:
+		return []Algorithm{EdDSA}
+	case *rsa.PublicKey:
+		return []Algorithm{RS256, PS256}
+	}
+	return nil
+}
+
+// AlgorithmFor returns the algorithm to sign with pub's private key: preferred
+// if the key supports it, otherwise the key's default algorithm.
+func AlgorithmFor(pub crypto.PublicKey, preferred Algorithm) (Algorithm, error) {
+	algs := KeyAlgorithms(pub)
+	if len(algs) == 0 {
+		return "", fmt.Errorf("unsupported key type %T", pub)
+	}
+	for _, alg := range algs {
+		if alg == preferred {
+			return alg, nil
+		}
+	}
+	return algs[0], nil
+}
+
+// SupportsAlgorithm reports whether pub can be used with alg.
+func SupportsAlgorithm(pub crypto.PublicKey, alg Algorithm) bool {
+	for _, a := range KeyAlgorithms(pub) {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// SignJWS signs a JWS signing input with alg. ECDSA signatures are returned
+// in the JWS r||s form.
+func SignJWS(key crypto.Signer, alg Algorithm, input []byte) ([]byte, error) {
+	if !SupportsAlgorithm(key.Public(), alg) {
+		return nil, fmt.Errorf("%T key cannot sign with %s", key.Public(), alg)
+	}
+	switch alg {
+	case EdDSA:
+		return key.Sign(rand.Reader, input, crypto.Hash(0))
+	case RS256:
+		digest := sha256.Sum256(input)
+		return key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	case PS256:
+		digest := sha256.Sum256(input)
+		return key.Sign(rand.Reader, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256})
+	}
+
+	hash := algorithmHash(alg)
+	h := hash.New()
+	h.Write(input)
+	der, err := key.Sign(rand.Reader, h.Sum(nil), hash)
+	if err != nil {
+		return nil, err
+	}
+	var rs struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &rs); err != nil {
+		return nil, fmt.Errorf("decoding ECDSA signature: %w", err)
+	}
+	size := (key.Public().(*ecdsa.PublicKey).Curve.Params().BitSize + 7) / 8
+	sig := make([]byte, 2*size)
+	rs.R.FillBytes(sig[:size])
+	rs.S.FillBytes(sig[size:])
+	return sig, nil
+}
+
+// VerifyJWS verifies a JWS signature made with alg. Besides the signing
+// algorithms, RSA keys verify RS384, RS512, PS384 and PS512, and Ed25519 keys
+// the Ed25519 algorithm.
+func VerifyJWS(pub crypto.PublicKey, alg Algorithm, input, sig []byte) error {
+	if !verifiesAlgorithm(pub, alg) {
+		return fmt.Errorf("%T key cannot verify %s", pub, alg)
+	}
+	switch key := pub.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, input, sig) {
+			return fmt.Errorf("%s signature invalid", alg)
+		}
+		return nil
+	case *rsa.PublicKey:
+		hash := algorithmHash(alg)
+		h := hash.New()
+		h.Write(input)
+		if strings.HasPrefix(string(alg), "PS") {
+			return rsa.VerifyPSS(key, hash, h.Sum(nil), sig, nil)
+		}
+		return rsa.VerifyPKCS1v15(key, hash, h.Sum(nil), sig)
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return fmt.Errorf("%s signature has length %d, expected %d", alg, len(sig), 2*size)
+		}
+		h := algorithmHash(alg).New()
+		h.Write(input)
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(key, h.Sum(nil), r, s) {
+			return fmt.Errorf("%s signature invalid", alg)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported key type %T", pub)
+}
+
+// verifiesAlgorithm reports whether VerifyJWS accepts alg for pub.
+func verifiesAlgorithm(pub crypto.PublicKey, alg Algorithm) bool {
+	if SupportsAlgorithm(pub, alg) {
+		return true
+	}
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return alg == RS384 || alg == RS512 || alg == PS384 || alg == PS512
+	case ed25519.PublicKey:
+		return alg == Ed25519
+	}
+	return false
+}
+
+func algorithmHash(alg Algorithm) crypto.Hash {
+	switch alg {
+	case ES384, RS384, PS384:
+		return crypto.SHA384
+	case ES512, RS512, PS512:
+		return crypto.SHA512
+	default:
+		return crypto.SHA256
+	}
+}
+
+// PublicJWK returns the JWK of a public key with the members RFC 7638 needs
+// for a thumbprint.
+func PublicJWK(pub crypto.PublicKey) (map[string]string, error) {
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		return map[string]string{
+			"kty": "EC",
+			"crv": key.Curve.Params().Name,
+			"x":   format.EncodeBase64URL(key.X.FillBytes(make([]byte, size))),
+			"y":   format.EncodeBase64URL(key.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case ed25519.PublicKey:
+		return map[string]string{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   format.EncodeBase64URL(key),
+		}, nil
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA",
+			"n":   format.EncodeBase64URL(key.N.Bytes()),
+			"e":   format.EncodeBase64URL(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keys
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+
+	"github.com/veraison/go-cose"
+)
+
+func TestParseAlgorithm(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    Algorithm
+		wantErr bool
+	}{
+		{"", ES256, false},
+		{"ES256", ES256, false},
+		{"es384", ES384, false},
+		{"ES512", ES512, false},
+		{"eddsa", EdDSA, false},
+		{"RS256", RS256, false},
+		{"ps256", PS256, false},
+		{"HS256", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAlgorithm(tt.raw)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseAlgorithm(%q) = %q, %v; want %q (error %v)", tt.raw, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSignVerifyJWS(t *testing.T) {
+	for _, alg := range Algorithms {
+		t.Run(string(alg), func(t *testing.T) {
+			key, err := GenerateKey(alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !SupportsAlgorithm(key.Public(), alg) {
+				t.Fatalf("generated key does not support %s: %v", alg, KeyAlgorithms(key.Public()))
+			}
+
+			input := []byte("header.payload")
+			sig, err := SignJWS(key, alg, input)
+			if err != nil {
+				t.Fatalf("SignJWS() error: %v", err)
+			}
+			if err := VerifyJWS(key.Public(), alg, input, sig); err != nil {
+				t.Errorf("VerifyJWS() error: %v", err)
+			}
+			if err := VerifyJWS(key.Public(), alg, []byte("header.tampered"), sig); err == nil {
+				t.Error("expected tampered input to fail verification")
+			}
+
+			jwk, err := PublicJWK(key.Public())
+			if err != nil {
+				t.Fatalf("PublicJWK() error: %v", err)
+			}
+			data, _ := json.Marshal(jwk)
+			pub, err := ParseJWK(data)
+			if err != nil {
+				t.Fatalf("ParseJWK() error: %v", err)
+			}
+			if err := VerifyJWS(pub, alg, input, sig); err != nil {
+				t.Errorf("VerifyJWS() with the JWK round-tripped key: %v", err)
+			}
+		})
+	}
+}
+
+func TestSignJWS_WrongKeyType(t *testing.T) {
+	key, err := GenerateKey(ES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SignJWS(key, ES384, []byte("input")); err == nil {
+		t.Error("expected an error signing ES384 with a P-256 key")
+	}
+	if _, err := SignJWS(key, RS256, []byte("input")); err == nil {
+		t.Error("expected an error signing RS256 with an EC key")
+	}
+}
+
+func TestVerifyJWS_VerifyOnlyAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := []byte("header.payload")
+
+	tests := []struct {
+		alg  Algorithm
+		hash crypto.Hash
+		pss  bool
+	}{
+		{RS384, crypto.SHA384, false},
+		{RS512, crypto.SHA512, false},
+		{PS384, crypto.SHA384, true},
+		{PS512, crypto.SHA512, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.alg), func(t *testing.T) {
+			h := tt.hash.New()
+			h.Write(input)
+			var opts crypto.SignerOpts = tt.hash
+			if tt.pss {
+				opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: tt.hash}
+			}
+			sig, err := rsaKey.Sign(rand.Reader, h.Sum(nil), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyJWS(rsaKey.Public(), tt.alg, input, sig); err != nil {
+				t.Errorf("VerifyJWS() error: %v", err)
+			}
+			if _, err := SignJWS(rsaKey, tt.alg, input); err == nil {
+				t.Errorf("expected %s to be verify-only", tt.alg)
+			}
+		})
+	}
+
+	edKey, err := GenerateKey(EdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := SignJWS(edKey, EdDSA, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyJWS(edKey.Public(), Ed25519, input, sig); err != nil {
+		t.Errorf("VerifyJWS() with Ed25519: %v", err)
+	}
+	if err := VerifyJWS(rsaKey.Public(), Ed25519, input, sig); err == nil {
+		t.Error("expected Ed25519 with an RSA key to fail")
+	}
+}
+
+func TestAlgorithmFor(t *testing.T) {
+	rsaKey, err := GenerateKey(RS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := GenerateKey(ES384)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		key       any
+		preferred Algorithm
+		want      Algorithm
+	}{
+		{"RSA prefers PS256", rsaKey.Public(), PS256, PS256},
+		{"RSA defaults to RS256", rsaKey.Public(), ES256, RS256},
+		{"EC key uses its curve", ecKey.Public(), ES256, ES384},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AlgorithmFor(tt.key, tt.preferred)
+			if err != nil || got != tt.want {
+				t.Errorf("AlgorithmFor() = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCOSESignerVerifier(t *testing.T) {
+	for _, alg := range Algorithms {
+		t.Run(string(alg), func(t *testing.T) {
+			key, err := GenerateKey(alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signer, err := COSESigner(key, alg)
+			if err != nil {
+				t.Fatalf("COSESigner() error: %v", err)
+			}
+			id, ok := COSEAlgorithm(alg)
+			if !ok || signer.Algorithm() != id {
+				t.Fatalf("signer algorithm = %v, want %v", signer.Algorithm(), id)
+			}
+			if back, ok := AlgorithmFromCOSE(id); !ok || back != alg {
+				t.Errorf("AlgorithmFromCOSE(%v) = %q, want %q", id, back, alg)
+			}
+
+			msg := cose.NewSign1Message()
+			msg.Headers.Protected.SetAlgorithm(id)
+			msg.Payload = []byte("payload")
+			if err := msg.Sign(nil, nil, signer); err != nil {
+				t.Fatalf("Sign() error: %v", err)
+			}
+
+			verifier, err := COSEVerifier(id, key.Public())
+			if err != nil {
+				t.Fatalf("COSEVerifier() error: %v", err)
+			}
+			if err := msg.Verify(nil, verifier); err != nil {
+				t.Errorf("Verify() error: %v", err)
+			}
+
+			coseKey, err := COSEKey(key.Public())
+			if err != nil {
+				t.Fatalf("COSEKey() error: %v", err)
+			}
+			if _, ok := coseKey[int64(1)]; !ok {
+				t.Error("COSE key is missing kty")
+			}
+		})
+	}
+}
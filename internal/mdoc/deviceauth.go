@@ -0,0 +1,150 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mdoc
+
+import (
+	"crypto/ecdsa"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// COSEAlgHMAC256 is the COSE algorithm identifier of HMAC 256/256, the MAC
+// algorithm of deviceMac (ISO 18013-5 Section 9.1.3.5).
+const COSEAlgHMAC256 = 5
+
+// DeviceAuthenticationBytes builds the payload device authentication signs or
+// MACs (ISO 18013-5 Section 9.1.3.4):
+// Tag24(["DeviceAuthentication", SessionTranscript, DocType, DeviceNameSpacesBytes]).
+func DeviceAuthenticationBytes(sessionTranscript []byte, docType string, deviceNameSpacesBytes []byte) ([]byte, error) {
+	deviceAuth, err := cbor.Marshal([]any{
+		"DeviceAuthentication",
+		cbor.RawMessage(sessionTranscript),
+		docType,
+		cbor.RawMessage(deviceNameSpacesBytes),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding DeviceAuthentication: %w", err)
+	}
+	tagged, err := cbor.Marshal(cbor.Tag{Number: 24, Content: deviceAuth})
+	if err != nil {
+		return nil, fmt.Errorf("encoding Tag24(DeviceAuthentication): %w", err)
+	}
+	return tagged, nil
+}
+
+// DeriveEMacKey derives the deviceMac key EMacKey from the ECDH shared secret
+// of one party's private and the other's public key (the device key and the
+// reader's ephemeral key, in either direction): HKDF-SHA-256 with the salt
+// SHA-256(SessionTranscriptBytes) and the info "EMacKey" (ISO 18013-5
+// Section 9.1.3.5).
+func DeriveEMacKey(priv *ecdsa.PrivateKey, pub *ecdsa.PublicKey, sessionTranscript []byte) ([]byte, error) {
+	ecdhPriv, err := priv.ECDH()
+	if err != nil {
+		return nil, fmt.Errorf("converting private key: %w", err)
+	}
+	ecdhPub, err := pub.ECDH()
+	if err != nil {
+		return nil, fmt.Errorf("converting public key: %w", err)
+	}
+	shared, err := ecdhPriv.ECDH(ecdhPub)
+	if err != nil {
+		return nil, fmt.Errorf("ECDH: %w", err)
+	}
+
+	sessionTranscriptBytes, err := cbor.Marshal(cbor.Tag{Number: 24, Content: sessionTranscript})
+	if err != nil {
+		return nil, fmt.Errorf("encoding SessionTranscriptBytes: %w", err)
+	}
+	salt := sha256.Sum256(sessionTranscriptBytes)
+	return hkdf.Key(sha256.New, shared, salt[:], "EMacKey", 32)
+}
+
+// CreateDeviceMac creates the deviceMac of a document: a COSE_Mac0 with
+// HMAC 256/256 over the DeviceAuthenticationBytes, which are detached.
+func CreateDeviceMac(key, deviceAuthBytes []byte) ([]byte, error) {
+	protected, err := cbor.Marshal(map[int64]any{1: COSEAlgHMAC256})
+	if err != nil {
+		return nil, fmt.Errorf("encoding protected header: %w", err)
+	}
+	tag, err := mac0Tag(key, protected, deviceAuthBytes)
+	if err != nil {
+		return nil, err
+	}
+	return cbor.Marshal([]any{protected, map[int64]any{}, nil, tag})
+}
+
+// verifyDeviceMac checks a COSE_Mac0 deviceMac against the
+// DeviceAuthenticationBytes it authenticates.
+func verifyDeviceMac(raw, key, deviceAuthBytes []byte) error {
+	var mac0 []cbor.RawMessage
+	if err := cborDecMode.Unmarshal(raw, &mac0); err != nil {
+		var tagged cbor.Tag
+		if tagErr := cborDecMode.Unmarshal(raw, &tagged); tagErr != nil || tagged.Number != 17 {
+			return fmt.Errorf("decoding COSE_Mac0: %w", err)
+		}
+		content, err := cbor.Marshal(tagged.Content)
+		if err != nil {
+			return fmt.Errorf("decoding COSE_Mac0: %w", err)
+		}
+		if err := cborDecMode.Unmarshal(content, &mac0); err != nil {
+			return fmt.Errorf("decoding COSE_Mac0: %w", err)
+		}
+	}
+	if len(mac0) != 4 {
+		return fmt.Errorf("COSE_Mac0 expected 4 elements, got %d", len(mac0))
+	}
+
+	var protected []byte
+	if err := cborDecMode.Unmarshal(mac0[0], &protected); err != nil {
+		return fmt.Errorf("decoding protected header: %w", err)
+	}
+	var header map[int64]any
+	if err := cborDecMode.Unmarshal(protected, &header); err != nil {
+		return fmt.Errorf("decoding protected header: %w", err)
+	}
+	if alg, _ := header[1].(int64); alg != COSEAlgHMAC256 {
+		return fmt.Errorf("unsupported deviceMac algorithm %v (expected HMAC 256/256)", header[1])
+	}
+	var tag []byte
+	if err := cborDecMode.Unmarshal(mac0[3], &tag); err != nil {
+		return fmt.Errorf("decoding MAC tag: %w", err)
+	}
+
+	expected, err := mac0Tag(key, protected, deviceAuthBytes)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(tag, expected) {
+		return fmt.Errorf("deviceMac does not match")
+	}
+	return nil
+}
+
+// mac0Tag computes the HMAC-SHA-256 tag of a COSE_Mac0 over its
+// MAC_structure ["MAC0", protected, external_aad, payload] (RFC 9052 Section
+// 6.3) with an empty external_aad.
+func mac0Tag(key, protected, payload []byte) ([]byte, error) {
+	structure, err := cbor.Marshal([]any{"MAC0", protected, []byte{}, payload})
+	if err != nil {
+		return nil, fmt.Errorf("encoding MAC_structure: %w", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(structure)
+	return mac.Sum(nil), nil
+}
@@ -98,8 +98,21 @@ func parseDeviceResponse(data []byte) (*Document, error) {
 
 func parseDeviceSigned(ds map[any]any) *DeviceSigned {
 	result := &DeviceSigned{}
+	if ns, ok := ds["nameSpaces"]; ok {
+		result.NameSpacesBytes, _ = cbor.Marshal(ns)
+	}
 	if da, ok := ds["deviceAuth"].(map[any]any); ok {
 		result.DeviceAuth = convertCBORMapToStringKeys(da)
+		if sig, ok := da["deviceSignature"]; ok {
+			// go-cose verifies the tagged COSE_Sign1
+			if _, tagged := sig.(cbor.Tag); !tagged {
+				sig = cbor.Tag{Number: 18, Content: sig}
+			}
+			result.DeviceSignature, _ = cbor.Marshal(sig)
+		}
+		if mac, ok := da["deviceMac"]; ok {
+			result.DeviceMac, _ = cbor.Marshal(mac)
+		}
 	}
 	return result
 }
@@ -32,6 +32,27 @@ type Document struct {
 // DeviceSigned contains the device-signed portion of a DeviceResponse document.
 type DeviceSigned struct {
 	DeviceAuth map[string]any
+	// NameSpacesBytes is the encoded DeviceNameSpacesBytes (Tag 24).
+	NameSpacesBytes []byte
+	// DeviceSignature and DeviceMac hold the encoded COSE_Sign1 or COSE_Mac0
+	// of the device authentication, whichever the document uses.
+	DeviceSignature []byte
+	DeviceMac       []byte
+}
+
+// Method returns the device authentication method: "deviceSignature",
+// "deviceMac", or "" if the document has neither.
+func (ds *DeviceSigned) Method() string {
+	switch {
+	case ds == nil:
+		return ""
+	case ds.DeviceMac != nil:
+		return "deviceMac"
+	case ds.DeviceSignature != nil:
+		return "deviceSignature"
+	default:
+		return ""
+	}
 }
 
 // IssuerSignedItem represents a single claim within a namespace.
@@ -55,6 +76,17 @@ type IssuerAuth struct {
 	MSO               *MSO
 }
 
+// Algorithm returns the COSE algorithm identifier of the protected header.
+func (ia *IssuerAuth) Algorithm() (int64, bool) {
+	switch v := ia.ProtectedHeader[int64(1)].(type) {
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
 // MSO is the Mobile Security Object.
 type MSO struct {
 	Version         string
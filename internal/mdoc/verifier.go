@@ -15,11 +15,19 @@
 package mdoc
 
 import (
+	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
 	"fmt"
+	"math/big"
 	"time"
 
 	"github.com/veraison/go-cose"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 )
 
 // VerifyResult contains the mDOC verification result.
@@ -32,13 +40,25 @@ type VerifyResult struct {
 	ValidFrom      *time.Time
 	ValidUntil     *time.Time
 	Signed         *time.Time
-	Errors         []string
+	// DeviceAuth is the device authentication method of a DeviceResponse
+	// document, "deviceSignature" or "deviceMac"; VerifyDeviceAuth checks it.
+	DeviceAuth string
+	Errors     []string
+}
+
+// DeviceAuthResult contains the result of verifying the device
+// authentication of a DeviceResponse document.
+type DeviceAuthResult struct {
+	Method string // "deviceSignature" or "deviceMac"
+	Valid  bool
+	Errors []string
 }
 
 // Verify verifies the mDOC issuerAuth COSE_Sign1 signature.
 func Verify(doc *Document, pubKey crypto.PublicKey) *VerifyResult {
 	result := &VerifyResult{
-		DocType: doc.DocType,
+		DocType:    doc.DocType,
+		DeviceAuth: doc.DeviceSigned.Method(),
 	}
 
 	if doc.IssuerAuth == nil {
@@ -61,17 +81,8 @@ func Verify(doc *Document, pubKey crypto.PublicKey) *VerifyResult {
 		}
 	}
 
-	// Determine algorithm from protected header
-	if doc.IssuerAuth.ProtectedHeader != nil {
-		// COSE algorithm label is 1
-		if alg, ok := doc.IssuerAuth.ProtectedHeader[int64(1)]; ok {
-			switch v := alg.(type) {
-			case int64:
-				result.Algorithm = coseAlgName(v)
-			case uint64:
-				result.Algorithm = coseAlgName(int64(v))
-			}
-		}
+	if alg, ok := doc.IssuerAuth.Algorithm(); ok {
+		result.Algorithm = coseAlgName(alg)
 	}
 
 	if result.Algorithm == "" {
@@ -92,7 +103,7 @@ func Verify(doc *Document, pubKey crypto.PublicKey) *VerifyResult {
 		return result
 	}
 
-	verifier, err := cose.NewVerifier(coseAlg, pubKey)
+	verifier, err := keys.COSEVerifier(coseAlg, pubKey)
 	if err != nil {
 		result.Errors = append(result.Errors, fmt.Sprintf("creating verifier: %v", err))
 		return result
@@ -107,10 +118,138 @@ func Verify(doc *Document, pubKey crypto.PublicKey) *VerifyResult {
 	return result
 }
 
+// VerifyDeviceAuth verifies the device authentication of a DeviceResponse
+// document over the session transcript it was created for: a deviceSignature
+// with the device key of the MSO, or a deviceMac with the EMacKey derived from
+// readerKey, the private part of the reader's ephemeral key, and the device
+// key. readerKey is only needed for deviceMac.
+func VerifyDeviceAuth(doc *Document, sessionTranscript []byte, readerKey *ecdsa.PrivateKey) *DeviceAuthResult {
+	result := &DeviceAuthResult{Method: doc.DeviceSigned.Method()}
+	if result.Method == "" {
+		result.Errors = append(result.Errors, "no deviceSignature or deviceMac found")
+		return result
+	}
+	if doc.IssuerAuth == nil || doc.IssuerAuth.MSO == nil {
+		result.Errors = append(result.Errors, "no MSO with a device key found")
+		return result
+	}
+	deviceKey, err := DeviceKey(doc.IssuerAuth.MSO)
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return result
+	}
+	deviceAuthBytes, err := DeviceAuthenticationBytes(sessionTranscript, doc.DocType, doc.DeviceSigned.NameSpacesBytes)
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return result
+	}
+
+	if result.Method == "deviceMac" {
+		if readerKey == nil {
+			result.Errors = append(result.Errors, "deviceMac needs the reader key")
+			return result
+		}
+		ecKey, ok := deviceKey.(*ecdsa.PublicKey)
+		if !ok {
+			result.Errors = append(result.Errors, "deviceMac needs an EC device key")
+			return result
+		}
+		key, err := DeriveEMacKey(readerKey, ecKey, sessionTranscript)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("deriving EMacKey: %v", err))
+			return result
+		}
+		if err := verifyDeviceMac(doc.DeviceSigned.DeviceMac, key, deviceAuthBytes); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			return result
+		}
+		result.Valid = true
+		return result
+	}
+
+	var msg cose.Sign1Message
+	if err := msg.UnmarshalCBOR(doc.DeviceSigned.DeviceSignature); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("parsing deviceSignature: %v", err))
+		return result
+	}
+	alg, err := msg.Headers.Protected.Algorithm()
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("deviceSignature algorithm: %v", err))
+		return result
+	}
+	// The payload is detached or, as some wallets send it, embedded; either
+	// way the signature has to be over the DeviceAuthenticationBytes.
+	if msg.Payload != nil && !bytes.Equal(msg.Payload, deviceAuthBytes) {
+		result.Errors = append(result.Errors, "deviceSignature payload does not match the session transcript")
+		return result
+	}
+	msg.Payload = deviceAuthBytes
+	verifier, err := keys.COSEVerifier(alg, deviceKey)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("creating verifier: %v", err))
+		return result
+	}
+	if err := msg.Verify(nil, verifier); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("deviceSignature verification failed: %v", err))
+		return result
+	}
+	result.Valid = true
+	return result
+}
+
+// DeviceKey returns the device key of an MSO, the COSE_Key in deviceKeyInfo:
+// an EC2 key, an Ed25519 OKP key or an RSA key.
+func DeviceKey(mso *MSO) (crypto.PublicKey, error) {
+	coseKey, ok := mso.DeviceKeyInfo["deviceKey"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("MSO has no deviceKeyInfo.deviceKey")
+	}
+	switch kty, _ := coseKey["1"].(int64); kty {
+	case 1:
+		if crv, _ := coseKey["-1"].(int64); crv != 6 {
+			return nil, fmt.Errorf("unsupported device key curve %v", coseKey["-1"])
+		}
+		x, _ := coseKey["-2"].([]byte)
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("device key has no valid Ed25519 x coordinate")
+		}
+		return ed25519.PublicKey(x), nil
+	case 2:
+		var curve elliptic.Curve
+		switch crv, _ := coseKey["-1"].(int64); crv {
+		case 1:
+			curve = elliptic.P256()
+		case 2:
+			curve = elliptic.P384()
+		case 3:
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported device key curve %v", coseKey["-1"])
+		}
+		x, _ := coseKey["-2"].([]byte)
+		y, _ := coseKey["-3"].([]byte)
+		if len(x) == 0 || len(y) == 0 {
+			return nil, fmt.Errorf("device key has no x or y coordinate")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case 3:
+		n, _ := coseKey["-1"].([]byte)
+		e, _ := coseKey["-2"].([]byte)
+		if len(n) == 0 || len(e) == 0 {
+			return nil, fmt.Errorf("device key has no n or e")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	default:
+		return nil, fmt.Errorf("unsupported device key type (kty %v)", coseKey["1"])
+	}
+}
+
 func coseAlgName(id int64) string {
 	switch id {
 	case -7:
 		return "ES256"
+	case -8:
+		return "EdDSA"
 	case -35:
 		return "ES384"
 	case -36:
@@ -132,8 +271,12 @@ func coseAlgorithm(name string) (cose.Algorithm, bool) {
 		return cose.AlgorithmES384, true
 	case "ES512":
 		return cose.AlgorithmES512, true
+	case "EdDSA":
+		return cose.AlgorithmEdDSA, true
 	case "PS256":
 		return cose.AlgorithmPS256, true
+	case "RS256":
+		return cose.AlgorithmRS256, true
 	default:
 		return 0, false
 	}
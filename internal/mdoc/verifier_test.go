@@ -15,6 +15,7 @@
 package mdoc
 
 import (
+	"bytes"
 	"crypto"
 	"testing"
 	"time"
@@ -138,6 +139,7 @@ func TestCoseAlgName(t *testing.T) {
 		want string
 	}{
 		{-7, "ES256"},
+		{-8, "EdDSA"},
 		{-35, "ES384"},
 		{-36, "ES512"},
 		{-37, "PS256"},
@@ -163,7 +165,8 @@ func TestCoseAlgorithm(t *testing.T) {
 		{"ES384", cose.AlgorithmES384, true},
 		{"ES512", cose.AlgorithmES512, true},
 		{"PS256", cose.AlgorithmPS256, true},
-		{"RS256", 0, false},
+		{"RS256", cose.AlgorithmRS256, true},
+		{"EdDSA", cose.AlgorithmEdDSA, true},
 		{"es256", 0, false},
 		{"", 0, false},
 	}
@@ -273,3 +276,49 @@ func TestVerify_NilIssuerAuth(t *testing.T) {
 		t.Error("expected error about missing issuerAuth")
 	}
 }
+
+func TestDeviceMac(t *testing.T) {
+	deviceKey, _ := mock.GenerateKey()
+	readerKey, _ := mock.GenerateKey()
+	transcript := []byte{0x83, 0xf6, 0xf6, 0xf6} // [null, null, null]
+
+	// Both sides derive the same EMacKey
+	walletKey, err := DeriveEMacKey(deviceKey, &readerKey.PublicKey, transcript)
+	if err != nil {
+		t.Fatalf("DeriveEMacKey: %v", err)
+	}
+	readerMacKey, err := DeriveEMacKey(readerKey, &deviceKey.PublicKey, transcript)
+	if err != nil {
+		t.Fatalf("DeriveEMacKey: %v", err)
+	}
+	if !bytes.Equal(walletKey, readerMacKey) || len(walletKey) != 32 {
+		t.Fatalf("EMacKeys differ: %x vs %x", walletKey, readerMacKey)
+	}
+
+	payload, err := DeviceAuthenticationBytes(transcript, "org.iso.18013.5.1.mDL", []byte{0xd8, 0x18, 0x41, 0xa0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac, err := CreateDeviceMac(walletKey, payload)
+	if err != nil {
+		t.Fatalf("CreateDeviceMac: %v", err)
+	}
+	if err := verifyDeviceMac(mac, readerMacKey, payload); err != nil {
+		t.Errorf("verifyDeviceMac: %v", err)
+	}
+
+	otherKey, _ := DeriveEMacKey(readerKey, &readerKey.PublicKey, transcript)
+	if err := verifyDeviceMac(mac, otherKey, payload); err == nil {
+		t.Error("expected a mismatch with another key")
+	}
+	if err := verifyDeviceMac(mac, readerMacKey, append(payload, 0)); err == nil {
+		t.Error("expected a mismatch with another payload")
+	}
+}
+
+func TestVerifyDeviceAuth_NoDeviceAuth(t *testing.T) {
+	result := VerifyDeviceAuth(&Document{DocType: "test"}, nil, nil)
+	if result.Valid || len(result.Errors) == 0 {
+		t.Errorf("expected an error without device authentication, got %+v", result)
+	}
+}
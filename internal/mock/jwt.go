@@ -15,8 +15,7 @@
 package mock
 
 import (
-	"crypto/ecdsa"
-	"crypto/sha256"
+	"crypto"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
@@ -24,6 +23,7 @@ import (
 	"time"
 
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 )
 
 // JWTConfig holds options for generating a mock JWT VC credential.
@@ -33,7 +33,8 @@ type JWTConfig struct {
 	ExpiresIn     time.Duration
 	NotBefore     *time.Time // optional: sets nbf claim
 	Claims        map[string]any
-	Key           *ecdsa.PrivateKey
+	Key           crypto.Signer
+	Alg           keys.Algorithm      // optional: signing algorithm; defaults to the key's algorithm
 	StatusListURI string              // optional: status list URI for revocation
 	StatusListIdx int                 // optional: index in the status list
 	CertChain     []*x509.Certificate // optional: x5c certificate chain [leaf, CA]
@@ -45,6 +46,10 @@ func GenerateJWT(cfg JWTConfig) (string, error) {
 	if cfg.Key == nil {
 		return "", fmt.Errorf("signing key is required")
 	}
+	alg, err := signingAlgorithm(cfg.Key, cfg.Alg)
+	if err != nil {
+		return "", err
+	}
 
 	now := time.Now()
 
@@ -76,7 +81,7 @@ func GenerateJWT(cfg JWTConfig) (string, error) {
 
 	// Build header
 	header := map[string]any{
-		"alg": "ES256",
+		"alg": string(alg),
 		"typ": "vc+jwt",
 	}
 
@@ -101,11 +106,7 @@ func GenerateJWT(cfg JWTConfig) (string, error) {
 	headerB64 := format.EncodeBase64URL(headerJSON)
 	payloadB64 := format.EncodeBase64URL(payloadJSON)
 
-	// Sign with ECDSA (JWS r||s format)
-	sigInput := headerB64 + "." + payloadB64
-	h := sha256.Sum256([]byte(sigInput))
-
-	sig, err := signECDSA(cfg.Key, h[:])
+	sig, err := keys.SignJWS(cfg.Key, alg, []byte(headerB64+"."+payloadB64))
 	if err != nil {
 		return "", fmt.Errorf("signing: %w", err)
 	}
@@ -19,6 +19,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 	"github.com/dominikschlosser/oid4vc-dev/internal/sdjwt"
 )
 
@@ -241,3 +242,35 @@ func TestGenerateJWT_WithoutNotBefore(t *testing.T) {
 		t.Error("nbf should not be present when NotBefore is nil")
 	}
 }
+
+func TestGenerateJWT_Algorithms(t *testing.T) {
+	for _, alg := range keys.Algorithms {
+		t.Run(string(alg), func(t *testing.T) {
+			key, err := keys.GenerateKey(alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := GenerateJWT(JWTConfig{
+				Issuer:    "https://issuer.example",
+				VCT:       "urn:eudi:pid:1",
+				ExpiresIn: 24 * time.Hour,
+				Claims:    DefaultClaims,
+				Key:       key,
+				Alg:       alg,
+			})
+			if err != nil {
+				t.Fatalf("GenerateJWT: %v", err)
+			}
+
+			token, err := sdjwt.Parse(result)
+			if err != nil {
+				t.Fatalf("sdjwt.Parse: %v", err)
+			}
+			verifyResult := sdjwt.Verify(token, key.Public())
+			if !verifyResult.SignatureValid || verifyResult.Algorithm != string(alg) {
+				t.Errorf("expected a valid %s signature, got %s: %v", alg, verifyResult.Algorithm, verifyResult.Errors)
+			}
+		})
+	}
+}
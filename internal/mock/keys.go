@@ -15,6 +15,7 @@
 package mock
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -26,6 +27,7 @@ import (
 	"time"
 
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 )
 
 // GenerateKey creates an ephemeral P-256 private key.
@@ -33,49 +35,31 @@ func GenerateKey() (*ecdsa.PrivateKey, error) {
 	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 }
 
-// PublicKeyJWKMap returns the JWK representation of a P-256 public key as a map.
-func PublicKeyJWKMap(key *ecdsa.PublicKey) map[string]string {
-	keySize := (key.Curve.Params().BitSize + 7) / 8
-	xBytes := padToKeySize(key.X.Bytes(), keySize)
-	yBytes := padToKeySize(key.Y.Bytes(), keySize)
-
-	return map[string]string{
-		"kty": "EC",
-		"crv": "P-256",
-		"x":   format.EncodeBase64URL(xBytes),
-		"y":   format.EncodeBase64URL(yBytes),
+// signingAlgorithm returns the algorithm to sign with key: alg if set,
+// otherwise the key's default algorithm.
+func signingAlgorithm(key crypto.Signer, alg keys.Algorithm) (keys.Algorithm, error) {
+	if alg == "" {
+		return keys.AlgorithmFor(key.Public(), "")
 	}
-}
-
-func padToKeySize(b []byte, size int) []byte {
-	for len(b) < size {
-		b = append([]byte{0}, b...)
+	if !keys.SupportsAlgorithm(key.Public(), alg) {
+		return "", fmt.Errorf("%s cannot be used with a %T key", alg, key.Public())
 	}
-	return b
+	return alg, nil
 }
 
-// PublicKeyJWK returns the JSON JWK representation of a P-256 public key.
-func PublicKeyJWK(key *ecdsa.PublicKey) string {
-	keySize := (key.Curve.Params().BitSize + 7) / 8
-	xBytes := key.X.Bytes()
-	yBytes := key.Y.Bytes()
-
-	// Pad to key size
-	for len(xBytes) < keySize {
-		xBytes = append([]byte{0}, xBytes...)
-	}
-	for len(yBytes) < keySize {
-		yBytes = append([]byte{0}, yBytes...)
-	}
-
-	jwk := map[string]string{
-		"kty": "EC",
-		"crv": "P-256",
-		"x":   format.EncodeBase64URL(xBytes),
-		"y":   format.EncodeBase64URL(yBytes),
+// PublicKeyJWKMap returns the JWK representation of an EC, Ed25519 or RSA
+// public key as a map, or nil for other key types.
+func PublicKeyJWKMap(key crypto.PublicKey) map[string]string {
+	jwk, err := keys.PublicJWK(key)
+	if err != nil {
+		return nil
 	}
+	return jwk
+}
 
-	b, _ := json.MarshalIndent(jwk, "", "  ")
+// PublicKeyJWK returns the JSON JWK representation of a public key.
+func PublicKeyJWK(key crypto.PublicKey) string {
+	b, _ := json.MarshalIndent(PublicKeyJWKMap(key), "", "  ")
 	return string(b)
 }
 
@@ -101,10 +85,16 @@ func GenerateCACert(caKey *ecdsa.PrivateKey) (*x509.Certificate, error) {
 }
 
 // GenerateLeafCert creates a leaf certificate signed by the CA.
-func GenerateLeafCert(caKey *ecdsa.PrivateKey, caCert *x509.Certificate, leafPubKey *ecdsa.PublicKey) (*x509.Certificate, error) {
+func GenerateLeafCert(caKey *ecdsa.PrivateKey, caCert *x509.Certificate, leafPubKey crypto.PublicKey) (*x509.Certificate, error) {
+	return GenerateNamedLeafCert(caKey, caCert, leafPubKey, "OID4VC Dev Wallet Issuer")
+}
+
+// GenerateNamedLeafCert creates a leaf certificate with the given common name
+// signed by the CA.
+func GenerateNamedLeafCert(caKey *ecdsa.PrivateKey, caCert *x509.Certificate, leafPubKey crypto.PublicKey, commonName string) (*x509.Certificate, error) {
 	template := &x509.Certificate{
 		SerialNumber:          big.NewInt(2),
-		Subject:               pkix.Name{CommonName: "OID4VC Dev Wallet Issuer"},
+		Subject:               pkix.Name{CommonName: commonName},
 		NotBefore:             time.Now().Add(-time.Hour),
 		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
 		KeyUsage:              x509.KeyUsageDigitalSignature,
@@ -119,7 +109,7 @@ func GenerateLeafCert(caKey *ecdsa.PrivateKey, caCert *x509.Certificate, leafPub
 	return x509.ParseCertificate(der)
 }
 
-// PrivateKeyJWK returns the JSON JWK representation of a P-256 private key (includes d).
+// PrivateKeyJWK returns the JSON JWK representation of an EC private key (includes d).
 func PrivateKeyJWK(key *ecdsa.PrivateKey) string {
 	keySize := (key.Curve.Params().BitSize + 7) / 8
 	xBytes := key.X.Bytes()
@@ -138,7 +128,7 @@ func PrivateKeyJWK(key *ecdsa.PrivateKey) string {
 
 	jwk := map[string]string{
 		"kty": "EC",
-		"crv": "P-256",
+		"crv": key.Curve.Params().Name,
 		"x":   format.EncodeBase64URL(xBytes),
 		"y":   format.EncodeBase64URL(yBytes),
 		"d":   format.EncodeBase64URL(dBytes),
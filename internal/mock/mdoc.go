@@ -15,7 +15,7 @@
 package mock
 
 import (
-	"crypto/ecdsa"
+	"crypto"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
@@ -25,6 +25,8 @@ import (
 
 	"github.com/fxamacker/cbor/v2"
 	"github.com/veraison/go-cose"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 )
 
 // MDOCConfig holds options for generating a mock mDOC credential.
@@ -32,8 +34,9 @@ type MDOCConfig struct {
 	DocType       string
 	Namespace     string
 	Claims        map[string]any
-	Key           *ecdsa.PrivateKey
-	HolderKey     *ecdsa.PublicKey    // optional: adds deviceKeyInfo to MSO
+	Key           crypto.Signer
+	Alg           keys.Algorithm      // optional: signing algorithm; defaults to the key's algorithm
+	HolderKey     crypto.PublicKey    // optional: adds deviceKeyInfo to MSO
 	ExpiresIn     time.Duration       // validity duration; defaults to 30 days if zero
 	ValidFrom     *time.Time          // optional: override validFrom (defaults to now)
 	StatusListURI string              // optional: status list URI for revocation
@@ -123,25 +126,10 @@ func GenerateMDOC(cfg MDOCConfig) (string, error) {
 
 	// Add deviceKeyInfo with holder's COSE_Key
 	if cfg.HolderKey != nil {
-		keySize := (cfg.HolderKey.Curve.Params().BitSize + 7) / 8
-		xBytes := cfg.HolderKey.X.Bytes()
-		yBytes := cfg.HolderKey.Y.Bytes()
-		for len(xBytes) < keySize {
-			xBytes = append([]byte{0}, xBytes...)
-		}
-		for len(yBytes) < keySize {
-			yBytes = append([]byte{0}, yBytes...)
-		}
-
-		// COSE_Key: kty=2 (EC2), crv=1 (P-256), x, y
-		// Using COSE key labels: 1=kty, -1=crv, -2=x, -3=y
-		coseKey := map[any]any{
-			int64(1):  int64(2), // kty: EC2
-			int64(-1): int64(1), // crv: P-256
-			int64(-2): xBytes,   // x coordinate
-			int64(-3): yBytes,   // y coordinate
+		coseKey, err := keys.COSEKey(cfg.HolderKey)
+		if err != nil {
+			return "", fmt.Errorf("encoding device key: %w", err)
 		}
-
 		mso["deviceKeyInfo"] = map[string]any{
 			"deviceKey": coseKey,
 		}
@@ -153,13 +141,17 @@ func GenerateMDOC(cfg MDOCConfig) (string, error) {
 	}
 
 	// Sign MSO with COSE_Sign1
-	signer, err := cose.NewSigner(cose.AlgorithmES256, cfg.Key)
+	alg, err := signingAlgorithm(cfg.Key, cfg.Alg)
+	if err != nil {
+		return "", err
+	}
+	signer, err := keys.COSESigner(cfg.Key, alg)
 	if err != nil {
 		return "", fmt.Errorf("creating COSE signer: %w", err)
 	}
 
 	msg := cose.NewSign1Message()
-	msg.Headers.Protected.SetAlgorithm(cose.AlgorithmES256)
+	msg.Headers.Protected.SetAlgorithm(signer.Algorithm())
 	msg.Payload = msoBytes
 
 	// Add x5chain (label 33) to unprotected header
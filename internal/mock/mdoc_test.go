@@ -15,9 +15,11 @@
 package mock
 
 import (
+	"crypto"
 	"testing"
 	"time"
 
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 	"github.com/dominikschlosser/oid4vc-dev/internal/mdoc"
 )
 
@@ -390,3 +392,47 @@ func TestGenerateMDOC_WithValidFrom(t *testing.T) {
 		t.Errorf("expected validFrom=%v, got %v", vf, *vi.ValidFrom)
 	}
 }
+
+func TestGenerateMDOC_Algorithms(t *testing.T) {
+	for _, alg := range keys.Algorithms {
+		t.Run(string(alg), func(t *testing.T) {
+			key, err := keys.GenerateKey(alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			holderKey, err := keys.GenerateKey(alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := GenerateMDOC(MDOCConfig{
+				DocType:   "org.example.test",
+				Namespace: "org.example.test",
+				Claims:    map[string]any{"name": "Test"},
+				Key:       key,
+				Alg:       alg,
+				HolderKey: holderKey.Public(),
+			})
+			if err != nil {
+				t.Fatalf("GenerateMDOC: %v", err)
+			}
+
+			doc, err := mdoc.Parse(result)
+			if err != nil {
+				t.Fatalf("mdoc.Parse: %v", err)
+			}
+			verifyResult := mdoc.Verify(doc, key.Public())
+			if !verifyResult.SignatureValid {
+				t.Errorf("COSE signature verification failed: %v", verifyResult.Errors)
+			}
+
+			deviceKey, err := mdoc.DeviceKey(doc.IssuerAuth.MSO)
+			if err != nil {
+				t.Fatalf("mdoc.DeviceKey: %v", err)
+			}
+			if !holderKey.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(deviceKey) {
+				t.Error("deviceKeyInfo does not hold the holder key")
+			}
+		})
+	}
+}
@@ -15,7 +15,7 @@
 package mock
 
 import (
-	"crypto/ecdsa"
+	"crypto"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 )
 
 // SDJWTConfig holds options for generating a mock SD-JWT credential.
@@ -35,8 +36,9 @@ type SDJWTConfig struct {
 	ExpiresIn     time.Duration
 	NotBefore     *time.Time // optional: sets nbf claim
 	Claims        map[string]any
-	Key           *ecdsa.PrivateKey
-	HolderKey     *ecdsa.PublicKey    // optional: adds cnf claim for holder binding
+	Key           crypto.Signer
+	Alg           keys.Algorithm      // optional: signing algorithm; defaults to the key's algorithm
+	HolderKey     crypto.PublicKey    // optional: adds cnf claim for holder binding
 	StatusListURI string              // optional: status list URI for revocation
 	StatusListIdx int                 // optional: index in the status list
 	CertChain     []*x509.Certificate // optional: x5c certificate chain [leaf, CA]
@@ -47,6 +49,10 @@ type SDJWTConfig struct {
 // Slice values produce array element disclosures ({"...": digest} entries).
 func GenerateSDJWT(cfg SDJWTConfig) (string, error) {
 	now := time.Now()
+	alg, err := signingAlgorithm(cfg.Key, cfg.Alg)
+	if err != nil {
+		return "", err
+	}
 
 	// Generate disclosures and compute digests
 	var disclosures []string
@@ -101,7 +107,7 @@ func GenerateSDJWT(cfg SDJWTConfig) (string, error) {
 
 	// Build header
 	header := map[string]any{
-		"alg": "ES256",
+		"alg": string(alg),
 		"typ": "vc+sd-jwt",
 	}
 
@@ -126,23 +132,11 @@ func GenerateSDJWT(cfg SDJWTConfig) (string, error) {
 	headerB64 := format.EncodeBase64URL(headerJSON)
 	payloadB64 := format.EncodeBase64URL(payloadJSON)
 
-	// Sign with ECDSA (JWS r||s format)
-	sigInput := headerB64 + "." + payloadB64
-	h := sha256.Sum256([]byte(sigInput))
-
-	r, s, err := ecdsa.Sign(rand.Reader, cfg.Key, h[:])
+	sig, err := keys.SignJWS(cfg.Key, alg, []byte(headerB64+"."+payloadB64))
 	if err != nil {
 		return "", fmt.Errorf("signing: %w", err)
 	}
 
-	// Encode r||s with fixed-size padding (32 bytes each for P-256)
-	keySize := (cfg.Key.Curve.Params().BitSize + 7) / 8
-	rBytes := r.Bytes()
-	sBytes := s.Bytes()
-	sig := make([]byte, 2*keySize)
-	copy(sig[keySize-len(rBytes):keySize], rBytes)
-	copy(sig[2*keySize-len(sBytes):], sBytes)
-
 	sigB64 := format.EncodeBase64URL(sig)
 
 	// Assemble: header.payload.sig~disc1~disc2~
@@ -230,26 +224,3 @@ func createArrayElementDisclosure(value any) (encoded string, digest string, err
 	h := sha256.Sum256([]byte(enc))
 	return enc, format.EncodeBase64URL(h[:]), nil
 }
-
-// signECDSA signs a digest and returns the JWS r||s encoded signature.
-func signECDSA(key *ecdsa.PrivateKey, digest []byte) ([]byte, error) {
-	r, s, err := ecdsa.Sign(rand.Reader, key, digest)
-	if err != nil {
-		return nil, err
-	}
-
-	keySize := (key.Curve.Params().BitSize + 7) / 8
-	rBytes := padToSize(r.Bytes(), keySize)
-	sBytes := padToSize(s.Bytes(), keySize)
-
-	return append(rBytes, sBytes...), nil
-}
-
-func padToSize(b []byte, size int) []byte {
-	if len(b) >= size {
-		return b
-	}
-	padded := make([]byte, size)
-	copy(padded[size-len(b):], b)
-	return padded
-}
@@ -15,10 +15,12 @@
 package mock
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 	"github.com/dominikschlosser/oid4vc-dev/internal/sdjwt"
 )
 
@@ -439,3 +441,69 @@ func TestGenerateSDJWT_WithoutNotBefore(t *testing.T) {
 		t.Error("nbf should not be present when NotBefore is nil")
 	}
 }
+
+func TestGenerateSDJWT_Algorithms(t *testing.T) {
+	for _, alg := range keys.Algorithms {
+		t.Run(string(alg), func(t *testing.T) {
+			key, err := keys.GenerateKey(alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			holderKey, err := keys.GenerateKey(alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := GenerateSDJWT(SDJWTConfig{
+				Issuer:    "https://issuer.example",
+				VCT:       "urn:eudi:pid:1",
+				ExpiresIn: 24 * time.Hour,
+				Claims:    DefaultClaims,
+				Key:       key,
+				Alg:       alg,
+				HolderKey: holderKey.Public(),
+			})
+			if err != nil {
+				t.Fatalf("GenerateSDJWT: %v", err)
+			}
+
+			token, err := sdjwt.Parse(result)
+			if err != nil {
+				t.Fatalf("sdjwt.Parse: %v", err)
+			}
+			if token.Header["alg"] != string(alg) {
+				t.Errorf("expected alg %s, got %v", alg, token.Header["alg"])
+			}
+			verifyResult := sdjwt.Verify(token, key.Public())
+			if !verifyResult.SignatureValid {
+				t.Errorf("signature verification failed: %v", verifyResult.Errors)
+			}
+
+			cnf, _ := token.Payload["cnf"].(map[string]any)
+			jwk, _ := json.Marshal(cnf["jwk"])
+			pub, err := keys.ParseJWK(jwk)
+			if err != nil {
+				t.Fatalf("parsing cnf.jwk: %v", err)
+			}
+			if !keys.SupportsAlgorithm(pub, alg) {
+				t.Errorf("cnf.jwk %s cannot be used with %s", jwk, alg)
+			}
+		})
+	}
+}
+
+func TestGenerateSDJWT_AlgorithmMismatch(t *testing.T) {
+	key, _ := GenerateKey()
+
+	_, err := GenerateSDJWT(SDJWTConfig{
+		Issuer:    "https://issuer.example",
+		VCT:       "urn:eudi:pid:1",
+		ExpiresIn: 24 * time.Hour,
+		Claims:    DefaultClaims,
+		Key:       key,
+		Alg:       keys.RS256,
+	})
+	if err == nil {
+		t.Fatal("expected an error signing RS256 with a P-256 key")
+	}
+}
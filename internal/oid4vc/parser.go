@@ -141,10 +141,15 @@ func parseVCIJSON(data []byte) (RequestType, any, error) {
 			if txCode := jsonutil.GetMap(preAuth, "tx_code"); txCode != nil {
 				offer.Grants.TxCode = txCode
 			}
+			offer.Grants.AuthorizationServer = jsonutil.GetString(preAuth, "authorization_server")
 		}
 		if authCode := jsonutil.GetMap(grants, "authorization_code"); authCode != nil {
+			offer.Grants.HasAuthorizationCode = true
 			offer.Grants.IssuerState = jsonutil.GetString(authCode, "issuer_state")
 			offer.Grants.AuthorizationCode = jsonutil.GetString(authCode, "authorization_code")
+			if as := jsonutil.GetString(authCode, "authorization_server"); as != "" {
+				offer.Grants.AuthorizationServer = as
+			}
 		}
 	}
 
@@ -219,9 +224,62 @@ func parseVPParams(q url.Values, opts ParseOptions) (RequestType, any, error) {
 		}
 	}
 
+	// Parse transaction_data
+	if td := q.Get("transaction_data"); td != "" {
+		var entries []string
+		if err := json.Unmarshal([]byte(td), &entries); err == nil {
+			req.TransactionData = entries
+		}
+	}
+
+	// Parse verifier_info
+	if vi := q.Get("verifier_info"); vi != "" {
+		var entries []map[string]any
+		if err := json.Unmarshal([]byte(vi), &entries); err == nil {
+			req.VerifierInfo = entries
+		}
+	}
+
+	parseLegacyParams(&req.Legacy, q)
+
 	return TypeVP, req, nil
 }
 
+// parseLegacyParams extracts the pre-1.0 draft parameters from URL query
+// parameters, without overriding those of a request object.
+func parseLegacyParams(legacy *LegacyParams, q url.Values) {
+	if pd := q.Get("presentation_definition"); pd != "" && legacy.PresentationDefinition == nil {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(pd), &m); err == nil {
+			legacy.PresentationDefinition = m
+		}
+	}
+	setIfEmpty := func(target *string, key string) {
+		if *target == "" {
+			*target = q.Get(key)
+		}
+	}
+	setIfEmpty(&legacy.PresentationDefinitionURI, "presentation_definition_uri")
+	setIfEmpty(&legacy.ClientIDScheme, "client_id_scheme")
+	setIfEmpty(&legacy.ClientMetadataURI, "client_metadata_uri")
+}
+
+// applyLegacyPayload extracts the pre-1.0 draft parameters from a request
+// object payload or JSON request.
+func applyLegacyPayload(legacy *LegacyParams, payload map[string]any) {
+	if pd := jsonutil.GetMap(payload, "presentation_definition"); pd != nil {
+		legacy.PresentationDefinition = pd
+	}
+	setString := func(target *string, key string) {
+		if v := jsonutil.GetString(payload, key); v != "" {
+			*target = v
+		}
+	}
+	setString(&legacy.PresentationDefinitionURI, "presentation_definition_uri")
+	setString(&legacy.ClientIDScheme, "client_id_scheme")
+	setString(&legacy.ClientMetadataURI, "client_metadata_uri")
+}
+
 // applyRequestObjectPayload applies Request Object claims authoritatively per OID4VP 1.0.
 func applyRequestObjectPayload(req *AuthorizationRequest, payload map[string]any) error {
 	if outerClientID := req.ClientID; outerClientID != "" {
@@ -247,6 +305,13 @@ func applyRequestObjectPayload(req *AuthorizationRequest, payload map[string]any
 	if dq, ok := payload["dcql_query"].(map[string]any); ok {
 		req.DCQLQuery = dq
 	}
+	if td, ok := payload["transaction_data"].([]any); ok {
+		req.TransactionData = stringValues(td)
+	}
+	if vi, ok := payload["verifier_info"].([]any); ok {
+		req.VerifierInfo = objectValues(vi)
+	}
+	applyLegacyPayload(&req.Legacy, payload)
 
 	return nil
 }
@@ -328,6 +393,35 @@ func buildVPFromJSON(m map[string]any) (RequestType, *AuthorizationRequest) {
 	if dq := jsonutil.GetMap(m, "dcql_query"); dq != nil {
 		req.DCQLQuery = dq
 	}
+	if td, ok := m["transaction_data"].([]any); ok {
+		req.TransactionData = stringValues(td)
+	}
+	if vi, ok := m["verifier_info"].([]any); ok {
+		req.VerifierInfo = objectValues(vi)
+	}
+	applyLegacyPayload(&req.Legacy, m)
 
 	return TypeVP, req
 }
+
+// stringValues returns the string elements of a JSON array.
+func stringValues(arr []any) []string {
+	values := make([]string, 0, len(arr))
+	for _, v := range arr {
+		if s, ok := v.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// objectValues returns the object elements of a JSON array.
+func objectValues(arr []any) []map[string]any {
+	values := make([]map[string]any, 0, len(arr))
+	for _, v := range arr {
+		if m, ok := v.(map[string]any); ok {
+			values = append(values, m)
+		}
+	}
+	return values
+}
@@ -141,6 +141,86 @@ func TestParseVPWithDCQLQuery(t *testing.T) {
 	}
 }
 
+func TestParseVPWithTransactionData(t *testing.T) {
+	uri := "openid4vp://?client_id=v&response_type=vp_token&transaction_data=" + url.QueryEscape(`["eyJ0eXBlIjoicGF5bWVudCJ9"]`)
+	_, result, err := Parse(uri)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if td := result.(*AuthorizationRequest).TransactionData; len(td) != 1 || td[0] != "eyJ0eXBlIjoicGF5bWVudCJ9" {
+		t.Errorf("expected transaction_data from the query, got %v", td)
+	}
+
+	jwt := makeTestJWT(map[string]any{"alg": "ES256"}, map[string]any{
+		"client_id":        "v",
+		"response_type":    "vp_token",
+		"transaction_data": []any{"from-request-object"},
+	})
+	_, result, err = Parse("openid4vp://?client_id=v&request=" + url.QueryEscape(jwt))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if td := result.(*AuthorizationRequest).TransactionData; len(td) != 1 || td[0] != "from-request-object" {
+		t.Errorf("expected transaction_data from the request object, got %v", td)
+	}
+}
+
+func TestParseVPWithVerifierInfo(t *testing.T) {
+	uri := "openid4vp://?client_id=v&response_type=vp_token&verifier_info=" + url.QueryEscape(`[{"format":"registration_cert","data":"eyJ..."}]`)
+	_, result, err := Parse(uri)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if vi := result.(*AuthorizationRequest).VerifierInfo; len(vi) != 1 || vi[0]["format"] != "registration_cert" {
+		t.Errorf("expected verifier_info from the query, got %v", vi)
+	}
+
+	jwt := makeTestJWT(map[string]any{"alg": "ES256"}, map[string]any{
+		"client_id":     "v",
+		"response_type": "vp_token",
+		"verifier_info": []any{map[string]any{"format": "registration_cert", "data": map[string]any{}}, "not an object"},
+	})
+	_, result, err = Parse("openid4vp://?client_id=v&request=" + url.QueryEscape(jwt))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if vi := result.(*AuthorizationRequest).VerifierInfo; len(vi) != 1 {
+		t.Errorf("expected the object entry of the request object's verifier_info, got %v", vi)
+	}
+}
+
+func TestParseVPLegacyParams(t *testing.T) {
+	uri := "openid4vp://?client_id=v&client_id_scheme=redirect_uri&response_type=vp_token" +
+		"&presentation_definition=" + url.QueryEscape(`{"id":"pd","input_descriptors":[]}`) +
+		"&client_metadata_uri=" + url.QueryEscape("https://v.example/meta")
+	_, result, err := Parse(uri)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	legacy := result.(*AuthorizationRequest).Legacy
+	if legacy.ClientIDScheme != "redirect_uri" || legacy.ClientMetadataURI != "https://v.example/meta" || legacy.PresentationDefinition["id"] != "pd" {
+		t.Errorf("unexpected legacy params from the query: %+v", legacy)
+	}
+
+	jwt := makeTestJWT(map[string]any{"alg": "ES256"}, map[string]any{
+		"client_id":                   "v",
+		"client_id_scheme":            "x509_san_dns",
+		"response_type":               "vp_token",
+		"presentation_definition_uri": "https://v.example/pd",
+	})
+	_, result, err = Parse("openid4vp://?client_id=v&client_id_scheme=redirect_uri&request=" + url.QueryEscape(jwt))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	legacy = result.(*AuthorizationRequest).Legacy
+	if legacy.ClientIDScheme != "x509_san_dns" || legacy.PresentationDefinitionURI != "https://v.example/pd" {
+		t.Errorf("expected legacy params from the request object, got %+v", legacy)
+	}
+	if !(LegacyParams{}).IsZero() || legacy.IsZero() {
+		t.Error("expected IsZero only without legacy params")
+	}
+}
+
 func TestParseVPDirectJWT(t *testing.T) {
 	payload := map[string]any{
 		"client_id":     "https://verifier.example",
@@ -340,6 +420,24 @@ func TestParseVCIWithAuthorizationCodeGrant(t *testing.T) {
 	if co.Grants.IssuerState != "state123" {
 		t.Errorf("expected issuer_state state123, got %s", co.Grants.IssuerState)
 	}
+	if !co.Grants.HasAuthorizationCode {
+		t.Error("expected HasAuthorizationCode to be true")
+	}
+}
+
+func TestParseVCIAuthorizationServerHint(t *testing.T) {
+	raw := `{"credential_issuer":"https://issuer.example","credential_configuration_ids":["pid"],"grants":{"authorization_code":{"authorization_server":"https://auth.issuer.example"}}}`
+	_, result, err := Parse(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	co := result.(*CredentialOffer)
+	if !co.Grants.HasAuthorizationCode {
+		t.Error("expected HasAuthorizationCode for empty-state authorization_code grant")
+	}
+	if co.Grants.AuthorizationServer != "https://auth.issuer.example" {
+		t.Errorf("expected authorization_server https://auth.issuer.example, got %s", co.Grants.AuthorizationServer)
+	}
 }
 
 func TestParseVCIMultipleCredentialConfigs(t *testing.T) {
@@ -33,10 +33,12 @@ type CredentialOffer struct {
 
 // OfferGrants holds the grant types in a credential offer.
 type OfferGrants struct {
-	PreAuthorizedCode string
-	TxCode            map[string]any // input_mode, length, description
-	AuthorizationCode string
-	IssuerState       string
+	PreAuthorizedCode    string
+	TxCode               map[string]any // input_mode, length, description
+	AuthorizationCode    string
+	IssuerState          string
+	AuthorizationServer  string // authorization_server hint from the grant, if any
+	HasAuthorizationCode bool   // true if the offer contains an authorization_code grant
 }
 
 // AuthorizationRequest represents a parsed OID4VP authorization request.
@@ -51,11 +53,28 @@ type AuthorizationRequest struct {
 	Scope            string
 	RequestURIMethod string // "get" (default) or "post" per OID4VP 1.0 §5.10
 	DCQLQuery        map[string]any
+	TransactionData  []string         // base64url-encoded transaction_data entries (OID4VP 1.0 §5.1)
+	VerifierInfo     []map[string]any // verifier_info attestations about the verifier (OID4VP 1.0 §5.1)
+	Legacy           LegacyParams
 	RequestObject    *RequestObjectJWT
 	FullParams       map[string]string
 	FullJSON         map[string]any
 }
 
+// LegacyParams holds the parameters of OID4VP drafts before 1.0 that the
+// final specification removed.
+type LegacyParams struct {
+	PresentationDefinition    map[string]any // DIF Presentation Exchange query
+	PresentationDefinitionURI string
+	ClientIDScheme            string // separate client identifier scheme (drafts before 22)
+	ClientMetadataURI         string
+}
+
+// IsZero reports whether none of the legacy parameters is set.
+func (l LegacyParams) IsZero() bool {
+	return l.PresentationDefinition == nil && l.PresentationDefinitionURI == "" && l.ClientIDScheme == "" && l.ClientMetadataURI == ""
+}
+
 // RequestObjectJWT holds the decoded header and payload of a JWT request object.
 type RequestObjectJWT struct {
 	Raw     string
@@ -24,6 +24,7 @@ import (
 
 	"github.com/fatih/color"
 
+	"github.com/dominikschlosser/oid4vc-dev/internal/did"
 	"github.com/dominikschlosser/oid4vc-dev/internal/mdoc"
 	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
 	"github.com/dominikschlosser/oid4vc-dev/internal/sdjwt"
@@ -355,6 +356,9 @@ func PrintVerifyResultMDOC(r *mdoc.VerifyResult, opts Options) {
 
 	printKV("Algorithm", r.Algorithm, 1)
 	printKV("DocType", r.DocType, 1)
+	if r.DeviceAuth != "" {
+		printKV("Device Auth", r.DeviceAuth, 1)
+	}
 
 	printTimeValidity(r.ValidUntil, r.ValidFrom, r.Expired, r.NotYetValid)
 
@@ -528,7 +532,7 @@ func BuildCredentialOfferJSON(offer *oid4vc.CredentialOffer) map[string]any {
 		}
 		grants["urn:ietf:params:oauth:grant-type:pre-authorized_code"] = preAuth
 	}
-	if offer.Grants.AuthorizationCode != "" || offer.Grants.IssuerState != "" {
+	if offer.Grants.HasAuthorizationCode || offer.Grants.AuthorizationCode != "" || offer.Grants.IssuerState != "" {
 		authCode := map[string]any{}
 		if offer.Grants.AuthorizationCode != "" {
 			authCode["authorization_code"] = offer.Grants.AuthorizationCode
@@ -536,6 +540,9 @@ func BuildCredentialOfferJSON(offer *oid4vc.CredentialOffer) map[string]any {
 		if offer.Grants.IssuerState != "" {
 			authCode["issuer_state"] = offer.Grants.IssuerState
 		}
+		if offer.Grants.AuthorizationServer != "" {
+			authCode["authorization_server"] = offer.Grants.AuthorizationServer
+		}
 		grants["authorization_code"] = authCode
 	}
 	if len(grants) > 0 {
@@ -565,7 +572,7 @@ func PrintCredentialOffer(offer *oid4vc.CredentialOffer, opts Options) {
 		}
 	}
 
-	hasGrants := offer.Grants.PreAuthorizedCode != "" || offer.Grants.AuthorizationCode != "" || offer.Grants.IssuerState != ""
+	hasGrants := offer.Grants.PreAuthorizedCode != "" || offer.Grants.HasAuthorizationCode || offer.Grants.AuthorizationCode != "" || offer.Grants.IssuerState != ""
 	if hasGrants {
 		printSection("Grants")
 		if offer.Grants.PreAuthorizedCode != "" {
@@ -590,6 +597,9 @@ func PrintCredentialOffer(offer *oid4vc.CredentialOffer, opts Options) {
 		if offer.Grants.IssuerState != "" {
 			printKV("Issuer State", offer.Grants.IssuerState, 1)
 		}
+		if offer.Grants.AuthorizationServer != "" {
+			printKV("Authorization Server", offer.Grants.AuthorizationServer, 1)
+		}
 	}
 
 	if opts.Verbose && offer.FullJSON != nil {
@@ -784,6 +794,56 @@ func PrintTrustList(tl *trustlist.TrustList, opts Options) {
 	fmt.Println()
 }
 
+// DIDResolution is the outcome of resolving one DID for display.
+type DIDResolution struct {
+	DID      string
+	Document *did.Document
+	Err      error
+}
+
+// BuildDIDDocumentsJSON returns a JSON-serializable map of resolved DID documents.
+func BuildDIDDocumentsJSON(results []DIDResolution) map[string]any {
+	docs := make([]any, 0, len(results))
+	for _, r := range results {
+		entry := map[string]any{"did": r.DID}
+		if r.Err != nil {
+			entry["error"] = r.Err.Error()
+		} else {
+			entry["document"] = r.Document
+		}
+		docs = append(docs, entry)
+	}
+	return map[string]any{"did_documents": docs}
+}
+
+// PrintDIDDocuments prints resolved DID documents to the terminal.
+func PrintDIDDocuments(results []DIDResolution, opts Options) {
+	if opts.JSON {
+		PrintJSON(BuildDIDDocumentsJSON(results))
+		return
+	}
+
+	headerColor.Println("DID Documents")
+	headerColor.Println(strings.Repeat("─", 50))
+
+	if len(results) == 0 {
+		dimColor.Println("\n  No DIDs found")
+	}
+	for _, r := range results {
+		printSection(r.DID)
+		if r.Err != nil {
+			errorColor.Printf("  ✗ %v\n", r.Err)
+			continue
+		}
+		var m map[string]any
+		if data, err := json.Marshal(r.Document); err == nil {
+			json.Unmarshal(data, &m)
+		}
+		printMap(m, 1)
+	}
+	fmt.Println()
+}
+
 // PrintError prints an error message.
 func PrintError(msg string) {
 	fmt.Fprintf(os.Stderr, "%s %s\n", errorColor.Sprint("Error:"), msg)
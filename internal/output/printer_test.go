@@ -16,6 +16,7 @@ package output
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"os"
 	"strings"
@@ -24,6 +25,7 @@ import (
 
 	"github.com/fatih/color"
 
+	"github.com/dominikschlosser/oid4vc-dev/internal/did"
 	"github.com/dominikschlosser/oid4vc-dev/internal/mdoc"
 	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
 	"github.com/dominikschlosser/oid4vc-dev/internal/sdjwt"
@@ -791,6 +793,34 @@ func TestPrintAuthorizationRequest_JSON(t *testing.T) {
 	}
 }
 
+func TestPrintDIDDocuments(t *testing.T) {
+	results := []DIDResolution{
+		{DID: "did:web:example.com", Document: &did.Document{ID: "did:web:example.com"}},
+		{DID: "did:example:1", Err: errors.New("unsupported DID method")},
+	}
+
+	out := captureOutput(func() {
+		PrintDIDDocuments(results, Options{})
+	})
+	if !strings.Contains(out, "id: did:web:example.com") {
+		t.Errorf("expected the resolved document, got %s", out)
+	}
+	if !strings.Contains(out, "unsupported DID method") {
+		t.Errorf("expected the resolution error, got %s", out)
+	}
+
+	docs, _ := BuildDIDDocumentsJSON(results)["did_documents"].([]any)
+	if len(docs) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(docs))
+	}
+	if first := docs[0].(map[string]any); first["document"] == nil || first["error"] != nil {
+		t.Errorf("unexpected entry %v", first)
+	}
+	if second := docs[1].(map[string]any); second["error"] != "unsupported DID method" {
+		t.Errorf("unexpected entry %v", second)
+	}
+}
+
 func TestRelativeTime(t *testing.T) {
 	now := time.Date(2026, 2, 26, 12, 0, 0, 0, time.UTC)
 	timeNow = func() time.Time { return now }
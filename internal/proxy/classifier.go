@@ -259,8 +259,7 @@ func decodeEntry(e *TrafficEntry) map[string]any {
 			}
 		}
 		if e.ResponseBody != "" {
-			var resp map[string]any
-			if err := json.Unmarshal([]byte(e.ResponseBody), &resp); err == nil {
+			if resp := decodeCredentialResponse(e.ResponseBody, e.DebugJWK, decoded); resp != nil {
 				decoded["response"] = resp
 				// Try to decode the credential inside the response
 				if cred, ok := resp["credential"].(string); ok {
@@ -299,36 +298,9 @@ func decodeJARMResponse(raw string, cekB64 string, jwkJSON string, decoded map[s
 	raw = strings.TrimSpace(raw)
 
 	if isJWE(raw) {
-		headerBytes, err := format.DecodeBase64URL(strings.SplitN(raw, ".", 2)[0])
-		if err != nil {
+		if !decodeJWEHeader(raw, decoded) {
 			return
 		}
-		var header map[string]any
-		if err := json.Unmarshal(headerBytes, &header); err != nil {
-			return
-		}
-		decoded["response_header"] = header
-
-		// Surface key fields for easier debugging
-		if alg, ok := header["alg"].(string); ok {
-			decoded["encryption_alg"] = alg
-		}
-		if enc, ok := header["enc"].(string); ok {
-			decoded["encryption_enc"] = enc
-		}
-		if kid, ok := header["kid"].(string); ok {
-			decoded["encryption_kid"] = kid
-		}
-		// Ephemeral public key from the JWE sender (wallet)
-		if epk, ok := header["epk"].(map[string]any); ok {
-			decoded["encryption_epk"] = epk
-		}
-		if apu, ok := header["apu"].(string); ok {
-			decoded["encryption_apu"] = apu
-		}
-		if apv, ok := header["apv"].(string); ok {
-			decoded["encryption_apv"] = apv
-		}
 
 		// Try to decrypt with debug CEK if available
 		if cekB64 != "" {
@@ -369,6 +341,72 @@ func decodeJARMResponse(raw string, cekB64 string, jwkJSON string, decoded map[s
 	}
 }
 
+// decodeJWEHeader surfaces the protected header fields of a JWE in decoded.
+// It returns false if the header cannot be parsed.
+func decodeJWEHeader(raw string, decoded map[string]any) bool {
+	headerBytes, err := format.DecodeBase64URL(strings.SplitN(raw, ".", 2)[0])
+	if err != nil {
+		return false
+	}
+	var header map[string]any
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return false
+	}
+	decoded["response_header"] = header
+
+	// Surface key fields for easier debugging
+	if alg, ok := header["alg"].(string); ok {
+		decoded["encryption_alg"] = alg
+	}
+	if enc, ok := header["enc"].(string); ok {
+		decoded["encryption_enc"] = enc
+	}
+	if kid, ok := header["kid"].(string); ok {
+		decoded["encryption_kid"] = kid
+	}
+	// Ephemeral public key from the JWE sender
+	if epk, ok := header["epk"].(map[string]any); ok {
+		decoded["encryption_epk"] = epk
+	}
+	if apu, ok := header["apu"].(string); ok {
+		decoded["encryption_apu"] = apu
+	}
+	if apv, ok := header["apv"].(string); ok {
+		decoded["encryption_apv"] = apv
+	}
+	return true
+}
+
+// decodeCredentialResponse parses an OID4VCI credential response. An
+// encrypted response (JWE) is decrypted with the wallet's ephemeral private
+// key from the X-Debug-JWE-JWK header, if available. Returns nil if the
+// response cannot be read.
+func decodeCredentialResponse(body string, jwkJSON string, decoded map[string]any) map[string]any {
+	raw := strings.TrimSpace(body)
+	if !isJWE(raw) {
+		var resp map[string]any
+		if err := json.Unmarshal([]byte(raw), &resp); err != nil {
+			return nil
+		}
+		return resp
+	}
+
+	if !decodeJWEHeader(raw, decoded) {
+		return nil
+	}
+	if jwkJSON != "" {
+		if plaintext, err := DecryptJWEWithJWK(raw, jwkJSON); err == nil {
+			var resp map[string]any
+			if err := json.Unmarshal(plaintext, &resp); err == nil {
+				decoded["response_type"] = "JWE (decrypted via debug key)"
+				return resp
+			}
+		}
+	}
+	decoded["response_type"] = "JWE (encrypted — payload not readable without the wallet's ephemeral private key)"
+	return nil
+}
+
 // extractJARMCredentials pulls credential strings from a decrypted JARM payload.
 // The payload typically contains vp_token (map or string) and optionally id_token.
 func extractJARMCredentials(payload map[string]any) ([]string, []string) {
@@ -572,21 +610,19 @@ func extractCredentials(e *TrafficEntry) ([]string, []string) {
 		}
 
 	case ClassVCICredentialRequest:
-		if e.ResponseBody != "" {
-			var resp map[string]any
-			if err := json.Unmarshal([]byte(e.ResponseBody), &resp); err == nil {
-				if cred, ok := resp["credential"].(string); ok && cred != "" {
-					creds = append(creds, cred)
-					labels = append(labels, "credential")
-				}
-				// batch response: credentials array
-				if arr, ok := resp["credentials"].([]any); ok {
-					for i, item := range arr {
-						if obj, ok := item.(map[string]any); ok {
-							if cred, ok := obj["credential"].(string); ok && cred != "" {
-								creds = append(creds, cred)
-								labels = append(labels, fmt.Sprintf("credential[%d]", i))
-							}
+		// The response decoded by decodeEntry, decrypted if it was encrypted
+		if resp, ok := e.Decoded["response"].(map[string]any); ok {
+			if cred, ok := resp["credential"].(string); ok && cred != "" {
+				creds = append(creds, cred)
+				labels = append(labels, "credential")
+			}
+			// batch response: credentials array
+			if arr, ok := resp["credentials"].([]any); ok {
+				for i, item := range arr {
+					if obj, ok := item.(map[string]any); ok {
+						if cred, ok := obj["credential"].(string); ok && cred != "" {
+							creds = append(creds, cred)
+							labels = append(labels, fmt.Sprintf("credential[%d]", i))
 						}
 					}
 				}
@@ -444,6 +444,53 @@ func TestDecodeEntryVCICredentialRequest(t *testing.T) {
 	}
 }
 
+func TestDecodeEntryVCIEncryptedCredentialResponse(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwe, _, err := wallet.EncryptJWE([]byte(`{"credentials":[{"credential":"cred1"},{"credential":"cred2"}]}`), &key.PublicKey, "kid", "ECDH-ES", "A128GCM", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &TrafficEntry{
+		Method:       "POST",
+		URL:          "http://issuer.example/credential",
+		RequestBody:  `{"credential_configuration_id":"pid","credential_response_encryption":{"enc":"A128GCM"}}`,
+		StatusCode:   200,
+		ResponseBody: jwe,
+		DebugJWK:     ecPrivateKeyToJWK(t, key),
+	}
+	Classify(e)
+
+	if e.Decoded["response_type"] != "JWE (decrypted via debug key)" {
+		t.Errorf("response_type: got %v", e.Decoded["response_type"])
+	}
+	if e.Decoded["encryption_enc"] != "A128GCM" {
+		t.Errorf("encryption_enc: got %v", e.Decoded["encryption_enc"])
+	}
+	if _, ok := e.Decoded["response"].(map[string]any); !ok {
+		t.Fatal("expected decrypted response as map")
+	}
+	if len(e.Credentials) != 2 || e.Credentials[0] != "cred1" {
+		t.Errorf("expected credentials from decrypted response, got %v", e.Credentials)
+	}
+
+	// Without the wallet's key only the JWE header is shown
+	e.DebugJWK = ""
+	Classify(e)
+	if _, ok := e.Decoded["response"]; ok {
+		t.Error("expected no response without decryption key")
+	}
+	if len(e.Credentials) != 0 {
+		t.Errorf("expected no credentials without decryption key, got %v", e.Credentials)
+	}
+	if e.Decoded["encryption_alg"] != "ECDH-ES" {
+		t.Errorf("encryption_alg: got %v", e.Decoded["encryption_alg"])
+	}
+}
+
 func TestDecodeEntryUnknownReturnsNil(t *testing.T) {
 	e := &TrafficEntry{
 		Method:     "GET",
@@ -103,9 +103,11 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Capture and strip debug JWE key header before forwarding
+	// Capture and strip debug JWE key headers before forwarding
 	debugJWEKey := r.Header.Get("X-Debug-JWE-CEK")
 	r.Header.Del("X-Debug-JWE-CEK")
+	debugJWK := r.Header.Get("X-Debug-JWE-JWK")
+	r.Header.Del("X-Debug-JWE-JWK")
 
 	// Store request info in context via header (cleaned up in modifyResponse)
 	r.Header.Set("X-Proxy-Start", fmt.Sprintf("%d", start.UnixNano()))
@@ -114,6 +116,9 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if debugJWEKey != "" {
 		r.Header.Set("X-Proxy-JWEKey", debugJWEKey)
 	}
+	if debugJWK != "" {
+		r.Header.Set("X-Proxy-JWK", debugJWK)
+	}
 
 	s.proxy.ServeHTTP(w, r)
 }
@@ -150,12 +155,14 @@ func (s *Server) modifyResponse(resp *http.Response) error {
 	reqBody := resp.Request.Header.Get("X-Proxy-ReqBody")
 	origURL := resp.Request.Header.Get("X-Proxy-OrigURL")
 	debugJWEKey := resp.Request.Header.Get("X-Proxy-JWEKey")
+	debugJWK := resp.Request.Header.Get("X-Proxy-JWK")
 
 	// Clean up internal headers
 	resp.Request.Header.Del("X-Proxy-Start")
 	resp.Request.Header.Del("X-Proxy-ReqBody")
 	resp.Request.Header.Del("X-Proxy-OrigURL")
 	resp.Request.Header.Del("X-Proxy-JWEKey")
+	resp.Request.Header.Del("X-Proxy-JWK")
 
 	// Read response body
 	var respBody string
@@ -210,8 +217,7 @@ func (s *Server) modifyResponse(resp *http.Response) error {
 	}
 
 	// Fall back to scanner-detected JWK private key for ECDH-ES decryption
-	var debugJWK string
-	if s.scanner != nil {
+	if debugJWK == "" && s.scanner != nil {
 		debugJWK = s.scanner.LastJWK()
 	}
 
@@ -252,6 +252,46 @@ func TestServerStripsDebugJWEKeyHeader(t *testing.T) {
 	}
 }
 
+func TestServerStripsDebugJWKHeader(t *testing.T) {
+	var receivedHeaders http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedHeaders = r.Header.Clone()
+		w.WriteHeader(200)
+	}))
+	defer backend.Close()
+
+	targetURL, _ := url.Parse(backend.URL)
+	var captured []*TrafficEntry
+	writer := &testWriter{entries: &captured}
+
+	srv := NewServer(Config{TargetURL: targetURL, AllTraffic: true}, writer)
+	proxy := httptest.NewServer(srv)
+	defer proxy.Close()
+
+	req, _ := http.NewRequest("POST", proxy.URL+"/credential", strings.NewReader(`{"credential_configuration_id":"pid"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Debug-JWE-JWK", `{"kty":"EC","crv":"P-256","d":"test"}`)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if receivedHeaders.Get("X-Debug-JWE-JWK") != "" {
+		t.Error("X-Debug-JWE-JWK header was not stripped before forwarding to backend")
+	}
+	if len(captured) != 1 {
+		t.Fatalf("expected 1 captured entry, got %d", len(captured))
+	}
+	if captured[0].DebugJWK != `{"kty":"EC","crv":"P-256","d":"test"}` {
+		t.Errorf("expected DebugJWK from header, got %q", captured[0].DebugJWK)
+	}
+	if captured[0].RequestHeaders.Get("X-Proxy-JWK") != "" {
+		t.Error("internal X-Proxy-JWK header leaked into the captured request headers")
+	}
+}
+
 func TestServerErrorHandler(t *testing.T) {
 	// Test that the error handler returns 502 instead of panicking
 	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
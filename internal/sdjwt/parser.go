@@ -80,7 +80,7 @@ func Parse(raw string) (*Token, error) {
 	}
 
 	// Resolve claims by matching _sd digests
-	token.ResolvedClaims = resolveClaims(token.Payload, token.Disclosures)
+	token.ResolvedClaims = ResolveClaims(token.Payload, token.Disclosures)
 
 	// Generate warnings for disclosed claims whose children are all undisclosed
 	token.Warnings = checkFullyUndisclosedChildren(token.Disclosures)
@@ -224,8 +224,8 @@ func computeDigest(raw string, sdAlg string) (string, error) {
 	return format.EncodeBase64URL(h.Sum(nil)), nil
 }
 
-// resolveClaims merges disclosures into the payload by matching _sd digests.
-func resolveClaims(payload map[string]any, disclosures []Disclosure) map[string]any {
+// ResolveClaims merges disclosures into the payload by matching _sd digests.
+func ResolveClaims(payload map[string]any, disclosures []Disclosure) map[string]any {
 	digestMap := make(map[string]*Disclosure)
 	for i := range disclosures {
 		digestMap[disclosures[i].Digest] = &disclosures[i]
@@ -0,0 +1,168 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdjwt
+
+import "math"
+
+// SelectDisclosures returns the disclosures a holder has to present so that
+// the claims selected by the given claims path pointers (OID4VP 1.0 Section 7)
+// are disclosed, and no others. Along a path only the disclosures that lead
+// to the claim are selected; below the claim everything is, including nested
+// _sd members and "..." array elements. Path elements are strings for object
+// members, non-negative integers for array indices and nil for all array
+// elements. Array indices count every element of the issued array, as in the
+// resolved claims. The result keeps the order of disclosures.
+func SelectDisclosures(payload map[string]any, disclosures []Disclosure, paths [][]any) []Disclosure {
+	digestMap := make(map[string]*Disclosure, len(disclosures))
+	for i := range disclosures {
+		digestMap[disclosures[i].Digest] = &disclosures[i]
+	}
+
+	selected := make(map[string]bool)
+	for _, path := range paths {
+		if len(path) > 0 {
+			selectPath(payload, path, digestMap, selected)
+		}
+	}
+
+	var result []Disclosure
+	for _, d := range disclosures {
+		if selected[d.Digest] {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// selectPath selects the disclosures on the way along path from value.
+func selectPath(value any, path []any, digestMap map[string]*Disclosure, selected map[string]bool) {
+	if len(path) == 0 {
+		selectAll(value, digestMap, selected)
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		name, ok := path[0].(string)
+		if !ok || name == "_sd" || name == "_sd_alg" {
+			return
+		}
+		if child, exists := v[name]; exists {
+			selectPath(child, path[1:], digestMap, selected)
+			return
+		}
+		for _, digest := range sdDigests(v) {
+			if disc, found := digestMap[digest]; found && !disc.IsArrayEntry && disc.Name == name {
+				selected[digest] = true
+				selectPath(disc.Value, path[1:], digestMap, selected)
+				return
+			}
+		}
+	case []any:
+		index, wildcard := -1, path[0] == nil
+		if !wildcard {
+			i, ok := arrayIndex(path[0])
+			if !ok {
+				return
+			}
+			index = i
+		}
+		for i, item := range v {
+			if !wildcard && i != index {
+				continue
+			}
+			elem, digest, ok := arrayElement(item, digestMap)
+			if !ok {
+				continue
+			}
+			if digest != "" {
+				selected[digest] = true
+			}
+			selectPath(elem, path[1:], digestMap, selected)
+		}
+	}
+}
+
+// selectAll selects every disclosure below value.
+func selectAll(value any, digestMap map[string]*Disclosure, selected map[string]bool) {
+	switch v := value.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if k != "_sd" && k != "_sd_alg" {
+				selectAll(child, digestMap, selected)
+			}
+		}
+		for _, digest := range sdDigests(v) {
+			if disc, found := digestMap[digest]; found && !disc.IsArrayEntry {
+				selected[digest] = true
+				selectAll(disc.Value, digestMap, selected)
+			}
+		}
+	case []any:
+		for _, item := range v {
+			elem, digest, ok := arrayElement(item, digestMap)
+			if !ok {
+				continue
+			}
+			if digest != "" {
+				selected[digest] = true
+			}
+			selectAll(elem, digestMap, selected)
+		}
+	}
+}
+
+// sdDigests returns the _sd digests of an object.
+func sdDigests(obj map[string]any) []string {
+	sdArr, _ := obj["_sd"].([]any)
+	digests := make([]string, 0, len(sdArr))
+	for _, d := range sdArr {
+		if s, ok := d.(string); ok {
+			digests = append(digests, s)
+		}
+	}
+	return digests
+}
+
+// arrayElement returns the value of an array element and, for a {"...": digest}
+// element, the digest of its disclosure. ok is false for elements referencing
+// a digest the holder has no disclosure for, such as decoys.
+func arrayElement(item any, digestMap map[string]*Disclosure) (value any, digest string, ok bool) {
+	if obj, isObj := item.(map[string]any); isObj && len(obj) == 1 {
+		if d, isRef := obj["..."].(string); isRef {
+			disc, found := digestMap[d]
+			if !found || !disc.IsArrayEntry {
+				return nil, "", false
+			}
+			return disc.Value, d, true
+		}
+	}
+	return item, "", true
+}
+
+// arrayIndex converts a claims path element to an array index.
+func arrayIndex(elem any) (int, bool) {
+	switch e := elem.(type) {
+	case float64:
+		if e >= 0 && e == math.Trunc(e) {
+			return int(e), true
+		}
+	case int:
+		if e >= 0 {
+			return e, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,96 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdjwt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// nestedTestCredential returns a payload with a recursively disclosable
+// address and an array of disclosable nationalities with a decoy.
+func nestedTestCredential() (map[string]any, []Disclosure) {
+	payload := map[string]any{
+		"iss": "https://issuer.example",
+		"_sd": []any{"d-given", "d-address", "d-nat"},
+	}
+	disclosures := []Disclosure{
+		{Digest: "d-given", Name: "given_name", Value: "Erika"},
+		{Digest: "d-address", Name: "address", Value: map[string]any{
+			"country": "DE",
+			"_sd":     []any{"d-street", "d-locality"},
+		}},
+		{Digest: "d-street", Name: "street_address", Value: "Heidestraße 17"},
+		{Digest: "d-locality", Name: "locality", Value: "Köln"},
+		{Digest: "d-nat", Name: "nationalities", Value: []any{
+			map[string]any{"...": "d-nat0"},
+			map[string]any{"...": "decoy"},
+			map[string]any{"...": "d-nat2"},
+		}},
+		{Digest: "d-nat0", Value: "DE", IsArrayEntry: true},
+		{Digest: "d-nat2", Value: "FR", IsArrayEntry: true},
+	}
+	return payload, disclosures
+}
+
+func TestSelectDisclosures(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths [][]any
+		want  string
+	}{
+		{"top-level claim", [][]any{{"given_name"}}, "d-given"},
+		{"nested member", [][]any{{"address", "locality"}}, "d-address d-locality"},
+		{"whole object", [][]any{{"address"}}, "d-address d-street d-locality"},
+		{"always visible nested member", [][]any{{"address", "country"}}, "d-address"},
+		{"all array elements", [][]any{{"nationalities", nil}}, "d-nat d-nat0 d-nat2"},
+		{"array index", [][]any{{"nationalities", float64(2)}}, "d-nat d-nat2"},
+		{"decoy index", [][]any{{"nationalities", float64(1)}}, "d-nat"},
+		{"index out of range", [][]any{{"nationalities", float64(5)}}, "d-nat"},
+		{"disclosure order kept", [][]any{{"nationalities", float64(0)}, {"given_name"}}, "d-given d-nat d-nat0"},
+		{"plain claim", [][]any{{"iss"}}, ""},
+		{"missing claim", [][]any{{"birthdate"}}, ""},
+		{"index into object", [][]any{{"address", float64(0)}}, "d-address"},
+		{"empty path", [][]any{{}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, disclosures := nestedTestCredential()
+			var digests []string
+			for _, d := range SelectDisclosures(payload, disclosures, tt.paths) {
+				digests = append(digests, d.Digest)
+			}
+			if got := strings.Join(digests, " "); got != tt.want {
+				t.Errorf("SelectDisclosures(%v) = %q, want %q", tt.paths, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectDisclosures_ResolvesToRequestedClaims(t *testing.T) {
+	payload, disclosures := nestedTestCredential()
+	selected := SelectDisclosures(payload, disclosures, [][]any{{"address", "locality"}, {"nationalities", float64(0)}})
+
+	got := ResolveClaims(payload, selected)
+	want := map[string]any{
+		"iss":           "https://issuer.example",
+		"address":       map[string]any{"country": "DE", "locality": "Köln"},
+		"nationalities": []any{"DE", map[string]any{"...": "decoy"}, map[string]any{"...": "d-nat2"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resolved claims = %v, want %v", got, want)
+	}
+}
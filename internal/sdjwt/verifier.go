@@ -17,6 +17,7 @@ package sdjwt
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"fmt"
 	"math/big"
@@ -97,6 +98,8 @@ func Verify(token *Token, pubKey crypto.PublicKey) *VerifyResult {
 		result.SignatureValid = verifyRSA(pubKey, sigInput, sig, crypto.SHA512)
 	case "PS256":
 		result.SignatureValid = verifyRSAPSS(pubKey, sigInput, sig, crypto.SHA256)
+	case "EdDSA":
+		result.SignatureValid = verifyEdDSA(pubKey, sigInput, sig)
 	default:
 		result.Errors = append(result.Errors, fmt.Sprintf("unsupported algorithm: %s", alg))
 	}
@@ -149,3 +152,11 @@ func verifyRSAPSS(pubKey crypto.PublicKey, sigInput, sig []byte, hash crypto.Has
 	h.Write(sigInput)
 	return rsa.VerifyPSS(rsaKey, hash, h.Sum(nil), sig, nil) == nil
 }
+
+func verifyEdDSA(pubKey crypto.PublicKey, sigInput, sig []byte) bool {
+	edKey, ok := pubKey.(ed25519.PublicKey)
+	if !ok {
+		return false
+	}
+	return ed25519.Verify(edKey, sigInput, sig)
+}
@@ -18,18 +18,17 @@ import (
 	"bytes"
 	"compress/flate"
 	"compress/zlib"
-	"crypto"
-	"crypto/ecdsa"
 	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
-	"math/big"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 )
 
 var httpClient = &http.Client{
@@ -237,42 +236,14 @@ func verifyStatusListSignature(header map[string]any, parts []string, trustCerts
 		return false, fmt.Sprintf("decoding signature: %v", err)
 	}
 
-	switch alg {
-	case "ES256":
-		if !verifyECDSA(leaf.PublicKey, sigInput, sig, crypto.SHA256) {
-			return false, "ES256 signature verification failed"
-		}
-	case "ES384":
-		if !verifyECDSA(leaf.PublicKey, sigInput, sig, crypto.SHA384) {
-			return false, "ES384 signature verification failed"
-		}
-	default:
+	if !slices.Contains(keys.Algorithms, keys.Algorithm(alg)) {
 		return false, fmt.Sprintf("unsupported algorithm: %s", alg)
 	}
-
-	return true, fmt.Sprintf("x5c chain valid, signed by %s", leaf.Subject.CommonName)
-}
-
-// verifyECDSA verifies a JWS ECDSA signature (r||s format).
-func verifyECDSA(pubKey crypto.PublicKey, sigInput, sig []byte, hash crypto.Hash) bool {
-	ecKey, ok := pubKey.(*ecdsa.PublicKey)
-	if !ok {
-		return false
-	}
-
-	h := hash.New()
-	h.Write(sigInput)
-	digest := h.Sum(nil)
-
-	keySize := (ecKey.Curve.Params().BitSize + 7) / 8
-	if len(sig) != 2*keySize {
-		return false
+	if err := keys.VerifyJWS(leaf.PublicKey, keys.Algorithm(alg), sigInput, sig); err != nil {
+		return false, fmt.Sprintf("%s signature verification failed: %v", alg, err)
 	}
 
-	r := new(big.Int).SetBytes(sig[:keySize])
-	s := new(big.Int).SetBytes(sig[keySize:])
-
-	return ecdsa.Verify(ecKey, digest, r, s)
+	return true, fmt.Sprintf("x5c chain valid, signed by %s", leaf.Subject.CommonName)
 }
 
 func zlibDecompress(data []byte) ([]byte, error) {
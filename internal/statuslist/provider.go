@@ -17,9 +17,7 @@ package statuslist
 import (
 	"bytes"
 	"compress/zlib"
-	"crypto/ecdsa"
-	"crypto/rand"
-	"crypto/sha256"
+	"crypto"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
@@ -27,11 +25,18 @@ import (
 	"time"
 
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 )
 
 // GenerateStatusListJWT creates a signed status list JWT (RFC 9596) from a bitstring.
 // If certChain is provided, the x5c header is included for certificate chain validation.
-func GenerateStatusListJWT(bitstring []byte, signingKey *ecdsa.PrivateKey, certChain ...*x509.Certificate) (string, error) {
+// The JWT is signed with the default algorithm of signingKey (RS256 for RSA keys).
+func GenerateStatusListJWT(bitstring []byte, signingKey crypto.Signer, certChain ...*x509.Certificate) (string, error) {
+	alg, err := keys.AlgorithmFor(signingKey.Public(), "")
+	if err != nil {
+		return "", err
+	}
+
 	// zlib-compress the bitstring
 	var buf bytes.Buffer
 	w, err := zlib.NewWriterLevel(&buf, zlib.BestCompression)
@@ -59,7 +64,7 @@ func GenerateStatusListJWT(bitstring []byte, signingKey *ecdsa.PrivateKey, certC
 	}
 
 	header := map[string]any{
-		"alg": "ES256",
+		"alg": string(alg),
 		"typ": "statuslist+jwt",
 	}
 
@@ -83,21 +88,11 @@ func GenerateStatusListJWT(bitstring []byte, signingKey *ecdsa.PrivateKey, certC
 	headerB64 := format.EncodeBase64URL(headerJSON)
 	payloadB64 := format.EncodeBase64URL(payloadJSON)
 
-	sigInput := headerB64 + "." + payloadB64
-	h := sha256.Sum256([]byte(sigInput))
-
-	r, s, err := ecdsa.Sign(rand.Reader, signingKey, h[:])
+	sig, err := keys.SignJWS(signingKey, alg, []byte(headerB64+"."+payloadB64))
 	if err != nil {
 		return "", fmt.Errorf("signing: %w", err)
 	}
 
-	keySize := (signingKey.Curve.Params().BitSize + 7) / 8
-	rBytes := r.Bytes()
-	sBytes := s.Bytes()
-	sig := make([]byte, 2*keySize)
-	copy(sig[keySize-len(rBytes):keySize], rBytes)
-	copy(sig[2*keySize-len(sBytes):], sBytes)
-
 	sigB64 := format.EncodeBase64URL(sig)
 
 	return headerB64 + "." + payloadB64 + "." + sigB64, nil
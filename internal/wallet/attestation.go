@@ -0,0 +1,420 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
+)
+
+// DefaultWalletProviderID is the iss of Wallet Instance Attestations minted by
+// the built-in mock wallet provider.
+const DefaultWalletProviderID = "https://wallet-provider.oid4vc-dev.local"
+
+// defaultAttestationLifetime is how long a Wallet Instance Attestation is valid.
+const defaultAttestationLifetime = time.Hour
+
+// ClientAttestationMode controls when the wallet authenticates to the
+// authorization server with an OAuth Client Attestation.
+type ClientAttestationMode string
+
+const (
+	// ClientAttestationAuto attests when the authorization server lists
+	// attest_jwt_client_auth in token_endpoint_auth_methods_supported.
+	ClientAttestationAuto ClientAttestationMode = "auto"
+	// ClientAttestationForce always sends client attestations.
+	ClientAttestationForce ClientAttestationMode = "force"
+	// ClientAttestationOff never sends client attestations.
+	ClientAttestationOff ClientAttestationMode = "off"
+)
+
+// ParseClientAttestationMode parses a client attestation mode string. An
+// empty value means auto.
+func ParseClientAttestationMode(raw string) (ClientAttestationMode, error) {
+	switch ClientAttestationMode(strings.ToLower(strings.TrimSpace(raw))) {
+	case "", ClientAttestationAuto:
+		return ClientAttestationAuto, nil
+	case ClientAttestationForce:
+		return ClientAttestationForce, nil
+	case ClientAttestationOff:
+		return ClientAttestationOff, nil
+	default:
+		return "", fmt.Errorf("invalid client attestation mode %q (expected 'auto', 'force', or 'off')", raw)
+	}
+}
+
+// Attestation defects that can be injected for negative testing.
+const (
+	AttestationDefectExpired      = "expired"       // attestation exp in the past
+	AttestationDefectSignature    = "signature"     // attestation signature corrupted
+	AttestationDefectCNF          = "cnf"           // cnf key differs from the PoP signing key
+	AttestationDefectPoPMissing   = "pop-missing"   // OAuth-Client-Attestation-PoP header omitted
+	AttestationDefectPoPSignature = "pop-signature" // PoP signature corrupted
+	AttestationDefectPoPAudience  = "pop-aud"       // PoP aud is not the authorization server
+	AttestationDefectPoPStale     = "pop-stale"     // PoP iat one hour in the past
+)
+
+var attestationDefects = []string{
+	AttestationDefectExpired,
+	AttestationDefectSignature,
+	AttestationDefectCNF,
+	AttestationDefectPoPMissing,
+	AttestationDefectPoPSignature,
+	AttestationDefectPoPAudience,
+	AttestationDefectPoPStale,
+}
+
+// ParseAttestationDefects validates a list of attestation defect names.
+func ParseAttestationDefects(raw []string) ([]string, error) {
+	var out []string
+	for _, d := range raw {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "" {
+			continue
+		}
+		if !slices.Contains(attestationDefects, d) {
+			return nil, fmt.Errorf("unknown attestation defect %q (expected one of: %s)", d, strings.Join(attestationDefects, ", "))
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// ClientAttestationConfig controls the Wallet Instance Attestation the wallet
+// presents as OAuth Client Attestation at the token and PAR endpoints.
+type ClientAttestationConfig struct {
+	Mode    ClientAttestationMode
+	Claims  map[string]any // merged into the attestation payload; nil values remove claims
+	Defects []string       // deliberate defects for negative testing
+}
+
+func (c ClientAttestationConfig) has(defect string) bool {
+	return slices.Contains(c.Defects, defect)
+}
+
+// WalletProvider is the mock wallet provider that attests this wallet
+// instance. Its certificate is issued by the wallet's CA, so verifiers that
+// use the wallet trust list can validate the x5c chain.
+type WalletProvider struct {
+	Key       *ecdsa.PrivateKey
+	CertChain []*x509.Certificate // [provider, CA]
+}
+
+// x5c returns the provider's certificate chain as x5c header value.
+func (p *WalletProvider) x5c() []string {
+	x5c := make([]string, len(p.CertChain))
+	for i, cert := range p.CertChain {
+		x5c[i] = base64.StdEncoding.EncodeToString(cert.Raw)
+	}
+	return x5c
+}
+
+// walletProvider returns the mock wallet provider and the wallet instance key
+// bound in attestations, creating them on first use.
+func (w *Wallet) walletProvider() (*WalletProvider, *ecdsa.PrivateKey, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.WalletProvider == nil {
+		if w.CAKey == nil || len(w.CertChain) < 2 {
+			return nil, nil, fmt.Errorf("wallet CA is not available to certify the wallet provider")
+		}
+		key, err := mock.GenerateKey()
+		if err != nil {
+			return nil, nil, fmt.Errorf("generating wallet provider key: %w", err)
+		}
+		caCert := w.CertChain[len(w.CertChain)-1]
+		cert, err := mock.GenerateNamedLeafCert(w.CAKey, caCert, &key.PublicKey, "OID4VC Dev Wallet Provider")
+		if err != nil {
+			return nil, nil, fmt.Errorf("generating wallet provider certificate: %w", err)
+		}
+		w.WalletProvider = &WalletProvider{Key: key, CertChain: []*x509.Certificate{cert, caCert}}
+	}
+	if w.InstanceKey == nil {
+		key, err := mock.GenerateKey()
+		if err != nil {
+			return nil, nil, fmt.Errorf("generating wallet instance key: %w", err)
+		}
+		w.InstanceKey = key
+	}
+	return w.WalletProvider, w.InstanceKey, nil
+}
+
+// clientAttester attaches OAuth Client Attestation headers
+// (draft-ietf-oauth-attestation-based-client-auth) to requests to one
+// authorization server.
+type clientAttester struct {
+	cfg         ClientAttestationConfig
+	clientID    string
+	audience    string // authorization server issuer identifier
+	provider    *WalletProvider
+	instanceKey *ecdsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string
+}
+
+// resolveClientAttestation decides whether requests to the authorization
+// server carry a client attestation. It returns nil when they do not.
+func (w *Wallet) resolveClientAttestation(oauthMeta map[string]any, authServer string) (*clientAttester, error) {
+	w.mu.RLock()
+	cfg := w.ClientAttestation
+	clientID := w.IssuanceClientID
+	w.mu.RUnlock()
+
+	if cfg.Mode == ClientAttestationOff {
+		return nil, nil
+	}
+	if cfg.Mode != ClientAttestationForce && !supportsAttestationAuth(oauthMeta) {
+		return nil, nil
+	}
+	if clientID == "" {
+		clientID = DefaultIssuanceClientID
+	}
+
+	provider, instanceKey, err := w.walletProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	audience, _ := oauthMeta["issuer"].(string)
+	if audience == "" {
+		audience = authServer
+	}
+
+	a := &clientAttester{
+		cfg:         cfg,
+		clientID:    clientID,
+		audience:    audience,
+		provider:    provider,
+		instanceKey: instanceKey,
+	}
+	if ep, ok := oauthMeta["challenge_endpoint"].(string); ok && ep != "" {
+		challenge, err := fetchAttestationChallenge(ep)
+		if err != nil {
+			log.Printf("[VCI] Warning: fetching attestation challenge: %v", err)
+		} else {
+			a.challenge = challenge
+		}
+	}
+
+	log.Printf("[VCI] Using OAuth client attestation (client_id %s, aud %s)", clientID, audience)
+	if len(cfg.Defects) > 0 {
+		log.Printf("[VCI] Injecting attestation defects: %s", strings.Join(cfg.Defects, ", "))
+	}
+	return a, nil
+}
+
+// supportsAttestationAuth reports whether the authorization server accepts
+// attestation-based client authentication.
+func supportsAttestationAuth(oauthMeta map[string]any) bool {
+	methods, _ := oauthMeta["token_endpoint_auth_methods_supported"].([]any)
+	for _, m := range methods {
+		if m == "attest_jwt_client_auth" {
+			return true
+		}
+	}
+	return false
+}
+
+// apply sets the attestation headers on req.
+func (a *clientAttester) apply(req *http.Request) error {
+	attestation, err := a.attestationJWT()
+	if err != nil {
+		return fmt.Errorf("creating client attestation: %w", err)
+	}
+	req.Header.Set("OAuth-Client-Attestation", attestation)
+
+	if a.cfg.has(AttestationDefectPoPMissing) {
+		return nil
+	}
+	pop, err := a.popJWT()
+	if err != nil {
+		return fmt.Errorf("creating client attestation PoP: %w", err)
+	}
+	req.Header.Set("OAuth-Client-Attestation-PoP", pop)
+	return nil
+}
+
+// attestationJWT mints a Wallet Instance Attestation signed by the wallet
+// provider and bound to the wallet instance key.
+func (a *clientAttester) attestationJWT() (string, error) {
+	cnfKey := &a.instanceKey.PublicKey
+	if a.cfg.has(AttestationDefectCNF) {
+		other, err := mock.GenerateKey()
+		if err != nil {
+			return "", err
+		}
+		cnfKey = &other.PublicKey
+	}
+
+	header := map[string]any{
+		"alg": "ES256",
+		"typ": "oauth-client-attestation+jwt",
+		"x5c": a.provider.x5c(),
+	}
+
+	now := time.Now()
+	exp := now.Add(defaultAttestationLifetime)
+	if a.cfg.has(AttestationDefectExpired) {
+		exp = now.Add(-time.Minute)
+	}
+	payload := map[string]any{
+		"iss":         DefaultWalletProviderID,
+		"sub":         a.clientID,
+		"iat":         now.Unix(),
+		"exp":         exp.Unix(),
+		"cnf":         map[string]any{"jwk": mock.PublicKeyJWKMap(cnfKey)},
+		"wallet_name": "OID4VC Dev Wallet",
+		"wallet_link": "https://github.com/dominikschlosser/oid4vc-dev",
+	}
+	for k, v := range a.cfg.Claims {
+		if v == nil {
+			delete(payload, k)
+			continue
+		}
+		payload[k] = v
+	}
+
+	jwt, err := signJWT(header, payload, a.provider.Key)
+	if err != nil {
+		return "", err
+	}
+	if a.cfg.has(AttestationDefectSignature) {
+		jwt = corruptJWTSignature(jwt)
+	}
+	return jwt, nil
+}
+
+// popJWT creates the proof of possession of the wallet instance key.
+func (a *clientAttester) popJWT() (string, error) {
+	header := map[string]any{
+		"alg": "ES256",
+		"typ": "oauth-client-attestation-pop+jwt",
+	}
+
+	iat := time.Now()
+	if a.cfg.has(AttestationDefectPoPStale) {
+		iat = iat.Add(-time.Hour)
+	}
+	aud := a.audience
+	if a.cfg.has(AttestationDefectPoPAudience) {
+		aud = "https://wrong-audience.example"
+	}
+	payload := map[string]any{
+		"iss": a.clientID,
+		"aud": aud,
+		"jti": uuid.New().String(),
+		"iat": iat.Unix(),
+	}
+	a.mu.Lock()
+	if a.challenge != "" {
+		payload["challenge"] = a.challenge
+	}
+	a.mu.Unlock()
+
+	jwt, err := signJWT(header, payload, a.instanceKey)
+	if err != nil {
+		return "", err
+	}
+	if a.cfg.has(AttestationDefectPoPSignature) {
+		jwt = corruptJWTSignature(jwt)
+	}
+	return jwt, nil
+}
+
+// rememberChallenge stores the OAuth-Client-Attestation-Challenge of a
+// response and reports whether it is new.
+func (a *clientAttester) rememberChallenge(resp *http.Response) bool {
+	challenge := resp.Header.Get("OAuth-Client-Attestation-Challenge")
+	if challenge == "" {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.challenge == challenge {
+		return false
+	}
+	a.challenge = challenge
+	return true
+}
+
+// isAttestationChallenge reports whether a response asks the client to
+// retry with a server-provided attestation challenge.
+func isAttestationChallenge(body []byte) bool {
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	return json.Unmarshal(body, &errResp) == nil && errResp.Error == "use_attestation_challenge"
+}
+
+// fetchAttestationChallenge obtains a fresh challenge from the authorization
+// server's challenge endpoint.
+func fetchAttestationChallenge(endpoint string) (string, error) {
+	req, err := http.NewRequest("POST", endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("challenge endpoint returned HTTP %d", resp.StatusCode)
+	}
+	var challengeResp struct {
+		Challenge string `json:"attestation_challenge"`
+	}
+	if err := json.Unmarshal(body, &challengeResp); err != nil {
+		return "", fmt.Errorf("parsing challenge response: %w", err)
+	}
+	if challengeResp.Challenge == "" {
+		return "", fmt.Errorf("challenge response missing attestation_challenge")
+	}
+	return challengeResp.Challenge, nil
+}
+
+// corruptJWTSignature flips bits in the signature of a compact JWS so that
+// it no longer verifies.
+func corruptJWTSignature(jwt string) string {
+	i := strings.LastIndex(jwt, ".")
+	sig, err := format.DecodeBase64URL(jwt[i+1:])
+	if err != nil || len(sig) == 0 {
+		return jwt + "x"
+	}
+	sig[0] ^= 0xff
+	return jwt[:i+1] + format.EncodeBase64URL(sig)
+}
@@ -0,0 +1,334 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
+)
+
+func TestParseClientAttestationMode(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    ClientAttestationMode
+		wantErr bool
+	}{
+		{"", ClientAttestationAuto, false},
+		{"auto", ClientAttestationAuto, false},
+		{"Force", ClientAttestationForce, false},
+		{"off", ClientAttestationOff, false},
+		{"on", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseClientAttestationMode(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseClientAttestationMode(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseClientAttestationMode(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestParseAttestationDefects(t *testing.T) {
+	got, err := ParseAttestationDefects([]string{"expired", " POP-aud ", ""})
+	if err != nil {
+		t.Fatalf("ParseAttestationDefects: %v", err)
+	}
+	if len(got) != 2 || got[0] != "expired" || got[1] != "pop-aud" {
+		t.Errorf("unexpected defects: %v", got)
+	}
+	if _, err := ParseAttestationDefects([]string{"bogus"}); err == nil {
+		t.Error("expected error for unknown defect")
+	}
+}
+
+// verifyClientAttestation checks the OAuth Client Attestation headers of r the
+// way an authorization server would, trusting the wallet's CA.
+func verifyClientAttestation(t *testing.T, w *Wallet, r *http.Request, aud, challenge string) (map[string]any, error) {
+	t.Helper()
+	attestation := r.Header.Get("OAuth-Client-Attestation")
+	if attestation == "" {
+		return nil, errors.New("missing OAuth-Client-Attestation")
+	}
+	header, claims, _, err := format.ParseJWTParts(attestation)
+	if err != nil {
+		return nil, fmt.Errorf("parsing attestation: %w", err)
+	}
+	if header["typ"] != "oauth-client-attestation+jwt" {
+		return nil, fmt.Errorf("unexpected attestation typ %v", header["typ"])
+	}
+	x5c, _ := header["x5c"].([]any)
+	if len(x5c) != 2 {
+		return nil, fmt.Errorf("expected x5c chain of 2, got %d", len(x5c))
+	}
+	der, _ := base64.StdEncoding.DecodeString(x5c[0].(string))
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing x5c leaf: %w", err)
+	}
+	if err := leaf.CheckSignatureFrom(w.CertChain[1]); err != nil {
+		return nil, fmt.Errorf("x5c leaf not issued by wallet CA: %w", err)
+	}
+	if !verifyES256(t, attestation, leaf.PublicKey.(*ecdsa.PublicKey)) {
+		return nil, errors.New("attestation signature invalid")
+	}
+	if exp, _ := claims["exp"].(float64); int64(exp) < time.Now().Unix() {
+		return nil, errors.New("attestation expired")
+	}
+
+	pop := r.Header.Get("OAuth-Client-Attestation-PoP")
+	if pop == "" {
+		return nil, errors.New("missing OAuth-Client-Attestation-PoP")
+	}
+	popHeader, popClaims, _, err := format.ParseJWTParts(pop)
+	if err != nil {
+		return nil, fmt.Errorf("parsing PoP: %w", err)
+	}
+	if popHeader["typ"] != "oauth-client-attestation-pop+jwt" {
+		return nil, fmt.Errorf("unexpected PoP typ %v", popHeader["typ"])
+	}
+	cnf, _ := claims["cnf"].(map[string]any)
+	jwkJSON, _ := json.Marshal(cnf["jwk"])
+	cnfKey, err := keys.ParseJWK(jwkJSON)
+	if err != nil {
+		return nil, fmt.Errorf("parsing cnf jwk: %w", err)
+	}
+	if !verifyES256(t, pop, cnfKey.(*ecdsa.PublicKey)) {
+		return nil, errors.New("PoP not signed by cnf key")
+	}
+	if popClaims["iss"] != claims["sub"] {
+		return nil, fmt.Errorf("PoP iss %v does not match attestation sub %v", popClaims["iss"], claims["sub"])
+	}
+	if popClaims["aud"] != aud {
+		return nil, fmt.Errorf("PoP aud %v, want %s", popClaims["aud"], aud)
+	}
+	if iat, _ := popClaims["iat"].(float64); time.Since(time.Unix(int64(iat), 0)) > 5*time.Minute {
+		return nil, errors.New("PoP too old")
+	}
+	if challenge != "" && popClaims["challenge"] != challenge {
+		return nil, fmt.Errorf("PoP challenge %v, want %s", popClaims["challenge"], challenge)
+	}
+	return claims, nil
+}
+
+// attestationIssuer is a pre-authorized code issuer whose token endpoint
+// requires attestation-based client authentication.
+type attestationIssuer struct {
+	t *testing.T
+	w *Wallet
+	// requireChallenge makes the token endpoint demand a challenge via
+	// use_attestation_challenge before accepting the attestation.
+	requireChallenge bool
+
+	tokenRequests int
+	claims        map[string]any // attestation claims of the accepted request
+	verifyErr     error          // last verification failure
+}
+
+func (a *attestationIssuer) start() *httptest.Server {
+	credRaw := generateTestCredential(a.t, a.w)
+	var serverURL string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/.well-known/openid-credential-issuer"):
+			json.NewEncoder(rw).Encode(map[string]any{
+				"credential_issuer":   serverURL,
+				"credential_endpoint": serverURL + "/credential",
+				"credential_configurations_supported": map[string]any{
+					"test-config": map[string]any{"format": "dc+sd-jwt"},
+				},
+			})
+
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/.well-known/oauth-authorization-server"):
+			json.NewEncoder(rw).Encode(map[string]any{
+				"issuer":                                serverURL,
+				"token_endpoint":                        serverURL + "/token",
+				"token_endpoint_auth_methods_supported": []string{"attest_jwt_client_auth"},
+			})
+
+		case r.Method == "POST" && r.URL.Path == "/token":
+			a.tokenRequests++
+			challenge := ""
+			if a.requireChallenge {
+				challenge = "server-challenge"
+				if a.tokenRequests == 1 {
+					rw.Header().Set("OAuth-Client-Attestation-Challenge", challenge)
+					rw.WriteHeader(http.StatusBadRequest)
+					json.NewEncoder(rw).Encode(map[string]string{"error": "use_attestation_challenge"})
+					return
+				}
+			}
+			claims, err := verifyClientAttestation(a.t, a.w, r, serverURL, challenge)
+			if err != nil {
+				a.verifyErr = err
+				rw.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(rw).Encode(map[string]string{"error": "invalid_client", "error_description": err.Error()})
+				return
+			}
+			a.claims = claims
+			json.NewEncoder(rw).Encode(map[string]any{"access_token": "test-access-token", "token_type": "Bearer", "c_nonce": "test-c-nonce"})
+
+		case r.Method == "POST" && r.URL.Path == "/credential":
+			json.NewEncoder(rw).Encode(map[string]any{"credential": credRaw})
+
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	serverURL = srv.URL
+	return srv
+}
+
+func TestProcessCredentialOffer_ClientAttestation(t *testing.T) {
+	w := generateTestWallet(t)
+	w.IssuanceClientID = "test-client"
+	w.ClientAttestation.Claims = map[string]any{"wallet_name": "Custom Wallet", "wallet_link": nil}
+	issuer := &attestationIssuer{t: t, w: w, requireChallenge: true}
+	srv := issuer.start()
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	if _, err := w.ProcessCredentialOffer(preAuthOfferURI(srv.URL)); err != nil {
+		t.Fatalf("ProcessCredentialOffer (client attestation): %v (server: %v)", err, issuer.verifyErr)
+	}
+	if issuer.tokenRequests != 2 {
+		t.Errorf("expected token request to be retried with the challenge, got %d requests", issuer.tokenRequests)
+	}
+	if issuer.claims["sub"] != "test-client" || issuer.claims["iss"] != DefaultWalletProviderID {
+		t.Errorf("unexpected attestation sub/iss: %v", issuer.claims)
+	}
+	if issuer.claims["wallet_name"] != "Custom Wallet" {
+		t.Errorf("expected wallet_name override, got %v", issuer.claims["wallet_name"])
+	}
+	if _, ok := issuer.claims["wallet_link"]; ok {
+		t.Error("expected wallet_link to be removed by null override")
+	}
+}
+
+func TestProcessCredentialOffer_ClientAttestationDefects(t *testing.T) {
+	tests := []struct {
+		defect  string
+		wantErr string
+	}{
+		{AttestationDefectExpired, "attestation expired"},
+		{AttestationDefectSignature, "attestation signature invalid"},
+		{AttestationDefectCNF, "PoP not signed by cnf key"},
+		{AttestationDefectPoPMissing, "missing OAuth-Client-Attestation-PoP"},
+		{AttestationDefectPoPSignature, "PoP not signed by cnf key"},
+		{AttestationDefectPoPAudience, "PoP aud"},
+		{AttestationDefectPoPStale, "PoP too old"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.defect, func(t *testing.T) {
+			w := generateTestWallet(t)
+			w.ClientAttestation.Defects = []string{tt.defect}
+			issuer := &attestationIssuer{t: t, w: w}
+			srv := issuer.start()
+			defer srv.Close()
+
+			oldClient := httpClient
+			httpClient = srv.Client()
+			defer func() { httpClient = oldClient }()
+
+			_, err := w.ProcessCredentialOffer(preAuthOfferURI(srv.URL))
+			if err == nil || !strings.Contains(err.Error(), "invalid_client") {
+				t.Fatalf("expected invalid_client token error, got %v", err)
+			}
+			if issuer.verifyErr == nil || !strings.Contains(issuer.verifyErr.Error(), tt.wantErr) {
+				t.Errorf("expected verification failure %q, got %v", tt.wantErr, issuer.verifyErr)
+			}
+		})
+	}
+}
+
+func TestProcessCredentialOffer_ClientAttestationModes(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     ClientAttestationMode
+		asMeta   map[string]any
+		wantSent bool
+	}{
+		{name: "auto without support", mode: ClientAttestationAuto, wantSent: false},
+		{name: "auto with support", mode: ClientAttestationAuto, asMeta: map[string]any{"token_endpoint_auth_methods_supported": []any{"attest_jwt_client_auth"}}, wantSent: true},
+		{name: "force", mode: ClientAttestationForce, wantSent: true},
+		{name: "off", mode: ClientAttestationOff, asMeta: map[string]any{"token_endpoint_auth_methods_supported": []any{"attest_jwt_client_auth"}}, wantSent: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := generateTestWallet(t)
+			w.ClientAttestation.Mode = tt.mode
+
+			var parSent, tokenSent bool
+			var challenge, state string
+			srv := setupAuthCodeIssuer(t, w, &challenge, &authCodeIssuerOptions{
+				ASMetadata: tt.asMeta,
+				PAR: func(rw http.ResponseWriter, form url.Values) {
+					challenge = form.Get("code_challenge")
+					state = form.Get("state")
+					rw.WriteHeader(http.StatusCreated)
+					json.NewEncoder(rw).Encode(map[string]any{"request_uri": "urn:ietf:params:oauth:request_uri:abc", "expires_in": 60})
+				},
+				OnRequest: func(r *http.Request) {
+					sent := r.Header.Get("OAuth-Client-Attestation") != "" && r.Header.Get("OAuth-Client-Attestation-PoP") != ""
+					switch {
+					case strings.HasSuffix(r.URL.Path, "/par"):
+						parSent = sent
+					case strings.HasSuffix(r.URL.Path, "/token"):
+						tokenSent = sent
+					}
+				},
+			})
+			defer srv.Close()
+
+			oldClient := httpClient
+			httpClient = srv.Client()
+			defer func() { httpClient = oldClient }()
+
+			w.IssuanceClientID = "test-client"
+			w.IssuanceRedirectURI = "http://localhost:8085/callback"
+			w.OnAuthorizationURL = func(authURL string) error {
+				w.CompleteAuthorization(state, AuthorizationCallback{Code: "auth-code-123"})
+				return nil
+			}
+
+			if _, err := w.ProcessCredentialOffer(authCodeOfferURI(srv.URL)); err != nil {
+				t.Fatalf("ProcessCredentialOffer: %v", err)
+			}
+			if parSent != tt.wantSent || tokenSent != tt.wantSent {
+				t.Errorf("expected attestation sent=%v, got PAR=%v token=%v", tt.wantSent, parSent, tokenSent)
+			}
+		})
+	}
+}
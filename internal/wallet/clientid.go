@@ -17,23 +17,34 @@ package wallet
 import (
 	"crypto"
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/sha256"
-	"crypto/sha512"
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
-	"math/big"
 	"strings"
 
+	"github.com/dominikschlosser/oid4vc-dev/internal/did"
+	"github.com/dominikschlosser/oid4vc-dev/internal/federation"
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
 	"github.com/dominikschlosser/oid4vc-dev/internal/jsonutil"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
 )
 
-// VerifyRequestObjectSignature verifies the Request Object JWS using the leaf x5c certificate.
+// FederationVerifier is the verifier an OpenID Federation trust chain resolves
+// an openid_federation: client ID to.
+type FederationVerifier struct {
+	Key      crypto.PublicKey // Request Object signing key named by its kid
+	Metadata map[string]any   // openid_credential_verifier metadata with policies applied
+}
+
+// VerifyRequestObjectSignature verifies the Request Object JWS using the leaf x5c certificate,
+// or, without x5c, the verification method a DID URL kid names in the resolved DID document.
 // If an x5c chain is present, it also verifies that the supplied chain is internally consistent.
-func VerifyRequestObjectSignature(reqObj *oid4vc.RequestObjectJWT) string {
+// Request Objects of openid_federation: client IDs are verified with the key of fed, which
+// VerifyClientID resolves; without it, their signature does not verify.
+func VerifyRequestObjectSignature(reqObj *oid4vc.RequestObjectJWT, fed *FederationVerifier) string {
 	if reqObj == nil {
 		return ""
 	}
@@ -52,12 +63,27 @@ func VerifyRequestObjectSignature(reqObj *oid4vc.RequestObjectJWT) string {
 		return ""
 	}
 
-	certs, warning := extractCertChain(reqObj)
-	if warning != "" {
-		return warning
-	}
-	if warning := verifySuppliedX5CChain(certs); warning != "" {
-		return warning
+	var pubKey crypto.PublicKey
+	if strings.HasPrefix(jsonutil.GetString(reqObj.Payload, "client_id"), "openid_federation:") {
+		if fed == nil {
+			return "Request Object signature cannot be verified: no trust chain resolved the openid_federation: signing key"
+		}
+		pubKey = fed.Key
+	} else if kid := jsonutil.GetString(reqObj.Header, "kid"); strings.HasPrefix(kid, "did:") && len(jsonutil.GetArray(reqObj.Header, "x5c")) == 0 {
+		key, err := resolveDIDKey(kid)
+		if err != nil {
+			return fmt.Sprintf("Request Object signature cannot be verified: %v", err)
+		}
+		pubKey = key
+	} else {
+		certs, warning := extractCertChain(reqObj)
+		if warning != "" {
+			return warning
+		}
+		if warning := verifySuppliedX5CChain(certs); warning != "" {
+			return warning
+		}
+		pubKey = certs[0].PublicKey
 	}
 
 	parts := strings.Split(reqObj.Raw, ".")
@@ -70,7 +96,7 @@ func VerifyRequestObjectSignature(reqObj *oid4vc.RequestObjectJWT) string {
 		return fmt.Sprintf("failed to decode Request Object signature: %v", err)
 	}
 
-	if err := verifyJWSSignature(certs[0].PublicKey, alg, sigInput, sig); err != nil {
+	if err := keys.VerifyJWS(pubKey, keys.Algorithm(alg), sigInput, sig); err != nil {
 		return fmt.Sprintf("Request Object signature verification failed: %v", err)
 	}
 
@@ -78,22 +104,26 @@ func VerifyRequestObjectSignature(reqObj *oid4vc.RequestObjectJWT) string {
 }
 
 // VerifyClientID validates the client_id prefix against the request object and
-// response URI per OID4VP 1.0 Client Identifier Prefixes.
+// response URI per OID4VP 1.0 Client Identifier Prefixes. trustAnchors are the
+// OpenID Federation trust anchors for openid_federation: client IDs, for which
+// it also returns the verifier the trust chain resolves to.
 // Returns a warning string if there's a mismatch, or "" if OK / not applicable.
-func VerifyClientID(clientID string, reqObj *oid4vc.RequestObjectJWT, responseURI string) string {
+func VerifyClientID(clientID string, reqObj *oid4vc.RequestObjectJWT, responseURI string, trustAnchors []string) (*FederationVerifier, string) {
 	switch {
 	case strings.HasPrefix(clientID, "x509_san_dns:"):
-		return verifyX509SAN(clientID, "x509_san_dns:", "dns", reqObj)
+		return nil, verifyX509SAN(clientID, "x509_san_dns:", "dns", reqObj)
 	case strings.HasPrefix(clientID, "x509_hash:"):
-		return verifyX509Hash(clientID, reqObj)
+		return nil, verifyX509Hash(clientID, reqObj)
 	case strings.HasPrefix(clientID, "redirect_uri:"):
-		return verifyRedirectURI(clientID, reqObj, responseURI)
+		return nil, verifyRedirectURI(clientID, reqObj, responseURI)
 	case strings.HasPrefix(clientID, "verifier_attestation:"):
-		return verifyVerifierAttestation(clientID, reqObj)
+		return nil, verifyVerifierAttestation(clientID, reqObj)
 	case strings.HasPrefix(clientID, "decentralized_identifier:"):
-		return verifyDecentralizedIdentifier(clientID, reqObj)
+		return nil, verifyDecentralizedIdentifier(clientID, reqObj)
+	case strings.HasPrefix(clientID, "openid_federation:"):
+		return resolveOpenIDFederation(clientID, reqObj, trustAnchors)
 	default:
-		return ""
+		return nil, ""
 	}
 }
 
@@ -193,30 +223,107 @@ func verifyVerifierAttestation(clientID string, reqObj *oid4vc.RequestObjectJWT)
 }
 
 // verifyDecentralizedIdentifier validates the decentralized_identifier: prefix per OID4VP 1.0.
-// The value must be a valid DID (did:method:identifier format) and a signed Request Object must be present.
-// Note: Full DID resolution is not implemented — only format validation is performed.
+// The value must be a DID, and the signed Request Object's kid must be a DID URL of it.
+// VerifyRequestObjectSignature resolves the DID (did:key, did:jwk, did:web) and checks the
+// signature against the verification method the kid names.
 func verifyDecentralizedIdentifier(clientID string, reqObj *oid4vc.RequestObjectJWT) string {
-	did := strings.TrimPrefix(clientID, "decentralized_identifier:")
+	didValue := strings.TrimPrefix(clientID, "decentralized_identifier:")
 
-	// Validate DID format: must have at least 3 colon-separated parts (did:method:id)
-	didParts := strings.SplitN(did, ":", 3)
-	if len(didParts) < 3 || didParts[0] != "did" || didParts[1] == "" || didParts[2] == "" {
-		return fmt.Sprintf("decentralized_identifier: value %q is not a valid DID (expected did:method:identifier)", did)
+	if _, _, err := did.Split(didValue); err != nil {
+		return fmt.Sprintf("decentralized_identifier: %v", err)
 	}
 
 	if reqObj == nil || reqObj.Header == nil {
 		return "decentralized_identifier: requires a signed Request Object"
 	}
 
-	// Check that the request object's kid header references the DID
+	// The request object's kid header must be a DID URL of the DID
 	kid := jsonutil.GetString(reqObj.Header, "kid")
-	if kid != "" && !strings.HasPrefix(kid, did) {
-		return fmt.Sprintf("decentralized_identifier: Request Object kid %q does not reference DID %q", kid, did)
+	if kid == "" {
+		return "decentralized_identifier: Request Object has no kid naming a verification method of the DID"
+	}
+	if !strings.HasPrefix(kid, didValue+"#") {
+		return fmt.Sprintf("decentralized_identifier: Request Object kid %q does not reference DID %q", kid, didValue)
 	}
 
 	return ""
 }
 
+// resolveOpenIDFederation validates the openid_federation: prefix per OID4VP 1.0.
+// The wallet resolves a trust chain from the verifier's entity identifier to one
+// of the configured trust anchors and looks up the key the Request Object's kid
+// names in the resolved openid_credential_verifier metadata's jwks. Federation
+// entity keys sign entity statements, not Request Objects, and are not used.
+// VerifyRequestObjectSignature checks the signature with that key.
+func resolveOpenIDFederation(clientID string, reqObj *oid4vc.RequestObjectJWT, trustAnchors []string) (*FederationVerifier, string) {
+	entityID := strings.TrimPrefix(clientID, "openid_federation:")
+
+	if reqObj == nil || reqObj.Header == nil || reqObj.Raw == "" {
+		return nil, "openid_federation: requires a signed Request Object"
+	}
+	if len(trustAnchors) == 0 {
+		return nil, "openid_federation: no trust anchors configured (use --trust-anchor)"
+	}
+
+	anchors := make([]federation.TrustAnchor, 0, len(trustAnchors))
+	for _, source := range trustAnchors {
+		anchor, err := federation.LoadTrustAnchor(source, httpClient)
+		if err != nil {
+			return nil, fmt.Sprintf("openid_federation: %v", err)
+		}
+		anchors = append(anchors, *anchor)
+	}
+
+	chain, err := federation.ResolveTrustChain(entityID, anchors, httpClient)
+	if err != nil {
+		return nil, fmt.Sprintf("openid_federation: no valid trust chain for %s: %v", entityID, err)
+	}
+	metadata, ok := chain.Metadata[federation.VerifierEntityType].(map[string]any)
+	if !ok {
+		return nil, fmt.Sprintf("openid_federation: %s has no %s metadata", entityID, federation.VerifierEntityType)
+	}
+
+	kid := jsonutil.GetString(reqObj.Header, "kid")
+	jwk, err := federation.FindJWK(jsonutil.GetMap(metadata, "jwks"), kid)
+	if err != nil {
+		return nil, fmt.Sprintf("openid_federation: Request Object signing key not found in the verifier's %s jwks: %v", federation.VerifierEntityType, err)
+	}
+	jwkJSON, err := json.Marshal(jwk)
+	if err != nil {
+		return nil, fmt.Sprintf("openid_federation: %v", err)
+	}
+	pubKey, err := keys.ParseJWK(jwkJSON)
+	if err != nil {
+		return nil, fmt.Sprintf("openid_federation: %v", err)
+	}
+	return &FederationVerifier{Key: pubKey, Metadata: metadata}, ""
+}
+
+// ApplyFederationMetadata replaces the Request Object's client_metadata with
+// the metadata of the verifier's trust chain, so that response encryption and
+// format negotiation use what the federation vouches for.
+func ApplyFederationMetadata(reqObj *oid4vc.RequestObjectJWT, fed *FederationVerifier) {
+	if reqObj.Payload == nil {
+		reqObj.Payload = map[string]any{}
+	}
+	reqObj.Payload["client_metadata"] = fed.Metadata
+}
+
+// resolveDIDKey resolves the DID of a DID URL and returns the public key of
+// the verification method it names. did:web documents are fetched with the
+// wallet's HTTP client.
+func resolveDIDKey(didURL string) (crypto.PublicKey, error) {
+	doc, err := did.Resolve(didURL, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	vm, ok := doc.FindVerificationMethod(didURL)
+	if !ok {
+		return nil, fmt.Errorf("DID document of %s has no verification method %s", doc.ID, didURL)
+	}
+	return vm.PublicKey()
+}
+
 // extractLeafCert extracts and parses the leaf certificate from the request
 // object's x5c header. Returns a warning if extraction fails.
 func extractLeafCert(reqObj *oid4vc.RequestObjectJWT) (*x509.Certificate, string) {
@@ -280,7 +387,7 @@ func extractCertChain(reqObj *oid4vc.RequestObjectJWT) ([]*x509.Certificate, str
 // prefixRequiresSigning returns true if the client_id prefix requires a signed
 // Request Object per OID4VP 1.0.
 func prefixRequiresSigning(clientID string) bool {
-	prefixes := []string{"x509_san_dns:", "x509_hash:", "decentralized_identifier:", "verifier_attestation:"}
+	prefixes := []string{"x509_san_dns:", "x509_hash:", "decentralized_identifier:", "verifier_attestation:", "openid_federation:"}
 	for _, p := range prefixes {
 		if strings.HasPrefix(clientID, p) {
 			return true
@@ -373,74 +480,3 @@ func verifySuppliedX5CChain(certs []*x509.Certificate) string {
 
 	return ""
 }
-
-func verifyJWSSignature(pubKey crypto.PublicKey, alg string, sigInput, sig []byte) error {
-	hash, err := jwsHash(alg)
-	if err != nil {
-		return err
-	}
-	digest := hashDigest(hash, sigInput)
-
-	switch key := pubKey.(type) {
-	case *ecdsa.PublicKey:
-		if !verifyECDSAJWS(key, sig, digest) {
-			return fmt.Errorf("%s signature invalid", alg)
-		}
-		return nil
-	case *rsa.PublicKey:
-		switch {
-		case strings.HasPrefix(alg, "RS"):
-			return rsa.VerifyPKCS1v15(key, hash, digest, sig)
-		case strings.HasPrefix(alg, "PS"):
-			return rsa.VerifyPSS(key, hash, digest, sig, nil)
-		default:
-			return fmt.Errorf("algorithm %s is not compatible with RSA", alg)
-		}
-	default:
-		return fmt.Errorf("unsupported public key type %T", pubKey)
-	}
-}
-
-func jwsHash(alg string) (crypto.Hash, error) {
-	switch alg {
-	case "ES256", "RS256", "PS256":
-		return crypto.SHA256, nil
-	case "ES384", "RS384", "PS384":
-		return crypto.SHA384, nil
-	case "ES512", "RS512", "PS512":
-		return crypto.SHA512, nil
-	default:
-		return 0, fmt.Errorf("unsupported JWS algorithm %q", alg)
-	}
-}
-
-func hashDigest(hash crypto.Hash, input []byte) []byte {
-	switch hash {
-	case crypto.SHA256:
-		sum := sha256.Sum256(input)
-		return sum[:]
-	case crypto.SHA384:
-		sum := sha512.Sum384(input)
-		return sum[:]
-	case crypto.SHA512:
-		sum := sha512.Sum512(input)
-		return sum[:]
-	default:
-		return nil
-	}
-}
-
-func verifyECDSAJWS(pub *ecdsa.PublicKey, sig, digest []byte) bool {
-	curveBytes := (pub.Params().BitSize + 7) / 8
-	if len(sig) != 2*curveBytes {
-		return false
-	}
-	r := new(big.Int).SetBytes(sig[:curveBytes])
-	s := new(big.Int).SetBytes(sig[curveBytes:])
-
-	if pub.Curve == elliptic.P256() || pub.Curve == elliptic.P384() || pub.Curve == elliptic.P521() {
-		return ecdsa.Verify(pub, digest, r, s)
-	}
-
-	return false
-}
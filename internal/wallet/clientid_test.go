@@ -26,11 +26,14 @@ import (
 	"encoding/json"
 	"math/big"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
 	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
 )
 
@@ -103,7 +106,7 @@ func TestVerifyClientID_X509SanDNS(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			warning := VerifyClientID(tt.clientID, tt.reqObj, "")
+			_, warning := VerifyClientID(tt.clientID, tt.reqObj, "", nil)
 			if tt.wantEmpty && warning != "" {
 				t.Errorf("expected no warning, got: %s", warning)
 			}
@@ -132,7 +135,7 @@ func TestVerifyClientID_X509Hash(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			warning := VerifyClientID(tt.clientID, reqObjWithX5C(certB64), "")
+			_, warning := VerifyClientID(tt.clientID, reqObjWithX5C(certB64), "", nil)
 			if tt.wantEmpty && warning != "" {
 				t.Errorf("expected no warning, got: %s", warning)
 			}
@@ -173,7 +176,7 @@ func TestVerifyClientID_RedirectURI(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			warning := VerifyClientID(tt.clientID, tt.reqObj, tt.responseURI)
+			_, warning := VerifyClientID(tt.clientID, tt.reqObj, tt.responseURI, nil)
 			if tt.wantEmpty && warning != "" {
 				t.Errorf("expected no warning, got: %s", warning)
 			}
@@ -326,7 +329,7 @@ func TestVerifyClientID_VerifierAttestation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			warning := VerifyClientID(tt.clientID, tt.reqObj, "")
+			_, warning := VerifyClientID(tt.clientID, tt.reqObj, "", nil)
 			if tt.wantEmpty && warning != "" {
 				t.Errorf("expected no warning, got: %s", warning)
 			}
@@ -366,7 +369,7 @@ func TestVerifyClientID_DecentralizedIdentifier(t *testing.T) {
 		{
 			name:      "valid DID with matching kid",
 			clientID:  "decentralized_identifier:did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK",
-			reqObj:    &oid4vc.RequestObjectJWT{Header: map[string]any{"kid": "did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK#key-1"}},
+			reqObj:    &oid4vc.RequestObjectJWT{Header: map[string]any{"kid": "did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK#z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK"}},
 			wantEmpty: true,
 		},
 		{
@@ -376,16 +379,16 @@ func TestVerifyClientID_DecentralizedIdentifier(t *testing.T) {
 			wantMsg:  "does not reference DID",
 		},
 		{
-			name:      "valid DID without kid (no check)",
-			clientID:  "decentralized_identifier:did:web:example.com",
-			reqObj:    &oid4vc.RequestObjectJWT{Header: map[string]any{"alg": "ES256"}},
-			wantEmpty: true,
+			name:     "valid DID without kid",
+			clientID: "decentralized_identifier:did:web:example.com",
+			reqObj:   &oid4vc.RequestObjectJWT{Header: map[string]any{"alg": "ES256"}},
+			wantMsg:  "has no kid",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			warning := VerifyClientID(tt.clientID, tt.reqObj, "")
+			_, warning := VerifyClientID(tt.clientID, tt.reqObj, "", nil)
 			if tt.wantEmpty && warning != "" {
 				t.Errorf("expected no warning, got: %s", warning)
 			}
@@ -440,17 +443,101 @@ func TestVerifyRequestObjectSignature(t *testing.T) {
 		Header:  parsedHeader,
 		Payload: parsedPayload,
 	}
-	if warning := VerifyRequestObjectSignature(reqObj); warning != "" {
+	if warning := VerifyRequestObjectSignature(reqObj, nil); warning != "" {
 		t.Fatalf("expected valid signature, got %s", warning)
 	}
 
 	parts := strings.Split(raw, ".")
 	reqObj.Raw = parts[0] + "." + parts[1] + ".AAAA"
-	if warning := VerifyRequestObjectSignature(reqObj); warning == "" {
+	if warning := VerifyRequestObjectSignature(reqObj, nil); warning == "" {
 		t.Fatal("expected signature verification failure")
 	}
 }
 
+func TestVerifyRequestObjectSignature_DIDWeb(t *testing.T) {
+	key, _ := mock.GenerateKey()
+	other, _ := mock.GenerateKey()
+	var didValue string
+	fetches := 0
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/did.json" {
+			http.NotFound(w, r)
+			return
+		}
+		fetches++
+		json.NewEncoder(w).Encode(map[string]any{
+			"id": didValue,
+			"verificationMethod": []any{map[string]any{
+				"id":           "#key-1",
+				"type":         "JsonWebKey2020",
+				"controller":   didValue,
+				"publicKeyJwk": mock.PublicKeyJWKMap(&key.PublicKey),
+			}},
+		})
+	}))
+	defer srv.Close()
+	didValue = "did:web:" + strings.ReplaceAll(strings.TrimPrefix(srv.URL, "https://"), ":", "%3A")
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	sign := func(t *testing.T, kid string, signer *ecdsa.PrivateKey) *oid4vc.RequestObjectJWT {
+		t.Helper()
+		raw, err := signJWT(map[string]any{"alg": "ES256", "typ": "oauth-authz-req+jwt", "kid": kid},
+			map[string]any{"client_id": "decentralized_identifier:" + didValue}, signer)
+		if err != nil {
+			t.Fatalf("signJWT: %v", err)
+		}
+		header, payload, _, err := format.ParseJWTParts(raw)
+		if err != nil {
+			t.Fatalf("ParseJWTParts: %v", err)
+		}
+		return &oid4vc.RequestObjectJWT{Raw: raw, Header: header, Payload: payload}
+	}
+
+	reqObj := sign(t, didValue+"#key-1", key)
+	if _, warning := VerifyClientID("decentralized_identifier:"+didValue, reqObj, "", nil); warning != "" {
+		t.Fatalf("expected client_id to verify, got %s", warning)
+	}
+	if warning := VerifyRequestObjectSignature(reqObj, nil); warning != "" {
+		t.Fatalf("expected valid signature, got %s", warning)
+	}
+	if fetches != 1 {
+		t.Errorf("expected the DID document to be fetched once, got %d", fetches)
+	}
+
+	if warning := VerifyRequestObjectSignature(sign(t, didValue+"#key-1", other), nil); warning == "" {
+		t.Error("expected a signature by another key to fail")
+	}
+	if warning := VerifyRequestObjectSignature(sign(t, didValue+"#key-2", key), nil); !strings.Contains(warning, "has no verification method") {
+		t.Errorf("expected unknown verification method, got %q", warning)
+	}
+}
+
+func TestVerifyRequestObjectSignature_UnresolvableDID(t *testing.T) {
+	tests := []struct {
+		name    string
+		kid     string
+		wantMsg string
+	}{
+		{"kid names no verification method", "did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK#key-1", "has no verification method"},
+		{"unsupported DID method", "did:example:123#key-1", "unsupported DID method"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqObj := &oid4vc.RequestObjectJWT{
+				Raw:    "header.payload.sig",
+				Header: map[string]any{"alg": "ES256", "kid": tt.kid},
+			}
+			if warning := VerifyRequestObjectSignature(reqObj, nil); !strings.Contains(warning, tt.wantMsg) {
+				t.Errorf("expected warning containing %q, got: %q", tt.wantMsg, warning)
+			}
+		})
+	}
+}
+
 func TestVerifyRequestObjectSignature_AllowsAlgNone(t *testing.T) {
 	header := map[string]any{
 		"alg": "none",
@@ -469,7 +556,7 @@ func TestVerifyRequestObjectSignature_AllowsAlgNone(t *testing.T) {
 		Header:  header,
 		Payload: payload,
 	}
-	if warning := VerifyRequestObjectSignature(reqObj); warning != "" {
+	if warning := VerifyRequestObjectSignature(reqObj, nil); warning != "" {
 		t.Fatalf("expected alg=none request object to bypass signature verification, got %s", warning)
 	}
 }
@@ -482,12 +569,153 @@ func TestVerifyClientID_RedirectURIAllowsUnsignedRequestObject(t *testing.T) {
 		},
 	}
 
-	warning := VerifyClientID(
+	_, warning := VerifyClientID(
 		"redirect_uri:https://verifier.example/cb",
 		reqObj,
 		"https://verifier.example/cb",
+		nil,
 	)
 	if warning != "" {
 		t.Fatalf("expected redirect_uri client_id to allow unsigned request objects, got %s", warning)
 	}
 }
+
+func TestVerifyClientID_OpenIDFederation(t *testing.T) {
+	taKey, _ := mock.GenerateKey()
+	verifierKey, _ := mock.GenerateKey()
+	requestKey, _ := mock.GenerateKey()
+	other, _ := mock.GenerateKey()
+	jwks := func(kid string, key *ecdsa.PrivateKey) map[string]any {
+		jwk := map[string]any{}
+		for k, v := range mock.PublicKeyJWKMap(&key.PublicKey) {
+			jwk[k] = v
+		}
+		jwk["kid"] = kid
+		return map[string]any{"keys": []any{jwk}}
+	}
+
+	// A stand-in federation: a trust anchor with one verifier subordinate.
+	var taID, verifierID string
+	statement := func(key *ecdsa.PrivateKey, iss, sub string, claims map[string]any) string {
+		payload := map[string]any{"iss": iss, "sub": sub, "iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix()}
+		for k, v := range claims {
+			payload[k] = v
+		}
+		raw, _ := signJWT(map[string]any{"alg": "ES256", "typ": "entity-statement+jwt", "kid": "fed"}, payload, key)
+		return raw
+	}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ta/.well-known/openid-federation":
+			w.Write([]byte(statement(taKey, taID, taID, map[string]any{
+				"jwks":     jwks("fed", taKey),
+				"metadata": map[string]any{"federation_entity": map[string]any{"federation_fetch_endpoint": taID + "/fetch"}},
+			})))
+		case "/ta/fetch":
+			w.Write([]byte(statement(taKey, taID, r.URL.Query().Get("sub"), map[string]any{
+				"jwks": jwks("fed", verifierKey),
+				"metadata_policy": map[string]any{"openid_credential_verifier": map[string]any{
+					"client_name": map[string]any{"value": "Federated Verifier"},
+				}},
+			})))
+		case "/verifier/.well-known/openid-federation":
+			w.Write([]byte(statement(verifierKey, verifierID, verifierID, map[string]any{
+				"jwks":            jwks("fed", verifierKey),
+				"authority_hints": []any{taID},
+				"metadata": map[string]any{"openid_credential_verifier": map[string]any{
+					"jwks":                 jwks("request", requestKey),
+					"vp_formats_supported": map[string]any{"dc+sd-jwt": map[string]any{"sd-jwt_alg_values": []any{"ES256"}}},
+				}},
+			})))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	taID, verifierID = srv.URL+"/ta", srv.URL+"/verifier"
+	clientID := "openid_federation:" + verifierID
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	sign := func(t *testing.T, kid string, signer *ecdsa.PrivateKey) *oid4vc.RequestObjectJWT {
+		t.Helper()
+		raw, err := signJWT(map[string]any{"alg": "ES256", "typ": "oauth-authz-req+jwt", "kid": kid},
+			map[string]any{"client_id": clientID, "client_metadata": map[string]any{"client_name": "Self-asserted"}}, signer)
+		if err != nil {
+			t.Fatalf("signJWT: %v", err)
+		}
+		header, payload, _, err := format.ParseJWTParts(raw)
+		if err != nil {
+			t.Fatalf("ParseJWTParts: %v", err)
+		}
+		return &oid4vc.RequestObjectJWT{Raw: raw, Header: header, Payload: payload}
+	}
+	anchors := []string{taID + "/.well-known/openid-federation"}
+
+	reqObj := sign(t, "request", requestKey)
+	if warning := VerifyRequestObjectSignature(reqObj, nil); !strings.Contains(warning, "no trust chain") {
+		t.Fatalf("expected the signature not to verify without a trust chain, got %q", warning)
+	}
+	fed, warning := VerifyClientID(clientID, reqObj, "", anchors)
+	if warning != "" {
+		t.Fatalf("expected trust chain to verify, got %s", warning)
+	}
+	if warning := VerifyRequestObjectSignature(reqObj, fed); warning != "" {
+		t.Fatalf("expected signature to verify with the federation key, got %s", warning)
+	}
+	if fed.Metadata["client_name"] != "Federated Verifier" || fed.Metadata["vp_formats_supported"] == nil {
+		t.Errorf("expected metadata from the trust chain, got %v", fed.Metadata)
+	}
+	if metadata, _ := reqObj.Payload["client_metadata"].(map[string]any); metadata["client_name"] != "Self-asserted" {
+		t.Errorf("expected VerifyClientID to leave client_metadata alone, got %v", metadata)
+	}
+
+	if _, err := ValidatePresentationRequest(ValidationModeStrict, clientID, reqObj, "", nil, nil, nil, anchors, nil); err != nil {
+		t.Fatalf("ValidatePresentationRequest: %v", err)
+	}
+	if metadata, _ := reqObj.Payload["client_metadata"].(map[string]any); metadata["client_name"] != "Federated Verifier" {
+		t.Errorf("expected client_metadata from the trust chain, got %v", metadata)
+	}
+
+	untrusted := sign(t, "request", requestKey)
+	findings, err := ValidatePresentationRequest(ValidationModeDebug, clientID, untrusted, "", nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("ValidatePresentationRequest: %v", err)
+	}
+	if !strings.Contains(strings.Join(findings, "; "), "not vouched for by a trust chain") {
+		t.Errorf("expected a finding about the unverified client_metadata, got %v", findings)
+	}
+	if metadata, _ := untrusted.Payload["client_metadata"].(map[string]any); metadata["client_name"] != "Self-asserted" {
+		t.Errorf("expected the request's own client_metadata, got %v", metadata)
+	}
+
+	tests := []struct {
+		name    string
+		reqObj  *oid4vc.RequestObjectJWT
+		anchors []string
+		want    string
+	}{
+		{"entity configuration key", sign(t, "fed", verifierKey), anchors, "signing key not found"},
+		{"wrong key", sign(t, "request", other), anchors, "signature verification failed"},
+		{"unknown kid", sign(t, "missing", requestKey), anchors, "signing key not found"},
+		{"no trust anchors", sign(t, "request", requestKey), nil, "no trust anchors configured"},
+		{"other trust anchor", sign(t, "request", requestKey), []string{verifierID + "/.well-known/openid-federation"}, "no valid trust chain"},
+		{"unsigned", &oid4vc.RequestObjectJWT{Header: map[string]any{"alg": "none"}}, anchors, "requires a signed Request Object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fed, warning := VerifyClientID(clientID, tt.reqObj, "", tt.anchors)
+			if warning == "" {
+				warning = VerifyRequestObjectSignature(tt.reqObj, fed)
+			}
+			if tt.want == "" && warning != "" {
+				t.Errorf("expected no warning, got %s", warning)
+			}
+			if tt.want != "" && !strings.Contains(warning, tt.want) {
+				t.Errorf("expected warning containing %q, got %q", tt.want, warning)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/jsonutil"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
+	"github.com/dominikschlosser/oid4vc-dev/internal/mdoc"
+)
+
+// UnusedInstances returns the number of batch instances not yet presented.
+func (c StoredCredential) UnusedInstances() int {
+	n := 0
+	for _, inst := range c.Instances {
+		if !inst.Used {
+			n++
+		}
+	}
+	return n
+}
+
+// ImportCredentialBatch imports batch-issued copies of one credential as a
+// single StoredCredential with one instance per copy. holderKeys[i] is the key
+// raws[i] is bound to. A batch of one is imported as a plain credential.
+func (w *Wallet) ImportCredentialBatch(raws []string, holderKeys []crypto.Signer) (*StoredCredential, error) {
+	if len(raws) == 0 {
+		return nil, fmt.Errorf("no credentials to import")
+	}
+	if len(raws) > len(holderKeys) {
+		return nil, fmt.Errorf("received %d credentials for %d holder keys", len(raws), len(holderKeys))
+	}
+
+	instances := make([]CredentialInstance, len(raws))
+	for i, raw := range raws {
+		keyPEM, err := encodeKeyPEM(holderKeys[i])
+		if err != nil {
+			return nil, fmt.Errorf("encoding holder key for instance %d: %w", i, err)
+		}
+		instances[i] = CredentialInstance{Raw: raw, HolderKey: string(keyPEM)}
+	}
+
+	imported, err := w.ImportCredential(raws[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(raws) == 1 {
+		return imported, nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := range w.Credentials {
+		if w.Credentials[i].ID == imported.ID {
+			w.Credentials[i].Instances = instances
+			cred := w.Credentials[i]
+			log.Printf("[Wallet] Stored %d batch instances for credential %s", len(instances), cred.ID)
+			return &cred, nil
+		}
+	}
+	return nil, fmt.Errorf("credential %s disappeared during import", imported.ID)
+}
+
+// selectedInstance is the credential selected for a presentation with the
+// holder key it is bound to.
+type selectedInstance struct {
+	cred    StoredCredential
+	key     crypto.Signer
+	index   int    // batch instance, -1 for a credential without instances
+	warning string // set when an already presented instance is reused
+}
+
+// InstancesExhausted reports whether every batch instance of a credential has
+// been presented.
+func (c StoredCredential) InstancesExhausted() bool {
+	return len(c.Instances) > 0 && c.UnusedInstances() == 0
+}
+
+// instancesExhaustedWarning describes the reuse of an instance of a
+// credential whose batch instances are all used.
+func instancesExhaustedWarning(c StoredCredential) string {
+	return fmt.Sprintf("all %d batch instances of credential %s are used; presenting one again makes the presentations linkable", len(c.Instances), c.ID)
+}
+
+// InstanceWarnings returns a warning for every matched credential whose batch
+// instances are all used, for the consent screen.
+func (w *Wallet) InstanceWarnings(matches []CredentialMatch) []string {
+	var warnings []string
+	for _, m := range matches {
+		if cred, ok := w.GetCredential(m.CredentialID); ok && cred.InstancesExhausted() {
+			warnings = append(warnings, instancesExhaustedWarning(cred))
+		}
+	}
+	return warnings
+}
+
+// selectInstance returns the credential to present for id together with the
+// holder key it is bound to. For batch-issued credentials, the first unused
+// instance is selected so consecutive presentations are unlinkable; the caller
+// marks it used with markInstanceUsed once the presentation is built. Once all
+// instances are used, strict mode fails, and debug mode reuses the first
+// instance with a warning.
+func (w *Wallet) selectInstance(id string) (selectedInstance, error) {
+	w.mu.Lock()
+	var cred *StoredCredential
+	for i := range w.Credentials {
+		if w.Credentials[i].ID == id {
+			cred = &w.Credentials[i]
+			break
+		}
+	}
+	if cred == nil {
+		w.mu.Unlock()
+		return selectedInstance{}, fmt.Errorf("credential %s not found", id)
+	}
+	if len(cred.Instances) == 0 {
+		out := *cred
+		w.mu.Unlock()
+		return selectedInstance{cred: out, key: w.holderKeyFor(out), index: -1}, nil
+	}
+
+	idx := slices.IndexFunc(cred.Instances, func(inst CredentialInstance) bool { return !inst.Used })
+	var warning string
+	if idx < 0 {
+		warning = instancesExhaustedWarning(*cred)
+		if w.ValidationMode == ValidationModeStrict {
+			w.mu.Unlock()
+			return selectedInstance{}, errors.New(warning)
+		}
+		log.Printf("[Wallet] WARNING: %s", warning)
+		idx = 0
+	}
+	inst := cred.Instances[idx]
+	total := len(cred.Instances)
+	out := *cred
+	out.Instances = nil
+	w.mu.Unlock()
+
+	key, err := parsePEMKey([]byte(inst.HolderKey), "instance holder")
+	if err != nil {
+		return selectedInstance{}, err
+	}
+
+	out.Raw = inst.Raw
+	if err := out.Rehydrate(); err != nil {
+		return selectedInstance{}, fmt.Errorf("rehydrating instance %d: %w", idx, err)
+	}
+	log.Printf("[Wallet] Using instance %d/%d of credential %s", idx+1, total, id)
+	return selectedInstance{cred: out, key: key, index: idx, warning: warning}, nil
+}
+
+// markInstanceUsed marks a batch instance of a credential as presented.
+func (w *Wallet) markInstanceUsed(id string, index int) {
+	if index < 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := range w.Credentials {
+		if w.Credentials[i].ID == id && index < len(w.Credentials[i].Instances) {
+			w.Credentials[i].Instances[index].Used = true
+			return
+		}
+	}
+}
+
+// holderKeyFor returns the holder key of a credential without batch
+// instances: the key of OtherHolderKeys it is bound to, if it was issued
+// under another --alg, otherwise the wallet's holder key.
+func (w *Wallet) holderKeyFor(cred StoredCredential) crypto.Signer {
+	if bound, ok := credentialHolderKey(cred).(interface{ Equal(crypto.PublicKey) bool }); ok {
+		for _, key := range w.OtherHolderKeys {
+			if bound.Equal(key.Public()) {
+				return key
+			}
+		}
+	}
+	return w.HolderKey
+}
+
+// credentialHolderKey returns the public key a credential is bound to: the
+// cnf key of an SD-JWT or the device key of an mDoc, or nil.
+func credentialHolderKey(cred StoredCredential) crypto.PublicKey {
+	switch cred.Format {
+	case "dc+sd-jwt":
+		issuerJWT, _, _ := strings.Cut(cred.Raw, "~")
+		_, payload, _, err := format.ParseJWTParts(issuerJWT)
+		if err != nil {
+			return nil
+		}
+		jwk := jsonutil.GetMap(jsonutil.GetMap(payload, "cnf"), "jwk")
+		if jwk == nil {
+			return nil
+		}
+		data, err := json.Marshal(jwk)
+		if err != nil {
+			return nil
+		}
+		pub, err := keys.ParseJWK(data)
+		if err != nil {
+			return nil
+		}
+		return pub
+	case "mso_mdoc":
+		doc, err := mdoc.Parse(cred.Raw)
+		if err != nil || doc.IssuerAuth == nil || doc.IssuerAuth.MSO == nil {
+			return nil
+		}
+		pub, err := mdoc.DeviceKey(doc.IssuerAuth.MSO)
+		if err != nil {
+			return nil
+		}
+		return pub
+	}
+	return nil
+}
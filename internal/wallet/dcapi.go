@@ -0,0 +1,286 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/jsonutil"
+	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
+)
+
+// Digital Credentials API protocol identifiers (OID4VP 1.0 Appendix A.1).
+const (
+	DCAPIProtocolUnsigned    = "openid4vp-v1-unsigned"
+	DCAPIProtocolSigned      = "openid4vp-v1-signed"
+	DCAPIProtocolMultiSigned = "openid4vp-v1-multisigned"
+)
+
+// DCAPIRequest is an OID4VP request as a page passes it to
+// navigator.credentials.get, together with the origin the browser would
+// attach to it.
+type DCAPIRequest struct {
+	Origin   string         `json:"origin"`
+	Protocol string         `json:"protocol"`
+	Data     map[string]any `json:"data"`
+}
+
+// IsDCAPIResponseMode reports whether mode is a DC API response mode.
+func IsDCAPIResponseMode(mode string) bool {
+	return mode == "dc_api" || mode == "dc_api.jwt"
+}
+
+// ParseDCAPIRequest extracts the authorization request parameters of a DC API
+// request (OID4VP 1.0 Appendix A.3). Unsigned requests carry the parameters
+// in data and are represented as an unsecured (alg "none") request object
+// with the client_id "origin:<origin>". Signed requests carry a compact JWS in
+// data.request; multi-signed requests a JWS JSON serialization whose
+// signatures each name a client_id in their protected header. Of these, the
+// first signature whose client_id and signature verify is used.
+func ParseDCAPIRequest(req DCAPIRequest, trustAnchors []string) (*AuthorizationRequestParams, error) {
+	origin, err := url.Parse(req.Origin)
+	if err != nil || origin.Scheme == "" || origin.Host == "" {
+		return nil, fmt.Errorf("invalid origin %q", req.Origin)
+	}
+	if req.Data == nil {
+		return nil, fmt.Errorf("missing data")
+	}
+
+	var reqObj *oid4vc.RequestObjectJWT
+	switch req.Protocol {
+	case DCAPIProtocolUnsigned:
+		reqObj, err = unsignedDCAPIRequestObject(req.Data, req.Origin)
+	case DCAPIProtocolSigned:
+		raw, ok := req.Data["request"].(string)
+		if !ok || raw == "" {
+			return nil, fmt.Errorf("signed request has no request parameter")
+		}
+		header, payload, _, parseErr := format.ParseJWTParts(raw)
+		if parseErr != nil {
+			return nil, fmt.Errorf("parsing request: %w", parseErr)
+		}
+		reqObj = &oid4vc.RequestObjectJWT{Raw: raw, Header: header, Payload: payload}
+	case DCAPIProtocolMultiSigned:
+		var candidates []*oid4vc.RequestObjectJWT
+		candidates, err = multiSignedDCAPIRequestObjects(req.Data["request"])
+		if err == nil {
+			reqObj = selectDCAPIRequestObject(candidates, trustAnchors)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported protocol %q", req.Protocol)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	params := &AuthorizationRequestParams{
+		ClientID:        jsonutil.GetString(reqObj.Payload, "client_id"),
+		ResponseType:    jsonutil.GetString(reqObj.Payload, "response_type"),
+		ResponseMode:    jsonutil.GetString(reqObj.Payload, "response_mode"),
+		Nonce:           jsonutil.GetString(reqObj.Payload, "nonce"),
+		State:           jsonutil.GetString(reqObj.Payload, "state"),
+		RedirectURI:     jsonutil.GetString(reqObj.Payload, "redirect_uri"),
+		ResponseURI:     jsonutil.GetString(reqObj.Payload, "response_uri"),
+		DCQLQuery:       jsonutil.GetMap(reqObj.Payload, "dcql_query"),
+		TransactionData: stringValues(reqObj.Payload["transaction_data"]),
+		VerifierInfo:    objectArray(jsonutil.GetArray(reqObj.Payload, "verifier_info")),
+		RequestObject:   reqObj,
+		Origin:          req.Origin,
+		Protocol:        req.Protocol,
+	}
+	if req.Protocol != DCAPIProtocolUnsigned && params.ClientID == "" {
+		return nil, fmt.Errorf("signed request has no client_id")
+	}
+	return params, nil
+}
+
+// unsignedDCAPIRequestObject wraps the parameters of an unsigned request in an
+// unsecured request object. A client_id in the parameters is ignored.
+func unsignedDCAPIRequestObject(data map[string]any, origin string) (*oid4vc.RequestObjectJWT, error) {
+	payload := make(map[string]any, len(data)+1)
+	for k, v := range data {
+		payload[k] = v
+	}
+	payload["client_id"] = "origin:" + origin
+
+	header := map[string]any{"alg": "none", "typ": "oauth-authz-req+jwt"}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encoding request: %w", err)
+	}
+	raw := format.EncodeBase64URL(headerJSON) + "." + format.EncodeBase64URL(payloadJSON) + "."
+	return &oid4vc.RequestObjectJWT{Raw: raw, Header: header, Payload: payload}, nil
+}
+
+// multiSignedDCAPIRequestObjects returns one request object per signature of
+// a JWS JSON serialization. Each has the signature's protected and
+// unprotected header members as header, the payload with the client_id of
+// the protected header, and the compact form of that signature as Raw, so it
+// can be verified like a single-signed request object.
+func multiSignedDCAPIRequestObjects(request any) ([]*oid4vc.RequestObjectJWT, error) {
+	if s, ok := request.(string); ok {
+		if err := json.Unmarshal([]byte(s), &request); err != nil {
+			return nil, fmt.Errorf("parsing request: %w", err)
+		}
+	}
+	jws, ok := request.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("multi-signed request is not a JWS JSON serialization")
+	}
+	payloadB64 := jsonutil.GetString(jws, "payload")
+	payloadJSON, err := format.DecodeBase64URL(payloadB64)
+	if err != nil {
+		return nil, fmt.Errorf("decoding payload: %w", err)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(payloadJSON, &payload); err != nil {
+		return nil, fmt.Errorf("parsing payload: %w", err)
+	}
+
+	signatures := jsonutil.GetArray(jws, "signatures")
+	if len(signatures) == 0 {
+		return nil, fmt.Errorf("multi-signed request has no signatures")
+	}
+	var candidates []*oid4vc.RequestObjectJWT
+	for i, v := range signatures {
+		sig, _ := v.(map[string]any)
+		protectedB64 := jsonutil.GetString(sig, "protected")
+		protectedJSON, err := format.DecodeBase64URL(protectedB64)
+		if err != nil {
+			return nil, fmt.Errorf("signature %d: decoding protected header: %w", i, err)
+		}
+		var header map[string]any
+		if err := json.Unmarshal(protectedJSON, &header); err != nil {
+			return nil, fmt.Errorf("signature %d: parsing protected header: %w", i, err)
+		}
+		clientID := jsonutil.GetString(header, "client_id")
+		if clientID == "" {
+			return nil, fmt.Errorf("signature %d: protected header has no client_id", i)
+		}
+		for k, hv := range jsonutil.GetMap(sig, "header") {
+			if _, exists := header[k]; !exists {
+				header[k] = hv
+			}
+		}
+
+		sigPayload := make(map[string]any, len(payload)+1)
+		for k, pv := range payload {
+			sigPayload[k] = pv
+		}
+		sigPayload["client_id"] = clientID
+		candidates = append(candidates, &oid4vc.RequestObjectJWT{
+			Raw:     protectedB64 + "." + payloadB64 + "." + jsonutil.GetString(sig, "signature"),
+			Header:  header,
+			Payload: sigPayload,
+		})
+	}
+	return candidates, nil
+}
+
+// selectDCAPIRequestObject returns the first candidate whose client_id and
+// signature verify, or the first candidate, whose findings validation then
+// reports.
+func selectDCAPIRequestObject(candidates []*oid4vc.RequestObjectJWT, trustAnchors []string) *oid4vc.RequestObjectJWT {
+	for _, reqObj := range candidates {
+		clientID := jsonutil.GetString(reqObj.Payload, "client_id")
+		if fed, finding := VerifyClientID(clientID, reqObj, "", trustAnchors); finding == "" && VerifyRequestObjectSignature(reqObj, fed) == "" {
+			return reqObj
+		}
+	}
+	return candidates[0]
+}
+
+// ValidateDCAPIRequest checks the DC API specific rules of OID4VP 1.0
+// Appendix A: a dc_api or dc_api.jwt response mode (the latter with an
+// encryption key), a nonce, no response_uri or redirect_uri, and, for signed
+// requests, expected_origins listing the origin and a client_id that does not
+// use the reserved origin: prefix.
+func ValidateDCAPIRequest(params *AuthorizationRequestParams) []string {
+	var findings []string
+	if !IsDCAPIResponseMode(params.ResponseMode) {
+		findings = append(findings, fmt.Sprintf("response_mode must be dc_api or dc_api.jwt, got %q", params.ResponseMode))
+	}
+	if params.ResponseMode == "dc_api.jwt" && !HasEncryptionKey(params.RequestObject) {
+		findings = append(findings, "response_mode is dc_api.jwt but client_metadata.jwks has no encryption key")
+	}
+	if params.Nonce == "" {
+		findings = append(findings, "request has no nonce")
+	}
+	if params.ResponseURI != "" || params.RedirectURI != "" {
+		findings = append(findings, "response_uri and redirect_uri are not used with the DC API")
+	}
+	if params.Protocol == DCAPIProtocolUnsigned {
+		return findings
+	}
+
+	if strings.HasPrefix(params.ClientID, "origin:") {
+		findings = append(findings, "client_id prefix origin: is reserved and must not be used in requests")
+	}
+	expected := stringValues(params.RequestObject.Payload["expected_origins"])
+	switch {
+	case len(expected) == 0:
+		findings = append(findings, "signed request has no expected_origins")
+	case !slices.Contains(expected, params.Origin):
+		findings = append(findings, fmt.Sprintf("origin %s is not in expected_origins %v", params.Origin, expected))
+	}
+	return findings
+}
+
+// BuildDCAPIResponse builds the data of the DC API response: the vp_token
+// (and id_token) for dc_api, or {"response": JWE} encrypted to the verifier's
+// client_metadata key for dc_api.jwt.
+func (w *Wallet) BuildDCAPIResponse(vpResult *VPTokenMapResult, idToken string, params PresentationParams) (map[string]any, error) {
+	var vpToken map[string][]string
+	if vpResult != nil {
+		vpToken = vpResult.VPToken()
+	}
+
+	if params.ResponseMode == "dc_api.jwt" {
+		jwe, _, err := w.EncryptResponse(vpToken, nil, idToken, "", "", params)
+		if err != nil {
+			return nil, fmt.Errorf("encrypting response: %w", err)
+		}
+		return map[string]any{"response": jwe}, nil
+	}
+
+	data := map[string]any{}
+	if vpToken != nil {
+		data["vp_token"] = vpToken
+	}
+	if idToken != "" {
+		data["id_token"] = idToken
+	}
+	return data, nil
+}
+
+// objectArray returns the object elements of a JSON array.
+func objectArray(arr []any) []map[string]any {
+	var values []map[string]any
+	for _, v := range arr {
+		if m, ok := v.(map[string]any); ok {
+			values = append(values, m)
+		}
+	}
+	return values
+}
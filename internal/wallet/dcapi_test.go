@@ -0,0 +1,257 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/did"
+	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
+	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
+)
+
+const testOrigin = "https://verifier.example"
+
+// testDIDJWKSigner returns a did:jwk for key and the kid of its verification method.
+func testDIDJWKSigner(t *testing.T, key *ecdsa.PrivateKey) (string, string) {
+	t.Helper()
+	jwk := map[string]any{}
+	for k, v := range mock.PublicKeyJWKMap(&key.PublicKey) {
+		jwk[k] = v
+	}
+	didValue, err := did.JWKDID(jwk)
+	if err != nil {
+		t.Fatalf("JWKDID: %v", err)
+	}
+	return didValue, didValue + "#0"
+}
+
+func TestParseDCAPIRequest_Unsigned(t *testing.T) {
+	params, err := ParseDCAPIRequest(DCAPIRequest{
+		Origin:   testOrigin,
+		Protocol: DCAPIProtocolUnsigned,
+		Data: map[string]any{
+			"client_id":       "ignored",
+			"response_type":   "vp_token",
+			"response_mode":   "dc_api",
+			"nonce":           "n-1",
+			"dcql_query":      map[string]any{"credentials": []any{}},
+			"client_metadata": map[string]any{"vp_formats_supported": map[string]any{"dc+sd-jwt": map[string]any{}}},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("ParseDCAPIRequest: %v", err)
+	}
+	if params.ClientID != "origin:"+testOrigin {
+		t.Errorf("client_id = %q, want origin:%s", params.ClientID, testOrigin)
+	}
+	if params.ResponseMode != "dc_api" || params.Nonce != "n-1" || params.DCQLQuery == nil {
+		t.Errorf("unexpected params %+v", params)
+	}
+	if findings, err := ValidatePresentationRequest(ValidationModeStrict, params.ClientID, params.RequestObject, "", nil, nil, nil, nil, nil); err != nil {
+		t.Errorf("expected the unsecured request object to validate, got %v %v", findings, err)
+	}
+	if findings := ValidateDCAPIRequest(params); len(findings) != 0 {
+		t.Errorf("unexpected findings %v", findings)
+	}
+}
+
+func TestParseDCAPIRequest_Signed(t *testing.T) {
+	key, _ := mock.GenerateKey()
+	didValue, kid := testDIDJWKSigner(t, key)
+	raw, err := signJWT(map[string]any{"alg": "ES256", "typ": "oauth-authz-req+jwt", "kid": kid}, map[string]any{
+		"client_id":        "decentralized_identifier:" + didValue,
+		"response_type":    "vp_token",
+		"response_mode":    "dc_api",
+		"nonce":            "n-1",
+		"expected_origins": []any{"https://other.example"},
+		"client_metadata":  map[string]any{"vp_formats_supported": map[string]any{"dc+sd-jwt": map[string]any{}}},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := ParseDCAPIRequest(DCAPIRequest{Origin: testOrigin, Protocol: DCAPIProtocolSigned, Data: map[string]any{"request": raw}}, nil)
+	if err != nil {
+		t.Fatalf("ParseDCAPIRequest: %v", err)
+	}
+	if params.ClientID != "decentralized_identifier:"+didValue {
+		t.Errorf("client_id = %q", params.ClientID)
+	}
+	if _, err := ValidatePresentationRequest(ValidationModeStrict, params.ClientID, params.RequestObject, "", nil, nil, nil, nil, nil); err != nil {
+		t.Errorf("expected signed request to validate: %v", err)
+	}
+	findings := ValidateDCAPIRequest(params)
+	if len(findings) != 1 || !strings.Contains(findings[0], "is not in expected_origins") {
+		t.Errorf("expected an expected_origins finding, got %v", findings)
+	}
+}
+
+func TestParseDCAPIRequest_MultiSigned(t *testing.T) {
+	trusted, _ := mock.GenerateKey()
+	other, _ := mock.GenerateKey()
+	trustedDID, trustedKid := testDIDJWKSigner(t, trusted)
+	otherDID, otherKid := testDIDJWKSigner(t, other)
+
+	payload := map[string]any{
+		"response_type":    "vp_token",
+		"response_mode":    "dc_api",
+		"nonce":            "n-1",
+		"expected_origins": []any{testOrigin},
+		"client_metadata":  map[string]any{"vp_formats_supported": map[string]any{"dc+sd-jwt": map[string]any{}}},
+	}
+	// signature signs the shared payload with client_id in the protected
+	// header and kid in the unprotected header.
+	signature := func(key *ecdsa.PrivateKey, clientID, kid string) (string, map[string]any) {
+		raw, err := signJWT(map[string]any{"alg": "ES256", "typ": "oauth-authz-req+jwt", "client_id": clientID}, payload, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts := strings.Split(raw, ".")
+		return parts[1], map[string]any{"protected": parts[0], "header": map[string]any{"kid": kid}, "signature": parts[2]}
+	}
+	payloadB64, trustedSig := signature(trusted, "decentralized_identifier:"+trustedDID, trustedKid)
+	// The other verifier's signature names a key it was not made with.
+	_, otherSig := signature(trusted, "decentralized_identifier:"+otherDID, otherKid)
+	request := map[string]any{"payload": payloadB64, "signatures": []any{otherSig, trustedSig}}
+
+	params, err := ParseDCAPIRequest(DCAPIRequest{Origin: testOrigin, Protocol: DCAPIProtocolMultiSigned, Data: map[string]any{"request": request}}, nil)
+	if err != nil {
+		t.Fatalf("ParseDCAPIRequest: %v", err)
+	}
+	if params.ClientID != "decentralized_identifier:"+trustedDID {
+		t.Errorf("expected the verifiable signature to be selected, got client_id %q", params.ClientID)
+	}
+	if _, err := ValidatePresentationRequest(ValidationModeStrict, params.ClientID, params.RequestObject, "", nil, nil, nil, nil, nil); err != nil {
+		t.Errorf("expected selected signature to validate: %v", err)
+	}
+	if findings := ValidateDCAPIRequest(params); len(findings) != 0 {
+		t.Errorf("unexpected findings %v", findings)
+	}
+
+	_, unnamed := signature(trusted, "", trustedKid)
+	request["signatures"] = []any{unnamed}
+	if _, err := ParseDCAPIRequest(DCAPIRequest{Origin: testOrigin, Protocol: DCAPIProtocolMultiSigned, Data: map[string]any{"request": request}}, nil); err == nil || !strings.Contains(err.Error(), "no client_id") {
+		t.Errorf("expected a signature without client_id to be rejected, got %v", err)
+	}
+}
+
+func TestParseDCAPIRequest_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		req  DCAPIRequest
+		want string
+	}{
+		{"no origin", DCAPIRequest{Protocol: DCAPIProtocolUnsigned, Data: map[string]any{}}, "invalid origin"},
+		{"unknown protocol", DCAPIRequest{Origin: testOrigin, Protocol: "openid4vp", Data: map[string]any{}}, "unsupported protocol"},
+		{"no data", DCAPIRequest{Origin: testOrigin, Protocol: DCAPIProtocolUnsigned}, "missing data"},
+		{"signed without request", DCAPIRequest{Origin: testOrigin, Protocol: DCAPIProtocolSigned, Data: map[string]any{}}, "no request parameter"},
+		{"signed without client_id", DCAPIRequest{Origin: testOrigin, Protocol: DCAPIProtocolSigned, Data: map[string]any{
+			"request": makeTestJWT(map[string]any{"alg": "ES256"}, map[string]any{"nonce": "n"}),
+		}}, "no client_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseDCAPIRequest(tt.req, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateDCAPIRequest(t *testing.T) {
+	key, _ := mock.GenerateKey()
+	tests := []struct {
+		name string
+		data map[string]any
+		want string
+	}{
+		{"wrong response mode", map[string]any{"response_mode": "direct_post", "nonce": "n"}, "response_mode must be dc_api or dc_api.jwt"},
+		{"dc_api.jwt without key", map[string]any{"response_mode": "dc_api.jwt", "nonce": "n"}, "has no encryption key"},
+		{"no nonce", map[string]any{"response_mode": "dc_api"}, "has no nonce"},
+		{"response_uri", map[string]any{"response_mode": "dc_api", "nonce": "n", "response_uri": "https://verifier.example/cb"}, "not used with the DC API"},
+		{"dc_api.jwt", map[string]any{"response_mode": "dc_api.jwt", "nonce": "n", "client_metadata": map[string]any{
+			"jwks": map[string]any{"keys": []any{testEncJWK(t, &key.PublicKey)}},
+		}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := ParseDCAPIRequest(DCAPIRequest{Origin: testOrigin, Protocol: DCAPIProtocolUnsigned, Data: tt.data}, nil)
+			if err != nil {
+				t.Fatalf("ParseDCAPIRequest: %v", err)
+			}
+			findings := strings.Join(ValidateDCAPIRequest(params), "; ")
+			if tt.want == "" && findings != "" {
+				t.Errorf("unexpected findings %s", findings)
+			}
+			if !strings.Contains(findings, tt.want) {
+				t.Errorf("expected finding containing %q, got %q", tt.want, findings)
+			}
+		})
+	}
+
+	signed := &AuthorizationRequestParams{
+		ClientID:      "origin:" + testOrigin,
+		ResponseMode:  "dc_api",
+		Nonce:         "n",
+		Origin:        testOrigin,
+		Protocol:      DCAPIProtocolSigned,
+		RequestObject: unsignedTestRequestObject(t, map[string]any{}),
+	}
+	findings := strings.Join(ValidateDCAPIRequest(signed), "; ")
+	if !strings.Contains(findings, "origin: is reserved") || !strings.Contains(findings, "has no expected_origins") {
+		t.Errorf("expected reserved prefix and expected_origins findings, got %q", findings)
+	}
+}
+
+func unsignedTestRequestObject(t *testing.T, data map[string]any) *oid4vc.RequestObjectJWT {
+	t.Helper()
+	reqObj, err := unsignedDCAPIRequestObject(data, testOrigin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reqObj
+}
+
+func TestBuildSessionTranscriptDCAPI(t *testing.T) {
+	thumbprint := []byte{1, 2, 3}
+	transcript, err := buildSessionTranscriptDCAPI(testOrigin, "n-1", thumbprint)
+	if err != nil {
+		t.Fatalf("buildSessionTranscriptDCAPI: %v", err)
+	}
+
+	var decoded []any
+	if err := cbor.Unmarshal(transcript, &decoded); err != nil {
+		t.Fatalf("decoding SessionTranscript: %v", err)
+	}
+	if len(decoded) != 3 || decoded[0] != nil || decoded[1] != nil {
+		t.Fatalf("unexpected SessionTranscript %v", decoded)
+	}
+	handover, _ := decoded[2].([]any)
+	if len(handover) != 2 || handover[0] != "OpenID4VPDCAPIHandover" {
+		t.Fatalf("unexpected handover %v", decoded[2])
+	}
+	info, _ := cbor.Marshal([]any{testOrigin, "n-1", thumbprint})
+	want := sha256.Sum256(info)
+	if hash, _ := handover[1].([]byte); string(hash) != string(want[:]) {
+		t.Error("handover hash does not match SHA256(CBOR([origin, nonce, jwkThumbprint]))")
+	}
+}
@@ -15,12 +15,16 @@
 package wallet
 
 import (
+	"fmt"
 	"log"
+	"math"
+	"slices"
 	"sort"
 	"strings"
 
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
 	"github.com/dominikschlosser/oid4vc-dev/internal/mdoc"
+	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
 	"github.com/dominikschlosser/oid4vc-dev/internal/sdjwt"
 	"github.com/dominikschlosser/oid4vc-dev/internal/trustlist"
 	"github.com/dominikschlosser/oid4vc-dev/internal/validate"
@@ -29,12 +33,20 @@ import (
 // EvaluateDCQL matches stored credentials against a DCQL query (OID4VP 1.0 Section 6).
 // It returns matched credentials grouped by query credential ID.
 func (w *Wallet) EvaluateDCQL(query map[string]any) []CredentialMatch {
+	return w.EvaluateDCQLForRequest(query, nil)
+}
+
+// EvaluateDCQLForRequest is EvaluateDCQL for a request whose client_metadata
+// may restrict the formats and algorithms of the presentations: credentials
+// its vp_formats_supported rules out do not match.
+func (w *Wallet) EvaluateDCQLForRequest(query map[string]any, reqObj *oid4vc.RequestObjectJWT) []CredentialMatch {
 	credentials := w.GetCredentials()
 	credQueries, _ := query["credentials"].([]any)
 
 	log.Printf("[DCQL] Evaluating query: %d credential queries against %d stored credentials", len(credQueries), len(credentials))
 
 	var matches []CredentialMatch
+	multiple := make(map[string]bool)
 
 	for _, cq := range credQueries {
 		cqMap, ok := cq.(map[string]any)
@@ -44,6 +56,11 @@ func (w *Wallet) EvaluateDCQL(query map[string]any) []CredentialMatch {
 
 		queryID, _ := cqMap["id"].(string)
 		queryFormat, _ := cqMap["format"].(string)
+		multiple[queryID], _ = cqMap["multiple"].(bool)
+		holderBinding, ok := cqMap["require_cryptographic_holder_binding"].(bool)
+		if !ok {
+			holderBinding = true
+		}
 
 		for _, cred := range credentials {
 			typeLabel := cred.VCT
@@ -59,10 +76,14 @@ func (w *Wallet) EvaluateDCQL(query map[string]any) []CredentialMatch {
 				log.Printf("[DCQL]   query=%s: credential %s (%s) skipped: meta mismatch", queryID, typeLabel, cred.Format)
 				continue
 			}
+			if reason := w.vpFormatMismatch(cred, holderBinding, reqObj); reason != "" {
+				log.Printf("[DCQL]   query=%s: credential %s (%s) skipped: %s", queryID, typeLabel, cred.Format, reason)
+				continue
+			}
 
-			selectedKeys := selectClaims(cred, cqMap)
-			if selectedKeys == nil {
-				log.Printf("[DCQL]   query=%s: credential %s (%s) skipped: required claims not found", queryID, typeLabel, cred.Format)
+			selectedPaths := selectClaims(cred, cqMap)
+			if selectedPaths == nil {
+				log.Printf("[DCQL]   query=%s: credential %s (%s) skipped: required claims not found or values not matched", queryID, typeLabel, cred.Format)
 				continue
 			}
 
@@ -73,15 +94,18 @@ func (w *Wallet) EvaluateDCQL(query map[string]any) []CredentialMatch {
 				}
 			}
 
-			log.Printf("[DCQL]   query=%s: credential %s (%s) matched, selected claims: %v", queryID, typeLabel, cred.Format, selectedKeys)
+			log.Printf("[DCQL]   query=%s: credential %s (%s) matched, selected claims: %v", queryID, typeLabel, cred.Format, selectedPaths)
 			matches = append(matches, CredentialMatch{
-				QueryID:      queryID,
-				CredentialID: cred.ID,
-				Format:       cred.Format,
-				VCT:          cred.VCT,
-				DocType:      cred.DocType,
-				Claims:       filterClaims(cred.Claims, selectedKeys),
-				SelectedKeys: selectedKeys,
+				QueryID:              queryID,
+				CredentialID:         cred.ID,
+				Format:               cred.Format,
+				VCT:                  cred.VCT,
+				DocType:              cred.DocType,
+				Claims:               disclosedClaims(cred, selectedPaths),
+				SelectedKeys:         claimKeys(cred, selectedPaths),
+				SelectedPaths:        selectedPaths,
+				RetainedPaths:        retainedPaths(cred, cqMap, selectedPaths),
+				WithoutHolderBinding: !holderBinding,
 			})
 		}
 	}
@@ -107,10 +131,176 @@ func (w *Wallet) EvaluateDCQL(query map[string]any) []CredentialMatch {
 		}
 	}
 
+	matches = limitMatches(matches, multiple)
+
 	log.Printf("[DCQL] Result: %d matches", len(matches))
 	return matches
 }
 
+// ValidateDCQLQuery checks a DCQL query against the rules of OID4VP 1.0
+// Section 6 and returns a finding for each violation.
+func ValidateDCQLQuery(query map[string]any) []string {
+	if query == nil {
+		return nil
+	}
+	credQueries, ok := query["credentials"].([]any)
+	if !ok || len(credQueries) == 0 {
+		return []string{"dcql_query: credentials must be a non-empty array"}
+	}
+
+	var findings []string
+	queryIDs := make(map[string]bool)
+	for i, cq := range credQueries {
+		cqMap, ok := cq.(map[string]any)
+		if !ok {
+			findings = append(findings, fmt.Sprintf("dcql_query: credentials[%d] is not an object", i))
+			continue
+		}
+		label := fmt.Sprintf("dcql_query: credentials[%d]", i)
+		if id, _ := cqMap["id"].(string); id == "" {
+			findings = append(findings, label+": id is required")
+		} else if queryIDs[id] {
+			findings = append(findings, fmt.Sprintf("%s: duplicate id %q", label, id))
+		} else {
+			queryIDs[id] = true
+		}
+		if f, _ := cqMap["format"].(string); f == "" {
+			findings = append(findings, label+": format is required")
+		}
+		for _, name := range []string{"multiple", "require_cryptographic_holder_binding"} {
+			if v, ok := cqMap[name]; ok {
+				if _, isBool := v.(bool); !isBool {
+					findings = append(findings, fmt.Sprintf("%s: %s must be a boolean", label, name))
+				}
+			}
+		}
+		findings = append(findings, validateClaimsQuery(label, cqMap)...)
+	}
+
+	if v, ok := query["credential_sets"]; ok {
+		credSets, _ := v.([]any)
+		if len(credSets) == 0 {
+			findings = append(findings, "dcql_query: credential_sets must be a non-empty array")
+		}
+		for i, cs := range credSets {
+			csMap, _ := cs.(map[string]any)
+			options, _ := csMap["options"].([]any)
+			if len(options) == 0 {
+				findings = append(findings, fmt.Sprintf("dcql_query: credential_sets[%d]: options must be a non-empty array", i))
+			}
+			for _, opt := range options {
+				ids, _ := opt.([]any)
+				for _, id := range ids {
+					if s, _ := id.(string); !queryIDs[s] {
+						findings = append(findings, fmt.Sprintf("dcql_query: credential_sets[%d] references unknown credential query %v", i, id))
+					}
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// validateClaimsQuery checks the claims and claim_sets of a credential query.
+func validateClaimsQuery(label string, cqMap map[string]any) []string {
+	var findings []string
+	claimsVal, hasClaims := cqMap["claims"]
+	claimSetsVal, hasClaimSets := cqMap["claim_sets"]
+	claims, _ := claimsVal.([]any)
+	if hasClaims && len(claims) == 0 {
+		findings = append(findings, label+": claims must be a non-empty array")
+	}
+	if hasClaimSets && !hasClaims {
+		findings = append(findings, label+": claim_sets must not be present without claims")
+	}
+
+	format, _ := cqMap["format"].(string)
+	claimIDs := make(map[string]bool)
+	for j, c := range claims {
+		claim, ok := c.(map[string]any)
+		if !ok {
+			findings = append(findings, fmt.Sprintf("%s: claims[%d] is not an object", label, j))
+			continue
+		}
+		claimLabel := fmt.Sprintf("%s: claims[%d]", label, j)
+		if path, _ := claim["path"].([]any); len(path) == 0 {
+			findings = append(findings, claimLabel+": path must be a non-empty array")
+		}
+		if id, _ := claim["id"].(string); id != "" {
+			if claimIDs[id] {
+				findings = append(findings, fmt.Sprintf("%s: duplicate id %q", claimLabel, id))
+			}
+			claimIDs[id] = true
+		} else if hasClaimSets {
+			findings = append(findings, claimLabel+": id is required when claim_sets is present")
+		}
+		if v, ok := claim["values"]; ok {
+			if values, _ := v.([]any); len(values) == 0 {
+				findings = append(findings, claimLabel+": values must be a non-empty array")
+			}
+		}
+		if v, ok := claim["intent_to_retain"]; ok {
+			if _, isBool := v.(bool); !isBool {
+				findings = append(findings, claimLabel+": intent_to_retain must be a boolean")
+			} else if format != "mso_mdoc" {
+				findings = append(findings, fmt.Sprintf("%s: intent_to_retain is only defined for mso_mdoc, not %s", claimLabel, format))
+			}
+		}
+	}
+
+	if hasClaimSets && hasClaims {
+		claimSets, _ := claimSetsVal.([]any)
+		if len(claimSets) == 0 {
+			findings = append(findings, label+": claim_sets must be a non-empty array")
+		}
+		for _, cs := range claimSets {
+			set, _ := cs.([]any)
+			for _, id := range set {
+				if s, _ := id.(string); !claimIDs[s] {
+					findings = append(findings, fmt.Sprintf("%s: claim_sets references unknown claim id %v", label, id))
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// limitMatches keeps only the first match per credential query, unless the
+// query allows multiple credentials ("multiple": true).
+func limitMatches(matches []CredentialMatch, multiple map[string]bool) []CredentialMatch {
+	var result []CredentialMatch
+	used := make(map[string]bool)
+	for _, m := range matches {
+		if used[m.QueryID] && !multiple[m.QueryID] {
+			continue
+		}
+		result = append(result, m)
+		used[m.QueryID] = true
+	}
+	return result
+}
+
+// retainedPaths returns the selected claims path pointers of an mDoc whose
+// claims query entry sets intent_to_retain.
+func retainedPaths(cred StoredCredential, cqMap map[string]any, selectedPaths [][]any) [][]any {
+	if cred.Format != "mso_mdoc" {
+		return nil
+	}
+	claimsQuery, _ := cqMap["claims"].([]any)
+	var retained [][]any
+	for _, cq := range claimsQuery {
+		claim, _ := cq.(map[string]any)
+		path, _ := claim["path"].([]any)
+		if retain, _ := claim["intent_to_retain"].(bool); !retain {
+			continue
+		}
+		if slices.ContainsFunc(selectedPaths, func(p []any) bool { return claimPathEqual(p, path) }) {
+			retained = append(retained, path)
+		}
+	}
+	return retained
+}
+
 // matchesFormat checks if a credential matches the requested format.
 func matchesFormat(cred StoredCredential, queryFormat string) bool {
 	if queryFormat == "" {
@@ -154,8 +344,9 @@ func matchesMeta(cred StoredCredential, cqMap map[string]any) bool {
 }
 
 // selectClaims determines which claims to disclose based on the query.
-// Returns claim keys to disclose, or nil if the credential can't satisfy the query.
-func selectClaims(cred StoredCredential, cqMap map[string]any) []string {
+// Returns the claims path pointers to disclose, or nil if the credential can't
+// satisfy the query.
+func selectClaims(cred StoredCredential, cqMap map[string]any) [][]any {
 	claimsQuery, ok := cqMap["claims"].([]any)
 	if !ok || len(claimsQuery) == 0 {
 		// No specific claims requested, include all
@@ -163,7 +354,7 @@ func selectClaims(cred StoredCredential, cqMap map[string]any) []string {
 		for k := range cred.Claims {
 			all = append(all, k)
 		}
-		return all
+		return claimPaths(cred, all)
 	}
 
 	// Check claim_sets first (preference ordering)
@@ -177,8 +368,8 @@ func selectClaims(cred StoredCredential, cqMap map[string]any) []string {
 
 // selectFromClaimSets picks the first satisfiable claim_set (preference order).
 // claim_sets entries reference claims by their "id" property (string).
-func selectFromClaimSets(cred StoredCredential, claimsQuery []any, claimSets []any) []string {
-	// Build index: claim id → claim path
+func selectFromClaimSets(cred StoredCredential, claimsQuery []any, claimSets []any) [][]any {
+	// Build index: claim id → claims query entry
 	claimByID := buildClaimByID(claimsQuery)
 
 	for _, cs := range claimSets {
@@ -187,7 +378,7 @@ func selectFromClaimSets(cred StoredCredential, claimsQuery []any, claimSets []a
 			continue
 		}
 
-		var selected []string
+		var selected [][]any
 		satisfiable := true
 
 		for _, ref := range csArr {
@@ -197,18 +388,17 @@ func selectFromClaimSets(cred StoredCredential, claimsQuery []any, claimSets []a
 				break
 			}
 
-			path := claimByID[id]
-			if path == nil {
+			claim := claimByID[id]
+			if claim == nil {
 				satisfiable = false
 				break
 			}
 
-			key := claimKeyFromPath(cred, path)
-			if key == "" {
+			if !matchClaim(cred, claim) {
 				satisfiable = false
 				break
 			}
-			selected = append(selected, key)
+			selected = append(selected, claim["path"].([]any))
 		}
 
 		if satisfiable && len(selected) > 0 {
@@ -219,9 +409,9 @@ func selectFromClaimSets(cred StoredCredential, claimsQuery []any, claimSets []a
 	return nil
 }
 
-// buildClaimByID builds a map of claim id → path from claims query entries.
-func buildClaimByID(claimsQuery []any) map[string][]any {
-	byID := make(map[string][]any)
+// buildClaimByID builds a map of claim id → claims query entry.
+func buildClaimByID(claimsQuery []any) map[string]map[string]any {
+	byID := make(map[string]map[string]any)
 	for _, cq := range claimsQuery {
 		cqMap, ok := cq.(map[string]any)
 		if !ok {
@@ -231,11 +421,10 @@ func buildClaimByID(claimsQuery []any) map[string][]any {
 		if id == "" {
 			continue
 		}
-		path, ok := cqMap["path"].([]any)
-		if !ok {
+		if _, ok := cqMap["path"].([]any); !ok {
 			continue
 		}
-		byID[id] = path
+		byID[id] = cqMap
 	}
 	return byID
 }
@@ -244,8 +433,8 @@ func buildClaimByID(claimsQuery []any) map[string][]any {
 // Per DCQL (OID4VP 1.0 Section 6), claims without claim_sets are required by default
 // unless the individual claim entry has "required": false.
 // Returns nil if any required claim is missing.
-func selectAllRequestedClaims(cred StoredCredential, claimsQuery []any) []string {
-	var selected []string
+func selectAllRequestedClaims(cred StoredCredential, claimsQuery []any) [][]any {
+	var selected [][]any
 	for _, cq := range claimsQuery {
 		cqMap, ok := cq.(map[string]any)
 		if !ok {
@@ -262,9 +451,8 @@ func selectAllRequestedClaims(cred StoredCredential, claimsQuery []any) []string
 			required = r
 		}
 
-		key := claimKeyFromPath(cred, path)
-		if key != "" {
-			selected = append(selected, key)
+		if matchClaim(cred, cqMap) {
+			selected = append(selected, path)
 		} else if required {
 			return nil
 		}
@@ -275,6 +463,66 @@ func selectAllRequestedClaims(cred StoredCredential, claimsQuery []any) []string
 	return selected
 }
 
+// matchClaim reports whether a claims query entry matches the credential:
+// its path must select at least one value and, with "values", one of the
+// selected values must match one of the expected values in type and value
+// (OID4VP 1.0 Section 6.3).
+func matchClaim(cred StoredCredential, claim map[string]any) bool {
+	path, _ := claim["path"].([]any)
+	key, selected := resolveClaimPath(cred, path)
+	if key == "" {
+		return false
+	}
+	expected, ok := claim["values"].([]any)
+	if !ok {
+		return true
+	}
+	for _, v := range selected {
+		for _, e := range expected {
+			if claimValueMatches(v, e) {
+				return true
+			}
+		}
+	}
+	log.Printf("[DCQL]   claim %v: values %v not matched by %v", path, expected, selected)
+	return false
+}
+
+// claimValueMatches reports whether a claim value equals an expected DCQL
+// value. Strings and booleans match exactly; integers match integers of any
+// numeric type, since mDoc claims decode as int64 and JSON claims as float64.
+func claimValueMatches(v, expected any) bool {
+	switch e := expected.(type) {
+	case string:
+		s, ok := v.(string)
+		return ok && s == e
+	case bool:
+		b, ok := v.(bool)
+		return ok && b == e
+	case float64:
+		n, ok := integerValue(v)
+		return ok && e == math.Trunc(e) && n == e
+	default:
+		return false
+	}
+}
+
+// integerValue returns v as float64 if it is an integer.
+func integerValue(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, n == math.Trunc(n) && !math.IsInf(n, 0)
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
+
 // claimKeyFromPath resolves a DCQL claim path to a credential claim key.
 // For SD-JWT: path is like ["given_name"] → key "given_name"
 //
@@ -284,69 +532,109 @@ func selectAllRequestedClaims(cred StoredCredential, claimsQuery []any) []string
 //
 // For mDoc: path is like ["eu.europa.ec.eudi.pid.1", "given_name"] → key "eu.europa.ec.eudi.pid.1:given_name"
 func claimKeyFromPath(cred StoredCredential, path []any) string {
+	key, _ := resolveClaimPath(cred, path)
+	return key
+}
+
+// resolveClaimPath processes a claims path pointer (OID4VP 1.0 Section 7)
+// and returns the top-level claim key and the values the path selects. For
+// mDocs, the first two elements name the namespace and data element; further
+// elements descend into the element value. Returns "" if nothing is selected.
+func resolveClaimPath(cred StoredCredential, path []any) (string, []any) {
 	if len(path) == 0 {
-		return ""
+		return "", nil
 	}
 
-	if cred.Format == "mso_mdoc" && len(path) >= 2 {
+	var key string
+	var rest []any
+	if cred.Format == "mso_mdoc" {
+		if len(path) < 2 {
+			return "", nil
+		}
 		ns, ok1 := path[0].(string)
 		elem, ok2 := path[1].(string)
-		if ok1 && ok2 {
-			key := ns + ":" + elem
-			if _, exists := cred.Claims[key]; exists {
-				return key
-			}
+		if !ok1 || !ok2 {
+			return "", nil
 		}
-		return ""
+		key, rest = ns+":"+elem, path[2:]
+	} else {
+		k, ok := path[0].(string)
+		if !ok {
+			return "", nil
+		}
+		key, rest = k, path[1:]
 	}
 
-	// SD-JWT
-	key, ok := path[0].(string)
-	if !ok {
-		return ""
-	}
 	val, exists := cred.Claims[key]
 	if !exists {
-		return ""
+		return "", nil
 	}
-
-	// Single-segment path: just check existence
-	if len(path) == 1 {
-		return key
+	selected := []any{val}
+	for _, elem := range rest {
+		selected = selectPathElement(selected, elem)
+		if len(selected) == 0 {
+			return "", nil
+		}
 	}
+	return key, selected
+}
 
-	// Multi-segment: validate nested structure
-	switch second := path[1].(type) {
-	case string:
-		// Nested object path like ["address", "street_address"]
-		obj, ok := val.(map[string]any)
-		if !ok {
-			return ""
-		}
-		if _, exists := obj[second]; !exists {
-			return ""
-		}
-		return key
-	case float64:
-		// Array index like ["nationalities", 0]
-		arr, ok := val.([]any)
-		if !ok {
-			return ""
+// selectPathElement applies one claims path element to the selected values:
+// a string selects an object member, a non-negative integer an array
+// element, and null all elements of an array.
+func selectPathElement(selected []any, elem any) []any {
+	var next []any
+	for _, v := range selected {
+		switch e := elem.(type) {
+		case string:
+			if obj, ok := v.(map[string]any); ok {
+				if child, exists := obj[e]; exists {
+					next = append(next, child)
+				}
+			}
+		case float64:
+			arr, ok := v.([]any)
+			if idx := int(e); ok && e == math.Trunc(e) && idx >= 0 && idx < len(arr) {
+				next = append(next, arr[idx])
+			}
+		case nil:
+			if arr, ok := v.([]any); ok {
+				next = append(next, arr...)
+			}
 		}
-		idx := int(second)
-		if idx < 0 || idx >= len(arr) {
-			return ""
+	}
+	return next
+}
+
+// claimKeys returns the top-level claim keys of claims path pointers in
+// order, without duplicates.
+func claimKeys(cred StoredCredential, paths [][]any) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		key := claimKeyFromPath(cred, path)
+		if key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
 		}
-		return key
-	case nil:
-		// Array wildcard like ["nationalities", null]
-		if _, ok := val.([]any); !ok {
-			return ""
+	}
+	return keys
+}
+
+// claimPaths returns a claims path pointer for each top-level claim key,
+// splitting mDoc keys into namespace and data element.
+func claimPaths(cred StoredCredential, keys []string) [][]any {
+	paths := make([][]any, 0, len(keys))
+	for _, key := range keys {
+		if cred.Format == "mso_mdoc" {
+			if i := strings.LastIndex(key, ":"); i >= 0 {
+				paths = append(paths, []any{key[:i], key[i+1:]})
+			}
+			continue
 		}
-		return key
-	default:
-		return ""
+		paths = append(paths, []any{key})
 	}
+	return paths
 }
 
 // filterClaims returns only the claims with the given keys.
@@ -449,13 +737,11 @@ func applyCredentialSets(matches []CredentialMatch, credSets []any, preferredFor
 		return matches
 	}
 
-	// Filter to only needed matches (first match per query ID)
+	// Filter to only needed matches
 	var result []CredentialMatch
-	used := make(map[string]bool)
 	for _, m := range matches {
-		if needed[m.QueryID] && !used[m.QueryID] {
+		if needed[m.QueryID] {
 			result = append(result, m)
-			used[m.QueryID] = true
 		}
 	}
 	return result
@@ -18,6 +18,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
@@ -500,6 +503,379 @@ func TestEvaluateDCQL_OptionalClaimMissing_Accepted(t *testing.T) {
 	}
 }
 
+func TestEvaluateDCQL_Values(t *testing.T) {
+	w := generateTestWalletWithPID(t)
+	vcJWT, err := signJWT(map[string]any{"alg": "ES256", "typ": "JWT"}, map[string]any{
+		"iss": "https://issuer.example",
+		"vc": map[string]any{
+			"type":              []any{"VerifiableCredential", "UniversityDegree"},
+			"credentialSubject": map[string]any{"degree": map[string]any{"type": "BachelorDegree"}},
+		},
+	}, w.IssuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.ImportCredential(vcJWT); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		format string
+		path   []any
+		values []any
+		match  bool
+	}{
+		{"string", "dc+sd-jwt", []any{"birth_country"}, []any{"AT", "DE"}, true},
+		{"string mismatch", "dc+sd-jwt", []any{"birth_country"}, []any{"AT"}, false},
+		{"boolean", "dc+sd-jwt", []any{"age_over_18"}, []any{true}, true},
+		{"boolean mismatch", "dc+sd-jwt", []any{"age_over_18"}, []any{false}, false},
+		{"boolean as string", "dc+sd-jwt", []any{"age_over_18"}, []any{"true"}, false},
+		{"integer", "dc+sd-jwt", []any{"age_in_years"}, []any{float64(41)}, true},
+		{"integer mismatch", "dc+sd-jwt", []any{"age_in_years"}, []any{float64(42)}, false},
+		{"integer as string", "dc+sd-jwt", []any{"age_in_years"}, []any{"41"}, false},
+		{"nested", "dc+sd-jwt", []any{"address", "country"}, []any{"DE"}, true},
+		{"nested mismatch", "dc+sd-jwt", []any{"address", "country"}, []any{"FR"}, false},
+		{"array wildcard", "dc+sd-jwt", []any{"nationalities", nil}, []any{"FR", "DE"}, true},
+		{"array wildcard mismatch", "dc+sd-jwt", []any{"nationalities", nil}, []any{"FR"}, false},
+		{"array index", "dc+sd-jwt", []any{"nationalities", float64(0)}, []any{"DE"}, true},
+		{"mdoc string", "mso_mdoc", []any{"eu.europa.ec.eudi.pid.1", "nationality"}, []any{"DE"}, true},
+		{"mdoc string mismatch", "mso_mdoc", []any{"eu.europa.ec.eudi.pid.1", "nationality"}, []any{"FR"}, false},
+		{"mdoc integer", "mso_mdoc", []any{"eu.europa.ec.eudi.pid.1", "age_in_years"}, []any{float64(41)}, true},
+		{"mdoc boolean", "mso_mdoc", []any{"eu.europa.ec.eudi.pid.1", "age_over_18"}, []any{true}, true},
+		{"jwt vc nested", "jwt_vc_json", []any{"vc", "credentialSubject", "degree", "type"}, []any{"BachelorDegree"}, true},
+		{"jwt vc array wildcard", "jwt_vc_json", []any{"vc", "type", nil}, []any{"UniversityDegree"}, true},
+		{"jwt vc mismatch", "jwt_vc_json", []any{"vc", "credentialSubject", "degree", "type"}, []any{"MasterDegree"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := map[string]any{
+				"credentials": []any{
+					map[string]any{
+						"id":     "q",
+						"format": tt.format,
+						"claims": []any{
+							map[string]any{"path": tt.path, "values": tt.values},
+						},
+					},
+				},
+			}
+			matches := w.EvaluateDCQL(query)
+			if got := len(matches) == 1; got != tt.match {
+				t.Errorf("matched = %v (%d matches), want %v", got, len(matches), tt.match)
+			}
+		})
+	}
+}
+
+func TestEvaluateDCQL_Values_ClaimSets(t *testing.T) {
+	w := generateTestWalletWithPID(t)
+
+	query := map[string]any{
+		"credentials": []any{
+			map[string]any{
+				"id":     "pid",
+				"format": "dc+sd-jwt",
+				"claims": []any{
+					map[string]any{"id": "fr", "path": []any{"nationalities", nil}, "values": []any{"FR"}},
+					map[string]any{"id": "adult", "path": []any{"age_over_18"}, "values": []any{true}},
+					map[string]any{"id": "name", "path": []any{"given_name"}},
+				},
+				"claim_sets": []any{
+					[]any{"fr", "name"},
+					[]any{"adult"},
+				},
+			},
+		},
+	}
+
+	matches := w.EvaluateDCQL(query)
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %d", len(matches))
+	}
+	if keys := matches[0].SelectedKeys; len(keys) != 1 || keys[0] != "age_over_18" {
+		t.Errorf("expected the second claim set, got %v", keys)
+	}
+}
+
+func TestEvaluateDCQL_Values_CredentialSets(t *testing.T) {
+	w := generateTestWalletWithPID(t)
+
+	query := map[string]any{
+		"credentials": []any{
+			map[string]any{
+				"id":     "pid_sdjwt",
+				"format": "dc+sd-jwt",
+				"claims": []any{
+					map[string]any{"path": []any{"age_in_years"}, "values": []any{float64(17)}},
+				},
+			},
+			map[string]any{
+				"id":     "pid_mdoc",
+				"format": "mso_mdoc",
+				"claims": []any{
+					map[string]any{"path": []any{"eu.europa.ec.eudi.pid.1", "age_in_years"}, "values": []any{float64(41)}},
+				},
+			},
+		},
+		"credential_sets": []any{
+			map[string]any{
+				"options": []any{
+					[]any{"pid_sdjwt"},
+					[]any{"pid_mdoc"},
+				},
+			},
+		},
+	}
+
+	matches := w.EvaluateDCQL(query)
+	if len(matches) != 1 || matches[0].QueryID != "pid_mdoc" {
+		t.Fatalf("expected only the mdoc option to be satisfiable, got %+v", matches)
+	}
+}
+
+func TestEvaluateDCQL_NestedPaths(t *testing.T) {
+	w := generateTestWalletWithPID(t)
+
+	query := map[string]any{
+		"credentials": []any{
+			map[string]any{
+				"id":     "pid",
+				"format": "dc+sd-jwt",
+				"claims": []any{
+					map[string]any{"path": []any{"address", "locality"}},
+					map[string]any{"path": []any{"nationalities", nil}},
+					map[string]any{"path": []any{"address", "postal_code"}},
+				},
+			},
+			map[string]any{
+				"id":     "pid_mdoc",
+				"format": "mso_mdoc",
+				"claims": []any{
+					map[string]any{"path": []any{"eu.europa.ec.eudi.pid.1", "nationality"}},
+				},
+			},
+		},
+	}
+
+	matches := w.EvaluateDCQL(query)
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(matches))
+	}
+
+	sd := matches[0]
+	if len(sd.SelectedPaths) != 3 {
+		t.Errorf("expected the 3 requested paths, got %v", sd.SelectedPaths)
+	}
+	if fmt.Sprint(sd.SelectedKeys) != "[address nationalities]" {
+		t.Errorf("SelectedKeys = %v, want [address nationalities]", sd.SelectedKeys)
+	}
+	wantClaims := map[string]any{
+		"address":       map[string]any{"locality": "KÖLN", "postal_code": "51147"},
+		"nationalities": []any{"DE"},
+	}
+	if !reflect.DeepEqual(sd.Claims, wantClaims) {
+		t.Errorf("Claims = %v, want %v", sd.Claims, wantClaims)
+	}
+
+	mdocMatch := matches[1]
+	if fmt.Sprint(mdocMatch.SelectedKeys) != "[eu.europa.ec.eudi.pid.1:nationality]" || len(mdocMatch.Claims) != 1 {
+		t.Errorf("unexpected mDoc selection: keys=%v claims=%v", mdocMatch.SelectedKeys, mdocMatch.Claims)
+	}
+}
+
+func TestEvaluateDCQL_NoClaims_SelectsAllPaths(t *testing.T) {
+	w := generateTestWalletWithPID(t)
+
+	matches := w.EvaluateDCQL(map[string]any{
+		"credentials": []any{
+			map[string]any{"id": "pid_mdoc", "format": "mso_mdoc"},
+		},
+	})
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %d", len(matches))
+	}
+	m := matches[0]
+	if len(m.SelectedPaths) != len(m.SelectedKeys) {
+		t.Fatalf("expected one path per key, got %d paths for %d keys", len(m.SelectedPaths), len(m.SelectedKeys))
+	}
+	for _, path := range m.SelectedPaths {
+		if len(path) != 2 || path[0] != "eu.europa.ec.eudi.pid.1" {
+			t.Errorf("expected [namespace, element] path, got %v", path)
+		}
+	}
+}
+
+func TestEvaluateDCQL_Multiple(t *testing.T) {
+	w := generateTestWallet(t)
+	for range 2 {
+		if _, err := w.ImportCredential(generateTestCredential(t, w)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, multiple := range []bool{false, true} {
+		t.Run(fmt.Sprint(multiple), func(t *testing.T) {
+			matches := w.EvaluateDCQL(map[string]any{
+				"credentials": []any{
+					map[string]any{
+						"id":       "cred",
+						"format":   "dc+sd-jwt",
+						"multiple": multiple,
+						"meta":     map[string]any{"vct_values": []any{"TestIssuedCred"}},
+						"claims":   []any{map[string]any{"path": []any{"given_name"}}},
+					},
+				},
+			})
+			want := 1
+			if multiple {
+				want = 2
+			}
+			if len(matches) != want {
+				t.Fatalf("expected %d matches, got %d", want, len(matches))
+			}
+			if multiple && matches[0].CredentialID == matches[1].CredentialID {
+				t.Error("expected two different credentials")
+			}
+		})
+	}
+}
+
+func TestEvaluateDCQL_HolderBindingAndIntentToRetain(t *testing.T) {
+	w := generateTestWalletWithPID(t)
+
+	matches := w.EvaluateDCQL(map[string]any{
+		"credentials": []any{
+			map[string]any{
+				"id":                                   "pid",
+				"format":                               "dc+sd-jwt",
+				"require_cryptographic_holder_binding": false,
+				"claims":                               []any{map[string]any{"path": []any{"given_name"}}},
+			},
+			map[string]any{
+				"id":     "pid_mdoc",
+				"format": "mso_mdoc",
+				"claims": []any{
+					map[string]any{"path": []any{"eu.europa.ec.eudi.pid.1", "given_name"}, "intent_to_retain": true},
+					map[string]any{"path": []any{"eu.europa.ec.eudi.pid.1", "family_name"}, "intent_to_retain": false},
+				},
+			},
+		},
+	})
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(matches))
+	}
+	if !matches[0].WithoutHolderBinding {
+		t.Error("expected the SD-JWT match to be presented without holder binding")
+	}
+	if matches[1].WithoutHolderBinding {
+		t.Error("holder binding is required by default")
+	}
+	if retained := matches[1].RetainedPaths; len(retained) != 1 || retained[0][1] != "given_name" {
+		t.Errorf("RetainedPaths = %v, want only given_name", retained)
+	}
+}
+
+func TestValidateDCQLQuery(t *testing.T) {
+	claim := func(id string) map[string]any {
+		return map[string]any{"id": id, "path": []any{id}}
+	}
+	tests := []struct {
+		name  string
+		query map[string]any
+		want  string // substring of the single finding, "" for none
+	}{
+		{"valid", map[string]any{"credentials": []any{
+			map[string]any{"id": "pid", "format": "dc+sd-jwt", "multiple": true, "require_cryptographic_holder_binding": false,
+				"claims": []any{claim("a"), claim("b")}, "claim_sets": []any{[]any{"a"}, []any{"b"}}},
+		}}, ""},
+		{"no credentials", map[string]any{}, "credentials must be a non-empty array"},
+		{"duplicate id", map[string]any{"credentials": []any{
+			map[string]any{"id": "pid", "format": "dc+sd-jwt"},
+			map[string]any{"id": "pid", "format": "mso_mdoc"},
+		}}, `duplicate id "pid"`},
+		{"multiple not boolean", map[string]any{"credentials": []any{
+			map[string]any{"id": "pid", "format": "dc+sd-jwt", "multiple": "yes"},
+		}}, "multiple must be a boolean"},
+		{"holder binding not boolean", map[string]any{"credentials": []any{
+			map[string]any{"id": "pid", "format": "dc+sd-jwt", "require_cryptographic_holder_binding": "false"},
+		}}, "require_cryptographic_holder_binding must be a boolean"},
+		{"claim_sets without claims", map[string]any{"credentials": []any{
+			map[string]any{"id": "pid", "format": "dc+sd-jwt", "claim_sets": []any{[]any{"a"}}},
+		}}, "claim_sets must not be present without claims"},
+		{"claim without id in claim_sets query", map[string]any{"credentials": []any{
+			map[string]any{"id": "pid", "format": "dc+sd-jwt",
+				"claims":     []any{claim("a"), map[string]any{"path": []any{"b"}}},
+				"claim_sets": []any{[]any{"a"}}},
+		}}, "id is required when claim_sets is present"},
+		{"unknown claim id", map[string]any{"credentials": []any{
+			map[string]any{"id": "pid", "format": "dc+sd-jwt", "claims": []any{claim("a")}, "claim_sets": []any{[]any{"x"}}},
+		}}, "unknown claim id x"},
+		{"intent_to_retain on SD-JWT", map[string]any{"credentials": []any{
+			map[string]any{"id": "pid", "format": "dc+sd-jwt",
+				"claims": []any{map[string]any{"path": []any{"a"}, "intent_to_retain": true}}},
+		}}, "only defined for mso_mdoc"},
+		{"unknown credential query in credential_sets", map[string]any{
+			"credentials":     []any{map[string]any{"id": "pid", "format": "dc+sd-jwt"}},
+			"credential_sets": []any{map[string]any{"options": []any{[]any{"mdl"}}}},
+		}, "unknown credential query mdl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := ValidateDCQLQuery(tt.query)
+			if tt.want == "" {
+				if len(findings) != 0 {
+					t.Errorf("expected no findings, got %v", findings)
+				}
+				return
+			}
+			if len(findings) != 1 || !strings.Contains(findings[0], tt.want) {
+				t.Errorf("expected one finding containing %q, got %v", tt.want, findings)
+			}
+		})
+	}
+}
+
+func TestValidatePresentationRequest_StrictRejectsInvalidDCQL(t *testing.T) {
+	query := map[string]any{"credentials": []any{
+		map[string]any{"id": "pid", "format": "dc+sd-jwt", "multiple": 1},
+	}}
+	_, err := ValidatePresentationRequest(ValidationModeStrict, "redirect_uri:https://verifier.example/cb", nil, "https://verifier.example/cb", query, nil, nil, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "multiple must be a boolean") {
+		t.Errorf("expected strict mode to reject the query, got %v", err)
+	}
+	findings, err := ValidatePresentationRequest(ValidationModeDebug, "redirect_uri:https://verifier.example/cb", nil, "https://verifier.example/cb", query, nil, nil, nil, nil)
+	if err != nil || !slices.ContainsFunc(findings, func(f string) bool { return strings.Contains(f, "multiple") }) {
+		t.Errorf("expected a debug warning, got %v, %v", findings, err)
+	}
+}
+
+func TestClaimValueMatches(t *testing.T) {
+	tests := []struct {
+		v, expected any
+		want        bool
+	}{
+		{"DE", "DE", true},
+		{"DE", "de", false},
+		{true, true, true},
+		{true, false, false},
+		{float64(41), float64(41), true},
+		{int64(41), float64(41), true},
+		{uint64(41), float64(41), true},
+		{41, float64(41), true},
+		{41.5, float64(41), false},
+		{float64(41), 41.5, false},
+		{"41", float64(41), false},
+		{nil, nil, false},
+		{map[string]any{}, "DE", false},
+	}
+	for _, tt := range tests {
+		if got := claimValueMatches(tt.v, tt.expected); got != tt.want {
+			t.Errorf("claimValueMatches(%#v, %#v) = %v, want %v", tt.v, tt.expected, got, tt.want)
+		}
+	}
+}
+
 func TestMatchesFormat(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -596,39 +972,6 @@ func TestClaimKeyFromPath(t *testing.T) {
 	}
 }
 
-func TestCollectArrayDigests(t *testing.T) {
-	digests := make(map[string]bool)
-
-	// Array with digest references
-	collectArrayDigests([]any{
-		map[string]any{"...": "digest1"},
-		map[string]any{"...": "digest2"},
-		"plain",
-		map[string]any{"other": "value"},
-	}, digests)
-
-	if !digests["digest1"] || !digests["digest2"] {
-		t.Errorf("expected digest1 and digest2, got %v", digests)
-	}
-	if len(digests) != 2 {
-		t.Errorf("expected 2 digests, got %d", len(digests))
-	}
-
-	// Non-array value: no-op
-	digests2 := make(map[string]bool)
-	collectArrayDigests("not-an-array", digests2)
-	if len(digests2) != 0 {
-		t.Errorf("expected no digests for non-array, got %d", len(digests2))
-	}
-
-	// Empty array
-	digests3 := make(map[string]bool)
-	collectArrayDigests([]any{}, digests3)
-	if len(digests3) != 0 {
-		t.Errorf("expected no digests for empty array, got %d", len(digests3))
-	}
-}
-
 // serveTrustList creates an httptest.Server serving the given trust list JWT.
 func serveTrustList(t *testing.T, tlJWT string) *httptest.Server {
 	t.Helper()
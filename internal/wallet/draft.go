@@ -0,0 +1,196 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/jsonutil"
+	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
+)
+
+// OID4VP drafts the draft compatibility mode (--draft) supports.
+const (
+	MinDraft = 20
+	MaxDraft = 24
+)
+
+// legacyClientIDSchemes maps the client_id_scheme values of drafts before 22
+// to the client identifier prefixes of OID4VP 1.0.
+var legacyClientIDSchemes = map[string]string{
+	"pre-registered":       "",
+	"redirect_uri":         "redirect_uri:",
+	"x509_san_dns":         "x509_san_dns:",
+	"did":                  "decentralized_identifier:",
+	"verifier_attestation": "verifier_attestation:",
+	"entity_id":            "openid_federation:",
+}
+
+// ResolveDraftRequest prepares a request of an OID4VP draft for the draft
+// compatibility mode. It fetches presentation_definition_uri, as well as the
+// client_metadata_uri and jwks_uri of request objects. The legacy
+// authorization_encrypted_response_alg/enc and vp_formats metadata are mapped
+// to their 1.0 form. It returns the client_id with its OID4VP 1.0 prefix for
+// client identifier validation, and findings about the draft parameters. In
+// strict mode, findings are an error.
+func (w *Wallet) ResolveDraftRequest(clientID string, legacy *oid4vc.LegacyParams, reqObj *oid4vc.RequestObjectJWT) (string, []string, error) {
+	if legacy.PresentationDefinition == nil && legacy.PresentationDefinitionURI != "" {
+		pd, err := fetchJSONObject(legacy.PresentationDefinitionURI)
+		if err != nil {
+			return "", nil, fmt.Errorf("fetching presentation_definition_uri: %w", err)
+		}
+		legacy.PresentationDefinition = pd
+	}
+
+	if reqObj != nil && reqObj.Payload != nil {
+		meta := jsonutil.GetMap(reqObj.Payload, "client_metadata")
+		if meta == nil && legacy.ClientMetadataURI != "" {
+			fetched, err := fetchJSONObject(legacy.ClientMetadataURI)
+			if err != nil {
+				return "", nil, fmt.Errorf("fetching client_metadata_uri: %w", err)
+			}
+			meta = fetched
+			reqObj.Payload["client_metadata"] = meta
+		}
+		if jwksURI := jsonutil.GetString(meta, "jwks_uri"); jwksURI != "" && meta["jwks"] == nil {
+			jwks, err := fetchJSONObject(jwksURI)
+			if err != nil {
+				return "", nil, fmt.Errorf("fetching client_metadata.jwks_uri: %w", err)
+			}
+			meta["jwks"] = jwks
+		}
+		applyLegacyEncryptionMetadata(meta)
+		applyLegacyVPFormats(meta)
+	}
+
+	var findings []string
+	validationID, finding := draftClientID(w.Draft, clientID, legacy.ClientIDScheme)
+	if finding != "" {
+		findings = append(findings, finding)
+	}
+	if w.ValidationMode == ValidationModeStrict && len(findings) > 0 {
+		return "", nil, fmt.Errorf("draft %d request validation failed: %s", w.Draft, strings.Join(findings, "; "))
+	}
+	return validationID, findings, nil
+}
+
+// DraftPresentationDefinition returns the Presentation Exchange definition a
+// request without a DCQL query is evaluated against in draft compatibility
+// mode, or nil.
+func (w *Wallet) DraftPresentationDefinition(dcqlQuery map[string]any, legacy oid4vc.LegacyParams) map[string]any {
+	if w.Draft == 0 || dcqlQuery != nil {
+		return nil
+	}
+	return legacy.PresentationDefinition
+}
+
+// draftClientID returns the OID4VP 1.0 form of a draft client_id. Before
+// draft 22, the scheme is a separate client_id_scheme parameter; from draft
+// 22 on, it is a prefix of the client_id, and DIDs are used without one.
+func draftClientID(draft int, clientID, scheme string) (string, string) {
+	if draft < 22 {
+		if scheme == "" {
+			return clientID, ""
+		}
+		prefix, ok := legacyClientIDSchemes[scheme]
+		if !ok {
+			return clientID, fmt.Sprintf("client_id_scheme %q is not supported, the client_id is not verified", scheme)
+		}
+		return prefix + clientID, ""
+	}
+
+	var finding string
+	if scheme != "" {
+		finding = fmt.Sprintf("client_id_scheme was removed in draft 22 (the scheme is a client_id prefix), ignoring %q", scheme)
+	}
+	if strings.HasPrefix(clientID, "did:") {
+		return "decentralized_identifier:" + clientID, finding
+	}
+	return clientID, finding
+}
+
+// applyLegacyEncryptionMetadata maps the response encryption metadata of the
+// drafts to OID4VP 1.0: authorization_encrypted_response_enc becomes
+// encrypted_response_enc_values_supported, and authorization_encrypted_response_alg
+// the alg of JWKs without one.
+func applyLegacyEncryptionMetadata(meta map[string]any) {
+	if meta == nil {
+		return
+	}
+	if enc := jsonutil.GetString(meta, "authorization_encrypted_response_enc"); enc != "" && meta["encrypted_response_enc_values_supported"] == nil {
+		meta["encrypted_response_enc_values_supported"] = []any{enc}
+	}
+	alg := jsonutil.GetString(meta, "authorization_encrypted_response_alg")
+	if alg == "" {
+		return
+	}
+	for _, k := range jsonutil.GetArray(jsonutil.GetMap(meta, "jwks"), "keys") {
+		if jwk, ok := k.(map[string]any); ok && jwk["alg"] == nil {
+			jwk["alg"] = alg
+		}
+	}
+}
+
+// applyLegacyVPFormats maps the vp_formats metadata of the drafts to the
+// vp_formats_supported of OID4VP 1.0, with the wallet's format identifiers
+// and the alg of JWT VCs as alg_values.
+func applyLegacyVPFormats(meta map[string]any) {
+	legacy := jsonutil.GetMap(meta, "vp_formats")
+	if legacy == nil || meta["vp_formats_supported"] != nil {
+		return
+	}
+	formats := make(map[string]any, len(legacy))
+	for designation, v := range legacy {
+		f, ok := presentationExchangeFormats[designation]
+		params, isMap := v.(map[string]any)
+		if !ok || !isMap {
+			continue
+		}
+		if f == "jwt_vc_json" && params["alg"] != nil && params["alg_values"] == nil {
+			params["alg_values"] = params["alg"]
+		}
+		formats[f] = params
+	}
+	meta["vp_formats_supported"] = formats
+}
+
+// fetchJSONObject GETs a URL and decodes the JSON object it returns.
+func fetchJSONObject(uri string) (map[string]any, error) {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", uri, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("fetching %s failed (%d): %s", uri, resp.StatusCode, string(body))
+	}
+
+	var obj map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", uri, err)
+	}
+	return obj, nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
+)
+
+func TestDraftClientID(t *testing.T) {
+	tests := []struct {
+		name     string
+		draft    int
+		clientID string
+		scheme   string
+		want     string
+		finding  string
+	}{
+		{"draft 20 redirect_uri", 20, "https://rp.example/cb", "redirect_uri", "redirect_uri:https://rp.example/cb", ""},
+		{"draft 21 x509_san_dns", 21, "rp.example", "x509_san_dns", "x509_san_dns:rp.example", ""},
+		{"draft 20 did", 20, "did:web:rp.example", "did", "decentralized_identifier:did:web:rp.example", ""},
+		{"draft 20 entity_id", 20, "https://rp.example", "entity_id", "openid_federation:https://rp.example", ""},
+		{"draft 20 pre-registered", 20, "rp", "pre-registered", "rp", ""},
+		{"draft 20 no scheme", 20, "rp", "", "rp", ""},
+		{"draft 20 unknown scheme", 20, "rp", "custom", "rp", "not supported"},
+		{"draft 22 prefix", 22, "x509_san_dns:rp.example", "", "x509_san_dns:rp.example", ""},
+		{"draft 23 did", 23, "did:jwk:abc", "", "decentralized_identifier:did:jwk:abc", ""},
+		{"draft 24 scheme parameter", 24, "redirect_uri:https://rp.example", "redirect_uri", "redirect_uri:https://rp.example", "removed in draft 22"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, finding := draftClientID(tt.draft, tt.clientID, tt.scheme)
+			if got != tt.want {
+				t.Errorf("client_id = %q, want %q", got, tt.want)
+			}
+			if (tt.finding == "") != (finding == "") || !strings.Contains(finding, tt.finding) {
+				t.Errorf("finding = %q, want one containing %q", finding, tt.finding)
+			}
+		})
+	}
+}
+
+func TestResolveDraftRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/pd":
+			w.Write([]byte(`{"id":"pd","input_descriptors":[{"id":"pid"}]}`))
+		case "/metadata":
+			w.Write([]byte(`{"authorization_encrypted_response_alg":"ECDH-ES","authorization_encrypted_response_enc":"A256GCM","vp_formats":{"vc+sd-jwt":{"sd-jwt_alg_values":["ES256"]},"jwt_vc":{"alg":["ES256"]}},"jwks_uri":"` + "http://" + r.Host + `/jwks"}`))
+		case "/jwks":
+			w.Write([]byte(`{"keys":[{"kty":"EC","crv":"P-256","x":"x","y":"y","use":"enc"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	w := generateTestWallet(t)
+	w.Draft = 20
+	legacy := &oid4vc.LegacyParams{
+		PresentationDefinitionURI: srv.URL + "/pd",
+		ClientIDScheme:            "redirect_uri",
+		ClientMetadataURI:         srv.URL + "/metadata",
+	}
+	reqObj := &oid4vc.RequestObjectJWT{Payload: map[string]any{}}
+
+	clientID, findings, err := w.ResolveDraftRequest("https://rp.example/cb", legacy, reqObj)
+	if err != nil {
+		t.Fatalf("ResolveDraftRequest: %v", err)
+	}
+	if clientID != "redirect_uri:https://rp.example/cb" || len(findings) != 0 {
+		t.Errorf("got client_id %q, findings %v", clientID, findings)
+	}
+	if legacy.PresentationDefinition["id"] != "pd" {
+		t.Errorf("presentation_definition_uri not resolved: %v", legacy.PresentationDefinition)
+	}
+
+	meta, _ := reqObj.Payload["client_metadata"].(map[string]any)
+	if !reflect.DeepEqual(meta["encrypted_response_enc_values_supported"], []any{"A256GCM"}) {
+		t.Errorf("enc not mapped: %v", meta["encrypted_response_enc_values_supported"])
+	}
+	wantFormats := map[string]any{
+		"dc+sd-jwt":   map[string]any{"sd-jwt_alg_values": []any{"ES256"}},
+		"jwt_vc_json": map[string]any{"alg": []any{"ES256"}, "alg_values": []any{"ES256"}},
+	}
+	if formats := VPFormatsSupported(reqObj); !reflect.DeepEqual(formats, wantFormats) {
+		t.Errorf("vp_formats mapped to %v, want %v", formats, wantFormats)
+	}
+	jwk := findEncryptionJWK(reqObj)
+	if jwk == nil {
+		t.Fatal("expected the jwks_uri key in client_metadata.jwks")
+	}
+	if jwk["alg"] != "ECDH-ES" {
+		t.Errorf("alg not mapped to the JWK: %v", jwk)
+	}
+}
+
+func TestResolveDraftRequest_Strict(t *testing.T) {
+	w := generateTestWallet(t)
+	w.Draft = 23
+	w.ValidationMode = ValidationModeStrict
+
+	legacy := &oid4vc.LegacyParams{ClientIDScheme: "redirect_uri"}
+	_, _, err := w.ResolveDraftRequest("redirect_uri:https://rp.example/cb", legacy, nil)
+	if err == nil || !strings.Contains(err.Error(), "draft 23 request validation failed") {
+		t.Errorf("expected a strict mode error, got %v", err)
+	}
+
+	w.ValidationMode = ValidationModeDebug
+	_, findings, err := w.ResolveDraftRequest("redirect_uri:https://rp.example/cb", legacy, nil)
+	if err != nil || len(findings) != 1 {
+		t.Errorf("expected one finding in debug mode, got %v, %v", findings, err)
+	}
+}
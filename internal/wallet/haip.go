@@ -26,7 +26,7 @@ import (
 // Returns a list of violation messages. Empty list means compliant.
 //
 // HAIP 1.0 requires:
-//   - response_mode MUST be direct_post.jwt (encrypted responses)
+//   - response_mode MUST be direct_post.jwt, or dc_api.jwt over the DC API (encrypted responses)
 //   - client_id MUST use x509_hash: scheme
 //   - Signed Request Objects (JAR) MUST be used
 //   - DCQL query MUST be used (not presentation_definition)
@@ -34,8 +34,13 @@ import (
 func ValidateHAIPCompliance(params *AuthorizationRequestParams, reqObj *oid4vc.RequestObjectJWT) []string {
 	var violations []string
 
-	// §5.1.2.3: response_mode MUST be direct_post.jwt
-	if params.ResponseMode != "direct_post.jwt" {
+	// §5.1.2.3: response_mode MUST be direct_post.jwt (dc_api.jwt over the DC API)
+	if params.Origin != "" {
+		if params.ResponseMode != "dc_api.jwt" {
+			violations = append(violations, fmt.Sprintf(
+				"HAIP: response_mode MUST be 'dc_api.jwt' over the DC API, got %q", params.ResponseMode))
+		}
+	} else if params.ResponseMode != "direct_post.jwt" {
 		violations = append(violations, fmt.Sprintf(
 			"HAIP: response_mode MUST be 'direct_post.jwt', got %q", params.ResponseMode))
 	}
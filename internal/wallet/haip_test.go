@@ -52,6 +52,23 @@ func TestValidateHAIPCompliance(t *testing.T) {
 			wantViolations: 1,
 			wantContain:    "response_mode",
 		},
+		{
+			name: "dc_api.jwt over the DC API",
+			modifyParams: func(p *AuthorizationRequestParams) {
+				p.Origin = "https://verifier.example"
+				p.ResponseMode = "dc_api.jwt"
+			},
+			wantViolations: 0,
+		},
+		{
+			name: "dc_api over the DC API",
+			modifyParams: func(p *AuthorizationRequestParams) {
+				p.Origin = "https://verifier.example"
+				p.ResponseMode = "dc_api"
+			},
+			wantViolations: 1,
+			wantContain:    "dc_api.jwt",
+		},
 		{
 			name:           "wrong client_id scheme",
 			modifyParams:   func(p *AuthorizationRequestParams) { p.ClientID = "x509_san_dns:example.com" },
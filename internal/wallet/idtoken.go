@@ -15,56 +15,112 @@
 package wallet
 
 import (
-	"crypto/ecdsa"
-	"crypto/sha256"
+	"crypto"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/dominikschlosser/oid4vc-dev/internal/did"
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
+	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
 )
 
-// CreateSelfIssuedIDToken creates a SIOPv2 self-issued ID token JWT signed by the wallet's holder key.
-func (w *Wallet) CreateSelfIssuedIDToken(nonce, clientID string) (string, error) {
-	subJWK := mock.PublicKeyJWKMap(&w.HolderKey.PublicKey)
-	thumbprint, err := jwkThumbprint(&w.HolderKey.PublicKey)
-	if err != nil {
-		return "", fmt.Errorf("computing JWK thumbprint: %w", err)
+// Subject syntax types (SIOPv2 Section 7) the wallet supports for the sub of
+// self-issued ID tokens.
+const (
+	SubjectSyntaxJWKThumbprint = "urn:ietf:params:oauth:jwk-thumbprint"
+	SubjectSyntaxDIDJWK        = "did:jwk"
+	SubjectSyntaxDIDKey        = "did:key"
+)
+
+// SubjectSyntaxType returns the first entry of the verifier's
+// client_metadata.subject_syntax_types_supported that the wallet supports,
+// or the JWK thumbprint type if the request names none.
+func SubjectSyntaxType(reqObj *oid4vc.RequestObjectJWT) string {
+	if reqObj == nil || reqObj.Payload == nil {
+		return SubjectSyntaxJWKThumbprint
+	}
+	clientMeta, _ := reqObj.Payload["client_metadata"].(map[string]any)
+	types, _ := clientMeta["subject_syntax_types_supported"].([]any)
+	for _, t := range types {
+		switch t {
+		case SubjectSyntaxJWKThumbprint, SubjectSyntaxDIDJWK, SubjectSyntaxDIDKey:
+			return t.(string)
+		}
 	}
+	return SubjectSyntaxJWKThumbprint
+}
 
+// CreateSelfIssuedIDToken creates a SIOPv2 self-issued ID token JWT signed by the wallet's holder key.
+// With the JWK thumbprint subject syntax type the sub is the thumbprint of the holder key,
+// which the token carries as sub_jwk; with did:jwk or did:key the sub is the holder key's DID
+// and the header kid names its verification method.
+func (w *Wallet) CreateSelfIssuedIDToken(nonce, clientID, subjectSyntaxType string) (string, error) {
 	header := map[string]any{
-		"alg": "ES256",
+		"alg": string(w.signingAlg(w.HolderKey)),
 		"typ": "JWT",
-		"jwk": subJWK,
 	}
-
 	now := time.Now()
 	payload := map[string]any{
-		"iss":     "https://self-issued.me/v2",
-		"sub":     thumbprint,
-		"aud":     clientID,
-		"nonce":   nonce,
-		"iat":     now.Unix(),
-		"exp":     now.Add(5 * time.Minute).Unix(),
-		"sub_jwk": subJWK,
+		"iss":   "https://self-issued.me/v2",
+		"aud":   clientID,
+		"nonce": nonce,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+	}
+
+	subJWK := mock.PublicKeyJWKMap(w.HolderKey.Public())
+	switch subjectSyntaxType {
+	case SubjectSyntaxDIDJWK:
+		jwk := make(map[string]any, len(subJWK))
+		for k, v := range subJWK {
+			jwk[k] = v
+		}
+		sub, err := did.JWKDID(jwk)
+		if err != nil {
+			return "", err
+		}
+		payload["sub"] = sub
+		header["kid"] = sub + "#0"
+	case SubjectSyntaxDIDKey:
+		sub, err := did.KeyDID(w.HolderKey.Public())
+		if err != nil {
+			return "", err
+		}
+		payload["sub"] = sub
+		header["kid"] = sub + "#" + strings.TrimPrefix(sub, "did:key:")
+	default:
+		thumbprint, err := jwkThumbprint(w.HolderKey.Public())
+		if err != nil {
+			return "", fmt.Errorf("computing JWK thumbprint: %w", err)
+		}
+		payload["sub"] = thumbprint
+		payload["sub_jwk"] = subJWK
+		header["jwk"] = subJWK
 	}
 
 	return signJWT(header, payload, w.HolderKey)
 }
 
-// jwkThumbprint computes the JWK thumbprint per RFC 7638 for a P-256 public key.
-// The thumbprint is the base64url-encoded SHA-256 hash of the canonical JWK representation
-// with members sorted lexicographically: {"crv","kty","x","y"}.
-func jwkThumbprint(key *ecdsa.PublicKey) (string, error) {
-	jwk := mock.PublicKeyJWKMap(key)
-
-	// RFC 7638: canonical form uses sorted required members only
-	canonical := fmt.Sprintf(`{"crv":"%s","kty":"%s","x":"%s","y":"%s"}`,
-		jwk["crv"], jwk["kty"], jwk["x"], jwk["y"])
-
-	h := sha256.Sum256([]byte(canonical))
-	return format.EncodeBase64URL(h[:]), nil
+// jwkThumbprint computes the JWK thumbprint per RFC 7638 of a public key.
+// The thumbprint is the base64url-encoded SHA-256 hash of the canonical JWK
+// representation, see computeJWKThumbprint.
+func jwkThumbprint(key crypto.PublicKey) (string, error) {
+	jwk, err := keys.PublicJWK(key)
+	if err != nil {
+		return "", err
+	}
+	members := make(map[string]any, len(jwk))
+	for k, v := range jwk {
+		members[k] = v
+	}
+	thumbprint := computeJWKThumbprint(members)
+	if thumbprint == nil {
+		return "", fmt.Errorf("unsupported JWK key type %s", jwk["kty"])
+	}
+	return format.EncodeBase64URL(thumbprint), nil
 }
 
 // ResponseTypeContains checks if a space-separated response_type string contains the given value.
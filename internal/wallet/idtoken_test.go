@@ -27,8 +27,10 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/dominikschlosser/oid4vc-dev/internal/did"
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
 	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
+	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
 )
 
 func TestCreateSelfIssuedIDToken(t *testing.T) {
@@ -38,7 +40,7 @@ func TestCreateSelfIssuedIDToken(t *testing.T) {
 	}
 	w := &Wallet{HolderKey: key}
 
-	token, err := w.CreateSelfIssuedIDToken("test-nonce", "https://verifier.example")
+	token, err := w.CreateSelfIssuedIDToken("test-nonce", "https://verifier.example", SubjectSyntaxJWKThumbprint)
 	if err != nil {
 		t.Fatalf("CreateSelfIssuedIDToken() error: %v", err)
 	}
@@ -95,6 +97,81 @@ func TestCreateSelfIssuedIDToken(t *testing.T) {
 	}
 }
 
+func TestCreateSelfIssuedIDToken_DIDSubject(t *testing.T) {
+	key, err := mock.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &Wallet{HolderKey: key}
+
+	for _, syntaxType := range []string{SubjectSyntaxDIDJWK, SubjectSyntaxDIDKey} {
+		t.Run(syntaxType, func(t *testing.T) {
+			token, err := w.CreateSelfIssuedIDToken("test-nonce", "https://verifier.example", syntaxType)
+			if err != nil {
+				t.Fatalf("CreateSelfIssuedIDToken() error: %v", err)
+			}
+			header, payload, _, err := format.ParseJWTParts(token)
+			if err != nil {
+				t.Fatalf("parsing JWT: %v", err)
+			}
+			sub, _ := payload["sub"].(string)
+			if !strings.HasPrefix(sub, syntaxType+":") {
+				t.Fatalf("sub = %q, want a %s", sub, syntaxType)
+			}
+			if header["jwk"] != nil || payload["sub_jwk"] != nil {
+				t.Error("a DID subject should not carry jwk or sub_jwk")
+			}
+
+			kid, _ := header["kid"].(string)
+			doc, err := did.Resolve(sub, nil)
+			if err != nil {
+				t.Fatalf("resolving sub: %v", err)
+			}
+			vm, ok := doc.FindVerificationMethod(kid)
+			if !ok {
+				t.Fatalf("kid %q names no verification method of %s", kid, sub)
+			}
+			pub, err := vm.PublicKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !key.PublicKey.Equal(pub) {
+				t.Error("DID does not resolve to the holder key")
+			}
+			if !verifyES256(t, token, &key.PublicKey) {
+				t.Error("signature verification failed")
+			}
+		})
+	}
+}
+
+func TestSubjectSyntaxType(t *testing.T) {
+	tests := []struct {
+		name      string
+		supported any
+		want      string
+	}{
+		{"no client_metadata", nil, SubjectSyntaxJWKThumbprint},
+		{"verifier order", []any{"did:example", "did:key", "did:jwk"}, SubjectSyntaxDIDKey},
+		{"thumbprint first", []any{SubjectSyntaxJWKThumbprint, "did:jwk"}, SubjectSyntaxJWKThumbprint},
+		{"nothing supported", []any{"did:ebsi"}, SubjectSyntaxJWKThumbprint},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqObj := &oid4vc.RequestObjectJWT{Payload: map[string]any{}}
+			if tt.supported != nil {
+				reqObj.Payload["client_metadata"] = map[string]any{"subject_syntax_types_supported": tt.supported}
+			}
+			if got := SubjectSyntaxType(reqObj); got != tt.want {
+				t.Errorf("SubjectSyntaxType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if got := SubjectSyntaxType(nil); got != SubjectSyntaxJWKThumbprint {
+		t.Errorf("SubjectSyntaxType(nil) = %q", got)
+	}
+}
+
 func TestJWKThumbprint(t *testing.T) {
 	// Use a known key to verify thumbprint computation.
 	// RFC 7638 §3.1 example uses RSA, so we just verify our P-256 implementation
@@ -217,7 +294,7 @@ func splitJWT(token string) [3]string {
 
 func TestBuildFragmentRedirect_WithIDToken(t *testing.T) {
 	vpToken := map[string][]string{"pid": {"token1"}}
-	got, err := BuildFragmentRedirect("https://verifier.example/cb", "state1", vpToken, "eyJhbGciOiJFUzI1NiJ9.test.sig")
+	got, err := BuildFragmentRedirect("https://verifier.example/cb", "state1", vpToken, nil, "eyJhbGciOiJFUzI1NiJ9.test.sig")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -231,7 +308,7 @@ func TestBuildFragmentRedirect_WithIDToken(t *testing.T) {
 }
 
 func TestBuildFragmentRedirect_IDTokenOnly(t *testing.T) {
-	got, err := BuildFragmentRedirect("https://verifier.example/cb", "state1", nil, "eyJhbGciOiJFUzI1NiJ9.test.sig")
+	got, err := BuildFragmentRedirect("https://verifier.example/cb", "state1", nil, nil, "eyJhbGciOiJFUzI1NiJ9.test.sig")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -15,6 +15,7 @@
 package wallet
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"encoding/json"
 	"fmt"
@@ -25,6 +26,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
 	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
 )
@@ -43,11 +45,19 @@ type IssuanceResult struct {
 	CredentialID string `json:"credential_id"`
 	Format       string `json:"format"`
 	Issuer       string `json:"issuer"`
+	Instances    int    `json:"instances,omitempty"`  // number of batch-issued instances
+	PendingID    string `json:"pending_id,omitempty"` // set when issuance was deferred
 	Error        string `json:"error,omitempty"`
 }
 
 // ProcessCredentialOffer processes an OID4VCI credential offer URI.
 func (w *Wallet) ProcessCredentialOffer(offerURI string) (*IssuanceResult, error) {
+	return w.processCredentialOffer(offerURI, "")
+}
+
+// processCredentialOffer runs the issuance of an offer. A non-empty replaces
+// is the ID of a credential that the issued credential replaces.
+func (w *Wallet) processCredentialOffer(offerURI, replaces string) (*IssuanceResult, error) {
 	// Parse the credential offer
 	reqType, result, err := oid4vc.Parse(offerURI)
 	if err != nil {
@@ -62,67 +72,179 @@ func (w *Wallet) ProcessCredentialOffer(offerURI string) (*IssuanceResult, error
 		return nil, fmt.Errorf("unexpected result type")
 	}
 
-	// Reject offers that only have authorization_code grant (not supported)
-	if offer.Grants.PreAuthorizedCode == "" {
-		return nil, fmt.Errorf("credential offer requires authorization_code grant which is not supported; only pre-authorized_code flow is implemented")
-	}
-
 	// Fetch issuer metadata
 	metadata, err := fetchIssuerMetadata(offer.CredentialIssuer)
 	if err != nil {
 		return nil, fmt.Errorf("fetching issuer metadata: %w", err)
 	}
+	metadata, signedStatus, err := w.applySignedMetadata(metadata, offer.CredentialIssuer)
+	if err != nil {
+		return nil, err
+	}
 
-	// Get token endpoint
-	tokenEndpoint := getTokenEndpoint(metadata, offer.CredentialIssuer)
-	credentialEndpoint := getCredentialEndpoint(metadata, offer.CredentialIssuer)
+	authServer := resolveAuthorizationServer(metadata, offer.CredentialIssuer, offer.Grants.AuthorizationServer)
+	// Missing AS metadata is not fatal: endpoints fall back to defaults.
+	oauthMeta, _ := fetchOAuthMetadata(authServer)
 
-	// Token exchange (pre-authorized code flow)
-	w.mu.Lock()
-	txCode := w.TxCode
-	w.TxCode = "" // clear after use
-	w.mu.Unlock()
-	tokenResp, err := exchangeToken(tokenEndpoint, offer, txCode)
+	as, err := w.newAuthServerSession(authServer, oauthMeta)
 	if err != nil {
-		return nil, fmt.Errorf("token exchange: %w", err)
+		return nil, err
+	}
+
+	ictx := &IssuanceContext{
+		Issuer:              offer.CredentialIssuer,
+		AuthorizationServer: authServer,
+		OfferURI:            offerURI,
+	}
+	var tokenResp map[string]any
+	if offer.Grants.PreAuthorizedCode != "" {
+		// Token exchange (pre-authorized code flow)
+		tokenEndpoint := resolveTokenEndpoint(metadata, oauthMeta, authServer)
+		log.Printf("[VCI] Token endpoint: %s", tokenEndpoint)
+		w.mu.Lock()
+		txCode := w.TxCode
+		w.TxCode = "" // clear after use
+		w.mu.Unlock()
+		tokenResp, err = exchangeToken(tokenEndpoint, offer, txCode, as)
+		if err != nil {
+			return nil, fmt.Errorf("token exchange: %w", err)
+		}
+	} else {
+		// Authorization code flow (with PKCE). Used when the offer carries an
+		// authorization_code grant or no grants at all.
+		tokenResp, err = w.runAuthorizationCodeFlow(metadata, offer, as)
+		if err != nil {
+			return nil, fmt.Errorf("authorization code flow: %w", err)
+		}
+		ictx.ClientID = w.issuanceClientID()
+	}
+
+	return w.requestIssuance(authorizedIssuance{
+		Offer:        offer,
+		Metadata:     metadata,
+		SignedStatus: signedStatus,
+		TokenResp:    tokenResp,
+		Auth:         resourceAuth(tokenResp, as.DPoP),
+		Context:      ictx,
+		Replaces:     replaces,
+	})
+}
+
+// authorizedIssuance is an issuance for which the wallet holds an access
+// token: after the token exchange of an offer, or when a credential is
+// refreshed.
+type authorizedIssuance struct {
+	Offer        *oid4vc.CredentialOffer // the issuer and credential configuration to request
+	Metadata     map[string]any
+	SignedStatus string
+	TokenResp    map[string]any // nil when a stored access token is reused
+	Auth         accessTokenAuth
+	Context      *IssuanceContext // stored with the credential for later refreshes
+	Replaces     string           // ID of the credential being refreshed
+}
+
+// requestIssuance requests the credential of an authorized issuance and
+// stores it, or records a pending issuance if the issuer defers it.
+func (w *Wallet) requestIssuance(ai authorizedIssuance) (*IssuanceResult, error) {
+	offer, metadata, tokenResp, auth := ai.Offer, ai.Metadata, ai.TokenResp, ai.Auth
+
+	credentialEndpoint := getCredentialEndpoint(metadata, offer.CredentialIssuer)
+	encryption, err := w.resolveResponseEncryption(metadata)
+	if err != nil {
+		return nil, err
 	}
 
-	accessToken, _ := tokenResp["access_token"].(string)
 	cNonce, _ := tokenResp["c_nonce"].(string)
 
-	log.Printf("[VCI] Token endpoint: %s", tokenEndpoint)
 	log.Printf("[VCI] Credential endpoint: %s", credentialEndpoint)
 	log.Printf("[VCI] c_nonce: %q", cNonce)
-	if tokenJSON, err := json.MarshalIndent(tokenResp, "", "  "); err == nil {
-		log.Printf("[VCI] Token response:\n%s", tokenJSON)
+	if tokenResp != nil {
+		if tokenJSON, err := json.MarshalIndent(tokenResp, "", "  "); err == nil {
+			log.Printf("[VCI] Token response:\n%s", tokenJSON)
+		}
 	}
 
-	// Create proof of possession JWT
-	proofJWT, err := createProofJWT(w.HolderKey, offer.CredentialIssuer, cNonce)
+	// Batch issuance: one proof per holder key, each bound to a distinct key
+	batchSize := resolveBatchSize(metadata)
+	holderKeys, err := w.issuanceHolderKeys(batchSize)
 	if err != nil {
-		return nil, fmt.Errorf("creating proof JWT: %w", err)
+		return nil, err
+	}
+	if batchSize > 1 {
+		log.Printf("[VCI] Batch issuance: requesting %d credential instances", batchSize)
 	}
-	log.Printf("[VCI] Proof JWT: %s", proofJWT)
 
-	// Request credential
-	credFormat := ""
+	credFormat, configID := "", ""
 	if len(offer.CredentialConfigurationIDs) > 0 {
-		credFormat = resolveCredentialFormat(metadata, offer.CredentialConfigurationIDs[0])
+		configID = offer.CredentialConfigurationIDs[0]
+		credFormat = resolveCredentialFormat(metadata, configID)
+	}
+	proofReq, err := w.resolveProof(metadata, configID)
+	if err != nil {
+		return nil, err
+	}
+	w.mu.RLock()
+	locale := w.Locale
+	w.mu.RUnlock()
+	display := resolveCredentialDisplay(metadata, configID, credFormat, locale, ai.SignedStatus)
+	if proofReq.KeyAttestation {
+		log.Printf("[VCI] Issuer requires key attestation (proof type %s)", proofReq.Type)
+	}
+
+	// Create proofs of possession
+	proofs, err := w.createProofs(proofReq, holderKeys, offer.CredentialIssuer, cNonce)
+	if err != nil {
+		return nil, fmt.Errorf("creating proof JWT: %w", err)
+	}
+	for proofType, values := range proofs {
+		for _, v := range values {
+			if s, ok := v.(string); ok {
+				log.Printf("[VCI] Proof (%s): %s", proofType, s)
+			} else if proofJSON, err := json.Marshal(v); err == nil {
+				log.Printf("[VCI] Proof (%s): %s", proofType, proofJSON)
+			}
+		}
 	}
 
-	// Extract credential_identifiers from authorization_details in token response
+	// Request credential
+
+	// Extract credential_identifiers from authorization_details in token
+	// response. A refresh falls back to the identifier of the first issuance.
 	credentialIdentifier := resolveCredentialIdentifier(tokenResp, offer.CredentialConfigurationIDs)
+	if credentialIdentifier == "" {
+		credentialIdentifier = ai.Context.CredentialIdentifier
+	}
 	credentialConfigurationID := ""
 	if credentialIdentifier == "" && len(offer.CredentialConfigurationIDs) > 0 {
 		credentialConfigurationID = offer.CredentialConfigurationIDs[0]
 	}
 
+	ictx := *ai.Context
+	ictx.ConfigurationID = configID
+	ictx.CredentialIdentifier = credentialIdentifier
+	if tokenResp != nil {
+		ictx.setToken(tokenResp, auth)
+	}
+
+	state := credentialRequestState{
+		Issuer:               offer.CredentialIssuer,
+		Format:               credFormat,
+		Auth:                 auth,
+		DeferredEndpoint:     getDeferredCredentialEndpoint(metadata),
+		NotificationEndpoint: getNotificationEndpoint(metadata),
+		HolderKeys:           holderKeys,
+		Encryption:           encryption,
+		Display:              display,
+		Context:              &ictx,
+		Replaces:             ai.Replaces,
+	}
+
 	// If no c_nonce in token response, try a nonce endpoint or send without
 	// proof first to get a c_nonce from the error response.
 	if cNonce == "" {
 		cNonce = fetchNonce(metadata, offer.CredentialIssuer)
 		if cNonce != "" {
-			proofJWT, err = createProofJWT(w.HolderKey, offer.CredentialIssuer, cNonce)
+			proofs, err = w.createProofs(proofReq, holderKeys, offer.CredentialIssuer, cNonce)
 			if err != nil {
 				return nil, fmt.Errorf("creating proof JWT with nonce: %w", err)
 			}
@@ -133,14 +255,14 @@ func (w *Wallet) ProcessCredentialOffer(offerURI string) (*IssuanceResult, error
 	if cNonce == "" {
 		// Try credential request without proof to get c_nonce from error response
 		log.Printf("[VCI] No c_nonce available, attempting credential request to obtain one")
-		nonceResp, nonceErr := requestCredential(credentialEndpoint, accessToken, proofJWT, credentialIdentifier, credentialConfigurationID)
+		nonceResp, nonceErr := requestCredential(credentialEndpoint, auth, proofs, credentialIdentifier, credentialConfigurationID, encryption)
 		if nonceErr != nil {
 			// Check if the error response contained a c_nonce
 			if n, ok := nonceResp["c_nonce"].(string); ok && n != "" {
 				cNonce = n
 				log.Printf("[VCI] Got c_nonce from error response: %s", cNonce)
-				// Recreate proof with the real nonce
-				proofJWT, err = createProofJWT(w.HolderKey, offer.CredentialIssuer, cNonce)
+				// Recreate proofs with the real nonce
+				proofs, err = w.createProofs(proofReq, holderKeys, offer.CredentialIssuer, cNonce)
 				if err != nil {
 					return nil, fmt.Errorf("creating proof JWT with nonce: %w", err)
 				}
@@ -149,26 +271,11 @@ func (w *Wallet) ProcessCredentialOffer(offerURI string) (*IssuanceResult, error
 			}
 		} else {
 			// First request succeeded without nonce — use the response directly
-			credential := extractCredential(nonceResp)
-			if credential == "" {
-				return nil, fmt.Errorf("no credential in response")
-			}
-			imported, err := w.ImportCredential(credential)
-			if err != nil {
-				return nil, fmt.Errorf("importing received credential: %w", err)
-			}
-			if credFormat == "" {
-				credFormat = imported.Format
-			}
-			return &IssuanceResult{
-				CredentialID: imported.ID,
-				Format:       credFormat,
-				Issuer:       offer.CredentialIssuer,
-			}, nil
+			return w.storeIssuedCredentials(nonceResp, state)
 		}
 	}
 
-	credResp, err := requestCredential(credentialEndpoint, accessToken, proofJWT, credentialIdentifier, credentialConfigurationID)
+	credResp, err := requestCredential(credentialEndpoint, auth, proofs, credentialIdentifier, credentialConfigurationID, encryption)
 	if err != nil {
 		return nil, fmt.Errorf("requesting credential: %w", err)
 	}
@@ -177,17 +284,78 @@ func (w *Wallet) ProcessCredentialOffer(offerURI string) (*IssuanceResult, error
 		log.Printf("[VCI] Credential response:\n%s", credJSON)
 	}
 
-	credential := extractCredential(credResp)
-	if credential == "" {
+	return w.storeIssuedCredentials(credResp, state)
+}
+
+// authServerSession holds what an issuance needs to talk to the
+// authorization server: its metadata and, when in use, the DPoP signer and
+// client attester attached to token and PAR requests.
+type authServerSession struct {
+	URL         string
+	Metadata    map[string]any // nil if the server publishes no metadata
+	DPoP        *dpopSigner
+	Attestation *clientAttester
+}
+
+func (w *Wallet) newAuthServerSession(authServer string, oauthMeta map[string]any) (*authServerSession, error) {
+	dpop, err := w.resolveDPoP(oauthMeta)
+	if err != nil {
+		return nil, err
+	}
+	att, err := w.resolveClientAttestation(oauthMeta, authServer)
+	if err != nil {
+		return nil, err
+	}
+	return &authServerSession{
+		URL:         authServer,
+		Metadata:    oauthMeta,
+		DPoP:        dpop,
+		Attestation: att,
+	}, nil
+}
+
+// credentialRequestState captures what is needed to finish an issuance once
+// the credential endpoint has answered, immediately or deferred.
+type credentialRequestState struct {
+	Issuer               string
+	Format               string
+	Auth                 accessTokenAuth
+	DeferredEndpoint     string
+	NotificationEndpoint string // "" if the issuer does not support notifications
+	HolderKeys           []crypto.Signer
+	Encryption           *ResponseEncryption // nil for plain credential responses
+	Display              *CredentialDisplay  // nil if the issuer provides no display data
+	Context              *IssuanceContext
+	Replaces             string // ID of the credential being refreshed
+}
+
+// storeIssuedCredentials imports the credentials of a credential response.
+// Batch responses are stored as instances of a single credential. A response
+// carrying only a transaction_id is recorded as a pending deferred issuance.
+func (w *Wallet) storeIssuedCredentials(credResp map[string]any, state credentialRequestState) (*IssuanceResult, error) {
+	credentials := extractCredentials(credResp)
+	if len(credentials) == 0 {
+		if txID, ok := credResp["transaction_id"].(string); ok && txID != "" {
+			return w.deferIssuance(credResp, txID, state)
+		}
 		return nil, fmt.Errorf("no credential in response")
 	}
+	if len(credentials) < len(state.HolderKeys) {
+		log.Printf("[VCI] Issuer returned %d of %d requested credential instances", len(credentials), len(state.HolderKeys))
+	}
 
-	// Import the received credential
-	imported, err := w.ImportCredential(credential)
+	notification := responseNotification(credResp, state.NotificationEndpoint, state.Auth)
+	imported, err := w.importIssuedCredentials(credentials, state.HolderKeys, issuedCredentialInfo{
+		Notification: notification,
+		Display:      state.Display,
+		Context:      state.Context,
+		Replaces:     state.Replaces,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("importing received credential: %w", err)
 	}
 
+	credFormat := state.Format
 	if credFormat == "" {
 		credFormat = imported.Format
 	}
@@ -195,10 +363,43 @@ func (w *Wallet) ProcessCredentialOffer(offerURI string) (*IssuanceResult, error
 	return &IssuanceResult{
 		CredentialID: imported.ID,
 		Format:       credFormat,
-		Issuer:       offer.CredentialIssuer,
+		Issuer:       state.Issuer,
+		Instances:    len(imported.Instances),
 	}, nil
 }
 
+// resolveBatchSize returns batch_credential_issuance.batch_size from the issuer
+// metadata, or 1 if the issuer does not support batch issuance.
+func resolveBatchSize(metadata map[string]any) int {
+	batch, ok := metadata["batch_credential_issuance"].(map[string]any)
+	if !ok {
+		return 1
+	}
+	size, ok := batch["batch_size"].(float64)
+	if !ok || size < 2 {
+		return 1
+	}
+	return int(size)
+}
+
+// issuanceHolderKeys returns the holder keys to bind issued credentials to.
+// A single credential uses the wallet's holder key; batch instances each get a
+// fresh key so that presentations of different instances are unlinkable.
+func (w *Wallet) issuanceHolderKeys(n int) ([]crypto.Signer, error) {
+	if n <= 1 {
+		return []crypto.Signer{w.HolderKey}, nil
+	}
+	holderKeys := make([]crypto.Signer, n)
+	for i := range holderKeys {
+		key, err := keys.GenerateKey(w.holderAlg())
+		if err != nil {
+			return nil, fmt.Errorf("generating holder key for instance %d: %w", i, err)
+		}
+		holderKeys[i] = key
+	}
+	return holderKeys, nil
+}
+
 // fetchIssuerMetadata fetches the OpenID Credential Issuer metadata.
 func fetchIssuerMetadata(issuer string) (map[string]any, error) {
 	metadataURL := strings.TrimRight(issuer, "/") + "/.well-known/openid-credential-issuer"
@@ -232,24 +433,21 @@ func getTokenEndpoint(metadata map[string]any, issuer string) string {
 		return ep
 	}
 
-	// Determine the authorization server URL. Per OID4VCI spec, if
-	// authorization_servers is present, use the first entry; otherwise
-	// the credential issuer URL itself acts as the authorization server.
-	authServer := strings.TrimRight(issuer, "/")
-	if servers, ok := metadata["authorization_servers"].([]any); ok && len(servers) > 0 {
-		if s, ok := servers[0].(string); ok {
-			authServer = strings.TrimRight(s, "/")
-		}
-	}
-
 	// Fetch the OAuth authorization server metadata to find the token endpoint
-	oauthMeta, err := fetchOAuthMetadata(authServer)
-	if err == nil {
-		if ep, ok := oauthMeta["token_endpoint"].(string); ok {
-			return ep
-		}
-	}
+	authServer := resolveAuthorizationServer(metadata, issuer, "")
+	oauthMeta, _ := fetchOAuthMetadata(authServer)
+	return resolveTokenEndpoint(metadata, oauthMeta, authServer)
+}
 
+// resolveTokenEndpoint resolves the token endpoint from already fetched
+// issuer and authorization server metadata. oauthMeta may be nil.
+func resolveTokenEndpoint(metadata, oauthMeta map[string]any, authServer string) string {
+	if ep, ok := metadata["token_endpoint"].(string); ok {
+		return ep
+	}
+	if ep, ok := oauthMeta["token_endpoint"].(string); ok {
+		return ep
+	}
 	return authServer + "/token"
 }
 
@@ -293,6 +491,13 @@ func fetchOAuthMetadata(authServer string) (map[string]any, error) {
 	return nil, fmt.Errorf("no OAuth metadata found at %s", authServer)
 }
 
+// getDeferredCredentialEndpoint returns the deferred_credential_endpoint from
+// the issuer metadata, or "" if the issuer does not advertise one.
+func getDeferredCredentialEndpoint(metadata map[string]any) string {
+	ep, _ := metadata["deferred_credential_endpoint"].(string)
+	return ep
+}
+
 func getCredentialEndpoint(metadata map[string]any, issuer string) string {
 	if ep, ok := metadata["credential_endpoint"].(string); ok {
 		return ep
@@ -314,7 +519,7 @@ func resolveCredentialFormat(metadata map[string]any, configID string) string {
 }
 
 // exchangeToken performs the pre-authorized code token exchange.
-func exchangeToken(tokenEndpoint string, offer *oid4vc.CredentialOffer, txCode string) (map[string]any, error) {
+func exchangeToken(tokenEndpoint string, offer *oid4vc.CredentialOffer, txCode string, as *authServerSession) (map[string]any, error) {
 	form := url.Values{}
 	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:pre-authorized_code")
 	form.Set("pre-authorized_code", offer.Grants.PreAuthorizedCode)
@@ -322,21 +527,25 @@ func exchangeToken(tokenEndpoint string, offer *oid4vc.CredentialOffer, txCode s
 		form.Set("tx_code", txCode)
 	}
 
-	req, err := http.NewRequest("POST", tokenEndpoint, strings.NewReader(form.Encode()))
-	if err != nil {
-		return nil, fmt.Errorf("creating token request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return postTokenRequest(tokenEndpoint, form, as)
+}
 
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("token request: %w", err)
+// postTokenRequest sends a form-encoded token request and parses the response.
+// The request carries a DPoP proof and client attestation if the session
+// uses them.
+func postTokenRequest(tokenEndpoint string, form url.Values, as *authServerSession) (map[string]any, error) {
+	newReq := func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", tokenEndpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, fmt.Errorf("creating token request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	_, body, err := sendIssuanceRequest(newReq, as.DPoP, as.Attestation, "")
 	if err != nil {
-		return nil, fmt.Errorf("reading token response: %w", err)
+		return nil, fmt.Errorf("token request: %w", err)
 	}
 
 	var tokenResp map[string]any
@@ -352,20 +561,24 @@ func exchangeToken(tokenEndpoint string, offer *oid4vc.CredentialOffer, txCode s
 	return tokenResp, nil
 }
 
-// createProofJWT creates an OID4VCI proof of possession JWT.
-func createProofJWT(holderKey *ecdsa.PrivateKey, audience, cNonce string) (string, error) {
+// createProofJWT creates an OID4VCI proof of possession JWT signed with alg. A
+// non-empty keyAttestation is sent in the key_attestation header.
+func createProofJWT(holderKey crypto.Signer, alg keys.Algorithm, audience, cNonce, keyAttestation string) (string, error) {
 	// Build JWK for holder public key
-	jwkJSON := mock.PublicKeyJWK(&holderKey.PublicKey)
+	jwkJSON := mock.PublicKeyJWK(holderKey.Public())
 	var jwk map[string]any
 	if err := json.Unmarshal([]byte(jwkJSON), &jwk); err != nil {
 		return "", fmt.Errorf("parsing holder JWK: %w", err)
 	}
 
 	header := map[string]any{
-		"alg": "ES256",
+		"alg": string(alg),
 		"typ": "openid4vci-proof+jwt",
 		"jwk": jwk,
 	}
+	if keyAttestation != "" {
+		header["key_attestation"] = keyAttestation
+	}
 
 	payload := map[string]any{
 		"aud":   audience,
@@ -376,6 +589,19 @@ func createProofJWT(holderKey *ecdsa.PrivateKey, audience, cNonce string) (strin
 	return signJWT(header, payload, holderKey)
 }
 
+// createProofJWTs creates one proof of possession JWT per holder key.
+func createProofJWTs(holderKeys []crypto.Signer, alg keys.Algorithm, audience, cNonce string) ([]any, error) {
+	proofs := make([]any, len(holderKeys))
+	for i, key := range holderKeys {
+		proofJWT, err := createProofJWT(key, alg, audience, cNonce, "")
+		if err != nil {
+			return nil, err
+		}
+		proofs[i] = proofJWT
+	}
+	return proofs, nil
+}
+
 // resolveCredentialIdentifier extracts a credential_identifier from the token
 // response's authorization_details. Per OID4VCI 1.0 final, the token response
 // may contain credential_identifiers that should be used instead of the
@@ -398,28 +624,33 @@ func resolveCredentialIdentifier(tokenResp map[string]any, configIDs []string) s
 	return ""
 }
 
-// extractCredential extracts the credential string from a credential response.
+// extractCredentials extracts all credential strings from a credential response.
 // Supports both the single "credential" field and the "credentials" array format.
-func extractCredential(resp map[string]any) string {
+func extractCredentials(resp map[string]any) []string {
 	// Single credential field (OID4VCI draft 13 and earlier)
 	if c, ok := resp["credential"].(string); ok && c != "" {
-		return c
+		return []string{c}
 	}
 
-	// Credentials array (OID4VCI draft 14+)
-	if creds, ok := resp["credentials"].([]any); ok && len(creds) > 0 {
-		if entry, ok := creds[0].(map[string]any); ok {
-			if c, ok := entry["credential"].(string); ok {
-				return c
+	// Credentials array (OID4VCI draft 14+), one entry per batch instance
+	var out []string
+	if creds, ok := resp["credentials"].([]any); ok {
+		for _, entry := range creds {
+			switch e := entry.(type) {
+			case map[string]any:
+				if c, ok := e["credential"].(string); ok && c != "" {
+					out = append(out, c)
+				}
+			case string:
+				// Array of raw strings
+				if e != "" {
+					out = append(out, e)
+				}
 			}
 		}
-		// Array of raw strings
-		if c, ok := creds[0].(string); ok {
-			return c
-		}
 	}
 
-	return ""
+	return out
 }
 
 // fetchNonce tries to obtain a c_nonce from a dedicated nonce endpoint.
@@ -460,12 +691,11 @@ func fetchNonce(metadata map[string]any, issuer string) string {
 	return ""
 }
 
-// requestCredential sends a credential request to the issuer.
-func requestCredential(credentialEndpoint, accessToken, proofJWT string, credentialIdentifier string, credentialConfigurationID string) (map[string]any, error) {
+// requestCredential sends a credential request to the issuer. With enc set,
+// the response is requested encrypted to a fresh ephemeral key.
+func requestCredential(credentialEndpoint string, auth accessTokenAuth, proofs credentialProofs, credentialIdentifier string, credentialConfigurationID string, enc *ResponseEncryption) (map[string]any, error) {
 	reqBody := map[string]any{
-		"proofs": map[string]any{
-			"jwt": []string{proofJWT},
-		},
+		"proofs": proofs,
 	}
 
 	if credentialIdentifier != "" {
@@ -473,28 +703,40 @@ func requestCredential(credentialEndpoint, accessToken, proofJWT string, credent
 	} else if credentialConfigurationID != "" {
 		reqBody["credential_configuration_id"] = credentialConfigurationID
 	}
+	var encKey *ecdsa.PrivateKey
+	if enc != nil {
+		var err error
+		if encKey, err = enc.addTo(reqBody); err != nil {
+			return nil, err
+		}
+	}
 
 	bodyJSON, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("marshaling request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", credentialEndpoint, strings.NewReader(string(bodyJSON)))
-	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
+	newReq := func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", credentialEndpoint, strings.NewReader(string(bodyJSON)))
+		if err != nil {
+			return nil, fmt.Errorf("creating request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", auth.tokenType()+" "+auth.Token)
+		if encKey != nil {
+			setDebugKey(req, encKey)
+		}
+		return req, nil
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+accessToken)
 
-	resp, err := httpClient.Do(req)
+	resp, body, err := sendIssuanceRequest(newReq, auth.DPoP, nil, auth.Token)
 	if err != nil {
 		return nil, fmt.Errorf("credential request: %w", err)
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("reading credential response: %w", err)
+	if encKey != nil {
+		if body, err = decryptIssuanceResponse(resp, body, encKey); err != nil {
+			return nil, err
+		}
 	}
 
 	var credResp map[string]any
@@ -511,3 +753,54 @@ func requestCredential(credentialEndpoint, accessToken, proofJWT string, credent
 
 	return credResp, nil
 }
+
+// sendIssuanceRequest sends the request built by newReq and returns the
+// response with its body already read. With a DPoP signer, a proof is
+// attached (bound to accessToken, if set); with a client attester, the
+// client attestation headers are attached. A use_dpop_nonce or
+// use_attestation_challenge error is answered by retrying with the nonce or
+// challenge the server supplied, once per kind.
+func sendIssuanceRequest(newReq func() (*http.Request, error), dpop *dpopSigner, att *clientAttester, accessToken string) (*http.Response, []byte, error) {
+	dpopRetried, attRetried := false, false
+	for {
+		req, err := newReq()
+		if err != nil {
+			return nil, nil, err
+		}
+		target := req.URL.String()
+		if dpop != nil {
+			proof, err := dpop.proof(req.Method, target, accessToken)
+			if err != nil {
+				return nil, nil, fmt.Errorf("creating DPoP proof: %w", err)
+			}
+			req.Header.Set("DPoP", proof)
+		}
+		if att != nil {
+			if err := att.apply(req); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return resp, nil, fmt.Errorf("reading response: %w", err)
+		}
+
+		if dpop != nil && dpop.rememberNonce(target, resp) && !dpopRetried && isDPoPNonceChallenge(resp, body) {
+			dpopRetried = true
+			log.Printf("[VCI] Server requires a DPoP nonce, retrying %s", dpopHTU(target))
+			continue
+		}
+		if att != nil && att.rememberChallenge(resp) && !attRetried && isAttestationChallenge(body) {
+			attRetried = true
+			log.Printf("[VCI] Server requires an attestation challenge, retrying %s", dpopHTU(target))
+			continue
+		}
+		return resp, body, nil
+	}
+}
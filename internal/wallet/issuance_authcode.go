@@ -0,0 +1,317 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/config"
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
+)
+
+// DefaultIssuanceClientID is the OAuth client_id used for the OID4VCI
+// authorization code flow when none is configured.
+const DefaultIssuanceClientID = "oid4vc-dev-wallet"
+
+// AuthorizationCallback carries the parameters delivered to the wallet's
+// redirect_uri after the user finished the authorization endpoint step.
+type AuthorizationCallback struct {
+	Code             string `json:"code,omitempty"`
+	Error            string `json:"error,omitempty"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// authorizationRequest holds the state of an in-flight authorization code flow.
+type authorizationRequest struct {
+	Params       url.Values
+	State        string
+	CodeVerifier string
+	RedirectURI  string
+	ClientID     string
+}
+
+// generatePKCE creates a PKCE code verifier and its S256 code challenge (RFC 7636).
+func generatePKCE() (verifier, challenge string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("generating code verifier: %w", err)
+	}
+	verifier = format.EncodeBase64URL(b)
+	h := sha256.Sum256([]byte(verifier))
+	return verifier, format.EncodeBase64URL(h[:]), nil
+}
+
+// resolveAuthorizationServer determines the authorization server for an issuer.
+// Per OID4VCI, a grant-level authorization_server hint takes precedence, then
+// the first entry of authorization_servers; otherwise the credential issuer
+// acts as its own authorization server.
+func resolveAuthorizationServer(metadata map[string]any, issuer, hint string) string {
+	if hint != "" {
+		return strings.TrimRight(hint, "/")
+	}
+	if servers, ok := metadata["authorization_servers"].([]any); ok && len(servers) > 0 {
+		if s, ok := servers[0].(string); ok {
+			return strings.TrimRight(s, "/")
+		}
+	}
+	return strings.TrimRight(issuer, "/")
+}
+
+// getAuthorizationEndpoint returns the authorization endpoint from the
+// authorization server metadata, falling back to <server>/authorize.
+func getAuthorizationEndpoint(oauthMeta map[string]any, authServer string) string {
+	if ep, ok := oauthMeta["authorization_endpoint"].(string); ok {
+		return ep
+	}
+	return authServer + "/authorize"
+}
+
+// buildAuthorizationDetails builds the RAR (RFC 9396) authorization_details
+// for the offered credential configurations.
+func buildAuthorizationDetails(offer *oid4vc.CredentialOffer, authServer string) []map[string]any {
+	details := make([]map[string]any, 0, len(offer.CredentialConfigurationIDs))
+	for _, id := range offer.CredentialConfigurationIDs {
+		d := map[string]any{
+			"type":                        "openid_credential",
+			"credential_configuration_id": id,
+		}
+		// locations is required when the AS is not the credential issuer itself
+		if authServer != strings.TrimRight(offer.CredentialIssuer, "/") {
+			d["locations"] = []string{offer.CredentialIssuer}
+		}
+		details = append(details, d)
+	}
+	return details
+}
+
+// resolveCredentialScope returns the space-separated scope values of the
+// offered credential configurations, or "" if any of them has no scope.
+func resolveCredentialScope(metadata map[string]any, configIDs []string) string {
+	configs, _ := metadata["credential_configurations_supported"].(map[string]any)
+	var scopes []string
+	for _, id := range configIDs {
+		cfg, _ := configs[id].(map[string]any)
+		scope, _ := cfg["scope"].(string)
+		if scope == "" {
+			return ""
+		}
+		scopes = append(scopes, scope)
+	}
+	return strings.Join(scopes, " ")
+}
+
+// supportsAuthorizationDetails reports whether the authorization server accepts
+// openid_credential authorization_details. Servers that do not advertise
+// authorization_details_types_supported are assumed to accept them.
+func supportsAuthorizationDetails(oauthMeta map[string]any) bool {
+	types, ok := oauthMeta["authorization_details_types_supported"].([]any)
+	if !ok {
+		return true
+	}
+	for _, t := range types {
+		if t == "openid_credential" {
+			return true
+		}
+	}
+	return false
+}
+
+// buildAuthorizationRequest builds the authorization request parameters with
+// PKCE, state, issuer_state, and either authorization_details or scope.
+func buildAuthorizationRequest(clientID, redirectURI string, offer *oid4vc.CredentialOffer, authServer, scope string) (*authorizationRequest, error) {
+	verifier, challenge, err := generatePKCE()
+	if err != nil {
+		return nil, err
+	}
+	state, err := GenerateWalletNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", clientID)
+	params.Set("redirect_uri", redirectURI)
+	params.Set("state", state)
+	params.Set("code_challenge", challenge)
+	params.Set("code_challenge_method", "S256")
+	if offer.Grants.IssuerState != "" {
+		params.Set("issuer_state", offer.Grants.IssuerState)
+	}
+	if scope != "" {
+		params.Set("scope", scope)
+	} else if details := buildAuthorizationDetails(offer, authServer); len(details) > 0 {
+		detailsJSON, err := json.Marshal(details)
+		if err != nil {
+			return nil, fmt.Errorf("marshaling authorization_details: %w", err)
+		}
+		params.Set("authorization_details", string(detailsJSON))
+	}
+
+	return &authorizationRequest{
+		Params:       params,
+		State:        state,
+		CodeVerifier: verifier,
+		RedirectURI:  redirectURI,
+		ClientID:     clientID,
+	}, nil
+}
+
+// authorizationURL builds the front-channel URL for the authorization endpoint
+// from the given query parameters.
+func authorizationURL(authEndpoint string, params url.Values) (string, error) {
+	u, err := url.Parse(authEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("parsing authorization endpoint: %w", err)
+	}
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// runAuthorizationCodeFlow drives the OID4VCI authorization code flow: it
+// sends the user to the authorization endpoint, waits for the redirect on the
+// wallet's callback listener, and exchanges the code for an access token.
+func (w *Wallet) runAuthorizationCodeFlow(metadata map[string]any, offer *oid4vc.CredentialOffer, as *authServerSession) (map[string]any, error) {
+	clientID := w.issuanceClientID()
+	w.mu.RLock()
+	redirectURI := w.IssuanceRedirectURI
+	onAuthURL := w.OnAuthorizationURL
+	w.mu.RUnlock()
+
+	if redirectURI == "" {
+		return nil, fmt.Errorf("authorization code flow requires a redirect_uri (no callback listener configured)")
+	}
+	if onAuthURL == nil {
+		return nil, fmt.Errorf("authorization code flow requires user interaction but no authorization handler is configured")
+	}
+
+	authEndpoint := getAuthorizationEndpoint(as.Metadata, as.URL)
+
+	scope := ""
+	if !supportsAuthorizationDetails(as.Metadata) {
+		scope = resolveCredentialScope(metadata, offer.CredentialConfigurationIDs)
+	}
+
+	authReq, err := buildAuthorizationRequest(clientID, redirectURI, offer, as.URL, scope)
+	if err != nil {
+		return nil, fmt.Errorf("building authorization request: %w", err)
+	}
+	if as.DPoP != nil {
+		// RFC 9449 Section 10: bind the authorization code to the DPoP key
+		jkt, err := jwkThumbprint(&as.DPoP.key.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("computing dpop_jkt: %w", err)
+		}
+		authReq.Params.Set("dpop_jkt", jkt)
+	}
+
+	log.Printf("[VCI] Authorization server: %s", as.URL)
+	log.Printf("[VCI] Authorization endpoint: %s", authEndpoint)
+
+	authURL, err := w.resolveAuthorizationURL(as, authEndpoint, authReq)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[VCI] Authorization request: %s", authURL)
+
+	ch := w.registerAuthorization(authReq.State)
+	defer w.unregisterAuthorization(authReq.State)
+
+	if err := onAuthURL(authURL); err != nil {
+		return nil, fmt.Errorf("opening authorization endpoint: %w", err)
+	}
+
+	var cb AuthorizationCallback
+	select {
+	case cb = <-ch:
+	case <-time.After(config.ConsentTimeout):
+		return nil, fmt.Errorf("timed out waiting for authorization callback")
+	}
+
+	if cb.Error != "" {
+		return nil, fmt.Errorf("authorization error: %s: %s", cb.Error, cb.ErrorDescription)
+	}
+	if cb.Code == "" {
+		return nil, fmt.Errorf("authorization callback did not contain a code")
+	}
+	log.Printf("[VCI] Authorization code received")
+
+	tokenEndpoint := resolveTokenEndpoint(metadata, as.Metadata, as.URL)
+	log.Printf("[VCI] Token endpoint: %s", tokenEndpoint)
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", cb.Code)
+	form.Set("redirect_uri", authReq.RedirectURI)
+	form.Set("code_verifier", authReq.CodeVerifier)
+	form.Set("client_id", authReq.ClientID)
+
+	return postTokenRequest(tokenEndpoint, form, as)
+}
+
+// issuanceClientID returns the client_id of the authorization code flow.
+func (w *Wallet) issuanceClientID() string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.IssuanceClientID == "" {
+		return DefaultIssuanceClientID
+	}
+	return w.IssuanceClientID
+}
+
+// registerAuthorization registers a pending authorization keyed by state.
+func (w *Wallet) registerAuthorization(state string) chan AuthorizationCallback {
+	ch := make(chan AuthorizationCallback, 1)
+	w.mu.Lock()
+	if w.pendingAuthorizations == nil {
+		w.pendingAuthorizations = make(map[string]chan AuthorizationCallback)
+	}
+	w.pendingAuthorizations[state] = ch
+	w.mu.Unlock()
+	return ch
+}
+
+func (w *Wallet) unregisterAuthorization(state string) {
+	w.mu.Lock()
+	delete(w.pendingAuthorizations, state)
+	w.mu.Unlock()
+}
+
+// CompleteAuthorization delivers the authorization response for the pending
+// flow identified by state. It returns false if no flow is waiting for it.
+func (w *Wallet) CompleteAuthorization(state string, cb AuthorizationCallback) bool {
+	w.mu.Lock()
+	ch, ok := w.pendingAuthorizations[state]
+	if ok {
+		delete(w.pendingAuthorizations, state)
+	}
+	w.mu.Unlock()
+	if !ok {
+		return false
+	}
+	ch <- cb
+	return true
+}
@@ -0,0 +1,325 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// defaultDeferredInterval is the polling interval used when the issuer
+	// does not send one.
+	defaultDeferredInterval = 5 * time.Second
+	// maxDeferredInterval caps the back-off between polls.
+	maxDeferredInterval = 5 * time.Minute
+)
+
+// PendingIssuance is a deferred credential issuance (OID4VCI Section 9) that
+// is waiting for the issuer. It is persisted in wallet.json so polling can
+// resume after a restart.
+type PendingIssuance struct {
+	ID                   string              `json:"id"`
+	TransactionID        string              `json:"transaction_id"`
+	Issuer               string              `json:"issuer"`
+	Format               string              `json:"format,omitempty"`
+	DeferredEndpoint     string              `json:"deferred_credential_endpoint"`
+	NotificationEndpoint string              `json:"notification_endpoint,omitempty"`
+	AccessToken          string              `json:"access_token"`
+	TokenType            string              `json:"token_type,omitempty"`          // "DPoP" for DPoP-bound access tokens
+	HolderKeys           []string            `json:"holder_keys"`                   // PEM-encoded keys the proofs were bound to
+	Encryption           *ResponseEncryption `json:"response_encryption,omitempty"` // set if responses are encrypted
+	Display              *CredentialDisplay  `json:"display,omitempty"`             // issuer display data for the credential
+	Context              *IssuanceContext    `json:"issuance_context,omitempty"`    // stored with the credential for refreshes
+	Replaces             string              `json:"replaces,omitempty"`            // ID of the credential a refresh replaces
+	Interval             int                 `json:"interval"`                      // seconds between polls
+	Attempts             int                 `json:"attempts"`
+	CreatedAt            time.Time           `json:"created_at"`
+	NextAttempt          time.Time           `json:"next_attempt"`
+	LastError            string              `json:"last_error,omitempty"`
+}
+
+// deferIssuance records a credential response that only carried a
+// transaction_id as a pending issuance.
+func (w *Wallet) deferIssuance(credResp map[string]any, txID string, state credentialRequestState) (*IssuanceResult, error) {
+	if state.DeferredEndpoint == "" {
+		return nil, fmt.Errorf("issuer deferred issuance (transaction_id %s) but its metadata has no deferred_credential_endpoint", txID)
+	}
+	holderKeys := make([]string, len(state.HolderKeys))
+	for i, key := range state.HolderKeys {
+		keyPEM, err := encodeKeyPEM(key)
+		if err != nil {
+			return nil, fmt.Errorf("encoding holder key: %w", err)
+		}
+		holderKeys[i] = string(keyPEM)
+	}
+
+	interval := responseInterval(credResp, defaultDeferredInterval)
+	now := time.Now()
+	p := PendingIssuance{
+		ID:                   uuid.New().String(),
+		TransactionID:        txID,
+		Issuer:               state.Issuer,
+		Format:               state.Format,
+		DeferredEndpoint:     state.DeferredEndpoint,
+		NotificationEndpoint: state.NotificationEndpoint,
+		AccessToken:          state.Auth.Token,
+		TokenType:            state.Auth.tokenType(),
+		HolderKeys:           holderKeys,
+		Encryption:           state.Encryption,
+		Display:              state.Display,
+		Context:              state.Context,
+		Replaces:             state.Replaces,
+		Interval:             int(interval / time.Second),
+		CreatedAt:            now,
+		NextAttempt:          now.Add(interval),
+	}
+
+	w.mu.Lock()
+	w.PendingIssuances = append(w.PendingIssuances, p)
+	w.mu.Unlock()
+
+	log.Printf("[VCI] Issuance deferred: transaction_id=%s, polling %s every %ds", txID, p.DeferredEndpoint, p.Interval)
+	return &IssuanceResult{
+		Format:    state.Format,
+		Issuer:    state.Issuer,
+		PendingID: p.ID,
+	}, nil
+}
+
+// responseInterval reads the interval (in seconds) from a deferred or
+// credential response, or returns fallback if there is none.
+func responseInterval(resp map[string]any, fallback time.Duration) time.Duration {
+	if secs, ok := resp["interval"].(float64); ok && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return fallback
+}
+
+// GetPendingIssuances returns a snapshot of pending deferred issuances.
+func (w *Wallet) GetPendingIssuances() []PendingIssuance {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	out := make([]PendingIssuance, len(w.PendingIssuances))
+	copy(out, w.PendingIssuances)
+	return out
+}
+
+func (w *Wallet) getPendingIssuance(id string) (PendingIssuance, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	for _, p := range w.PendingIssuances {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return PendingIssuance{}, false
+}
+
+// updatePendingIssuance applies fn to the pending issuance with the given ID.
+func (w *Wallet) updatePendingIssuance(id string, fn func(p *PendingIssuance)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := range w.PendingIssuances {
+		if w.PendingIssuances[i].ID == id {
+			fn(&w.PendingIssuances[i])
+			return
+		}
+	}
+}
+
+// RemovePendingIssuance removes a pending issuance by ID.
+func (w *Wallet) RemovePendingIssuance(id string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, p := range w.PendingIssuances {
+		if p.ID == id {
+			w.PendingIssuances = append(w.PendingIssuances[:i], w.PendingIssuances[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// RetryPendingIssuance polls the deferred credential endpoint once for the
+// given pending issuance. If the credential is ready, it is imported and the
+// pending entry removed. If the issuer is still processing, the returned
+// result has PendingID set and the next attempt is rescheduled.
+func (w *Wallet) RetryPendingIssuance(id string) (*IssuanceResult, error) {
+	p, ok := w.getPendingIssuance(id)
+	if !ok {
+		return nil, fmt.Errorf("pending issuance %s not found", id)
+	}
+
+	log.Printf("[VCI] Polling deferred credential endpoint %s (transaction_id=%s, attempt %d)", p.DeferredEndpoint, p.TransactionID, p.Attempts+1)
+	auth, err := w.storedAccessTokenAuth(p.AccessToken, p.TokenType)
+	if err != nil {
+		return nil, err
+	}
+	resp, status, err := requestDeferredCredential(p.DeferredEndpoint, auth, p.TransactionID, p.Encryption)
+	if err != nil {
+		w.reschedulePendingIssuance(id, nil, err.Error())
+		return nil, err
+	}
+
+	errCode, _ := resp["error"].(string)
+	credentials := extractCredentials(resp)
+	switch {
+	case errCode == "invalid_transaction_id":
+		w.RemovePendingIssuance(id)
+		return nil, fmt.Errorf("deferred credential error: invalid_transaction_id (pending issuance removed)")
+
+	case errCode == "issuance_pending" || (errCode == "" && len(credentials) == 0 && (status == http.StatusAccepted || resp["transaction_id"] != nil)):
+		w.reschedulePendingIssuance(id, resp, "")
+		log.Printf("[VCI] Credential not ready yet (transaction_id=%s)", p.TransactionID)
+		return &IssuanceResult{Format: p.Format, Issuer: p.Issuer, PendingID: id}, nil
+
+	case errCode != "":
+		desc, _ := resp["error_description"].(string)
+		err := fmt.Errorf("deferred credential error: %s: %s", errCode, desc)
+		w.reschedulePendingIssuance(id, resp, err.Error())
+		return nil, err
+
+	case len(credentials) == 0:
+		w.reschedulePendingIssuance(id, resp, "no credential in deferred response")
+		return nil, fmt.Errorf("no credential in deferred response")
+	}
+
+	holderKeys := make([]crypto.Signer, len(p.HolderKeys))
+	for i, keyPEM := range p.HolderKeys {
+		key, err := parsePEMKey([]byte(keyPEM), "pending holder")
+		if err != nil {
+			return nil, err
+		}
+		holderKeys[i] = key
+	}
+
+	imported, err := w.importIssuedCredentials(credentials, holderKeys, issuedCredentialInfo{
+		Notification: responseNotification(resp, p.NotificationEndpoint, auth),
+		Display:      p.Display,
+		Context:      p.Context,
+		Replaces:     p.Replaces,
+	})
+	if err != nil {
+		w.reschedulePendingIssuance(id, resp, err.Error())
+		return nil, fmt.Errorf("importing deferred credential: %w", err)
+	}
+	w.RemovePendingIssuance(id)
+	log.Printf("[VCI] Deferred credential received (transaction_id=%s)", p.TransactionID)
+
+	credFormat := p.Format
+	if credFormat == "" {
+		credFormat = imported.Format
+	}
+	return &IssuanceResult{
+		CredentialID: imported.ID,
+		Format:       credFormat,
+		Issuer:       p.Issuer,
+		Instances:    len(imported.Instances),
+	}, nil
+}
+
+// reschedulePendingIssuance records a polling attempt. The issuer's interval
+// is used when present; otherwise the previous interval is doubled.
+func (w *Wallet) reschedulePendingIssuance(id string, resp map[string]any, lastError string) {
+	w.updatePendingIssuance(id, func(p *PendingIssuance) {
+		prev := time.Duration(p.Interval) * time.Second
+		if prev <= 0 {
+			prev = defaultDeferredInterval
+		}
+		next := responseInterval(resp, 0)
+		if next == 0 {
+			next = min(prev*2, maxDeferredInterval)
+		}
+		p.Attempts++
+		p.Interval = int(next / time.Second)
+		p.NextAttempt = time.Now().Add(next)
+		p.LastError = lastError
+	})
+}
+
+// PollDueIssuances retries every pending issuance whose next attempt is due
+// and returns the results of the attempts that completed or still wait.
+func (w *Wallet) PollDueIssuances() []*IssuanceResult {
+	now := time.Now()
+	var results []*IssuanceResult
+	for _, p := range w.GetPendingIssuances() {
+		if p.NextAttempt.After(now) {
+			continue
+		}
+		result, err := w.RetryPendingIssuance(p.ID)
+		if err != nil {
+			log.Printf("[VCI] Deferred issuance %s: %v", p.ID, err)
+			results = append(results, &IssuanceResult{Issuer: p.Issuer, PendingID: p.ID, Error: err.Error()})
+			continue
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// requestDeferredCredential sends a deferred credential request and returns
+// the parsed response body with its HTTP status.
+func requestDeferredCredential(endpoint string, auth accessTokenAuth, transactionID string, enc *ResponseEncryption) (map[string]any, int, error) {
+	reqBody := map[string]any{"transaction_id": transactionID}
+	var encKey *ecdsa.PrivateKey
+	if enc != nil {
+		var err error
+		if encKey, err = enc.addTo(reqBody); err != nil {
+			return nil, 0, err
+		}
+	}
+	bodyJSON, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, 0, fmt.Errorf("marshaling request: %w", err)
+	}
+
+	newReq := func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", endpoint, strings.NewReader(string(bodyJSON)))
+		if err != nil {
+			return nil, fmt.Errorf("creating deferred credential request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", auth.tokenType()+" "+auth.Token)
+		if encKey != nil {
+			setDebugKey(req, encKey)
+		}
+		return req, nil
+	}
+
+	resp, body, err := sendIssuanceRequest(newReq, auth.DPoP, nil, auth.Token)
+	if err != nil {
+		return nil, 0, fmt.Errorf("deferred credential request: %w", err)
+	}
+	if encKey != nil {
+		if body, err = decryptIssuanceResponse(resp, body, encKey); err != nil {
+			return nil, resp.StatusCode, err
+		}
+	}
+
+	var deferredResp map[string]any
+	if err := json.Unmarshal(body, &deferredResp); err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("parsing deferred credential response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	return deferredResp, resp.StatusCode, nil
+}
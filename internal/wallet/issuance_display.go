@@ -0,0 +1,395 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/jsonutil"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
+)
+
+// SignedMetadataSelfSigned is the SignedMetadata value of a credential whose
+// issuer metadata came with a signed_metadata JWT that verifies with the key
+// of its own x5c or jwk header. The key is not checked against a trust
+// anchor, so the signature does not establish who signed the metadata.
+const SignedMetadataSelfSigned = "self-signed"
+
+// CredentialDisplay is how the issuer wants a credential to be shown, taken
+// from the issuer metadata at issuance time for the wallet's locale.
+type CredentialDisplay struct {
+	Locale          string            `json:"locale,omitempty"`
+	Name            string            `json:"name,omitempty"`
+	Description     string            `json:"description,omitempty"`
+	LogoURI         string            `json:"logo_uri,omitempty"`
+	LogoAltText     string            `json:"logo_alt_text,omitempty"`
+	BackgroundColor string            `json:"background_color,omitempty"`
+	BackgroundImage string            `json:"background_image,omitempty"`
+	TextColor       string            `json:"text_color,omitempty"`
+	IssuerName      string            `json:"issuer_name,omitempty"`
+	IssuerLogoURI   string            `json:"issuer_logo_uri,omitempty"`
+	ClaimLabels     map[string]string `json:"claim_labels,omitempty"`    // claim key (see claimKey) → label
+	SignedMetadata  string            `json:"signed_metadata,omitempty"` // "self-signed", or why signed_metadata was rejected
+	Issues          []string          `json:"issues,omitempty"`          // problems found in the display metadata
+}
+
+// jwtRegisteredClaims are the claims of a signed_metadata JWT that are not
+// metadata parameters.
+var jwtRegisteredClaims = []string{"iss", "sub", "aud", "iat", "exp", "nbf", "jti"}
+
+// applySignedMetadata verifies the signed_metadata JWT of credential issuer
+// metadata and returns the metadata with the signed values taking precedence
+// over the plain ones. The returned status is "" without signed_metadata,
+// SignedMetadataSelfSigned, or the reason verification failed. Strict mode
+// rejects invalid signed metadata; debug mode falls back to the plain values.
+func (w *Wallet) applySignedMetadata(metadata map[string]any, issuer string) (map[string]any, string, error) {
+	raw, _ := metadata["signed_metadata"].(string)
+	if raw == "" {
+		return metadata, "", nil
+	}
+
+	claims, err := verifySignedMetadata(raw, issuer)
+	if err != nil {
+		w.mu.RLock()
+		mode := w.ValidationMode
+		w.mu.RUnlock()
+		if mode == ValidationModeStrict {
+			return nil, "", fmt.Errorf("signed_metadata: %w", err)
+		}
+		log.Printf("[VCI] Warning: signed_metadata rejected: %v; using unsigned metadata", err)
+		return metadata, err.Error(), nil
+	}
+
+	merged := make(map[string]any, len(metadata)+len(claims))
+	for k, v := range metadata {
+		merged[k] = v
+	}
+	for k, v := range claims {
+		merged[k] = v
+	}
+	delete(merged, "signed_metadata")
+	log.Printf("[VCI] signed_metadata signature valid (iss %v); self-signed, its key is not checked against a trust anchor", claims["iss"])
+	return merged, SignedMetadataSelfSigned, nil
+}
+
+// verifySignedMetadata checks a signed_metadata JWT: the signature against
+// the key in its x5c or jwk header, and the iss, sub, iat and exp claims.
+// An x5c chain is checked for consistency but not against a trust anchor.
+// It returns the metadata parameters of the JWT.
+func verifySignedMetadata(raw, issuer string) (map[string]any, error) {
+	header, payload, _, err := format.ParseJWTParts(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing JWT: %w", err)
+	}
+	alg := jsonutil.GetString(header, "alg")
+	if alg == "" || alg == "none" {
+		return nil, fmt.Errorf("unsigned JWT (alg %q)", alg)
+	}
+
+	pubKey, err := signedMetadataKey(header)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(raw, ".")
+	sig, err := format.DecodeBase64URL(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("decoding signature: %w", err)
+	}
+	if err := keys.VerifyJWS(pubKey, keys.Algorithm(alg), []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, fmt.Errorf("signature: %w", err)
+	}
+
+	if jsonutil.GetString(payload, "iss") == "" {
+		return nil, fmt.Errorf("missing iss claim")
+	}
+	if sub := jsonutil.GetString(payload, "sub"); strings.TrimRight(sub, "/") != strings.TrimRight(issuer, "/") {
+		return nil, fmt.Errorf("sub %q does not match credential issuer %q", sub, issuer)
+	}
+	if _, ok := payload["iat"].(float64); !ok {
+		return nil, fmt.Errorf("missing iat claim")
+	}
+	if exp, ok := payload["exp"].(float64); ok && time.Unix(int64(exp), 0).Before(time.Now()) {
+		return nil, fmt.Errorf("expired at %s", time.Unix(int64(exp), 0).Format(time.RFC3339))
+	}
+	if _, ok := payload["signed_metadata"]; ok {
+		return nil, fmt.Errorf("signed_metadata must not appear as a claim")
+	}
+
+	for _, c := range jwtRegisteredClaims {
+		delete(payload, c)
+	}
+	return payload, nil
+}
+
+// signedMetadataKey returns the public key of a signed_metadata JWT from its
+// x5c or jwk header.
+func signedMetadataKey(header map[string]any) (crypto.PublicKey, error) {
+	if x5c := jsonutil.GetArray(header, "x5c"); len(x5c) > 0 {
+		certs := make([]*x509.Certificate, 0, len(x5c))
+		for i, entry := range x5c {
+			b64, _ := entry.(string)
+			der, err := format.DecodeBase64Std(b64)
+			if err != nil {
+				return nil, fmt.Errorf("decoding x5c[%d]: %w", i, err)
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, fmt.Errorf("parsing x5c[%d]: %w", i, err)
+			}
+			certs = append(certs, cert)
+		}
+		if warning := verifySuppliedX5CChain(certs); warning != "" {
+			return nil, fmt.Errorf("x5c chain is not internally consistent")
+		}
+		return certs[0].PublicKey, nil
+	}
+	if jwk := jsonutil.GetMap(header, "jwk"); jwk != nil {
+		jwkJSON, _ := json.Marshal(jwk)
+		return keys.ParseJWK(jwkJSON)
+	}
+	return nil, fmt.Errorf("no x5c or jwk header to verify the signature")
+}
+
+// resolveCredentialDisplay picks the issuer and credential display entries
+// for locale from the issuer metadata and records problems a wallet would
+// stumble over. Credential display data is read from
+// credential_metadata.display (OID4VCI 1.0) or, for older issuers, from the
+// configuration's display. It returns nil if the issuer provides no display
+// data.
+func resolveCredentialDisplay(metadata map[string]any, configID, credFormat, locale, signedStatus string) *CredentialDisplay {
+	d := &CredentialDisplay{}
+	if signedStatus != "" {
+		d.SignedMetadata = signedStatus
+		if signedStatus != SignedMetadataSelfSigned {
+			d.Issues = append(d.Issues, "signed_metadata rejected: "+signedStatus)
+		}
+	}
+
+	if entry := d.pickDisplay("issuer display", jsonutil.GetArray(metadata, "display"), locale); entry != nil {
+		d.IssuerName = jsonutil.GetString(entry, "name")
+		if logo := jsonutil.GetMap(entry, "logo"); logo != nil {
+			d.IssuerLogoURI = jsonutil.GetString(logo, "uri")
+			d.checkURI("issuer logo", d.IssuerLogoURI)
+		}
+	}
+
+	cfg := jsonutil.GetMap(jsonutil.GetMap(metadata, "credential_configurations_supported"), configID)
+	credMeta := jsonutil.GetMap(cfg, "credential_metadata")
+	if credMeta == nil {
+		credMeta = cfg
+	}
+
+	if entry := d.pickDisplay("credential display", jsonutil.GetArray(credMeta, "display"), locale); entry != nil {
+		d.Locale = jsonutil.GetString(entry, "locale")
+		d.Name = jsonutil.GetString(entry, "name")
+		if d.Name == "" {
+			d.Issues = append(d.Issues, "credential display has no name")
+		}
+		d.Description = jsonutil.GetString(entry, "description")
+		if logo := jsonutil.GetMap(entry, "logo"); logo != nil {
+			d.LogoURI = jsonutil.GetString(logo, "uri")
+			d.LogoAltText = jsonutil.GetString(logo, "alt_text")
+			d.checkURI("credential logo", d.LogoURI)
+		}
+		if bg := jsonutil.GetMap(entry, "background_image"); bg != nil {
+			d.BackgroundImage = jsonutil.GetString(bg, "uri")
+			d.checkURI("background image", d.BackgroundImage)
+		}
+		d.BackgroundColor = d.checkColor("background_color", jsonutil.GetString(entry, "background_color"))
+		d.TextColor = d.checkColor("text_color", jsonutil.GetString(entry, "text_color"))
+	}
+
+	for i, c := range jsonutil.GetArray(credMeta, "claims") {
+		claim, _ := c.(map[string]any)
+		path := jsonutil.GetArray(claim, "path")
+		if len(path) == 0 {
+			d.Issues = append(d.Issues, fmt.Sprintf("claims[%d] has no path", i))
+			continue
+		}
+		key := claimKey(path, credFormat)
+		entry := d.pickDisplay("display of claim "+key, jsonutil.GetArray(claim, "display"), locale)
+		if entry == nil {
+			continue
+		}
+		label := jsonutil.GetString(entry, "name")
+		if label == "" {
+			d.Issues = append(d.Issues, fmt.Sprintf("display of claim %s has no name", key))
+			continue
+		}
+		if d.ClaimLabels == nil {
+			d.ClaimLabels = make(map[string]string)
+		}
+		d.ClaimLabels[key] = label
+	}
+
+	if d.Name == "" && d.IssuerName == "" && len(d.ClaimLabels) == 0 && d.SignedMetadata == "" && len(d.Issues) == 0 {
+		return nil
+	}
+	for _, issue := range d.Issues {
+		log.Printf("[VCI] Warning: issuer metadata: %s", issue)
+	}
+	return d
+}
+
+// pickDisplay returns the display entry for locale: an exact match, then a
+// match of the language, then the first entry. Entries with duplicate or
+// missing locales are recorded as issues when there is more than one.
+func (d *CredentialDisplay) pickDisplay(what string, entries []any, locale string) map[string]any {
+	var list []map[string]any
+	for _, e := range entries {
+		if m, ok := e.(map[string]any); ok {
+			list = append(list, m)
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+
+	if len(list) > 1 {
+		seen := make(map[string]bool)
+		for _, m := range list {
+			l := strings.ToLower(jsonutil.GetString(m, "locale"))
+			if l == "" {
+				d.Issues = append(d.Issues, what+" has several entries, but not all have a locale")
+				break
+			}
+			if seen[l] {
+				d.Issues = append(d.Issues, fmt.Sprintf("%s has duplicate locale %q", what, l))
+				break
+			}
+			seen[l] = true
+		}
+	}
+
+	locale = strings.ToLower(locale)
+	if locale != "" {
+		lang, _, _ := strings.Cut(locale, "-")
+		var langMatch map[string]any
+		for _, m := range list {
+			l := strings.ToLower(jsonutil.GetString(m, "locale"))
+			if l == locale {
+				return m
+			}
+			if entryLang, _, _ := strings.Cut(l, "-"); langMatch == nil && entryLang == lang {
+				langMatch = m
+			}
+		}
+		if langMatch != nil {
+			return langMatch
+		}
+	}
+	return list[0]
+}
+
+// cssNumericColor matches the numerical CSS color values OID4VCI requires
+// for background_color and text_color.
+var cssNumericColor = regexp.MustCompile(`^(#([0-9a-fA-F]{3,4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})|(rgb|rgba|hsl|hsla|hwb|lab|lch|oklab|oklch)\([^()]*\))$`)
+
+// checkColor returns color if it is a numerical CSS color, otherwise it
+// records an issue and returns "" so the UI falls back to its own colors.
+func (d *CredentialDisplay) checkColor(name, color string) string {
+	if color == "" {
+		return ""
+	}
+	if !cssNumericColor.MatchString(strings.TrimSpace(color)) {
+		d.Issues = append(d.Issues, fmt.Sprintf("%s %q is not a numerical CSS color", name, color))
+		return ""
+	}
+	return strings.TrimSpace(color)
+}
+
+// checkURI records an issue for a missing or non-https image URI. data: URIs
+// are accepted.
+func (d *CredentialDisplay) checkURI(what, uri string) {
+	switch {
+	case uri == "":
+		d.Issues = append(d.Issues, what+" has no uri")
+	case !strings.HasPrefix(uri, "https://") && !strings.HasPrefix(uri, "data:"):
+		d.Issues = append(d.Issues, fmt.Sprintf("%s uri %q is not https", what, uri))
+	}
+}
+
+// checkClaims records claims with display data that the issued credential
+// does not contain.
+func (d *CredentialDisplay) checkClaims(cred *StoredCredential) {
+	for key := range d.ClaimLabels {
+		if !hasClaim(cred, key) {
+			issue := fmt.Sprintf("claim %s has display data but is not in the credential", key)
+			log.Printf("[VCI] Warning: issuer metadata: %s", issue)
+			d.Issues = append(d.Issues, issue)
+		}
+	}
+}
+
+// claimKey turns a claims path pointer into the key used in ClaimLabels:
+// "namespace:element" for mDoc, otherwise the path elements joined with "."
+// with "*" for array wildcards.
+func claimKey(path []any, credFormat string) string {
+	elems := make([]string, len(path))
+	for i, p := range path {
+		switch v := p.(type) {
+		case string:
+			elems[i] = v
+		case float64:
+			elems[i] = strconv.Itoa(int(v))
+		default:
+			elems[i] = "*"
+		}
+	}
+	if credFormat == "mso_mdoc" && len(elems) == 2 {
+		return elems[0] + ":" + elems[1]
+	}
+	return strings.Join(elems, ".")
+}
+
+// hasClaim reports whether a credential contains the claim at key. A "*"
+// matches any non-empty array.
+func hasClaim(cred *StoredCredential, key string) bool {
+	if _, ok := cred.Claims[key]; ok {
+		return true
+	}
+	var cur any = cred.Claims
+	for _, elem := range strings.Split(key, ".") {
+		switch v := cur.(type) {
+		case map[string]any:
+			next, ok := v[elem]
+			if !ok {
+				return false
+			}
+			cur = next
+		case []any:
+			if elem == "*" {
+				return len(v) > 0
+			}
+			i, err := strconv.Atoi(elem)
+			if err != nil || i < 0 || i >= len(v) {
+				return false
+			}
+			cur = v[i]
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,266 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
+)
+
+// displayMetadata returns issuer metadata with English and German display
+// data for test-config.
+func displayMetadata() map[string]any {
+	return map[string]any{
+		"display": []any{
+			map[string]any{"name": "Test Issuer", "locale": "en", "logo": map[string]any{"uri": "https://issuer.example/logo.png"}},
+			map[string]any{"name": "Test-Aussteller", "locale": "de"},
+		},
+		"credential_configurations_supported": map[string]any{
+			"test-config": map[string]any{
+				"format": "dc+sd-jwt",
+				"credential_metadata": map[string]any{
+					"display": []any{
+						map[string]any{"name": "Test Credential", "locale": "en-US", "background_color": "#12107c", "text_color": "white"},
+						map[string]any{"name": "Testnachweis", "locale": "de-DE", "logo": map[string]any{"uri": "http://issuer.example/logo.png"}},
+					},
+					"claims": []any{
+						map[string]any{"path": []any{"given_name"}, "display": []any{
+							map[string]any{"name": "Given Name", "locale": "en"},
+							map[string]any{"name": "Vorname", "locale": "de"},
+						}},
+						map[string]any{"path": []any{"address", "street_address"}, "display": []any{map[string]any{"name": "Street"}}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestResolveCredentialDisplay(t *testing.T) {
+	t.Run("default locale", func(t *testing.T) {
+		d := resolveCredentialDisplay(displayMetadata(), "test-config", "dc+sd-jwt", "", "")
+		if d.Name != "Test Credential" || d.IssuerName != "Test Issuer" || d.IssuerLogoURI != "https://issuer.example/logo.png" {
+			t.Errorf("unexpected display: %+v", d)
+		}
+		if d.BackgroundColor != "#12107c" || d.TextColor != "" {
+			t.Errorf("colors = %q/%q, want #12107c and no text color", d.BackgroundColor, d.TextColor)
+		}
+		if d.ClaimLabels["given_name"] != "Given Name" || d.ClaimLabels["address.street_address"] != "Street" {
+			t.Errorf("claim labels = %v", d.ClaimLabels)
+		}
+		if !containsIssue(d.Issues, "text_color") {
+			t.Errorf("expected issue for non-numerical text_color, got %v", d.Issues)
+		}
+	})
+
+	t.Run("language match", func(t *testing.T) {
+		d := resolveCredentialDisplay(displayMetadata(), "test-config", "dc+sd-jwt", "de-AT", "")
+		if d.Name != "Testnachweis" || d.IssuerName != "Test-Aussteller" || d.ClaimLabels["given_name"] != "Vorname" {
+			t.Errorf("unexpected display for de-AT: %+v", d)
+		}
+		if !containsIssue(d.Issues, "not https") {
+			t.Errorf("expected issue for http logo, got %v", d.Issues)
+		}
+	})
+
+	t.Run("legacy configuration display", func(t *testing.T) {
+		meta := map[string]any{"credential_configurations_supported": map[string]any{
+			"pid": map[string]any{
+				"display": []any{map[string]any{"name": "PID"}},
+				"claims": []any{
+					map[string]any{"path": []any{"eu.europa.ec.eudi.pid.1", "family_name"}, "display": []any{map[string]any{"name": "Family Name"}}},
+				},
+			},
+		}}
+		d := resolveCredentialDisplay(meta, "pid", "mso_mdoc", "", "")
+		if d.Name != "PID" || d.ClaimLabels["eu.europa.ec.eudi.pid.1:family_name"] != "Family Name" {
+			t.Errorf("unexpected display: %+v", d)
+		}
+	})
+
+	t.Run("duplicate locales", func(t *testing.T) {
+		meta := map[string]any{"display": []any{
+			map[string]any{"name": "A", "locale": "en"},
+			map[string]any{"name": "B", "locale": "EN"},
+		}}
+		d := resolveCredentialDisplay(meta, "missing", "dc+sd-jwt", "", "")
+		if d.IssuerName != "A" || !containsIssue(d.Issues, "duplicate locale") {
+			t.Errorf("unexpected display: %+v", d)
+		}
+	})
+
+	t.Run("no display data", func(t *testing.T) {
+		if d := resolveCredentialDisplay(map[string]any{}, "test-config", "dc+sd-jwt", "", ""); d != nil {
+			t.Errorf("expected nil, got %+v", d)
+		}
+	})
+}
+
+func containsIssue(issues []string, substr string) bool {
+	for _, issue := range issues {
+		if strings.Contains(issue, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// signMetadata returns a signed_metadata JWT over claims, with the key in a
+// jwk or x5c header.
+func signMetadata(t *testing.T, claims map[string]any, useX5C bool) string {
+	t.Helper()
+	key, err := mock.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := map[string]any{"alg": "ES256", "typ": "JWT"}
+	if useX5C {
+		caKey, _ := mock.GenerateKey()
+		caCert, err := mock.GenerateCACert(caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := mock.GenerateLeafCert(caKey, caCert, &key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header["x5c"] = []any{
+			base64.StdEncoding.EncodeToString(leaf.Raw),
+			base64.StdEncoding.EncodeToString(caCert.Raw),
+		}
+	} else {
+		jwk := map[string]any{}
+		for k, v := range mock.PublicKeyJWKMap(&key.PublicKey) {
+			jwk[k] = v
+		}
+		header["jwk"] = jwk
+	}
+	jwt, err := signJWT(header, claims, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jwt
+}
+
+func TestVerifySignedMetadata(t *testing.T) {
+	const issuer = "https://issuer.example"
+	claims := func(mod func(map[string]any)) map[string]any {
+		c := map[string]any{
+			"iss":     "https://trust.example",
+			"sub":     issuer,
+			"iat":     float64(time.Now().Unix()),
+			"display": []any{map[string]any{"name": "Signed Issuer"}},
+		}
+		if mod != nil {
+			mod(c)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		jwt     string
+		wantErr string
+	}{
+		{"jwk", signMetadata(t, claims(nil), false), ""},
+		{"x5c", signMetadata(t, claims(nil), true), ""},
+		{"wrong sub", signMetadata(t, claims(func(c map[string]any) { c["sub"] = "https://other.example" }), false), "does not match"},
+		{"missing iat", signMetadata(t, claims(func(c map[string]any) { delete(c, "iat") }), false), "iat"},
+		{"expired", signMetadata(t, claims(func(c map[string]any) { c["exp"] = float64(time.Now().Add(-time.Hour).Unix()) }), false), "expired"},
+		{"bad signature", corruptJWTSignature(signMetadata(t, claims(nil), false)), "signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifySignedMetadata(tt.jwt, issuer+"/")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifySignedMetadata: %v", err)
+			}
+			if _, ok := got["iss"]; ok {
+				t.Error("registered claims must not be returned as metadata")
+			}
+			if got["display"] == nil {
+				t.Error("expected display from signed metadata")
+			}
+		})
+	}
+}
+
+func TestApplySignedMetadata(t *testing.T) {
+	const issuer = "https://issuer.example"
+	signed := signMetadata(t, map[string]any{
+		"iss":     issuer,
+		"sub":     "https://other.example",
+		"iat":     float64(time.Now().Unix()),
+		"display": []any{map[string]any{"name": "Signed Issuer"}},
+	}, false)
+	metadata := map[string]any{"signed_metadata": signed, "display": []any{map[string]any{"name": "Plain Issuer"}}}
+
+	w := &Wallet{ValidationMode: ValidationModeDebug}
+	got, status, err := w.applySignedMetadata(metadata, issuer)
+	if err != nil {
+		t.Fatalf("debug mode: %v", err)
+	}
+	if status == "" || status == SignedMetadataSelfSigned || got["signed_metadata"] == nil {
+		t.Errorf("expected rejected signed_metadata with unsigned fallback, got status %q", status)
+	}
+
+	w.ValidationMode = ValidationModeStrict
+	if _, _, err := w.applySignedMetadata(metadata, issuer); err == nil {
+		t.Error("expected strict mode to reject invalid signed_metadata")
+	}
+}
+
+func TestProcessCredentialOffer_DisplayMetadata(t *testing.T) {
+	w := generateTestWallet(t)
+	w.Locale = "de"
+
+	srv, offerURI := setupMockIssuer(t, w, mockIssuerOpts{
+		tokenCNonce:    "test-c-nonce",
+		issuerMetadata: displayMetadata(),
+	})
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	result, err := w.ProcessCredentialOffer(offerURI)
+	if err != nil {
+		t.Fatalf("ProcessCredentialOffer: %v", err)
+	}
+	cred, ok := w.GetCredential(result.CredentialID)
+	if !ok || cred.Display == nil {
+		t.Fatalf("expected stored credential with display data, got %+v", cred)
+	}
+	if cred.Display.Name != "Testnachweis" || cred.Display.ClaimLabels["given_name"] != "Vorname" {
+		t.Errorf("unexpected display: %+v", cred.Display)
+	}
+	if !containsIssue(cred.Display.Issues, "address.street_address") {
+		t.Errorf("expected issue for labelled claim missing from the credential, got %v", cred.Display.Issues)
+	}
+	if summary := CredentialSummary(cred); summary["display"] == nil {
+		t.Error("expected display in credential summary")
+	}
+}
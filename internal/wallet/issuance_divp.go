@@ -0,0 +1,256 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/did"
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
+)
+
+// diVPCryptosuite returns the Data Integrity cryptosuite of di_vp proofs
+// signed with alg, or "" if there is none: ecdsa-jcs-2019 for P-256 and P-384
+// keys, eddsa-jcs-2022 for Ed25519 keys. The JCS variants sign the JSON
+// canonicalization of the presentation, so no JSON-LD processing is needed.
+func diVPCryptosuite(alg keys.Algorithm) string {
+	switch alg {
+	case keys.ES256, keys.ES384:
+		return "ecdsa-jcs-2019"
+	case keys.EdDSA:
+		return "eddsa-jcs-2022"
+	default:
+		return ""
+	}
+}
+
+// createDIVPProofs creates one di_vp proof per holder key.
+func createDIVPProofs(holderKeys []crypto.Signer, audience, cNonce string) ([]any, error) {
+	proofs := make([]any, len(holderKeys))
+	for i, key := range holderKeys {
+		vp, err := createDIVPProof(key, audience, cNonce)
+		if err != nil {
+			return nil, err
+		}
+		proofs[i] = vp
+	}
+	return proofs, nil
+}
+
+// createDIVPProof builds a di_vp proof (OID4VCI 1.0 Appendix F.2): a W3C
+// Verifiable Presentation whose holder is the did:key of the holder key,
+// secured with a Data Integrity proof for the authentication purpose. The
+// proof's domain is the credential issuer and its challenge the c_nonce.
+func createDIVPProof(holderKey crypto.Signer, audience, cNonce string) (map[string]any, error) {
+	alg, err := keys.AlgorithmFor(holderKey.Public(), "")
+	if err != nil {
+		return nil, err
+	}
+	cryptosuite := diVPCryptosuite(alg)
+	if cryptosuite == "" {
+		return nil, fmt.Errorf("di_vp proofs need a P-256, P-384 or Ed25519 holder key, not %s", alg)
+	}
+	holderDID, err := did.KeyDID(holderKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	vp := map[string]any{
+		"@context": []any{"https://www.w3.org/ns/credentials/v2"},
+		"type":     []any{"VerifiablePresentation"},
+		"holder":   holderDID,
+	}
+	proof := map[string]any{
+		"@context":           vp["@context"],
+		"type":               "DataIntegrityProof",
+		"cryptosuite":        cryptosuite,
+		"proofPurpose":       "authentication",
+		"verificationMethod": holderDID + "#" + strings.TrimPrefix(holderDID, "did:key:"),
+		"created":            time.Now().UTC().Format(time.RFC3339),
+		"domain":             audience,
+	}
+	if cNonce != "" {
+		proof["challenge"] = cNonce
+	}
+
+	hashData, err := dataIntegrityHashData(vp, proof, alg)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := keys.SignJWS(holderKey, alg, hashData)
+	if err != nil {
+		return nil, fmt.Errorf("signing di_vp proof: %w", err)
+	}
+
+	proof["proofValue"] = "z" + format.EncodeBase58(sig)
+	vp["proof"] = proof
+	return vp, nil
+}
+
+// dataIntegrityHashData returns the data the JCS cryptosuites sign: the hash
+// of the canonical proof configuration followed by the hash of the canonical
+// document, with SHA-384 for P-384 keys and SHA-256 otherwise. ECDSA hashes
+// it again as ES256 and ES384 do, Ed25519 signs it as is.
+func dataIntegrityHashData(document, proofConfig map[string]any, alg keys.Algorithm) ([]byte, error) {
+	canonicalConfig, err := canonicalJSON(proofConfig)
+	if err != nil {
+		return nil, fmt.Errorf("canonicalizing proof configuration: %w", err)
+	}
+	canonicalDoc, err := canonicalJSON(document)
+	if err != nil {
+		return nil, fmt.Errorf("canonicalizing document: %w", err)
+	}
+	if alg == keys.ES384 {
+		configHash := sha512.Sum384(canonicalConfig)
+		docHash := sha512.Sum384(canonicalDoc)
+		return append(configHash[:], docHash[:]...), nil
+	}
+	configHash := sha256.Sum256(canonicalConfig)
+	docHash := sha256.Sum256(canonicalDoc)
+	return append(configHash[:], docHash[:]...), nil
+}
+
+// canonicalJSON serializes a decoded JSON value with the JSON
+// Canonicalization Scheme (RFC 8785): object members sorted by their UTF-16
+// code units, no insignificant whitespace, and ECMAScript number formatting.
+func canonicalJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeCanonicalJSON(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeCanonicalJSON(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case string:
+		writeCanonicalString(buf, v)
+	case float64:
+		s, err := canonicalNumber(v)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(s)
+	case int:
+		buf.WriteString(strconv.Itoa(v))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case []any:
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonicalJSON(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case []string:
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, e)
+		}
+		buf.WriteByte(']')
+	case map[string]any:
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		slices.SortFunc(names, func(a, b string) int {
+			return slices.Compare(utf16.Encode([]rune(a)), utf16.Encode([]rune(b)))
+		})
+		buf.WriteByte('{')
+		for i, name := range names {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, name)
+			buf.WriteByte(':')
+			if err := writeCanonicalJSON(buf, v[name]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unsupported JSON value of type %T", v)
+	}
+	return nil
+}
+
+// writeCanonicalString writes a JSON string, escaping only what RFC 8785
+// requires.
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// canonicalNumber formats a number like ECMAScript's Number.prototype.toString.
+func canonicalNumber(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("number %v cannot be represented in JSON", f)
+	}
+	if f == 0 {
+		return "0", nil
+	}
+	if abs := math.Abs(f); abs >= 1e21 || abs < 1e-6 {
+		s := strconv.FormatFloat(f, 'e', -1, 64)
+		mantissa, exp, _ := strings.Cut(s, "e")
+		sign, digits := exp[:1], strings.TrimLeft(exp[1:], "0")
+		return mantissa + "e" + sign + digits, nil
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64), nil
+}
@@ -0,0 +1,276 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/did"
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	v := map[string]any{
+		"b": []any{1e21, 1e-7, 0.5, float64(-0), float64(100)},
+		"a": "€\n\"\u0001",
+		"é": true,
+		"Z": nil,
+	}
+	got, err := canonicalJSON(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"Z":null,"a":"€\n\"\u0001","b":[1e+21,1e-7,0.5,0,100],"é":true}`
+	if string(got) != want {
+		t.Errorf("canonicalJSON() = %s, want %s", got, want)
+	}
+}
+
+// decodeDIDKey returns the P-256 public key of a did:key.
+func decodeDIDKey(t *testing.T, didValue string) *ecdsa.PublicKey {
+	t.Helper()
+	doc, err := did.Resolve(didValue, nil)
+	if err != nil {
+		t.Fatalf("resolving %s: %v", didValue, err)
+	}
+	pub, err := doc.VerificationMethod[0].PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok || key.Curve != elliptic.P256() {
+		t.Fatalf("did:key is not a P-256 key: %T", pub)
+	}
+	return key
+}
+
+// verifyDIVPProof checks a di_vp proof the way an issuer would and returns
+// the holder key.
+func verifyDIVPProof(t *testing.T, vp map[string]any, audience, nonce string) *ecdsa.PublicKey {
+	t.Helper()
+	proof, _ := vp["proof"].(map[string]any)
+	if proof == nil {
+		t.Fatal("presentation has no proof")
+	}
+	if types, _ := vp["type"].([]any); len(types) != 1 || types[0] != "VerifiablePresentation" {
+		t.Errorf("type = %v", vp["type"])
+	}
+	if proof["type"] != "DataIntegrityProof" || proof["cryptosuite"] != diVPCryptosuite(keys.ES256) || proof["proofPurpose"] != "authentication" {
+		t.Errorf("unexpected proof: %v", proof)
+	}
+	if proof["domain"] != audience {
+		t.Errorf("domain = %v, want %s", proof["domain"], audience)
+	}
+	if proof["challenge"] != nonce {
+		t.Errorf("challenge = %v, want %s", proof["challenge"], nonce)
+	}
+	holder, _ := vp["holder"].(string)
+	method, _ := proof["verificationMethod"].(string)
+	holderDID, fragment, _ := strings.Cut(method, "#")
+	if holderDID != holder || "did:key:"+fragment != holderDID {
+		t.Errorf("verificationMethod %s does not match holder %s", method, holder)
+	}
+	pub := decodeDIDKey(t, holderDID)
+
+	config := make(map[string]any, len(proof))
+	for k, v := range proof {
+		if k != "proofValue" {
+			config[k] = v
+		}
+	}
+	doc := make(map[string]any, len(vp))
+	for k, v := range vp {
+		if k != "proof" {
+			doc[k] = v
+		}
+	}
+	hashData, err := dataIntegrityHashData(doc, config, keys.ES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, _ := proof["proofValue"].(string)
+	sig, err := format.DecodeBase58(strings.TrimPrefix(value, "z"))
+	if err != nil || !strings.HasPrefix(value, "z") || len(sig) != 64 {
+		t.Fatalf("proofValue is not a base58btc P-256 signature: %s", value)
+	}
+	if !ecdsa.Verify(pub, sha256Sum(hashData), new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		t.Fatal("di_vp proof signature invalid")
+	}
+	return pub
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+func TestCreateDIVPProof(t *testing.T) {
+	w := generateTestWallet(t)
+	vp, err := createDIVPProof(w.HolderKey, "https://issuer.example", "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(vp["holder"].(string), "did:key:zDn") {
+		t.Errorf("holder = %v, want a P-256 did:key", vp["holder"])
+	}
+	pub := verifyDIVPProof(t, vp, "https://issuer.example", "nonce-1")
+	if !pub.Equal(w.HolderKey.Public()) {
+		t.Error("did:key does not match the holder key")
+	}
+}
+
+func TestCreateDIVPProof_Ed25519(t *testing.T) {
+	key, err := keys.GenerateKey(keys.EdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vp, err := createDIVPProof(key, "https://issuer.example", "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof := vp["proof"].(map[string]any)
+	if proof["cryptosuite"] != "eddsa-jcs-2022" {
+		t.Errorf("cryptosuite = %v, want eddsa-jcs-2022", proof["cryptosuite"])
+	}
+	if !strings.HasPrefix(vp["holder"].(string), "did:key:z6Mk") {
+		t.Errorf("holder = %v, want an Ed25519 did:key", vp["holder"])
+	}
+
+	config := make(map[string]any, len(proof))
+	for k, v := range proof {
+		if k != "proofValue" {
+			config[k] = v
+		}
+	}
+	doc := map[string]any{"@context": vp["@context"], "type": vp["type"], "holder": vp["holder"]}
+	hashData, err := dataIntegrityHashData(doc, config, keys.EdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := format.DecodeBase58(strings.TrimPrefix(proof["proofValue"].(string), "z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(key.Public().(ed25519.PublicKey), hashData, sig) {
+		t.Fatal("di_vp proof signature invalid")
+	}
+}
+
+func TestCreateDIVPProof_UnsupportedKey(t *testing.T) {
+	key, err := keys.GenerateKey(keys.RS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createDIVPProof(key, "https://issuer.example", "nonce-1"); err == nil {
+		t.Fatal("expected an error for an RSA holder key")
+	}
+}
+
+func TestProcessCredentialOffer_DIVPProofType(t *testing.T) {
+	w := generateTestWallet(t)
+
+	var issuer string
+	srv, offerURI := setupMockIssuer(t, w, mockIssuerOpts{
+		tokenCNonce: "test-c-nonce",
+		issuerMetadata: keyAttestationConfigMetadata(map[string]any{
+			"di_vp": map[string]any{"proof_signing_alg_values_supported": []any{"ecdsa-rdfc-2019", diVPCryptosuite(keys.ES256)}},
+		}),
+		credentialHandler: func(t *testing.T, reqBody map[string]any) map[string]any {
+			t.Helper()
+			proofs, _ := reqBody["proofs"].(map[string]any)
+			if _, ok := proofs["jwt"]; ok {
+				t.Error("expected no jwt proofs with the di_vp proof type")
+			}
+			vps, _ := proofs["di_vp"].([]any)
+			if len(vps) != 2 {
+				t.Fatalf("expected one di_vp proof per key, got %d", len(vps))
+			}
+			var holderKeys []*ecdsa.PublicKey
+			for _, vp := range vps {
+				holderKeys = append(holderKeys, verifyDIVPProof(t, vp.(map[string]any), issuer, "test-c-nonce"))
+			}
+			return issueForKeys(t, w, holderKeys)
+		},
+	})
+	defer srv.Close()
+	issuer = srv.URL
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	result, err := w.ProcessCredentialOffer(offerURI)
+	if err != nil {
+		t.Fatalf("ProcessCredentialOffer: %v", err)
+	}
+	if result.Instances != 2 {
+		t.Errorf("expected 2 instances, got %d", result.Instances)
+	}
+}
+
+func TestProcessCredentialOffer_ProofTypeOverride(t *testing.T) {
+	for _, mode := range []ValidationMode{ValidationModeStrict, ValidationModeDebug} {
+		t.Run(string(mode), func(t *testing.T) {
+			w := generateTestWallet(t)
+			w.ValidationMode = mode
+			w.ProofType = ProofTypeDIVP
+
+			requests := 0
+			srv, offerURI := setupMockIssuer(t, w, mockIssuerOpts{
+				tokenCNonce: "test-c-nonce",
+				issuerMetadata: keyAttestationConfigMetadata(map[string]any{
+					"jwt": map[string]any{"proof_signing_alg_values_supported": []any{"ES256"}},
+				}),
+				credentialHandler: func(t *testing.T, reqBody map[string]any) map[string]any {
+					requests++
+					proofs, _ := reqBody["proofs"].(map[string]any)
+					if _, ok := proofs["di_vp"]; !ok {
+						t.Errorf("expected the forced di_vp proofs, got %v", proofs)
+					}
+					return map[string]any{"credential": generateTestCredential(t, w)}
+				},
+			})
+			defer srv.Close()
+
+			oldClient := httpClient
+			httpClient = srv.Client()
+			defer func() { httpClient = oldClient }()
+
+			_, err := w.ProcessCredentialOffer(offerURI)
+			if mode == ValidationModeStrict {
+				if err == nil || !strings.Contains(err.Error(), "does not accept di_vp") {
+					t.Errorf("expected strict mode to reject the proof type, got %v", err)
+				}
+				if requests != 0 {
+					t.Errorf("expected no credential request, got %d", requests)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProcessCredentialOffer: %v", err)
+			}
+			if requests != 1 {
+				t.Errorf("expected 1 credential request, got %d", requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
+)
+
+// DPoPMode controls whether the wallet binds OID4VCI access tokens with DPoP
+// (RFC 9449).
+type DPoPMode string
+
+const (
+	// DPoPModeAuto uses DPoP when the authorization server advertises
+	// dpop_signing_alg_values_supported.
+	DPoPModeAuto DPoPMode = "auto"
+	// DPoPModeForce always sends DPoP proofs, even if the authorization
+	// server does not advertise support.
+	DPoPModeForce DPoPMode = "force"
+	// DPoPModeOff never sends DPoP proofs.
+	DPoPModeOff DPoPMode = "off"
+)
+
+// dpopAlg is the JWS algorithm of DPoP proofs signed with the wallet's EC P-256 key.
+const dpopAlg = "ES256"
+
+// ParseDPoPMode parses a DPoP mode string. An empty value means auto.
+func ParseDPoPMode(raw string) (DPoPMode, error) {
+	switch DPoPMode(strings.ToLower(strings.TrimSpace(raw))) {
+	case "", DPoPModeAuto:
+		return DPoPModeAuto, nil
+	case DPoPModeForce:
+		return DPoPModeForce, nil
+	case DPoPModeOff:
+		return DPoPModeOff, nil
+	default:
+		return "", fmt.Errorf("invalid DPoP mode %q (expected 'auto', 'force', or 'off')", raw)
+	}
+}
+
+// dpopSigner creates DPoP proofs for one issuance and remembers the latest
+// DPoP-Nonce of each server it talked to.
+type dpopSigner struct {
+	key    *ecdsa.PrivateKey
+	mu     sync.Mutex
+	nonces map[string]string // origin → DPoP-Nonce
+}
+
+// resolveDPoP decides whether the issuance uses DPoP, based on the wallet's
+// DPoPMode and the authorization server metadata. It returns nil for plain
+// Bearer tokens.
+func (w *Wallet) resolveDPoP(oauthMeta map[string]any) (*dpopSigner, error) {
+	w.mu.RLock()
+	mode := w.DPoPMode
+	w.mu.RUnlock()
+
+	if mode == DPoPModeOff {
+		return nil, nil
+	}
+
+	var algs []string
+	if raw, ok := oauthMeta["dpop_signing_alg_values_supported"].([]any); ok {
+		for _, a := range raw {
+			if s, ok := a.(string); ok {
+				algs = append(algs, s)
+			}
+		}
+	}
+
+	if len(algs) == 0 && mode != DPoPModeForce {
+		return nil, nil
+	}
+	if len(algs) > 0 && !slices.Contains(algs, dpopAlg) {
+		if mode == DPoPModeForce {
+			return nil, fmt.Errorf("authorization server does not support DPoP with %s (dpop_signing_alg_values_supported: %s)", dpopAlg, strings.Join(algs, ", "))
+		}
+		log.Printf("[VCI] Warning: dpop_signing_alg_values_supported %v does not include %s; continuing without DPoP", algs, dpopAlg)
+		return nil, nil
+	}
+
+	signer, err := w.newDPoPSigner()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[VCI] Using DPoP-bound access tokens (%s)", dpopAlg)
+	return signer, nil
+}
+
+// newDPoPSigner returns a signer for the wallet's DPoP key, generating an
+// in-memory key if none was loaded.
+func (w *Wallet) newDPoPSigner() (*dpopSigner, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.DPoPKey == nil {
+		key, err := mock.GenerateKey()
+		if err != nil {
+			return nil, fmt.Errorf("generating DPoP key: %w", err)
+		}
+		w.DPoPKey = key
+	}
+	return &dpopSigner{key: w.DPoPKey, nonces: make(map[string]string)}, nil
+}
+
+// proof creates a DPoP proof JWT for a request. accessToken is set for
+// requests to protected resources and is bound via the ath claim.
+func (d *dpopSigner) proof(method, target, accessToken string) (string, error) {
+	jwkJSON := mock.PublicKeyJWK(&d.key.PublicKey)
+	var jwk map[string]any
+	if err := json.Unmarshal([]byte(jwkJSON), &jwk); err != nil {
+		return "", fmt.Errorf("parsing DPoP JWK: %w", err)
+	}
+
+	header := map[string]any{
+		"alg": dpopAlg,
+		"typ": "dpop+jwt",
+		"jwk": jwk,
+	}
+
+	payload := map[string]any{
+		"jti": uuid.New().String(),
+		"htm": method,
+		"htu": dpopHTU(target),
+		"iat": time.Now().Unix(),
+	}
+	if nonce := d.nonce(target); nonce != "" {
+		payload["nonce"] = nonce
+	}
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		payload["ath"] = format.EncodeBase64URL(sum[:])
+	}
+
+	return signJWT(header, payload, d.key)
+}
+
+func (d *dpopSigner) nonce(target string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.nonces[dpopOrigin(target)]
+}
+
+// rememberNonce stores the DPoP-Nonce of a response and reports whether it
+// differs from the nonce used so far.
+func (d *dpopSigner) rememberNonce(target string, resp *http.Response) bool {
+	nonce := resp.Header.Get("DPoP-Nonce")
+	if nonce == "" {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	origin := dpopOrigin(target)
+	if d.nonces[origin] == nonce {
+		return false
+	}
+	d.nonces[origin] = nonce
+	return true
+}
+
+// dpopHTU returns the htu claim value: the request URI without query and fragment.
+func dpopHTU(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+// dpopOrigin returns the scheme and host of target. Nonces are tracked per
+// origin since the authorization server and the issuer issue their own.
+func dpopOrigin(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// isDPoPNonceChallenge reports whether a response asks the client to retry
+// with a server-provided nonce: a use_dpop_nonce error in the body (token
+// endpoint) or in the WWW-Authenticate header (protected resources).
+func isDPoPNonceChallenge(resp *http.Response, body []byte) bool {
+	if strings.Contains(resp.Header.Get("WWW-Authenticate"), "use_dpop_nonce") {
+		return true
+	}
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	return json.Unmarshal(body, &errResp) == nil && errResp.Error == "use_dpop_nonce"
+}
+
+// accessTokenAuth presents an access token to the credential issuer, either
+// as a Bearer token or DPoP-bound with a fresh proof per request.
+type accessTokenAuth struct {
+	Token string
+	DPoP  *dpopSigner // nil for Bearer tokens
+}
+
+// tokenType returns the token_type the access token is presented with.
+func (a accessTokenAuth) tokenType() string {
+	if a.DPoP != nil {
+		return "DPoP"
+	}
+	return "Bearer"
+}
+
+// storedAccessTokenAuth restores the presentation of a persisted access
+// token. DPoP-bound tokens get proofs from the wallet's DPoP key.
+func (w *Wallet) storedAccessTokenAuth(token, tokenType string) (accessTokenAuth, error) {
+	auth := accessTokenAuth{Token: token}
+	if strings.EqualFold(tokenType, "DPoP") {
+		signer, err := w.newDPoPSigner()
+		if err != nil {
+			return auth, err
+		}
+		auth.DPoP = signer
+	}
+	return auth, nil
+}
+
+// resourceAuth decides how the access token of a token response is presented.
+// A DPoP proof on the token request only binds the token if the authorization
+// server confirms it with token_type DPoP.
+func resourceAuth(tokenResp map[string]any, dpop *dpopSigner) accessTokenAuth {
+	accessToken, _ := tokenResp["access_token"].(string)
+	auth := accessTokenAuth{Token: accessToken}
+	if dpop == nil {
+		return auth
+	}
+	tokenType, _ := tokenResp["token_type"].(string)
+	if !strings.EqualFold(tokenType, "DPoP") {
+		log.Printf("[VCI] Warning: DPoP proof sent but token_type is %q; using the access token as Bearer token", tokenType)
+		return auth
+	}
+	auth.DPoP = dpop
+	return auth
+}
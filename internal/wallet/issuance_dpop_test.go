@@ -0,0 +1,358 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
+)
+
+func TestParseDPoPMode(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    DPoPMode
+		wantErr bool
+	}{
+		{"", DPoPModeAuto, false},
+		{"auto", DPoPModeAuto, false},
+		{"FORCE", DPoPModeForce, false},
+		{" off ", DPoPModeOff, false},
+		{"always", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDPoPMode(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDPoPMode(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDPoPMode(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+// dpopIssuer is a mock issuer whose authorization server issues DPoP-bound
+// access tokens and whose endpoints both demand a server-provided DPoP nonce.
+type dpopIssuer struct {
+	t *testing.T
+	// algs is advertised as dpop_signing_alg_values_supported; nil omits it.
+	algs []any
+
+	mu          sync.Mutex
+	tokenProofs []map[string]any // verified proof payloads seen at /token
+	credProofs  []map[string]any // verified proof payloads seen at /credential
+	thumbprints map[string]bool  // JWK thumbprints of all proofs
+}
+
+// verifyProof checks the DPoP header of r and returns the proof payload.
+func (d *dpopIssuer) verifyProof(r *http.Request) map[string]any {
+	proof := r.Header.Get("DPoP")
+	if proof == "" {
+		return nil
+	}
+	header, payload, _, err := format.ParseJWTParts(proof)
+	if err != nil {
+		d.t.Errorf("parsing DPoP proof: %v", err)
+		return nil
+	}
+	if header["typ"] != "dpop+jwt" || header["alg"] != "ES256" {
+		d.t.Errorf("unexpected DPoP header: %v", header)
+	}
+	jwkJSON, _ := json.Marshal(header["jwk"])
+	pub, err := keys.ParseJWK(jwkJSON)
+	if err != nil {
+		d.t.Fatalf("parsing DPoP jwk: %v", err)
+	}
+	if !verifyES256(d.t, proof, pub.(*ecdsa.PublicKey)) {
+		d.t.Error("DPoP proof signature invalid")
+	}
+	jkt, _ := jwkThumbprint(pub.(*ecdsa.PublicKey))
+	d.thumbprints[jkt] = true
+
+	if payload["htm"] != r.Method {
+		d.t.Errorf("expected htm %s, got %v", r.Method, payload["htm"])
+	}
+	if payload["htu"] != "http://"+r.Host+r.URL.Path {
+		d.t.Errorf("expected htu for %s, got %v", r.URL.Path, payload["htu"])
+	}
+	if payload["jti"] == nil || payload["iat"] == nil {
+		d.t.Errorf("DPoP proof missing jti/iat: %v", payload)
+	}
+	return payload
+}
+
+func (d *dpopIssuer) start(w *Wallet) *httptest.Server {
+	credRaw := generateTestCredential(d.t, w)
+	d.thumbprints = make(map[string]bool)
+	var serverURL string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		rw.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/.well-known/openid-credential-issuer"):
+			json.NewEncoder(rw).Encode(map[string]any{
+				"credential_issuer":   serverURL,
+				"credential_endpoint": serverURL + "/credential",
+				"credential_configurations_supported": map[string]any{
+					"test-config": map[string]any{"format": "dc+sd-jwt"},
+				},
+			})
+
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/.well-known/oauth-authorization-server"):
+			meta := map[string]any{
+				"issuer":         serverURL,
+				"token_endpoint": serverURL + "/token",
+			}
+			if d.algs != nil {
+				meta["dpop_signing_alg_values_supported"] = d.algs
+			}
+			json.NewEncoder(rw).Encode(meta)
+
+		case r.Method == "POST" && r.URL.Path == "/token":
+			payload := d.verifyProof(r)
+			if payload == nil {
+				json.NewEncoder(rw).Encode(map[string]any{"access_token": "bearer-token", "token_type": "Bearer", "c_nonce": "test-c-nonce"})
+				return
+			}
+			d.tokenProofs = append(d.tokenProofs, payload)
+			if payload["nonce"] != "as-nonce" {
+				rw.Header().Set("DPoP-Nonce", "as-nonce")
+				rw.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(rw).Encode(map[string]string{"error": "use_dpop_nonce"})
+				return
+			}
+			json.NewEncoder(rw).Encode(map[string]any{"access_token": "dpop-token", "token_type": "DPoP", "c_nonce": "test-c-nonce"})
+
+		case r.Method == "POST" && r.URL.Path == "/credential":
+			if r.Header.Get("Authorization") == "Bearer bearer-token" {
+				json.NewEncoder(rw).Encode(map[string]any{"credential": credRaw})
+				return
+			}
+			if r.Header.Get("Authorization") != "DPoP dpop-token" {
+				rw.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(rw).Encode(map[string]string{"error": "invalid_token"})
+				return
+			}
+			payload := d.verifyProof(r)
+			if payload == nil {
+				rw.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			d.credProofs = append(d.credProofs, payload)
+			ath := sha256.Sum256([]byte("dpop-token"))
+			if payload["ath"] != format.EncodeBase64URL(ath[:]) {
+				d.t.Errorf("expected ath to hash the access token, got %v", payload["ath"])
+			}
+			if payload["nonce"] != "rs-nonce" {
+				rw.Header().Set("DPoP-Nonce", "rs-nonce")
+				rw.Header().Set("WWW-Authenticate", `DPoP error="use_dpop_nonce", error_description="Resource server requires nonce in DPoP proof"`)
+				rw.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(rw).Encode(map[string]string{"error": "use_dpop_nonce"})
+				return
+			}
+			json.NewEncoder(rw).Encode(map[string]any{"credential": credRaw})
+
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	serverURL = srv.URL
+	return srv
+}
+
+// preAuthOfferURI builds a pre-authorized code credential offer for issuer.
+func preAuthOfferURI(issuer string) string {
+	offer := map[string]any{
+		"credential_issuer":            issuer,
+		"credential_configuration_ids": []string{"test-config"},
+		"grants": map[string]any{
+			"urn:ietf:params:oauth:grant-type:pre-authorized_code": map[string]any{
+				"pre-authorized_code": "test-pre-auth-code",
+			},
+		},
+	}
+	offerJSON, _ := json.Marshal(offer)
+	return "openid-credential-offer://?credential_offer=" + url.QueryEscape(string(offerJSON))
+}
+
+func TestProcessCredentialOffer_DPoP(t *testing.T) {
+	w := generateTestWallet(t)
+	issuer := &dpopIssuer{t: t, algs: []any{"RS256", "ES256"}}
+	srv := issuer.start(w)
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	result, err := w.ProcessCredentialOffer(preAuthOfferURI(srv.URL))
+	if err != nil {
+		t.Fatalf("ProcessCredentialOffer (DPoP): %v", err)
+	}
+	if result.CredentialID == "" {
+		t.Fatal("expected credential to be stored")
+	}
+
+	// One attempt without and one with the nonce at each endpoint
+	if len(issuer.tokenProofs) != 2 || issuer.tokenProofs[1]["nonce"] != "as-nonce" {
+		t.Errorf("expected token request retried with AS nonce, got %v", issuer.tokenProofs)
+	}
+	if len(issuer.credProofs) != 2 || issuer.credProofs[1]["nonce"] != "rs-nonce" {
+		t.Errorf("expected credential request retried with RS nonce, got %v", issuer.credProofs)
+	}
+	if issuer.tokenProofs[0]["ath"] != nil {
+		t.Error("token request proof must not carry ath")
+	}
+
+	// All proofs are signed with the dedicated DPoP key, not the holder key
+	dpopJKT, _ := jwkThumbprint(&w.DPoPKey.PublicKey)
+	holderJKT, _ := jwkThumbprint(w.HolderKey.Public())
+	if len(issuer.thumbprints) != 1 || !issuer.thumbprints[dpopJKT] {
+		t.Errorf("expected all proofs signed with the DPoP key, got %v", issuer.thumbprints)
+	}
+	if dpopJKT == holderJKT {
+		t.Error("DPoP key must differ from the holder key")
+	}
+}
+
+func TestProcessCredentialOffer_DPoPModes(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      DPoPMode
+		algs      []any
+		wantDPoP  bool
+		wantError string
+	}{
+		{name: "auto without metadata", mode: DPoPModeAuto, wantDPoP: false},
+		{name: "auto with metadata", mode: DPoPModeAuto, algs: []any{"ES256"}, wantDPoP: true},
+		{name: "off with metadata", mode: DPoPModeOff, algs: []any{"ES256"}, wantDPoP: false},
+		{name: "force without metadata", mode: DPoPModeForce, wantDPoP: true},
+		{name: "auto with unsupported alg", mode: DPoPModeAuto, algs: []any{"PS256"}, wantDPoP: false},
+		{name: "force with unsupported alg", mode: DPoPModeForce, algs: []any{"PS256"}, wantError: "does not support DPoP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := generateTestWallet(t)
+			w.DPoPMode = tt.mode
+			issuer := &dpopIssuer{t: t, algs: tt.algs}
+			srv := issuer.start(w)
+			defer srv.Close()
+
+			oldClient := httpClient
+			httpClient = srv.Client()
+			defer func() { httpClient = oldClient }()
+
+			_, err := w.ProcessCredentialOffer(preAuthOfferURI(srv.URL))
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProcessCredentialOffer: %v", err)
+			}
+			if gotDPoP := len(issuer.tokenProofs) > 0; gotDPoP != tt.wantDPoP {
+				t.Errorf("expected DPoP=%v, got %d token proofs", tt.wantDPoP, len(issuer.tokenProofs))
+			}
+		})
+	}
+}
+
+func TestProcessCredentialOffer_AuthorizationCodeDPoPJKT(t *testing.T) {
+	w := generateTestWallet(t)
+	var challenge string
+	srv := setupAuthCodeIssuer(t, w, &challenge, &authCodeIssuerOptions{
+		ASMetadata: map[string]any{"dpop_signing_alg_values_supported": []any{"ES256"}},
+	})
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	var gotJKT string
+	w.IssuanceClientID = "test-client"
+	w.IssuanceRedirectURI = "http://localhost:8085/callback"
+	w.OnAuthorizationURL = func(authURL string) error {
+		u, _ := url.Parse(authURL)
+		q := u.Query()
+		gotJKT = q.Get("dpop_jkt")
+		challenge = q.Get("code_challenge")
+		w.CompleteAuthorization(q.Get("state"), AuthorizationCallback{Code: "auth-code-123"})
+		return nil
+	}
+
+	// The mock AS answers with a Bearer token, which the wallet accepts
+	if _, err := w.ProcessCredentialOffer(authCodeOfferURI(srv.URL)); err != nil {
+		t.Fatalf("ProcessCredentialOffer: %v", err)
+	}
+	wantJKT, _ := jwkThumbprint(&w.DPoPKey.PublicKey)
+	if gotJKT != wantJKT {
+		t.Errorf("expected dpop_jkt %q, got %q", wantJKT, gotJKT)
+	}
+}
+
+func TestRetryPendingIssuance_DPoP(t *testing.T) {
+	w := generateTestWallet(t)
+	credRaw := generateTestCredential(t, w)
+
+	var gotAuth string
+	var gotProof bool
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotProof = r.Header.Get("DPoP") != ""
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(map[string]any{"credentials": []any{map[string]any{"credential": credRaw}}})
+	}))
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	holderPEM, _ := encodeKeyPEM(w.HolderKey)
+	w.PendingIssuances = []PendingIssuance{{
+		ID:               "p1",
+		TransactionID:    "tx-1",
+		DeferredEndpoint: srv.URL + "/deferred_credential",
+		AccessToken:      "dpop-token",
+		TokenType:        "DPoP",
+		HolderKeys:       []string{string(holderPEM)},
+	}}
+
+	result, err := w.RetryPendingIssuance("p1")
+	if err != nil {
+		t.Fatalf("RetryPendingIssuance: %v", err)
+	}
+	if result.CredentialID == "" {
+		t.Fatal("expected deferred credential to be imported")
+	}
+	if gotAuth != "DPoP dpop-token" || !gotProof {
+		t.Errorf("expected DPoP-bound deferred request, got Authorization %q, proof %v", gotAuth, gotProof)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/jsonutil"
+	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
+)
+
+// CredentialEncryptionMode controls whether the wallet asks the issuer to
+// encrypt credential responses (OID4VCI 1.0 credential_response_encryption).
+type CredentialEncryptionMode string
+
+const (
+	// CredentialEncryptionAuto requests encryption when the issuer metadata
+	// advertises credential_response_encryption.
+	CredentialEncryptionAuto CredentialEncryptionMode = "auto"
+	// CredentialEncryptionForce always requests encryption, even if the
+	// issuer does not advertise support.
+	CredentialEncryptionForce CredentialEncryptionMode = "force"
+	// CredentialEncryptionOff never requests encryption, even if the issuer
+	// requires it.
+	CredentialEncryptionOff CredentialEncryptionMode = "off"
+)
+
+// ParseCredentialEncryptionMode parses a credential encryption mode string.
+// An empty value means auto.
+func ParseCredentialEncryptionMode(raw string) (CredentialEncryptionMode, error) {
+	switch CredentialEncryptionMode(strings.ToLower(strings.TrimSpace(raw))) {
+	case "", CredentialEncryptionAuto:
+		return CredentialEncryptionAuto, nil
+	case CredentialEncryptionForce:
+		return CredentialEncryptionForce, nil
+	case CredentialEncryptionOff:
+		return CredentialEncryptionOff, nil
+	default:
+		return "", fmt.Errorf("invalid credential encryption mode %q (expected 'auto', 'force', or 'off')", raw)
+	}
+}
+
+// credentialEncryptionAlg is the key agreement algorithm of encrypted
+// credential responses; the wallet's ephemeral key is EC P-256.
+const credentialEncryptionAlg = "ECDH-ES"
+
+// credentialEncryptionEncs are the content encryption algorithms DecryptJWE
+// supports, in order of preference.
+var credentialEncryptionEncs = []string{"A128GCM", "A256GCM"}
+
+// debugJWKHeader carries the ephemeral private key of an encrypted
+// credential request so the proxy can decrypt the response. The proxy strips
+// it before forwarding.
+const debugJWKHeader = "X-Debug-JWE-JWK"
+
+// ResponseEncryption holds the algorithms for encrypted credential responses.
+// It is persisted with pending issuances so deferred credential responses
+// are encrypted the same way.
+type ResponseEncryption struct {
+	Alg string `json:"alg"`
+	Enc string `json:"enc"`
+}
+
+// resolveResponseEncryption decides whether credential responses are
+// encrypted, based on the wallet's CredentialEncryption mode and the issuer's
+// credential_response_encryption metadata. It returns nil for plain responses.
+func (w *Wallet) resolveResponseEncryption(metadata map[string]any) (*ResponseEncryption, error) {
+	w.mu.RLock()
+	mode := w.CredentialEncryption
+	w.mu.RUnlock()
+
+	meta := jsonutil.GetMap(metadata, "credential_response_encryption")
+	required, _ := meta["encryption_required"].(bool)
+
+	if mode == CredentialEncryptionOff {
+		if required {
+			log.Printf("[VCI] Warning: issuer requires encrypted credential responses but encryption is off")
+		}
+		return nil, nil
+	}
+	if meta == nil && mode != CredentialEncryptionForce {
+		return nil, nil
+	}
+
+	// An error is only returned when the wallet is expected to encrypt;
+	// otherwise it falls back to plain responses.
+	mustEncrypt := required || mode == CredentialEncryptionForce
+	unsupported := func(format string, args ...any) (*ResponseEncryption, error) {
+		msg := fmt.Sprintf(format, args...)
+		if mustEncrypt {
+			return nil, fmt.Errorf("credential response encryption: %s", msg)
+		}
+		log.Printf("[VCI] Warning: %s; requesting plain credential responses", msg)
+		return nil, nil
+	}
+
+	if algs := stringValues(meta["alg_values_supported"]); len(algs) > 0 && !slices.Contains(algs, credentialEncryptionAlg) {
+		return unsupported("issuer does not support %s (alg_values_supported: %s)", credentialEncryptionAlg, strings.Join(algs, ", "))
+	}
+	enc := credentialEncryptionEncs[0]
+	if encs := stringValues(meta["enc_values_supported"]); len(encs) > 0 {
+		i := slices.IndexFunc(credentialEncryptionEncs, func(e string) bool { return slices.Contains(encs, e) })
+		if i < 0 {
+			return unsupported("no supported content encryption (enc_values_supported: %s)", strings.Join(encs, ", "))
+		}
+		enc = credentialEncryptionEncs[i]
+	}
+
+	log.Printf("[VCI] Requesting encrypted credential responses (%s, %s)", credentialEncryptionAlg, enc)
+	return &ResponseEncryption{Alg: credentialEncryptionAlg, Enc: enc}, nil
+}
+
+// addTo generates an ephemeral key and adds the credential_response_encryption
+// parameter to a credential or deferred credential request body. It returns
+// the key to decrypt the response with.
+func (e *ResponseEncryption) addTo(reqBody map[string]any) (*ecdsa.PrivateKey, error) {
+	key, err := mock.GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("generating response encryption key: %w", err)
+	}
+	jwk := map[string]any{"use": "enc", "alg": e.Alg, "kid": uuid.New().String()}
+	for k, v := range mock.PublicKeyJWKMap(&key.PublicKey) {
+		jwk[k] = v
+	}
+	reqBody["credential_response_encryption"] = map[string]any{
+		"jwk": jwk,
+		"enc": e.Enc,
+	}
+	return key, nil
+}
+
+// setDebugKey adds the ephemeral private key to req for proxy debugging.
+func setDebugKey(req *http.Request, key *ecdsa.PrivateKey) {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, []byte(mock.PrivateKeyJWK(key))); err != nil {
+		return
+	}
+	req.Header.Set(debugJWKHeader, compact.String())
+}
+
+// decryptIssuanceResponse decrypts an encrypted credential or deferred
+// credential response. Error responses are not encrypted and are returned
+// unchanged, as is a plain success response, which is logged since the
+// issuer ignored the encryption request.
+func decryptIssuanceResponse(resp *http.Response, body []byte, key *ecdsa.PrivateKey) ([]byte, error) {
+	raw := strings.TrimSpace(string(body))
+	if !isJWE(raw) {
+		if resp.StatusCode < 300 {
+			log.Printf("[VCI] Warning: credential response is not encrypted although encryption was requested")
+		}
+		return body, nil
+	}
+	plaintext, err := DecryptJWE(raw, key)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting credential response: %w", err)
+	}
+	log.Printf("[VCI] Decrypted credential response:\n%s", plaintext)
+	return plaintext, nil
+}
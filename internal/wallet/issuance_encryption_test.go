@@ -0,0 +1,199 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseCredentialEncryptionMode(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    CredentialEncryptionMode
+		wantErr bool
+	}{
+		{"", CredentialEncryptionAuto, false},
+		{"auto", CredentialEncryptionAuto, false},
+		{" FORCE ", CredentialEncryptionForce, false},
+		{"off", CredentialEncryptionOff, false},
+		{"required", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCredentialEncryptionMode(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCredentialEncryptionMode(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseCredentialEncryptionMode(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestResolveResponseEncryption(t *testing.T) {
+	encMeta := func(algs, encs []any, required bool) map[string]any {
+		return map[string]any{
+			"credential_response_encryption": map[string]any{
+				"alg_values_supported": algs,
+				"enc_values_supported": encs,
+				"encryption_required":  required,
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		mode     CredentialEncryptionMode
+		metadata map[string]any
+		wantEnc  string // "" for plain responses
+		wantErr  bool
+	}{
+		{"auto without metadata", CredentialEncryptionAuto, map[string]any{}, "", false},
+		{"auto supported", CredentialEncryptionAuto, encMeta([]any{"ECDH-ES"}, []any{"A128GCM", "A256GCM"}, false), "A128GCM", false},
+		{"auto prefers supported enc", CredentialEncryptionAuto, encMeta([]any{"ECDH-ES"}, []any{"A128CBC-HS256", "A256GCM"}, false), "A256GCM", false},
+		{"auto unsupported alg", CredentialEncryptionAuto, encMeta([]any{"RSA-OAEP-256"}, []any{"A128GCM"}, false), "", false},
+		{"required unsupported alg", CredentialEncryptionAuto, encMeta([]any{"RSA-OAEP-256"}, []any{"A128GCM"}, true), "", true},
+		{"required unsupported enc", CredentialEncryptionAuto, encMeta([]any{"ECDH-ES"}, []any{"A128CBC-HS256"}, true), "", true},
+		{"force without metadata", CredentialEncryptionForce, map[string]any{}, "A128GCM", false},
+		{"off although required", CredentialEncryptionOff, encMeta([]any{"ECDH-ES"}, []any{"A128GCM"}, true), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Wallet{CredentialEncryption: tt.mode}
+			got, err := w.resolveResponseEncryption(tt.metadata)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			switch {
+			case tt.wantEnc == "" && got != nil:
+				t.Errorf("expected plain responses, got %+v", got)
+			case tt.wantEnc != "" && (got == nil || got.Enc != tt.wantEnc || got.Alg != "ECDH-ES"):
+				t.Errorf("got %+v, want ECDH-ES/%s", got, tt.wantEnc)
+			}
+		})
+	}
+}
+
+// checkEncryptionRequest verifies the credential_response_encryption
+// parameter of a credential or deferred credential request.
+func checkEncryptionRequest(t *testing.T, reqBody map[string]any, wantEnc string) {
+	t.Helper()
+	params, ok := reqBody["credential_response_encryption"].(map[string]any)
+	if !ok {
+		t.Fatal("expected credential_response_encryption in request")
+	}
+	if params["enc"] != wantEnc {
+		t.Errorf("enc = %v, want %s", params["enc"], wantEnc)
+	}
+	jwk, _ := params["jwk"].(map[string]any)
+	if jwk["kty"] != "EC" || jwk["alg"] != "ECDH-ES" || jwk["use"] != "enc" {
+		t.Errorf("unexpected response encryption jwk: %v", jwk)
+	}
+	if _, ok := jwk["d"]; ok {
+		t.Error("response encryption jwk must not contain the private key")
+	}
+}
+
+func TestProcessCredentialOffer_EncryptedCredentialResponse(t *testing.T) {
+	w := generateTestWallet(t)
+
+	var debugJWK string
+	srv, offerURI := setupMockIssuer(t, w, mockIssuerOpts{
+		tokenCNonce:      "test-c-nonce",
+		encryptResponses: true,
+		issuerMetadata: map[string]any{
+			"credential_response_encryption": map[string]any{
+				"alg_values_supported": []any{"ECDH-ES"},
+				"enc_values_supported": []any{"A256GCM"},
+				"encryption_required":  true,
+			},
+		},
+		inspectCredentialRequest: func(t *testing.T, reqBody map[string]any) {
+			checkEncryptionRequest(t, reqBody, "A256GCM")
+		},
+	})
+	defer srv.Close()
+
+	oldClient := httpClient
+	base := srv.Client().Transport
+	httpClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if v := r.Header.Get("X-Debug-JWE-JWK"); v != "" {
+			debugJWK = v
+		}
+		return base.RoundTrip(r)
+	})}
+	defer func() { httpClient = oldClient }()
+
+	result, err := w.ProcessCredentialOffer(offerURI)
+	if err != nil {
+		t.Fatalf("ProcessCredentialOffer: %v", err)
+	}
+	if result.CredentialID == "" {
+		t.Fatal("expected credential to be stored from the decrypted response")
+	}
+	if !strings.Contains(debugJWK, `"d"`) {
+		t.Errorf("expected X-Debug-JWE-JWK header with the ephemeral private key, got %q", debugJWK)
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestRetryPendingIssuance_EncryptedDeferredResponse(t *testing.T) {
+	w := generateTestWallet(t)
+	credRaw := generateTestCredential(t, w)
+
+	srv, offerURI := setupMockIssuer(t, w, mockIssuerOpts{
+		tokenCNonce:        "test-c-nonce",
+		encryptResponses:   true,
+		credentialResponse: map[string]any{"transaction_id": "tx-enc"},
+		issuerMetadata: map[string]any{
+			"credential_response_encryption": map[string]any{
+				"alg_values_supported": []any{"ECDH-ES"},
+				"enc_values_supported": []any{"A128GCM"},
+			},
+		},
+		deferredHandler: func(t *testing.T, reqBody map[string]any) (int, map[string]any) {
+			checkEncryptionRequest(t, reqBody, "A128GCM")
+			return http.StatusOK, map[string]any{"credentials": []any{map[string]any{"credential": credRaw}}}
+		},
+	})
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	result, err := w.ProcessCredentialOffer(offerURI)
+	if err != nil {
+		t.Fatalf("ProcessCredentialOffer: %v", err)
+	}
+	pending := w.GetPendingIssuances()
+	if len(pending) != 1 || pending[0].Encryption == nil || pending[0].Encryption.Enc != "A128GCM" {
+		t.Fatalf("expected pending issuance to remember response encryption, got %+v", pending)
+	}
+
+	result, err = w.RetryPendingIssuance(result.PendingID)
+	if err != nil {
+		t.Fatalf("RetryPendingIssuance: %v", err)
+	}
+	if result.CredentialID == "" {
+		t.Fatal("expected credential from the decrypted deferred response")
+	}
+}
@@ -15,6 +15,8 @@
 package wallet
 
 import (
+	"crypto/ecdsa"
+	"crypto/sha256"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -24,6 +26,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
 )
 
@@ -35,6 +39,11 @@ type mockIssuerOpts struct {
 	nonceEndpoint bool
 	// tokenAuthorizationDetails, if non-empty, is returned in the token response.
 	tokenAuthorizationDetails []any
+	// tokenResponse is merged into the token response.
+	tokenResponse map[string]any
+	// inspectTokenRequest validates the token request form sent by the wallet.
+	// The token endpoint accepts pre-authorized code and refresh token grants.
+	inspectTokenRequest func(*testing.T, url.Values)
 	// credentialResponse is the raw JSON object returned by the credential endpoint.
 	// If nil, a default response with a single SD-JWT credential is returned.
 	credentialResponse map[string]any
@@ -42,6 +51,49 @@ type mockIssuerOpts struct {
 	credentialConfigFormat string
 	// inspectCredentialRequest validates the credential request body sent by the wallet.
 	inspectCredentialRequest func(*testing.T, map[string]any)
+	// issuerMetadata is merged into the credential issuer metadata.
+	issuerMetadata map[string]any
+	// credentialHandler, if set, builds the credential response from the request body.
+	credentialHandler func(*testing.T, map[string]any) map[string]any
+	// deferredHandler, if set, serves POST /deferred_credential and returns
+	// the status code and body of the deferred credential response.
+	deferredHandler func(*testing.T, map[string]any) (int, map[string]any)
+	// encryptResponses encrypts successful credential and deferred credential
+	// responses to the credential_response_encryption key of the request.
+	encryptResponses bool
+	// notificationHandler, if set, serves POST /notification, is advertised
+	// as notification_endpoint, and returns the response status code.
+	notificationHandler func(*testing.T, map[string]any) int
+}
+
+// writeIssuerResponse writes a credential or deferred credential response,
+// as a JWE if encrypt is set and the request asked for encryption.
+func writeIssuerResponse(t *testing.T, rw http.ResponseWriter, reqBody map[string]any, status int, resp map[string]any, encrypt bool) {
+	t.Helper()
+	params, _ := reqBody["credential_response_encryption"].(map[string]any)
+	if !encrypt || params == nil || status >= 300 {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(status)
+		json.NewEncoder(rw).Encode(resp)
+		return
+	}
+	jwk, _ := params["jwk"].(map[string]any)
+	enc, _ := params["enc"].(string)
+	x, _ := jwk["x"].(string)
+	y, _ := jwk["y"].(string)
+	kid, _ := jwk["kid"].(string)
+	pub, err := ecdsaPublicKeyFromJWK(x, y)
+	if err != nil {
+		t.Fatalf("parsing response encryption jwk: %v", err)
+	}
+	plaintext, _ := json.Marshal(resp)
+	jwe, _, err := EncryptJWE(plaintext, pub, kid, "ECDH-ES", enc, nil)
+	if err != nil {
+		t.Fatalf("encrypting credential response: %v", err)
+	}
+	rw.Header().Set("Content-Type", "application/jwt")
+	rw.WriteHeader(status)
+	rw.Write([]byte(jwe))
 }
 
 func setupMockIssuer(t *testing.T, w *Wallet, opts mockIssuerOpts) (*httptest.Server, string) {
@@ -78,13 +130,25 @@ func setupMockIssuer(t *testing.T, w *Wallet, opts mockIssuerOpts) (*httptest.Se
 			if opts.nonceEndpoint {
 				meta["nonce_endpoint"] = serverURL + "/nonce"
 			}
+			if opts.notificationHandler != nil {
+				meta["notification_endpoint"] = serverURL + "/notification"
+			}
+			if opts.deferredHandler != nil {
+				meta["deferred_credential_endpoint"] = serverURL + "/deferred_credential"
+			}
+			for k, v := range opts.issuerMetadata {
+				meta[k] = v
+			}
 			rw.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(rw).Encode(meta)
 
 		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/token"):
 			body, _ := io.ReadAll(r.Body)
 			form, _ := url.ParseQuery(string(body))
-			if form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:pre-authorized_code" {
+			if opts.inspectTokenRequest != nil {
+				opts.inspectTokenRequest(t, form)
+			}
+			if gt := form.Get("grant_type"); gt != "urn:ietf:params:oauth:grant-type:pre-authorized_code" && gt != "refresh_token" {
 				rw.WriteHeader(http.StatusBadRequest)
 				json.NewEncoder(rw).Encode(map[string]string{"error": "unsupported_grant_type"})
 				return
@@ -99,9 +163,40 @@ func setupMockIssuer(t *testing.T, w *Wallet, opts mockIssuerOpts) (*httptest.Se
 			if opts.tokenAuthorizationDetails != nil {
 				resp["authorization_details"] = opts.tokenAuthorizationDetails
 			}
+			for k, v := range opts.tokenResponse {
+				resp[k] = v
+			}
 			rw.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(rw).Encode(resp)
 
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/deferred_credential") && opts.deferredHandler != nil:
+			if r.Header.Get("Authorization") != "Bearer test-access-token" {
+				rw.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(rw).Encode(map[string]string{"error": "invalid_token"})
+				return
+			}
+			var reqBody map[string]any
+			json.NewDecoder(r.Body).Decode(&reqBody)
+			status, resp := opts.deferredHandler(t, reqBody)
+			writeIssuerResponse(t, rw, reqBody, status, resp, opts.encryptResponses)
+
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/notification") && opts.notificationHandler != nil:
+			if r.Header.Get("Authorization") != "Bearer test-access-token" {
+				rw.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(rw).Encode(map[string]string{"error": "invalid_token"})
+				return
+			}
+			var reqBody map[string]any
+			json.NewDecoder(r.Body).Decode(&reqBody)
+			status := opts.notificationHandler(t, reqBody)
+			if status >= 300 {
+				rw.Header().Set("Content-Type", "application/json")
+				rw.WriteHeader(status)
+				json.NewEncoder(rw).Encode(map[string]string{"error": "invalid_notification_id"})
+				return
+			}
+			rw.WriteHeader(status)
+
 		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/nonce"):
 			rw.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(rw).Encode(map[string]any{"c_nonce": "nonce-from-endpoint"})
@@ -113,16 +208,19 @@ func setupMockIssuer(t *testing.T, w *Wallet, opts mockIssuerOpts) (*httptest.Se
 				json.NewEncoder(rw).Encode(map[string]string{"error": "invalid_token"})
 				return
 			}
+			body, _ := io.ReadAll(r.Body)
+			var reqBody map[string]any
+			if err := json.Unmarshal(body, &reqBody); err != nil {
+				t.Fatalf("credential request JSON: %v", err)
+			}
 			if opts.inspectCredentialRequest != nil {
-				body, _ := io.ReadAll(r.Body)
-				var reqBody map[string]any
-				if err := json.Unmarshal(body, &reqBody); err != nil {
-					t.Fatalf("credential request JSON: %v", err)
-				}
 				opts.inspectCredentialRequest(t, reqBody)
 			}
-			rw.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(rw).Encode(credResp)
+			resp := credResp
+			if opts.credentialHandler != nil {
+				resp = opts.credentialHandler(t, reqBody)
+			}
+			writeIssuerResponse(t, rw, reqBody, http.StatusOK, resp, opts.encryptResponses)
 
 		default:
 			rw.WriteHeader(http.StatusNotFound)
@@ -155,7 +253,7 @@ func generateTestCredential(t *testing.T, w *Wallet) string {
 		ExpiresIn: 24 * time.Hour,
 		Claims:    map[string]any{"given_name": "Test", "family_name": "User"},
 		Key:       w.IssuerKey,
-		HolderKey: &w.HolderKey.PublicKey,
+		HolderKey: w.HolderKey.Public(),
 	})
 	if err != nil {
 		t.Fatalf("generating test credential: %v", err)
@@ -275,28 +373,592 @@ func TestProcessCredentialOffer_Draft14CredentialsArray(t *testing.T) {
 	}
 }
 
-func TestProcessCredentialOffer_AuthCodeOnlyRejected(t *testing.T) {
+func TestProcessCredentialOffer_BatchIssuance(t *testing.T) {
 	w := generateTestWallet(t)
 
-	// Build an offer with only authorization_code grant (no pre-authorized code)
+	srv, offerURI := setupMockIssuer(t, w, mockIssuerOpts{
+		tokenCNonce: "test-c-nonce",
+		issuerMetadata: map[string]any{
+			"batch_credential_issuance": map[string]any{"batch_size": 3},
+		},
+		credentialHandler: func(t *testing.T, reqBody map[string]any) map[string]any {
+			t.Helper()
+			proofs, _ := reqBody["proofs"].(map[string]any)
+			jwts, _ := proofs["jwt"].([]any)
+			if len(jwts) != 3 {
+				t.Fatalf("expected 3 jwt proofs, got %d", len(jwts))
+			}
+			seen := make(map[string]bool)
+			var creds []any
+			for _, p := range jwts {
+				header, _, _, err := format.ParseJWTParts(p.(string))
+				if err != nil {
+					t.Fatalf("parsing proof JWT: %v", err)
+				}
+				jwkJSON, _ := json.Marshal(header["jwk"])
+				if seen[string(jwkJSON)] {
+					t.Fatal("expected each proof to use a distinct holder key")
+				}
+				seen[string(jwkJSON)] = true
+				pub, err := keys.ParseJWK(jwkJSON)
+				if err != nil {
+					t.Fatalf("parsing proof jwk: %v", err)
+				}
+				cred, err := mock.GenerateSDJWT(mock.SDJWTConfig{
+					Issuer:    "https://test-issuer.example",
+					VCT:       "TestIssuedCred",
+					ExpiresIn: 24 * time.Hour,
+					Claims:    map[string]any{"given_name": "Test"},
+					Key:       w.IssuerKey,
+					HolderKey: pub.(*ecdsa.PublicKey),
+				})
+				if err != nil {
+					t.Fatalf("generating batch credential: %v", err)
+				}
+				creds = append(creds, map[string]any{"credential": cred})
+			}
+			return map[string]any{"credentials": creds}
+		},
+	})
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	result, err := w.ProcessCredentialOffer(offerURI)
+	if err != nil {
+		t.Fatalf("ProcessCredentialOffer (batch): %v", err)
+	}
+	if result.Instances != 3 {
+		t.Errorf("expected 3 instances in result, got %d", result.Instances)
+	}
+
+	creds := w.GetCredentials()
+	if len(creds) != 1 {
+		t.Fatalf("expected batch stored as 1 credential, got %d", len(creds))
+	}
+	if len(creds[0].Instances) != 3 || creds[0].UnusedInstances() != 3 {
+		t.Fatalf("expected 3 unused instances, got %d (%d unused)", len(creds[0].Instances), creds[0].UnusedInstances())
+	}
+
+	// A presentation that fails does not use up an instance
+	match := CredentialMatch{CredentialID: result.CredentialID, SelectedKeys: []string{"given_name"}}
+	mdocOnly := PresentationParams{Nonce: "n", ClientID: "https://verifier.example", RequestObject: vpFormatsRequest(map[string]any{"mso_mdoc": map[string]any{}})}
+	if _, err := w.CreateVPToken(match, mdocOnly); err == nil {
+		t.Fatal("expected vp_formats_supported to rule out the SD-JWT")
+	}
+	if cred, _ := w.GetCredential(result.CredentialID); cred.UnusedInstances() != 3 {
+		t.Fatalf("expected a failed presentation to leave 3 unused instances, got %d", cred.UnusedInstances())
+	}
+
+	// Each presentation uses a different instance until all are used
+	params := PresentationParams{Nonce: "n", ClientID: "https://verifier.example"}
+	issuerJWTs := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		vp, err := w.CreateVPToken(match, params)
+		if err != nil {
+			t.Fatalf("CreateVPToken #%d: %v", i, err)
+		}
+		if vp.Warning != "" {
+			t.Errorf("CreateVPToken #%d: unexpected warning %q", i, vp.Warning)
+		}
+		issuerJWTs[strings.SplitN(vp.Token, "~", 2)[0]] = true
+	}
+	if len(issuerJWTs) != 3 {
+		t.Errorf("expected 3 distinct instances presented, got %d", len(issuerJWTs))
+	}
+	cred, _ := w.GetCredential(result.CredentialID)
+	if cred.UnusedInstances() != 0 {
+		t.Errorf("expected all instances used, got %d unused", cred.UnusedInstances())
+	}
+
+	if warnings := w.InstanceWarnings([]CredentialMatch{match}); len(warnings) != 1 || !strings.Contains(warnings[0], "linkable") {
+		t.Errorf("expected an exhaustion warning for the consent screen, got %v", warnings)
+	}
+
+	// Debug mode reuses exhausted instances with a warning
+	vp, err := w.CreateVPToken(match, params)
+	if err != nil {
+		t.Fatalf("CreateVPToken after exhausting instances: %v", err)
+	}
+	if !strings.Contains(vp.Warning, "all 3 batch instances") {
+		t.Errorf("expected a reuse warning, got %q", vp.Warning)
+	}
+	if cred, _ = w.GetCredential(result.CredentialID); !cred.InstancesExhausted() {
+		t.Errorf("expected instances to stay exhausted, got %d unused", cred.UnusedInstances())
+	}
+
+	// Strict mode refuses to reuse them
+	w.ValidationMode = ValidationModeStrict
+	if _, err := w.CreateVPToken(match, params); err == nil || !strings.Contains(err.Error(), "all 3 batch instances") {
+		t.Errorf("expected strict mode to reject exhausted instances, got %v", err)
+	}
+}
+
+func TestProcessCredentialOffer_DeferredIssuance(t *testing.T) {
+	w := generateTestWallet(t)
+	credRaw := generateTestCredential(t, w)
+
+	polls := 0
+	srv, offerURI := setupMockIssuer(t, w, mockIssuerOpts{
+		tokenCNonce:        "test-c-nonce",
+		credentialResponse: map[string]any{"transaction_id": "tx-123", "interval": 1},
+		deferredHandler: func(t *testing.T, reqBody map[string]any) (int, map[string]any) {
+			if reqBody["transaction_id"] != "tx-123" {
+				t.Errorf("expected transaction_id tx-123, got %v", reqBody["transaction_id"])
+			}
+			polls++
+			if polls == 1 {
+				return http.StatusAccepted, map[string]any{"transaction_id": "tx-123", "interval": 7}
+			}
+			return http.StatusOK, map[string]any{"credentials": []any{map[string]any{"credential": credRaw}}}
+		},
+	})
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	result, err := w.ProcessCredentialOffer(offerURI)
+	if err != nil {
+		t.Fatalf("ProcessCredentialOffer (deferred): %v", err)
+	}
+	if result.PendingID == "" || result.CredentialID != "" {
+		t.Fatalf("expected pending result without credential, got %+v", result)
+	}
+	pending := w.GetPendingIssuances()
+	if len(pending) != 1 {
+		t.Fatalf("expected 1 pending issuance, got %d", len(pending))
+	}
+	if pending[0].TransactionID != "tx-123" || pending[0].Interval != 1 {
+		t.Errorf("unexpected pending issuance: %+v", pending[0])
+	}
+	if pending[0].DeferredEndpoint != srv.URL+"/deferred_credential" {
+		t.Errorf("expected the advertised deferred endpoint, got %s", pending[0].DeferredEndpoint)
+	}
+
+	// First poll: still pending, interval taken from the response
+	result, err = w.RetryPendingIssuance(result.PendingID)
+	if err != nil {
+		t.Fatalf("RetryPendingIssuance #1: %v", err)
+	}
+	if result.PendingID == "" {
+		t.Fatal("expected issuance to still be pending")
+	}
+	pending = w.GetPendingIssuances()
+	if pending[0].Attempts != 1 || pending[0].Interval != 7 {
+		t.Errorf("expected 1 attempt with interval 7, got %d attempts, interval %d", pending[0].Attempts, pending[0].Interval)
+	}
+
+	// Second poll: credential is ready
+	result, err = w.RetryPendingIssuance(result.PendingID)
+	if err != nil {
+		t.Fatalf("RetryPendingIssuance #2: %v", err)
+	}
+	if result.CredentialID == "" || result.PendingID != "" {
+		t.Fatalf("expected imported credential, got %+v", result)
+	}
+	if len(w.GetPendingIssuances()) != 0 {
+		t.Error("expected pending issuance to be removed")
+	}
+	if len(w.GetCredentials()) != 1 {
+		t.Errorf("expected 1 credential, got %d", len(w.GetCredentials()))
+	}
+}
+
+func TestProcessCredentialOffer_DeferredWithoutEndpoint(t *testing.T) {
+	w := generateTestWallet(t)
+	srv, offerURI := setupMockIssuer(t, w, mockIssuerOpts{
+		tokenCNonce:        "test-c-nonce",
+		credentialResponse: map[string]any{"transaction_id": "tx-123"},
+	})
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	_, err := w.ProcessCredentialOffer(offerURI)
+	if err == nil || !strings.Contains(err.Error(), "no deferred_credential_endpoint") {
+		t.Fatalf("expected an error for a deferral without deferred_credential_endpoint, got %v", err)
+	}
+	if len(w.GetPendingIssuances()) != 0 {
+		t.Error("expected no pending issuance without a deferred endpoint")
+	}
+}
+
+func TestRetryPendingIssuance_InvalidTransactionID(t *testing.T) {
+	w := generateTestWallet(t)
+
+	srv, offerURI := setupMockIssuer(t, w, mockIssuerOpts{
+		tokenCNonce:        "test-c-nonce",
+		credentialResponse: map[string]any{"transaction_id": "tx-gone"},
+		deferredHandler: func(t *testing.T, reqBody map[string]any) (int, map[string]any) {
+			return http.StatusBadRequest, map[string]any{"error": "invalid_transaction_id"}
+		},
+	})
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	result, err := w.ProcessCredentialOffer(offerURI)
+	if err != nil {
+		t.Fatalf("ProcessCredentialOffer (deferred): %v", err)
+	}
+	if pending := w.GetPendingIssuances(); pending[0].Interval != int(defaultDeferredInterval/time.Second) {
+		t.Errorf("expected default interval, got %d", pending[0].Interval)
+	}
+
+	if _, err := w.RetryPendingIssuance(result.PendingID); err == nil || !strings.Contains(err.Error(), "invalid_transaction_id") {
+		t.Fatalf("expected invalid_transaction_id error, got: %v", err)
+	}
+	if len(w.GetPendingIssuances()) != 0 {
+		t.Error("expected pending issuance to be removed after invalid_transaction_id")
+	}
+}
+
+func TestReschedulePendingIssuance_BackOff(t *testing.T) {
+	w := generateTestWallet(t)
+	w.PendingIssuances = []PendingIssuance{{ID: "p1", Interval: 5}}
+
+	w.reschedulePendingIssuance("p1", nil, "temporary failure")
+	p := w.GetPendingIssuances()[0]
+	if p.Interval != 10 || p.Attempts != 1 || p.LastError != "temporary failure" {
+		t.Errorf("expected doubled interval after failure, got %+v", p)
+	}
+
+	w.PendingIssuances[0].Interval = 200
+	w.reschedulePendingIssuance("p1", nil, "")
+	if p := w.GetPendingIssuances()[0]; p.Interval != int(maxDeferredInterval/time.Second) {
+		t.Errorf("expected interval capped at %v, got %ds", maxDeferredInterval, p.Interval)
+	}
+}
+
+// authCodeIssuerOptions customizes the authorization server side of
+// setupAuthCodeIssuer.
+type authCodeIssuerOptions struct {
+	// ASMetadata is merged into the OAuth authorization server metadata.
+	ASMetadata map[string]any
+	// PAR handles POST /par; the endpoint is only advertised when set.
+	PAR func(rw http.ResponseWriter, form url.Values)
+	// OnRequest, if set, is called with every request before it is handled.
+	OnRequest func(r *http.Request)
+}
+
+// setupAuthCodeIssuer starts a mock issuer that only supports the
+// authorization code flow and verifies the PKCE code_verifier at the token
+// endpoint against the code_challenge seen by the authorization hook.
+func setupAuthCodeIssuer(t *testing.T, w *Wallet, challenge *string, opts *authCodeIssuerOptions) *httptest.Server {
+	t.Helper()
+	if opts == nil {
+		opts = &authCodeIssuerOptions{}
+	}
+
+	credRaw := generateTestCredential(t, w)
+	var serverURL string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if opts.OnRequest != nil {
+			opts.OnRequest(r)
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/.well-known/openid-credential-issuer"):
+			json.NewEncoder(rw).Encode(map[string]any{
+				"credential_issuer":   serverURL,
+				"credential_endpoint": serverURL + "/credential",
+				"credential_configurations_supported": map[string]any{
+					"test-config": map[string]any{"format": "dc+sd-jwt", "scope": "test_scope"},
+				},
+			})
+
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/.well-known/oauth-authorization-server"):
+			meta := map[string]any{
+				"issuer":                 serverURL,
+				"authorization_endpoint": serverURL + "/authorize",
+				"token_endpoint":         serverURL + "/token",
+			}
+			if opts.PAR != nil {
+				meta["pushed_authorization_request_endpoint"] = serverURL + "/par"
+			}
+			for k, v := range opts.ASMetadata {
+				meta[k] = v
+			}
+			json.NewEncoder(rw).Encode(meta)
+
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/par") && opts.PAR != nil:
+			body, _ := io.ReadAll(r.Body)
+			form, _ := url.ParseQuery(string(body))
+			opts.PAR(rw, form)
+
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/token"):
+			body, _ := io.ReadAll(r.Body)
+			form, _ := url.ParseQuery(string(body))
+			if form.Get("grant_type") != "authorization_code" || form.Get("code") != "auth-code-123" {
+				rw.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(rw).Encode(map[string]string{"error": "invalid_grant"})
+				return
+			}
+			h := sha256.Sum256([]byte(form.Get("code_verifier")))
+			if format.EncodeBase64URL(h[:]) != *challenge {
+				rw.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(rw).Encode(map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+				return
+			}
+			if form.Get("redirect_uri") != "http://localhost:8085/callback" || form.Get("client_id") != "test-client" {
+				rw.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(rw).Encode(map[string]string{"error": "invalid_client"})
+				return
+			}
+			json.NewEncoder(rw).Encode(map[string]any{
+				"access_token": "test-access-token",
+				"token_type":   "Bearer",
+				"c_nonce":      "test-c-nonce",
+			})
+
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/credential"):
+			if r.Header.Get("Authorization") != "Bearer test-access-token" {
+				rw.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(rw).Encode(map[string]string{"error": "invalid_token"})
+				return
+			}
+			json.NewEncoder(rw).Encode(map[string]any{"credential": credRaw})
+
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	serverURL = srv.URL
+	return srv
+}
+
+func authCodeOfferURI(issuer string) string {
 	offer := map[string]any{
-		"credential_issuer":            "https://issuer.example",
+		"credential_issuer":            issuer,
 		"credential_configuration_ids": []string{"test-config"},
 		"grants": map[string]any{
 			"authorization_code": map[string]any{
-				"issuer_state": "some-state",
+				"issuer_state": "issuer-state-xyz",
 			},
 		},
 	}
 	offerJSON, _ := json.Marshal(offer)
-	offerURI := "openid-credential-offer://?credential_offer=" + url.QueryEscape(string(offerJSON))
+	return "openid-credential-offer://?credential_offer=" + url.QueryEscape(string(offerJSON))
+}
 
-	_, err := w.ProcessCredentialOffer(offerURI)
+func TestProcessCredentialOffer_AuthorizationCodeFlow(t *testing.T) {
+	w := generateTestWallet(t)
+	var challenge string
+	srv := setupAuthCodeIssuer(t, w, &challenge, nil)
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	w.IssuanceClientID = "test-client"
+	w.IssuanceRedirectURI = "http://localhost:8085/callback"
+	w.OnAuthorizationURL = func(authURL string) error {
+		u, err := url.Parse(authURL)
+		if err != nil {
+			t.Fatalf("parsing authorization URL: %v", err)
+		}
+		if u.Path != "/authorize" {
+			t.Errorf("expected /authorize endpoint, got %s", u.Path)
+		}
+		q := u.Query()
+		if q.Get("response_type") != "code" {
+			t.Errorf("expected response_type=code, got %q", q.Get("response_type"))
+		}
+		if q.Get("code_challenge_method") != "S256" {
+			t.Errorf("expected code_challenge_method=S256, got %q", q.Get("code_challenge_method"))
+		}
+		if q.Get("issuer_state") != "issuer-state-xyz" {
+			t.Errorf("expected issuer_state round trip, got %q", q.Get("issuer_state"))
+		}
+		var details []map[string]any
+		if err := json.Unmarshal([]byte(q.Get("authorization_details")), &details); err != nil || len(details) != 1 {
+			t.Fatalf("expected one authorization_details entry, got %q", q.Get("authorization_details"))
+		}
+		if details[0]["type"] != "openid_credential" || details[0]["credential_configuration_id"] != "test-config" {
+			t.Errorf("unexpected authorization_details: %v", details[0])
+		}
+		challenge = q.Get("code_challenge")
+		if !w.CompleteAuthorization(q.Get("state"), AuthorizationCallback{Code: "auth-code-123"}) {
+			t.Fatal("expected pending authorization for state")
+		}
+		return nil
+	}
+
+	result, err := w.ProcessCredentialOffer(authCodeOfferURI(srv.URL))
+	if err != nil {
+		t.Fatalf("ProcessCredentialOffer (authorization code): %v", err)
+	}
+	if result.CredentialID == "" {
+		t.Error("expected non-empty credential ID")
+	}
+	if len(w.GetCredentials()) != 1 {
+		t.Fatalf("expected 1 credential, got %d", len(w.GetCredentials()))
+	}
+}
+
+func TestProcessCredentialOffer_AuthorizationCodeDenied(t *testing.T) {
+	w := generateTestWallet(t)
+	var challenge string
+	srv := setupAuthCodeIssuer(t, w, &challenge, nil)
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	w.IssuanceRedirectURI = "http://localhost:8085/callback"
+	w.OnAuthorizationURL = func(authURL string) error {
+		u, _ := url.Parse(authURL)
+		w.CompleteAuthorization(u.Query().Get("state"), AuthorizationCallback{Error: "access_denied", ErrorDescription: "user cancelled"})
+		return nil
+	}
+
+	_, err := w.ProcessCredentialOffer(authCodeOfferURI(srv.URL))
+	if err == nil {
+		t.Fatal("expected error when authorization is denied")
+	}
+	if !strings.Contains(err.Error(), "access_denied") {
+		t.Errorf("expected access_denied in error, got: %v", err)
+	}
+	if len(w.GetCredentials()) != 0 {
+		t.Errorf("expected no credentials, got %d", len(w.GetCredentials()))
+	}
+}
+
+func TestProcessCredentialOffer_AuthorizationCodeRequiresCallbackListener(t *testing.T) {
+	w := generateTestWallet(t)
+	var challenge string
+	srv := setupAuthCodeIssuer(t, w, &challenge, nil)
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	_, err := w.ProcessCredentialOffer(authCodeOfferURI(srv.URL))
 	if err == nil {
-		t.Fatal("expected error for authorization_code-only offer")
+		t.Fatal("expected error without a configured redirect_uri")
+	}
+	if !strings.Contains(err.Error(), "redirect_uri") {
+		t.Errorf("expected error about redirect_uri, got: %v", err)
+	}
+}
+
+func TestProcessCredentialOffer_PushedAuthorizationRequest(t *testing.T) {
+	w := generateTestWallet(t)
+	var challenge, state string
+	var pushed url.Values
+	srv := setupAuthCodeIssuer(t, w, &challenge, &authCodeIssuerOptions{
+		// Without openid_credential support the wallet falls back to scope
+		ASMetadata: map[string]any{"authorization_details_types_supported": []string{}},
+		PAR: func(rw http.ResponseWriter, form url.Values) {
+			pushed = form
+			challenge = form.Get("code_challenge")
+			state = form.Get("state")
+			rw.WriteHeader(http.StatusCreated)
+			json.NewEncoder(rw).Encode(map[string]any{
+				"request_uri": "urn:ietf:params:oauth:request_uri:abc",
+				"expires_in":  60,
+			})
+		},
+	})
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	w.IssuanceClientID = "test-client"
+	w.IssuanceRedirectURI = "http://localhost:8085/callback"
+	w.OnAuthorizationURL = func(authURL string) error {
+		u, _ := url.Parse(authURL)
+		q := u.Query()
+		if q.Get("request_uri") != "urn:ietf:params:oauth:request_uri:abc" {
+			t.Errorf("expected request_uri from PAR response, got %q", q.Get("request_uri"))
+		}
+		if q.Get("client_id") != "test-client" {
+			t.Errorf("expected client_id, got %q", q.Get("client_id"))
+		}
+		if q.Get("code_challenge") != "" || q.Get("state") != "" {
+			t.Errorf("expected only client_id and request_uri in front channel, got %v", q)
+		}
+		w.CompleteAuthorization(state, AuthorizationCallback{Code: "auth-code-123"})
+		return nil
+	}
+
+	if _, err := w.ProcessCredentialOffer(authCodeOfferURI(srv.URL)); err != nil {
+		t.Fatalf("ProcessCredentialOffer (PAR): %v", err)
+	}
+	if pushed.Get("scope") != "test_scope" {
+		t.Errorf("expected scope test_scope in PAR request, got %q", pushed.Get("scope"))
+	}
+	if pushed.Get("authorization_details") != "" {
+		t.Errorf("expected no authorization_details when scope is used, got %q", pushed.Get("authorization_details"))
+	}
+	if pushed.Get("issuer_state") != "issuer-state-xyz" {
+		t.Errorf("expected issuer_state in PAR request, got %q", pushed.Get("issuer_state"))
+	}
+}
+
+func TestProcessCredentialOffer_PushedAuthorizationRequestFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    ValidationMode
+		wantErr bool
+	}{
+		{"strict rejects", ValidationModeStrict, true},
+		{"debug falls back", ValidationModeDebug, false},
 	}
-	if !strings.Contains(err.Error(), "authorization_code") {
-		t.Errorf("expected error about authorization_code, got: %v", err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := generateTestWallet(t)
+			w.ValidationMode = tt.mode
+			var challenge string
+			srv := setupAuthCodeIssuer(t, w, &challenge, &authCodeIssuerOptions{
+				ASMetadata: map[string]any{"require_pushed_authorization_requests": true},
+				PAR: func(rw http.ResponseWriter, form url.Values) {
+					rw.WriteHeader(http.StatusBadRequest)
+					json.NewEncoder(rw).Encode(map[string]string{"error": "invalid_request"})
+				},
+			})
+			defer srv.Close()
+
+			oldClient := httpClient
+			httpClient = srv.Client()
+			defer func() { httpClient = oldClient }()
+
+			w.IssuanceClientID = "test-client"
+			w.IssuanceRedirectURI = "http://localhost:8085/callback"
+			w.OnAuthorizationURL = func(authURL string) error {
+				u, _ := url.Parse(authURL)
+				q := u.Query()
+				challenge = q.Get("code_challenge")
+				w.CompleteAuthorization(q.Get("state"), AuthorizationCallback{Code: "auth-code-123"})
+				return nil
+			}
+
+			_, err := w.ProcessCredentialOffer(authCodeOfferURI(srv.URL))
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "invalid_request") {
+					t.Fatalf("expected PAR error, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected fallback to front-channel request, got: %v", err)
+			}
+		})
 	}
 }
 
@@ -0,0 +1,291 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"crypto"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/jsonutil"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
+	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
+)
+
+// Proof types of OID4VCI credential requests (OID4VCI 1.0 Appendix F).
+const (
+	ProofTypeJWT         = "jwt"
+	ProofTypeAttestation = "attestation"
+	ProofTypeDIVP        = "di_vp"
+)
+
+// ParseProofType parses a proof type override. An empty value or "auto"
+// returns "", which lets the wallet choose from proof_types_supported.
+func ParseProofType(raw string) (string, error) {
+	switch t := strings.ToLower(strings.TrimSpace(raw)); t {
+	case "", "auto":
+		return "", nil
+	case ProofTypeJWT, ProofTypeAttestation, ProofTypeDIVP:
+		return t, nil
+	default:
+		return "", fmt.Errorf("invalid proof type %q (expected 'auto', 'jwt', 'attestation', or 'di_vp')", raw)
+	}
+}
+
+// Attack potential resistance levels for key_storage and user_authentication
+// in key attestations (OID4VCI 1.0 Appendix D.2, ISO/IEC 18045).
+const (
+	KeyAttestationLevelHigh          = "iso_18045_high"
+	KeyAttestationLevelModerate      = "iso_18045_moderate"
+	KeyAttestationLevelEnhancedBasic = "iso_18045_enhanced-basic"
+	KeyAttestationLevelBasic         = "iso_18045_basic"
+)
+
+// KeyAttestationConfig sets the key_storage and user_authentication values
+// claimed in key attestations. An empty list claims the first value the
+// issuer accepts, or iso_18045_high if the issuer states none.
+type KeyAttestationConfig struct {
+	KeyStorage         []string
+	UserAuthentication []string
+}
+
+// credentialProofs is the proofs object of a credential request, keyed by
+// proof type. jwt and attestation proofs are strings, di_vp proofs are
+// JSON objects.
+type credentialProofs map[string][]any
+
+// proofRequirements describes how a credential request proves possession of
+// the holder keys, as derived from proof_types_supported.
+type proofRequirements struct {
+	Type               string   // ProofTypeJWT, ProofTypeAttestation, or ProofTypeDIVP
+	KeyAttestation     bool     // a key attestation must be sent
+	KeyStorage         []string // key_storage values accepted by the issuer
+	UserAuthentication []string // user_authentication values accepted by the issuer
+}
+
+// resolveProof determines the proof type of a credential request and checks
+// that the issuer accepts it. Strict mode rejects a proof the issuer does not
+// accept; debug mode logs a warning and sends it anyway.
+func (w *Wallet) resolveProof(metadata map[string]any, configID string) (proofRequirements, error) {
+	w.mu.RLock()
+	override, mode := w.ProofType, w.ValidationMode
+	w.mu.RUnlock()
+
+	req, problems := resolveProofRequirements(metadata, configID, override, w.holderAlg())
+	if len(problems) > 0 && mode == ValidationModeStrict {
+		return req, fmt.Errorf("proof type %s: %s", req.Type, strings.Join(problems, "; "))
+	}
+	for _, p := range problems {
+		log.Printf("[VCI] Warning: %s", p)
+	}
+	log.Printf("[VCI] Proof type: %s", req.Type)
+	return req, nil
+}
+
+// resolveProofRequirements reads proof_types_supported of a credential
+// configuration. Without an override, the jwt proof type is preferred,
+// followed by attestation and di_vp; configurations without
+// proof_types_supported get jwt proofs. The returned problems describe why
+// the issuer may not accept the chosen proof signed with the holder key
+// algorithm alg.
+func resolveProofRequirements(metadata map[string]any, configID, override string, alg keys.Algorithm) (proofRequirements, []string) {
+	configs := jsonutil.GetMap(metadata, "credential_configurations_supported")
+	proofTypes := jsonutil.GetMap(jsonutil.GetMap(configs, configID), "proof_types_supported")
+
+	names := make([]string, 0, len(proofTypes))
+	for name := range proofTypes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var problems []string
+	req := proofRequirements{Type: override}
+	if req.Type == "" {
+		for _, t := range []string{ProofTypeJWT, ProofTypeAttestation, ProofTypeDIVP} {
+			if proofTypes[t] != nil {
+				req.Type = t
+				break
+			}
+		}
+		if req.Type == "" {
+			req.Type = ProofTypeJWT
+			if len(proofTypes) > 0 {
+				problems = append(problems, fmt.Sprintf("no supported proof type in proof_types_supported (%s); sending jwt proofs", strings.Join(names, ", ")))
+			}
+		}
+	} else if len(proofTypes) > 0 && proofTypes[req.Type] == nil {
+		problems = append(problems, fmt.Sprintf("issuer does not accept %s proofs (proof_types_supported: %s)", req.Type, strings.Join(names, ", ")))
+	}
+	if req.Type == ProofTypeAttestation {
+		req.KeyAttestation = true
+	}
+
+	proofType := jsonutil.GetMap(proofTypes, req.Type)
+	signing := string(alg)
+	if req.Type == ProofTypeDIVP {
+		if signing = diVPCryptosuite(alg); signing == "" {
+			problems = append(problems, fmt.Sprintf("di_vp proofs need a P-256, P-384 or Ed25519 holder key, not %s", alg))
+			return req, problems
+		}
+	}
+	if accepted := stringValues(proofType["proof_signing_alg_values_supported"]); len(accepted) > 0 && !slices.Contains(accepted, signing) {
+		problems = append(problems, fmt.Sprintf("issuer accepts %s proofs signed with %s, but the wallet uses %s", req.Type, strings.Join(accepted, ", "), signing))
+	}
+
+	if required, ok := proofType["key_attestations_required"].(map[string]any); ok {
+		if req.Type == ProofTypeDIVP {
+			problems = append(problems, "issuer requires a key attestation, which di_vp proofs cannot carry")
+			return req, problems
+		}
+		req.KeyAttestation = true
+		req.KeyStorage = stringValues(required["key_storage"])
+		req.UserAuthentication = stringValues(required["user_authentication"])
+	}
+	return req, problems
+}
+
+// createProofs builds the proofs of a credential request for the holder
+// keys. With a key attestation, a single jwt proof signed by the first key
+// carries the attestation of all keys in its key_attestation header, or the
+// key attestation itself is sent as attestation proof. di_vp proofs are one
+// signed presentation per key.
+func (w *Wallet) createProofs(req proofRequirements, holderKeys []crypto.Signer, audience, cNonce string) (credentialProofs, error) {
+	if req.Type == ProofTypeDIVP {
+		vps, err := createDIVPProofs(holderKeys, audience, cNonce)
+		if err != nil {
+			return nil, err
+		}
+		return credentialProofs{ProofTypeDIVP: vps}, nil
+	}
+	if !req.KeyAttestation {
+		jwts, err := createProofJWTs(holderKeys, w.holderAlg(), audience, cNonce)
+		if err != nil {
+			return nil, err
+		}
+		return credentialProofs{ProofTypeJWT: jwts}, nil
+	}
+
+	if req.Type == ProofTypeAttestation {
+		attestation, err := w.createKeyAttestation(req, holderKeys, cNonce)
+		if err != nil {
+			return nil, err
+		}
+		return credentialProofs{ProofTypeAttestation: {attestation}}, nil
+	}
+
+	attestation, err := w.createKeyAttestation(req, holderKeys, "")
+	if err != nil {
+		return nil, err
+	}
+	proofJWT, err := createProofJWT(holderKeys[0], w.holderAlg(), audience, cNonce, attestation)
+	if err != nil {
+		return nil, err
+	}
+	return credentialProofs{ProofTypeJWT: {proofJWT}}, nil
+}
+
+// createKeyAttestation mints a key-attestation+jwt signed by the mock wallet
+// provider that lists the holder keys as attested_keys. cNonce is included
+// when the attestation is itself the proof.
+func (w *Wallet) createKeyAttestation(req proofRequirements, holderKeys []crypto.Signer, cNonce string) (string, error) {
+	provider, _, err := w.walletProvider()
+	if err != nil {
+		return "", err
+	}
+	w.mu.RLock()
+	cfg := w.KeyAttestation
+	w.mu.RUnlock()
+
+	attestedKeys := make([]any, len(holderKeys))
+	for i, key := range holderKeys {
+		attestedKeys[i] = mock.PublicKeyJWKMap(key.Public())
+	}
+	keyStorage := keyAttestationLevels("key_storage", cfg.KeyStorage, req.KeyStorage)
+	userAuthentication := keyAttestationLevels("user_authentication", cfg.UserAuthentication, req.UserAuthentication)
+
+	header := map[string]any{
+		"alg": "ES256",
+		"typ": "key-attestation+jwt",
+		"x5c": provider.x5c(),
+	}
+
+	now := time.Now()
+	payload := map[string]any{
+		"iss":                 DefaultWalletProviderID,
+		"iat":                 now.Unix(),
+		"exp":                 now.Add(defaultAttestationLifetime).Unix(),
+		"attested_keys":       attestedKeys,
+		"key_storage":         keyStorage,
+		"user_authentication": userAuthentication,
+	}
+	if cNonce != "" {
+		payload["nonce"] = cNonce
+	}
+
+	log.Printf("[VCI] Key attestation for %d key(s): key_storage=%s user_authentication=%s",
+		len(holderKeys), strings.Join(keyStorage, ","), strings.Join(userAuthentication, ","))
+	return signJWT(header, payload, provider.Key)
+}
+
+// keyAttestationLevels returns the configured levels, or the first level the
+// issuer accepts. Configured levels the issuer does not accept are kept so
+// that issuers can be tested with insufficient attestations, but a warning
+// is logged.
+func keyAttestationLevels(name string, configured, accepted []string) []string {
+	if len(configured) == 0 {
+		if len(accepted) > 0 {
+			return accepted[:1]
+		}
+		return []string{KeyAttestationLevelHigh}
+	}
+	if len(accepted) > 0 && !slices.ContainsFunc(configured, func(l string) bool { return slices.Contains(accepted, l) }) {
+		log.Printf("[VCI] Warning: configured %s %v is not accepted by the issuer (%v)", name, configured, accepted)
+	}
+	return configured
+}
+
+// stringValues returns the string entries of a JSON array.
+func stringValues(v any) []string {
+	arr, _ := v.([]any)
+	var out []string
+	for _, e := range arr {
+		if s, ok := e.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// ParseKeyAttestationLevels normalizes key_storage or user_authentication
+// values. The ISO 18045 levels may be abbreviated ("high" for
+// iso_18045_high); other values are passed through since issuers may define
+// their own.
+func ParseKeyAttestationLevels(raw []string) []string {
+	var out []string
+	for _, l := range raw {
+		l = strings.TrimSpace(l)
+		switch strings.ToLower(l) {
+		case "":
+			continue
+		case "high", "moderate", "enhanced-basic", "basic":
+			l = "iso_18045_" + strings.ToLower(l)
+		}
+		out = append(out, l)
+	}
+	return out
+}
@@ -0,0 +1,323 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
+	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
+)
+
+func TestResolveProofRequirements(t *testing.T) {
+	metadata := func(proofTypes map[string]any) map[string]any {
+		cfg := map[string]any{"format": "dc+sd-jwt"}
+		if proofTypes != nil {
+			cfg["proof_types_supported"] = proofTypes
+		}
+		return map[string]any{
+			"credential_configurations_supported": map[string]any{"cfg": cfg},
+		}
+	}
+	required := map[string]any{
+		"key_attestations_required": map[string]any{
+			"key_storage":         []any{"iso_18045_moderate", "iso_18045_high"},
+			"user_authentication": []any{"iso_18045_high"},
+		},
+	}
+
+	algs := func(values ...any) map[string]any {
+		return map[string]any{"proof_signing_alg_values_supported": values}
+	}
+
+	tests := []struct {
+		name     string
+		meta     map[string]any
+		override string
+		want     proofRequirements
+		problems int
+	}{
+		{"no proof types", metadata(nil), "", proofRequirements{Type: ProofTypeJWT}, 0},
+		{"plain jwt", metadata(map[string]any{"jwt": map[string]any{}}), "", proofRequirements{Type: ProofTypeJWT}, 0},
+		{"jwt with key attestation", metadata(map[string]any{"jwt": required}), "", proofRequirements{
+			Type:               ProofTypeJWT,
+			KeyAttestation:     true,
+			KeyStorage:         []string{"iso_18045_moderate", "iso_18045_high"},
+			UserAuthentication: []string{"iso_18045_high"},
+		}, 0},
+		{"jwt preferred over attestation", metadata(map[string]any{"jwt": map[string]any{}, "attestation": required}), "", proofRequirements{Type: ProofTypeJWT}, 0},
+		{"attestation only", metadata(map[string]any{"attestation": map[string]any{}}), "", proofRequirements{Type: ProofTypeAttestation, KeyAttestation: true}, 0},
+		{"attestation preferred over di_vp", metadata(map[string]any{"di_vp": map[string]any{}, "attestation": map[string]any{}}), "", proofRequirements{Type: ProofTypeAttestation, KeyAttestation: true}, 0},
+		{"di_vp only", metadata(map[string]any{"di_vp": algs("ecdsa-rdfc-2019", "ecdsa-jcs-2019")}), "", proofRequirements{Type: ProofTypeDIVP}, 0},
+		{"unsupported proof type", metadata(map[string]any{"cwt": map[string]any{}}), "", proofRequirements{Type: ProofTypeJWT}, 1},
+		{"override accepted", metadata(map[string]any{"jwt": map[string]any{}, "di_vp": map[string]any{}}), ProofTypeDIVP, proofRequirements{Type: ProofTypeDIVP}, 0},
+		{"override not accepted", metadata(map[string]any{"jwt": map[string]any{}}), ProofTypeAttestation, proofRequirements{Type: ProofTypeAttestation, KeyAttestation: true}, 1},
+		{"override without proof types", metadata(nil), ProofTypeDIVP, proofRequirements{Type: ProofTypeDIVP}, 0},
+		{"jwt signing alg not accepted", metadata(map[string]any{"jwt": algs("EdDSA")}), "", proofRequirements{Type: ProofTypeJWT}, 1},
+		{"di_vp cryptosuite not accepted", metadata(map[string]any{"di_vp": algs("ecdsa-rdfc-2019")}), "", proofRequirements{Type: ProofTypeDIVP}, 1},
+		{"di_vp with key attestation", metadata(map[string]any{"di_vp": required}), "", proofRequirements{Type: ProofTypeDIVP}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, problems := resolveProofRequirements(tt.meta, "cfg", tt.override, keys.ES256)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveProofRequirements() = %+v, want %+v", got, tt.want)
+			}
+			if len(problems) != tt.problems {
+				t.Errorf("problems = %q, want %d", problems, tt.problems)
+			}
+		})
+	}
+}
+
+func TestParseProofType(t *testing.T) {
+	for raw, want := range map[string]string{"": "", "auto": "", "JWT": ProofTypeJWT, "attestation": ProofTypeAttestation, " di_vp ": ProofTypeDIVP} {
+		if got, err := ParseProofType(raw); err != nil || got != want {
+			t.Errorf("ParseProofType(%q) = %q, %v; want %q", raw, got, err, want)
+		}
+	}
+	if _, err := ParseProofType("ldp_vp"); err == nil {
+		t.Error("expected error for unknown proof type")
+	}
+}
+
+func TestParseKeyAttestationLevels(t *testing.T) {
+	got := ParseKeyAttestationLevels([]string{"high", " Enhanced-Basic ", "", "custom_level"})
+	want := []string{KeyAttestationLevelHigh, KeyAttestationLevelEnhancedBasic, "custom_level"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseKeyAttestationLevels() = %v, want %v", got, want)
+	}
+}
+
+func TestKeyAttestationLevels(t *testing.T) {
+	accepted := []string{KeyAttestationLevelModerate, KeyAttestationLevelHigh}
+	if got := keyAttestationLevels("key_storage", nil, accepted); !reflect.DeepEqual(got, []string{KeyAttestationLevelModerate}) {
+		t.Errorf("default with accepted levels = %v", got)
+	}
+	if got := keyAttestationLevels("key_storage", nil, nil); !reflect.DeepEqual(got, []string{KeyAttestationLevelHigh}) {
+		t.Errorf("default without accepted levels = %v", got)
+	}
+	configured := []string{KeyAttestationLevelBasic}
+	if got := keyAttestationLevels("key_storage", configured, accepted); !reflect.DeepEqual(got, configured) {
+		t.Errorf("configured levels must be kept even if not accepted, got %v", got)
+	}
+}
+
+// verifyKeyAttestation checks a key-attestation+jwt the way an issuer would,
+// trusting the wallet's CA, and returns its claims and attested keys.
+func verifyKeyAttestation(t *testing.T, w *Wallet, attestation string) (map[string]any, []*ecdsa.PublicKey) {
+	t.Helper()
+	header, claims, _, err := format.ParseJWTParts(attestation)
+	if err != nil {
+		t.Fatalf("parsing key attestation: %v", err)
+	}
+	if header["typ"] != "key-attestation+jwt" {
+		t.Fatalf("unexpected key attestation typ %v", header["typ"])
+	}
+	x5c, _ := header["x5c"].([]any)
+	if len(x5c) != 2 {
+		t.Fatalf("expected x5c chain of 2, got %d", len(x5c))
+	}
+	der, _ := base64.StdEncoding.DecodeString(x5c[0].(string))
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parsing x5c leaf: %v", err)
+	}
+	if err := leaf.CheckSignatureFrom(w.CertChain[1]); err != nil {
+		t.Fatalf("x5c leaf not issued by wallet CA: %v", err)
+	}
+	if !verifyES256(t, attestation, leaf.PublicKey.(*ecdsa.PublicKey)) {
+		t.Fatal("key attestation signature invalid")
+	}
+	if claims["iss"] != DefaultWalletProviderID {
+		t.Errorf("iss = %v, want %s", claims["iss"], DefaultWalletProviderID)
+	}
+	if exp, _ := claims["exp"].(float64); int64(exp) < time.Now().Unix() {
+		t.Error("key attestation expired")
+	}
+
+	var attested []*ecdsa.PublicKey
+	for _, k := range claims["attested_keys"].([]any) {
+		jwkJSON, _ := json.Marshal(k)
+		pub, err := keys.ParseJWK(jwkJSON)
+		if err != nil {
+			t.Fatalf("parsing attested key: %v", err)
+		}
+		attested = append(attested, pub.(*ecdsa.PublicKey))
+	}
+	return claims, attested
+}
+
+// issueForKeys returns a credentials response with one SD-JWT bound to each key.
+func issueForKeys(t *testing.T, w *Wallet, holderKeys []*ecdsa.PublicKey) map[string]any {
+	t.Helper()
+	var creds []any
+	for _, pub := range holderKeys {
+		cred, err := mock.GenerateSDJWT(mock.SDJWTConfig{
+			Issuer:    "https://test-issuer.example",
+			VCT:       "TestIssuedCred",
+			ExpiresIn: 24 * time.Hour,
+			Claims:    map[string]any{"given_name": "Test"},
+			Key:       w.IssuerKey,
+			HolderKey: pub,
+		})
+		if err != nil {
+			t.Fatalf("generating credential: %v", err)
+		}
+		creds = append(creds, map[string]any{"credential": cred})
+	}
+	return map[string]any{"credentials": creds}
+}
+
+func keyAttestationConfigMetadata(proofTypes map[string]any) map[string]any {
+	return map[string]any{
+		"batch_credential_issuance": map[string]any{"batch_size": 2},
+		"credential_configurations_supported": map[string]any{
+			"test-config": map[string]any{
+				"format":                "dc+sd-jwt",
+				"proof_types_supported": proofTypes,
+			},
+		},
+	}
+}
+
+func TestProcessCredentialOffer_KeyAttestationInProofJWT(t *testing.T) {
+	w := generateTestWallet(t)
+
+	srv, offerURI := setupMockIssuer(t, w, mockIssuerOpts{
+		tokenCNonce: "test-c-nonce",
+		issuerMetadata: keyAttestationConfigMetadata(map[string]any{
+			"jwt": map[string]any{
+				"proof_signing_alg_values_supported": []any{"ES256"},
+				"key_attestations_required": map[string]any{
+					"key_storage":         []any{"iso_18045_moderate", "iso_18045_high"},
+					"user_authentication": []any{"iso_18045_high"},
+				},
+			},
+		}),
+		credentialHandler: func(t *testing.T, reqBody map[string]any) map[string]any {
+			t.Helper()
+			proofs, _ := reqBody["proofs"].(map[string]any)
+			jwts, _ := proofs["jwt"].([]any)
+			if len(jwts) != 1 {
+				t.Fatalf("expected a single jwt proof carrying the key attestation, got %d", len(jwts))
+			}
+			header, payload, _, err := format.ParseJWTParts(jwts[0].(string))
+			if err != nil {
+				t.Fatalf("parsing proof JWT: %v", err)
+			}
+			if payload["nonce"] != "test-c-nonce" {
+				t.Errorf("proof nonce = %v", payload["nonce"])
+			}
+			attestation, _ := header["key_attestation"].(string)
+			if attestation == "" {
+				t.Fatal("proof JWT has no key_attestation header")
+			}
+			claims, attested := verifyKeyAttestation(t, w, attestation)
+			if len(attested) != 2 {
+				t.Fatalf("expected 2 attested keys, got %d", len(attested))
+			}
+			if _, ok := claims["nonce"]; ok {
+				t.Error("key attestation in a jwt proof must not carry the nonce")
+			}
+			if !reflect.DeepEqual(claims["key_storage"], []any{"iso_18045_moderate"}) {
+				t.Errorf("key_storage = %v, want the first accepted level", claims["key_storage"])
+			}
+			if !reflect.DeepEqual(claims["user_authentication"], []any{"iso_18045_high"}) {
+				t.Errorf("user_authentication = %v", claims["user_authentication"])
+			}
+			if !verifyES256(t, jwts[0].(string), attested[0]) {
+				t.Error("proof JWT must be signed by the first attested key")
+			}
+			return issueForKeys(t, w, attested)
+		},
+	})
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	result, err := w.ProcessCredentialOffer(offerURI)
+	if err != nil {
+		t.Fatalf("ProcessCredentialOffer: %v", err)
+	}
+	if result.Instances != 2 {
+		t.Errorf("expected 2 instances, got %d", result.Instances)
+	}
+}
+
+func TestProcessCredentialOffer_AttestationProofType(t *testing.T) {
+	w := generateTestWallet(t)
+	w.KeyAttestation = KeyAttestationConfig{
+		KeyStorage:         []string{KeyAttestationLevelBasic},
+		UserAuthentication: []string{KeyAttestationLevelModerate},
+	}
+
+	srv, offerURI := setupMockIssuer(t, w, mockIssuerOpts{
+		tokenCNonce: "test-c-nonce",
+		issuerMetadata: keyAttestationConfigMetadata(map[string]any{
+			"attestation": map[string]any{
+				"proof_signing_alg_values_supported": []any{"ES256"},
+				"key_attestations_required":          map[string]any{},
+			},
+		}),
+		credentialHandler: func(t *testing.T, reqBody map[string]any) map[string]any {
+			t.Helper()
+			proofs, _ := reqBody["proofs"].(map[string]any)
+			if _, ok := proofs["jwt"]; ok {
+				t.Error("expected no jwt proofs with the attestation proof type")
+			}
+			attestations, _ := proofs["attestation"].([]any)
+			if len(attestations) != 1 {
+				t.Fatalf("expected a single attestation proof, got %d", len(attestations))
+			}
+			claims, attested := verifyKeyAttestation(t, w, attestations[0].(string))
+			if claims["nonce"] != "test-c-nonce" {
+				t.Errorf("attestation proof nonce = %v, want c_nonce", claims["nonce"])
+			}
+			if !reflect.DeepEqual(claims["key_storage"], []any{KeyAttestationLevelBasic}) {
+				t.Errorf("key_storage = %v, want configured level", claims["key_storage"])
+			}
+			if !reflect.DeepEqual(claims["user_authentication"], []any{KeyAttestationLevelModerate}) {
+				t.Errorf("user_authentication = %v, want configured level", claims["user_authentication"])
+			}
+			if len(attested) != 2 {
+				t.Fatalf("expected 2 attested keys, got %d", len(attested))
+			}
+			return issueForKeys(t, w, attested)
+		},
+	})
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	result, err := w.ProcessCredentialOffer(offerURI)
+	if err != nil {
+		t.Fatalf("ProcessCredentialOffer: %v", err)
+	}
+	if result.Instances != 2 {
+		t.Errorf("expected 2 instances, got %d", result.Instances)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Notification events (OID4VCI 1.0 Section 11).
+const (
+	NotificationCredentialAccepted = "credential_accepted"
+	NotificationCredentialFailure  = "credential_failure"
+	NotificationCredentialDeleted  = "credential_deleted"
+)
+
+// CredentialNotification holds what the wallet needs to notify the issuer
+// about a credential. It is persisted with the credential so that a later
+// deletion can still be reported.
+type CredentialNotification struct {
+	ID          string `json:"notification_id"`
+	Endpoint    string `json:"notification_endpoint"`
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type,omitempty"` // "DPoP" for DPoP-bound access tokens
+}
+
+// getNotificationEndpoint returns the notification_endpoint from the issuer
+// metadata, or "" if the issuer does not support notifications.
+func getNotificationEndpoint(metadata map[string]any) string {
+	ep, _ := metadata["notification_endpoint"].(string)
+	return ep
+}
+
+// responseNotification returns the notification of a credential or deferred
+// credential response, or nil if the response has no notification_id.
+func responseNotification(resp map[string]any, endpoint string, auth accessTokenAuth) *CredentialNotification {
+	id, _ := resp["notification_id"].(string)
+	if id == "" {
+		return nil
+	}
+	if endpoint == "" {
+		log.Printf("[VCI] Warning: credential response has notification_id %q but the issuer has no notification_endpoint", id)
+		return nil
+	}
+	return &CredentialNotification{
+		ID:          id,
+		Endpoint:    endpoint,
+		AccessToken: auth.Token,
+		TokenType:   auth.tokenType(),
+	}
+}
+
+// issuedCredentialInfo is what the wallet stores with an issued credential
+// besides the credential itself.
+type issuedCredentialInfo struct {
+	Notification *CredentialNotification
+	Display      *CredentialDisplay
+	Context      *IssuanceContext
+	Replaces     string // ID of the credential being refreshed
+}
+
+// importIssuedCredentials imports issued credentials with the issuer's
+// display data and issuance context and reports the outcome to the issuer:
+// credential_accepted after a successful import, or credential_failure if the
+// import fails. A refreshed credential takes the place and ID of the
+// credential it replaces.
+func (w *Wallet) importIssuedCredentials(credentials []string, holderKeys []crypto.Signer, info issuedCredentialInfo) (*StoredCredential, error) {
+	n := info.Notification
+	imported, err := w.ImportCredentialBatch(credentials, holderKeys)
+	if err != nil {
+		w.notify(n, NotificationCredentialFailure, err.Error())
+		return nil, err
+	}
+	display := info.Display
+	if display != nil {
+		d := *display
+		d.Issues = append([]string(nil), display.Issues...)
+		d.checkClaims(imported)
+		display = &d
+	}
+	var ictx *IssuanceContext
+	if info.Context != nil {
+		c := *info.Context
+		c.IssuedAt = time.Now()
+		c.CredentialExpiresAt = credentialExpiry(*imported)
+		c.LastRefreshError = ""
+		if info.Replaces != "" {
+			c.LastRefreshAttempt = c.IssuedAt
+		}
+		ictx = &c
+	}
+
+	w.mu.Lock()
+	newIdx, oldIdx := -1, -1
+	for i := range w.Credentials {
+		switch w.Credentials[i].ID {
+		case imported.ID:
+			newIdx = i
+		case info.Replaces:
+			oldIdx = i
+		}
+	}
+	if newIdx >= 0 {
+		cred := &w.Credentials[newIdx]
+		cred.Notification = n
+		cred.Display = display
+		cred.Issuance = ictx
+		if info.Replaces != "" && oldIdx >= 0 {
+			cred.ID = info.Replaces
+			w.Credentials[oldIdx] = *cred
+			w.Credentials = append(w.Credentials[:newIdx], w.Credentials[newIdx+1:]...)
+			log.Printf("[VCI] Replaced credential %s with the refreshed credential", info.Replaces)
+		} else if info.Replaces != "" {
+			log.Printf("[VCI] Warning: refreshed credential %s was removed; stored the new credential as %s", info.Replaces, imported.ID)
+		}
+	}
+	w.mu.Unlock()
+	if info.Replaces != "" && oldIdx >= 0 {
+		imported.ID = info.Replaces
+	}
+	imported.Notification = n
+	imported.Display = display
+	imported.Issuance = ictx
+
+	w.notify(n, NotificationCredentialAccepted, "")
+	return imported, nil
+}
+
+// DeleteCredential removes a credential and sends credential_deleted if the
+// issuer gave it a notification_id. A failed notification is logged and does
+// not prevent the removal.
+func (w *Wallet) DeleteCredential(id string) bool {
+	cred, ok := w.GetCredential(id)
+	if !ok {
+		return false
+	}
+	w.notify(cred.Notification, NotificationCredentialDeleted, "")
+	return w.RemoveCredential(id)
+}
+
+// SendNotification sends an event for a stored credential to the issuer's
+// notification endpoint. Any event name is accepted so that issuers can be
+// tested with unknown events.
+func (w *Wallet) SendNotification(credentialID, event, description string) error {
+	cred, ok := w.GetCredential(credentialID)
+	if !ok {
+		return fmt.Errorf("credential %s not found", credentialID)
+	}
+	if cred.Notification == nil {
+		return fmt.Errorf("credential %s has no notification_id", credentialID)
+	}
+	if event == "" {
+		return fmt.Errorf("notification event is required")
+	}
+	return w.sendNotification(cred.Notification, event, description)
+}
+
+// notify sends a notification event and logs failures. It is a no-op for
+// credentials without a notification_id.
+func (w *Wallet) notify(n *CredentialNotification, event, description string) {
+	if n == nil {
+		return
+	}
+	if err := w.sendNotification(n, event, description); err != nil {
+		log.Printf("[VCI] Warning: notification %s failed: %v", event, err)
+	}
+}
+
+// sendNotification sends a notification request. The issuer answers with
+// 204 No Content on success.
+func (w *Wallet) sendNotification(n *CredentialNotification, event, description string) error {
+	auth, err := w.storedAccessTokenAuth(n.AccessToken, n.TokenType)
+	if err != nil {
+		return err
+	}
+
+	reqBody := map[string]any{
+		"notification_id": n.ID,
+		"event":           event,
+	}
+	if d := notificationDescription(description); d != "" {
+		reqBody["event_description"] = d
+	}
+	bodyJSON, err := json.Marshal(reqBody)
+	if err != nil {
+		return fmt.Errorf("marshaling notification: %w", err)
+	}
+
+	newReq := func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", n.Endpoint, strings.NewReader(string(bodyJSON)))
+		if err != nil {
+			return nil, fmt.Errorf("creating notification request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", auth.tokenType()+" "+auth.Token)
+		return req, nil
+	}
+
+	log.Printf("[VCI] Sending notification %s (notification_id=%s) to %s", event, n.ID, n.Endpoint)
+	resp, body, err := sendIssuanceRequest(newReq, auth.DPoP, nil, auth.Token)
+	if err != nil {
+		return fmt.Errorf("notification request: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		var errResp map[string]any
+		if json.Unmarshal(body, &errResp) == nil {
+			if code, ok := errResp["error"].(string); ok {
+				desc, _ := errResp["error_description"].(string)
+				return fmt.Errorf("notification error (%d): %s: %s", resp.StatusCode, code, desc)
+			}
+		}
+		return fmt.Errorf("notification request failed (%d): %s", resp.StatusCode, string(body))
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		log.Printf("[VCI] Warning: notification endpoint answered %d instead of 204", resp.StatusCode)
+	}
+	return nil
+}
+
+// notificationDescription restricts event_description to the characters
+// OID4VCI allows (printable ASCII except '"' and '\'). Line breaks and tabs
+// become spaces; other characters are dropped.
+func notificationDescription(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20:
+			return ' '
+		case r > 0x7e || r == '"' || r == '\\':
+			return -1
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,196 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// notificationRecorder collects the notification requests of a mock issuer.
+type notificationRecorder struct {
+	requests []map[string]any
+	status   int
+}
+
+func (n *notificationRecorder) handle(t *testing.T, reqBody map[string]any) int {
+	n.requests = append(n.requests, reqBody)
+	if n.status != 0 {
+		return n.status
+	}
+	return http.StatusNoContent
+}
+
+func (n *notificationRecorder) events() []string {
+	var out []string
+	for _, r := range n.requests {
+		event, _ := r["event"].(string)
+		out = append(out, event)
+	}
+	return out
+}
+
+func TestProcessCredentialOffer_Notifications(t *testing.T) {
+	w := generateTestWallet(t)
+	credRaw := generateTestCredential(t, w)
+	rec := &notificationRecorder{}
+
+	srv, offerURI := setupMockIssuer(t, w, mockIssuerOpts{
+		tokenCNonce:         "test-c-nonce",
+		credentialResponse:  map[string]any{"credential": credRaw, "notification_id": "notif-1"},
+		notificationHandler: rec.handle,
+	})
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	result, err := w.ProcessCredentialOffer(offerURI)
+	if err != nil {
+		t.Fatalf("ProcessCredentialOffer: %v", err)
+	}
+	cred, _ := w.GetCredential(result.CredentialID)
+	if cred.Notification == nil || cred.Notification.ID != "notif-1" {
+		t.Fatalf("expected notification_id to be stored, got %+v", cred.Notification)
+	}
+	if got := rec.events(); len(got) != 1 || got[0] != NotificationCredentialAccepted {
+		t.Fatalf("events after issuance = %v, want [credential_accepted]", got)
+	}
+	if rec.requests[0]["notification_id"] != "notif-1" {
+		t.Errorf("notification_id = %v", rec.requests[0]["notification_id"])
+	}
+
+	if err := w.SendNotification(result.CredentialID, "custom_event", `bad "chars"`+"\n"); err != nil {
+		t.Fatalf("SendNotification: %v", err)
+	}
+	if got := rec.requests[1]; got["event"] != "custom_event" || got["event_description"] != "bad chars " {
+		t.Errorf("override notification = %v", got)
+	}
+
+	if !w.DeleteCredential(result.CredentialID) {
+		t.Fatal("DeleteCredential returned false")
+	}
+	if got := rec.events(); len(got) != 3 || got[2] != NotificationCredentialDeleted {
+		t.Errorf("events after deletion = %v, want credential_deleted last", got)
+	}
+	if _, ok := w.GetCredential(result.CredentialID); ok {
+		t.Error("credential should be removed")
+	}
+}
+
+func TestProcessCredentialOffer_NotificationFailure(t *testing.T) {
+	w := generateTestWallet(t)
+	rec := &notificationRecorder{}
+
+	srv, offerURI := setupMockIssuer(t, w, mockIssuerOpts{
+		tokenCNonce:         "test-c-nonce",
+		credentialResponse:  map[string]any{"credential": "not-a-credential", "notification_id": "notif-2"},
+		notificationHandler: rec.handle,
+	})
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	if _, err := w.ProcessCredentialOffer(offerURI); err == nil {
+		t.Fatal("expected import error")
+	}
+	if got := rec.events(); len(got) != 1 || got[0] != NotificationCredentialFailure {
+		t.Fatalf("events = %v, want [credential_failure]", got)
+	}
+	if desc, _ := rec.requests[0]["event_description"].(string); desc == "" {
+		t.Error("credential_failure should carry the import error as event_description")
+	}
+}
+
+func TestDeferredIssuance_NotificationAccepted(t *testing.T) {
+	w := generateTestWallet(t)
+	credRaw := generateTestCredential(t, w)
+	rec := &notificationRecorder{}
+
+	srv, offerURI := setupMockIssuer(t, w, mockIssuerOpts{
+		tokenCNonce:        "test-c-nonce",
+		credentialResponse: map[string]any{"transaction_id": "tx-1"},
+		deferredHandler: func(t *testing.T, reqBody map[string]any) (int, map[string]any) {
+			return http.StatusOK, map[string]any{
+				"credentials":     []any{map[string]any{"credential": credRaw}},
+				"notification_id": "notif-3",
+			}
+		},
+		notificationHandler: rec.handle,
+	})
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	result, err := w.ProcessCredentialOffer(offerURI)
+	if err != nil {
+		t.Fatalf("ProcessCredentialOffer: %v", err)
+	}
+	result, err = w.RetryPendingIssuance(result.PendingID)
+	if err != nil {
+		t.Fatalf("RetryPendingIssuance: %v", err)
+	}
+	if got := rec.events(); len(got) != 1 || got[0] != NotificationCredentialAccepted {
+		t.Fatalf("events = %v, want [credential_accepted]", got)
+	}
+	if cred, _ := w.GetCredential(result.CredentialID); cred.Notification == nil || cred.Notification.ID != "notif-3" {
+		t.Errorf("expected notification_id from deferred response, got %+v", cred.Notification)
+	}
+}
+
+func TestSendNotification_Errors(t *testing.T) {
+	w := generateTestWallet(t)
+	credRaw := generateTestCredential(t, w)
+	rec := &notificationRecorder{}
+
+	srv, offerURI := setupMockIssuer(t, w, mockIssuerOpts{
+		tokenCNonce:         "test-c-nonce",
+		credentialResponse:  map[string]any{"credential": credRaw, "notification_id": "notif-4"},
+		notificationHandler: rec.handle,
+	})
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	result, err := w.ProcessCredentialOffer(offerURI)
+	if err != nil {
+		t.Fatalf("ProcessCredentialOffer: %v", err)
+	}
+
+	rec.status = http.StatusBadRequest
+	err = w.SendNotification(result.CredentialID, NotificationCredentialAccepted, "")
+	if err == nil || !strings.Contains(err.Error(), "invalid_notification_id") {
+		t.Errorf("expected issuer error to be returned, got %v", err)
+	}
+	if err := w.SendNotification("unknown", NotificationCredentialAccepted, ""); err == nil {
+		t.Error("expected error for unknown credential")
+	}
+
+	imported, err := w.ImportCredential(credRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SendNotification(imported.ID, NotificationCredentialAccepted, ""); err == nil {
+		t.Error("expected error for credential without notification_id")
+	}
+}
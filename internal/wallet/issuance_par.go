@@ -0,0 +1,102 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// resolveAuthorizationURL returns the URL the user is sent to. If the
+// authorization server has a pushed_authorization_request_endpoint, the
+// request parameters are pushed first (RFC 9126) and the URL only carries
+// client_id and request_uri. If PAR fails, the wallet falls back to a plain
+// front-channel request, except in strict mode when the server requires PAR.
+func (w *Wallet) resolveAuthorizationURL(as *authServerSession, authEndpoint string, authReq *authorizationRequest) (string, error) {
+	w.mu.RLock()
+	mode := w.ValidationMode
+	w.mu.RUnlock()
+
+	parEndpoint, _ := as.Metadata["pushed_authorization_request_endpoint"].(string)
+	required, _ := as.Metadata["require_pushed_authorization_requests"].(bool)
+
+	if parEndpoint == "" {
+		if required {
+			if mode == ValidationModeStrict {
+				return "", fmt.Errorf("authorization server requires pushed authorization requests but advertises no pushed_authorization_request_endpoint")
+			}
+			log.Printf("[VCI] Warning: authorization server requires PAR but advertises no pushed_authorization_request_endpoint; continuing without PAR")
+		}
+		return authorizationURL(authEndpoint, authReq.Params)
+	}
+
+	log.Printf("[VCI] PAR endpoint: %s", parEndpoint)
+	requestURI, err := pushAuthorizationRequest(parEndpoint, authReq.Params, as.Attestation)
+	if err != nil {
+		if required && mode == ValidationModeStrict {
+			return "", fmt.Errorf("pushed authorization request: %w", err)
+		}
+		log.Printf("[VCI] Warning: pushed authorization request failed: %v; continuing without PAR", err)
+		return authorizationURL(authEndpoint, authReq.Params)
+	}
+	log.Printf("[VCI] PAR request_uri: %s", requestURI)
+
+	params := url.Values{}
+	params.Set("client_id", authReq.ClientID)
+	params.Set("request_uri", requestURI)
+	return authorizationURL(authEndpoint, params)
+}
+
+// pushAuthorizationRequest posts the authorization request parameters to the
+// PAR endpoint and returns the request_uri from the response. With a client
+// attester, the request carries the client attestation.
+func pushAuthorizationRequest(parEndpoint string, params url.Values, att *clientAttester) (string, error) {
+	newReq := func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", parEndpoint, strings.NewReader(params.Encode()))
+		if err != nil {
+			return nil, fmt.Errorf("creating PAR request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	}
+
+	resp, body, err := sendIssuanceRequest(newReq, nil, att, "")
+	if err != nil {
+		return "", fmt.Errorf("PAR request: %w", err)
+	}
+
+	var parResp map[string]any
+	if err := json.Unmarshal(body, &parResp); err != nil {
+		return "", fmt.Errorf("parsing PAR response (HTTP %d): %w", resp.StatusCode, err)
+	}
+
+	if errMsg, ok := parResp["error"].(string); ok {
+		desc, _ := parResp["error_description"].(string)
+		return "", fmt.Errorf("PAR error: %s: %s", errMsg, desc)
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("PAR endpoint returned HTTP %d", resp.StatusCode)
+	}
+
+	requestURI, _ := parResp["request_uri"].(string)
+	if requestURI == "" {
+		return "", fmt.Errorf("PAR response missing request_uri")
+	}
+	return requestURI, nil
+}
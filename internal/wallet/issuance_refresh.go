@@ -0,0 +1,268 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/mdoc"
+	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
+)
+
+const (
+	// accessTokenLeeway is how long a stored access token must still be
+	// valid to be reused for a refresh.
+	accessTokenLeeway = 30 * time.Second
+	// autoRefreshRetryInterval is the minimum time between automatic refresh
+	// attempts of a credential.
+	autoRefreshRetryInterval = 5 * time.Minute
+	// autoRefreshCheckInterval is how often the server looks for credentials
+	// to refresh automatically.
+	autoRefreshCheckInterval = 30 * time.Second
+)
+
+// IssuanceContext records where an OID4VCI credential came from and the
+// tokens the issuer granted, so the credential can be refreshed later.
+type IssuanceContext struct {
+	Issuer               string    `json:"credential_issuer"`
+	ConfigurationID      string    `json:"credential_configuration_id,omitempty"`
+	CredentialIdentifier string    `json:"credential_identifier,omitempty"` // from authorization_details
+	AuthorizationServer  string    `json:"authorization_server,omitempty"`
+	ClientID             string    `json:"client_id,omitempty"` // set for the authorization code flow
+	OfferURI             string    `json:"offer_uri,omitempty"` // re-run when there is no usable token
+	AccessToken          string    `json:"access_token,omitempty"`
+	TokenType            string    `json:"token_type,omitempty"` // "DPoP" for DPoP-bound access tokens
+	AccessTokenExpiresAt time.Time `json:"access_token_expires_at,omitzero"`
+	RefreshToken         string    `json:"refresh_token,omitempty"`
+	IssuedAt             time.Time `json:"issued_at,omitzero"`
+	CredentialExpiresAt  time.Time `json:"credential_expires_at,omitzero"`
+	LastRefreshAttempt   time.Time `json:"last_refresh_attempt,omitzero"`
+	LastRefreshError     string    `json:"last_refresh_error,omitempty"`
+}
+
+// setToken records the tokens of a token response. A refresh token is kept
+// if the authorization server does not rotate it.
+func (c *IssuanceContext) setToken(tokenResp map[string]any, auth accessTokenAuth) {
+	c.AccessToken = auth.Token
+	c.TokenType = auth.tokenType()
+	c.AccessTokenExpiresAt = time.Time{}
+	if secs, ok := tokenResp["expires_in"].(float64); ok && secs > 0 {
+		c.AccessTokenExpiresAt = time.Now().Add(time.Duration(secs) * time.Second)
+	}
+	if rt, ok := tokenResp["refresh_token"].(string); ok && rt != "" {
+		c.RefreshToken = rt
+	}
+}
+
+// accessTokenValid reports whether the stored access token is known to be
+// valid for a while longer. Tokens without expires_in are not reused.
+func (c *IssuanceContext) accessTokenValid() bool {
+	return c.AccessToken != "" && !c.AccessTokenExpiresAt.IsZero() && time.Now().Add(accessTokenLeeway).Before(c.AccessTokenExpiresAt)
+}
+
+// Refreshable reports whether the wallet has a way to refresh the credential.
+func (c *IssuanceContext) Refreshable() bool {
+	return c.tokenRefreshable() || c.OfferURI != ""
+}
+
+// tokenRefreshable reports whether the credential can be refreshed without the
+// user: with a refresh token or a still valid access token.
+func (c *IssuanceContext) tokenRefreshable() bool {
+	return c.RefreshToken != "" || c.accessTokenValid()
+}
+
+// credentialExpiry returns when a credential expires: exp for SD-JWT and JWT
+// VCs, validUntil for mDocs. It returns the zero time if unknown.
+func credentialExpiry(c StoredCredential) time.Time {
+	if c.Format == "mso_mdoc" {
+		doc, err := mdoc.Parse(c.Raw)
+		if err != nil || doc.IssuerAuth == nil || doc.IssuerAuth.MSO == nil || doc.IssuerAuth.MSO.ValidityInfo == nil || doc.IssuerAuth.MSO.ValidityInfo.ValidUntil == nil {
+			return time.Time{}
+		}
+		return *doc.IssuerAuth.MSO.ValidityInfo.ValidUntil
+	}
+	if exp, ok := c.Claims["exp"].(float64); ok {
+		return time.Unix(int64(exp), 0)
+	}
+	return time.Time{}
+}
+
+// RefreshCredential fetches a fresh copy of a credential issued via OID4VCI
+// and replaces the stored one, keeping its ID. It uses the refresh token if
+// there is one, otherwise a still valid access token, otherwise it runs the
+// original credential offer again. If the issuer defers the credential, the
+// old one stays in place until the pending issuance completes.
+func (w *Wallet) RefreshCredential(id string) (*IssuanceResult, error) {
+	return w.refresh(id, true)
+}
+
+// refresh refreshes a credential and records the attempt. Only an explicit
+// refresh may rerun the credential offer: a pre-authorized code is one-time,
+// and the authorization code flow waits for the user.
+func (w *Wallet) refresh(id string, rerunOffer bool) (*IssuanceResult, error) {
+	cred, ok := w.GetCredential(id)
+	if !ok {
+		return nil, fmt.Errorf("credential %s not found", id)
+	}
+	if cred.Issuance == nil {
+		return nil, fmt.Errorf("credential %s has no issuance context (not issued via OID4VCI)", id)
+	}
+
+	ictx := *cred.Issuance
+	result, err := w.refreshCredential(id, &ictx, rerunOffer)
+	if err != nil {
+		w.updateIssuanceContext(id, func(c *IssuanceContext) {
+			c.LastRefreshAttempt = time.Now()
+			c.LastRefreshError = err.Error()
+		})
+		return nil, err
+	}
+	if result.PendingID != "" {
+		w.updateIssuanceContext(id, func(c *IssuanceContext) {
+			c.LastRefreshAttempt = time.Now()
+			c.LastRefreshError = ""
+		})
+	}
+	return result, nil
+}
+
+func (w *Wallet) refreshCredential(id string, ictx *IssuanceContext, rerunOffer bool) (*IssuanceResult, error) {
+	if !ictx.tokenRefreshable() {
+		if !rerunOffer {
+			return nil, fmt.Errorf("credential %s cannot be refreshed automatically: no refresh token or valid access token", id)
+		}
+		if ictx.OfferURI == "" {
+			return nil, fmt.Errorf("credential %s cannot be refreshed: no refresh token, valid access token, or credential offer", id)
+		}
+		log.Printf("[VCI] Refreshing credential %s by running its credential offer again", id)
+		return w.processCredentialOffer(ictx.OfferURI, id)
+	}
+
+	metadata, err := fetchIssuerMetadata(ictx.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("fetching issuer metadata: %w", err)
+	}
+	metadata, signedStatus, err := w.applySignedMetadata(metadata, ictx.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	ai := authorizedIssuance{
+		Offer:        &oid4vc.CredentialOffer{CredentialIssuer: ictx.Issuer},
+		Metadata:     metadata,
+		SignedStatus: signedStatus,
+		Context:      ictx,
+		Replaces:     id,
+	}
+	if ictx.ConfigurationID != "" {
+		ai.Offer.CredentialConfigurationIDs = []string{ictx.ConfigurationID}
+	}
+
+	if ictx.RefreshToken != "" {
+		log.Printf("[VCI] Refreshing credential %s with its refresh token", id)
+		authServer := ictx.AuthorizationServer
+		if authServer == "" {
+			authServer = resolveAuthorizationServer(metadata, ictx.Issuer, "")
+		}
+		oauthMeta, _ := fetchOAuthMetadata(authServer)
+		as, err := w.newAuthServerSession(authServer, oauthMeta)
+		if err != nil {
+			return nil, err
+		}
+		tokenEndpoint := resolveTokenEndpoint(metadata, oauthMeta, authServer)
+		log.Printf("[VCI] Token endpoint: %s", tokenEndpoint)
+
+		form := url.Values{}
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", ictx.RefreshToken)
+		if ictx.ClientID != "" {
+			form.Set("client_id", ictx.ClientID)
+		}
+		tokenResp, err := postTokenRequest(tokenEndpoint, form, as)
+		if err != nil {
+			return nil, fmt.Errorf("refresh token request: %w", err)
+		}
+		ai.TokenResp = tokenResp
+		ai.Auth = resourceAuth(tokenResp, as.DPoP)
+	} else {
+		log.Printf("[VCI] Refreshing credential %s with its access token (valid until %s)", id, ictx.AccessTokenExpiresAt.Format(time.RFC3339))
+		auth, err := w.storedAccessTokenAuth(ictx.AccessToken, ictx.TokenType)
+		if err != nil {
+			return nil, err
+		}
+		ai.Auth = auth
+	}
+
+	return w.requestIssuance(ai)
+}
+
+// updateIssuanceContext applies fn to the issuance context of a credential.
+func (w *Wallet) updateIssuanceContext(id string, fn func(c *IssuanceContext)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := range w.Credentials {
+		if w.Credentials[i].ID == id && w.Credentials[i].Issuance != nil {
+			c := *w.Credentials[i].Issuance
+			fn(&c)
+			w.Credentials[i].Issuance = &c
+			return
+		}
+	}
+}
+
+// RefreshExpiringCredentials refreshes the OID4VCI credentials that expire
+// within w.AutoRefresh with their refresh token or access token; credentials
+// without either are left to an explicit refresh. A credential is attempted at
+// most every autoRefreshRetryInterval, and not while a refresh of it is
+// pending.
+func (w *Wallet) RefreshExpiringCredentials() []*IssuanceResult {
+	w.mu.RLock()
+	window := w.AutoRefresh
+	w.mu.RUnlock()
+	if window <= 0 {
+		return nil
+	}
+
+	refreshing := make(map[string]bool)
+	for _, p := range w.GetPendingIssuances() {
+		if p.Replaces != "" {
+			refreshing[p.Replaces] = true
+		}
+	}
+
+	now := time.Now()
+	var results []*IssuanceResult
+	for _, c := range w.GetCredentials() {
+		ictx := c.Issuance
+		if ictx == nil || ictx.CredentialExpiresAt.IsZero() || !ictx.tokenRefreshable() || refreshing[c.ID] {
+			continue
+		}
+		if ictx.CredentialExpiresAt.Sub(now) > window || now.Sub(ictx.LastRefreshAttempt) < autoRefreshRetryInterval {
+			continue
+		}
+		log.Printf("[VCI] Credential %s expires at %s, refreshing", c.ID, ictx.CredentialExpiresAt.Format(time.RFC3339))
+		result, err := w.refresh(c.ID, false)
+		if err != nil {
+			log.Printf("[VCI] Refresh of credential %s failed: %v", c.ID, err)
+			results = append(results, &IssuanceResult{CredentialID: c.ID, Issuer: ictx.Issuer, Error: err.Error()})
+			continue
+		}
+		results = append(results, result)
+	}
+	return results
+}
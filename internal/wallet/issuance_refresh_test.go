@@ -0,0 +1,313 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
+)
+
+// refreshIssuer starts a mock issuer that issues a fresh credential on every
+// credential request and records the token requests.
+func refreshIssuer(t *testing.T, w *Wallet, tokenResp map[string]any) (string, *[]url.Values) {
+	t.Helper()
+	var forms []url.Values
+	srv, offerURI := setupMockIssuer(t, w, mockIssuerOpts{
+		tokenCNonce:   "test-c-nonce",
+		tokenResponse: tokenResp,
+		inspectTokenRequest: func(t *testing.T, form url.Values) {
+			forms = append(forms, form)
+		},
+		credentialHandler: func(t *testing.T, _ map[string]any) map[string]any {
+			return map[string]any{"credential": generateTestCredential(t, w)}
+		},
+	})
+	t.Cleanup(srv.Close)
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	t.Cleanup(func() { httpClient = oldClient })
+	return offerURI, &forms
+}
+
+// issueForRefresh issues a credential from offerURI and returns it.
+func issueForRefresh(t *testing.T, w *Wallet, offerURI string) StoredCredential {
+	t.Helper()
+	result, err := w.ProcessCredentialOffer(offerURI)
+	if err != nil {
+		t.Fatalf("ProcessCredentialOffer: %v", err)
+	}
+	cred, ok := w.GetCredential(result.CredentialID)
+	if !ok {
+		t.Fatal("issued credential not stored")
+	}
+	return cred
+}
+
+// checkRefreshed verifies that the credential with id was replaced in place.
+func checkRefreshed(t *testing.T, w *Wallet, old StoredCredential, result *IssuanceResult) StoredCredential {
+	t.Helper()
+	if result.CredentialID != old.ID {
+		t.Errorf("refreshed credential ID = %q, want %q", result.CredentialID, old.ID)
+	}
+	if n := len(w.GetCredentials()); n != 1 {
+		t.Errorf("expected the refreshed credential to replace the old one, have %d credentials", n)
+	}
+	cred, ok := w.GetCredential(old.ID)
+	if !ok {
+		t.Fatal("refreshed credential not stored under the old ID")
+	}
+	if cred.Raw == old.Raw {
+		t.Error("expected a fresh credential")
+	}
+	if cred.Issuance == nil || cred.Issuance.LastRefreshAttempt.IsZero() {
+		t.Errorf("expected issuance context with the refresh time, got %+v", cred.Issuance)
+	}
+	return cred
+}
+
+func TestProcessCredentialOffer_IssuanceContext(t *testing.T) {
+	w := generateTestWallet(t)
+	offerURI, _ := refreshIssuer(t, w, map[string]any{"refresh_token": "rt-1", "expires_in": float64(300)})
+
+	cred := issueForRefresh(t, w, offerURI)
+	ictx := cred.Issuance
+	if ictx == nil {
+		t.Fatal("expected issuance context")
+	}
+	if !strings.HasPrefix(ictx.Issuer, "http") || ictx.ConfigurationID != "test-config" || ictx.OfferURI != offerURI {
+		t.Errorf("unexpected issuance context: %+v", ictx)
+	}
+	if ictx.AccessToken != "test-access-token" || ictx.TokenType != "Bearer" || ictx.RefreshToken != "rt-1" {
+		t.Errorf("unexpected tokens: %+v", ictx)
+	}
+	if until := time.Until(ictx.AccessTokenExpiresAt); until < 4*time.Minute || until > 5*time.Minute {
+		t.Errorf("access token expiry in %s, want ~5m", until)
+	}
+	if until := time.Until(ictx.CredentialExpiresAt); until < 23*time.Hour || until > 25*time.Hour {
+		t.Errorf("credential expiry in %s, want ~24h", until)
+	}
+	if !ictx.Refreshable() {
+		t.Error("expected credential to be refreshable")
+	}
+}
+
+func TestRefreshCredential_RefreshToken(t *testing.T) {
+	w := generateTestWallet(t)
+	offerURI, forms := refreshIssuer(t, w, map[string]any{"refresh_token": "rt-1"})
+	old := issueForRefresh(t, w, offerURI)
+
+	result, err := w.RefreshCredential(old.ID)
+	if err != nil {
+		t.Fatalf("RefreshCredential: %v", err)
+	}
+	checkRefreshed(t, w, old, result)
+
+	if len(*forms) != 2 {
+		t.Fatalf("expected 2 token requests, got %d", len(*forms))
+	}
+	refresh := (*forms)[1]
+	if refresh.Get("grant_type") != "refresh_token" || refresh.Get("refresh_token") != "rt-1" {
+		t.Errorf("unexpected refresh token request: %v", refresh)
+	}
+}
+
+func TestRefreshCredential_StoredAccessToken(t *testing.T) {
+	w := generateTestWallet(t)
+	offerURI, forms := refreshIssuer(t, w, map[string]any{"expires_in": float64(3600)})
+	old := issueForRefresh(t, w, offerURI)
+
+	result, err := w.RefreshCredential(old.ID)
+	if err != nil {
+		t.Fatalf("RefreshCredential: %v", err)
+	}
+	checkRefreshed(t, w, old, result)
+	if len(*forms) != 1 {
+		t.Errorf("expected the valid access token to be reused, got %d token requests", len(*forms))
+	}
+}
+
+func TestRefreshCredential_RerunsOffer(t *testing.T) {
+	w := generateTestWallet(t)
+	offerURI, forms := refreshIssuer(t, w, nil)
+	old := issueForRefresh(t, w, offerURI)
+
+	result, err := w.RefreshCredential(old.ID)
+	if err != nil {
+		t.Fatalf("RefreshCredential: %v", err)
+	}
+	cred := checkRefreshed(t, w, old, result)
+	if len(*forms) != 2 || (*forms)[1].Get("pre-authorized_code") != "test-pre-auth-code" {
+		t.Errorf("expected the offer to be redeemed again, got %v", *forms)
+	}
+	if cred.Issuance.OfferURI != offerURI {
+		t.Errorf("expected offer URI to be kept, got %q", cred.Issuance.OfferURI)
+	}
+}
+
+func TestRefreshCredential_Errors(t *testing.T) {
+	w := generateTestWallet(t)
+	imported, err := w.ImportCredential(generateTestCredential(t, w))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.RefreshCredential("unknown"); err == nil {
+		t.Error("expected error for unknown credential")
+	}
+	if _, err := w.RefreshCredential(imported.ID); err == nil || !strings.Contains(err.Error(), "no issuance context") {
+		t.Errorf("expected error for imported credential, got %v", err)
+	}
+
+	w.mu.Lock()
+	w.Credentials[0].Issuance = &IssuanceContext{Issuer: "https://issuer.example"}
+	w.mu.Unlock()
+	if _, err := w.RefreshCredential(imported.ID); err == nil || !strings.Contains(err.Error(), "cannot be refreshed") {
+		t.Errorf("expected error without tokens or offer, got %v", err)
+	}
+	cred, _ := w.GetCredential(imported.ID)
+	if cred.Issuance.LastRefreshError == "" || cred.Issuance.LastRefreshAttempt.IsZero() {
+		t.Errorf("expected failed attempt to be recorded, got %+v", cred.Issuance)
+	}
+}
+
+func TestRefreshCredential_Deferred(t *testing.T) {
+	w := generateTestWallet(t)
+	requests := 0
+	srv, offerURI := setupMockIssuer(t, w, mockIssuerOpts{
+		tokenCNonce:   "test-c-nonce",
+		tokenResponse: map[string]any{"refresh_token": "rt-1"},
+		credentialHandler: func(t *testing.T, _ map[string]any) map[string]any {
+			requests++
+			if requests > 1 {
+				return map[string]any{"transaction_id": "tx-refresh"}
+			}
+			return map[string]any{"credential": generateTestCredential(t, w)}
+		},
+		deferredHandler: func(t *testing.T, _ map[string]any) (int, map[string]any) {
+			return http.StatusOK, map[string]any{"credentials": []any{map[string]any{"credential": generateTestCredential(t, w)}}}
+		},
+	})
+	defer srv.Close()
+
+	oldClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = oldClient }()
+
+	old := issueForRefresh(t, w, offerURI)
+	result, err := w.RefreshCredential(old.ID)
+	if err != nil {
+		t.Fatalf("RefreshCredential: %v", err)
+	}
+	if result.PendingID == "" {
+		t.Fatal("expected refresh to be deferred")
+	}
+	if cred, _ := w.GetCredential(old.ID); cred.Raw != old.Raw {
+		t.Error("old credential must stay in place while the refresh is pending")
+	}
+	if got := w.RefreshExpiringCredentials(); got != nil {
+		t.Errorf("auto refresh is off, got %v", got)
+	}
+
+	result, err = w.RetryPendingIssuance(result.PendingID)
+	if err != nil {
+		t.Fatalf("RetryPendingIssuance: %v", err)
+	}
+	checkRefreshed(t, w, old, result)
+}
+
+func TestRefreshExpiringCredentials(t *testing.T) {
+	w := generateTestWallet(t)
+	offerURI, forms := refreshIssuer(t, w, map[string]any{"refresh_token": "rt-1"})
+	old := issueForRefresh(t, w, offerURI)
+
+	w.AutoRefresh = time.Hour // the credential expires in 24h
+	if results := w.RefreshExpiringCredentials(); len(results) != 0 {
+		t.Fatalf("expected no refresh, got %d results", len(results))
+	}
+
+	w.AutoRefresh = 48 * time.Hour
+	results := w.RefreshExpiringCredentials()
+	if len(results) != 1 || results[0].Error != "" {
+		t.Fatalf("expected one successful refresh, got %+v", results)
+	}
+	checkRefreshed(t, w, old, results[0])
+
+	if results := w.RefreshExpiringCredentials(); len(results) != 0 {
+		t.Errorf("expected no refresh right after the last one, got %d results", len(results))
+	}
+	if len(*forms) != 2 {
+		t.Errorf("expected 2 token requests, got %d", len(*forms))
+	}
+}
+
+func TestCredentialExpiry(t *testing.T) {
+	w := generateTestWallet(t)
+	sdJWT, err := w.ImportCredential(generateTestCredential(t, w))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if until := time.Until(credentialExpiry(*sdJWT)); until < 23*time.Hour || until > 25*time.Hour {
+		t.Errorf("SD-JWT expiry in %s, want ~24h", until)
+	}
+
+	raw, err := mock.GenerateMDOC(mock.MDOCConfig{
+		DocType:   "org.iso.18013.5.1.mDL",
+		Namespace: "org.iso.18013.5.1",
+		Claims:    map[string]any{"family_name": "Test"},
+		Key:       w.IssuerKey,
+		ExpiresIn: 48 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mdocCred, err := w.ImportCredential(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if until := time.Until(credentialExpiry(*mdocCred)); until < 47*time.Hour || until > 49*time.Hour {
+		t.Errorf("mDoc expiry in %s, want ~48h", until)
+	}
+
+	if exp := credentialExpiry(StoredCredential{Format: "jwt_vc_json", Claims: map[string]any{}}); !exp.IsZero() {
+		t.Errorf("expected zero expiry without exp, got %s", exp)
+	}
+}
+
+func TestRefreshExpiringCredentials_SkipsOfferRerun(t *testing.T) {
+	w := generateTestWallet(t)
+	offerURI, forms := refreshIssuer(t, w, nil)
+	old := issueForRefresh(t, w, offerURI)
+
+	w.AutoRefresh = 48 * time.Hour
+	if results := w.RefreshExpiringCredentials(); len(results) != 0 {
+		t.Fatalf("expected no automatic refresh without tokens, got %+v", results)
+	}
+	if len(*forms) != 1 {
+		t.Errorf("expected the offer not to be redeemed again, got %d token requests", len(*forms))
+	}
+	if cred, _ := w.GetCredential(old.ID); !cred.Issuance.LastRefreshAttempt.IsZero() {
+		t.Errorf("expected no refresh attempt to be recorded, got %+v", cred.Issuance)
+	}
+
+	if _, err := w.refresh(old.ID, false); err == nil || !strings.Contains(err.Error(), "cannot be refreshed automatically") {
+		t.Errorf("expected a background refresh to refuse the offer, got %v", err)
+	}
+}
@@ -15,6 +15,7 @@
 package wallet
 
 import (
+	"crypto"
 	"testing"
 )
 
@@ -70,64 +71,92 @@ func TestResolveCredentialIdentifier_NoConfigIDs(t *testing.T) {
 	}
 }
 
-func TestExtractCredential_SingleField(t *testing.T) {
+func testCredentialRequestState(w *Wallet) credentialRequestState {
+	return credentialRequestState{
+		Issuer:     "https://test-issuer.example",
+		Format:     "dc+sd-jwt",
+		HolderKeys: []crypto.Signer{w.HolderKey},
+	}
+}
+
+func TestStoreIssuedCredentials_SingleField(t *testing.T) {
+	w := generateTestWallet(t)
 	resp := map[string]any{
-		"credential": "eyJhbGci...",
+		"credential": generateTestCredential(t, w),
 	}
 
-	got := extractCredential(resp)
-	if got != "eyJhbGci..." {
-		t.Errorf("expected eyJhbGci..., got %s", got)
+	result, err := w.storeIssuedCredentials(resp, testCredentialRequestState(w))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Issuer != "https://test-issuer.example" || result.Format != "dc+sd-jwt" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if _, ok := w.GetCredential(result.CredentialID); !ok {
+		t.Errorf("credential %s not stored", result.CredentialID)
 	}
 }
 
-func TestExtractCredential_CredentialsArray(t *testing.T) {
+func TestStoreIssuedCredentials_CredentialsArray(t *testing.T) {
+	w := generateTestWallet(t)
 	resp := map[string]any{
 		"credentials": []any{
 			map[string]any{
-				"credential": "eyJhbGci-from-array",
+				"credential": generateTestCredential(t, w),
 			},
 		},
 	}
 
-	got := extractCredential(resp)
-	if got != "eyJhbGci-from-array" {
-		t.Errorf("expected eyJhbGci-from-array, got %s", got)
+	result, err := w.storeIssuedCredentials(resp, testCredentialRequestState(w))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := w.GetCredential(result.CredentialID); !ok {
+		t.Errorf("credential %s not stored", result.CredentialID)
 	}
 }
 
-func TestExtractCredential_CredentialsArrayRawStrings(t *testing.T) {
+func TestStoreIssuedCredentials_CredentialsArrayRawStrings(t *testing.T) {
+	w := generateTestWallet(t)
 	resp := map[string]any{
 		"credentials": []any{
-			"raw-credential-string",
+			generateTestCredential(t, w),
 		},
 	}
 
-	got := extractCredential(resp)
-	if got != "raw-credential-string" {
-		t.Errorf("expected raw-credential-string, got %s", got)
+	result, err := w.storeIssuedCredentials(resp, testCredentialRequestState(w))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := w.GetCredential(result.CredentialID); !ok {
+		t.Errorf("credential %s not stored", result.CredentialID)
 	}
 }
 
-func TestExtractCredential_Empty(t *testing.T) {
+func TestStoreIssuedCredentials_Empty(t *testing.T) {
+	w := generateTestWallet(t)
 	resp := map[string]any{
 		"status": "ok",
 	}
 
-	got := extractCredential(resp)
-	if got != "" {
-		t.Errorf("expected empty, got %s", got)
+	_, err := w.storeIssuedCredentials(resp, testCredentialRequestState(w))
+	if err == nil || err.Error() != "no credential in response" {
+		t.Errorf("expected 'no credential in response', got %v", err)
+	}
+	if len(w.Credentials) != 0 {
+		t.Errorf("expected no stored credentials, got %d", len(w.Credentials))
 	}
 }
 
-func TestExtractCredential_EmptyCredentialsArray(t *testing.T) {
+func TestStoreIssuedCredentials_EmptyCredentialsArray(t *testing.T) {
+	w := generateTestWallet(t)
 	resp := map[string]any{
 		"credentials": []any{},
 	}
 
-	got := extractCredential(resp)
-	if got != "" {
-		t.Errorf("expected empty, got %s", got)
+	_, err := w.storeIssuedCredentials(resp, testCredentialRequestState(w))
+	if err == nil || err.Error() != "no credential in response" {
+		t.Errorf("expected 'no credential in response', got %v", err)
 	}
 }
 
@@ -190,6 +219,14 @@ func TestGetTokenEndpoint_Fallback(t *testing.T) {
 	}
 }
 
+func TestResolveTokenEndpoint_FromOAuthMetadata(t *testing.T) {
+	oauthMeta := map[string]any{"token_endpoint": "https://as.example/oauth/token"}
+	got := resolveTokenEndpoint(map[string]any{}, oauthMeta, "https://as.example")
+	if got != "https://as.example/oauth/token" {
+		t.Errorf("expected token_endpoint from the authorization server metadata, got %s", got)
+	}
+}
+
 func TestGetCredentialEndpoint_DirectInMetadata(t *testing.T) {
 	metadata := map[string]any{
 		"credential_endpoint": "https://issuer.example/credential",
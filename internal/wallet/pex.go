@@ -0,0 +1,351 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/jsonutil"
+	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
+)
+
+// presentationExchangeFormats maps the Presentation Exchange format
+// designations used by the OID4VP drafts to the wallet's credential formats.
+var presentationExchangeFormats = map[string]string{
+	"vc+sd-jwt":   "dc+sd-jwt",
+	"dc+sd-jwt":   "dc+sd-jwt",
+	"mso_mdoc":    "mso_mdoc",
+	"jwt_vc_json": "jwt_vc_json",
+	"jwt_vc":      "jwt_vc_json",
+}
+
+// EvaluatePresentationDefinition matches stored credentials against the input
+// descriptors of a DIF Presentation Exchange 2.0 presentation_definition, the
+// query language of OID4VP drafts before DCQL. Each input descriptor is matched
+// by one credential, whose match has the descriptor id as QueryID. mDoc input
+// descriptors are identified by their doctype (ISO 18013-7 Annex B).
+// submission_requirements are not evaluated: all input descriptors are
+// required, and nil is returned if one cannot be satisfied.
+func (w *Wallet) EvaluatePresentationDefinition(pd map[string]any) []CredentialMatch {
+	return w.EvaluatePresentationDefinitionForRequest(pd, nil)
+}
+
+// EvaluatePresentationDefinitionForRequest is EvaluatePresentationDefinition
+// for a request whose client_metadata.vp_formats_supported rules out
+// credentials.
+func (w *Wallet) EvaluatePresentationDefinitionForRequest(pd map[string]any, reqObj *oid4vc.RequestObjectJWT) []CredentialMatch {
+	credentials := w.GetCredentials()
+	descriptors := jsonutil.GetArray(pd, "input_descriptors")
+
+	log.Printf("[PE] Evaluating presentation_definition %q: %d input descriptors against %d stored credentials", jsonutil.GetString(pd, "id"), len(descriptors), len(credentials))
+	if _, ok := pd["submission_requirements"]; ok {
+		log.Printf("[PE] submission_requirements are not evaluated, all input descriptors are required")
+	}
+
+	var matches []CredentialMatch
+	for _, d := range descriptors {
+		desc, ok := d.(map[string]any)
+		if !ok {
+			continue
+		}
+		descID := jsonutil.GetString(desc, "id")
+
+		var candidates []CredentialMatch
+		for _, cred := range credentials {
+			typeLabel := cred.VCT
+			if typeLabel == "" {
+				typeLabel = cred.DocType
+			}
+
+			if inputDescriptorFormat(pd, desc, cred.Format) == "" {
+				log.Printf("[PE]   descriptor=%s: credential %s (%s) skipped: format not requested", descID, typeLabel, cred.Format)
+				continue
+			}
+			if cred.Format == "mso_mdoc" && cred.DocType != descID {
+				log.Printf("[PE]   descriptor=%s: credential %s (%s) skipped: doctype mismatch", descID, typeLabel, cred.Format)
+				continue
+			}
+			if reason := w.vpFormatMismatch(cred, true, reqObj); reason != "" {
+				log.Printf("[PE]   descriptor=%s: credential %s (%s) skipped: %s", descID, typeLabel, cred.Format, reason)
+				continue
+			}
+			selectedPaths := matchInputDescriptor(cred, desc)
+			if selectedPaths == nil {
+				log.Printf("[PE]   descriptor=%s: credential %s (%s) skipped: required fields not found or filters not matched", descID, typeLabel, cred.Format)
+				continue
+			}
+
+			log.Printf("[PE]   descriptor=%s: credential %s (%s) matched, selected claims: %v", descID, typeLabel, cred.Format, selectedPaths)
+			candidates = append(candidates, CredentialMatch{
+				QueryID:       descID,
+				CredentialID:  cred.ID,
+				Format:        cred.Format,
+				VCT:           cred.VCT,
+				DocType:       cred.DocType,
+				Claims:        disclosedClaims(cred, selectedPaths),
+				SelectedKeys:  claimKeys(cred, selectedPaths),
+				SelectedPaths: selectedPaths,
+			})
+		}
+		if len(candidates) == 0 {
+			log.Printf("[PE] Result: input descriptor %s not satisfied", descID)
+			return nil
+		}
+
+		best := candidates[0]
+		for _, c := range candidates {
+			if c.Format == w.PreferredFormat {
+				best = c
+				break
+			}
+		}
+		matches = append(matches, best)
+	}
+
+	log.Printf("[PE] Result: %d matches", len(matches))
+	return matches
+}
+
+// inputDescriptorFormat returns the format designation under which an input
+// descriptor accepts a credential of the given format, from the descriptor's
+// format or else the definition's. Without either, any format is accepted
+// under its own name. Returns "" if the format is not accepted.
+func inputDescriptorFormat(pd, desc map[string]any, credFormat string) string {
+	formats := jsonutil.GetMap(desc, "format")
+	if formats == nil {
+		formats = jsonutil.GetMap(pd, "format")
+	}
+	if formats == nil {
+		return credFormat
+	}
+	designations := make([]string, 0, len(formats))
+	for designation := range formats {
+		designations = append(designations, designation)
+	}
+	slices.Sort(designations)
+	for _, designation := range designations {
+		if presentationExchangeFormats[designation] == credFormat {
+			return designation
+		}
+	}
+	return ""
+}
+
+// matchInputDescriptor returns the claims path pointers of the fields of an
+// input descriptor's constraints that the credential satisfies, or nil if a
+// required field is missing or does not match its filter. Without fields, all
+// claims are selected.
+func matchInputDescriptor(cred StoredCredential, desc map[string]any) [][]any {
+	fields := jsonutil.GetArray(jsonutil.GetMap(desc, "constraints"), "fields")
+	if len(fields) == 0 {
+		all := make([]string, 0, len(cred.Claims))
+		for k := range cred.Claims {
+			all = append(all, k)
+		}
+		return claimPaths(cred, all)
+	}
+
+	selected := [][]any{}
+	for _, f := range fields {
+		field, ok := f.(map[string]any)
+		if !ok {
+			continue
+		}
+		path := matchField(cred, field)
+		if path == nil {
+			if optional, _ := field["optional"].(bool); optional {
+				continue
+			}
+			return nil
+		}
+		selected = append(selected, path)
+	}
+	return selected
+}
+
+// matchField returns the claims path pointer of the first JSONPath of a field
+// that selects a value of the credential matching the field's filter.
+func matchField(cred StoredCredential, field map[string]any) []any {
+	filter := jsonutil.GetMap(field, "filter")
+	for _, p := range jsonutil.GetArray(field, "path") {
+		expr, _ := p.(string)
+		path, ok := parseJSONPath(expr)
+		if !ok {
+			log.Printf("[PE]   unsupported JSONPath %q", expr)
+			continue
+		}
+		key, values := resolveClaimPath(cred, path)
+		if key == "" {
+			continue
+		}
+		if filter == nil || slices.ContainsFunc(values, func(v any) bool { return matchesFilter(v, filter) }) {
+			return path
+		}
+	}
+	return nil
+}
+
+// matchesFilter checks a value against the JSON Schema subset Presentation
+// Exchange filters commonly use: type, const, enum, pattern and contains.
+func matchesFilter(v any, filter map[string]any) bool {
+	if t := jsonutil.GetString(filter, "type"); t != "" && !matchesJSONType(v, t) {
+		return false
+	}
+	if c, ok := filter["const"]; ok && !claimValueMatches(v, c) {
+		return false
+	}
+	if enum, ok := filter["enum"].([]any); ok && !slices.ContainsFunc(enum, func(e any) bool { return claimValueMatches(v, e) }) {
+		return false
+	}
+	if pattern := jsonutil.GetString(filter, "pattern"); pattern != "" {
+		s, ok := v.(string)
+		re, err := regexp.Compile(pattern)
+		if !ok || err != nil || !re.MatchString(s) {
+			return false
+		}
+	}
+	if contains := jsonutil.GetMap(filter, "contains"); contains != nil {
+		arr, ok := v.([]any)
+		if !ok || !slices.ContainsFunc(arr, func(e any) bool { return matchesFilter(e, contains) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesJSONType reports whether a value has the given JSON Schema type.
+func matchesJSONType(v any, t string) bool {
+	switch t {
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "integer":
+		_, ok := integerValue(v)
+		return ok
+	case "number":
+		switch v.(type) {
+		case float64, int, int64, uint64:
+			return true
+		}
+		return false
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	default:
+		return true
+	}
+}
+
+// parseJSONPath converts the JSONPath of a Presentation Exchange field into a
+// claims path pointer. Supported are member names in dot or bracket notation,
+// array indexes, and the [*] wildcard, e.g. $.address.locality,
+// $['eu.europa.ec.eudi.pid.1']['given_name'] or $.nationalities[*].
+func parseJSONPath(expr string) ([]any, bool) {
+	rest, ok := strings.CutPrefix(expr, "$")
+	if !ok {
+		return nil, false
+	}
+
+	var path []any
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			if name == "" {
+				return nil, false
+			}
+			if name == "*" {
+				path = append(path, nil)
+			} else {
+				path = append(path, name)
+			}
+			rest = rest[end:]
+		case '[':
+			if len(rest) > 1 && (rest[1] == '\'' || rest[1] == '"') {
+				end := strings.IndexByte(rest[2:], rest[1])
+				if end < 0 || !strings.HasPrefix(rest[2+end+1:], "]") {
+					return nil, false
+				}
+				path = append(path, rest[2:2+end])
+				rest = rest[2+end+2:]
+				continue
+			}
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, false
+			}
+			inner := rest[1:end]
+			if inner == "*" {
+				path = append(path, nil)
+			} else if idx, err := strconv.Atoi(inner); err == nil && idx >= 0 {
+				path = append(path, float64(idx))
+			} else {
+				return nil, false
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, false
+		}
+	}
+	return path, len(path) > 0
+}
+
+// presentationSubmission builds the presentation_submission of a Presentation
+// Exchange response: a descriptor_map entry per match in vp_token order, with
+// the path "$" for a single presentation and "$[i]" for an array of them.
+func presentationSubmission(pd map[string]any, matches []CredentialMatch) map[string]any {
+	descriptors := make(map[string]map[string]any)
+	for _, d := range jsonutil.GetArray(pd, "input_descriptors") {
+		if desc, ok := d.(map[string]any); ok {
+			descriptors[jsonutil.GetString(desc, "id")] = desc
+		}
+	}
+
+	descriptorMap := make([]any, 0, len(matches))
+	for i, m := range matches {
+		path := "$"
+		if len(matches) > 1 {
+			path = fmt.Sprintf("$[%d]", i)
+		}
+		descriptorMap = append(descriptorMap, map[string]any{
+			"id":     m.QueryID,
+			"format": inputDescriptorFormat(pd, descriptors[m.QueryID], m.Format),
+			"path":   path,
+		})
+	}
+	return map[string]any{
+		"id":             uuid.New().String(),
+		"definition_id":  jsonutil.GetString(pd, "id"),
+		"descriptor_map": descriptorMap,
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []any
+		ok   bool
+	}{
+		{"$.given_name", []any{"given_name"}, true},
+		{"$.address.locality", []any{"address", "locality"}, true},
+		{"$['eu.europa.ec.eudi.pid.1']['family_name']", []any{"eu.europa.ec.eudi.pid.1", "family_name"}, true},
+		{`$["address"]["locality"]`, []any{"address", "locality"}, true},
+		{"$.nationalities[0]", []any{"nationalities", float64(0)}, true},
+		{"$.nationalities[*]", []any{"nationalities", nil}, true},
+		{"$.address.*", []any{"address", nil}, true},
+		{"$", nil, false},
+		{"given_name", nil, false},
+		{"$..given_name", nil, false},
+		{"$.nationalities[-1]", nil, false},
+		{"$['unterminated]", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, ok := parseJSONPath(tt.expr)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if tt.ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("path = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluatePresentationDefinition(t *testing.T) {
+	w := generateTestWalletWithPID(t)
+
+	sdJWTDescriptor := func(fields ...any) map[string]any {
+		return map[string]any{
+			"id":          "pid",
+			"format":      map[string]any{"vc+sd-jwt": map[string]any{}},
+			"constraints": map[string]any{"fields": fields},
+		}
+	}
+	field := func(path string, filter map[string]any) map[string]any {
+		f := map[string]any{"path": []any{path}}
+		if filter != nil {
+			f["filter"] = filter
+		}
+		return f
+	}
+
+	tests := []struct {
+		name      string
+		desc      map[string]any
+		wantPaths [][]any
+	}{
+		{
+			"const filter",
+			sdJWTDescriptor(field("$.vct", map[string]any{"const": mock.DefaultPIDVCT}), field("$.given_name", nil)),
+			[][]any{{"vct"}, {"given_name"}},
+		},
+		{
+			"const mismatch",
+			sdJWTDescriptor(field("$.vct", map[string]any{"const": "urn:other"})),
+			nil,
+		},
+		{
+			"type and pattern",
+			sdJWTDescriptor(field("$.birthdate", map[string]any{"type": "string", "pattern": `^\d{4}-\d{2}-\d{2}$`})),
+			[][]any{{"birthdate"}},
+		},
+		{
+			"enum",
+			sdJWTDescriptor(field("$.address.locality", map[string]any{"enum": []any{"BERLIN", "KÖLN"}})),
+			[][]any{{"address", "locality"}},
+		},
+		{
+			"contains",
+			sdJWTDescriptor(field("$.nationalities", map[string]any{"type": "array", "contains": map[string]any{"const": "DE"}})),
+			[][]any{{"nationalities"}},
+		},
+		{
+			"type mismatch",
+			sdJWTDescriptor(field("$.given_name", map[string]any{"type": "boolean"})),
+			nil,
+		},
+		{
+			"optional field missing",
+			sdJWTDescriptor(field("$.given_name", nil), map[string]any{"path": []any{"$.missing"}, "optional": true}),
+			[][]any{{"given_name"}},
+		},
+		{
+			"required field missing",
+			sdJWTDescriptor(field("$.missing", nil)),
+			nil,
+		},
+		{
+			"alternative paths",
+			sdJWTDescriptor(map[string]any{"path": []any{"$.credentialSubject.family_name", "$.family_name"}}),
+			[][]any{{"family_name"}},
+		},
+		{
+			"mdoc by doctype",
+			map[string]any{
+				"id":          "eu.europa.ec.eudi.pid.1",
+				"format":      map[string]any{"mso_mdoc": map[string]any{}},
+				"constraints": map[string]any{"fields": []any{field("$['eu.europa.ec.eudi.pid.1']['given_name']", nil)}},
+			},
+			[][]any{{"eu.europa.ec.eudi.pid.1", "given_name"}},
+		},
+		{
+			"mdoc id is not the doctype",
+			map[string]any{
+				"id":          "pid",
+				"format":      map[string]any{"mso_mdoc": map[string]any{}},
+				"constraints": map[string]any{"fields": []any{field("$['eu.europa.ec.eudi.pid.1']['given_name']", nil)}},
+			},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pd := map[string]any{"id": "pd", "input_descriptors": []any{tt.desc}}
+			matches := w.EvaluatePresentationDefinition(pd)
+			if tt.wantPaths == nil {
+				if matches != nil {
+					t.Fatalf("expected no match, got %+v", matches)
+				}
+				return
+			}
+			if len(matches) != 1 {
+				t.Fatalf("expected 1 match, got %d", len(matches))
+			}
+			if matches[0].QueryID != tt.desc["id"] {
+				t.Errorf("QueryID = %s, want %s", matches[0].QueryID, tt.desc["id"])
+			}
+			if !reflect.DeepEqual(matches[0].SelectedPaths, tt.wantPaths) {
+				t.Errorf("SelectedPaths = %v, want %v", matches[0].SelectedPaths, tt.wantPaths)
+			}
+		})
+	}
+}
+
+func TestEvaluatePresentationDefinition_DefinitionFormat(t *testing.T) {
+	w := generateTestWalletWithPID(t)
+	w.PreferredFormat = "dc+sd-jwt"
+
+	pd := map[string]any{
+		"id":                "pd",
+		"format":            map[string]any{"mso_mdoc": map[string]any{}},
+		"input_descriptors": []any{map[string]any{"id": "eu.europa.ec.eudi.pid.1"}},
+	}
+	matches := w.EvaluatePresentationDefinition(pd)
+	if len(matches) != 1 || matches[0].Format != "mso_mdoc" {
+		t.Fatalf("expected the mDoc PID despite the preferred format, got %+v", matches)
+	}
+	if len(matches[0].SelectedPaths) == 0 {
+		t.Error("expected all claims to be selected for a descriptor without fields")
+	}
+}
+
+func TestPresentationSubmission(t *testing.T) {
+	pd := map[string]any{
+		"id": "pd",
+		"input_descriptors": []any{
+			map[string]any{"id": "a", "format": map[string]any{"vc+sd-jwt": map[string]any{}}},
+			map[string]any{"id": "b"},
+		},
+	}
+	matches := []CredentialMatch{
+		{QueryID: "a", Format: "dc+sd-jwt"},
+		{QueryID: "b", Format: "mso_mdoc"},
+	}
+
+	submission := presentationSubmission(pd, matches)
+	if submission["id"] == "" || submission["definition_id"] != "pd" {
+		t.Errorf("unexpected id or definition_id: %v", submission)
+	}
+	want := []any{
+		map[string]any{"id": "a", "format": "vc+sd-jwt", "path": "$[0]"},
+		map[string]any{"id": "b", "format": "mso_mdoc", "path": "$[1]"},
+	}
+	if !reflect.DeepEqual(submission["descriptor_map"], want) {
+		t.Errorf("descriptor_map = %v, want %v", submission["descriptor_map"], want)
+	}
+
+	single := presentationSubmission(pd, matches[:1])
+	if path := single["descriptor_map"].([]any)[0].(map[string]any)["path"]; path != "$" {
+		t.Errorf("single presentation path = %v, want $", path)
+	}
+}
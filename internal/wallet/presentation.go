@@ -15,61 +15,115 @@
 package wallet
 
 import (
-	"crypto/ecdsa"
-	"crypto/rand"
+	"crypto"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"log"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/jsonutil"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
+	"github.com/dominikschlosser/oid4vc-dev/internal/sdjwt"
 )
 
 // PresentationParams holds parameters for VP token creation.
 type PresentationParams struct {
-	Nonce         string
-	ClientID      string
-	ResponseURI   string
-	RedirectURI   string                   // used for fragment response mode
-	ResponseMode  string                   // e.g. "direct_post.jwt", "direct_post", "fragment"
-	RequestObject *oid4vc.RequestObjectJWT // optional, used to extract JWK thumbprint for mDoc
+	Nonce           string
+	ClientID        string
+	ResponseURI     string
+	RedirectURI     string                   // used for fragment response mode
+	ResponseMode    string                   // e.g. "direct_post.jwt", "direct_post", "fragment"
+	RequestObject   *oid4vc.RequestObjectJWT // optional, used to extract JWK thumbprint for mDoc
+	TransactionData []TransactionData        // bound into the presentations of the credential queries they reference
+	Origin          string                   // set for DC API requests (dc_api, dc_api.jwt)
+
+	// PresentationDefinition is set for Presentation Exchange requests of
+	// OID4VP drafts; their response carries a presentation_submission.
+	PresentationDefinition map[string]any
+}
+
+// Audience returns the audience of the presentations: the client_id, or for
+// DC API requests the origin prefixed with "origin:" (OID4VP 1.0 Appendix A.4).
+func (p PresentationParams) Audience() string {
+	if p.Origin != "" {
+		return "origin:" + p.Origin
+	}
+	return p.ClientID
 }
 
 // VPTokenResult holds the result of VP token creation.
 type VPTokenResult struct {
 	Token     string
 	MDocNonce string // only set for ISO mode mDoc
+	Warning   string // set when an already presented batch instance was reused
 }
 
-// CreateVPToken creates a VP token for the given credential match.
+// CreateVPToken creates a VP token for the given credential match. The batch
+// instance it presents is marked used only once the presentation is built.
 func (w *Wallet) CreateVPToken(match CredentialMatch, params PresentationParams) (VPTokenResult, error) {
-	cred, ok := w.GetCredential(match.CredentialID)
-	if !ok {
-		return VPTokenResult{}, fmt.Errorf("credential %s not found", match.CredentialID)
+	sel, err := w.selectInstance(match.CredentialID)
+	if err != nil {
+		return VPTokenResult{}, err
+	}
+	if mismatch := w.vpFormatMismatch(sel.cred, !match.WithoutHolderBinding, params.RequestObject); mismatch != "" {
+		return VPTokenResult{}, vpFormatsNotSupported(mismatch)
 	}
 
+	result, err := w.createVPToken(sel.cred, sel.key, match, params)
+	if err != nil {
+		return VPTokenResult{}, err
+	}
+	w.markInstanceUsed(match.CredentialID, sel.index)
+	result.Warning = sel.warning
+	return result, nil
+}
+
+// createVPToken creates a VP token of a credential bound to holderKey.
+func (w *Wallet) createVPToken(cred StoredCredential, holderKey crypto.Signer, match CredentialMatch, params PresentationParams) (VPTokenResult, error) {
 	typeLabel := cred.VCT
 	if typeLabel == "" {
 		typeLabel = cred.DocType
 	}
 	log.Printf("[VP] Creating VP token: format=%s type=%s claims=%v", cred.Format, typeLabel, match.SelectedKeys)
 
+	txHashes := transactionDataHashes(params.TransactionData, match.QueryID)
+	if len(txHashes) > 0 {
+		log.Printf("[VP] Binding %d transaction data hash(es) for %s", len(txHashes), match.QueryID)
+	}
+
 	switch cred.Format {
 	case "dc+sd-jwt":
-		token, err := w.createSDJWTPresentation(cred, match.SelectedKeys, params.Nonce, params.ClientID)
+		paths := match.SelectedPaths
+		if paths == nil {
+			paths = claimPaths(cred, match.SelectedKeys)
+		}
+		bindingKey := holderKey
+		if match.WithoutHolderBinding {
+			if len(txHashes) > 0 {
+				log.Printf("[VP] WARNING: transaction data requires a KB-JWT, including one although holder binding is not required")
+			} else {
+				log.Printf("[VP] Holder binding not required, omitting KB-JWT")
+				bindingKey = nil
+			}
+		}
+		token, err := w.createSDJWTPresentation(cred, bindingKey, paths, params.Nonce, params.Audience(), txHashes, params.RequestObject)
 		if err != nil {
 			return VPTokenResult{}, err
 		}
-		log.Printf("[VP] SD-JWT presentation created: %d disclosures selected, aud=%s", len(match.SelectedKeys), params.ClientID)
 		return VPTokenResult{Token: token}, nil
 	case "jwt_vc_json":
 		log.Printf("[VP] Plain JWT presentation (no selective disclosure)")
 		return VPTokenResult{Token: cred.Raw}, nil
 	case "mso_mdoc":
-		result, err := w.createMDocPresentation(cred, match.SelectedKeys, params)
+		if match.WithoutHolderBinding {
+			log.Printf("[VP] Holder binding not required, but mDoc DeviceResponses always contain DeviceAuth")
+		}
+		result, err := w.createMDocPresentation(cred, holderKey, match.SelectedKeys, params, txHashes)
 		if err != nil {
 			return VPTokenResult{}, err
 		}
@@ -81,63 +135,164 @@ func (w *Wallet) CreateVPToken(match CredentialMatch, params PresentationParams)
 }
 
 // createSDJWTPresentation creates an SD-JWT presentation with selective disclosure and KB-JWT.
-func (w *Wallet) createSDJWTPresentation(cred StoredCredential, selectedKeys []string, nonce, clientID string) (string, error) {
-	// Parse the raw SD-JWT to get the issuer JWT part
-	parts := strings.Split(cred.Raw, "~")
-	if len(parts) < 1 {
-		return "", fmt.Errorf("invalid SD-JWT format")
-	}
-	issuerJWT := parts[0]
-
-	// Build set of selected claim names for filtering
-	selected := make(map[string]bool, len(selectedKeys))
-	for _, k := range selectedKeys {
-		selected[k] = true
-	}
-
-	// Collect digests of array entries referenced by selected disclosures.
-	// When a disclosure's value contains {"...": digest} entries (array element
-	// references), those digests identify which array entry disclosures to include.
-	referencedArrayDigests := make(map[string]bool)
-	for _, d := range cred.Disclosures {
-		if !d.IsArrayEntry && selected[d.Name] {
-			collectArrayDigests(d.Value, referencedArrayDigests)
-		}
-	}
-
-	// Filter disclosures to only include selected claims and their array entries
-	var selectedDisclosures []string
-	for _, d := range cred.Disclosures {
-		if d.IsArrayEntry {
-			if referencedArrayDigests[d.Digest] {
-				selectedDisclosures = append(selectedDisclosures, d.Raw)
-			}
-		} else if selected[d.Name] {
-			selectedDisclosures = append(selectedDisclosures, d.Raw)
-		}
+// It includes exactly the disclosures needed to disclose the claims at paths.
+// Without a holder key, the presentation has no KB-JWT. The KB-JWT binds
+// the given transaction data hashes.
+func (w *Wallet) createSDJWTPresentation(cred StoredCredential, holderKey crypto.Signer, paths [][]any, nonce, clientID string, txHashes [][]byte, reqObj *oid4vc.RequestObjectJWT) (string, error) {
+	issuerJWT, _, disclosures, err := selectSDJWTDisclosures(cred, paths)
+	if err != nil {
+		return "", err
 	}
 
 	// Build the SD-JWT without KB-JWT: issuer_jwt~disc1~disc2~...~
-	withoutKB := issuerJWT + "~" + strings.Join(selectedDisclosures, "~") + "~"
+	withoutKB := issuerJWT + "~"
+	for _, d := range disclosures {
+		withoutKB += d.Raw + "~"
+	}
+	if holderKey == nil {
+		log.Printf("[VP] SD-JWT presentation created: %d of %d disclosures selected, no KB-JWT", len(disclosures), len(cred.Disclosures))
+		return withoutKB, nil
+	}
 
 	// Compute sd_hash = base64url(SHA-256(sd-jwt-without-kb))
 	sdHash := sha256.Sum256([]byte(withoutKB))
 	sdHashB64 := format.EncodeBase64URL(sdHash[:])
 
 	// Create Key Binding JWT
-	kbJWT, err := w.createKBJWT(nonce, clientID, sdHashB64)
+	kbJWT, err := w.createKBJWT(holderKey, nonce, clientID, sdHashB64, txHashes, reqObj)
 	if err != nil {
 		return "", fmt.Errorf("creating KB-JWT: %w", err)
 	}
 
+	log.Printf("[VP] SD-JWT presentation created: %d of %d disclosures selected, aud=%s", len(disclosures), len(cred.Disclosures), clientID)
+
 	// Final: issuer_jwt~disc1~disc2~...~kb_jwt
 	return withoutKB + kbJWT, nil
 }
 
-// createKBJWT creates a Key Binding JWT.
-func (w *Wallet) createKBJWT(nonce, audience, sdHash string) (string, error) {
+// selectSDJWTDisclosures returns the issuer-signed JWT of an SD-JWT
+// credential, its payload, and the disclosures that disclose the claims at
+// paths.
+func selectSDJWTDisclosures(cred StoredCredential, paths [][]any) (string, map[string]any, []sdjwt.Disclosure, error) {
+	issuerJWT, _, _ := strings.Cut(cred.Raw, "~")
+	_, payload, _, err := format.ParseJWTParts(issuerJWT)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("invalid SD-JWT format: %w", err)
+	}
+	return issuerJWT, payload, sdjwt.SelectDisclosures(payload, cred.Disclosures, paths), nil
+}
+
+// disclosedClaims returns the claims a presentation of the claims at paths
+// discloses. For SD-JWT, nested objects and arrays contain only the selected
+// members and elements, besides those the issuer made always visible.
+func disclosedClaims(cred StoredCredential, paths [][]any) map[string]any {
+	keys := claimKeys(cred, paths)
+	if cred.Format != "dc+sd-jwt" {
+		return filterClaims(cred.Claims, keys)
+	}
+	_, payload, disclosures, err := selectSDJWTDisclosures(cred, paths)
+	if err != nil {
+		return filterClaims(cred.Claims, keys)
+	}
+	claims := filterClaims(sdjwt.ResolveClaims(payload, disclosures), keys)
+	for k, v := range claims {
+		claims[k] = dropUndisclosedElements(v)
+	}
+	return claims
+}
+
+// ApplyConsent narrows the matches to the claims the user selected in the
+// consent dialog. Selected claims path pointers and the legacy top-level claim
+// names can only remove claims the query requested, never add any. Matches
+// without a selection for their credential are left unchanged.
+func (w *Wallet) ApplyConsent(matches []CredentialMatch, result ConsentResult) {
+	for i, m := range matches {
+		cred, ok := w.GetCredential(m.CredentialID)
+		if !ok {
+			continue
+		}
+		requested := m.SelectedPaths
+		if requested == nil {
+			requested = claimPaths(cred, m.SelectedKeys)
+		}
+
+		var paths [][]any
+		if selected, ok := result.SelectedPaths[m.CredentialID]; ok {
+			for _, path := range requested {
+				if slices.ContainsFunc(selected, func(p []any) bool { return claimPathEqual(p, path) }) {
+					paths = append(paths, path)
+				}
+			}
+		} else if names, ok := result.SelectedClaims[m.CredentialID]; ok {
+			for _, path := range requested {
+				if slices.Contains(names, claimKeyFromPath(cred, path)) {
+					paths = append(paths, path)
+				}
+			}
+		} else {
+			continue
+		}
+
+		matches[i].SelectedPaths = paths
+		matches[i].SelectedKeys = claimKeys(cred, paths)
+		matches[i].Claims = disclosedClaims(cred, paths)
+	}
+}
+
+// claimPathEqual reports whether two claims path pointers are equal. Indices
+// compare by value, since JSON decodes them as float64.
+func claimPathEqual(a, b []any) bool {
+	return slices.EqualFunc(a, b, func(x, y any) bool {
+		if i, ok := integerValue(x); ok {
+			j, ok := integerValue(y)
+			return ok && i == j
+		}
+		return x == y
+	})
+}
+
+// dropUndisclosedElements removes the {"...": digest} references of array
+// elements that are not disclosed.
+func dropUndisclosedElements(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, child := range val {
+			out[k] = dropUndisclosedElements(child)
+		}
+		return out
+	case []any:
+		out := make([]any, 0, len(val))
+		for _, item := range val {
+			if obj, ok := item.(map[string]any); ok && len(obj) == 1 {
+				if _, isRef := obj["..."].(string); isRef {
+					continue
+				}
+			}
+			out = append(out, dropUndisclosedElements(item))
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// createKBJWT creates a Key Binding JWT signed with the credential's holder key,
+// with an algorithm of the verifier's kb-jwt_alg_values if it has any.
+// Transaction data hashes are added as transaction_data_hashes (OID4VP 1.0
+// Appendix B.3.3).
+func (w *Wallet) createKBJWT(holderKey crypto.Signer, nonce, audience, sdHash string, txHashes [][]byte, reqObj *oid4vc.RequestObjectJWT) (string, error) {
+	meta := jsonutil.GetMap(VPFormatsSupported(reqObj), "dc+sd-jwt")
+	algs := w.holderAlgs(holderKey.Public())
+	alg := negotiateKBJWTAlg(meta, algs)
+	if alg == "" {
+		if _, ok := meta["kb-jwt_alg_values"]; ok {
+			return "", vpFormatsNotSupported(fmt.Sprintf("none of the KB-JWT algorithms %v in kb-jwt_alg_values", algs))
+		}
+		alg = w.signingAlg(holderKey)
+	}
 	header := map[string]any{
-		"alg": "ES256",
+		"alg": string(alg),
 		"typ": "kb+jwt",
 	}
 
@@ -147,12 +302,27 @@ func (w *Wallet) createKBJWT(nonce, audience, sdHash string) (string, error) {
 		"nonce":   nonce,
 		"sd_hash": sdHash,
 	}
+	if len(txHashes) > 0 {
+		hashes := make([]string, len(txHashes))
+		for i, h := range txHashes {
+			hashes[i] = format.EncodeBase64URL(h)
+		}
+		payload["transaction_data_hashes"] = hashes
+		payload["transaction_data_hashes_alg"] = transactionDataHashAlg
+	}
 
-	return signJWT(header, payload, w.HolderKey)
+	return signJWT(header, payload, holderKey)
 }
 
 // signJWT creates and signs a JWT with the given header, payload, and key.
-func signJWT(header, payload map[string]any, key *ecdsa.PrivateKey) (string, error) {
+// The alg header selects between the algorithms of the key, e.g. RS256 and
+// PS256; a key that cannot sign with it is an error.
+func signJWT(header, payload map[string]any, key crypto.Signer) (string, error) {
+	alg := keys.Algorithm(jsonutil.GetString(header, "alg"))
+	if !keys.SupportsAlgorithm(key.Public(), alg) {
+		return "", fmt.Errorf("%T key cannot sign with %q", key.Public(), alg)
+	}
+
 	headerJSON, err := json.Marshal(header)
 	if err != nil {
 		return "", fmt.Errorf("marshaling header: %w", err)
@@ -162,39 +332,30 @@ func signJWT(header, payload map[string]any, key *ecdsa.PrivateKey) (string, err
 		return "", fmt.Errorf("marshaling payload: %w", err)
 	}
 
-	headerB64 := format.EncodeBase64URL(headerJSON)
-	payloadB64 := format.EncodeBase64URL(payloadJSON)
-
-	sigInput := headerB64 + "." + payloadB64
-	h := sha256.Sum256([]byte(sigInput))
-
-	r, s, err := ecdsa.Sign(rand.Reader, key, h[:])
+	sigInput := format.EncodeBase64URL(headerJSON) + "." + format.EncodeBase64URL(payloadJSON)
+	sig, err := keys.SignJWS(key, alg, []byte(sigInput))
 	if err != nil {
 		return "", fmt.Errorf("signing: %w", err)
 	}
 
-	keySize := (key.Curve.Params().BitSize + 7) / 8
-	rBytes := r.Bytes()
-	sBytes := s.Bytes()
-	sig := make([]byte, 2*keySize)
-	copy(sig[keySize-len(rBytes):keySize], rBytes)
-	copy(sig[2*keySize-len(sBytes):], sBytes)
-
 	return sigInput + "." + format.EncodeBase64URL(sig), nil
 }
 
 // VPTokenMapResult holds the result of creating VP tokens for all matches.
 type VPTokenMapResult struct {
-	TokenMap  map[string]string
-	MDocNonce string // set if any mDoc credential produced a nonce (ISO mode)
+	TokenMap      map[string][]string // query credential ID → presentations
+	Presentations []string            // all presentations in match order
+	Submission    map[string]any      // presentation_submission, set for Presentation Exchange requests
+	MDocNonce     string              // set if any mDoc credential produced a nonce (ISO mode)
+	Warnings      []string            // reused batch instances
 }
 
 // CreateVPTokenMap creates a vp_token as a JSON object for DCQL responses.
-// Maps query credential ID → presentation string.
+// Maps query credential ID → presentations, one per matched credential.
 func (w *Wallet) CreateVPTokenMap(matches []CredentialMatch, params PresentationParams) (*VPTokenMapResult, error) {
 	log.Printf("[VP] Creating VP token map: %d credentials, client=%s, response_mode=%s", len(matches), params.ClientID, params.ResponseMode)
 	result := &VPTokenMapResult{
-		TokenMap: make(map[string]string),
+		TokenMap: make(map[string][]string),
 	}
 
 	for _, match := range matches {
@@ -202,10 +363,17 @@ func (w *Wallet) CreateVPTokenMap(matches []CredentialMatch, params Presentation
 		if err != nil {
 			return nil, fmt.Errorf("creating VP token for %s: %w", match.QueryID, err)
 		}
-		result.TokenMap[match.QueryID] = tokenResult.Token
+		result.TokenMap[match.QueryID] = append(result.TokenMap[match.QueryID], tokenResult.Token)
+		result.Presentations = append(result.Presentations, tokenResult.Token)
 		if tokenResult.MDocNonce != "" {
 			result.MDocNonce = tokenResult.MDocNonce
 		}
+		if tokenResult.Warning != "" {
+			result.Warnings = append(result.Warnings, tokenResult.Warning)
+		}
+	}
+	if params.PresentationDefinition != nil {
+		result.Submission = presentationSubmission(params.PresentationDefinition, matches)
 	}
 
 	log.Printf("[VP] VP token map created: queries=%v", mapKeys(result.TokenMap))
@@ -217,11 +385,24 @@ func (w *Wallet) CreateVPTokenMap(matches []CredentialMatch, params Presentation
 func (r *VPTokenMapResult) VPToken() map[string][]string {
 	vpToken := make(map[string][]string, len(r.TokenMap))
 	for k, v := range r.TokenMap {
-		vpToken[k] = []string{v}
+		vpToken[k] = slices.Clone(v)
 	}
 	return vpToken
 }
 
+// ResponseToken returns the vp_token response parameter: the DCQL object of
+// VPToken or, for Presentation Exchange requests, the only presentation or
+// the array of presentations the presentation_submission describes.
+func (r *VPTokenMapResult) ResponseToken() any {
+	if r.Submission == nil {
+		return r.VPToken()
+	}
+	if len(r.Presentations) == 1 {
+		return r.Presentations[0]
+	}
+	return slices.Clone(r.Presentations)
+}
+
 // QueryIDs returns the credential query IDs in the token map.
 func (r *VPTokenMapResult) QueryIDs() []string {
 	return mapKeys(r.TokenMap)
@@ -230,12 +411,12 @@ func (r *VPTokenMapResult) QueryIDs() []string {
 // SubmitPresentation builds the vp_token, optionally encrypts it, and submits to the verifier.
 // If idToken is non-empty, it is included alongside vp_token in the response.
 func (w *Wallet) SubmitPresentation(vpResult *VPTokenMapResult, idToken, state, responseURI string, params PresentationParams) (*DirectPostResult, error) {
-	var vpToken map[string][]string
-	if vpResult != nil {
-		vpToken = vpResult.VPToken()
-	}
+	var vpToken any
+	var submission map[string]any
 	var mdocNonce string
 	if vpResult != nil {
+		vpToken = vpResult.ResponseToken()
+		submission = vpResult.Submission
 		mdocNonce = vpResult.MDocNonce
 	}
 
@@ -244,7 +425,7 @@ func (w *Wallet) SubmitPresentation(vpResult *VPTokenMapResult, idToken, state,
 		if !HasEncryptionKey(params.RequestObject) {
 			return nil, fmt.Errorf("response_mode is direct_post.jwt but no encryption key found in client_metadata.jwks — verifier must provide JWK per OID4VP 1.0")
 		}
-		jwe, cek, err := w.EncryptResponse(vpToken, idToken, state, mdocNonce, params)
+		jwe, cek, err := w.EncryptResponse(vpToken, submission, idToken, state, mdocNonce, params)
 		if err != nil {
 			return nil, fmt.Errorf("encrypting response: %w", err)
 		}
@@ -255,7 +436,7 @@ func (w *Wallet) SubmitPresentation(vpResult *VPTokenMapResult, idToken, state,
 		if redirectURI == "" {
 			redirectURI = responseURI
 		}
-		redirectURL, err := BuildFragmentRedirect(redirectURI, state, vpToken, idToken)
+		redirectURL, err := BuildFragmentRedirect(redirectURI, state, vpToken, submission, idToken)
 		if err != nil {
 			return nil, fmt.Errorf("building fragment redirect: %w", err)
 		}
@@ -267,21 +448,6 @@ func (w *Wallet) SubmitPresentation(vpResult *VPTokenMapResult, idToken, state,
 
 	default:
 		// direct_post (default)
-		return SubmitDirectPost(responseURI, state, vpToken, idToken)
-	}
-}
-
-// collectArrayDigests walks a disclosure value and collects digests from
-// array element references ({"...": digest} objects).
-func collectArrayDigests(value any, digests map[string]bool) {
-	switch v := value.(type) {
-	case []any:
-		for _, item := range v {
-			if obj, ok := item.(map[string]any); ok {
-				if digest, ok := obj["..."].(string); ok {
-					digests[digest] = true
-				}
-			}
-		}
+		return SubmitDirectPost(responseURI, state, vpToken, submission, idToken)
 	}
 }
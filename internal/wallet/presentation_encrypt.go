@@ -69,7 +69,7 @@ func firstJWK(jwksVal any) map[string]any {
 
 // computeJWKThumbprint computes the RFC 7638 JWK Thumbprint using SHA-256.
 // For EC keys, the required members in lexicographic order are: crv, kty, x, y.
-// For RSA keys: e, kty, n.
+// For RSA keys: e, kty, n. For OKP keys: crv, kty, x.
 func computeJWKThumbprint(jwk map[string]any) []byte {
 	kty, _ := jwk["kty"].(string)
 
@@ -90,6 +90,13 @@ func computeJWKThumbprint(jwk map[string]any) []byte {
 			return nil
 		}
 		canonical = map[string]string{"e": e, "kty": kty, "n": n}
+	case "OKP":
+		crv, _ := jwk["crv"].(string)
+		x, _ := jwk["x"].(string)
+		if crv == "" || x == "" {
+			return nil
+		}
+		canonical = map[string]string{"crv": crv, "kty": kty, "x": x}
 	default:
 		return nil
 	}
@@ -145,19 +152,30 @@ func HasEncryptionKey(reqObj *oid4vc.RequestObjectJWT) bool {
 	return err == nil
 }
 
-// EncryptResponse encrypts vp_token, optional id_token, and state as a JWE for direct_post.jwt response mode.
+// EncryptResponse encrypts vp_token, optional presentation_submission and id_token, and state as a JWE
+// for the direct_post.jwt and dc_api.jwt response modes. DC API responses carry no state.
 // Returns the JWE string and the derived content encryption key (CEK) for debugging.
-func (w *Wallet) EncryptResponse(vpToken any, idToken, state string, mdocNonce string, params PresentationParams) (string, []byte, error) {
-	log.Printf("[VP] Encrypting response: response_mode=direct_post.jwt")
-	payload := map[string]any{
-		"state": state,
+func (w *Wallet) EncryptResponse(vpToken any, submission map[string]any, idToken, state string, mdocNonce string, params PresentationParams) (string, []byte, error) {
+	log.Printf("[VP] Encrypting response: response_mode=%s", params.ResponseMode)
+	payload := map[string]any{}
+	if params.Origin == "" {
+		payload["state"] = state
 	}
 	if vpToken != nil {
 		payload["vp_token"] = vpToken
 	}
+	if submission != nil {
+		payload["presentation_submission"] = submission
+	}
 	if idToken != "" {
 		payload["id_token"] = idToken
 	}
+	return encryptResponsePayload(payload, mdocNonce, params)
+}
+
+// encryptResponsePayload encrypts the parameters of an authorization response
+// to the verifier's client_metadata key.
+func encryptResponsePayload(payload map[string]any, mdocNonce string, params PresentationParams) (string, []byte, error) {
 	payloadJSON, err := json.Marshal(payload)
 	if err != nil {
 		return "", nil, fmt.Errorf("marshaling response payload: %w", err)
@@ -15,18 +15,27 @@
 package wallet
 
 import (
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/sha256"
 	"fmt"
+	"log"
 
 	"github.com/fxamacker/cbor/v2"
 	"github.com/veraison/go-cose"
 
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/jsonutil"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
+	"github.com/dominikschlosser/oid4vc-dev/internal/mdoc"
+	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
 )
 
 // createMDocPresentation creates an mDoc DeviceResponse with selected data elements.
-func (w *Wallet) createMDocPresentation(cred StoredCredential, selectedKeys []string, params PresentationParams) (VPTokenResult, error) {
+// Transaction data hashes become device-signed data elements in the namespace
+// named after the docType, so DeviceAuth signs them.
+func (w *Wallet) createMDocPresentation(cred StoredCredential, holderKey crypto.Signer, selectedKeys []string, params PresentationParams, txHashes [][]byte) (VPTokenResult, error) {
 	nonce := params.Nonce
 	clientID := params.ClientID
 	responseURI := params.ResponseURI
@@ -82,7 +91,7 @@ func (w *Wallet) createMDocPresentation(cred StoredCredential, selectedKeys []st
 	}
 
 	var mdocNonce string
-	if mode == SessionTranscriptISO {
+	if mode == SessionTranscriptISO && params.Origin == "" {
 		// ISO mode needs mdocGeneratedNonce
 		nonceBytes := make([]byte, 16)
 		if _, err := rand.Read(nonceBytes); err != nil {
@@ -91,14 +100,34 @@ func (w *Wallet) createMDocPresentation(cred StoredCredential, selectedKeys []st
 		mdocNonce = format.EncodeBase64URL(nonceBytes)
 	}
 
-	jwkThumbprint := extractJWKThumbprint(params.RequestObject)
-	sessionTranscriptBytes, err := w.buildSessionTranscript(clientID, responseURI, nonce, mdocNonce, jwkThumbprint)
+	var sessionTranscriptBytes []byte
+	if params.Origin != "" {
+		var jwkThumbprint []byte
+		if params.ResponseMode == "dc_api.jwt" {
+			jwkThumbprint = extractJWKThumbprint(params.RequestObject)
+		}
+		sessionTranscriptBytes, err = buildSessionTranscriptDCAPI(params.Origin, nonce, jwkThumbprint)
+	} else {
+		jwkThumbprint := extractJWKThumbprint(params.RequestObject)
+		sessionTranscriptBytes, err = w.buildSessionTranscript(clientID, responseURI, nonce, mdocNonce, jwkThumbprint)
+	}
 	if err != nil {
 		return VPTokenResult{}, fmt.Errorf("building SessionTranscript: %w", err)
 	}
 
-	// Create DeviceAuth using COSE_Sign1
-	deviceAuthBytes, err := w.createDeviceAuth(sessionTranscriptBytes, docType)
+	deviceNameSpaces := map[string]any{}
+	if len(txHashes) > 0 {
+		deviceNameSpaces[docType] = map[string]any{
+			"transaction_data_hashes":     txHashes,
+			"transaction_data_hashes_alg": transactionDataHashAlg,
+		}
+	}
+	deviceNameSpacesBytes, err := encodeTag24(deviceNameSpaces)
+	if err != nil {
+		return VPTokenResult{}, fmt.Errorf("encoding DeviceNameSpaces: %w", err)
+	}
+
+	deviceAuth, err := w.createDeviceAuthentication(holderKey, sessionTranscriptBytes, docType, deviceNameSpacesBytes, params.RequestObject)
 	if err != nil {
 		return VPTokenResult{}, fmt.Errorf("creating DeviceAuth: %w", err)
 	}
@@ -111,10 +140,8 @@ func (w *Wallet) createMDocPresentation(cred StoredCredential, selectedKeys []st
 			"issuerAuth": issuerSigned["issuerAuth"],
 		},
 		"deviceSigned": map[string]any{
-			"nameSpaces": map[string]any{},
-			"deviceAuth": map[string]any{
-				"deviceSignature": cbor.RawMessage(deviceAuthBytes),
-			},
+			"nameSpaces": cbor.RawMessage(deviceNameSpacesBytes),
+			"deviceAuth": deviceAuth,
 		},
 	}
 
@@ -206,39 +233,103 @@ func buildSessionTranscriptOID4VP(clientID, nonce string, jwkThumbprint []byte,
 	return cbor.Marshal(sessionTranscript)
 }
 
-// createDeviceAuth creates a COSE_Sign1 DeviceAuth with proper DeviceAuthentication payload.
-// DeviceAuthentication = ["DeviceAuthentication", SessionTranscript, DocType, DeviceNameSpaces]
-// The payload is Tag24(CBOR(DeviceAuthentication)).
-func (w *Wallet) createDeviceAuth(sessionTranscriptBytes []byte, docType string) ([]byte, error) {
-	signer, err := cose.NewSigner(cose.AlgorithmES256, w.HolderKey)
+// buildSessionTranscriptDCAPI builds the OID4VP 1.0 session transcript for
+// requests over the DC API, bound to the origin instead of the client_id.
+// HandoverInfo = CBOR([origin, nonce, jwkThumbprint])
+// OpenID4VPDCAPIHandover = ["OpenID4VPDCAPIHandover", SHA256(HandoverInfo)]
+// SessionTranscript = [null, null, OpenID4VPDCAPIHandover]
+func buildSessionTranscriptDCAPI(origin, nonce string, jwkThumbprint []byte) ([]byte, error) {
+	var thumbprintValue any
+	if len(jwkThumbprint) > 0 {
+		thumbprintValue = jwkThumbprint
+	}
+	handoverInfo, err := cbor.Marshal([]any{origin, nonce, thumbprintValue})
 	if err != nil {
-		return nil, fmt.Errorf("creating COSE signer: %w", err)
+		return nil, fmt.Errorf("encoding HandoverInfo: %w", err)
 	}
+	hash := sha256.Sum256(handoverInfo)
+	return cbor.Marshal([]any{nil, nil, []any{"OpenID4VPDCAPIHandover", hash[:]}})
+}
 
-	// Decode sessionTranscriptBytes back to structured CBOR value
-	var sessionTranscript cbor.RawMessage = sessionTranscriptBytes
+// createDeviceAuthentication creates the DeviceAuth of a document: a
+// deviceMac in DeviceAuthMAC mode if the request has a reader key, a
+// deviceSignature otherwise. The verifier's deviceauth_alg_values decide if it
+// accepts only one of them.
+func (w *Wallet) createDeviceAuthentication(holderKey crypto.Signer, sessionTranscriptBytes []byte, docType string, deviceNameSpacesBytes []byte, reqObj *oid4vc.RequestObjectJWT) (map[string]any, error) {
+	meta := jsonutil.GetMap(VPFormatsSupported(reqObj), "mso_mdoc")
+	mode := w.negotiateDeviceAuth(meta, reqObj, holderKey.Public())
+	switch {
+	case mode == "":
+		return nil, vpFormatsNotSupported("no device authentication algorithm the wallet supports in deviceauth_alg_values")
+	case mode == DeviceAuthMAC:
+		readerKey, err := mdocReaderKey(reqObj)
+		if err != nil {
+			return nil, err
+		}
+		deviceMac, err := createDeviceMac(holderKey.(*ecdsa.PrivateKey), readerKey, sessionTranscriptBytes, docType, deviceNameSpacesBytes)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("[VP] mDoc device authentication: deviceMac")
+		return map[string]any{"deviceMac": cbor.RawMessage(deviceMac)}, nil
+	case w.DeviceAuth == DeviceAuthMAC:
+		log.Printf("[VP] deviceMac not possible (no reader key, no P-256 holder key, or not in deviceauth_alg_values), using deviceSignature")
+	}
 
-	// DeviceAuthentication = ["DeviceAuthentication", SessionTranscript, DocType, {}]
-	deviceAuth := []any{
-		"DeviceAuthentication",
-		sessionTranscript,
-		docType,
-		map[string]any{}, // empty DeviceNameSpaces
+	deviceSignature, err := w.createDeviceAuth(holderKey, w.deviceSignatureAlg(meta, holderKey.Public()), sessionTranscriptBytes, docType, deviceNameSpacesBytes)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"deviceSignature": cbor.RawMessage(deviceSignature)}, nil
+}
+
+// mdocReaderKey returns the reader key for deviceMac: the EC key of the
+// verifier's client_metadata.jwks, as ISO 18013-7 uses the verifier's
+// ephemeral response encryption key as EReaderKey.
+func mdocReaderKey(reqObj *oid4vc.RequestObjectJWT) (*ecdsa.PublicKey, error) {
+	jwk := findEncryptionJWK(reqObj)
+	if jwk == nil {
+		return nil, fmt.Errorf("no key in client_metadata.jwks")
+	}
+	x, _ := jwk["x"].(string)
+	y, _ := jwk["y"].(string)
+	if jwk["kty"] != "EC" || jwk["crv"] != "P-256" || x == "" || y == "" {
+		return nil, fmt.Errorf("client_metadata.jwks key is not an EC P-256 key")
 	}
+	return ecdsaPublicKeyFromJWK(x, y)
+}
 
-	deviceAuthBytes, err := cbor.Marshal(deviceAuth)
+// createDeviceMac creates a COSE_Mac0 deviceMac over the DeviceAuthentication
+// with the EMacKey of the holder key and the reader key (ISO 18013-5 Section
+// 9.1.3.5).
+func createDeviceMac(holderKey *ecdsa.PrivateKey, readerKey *ecdsa.PublicKey, sessionTranscriptBytes []byte, docType string, deviceNameSpacesBytes []byte) ([]byte, error) {
+	key, err := mdoc.DeriveEMacKey(holderKey, readerKey, sessionTranscriptBytes)
+	if err != nil {
+		return nil, fmt.Errorf("deriving EMacKey: %w", err)
+	}
+	deviceAuthBytes, err := mdoc.DeviceAuthenticationBytes(sessionTranscriptBytes, docType, deviceNameSpacesBytes)
 	if err != nil {
-		return nil, fmt.Errorf("encoding DeviceAuthentication: %w", err)
+		return nil, err
 	}
+	return mdoc.CreateDeviceMac(key, deviceAuthBytes)
+}
 
-	// Wrap in Tag 24
-	tag24Payload, err := cbor.Marshal(cbor.Tag{Number: 24, Content: deviceAuthBytes})
+// createDeviceAuth creates a COSE_Sign1 DeviceAuth with proper DeviceAuthentication payload.
+// DeviceAuthentication = ["DeviceAuthentication", SessionTranscript, DocType, DeviceNameSpacesBytes]
+// The payload is Tag24(CBOR(DeviceAuthentication)).
+func (w *Wallet) createDeviceAuth(holderKey crypto.Signer, alg keys.Algorithm, sessionTranscriptBytes []byte, docType string, deviceNameSpacesBytes []byte) ([]byte, error) {
+	signer, err := keys.COSESigner(holderKey, alg)
+	if err != nil {
+		return nil, fmt.Errorf("creating COSE signer: %w", err)
+	}
+
+	tag24Payload, err := mdoc.DeviceAuthenticationBytes(sessionTranscriptBytes, docType, deviceNameSpacesBytes)
 	if err != nil {
-		return nil, fmt.Errorf("encoding Tag24(DeviceAuthentication): %w", err)
+		return nil, err
 	}
 
 	msg := cose.NewSign1Message()
-	msg.Headers.Protected.SetAlgorithm(cose.AlgorithmES256)
+	msg.Headers.Protected.SetAlgorithm(signer.Algorithm())
 	msg.Payload = tag24Payload
 
 	if err := msg.Sign(rand.Reader, nil, signer); err != nil {
@@ -247,3 +338,12 @@ func (w *Wallet) createDeviceAuth(sessionTranscriptBytes []byte, docType string)
 
 	return msg.MarshalCBOR()
 }
+
+// encodeTag24 encodes v as embedded CBOR: Tag24(bstr .cbor v).
+func encodeTag24(v any) ([]byte, error) {
+	content, err := cbor.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return cbor.Marshal(cbor.Tag{Number: 24, Content: content})
+}
@@ -18,6 +18,8 @@ import (
 	"crypto/ecdsa"
 	"crypto/sha256"
 	"encoding/json"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -25,6 +27,8 @@ import (
 	"github.com/fxamacker/cbor/v2"
 
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
+	"github.com/dominikschlosser/oid4vc-dev/internal/mdoc"
 	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
 	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
 	"github.com/dominikschlosser/oid4vc-dev/internal/sdjwt"
@@ -161,6 +165,198 @@ func TestCreateVPToken_SDJWT_SelectiveDisclosure(t *testing.T) {
 	}
 }
 
+// pidSDJWT returns the SD-JWT PID of a wallet from generateTestWalletWithPID.
+func pidSDJWT(t *testing.T, w *Wallet) StoredCredential {
+	t.Helper()
+	for _, c := range w.GetCredentials() {
+		if c.Format == "dc+sd-jwt" {
+			return c
+		}
+	}
+	t.Fatal("no SD-JWT credential found")
+	return StoredCredential{}
+}
+
+func TestCreateVPToken_SDJWT_ClaimPaths(t *testing.T) {
+	address := mock.SDJWTPIDClaims["address"]
+	tests := []struct {
+		name            string
+		paths           [][]any
+		wantDisclosures string // sorted disclosure names, "..." for array elements
+		wantClaims      map[string]any
+	}{
+		{"nested member", [][]any{{"address", "locality"}}, "address locality",
+			map[string]any{"address": map[string]any{"locality": "KÖLN"}}},
+		{"two nested members", [][]any{{"address", "locality"}, {"address", "postal_code"}}, "address locality postal_code",
+			map[string]any{"address": map[string]any{"locality": "KÖLN", "postal_code": "51147"}}},
+		{"whole object", [][]any{{"address"}}, "address country locality postal_code region street_address",
+			map[string]any{"address": address}},
+		{"all array elements", [][]any{{"nationalities", nil}}, "... nationalities",
+			map[string]any{"nationalities": []any{"DE"}}},
+		{"array index", [][]any{{"nationalities", float64(0)}}, "... nationalities",
+			map[string]any{"nationalities": []any{"DE"}}},
+		{"top-level claim", [][]any{{"given_name"}}, "given_name",
+			map[string]any{"given_name": "ERIKA"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := generateTestWalletWithPID(t)
+			cred := pidSDJWT(t, w)
+
+			result, err := w.CreateVPToken(CredentialMatch{
+				QueryID:       "pid",
+				CredentialID:  cred.ID,
+				Format:        cred.Format,
+				SelectedPaths: tt.paths,
+			}, PresentationParams{Nonce: "n", ClientID: "client", ResponseURI: "response"})
+			if err != nil {
+				t.Fatalf("CreateVPToken error: %v", err)
+			}
+			parsed, err := sdjwt.Parse(result.Token)
+			if err != nil {
+				t.Fatalf("parsing VP token: %v", err)
+			}
+
+			var names []string
+			for _, d := range parsed.Disclosures {
+				if d.IsArrayEntry {
+					names = append(names, "...")
+				} else {
+					names = append(names, d.Name)
+				}
+			}
+			sort.Strings(names)
+			if got := strings.Join(names, " "); got != tt.wantDisclosures {
+				t.Errorf("disclosures = %q, want %q", got, tt.wantDisclosures)
+			}
+			for k, want := range tt.wantClaims {
+				if got := parsed.ResolvedClaims[k]; !reflect.DeepEqual(got, want) {
+					t.Errorf("disclosed %s = %v, want %v", k, got, want)
+				}
+			}
+			if disclosed := disclosedClaims(cred, tt.paths); !reflect.DeepEqual(disclosed, tt.wantClaims) {
+				t.Errorf("disclosedClaims() = %v, want %v", disclosed, tt.wantClaims)
+			}
+		})
+	}
+}
+
+func TestCreateVPToken_SDJWT_WithoutHolderBinding(t *testing.T) {
+	w := generateTestWalletWithPID(t)
+	cred := pidSDJWT(t, w)
+
+	result, err := w.CreateVPToken(CredentialMatch{
+		QueryID:              "pid",
+		CredentialID:         cred.ID,
+		Format:               cred.Format,
+		SelectedPaths:        [][]any{{"given_name"}},
+		WithoutHolderBinding: true,
+	}, PresentationParams{Nonce: "n", ClientID: "client", ResponseURI: "response"})
+	if err != nil {
+		t.Fatalf("CreateVPToken error: %v", err)
+	}
+	if !strings.HasSuffix(result.Token, "~") {
+		t.Errorf("expected an SD-JWT without KB-JWT ending in ~, got %s", result.Token)
+	}
+	parsed, err := sdjwt.Parse(result.Token)
+	if err != nil {
+		t.Fatalf("parsing VP token: %v", err)
+	}
+	if parsed.KeyBindingJWT != nil {
+		t.Error("expected no KB-JWT")
+	}
+	if len(parsed.Disclosures) != 1 || parsed.Disclosures[0].Name != "given_name" {
+		t.Errorf("expected only the given_name disclosure, got %d disclosures", len(parsed.Disclosures))
+	}
+}
+
+func TestCreateVPTokenMap_Multiple(t *testing.T) {
+	w := generateTestWallet(t)
+	for range 2 {
+		if _, err := w.ImportCredential(generateTestCredential(t, w)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	matches := w.EvaluateDCQL(map[string]any{
+		"credentials": []any{
+			map[string]any{"id": "cred", "format": "dc+sd-jwt", "multiple": true},
+		},
+	})
+
+	vpResult, err := w.CreateVPTokenMap(matches, PresentationParams{Nonce: "nonce", ClientID: "client", ResponseURI: "response_uri"})
+	if err != nil {
+		t.Fatalf("CreateVPTokenMap error: %v", err)
+	}
+	vp := vpResult.VPToken()
+	if len(vp) != 1 || len(vp["cred"]) != 2 {
+		t.Fatalf("expected two presentations for query cred, got %v", vp)
+	}
+	if vp["cred"][0] == vp["cred"][1] {
+		t.Error("expected presentations of two different credentials")
+	}
+}
+
+func TestApplyConsent(t *testing.T) {
+	w := generateTestWalletWithPID(t)
+	cred := pidSDJWT(t, w)
+	requested := func() []CredentialMatch {
+		paths := [][]any{{"given_name"}, {"address", "locality"}, {"address", "postal_code"}}
+		return []CredentialMatch{{
+			QueryID:       "pid",
+			CredentialID:  cred.ID,
+			Format:        cred.Format,
+			Claims:        disclosedClaims(cred, paths),
+			SelectedKeys:  claimKeys(cred, paths),
+			SelectedPaths: paths,
+		}}
+	}
+
+	t.Run("selected paths", func(t *testing.T) {
+		matches := requested()
+		w.ApplyConsent(matches, ConsentResult{Approved: true, SelectedPaths: map[string][][]any{
+			cred.ID: {{"address", "locality"}, {"family_name"}},
+		}})
+		m := matches[0]
+		if len(m.SelectedPaths) != 1 || !claimPathEqual(m.SelectedPaths[0], []any{"address", "locality"}) {
+			t.Errorf("expected only the requested address.locality path, got %v", m.SelectedPaths)
+		}
+		if len(m.SelectedKeys) != 1 || m.SelectedKeys[0] != "address" {
+			t.Errorf("SelectedKeys = %v, want [address]", m.SelectedKeys)
+		}
+		want := map[string]any{"address": map[string]any{"locality": "KÖLN"}}
+		if !reflect.DeepEqual(m.Claims, want) {
+			t.Errorf("Claims = %v, want %v", m.Claims, want)
+		}
+	})
+
+	t.Run("nothing selected", func(t *testing.T) {
+		matches := requested()
+		w.ApplyConsent(matches, ConsentResult{Approved: true, SelectedPaths: map[string][][]any{cred.ID: {}}})
+		if len(matches[0].SelectedPaths) != 0 || len(matches[0].Claims) != 0 {
+			t.Errorf("expected no claims, got %v", matches[0].SelectedPaths)
+		}
+	})
+
+	t.Run("legacy claim names", func(t *testing.T) {
+		matches := requested()
+		w.ApplyConsent(matches, ConsentResult{Approved: true, SelectedClaims: map[string][]string{cred.ID: {"address"}}})
+		if len(matches[0].SelectedPaths) != 2 {
+			t.Errorf("expected the two requested address paths, got %v", matches[0].SelectedPaths)
+		}
+		if _, ok := matches[0].Claims["given_name"]; ok {
+			t.Error("given_name was deselected")
+		}
+	})
+
+	t.Run("no selection for credential", func(t *testing.T) {
+		matches := requested()
+		w.ApplyConsent(matches, ConsentResult{Approved: true, SelectedClaims: map[string][]string{}})
+		if len(matches[0].SelectedPaths) != 3 {
+			t.Errorf("expected the match to be unchanged, got %v", matches[0].SelectedPaths)
+		}
+	})
+}
+
 func TestCreateVPToken_PlainJWT(t *testing.T) {
 	w := generateTestWallet(t)
 
@@ -391,6 +587,20 @@ func TestSignJWT(t *testing.T) {
 	}
 }
 
+func TestSignJWT_UnsupportedAlg(t *testing.T) {
+	key, _ := mock.GenerateKey()
+
+	for _, alg := range []string{"PS256", "ES384", ""} {
+		header := map[string]any{"alg": alg, "typ": "test+jwt"}
+		if _, err := signJWT(header, map[string]any{"sub": "test"}, key); err == nil {
+			t.Errorf("expected an error signing %q with a P-256 key", alg)
+		}
+		if header["alg"] != alg {
+			t.Errorf("alg header rewritten from %q to %v", alg, header["alg"])
+		}
+	}
+}
+
 func TestCreateVPToken_ImportedSDJWT_PreservesDisclosures(t *testing.T) {
 	// Simulates importing an externally-issued SD-JWT and presenting it
 	w := generateTestWallet(t)
@@ -403,7 +613,7 @@ func TestCreateVPToken_ImportedSDJWT_PreservesDisclosures(t *testing.T) {
 		ExpiresIn: 24 * time.Hour,
 		Claims:    map[string]any{"user_id": "abc123", "role": "admin", "department": "engineering"},
 		Key:       externalKey,
-		HolderKey: &w.HolderKey.PublicKey,
+		HolderKey: w.HolderKey.Public(),
 	})
 	if err != nil {
 		t.Fatalf("generating external SD-JWT: %v", err)
@@ -498,7 +708,7 @@ func TestEncryptResponse_UsesEncryptedResponseEncValuesSupported(t *testing.T) {
 		RequestObject: reqObj,
 	}
 
-	jweStr, _, err := w.EncryptResponse(map[string]any{"test": "value"}, "", "state", "", params)
+	jweStr, _, err := w.EncryptResponse(map[string]any{"test": "value"}, nil, "", "state", "", params)
 	if err != nil {
 		t.Fatalf("EncryptResponse error: %v", err)
 	}
@@ -544,7 +754,7 @@ func TestEncryptResponse_DefaultsToA128GCMWhenNoEncValues(t *testing.T) {
 		RequestObject: reqObj,
 	}
 
-	jweStr, _, err := w.EncryptResponse(map[string]any{"test": "value"}, "", "state", "", params)
+	jweStr, _, err := w.EncryptResponse(map[string]any{"test": "value"}, nil, "", "state", "", params)
 	if err != nil {
 		t.Fatalf("EncryptResponse error: %v", err)
 	}
@@ -583,7 +793,7 @@ func TestEncryptResponse_TopLevelJWKSNotUsed(t *testing.T) {
 		RequestObject: reqObj,
 	}
 
-	_, _, err := w.EncryptResponse(map[string]any{"test": "value"}, "", "state", "", params)
+	_, _, err := w.EncryptResponse(map[string]any{"test": "value"}, nil, "", "state", "", params)
 	if err == nil {
 		t.Fatal("expected error when JWK is only in top-level jwks (not client_metadata.jwks)")
 	}
@@ -615,7 +825,7 @@ func TestEncryptResponse_LegacyFieldNamesIgnored(t *testing.T) {
 		RequestObject: reqObj,
 	}
 
-	jweStr, _, err := w.EncryptResponse(map[string]any{"test": "value"}, "", "state", "", params)
+	jweStr, _, err := w.EncryptResponse(map[string]any{"test": "value"}, nil, "", "state", "", params)
 	if err != nil {
 		t.Fatalf("EncryptResponse error: %v", err)
 	}
@@ -713,7 +923,7 @@ func TestSubmitPresentation_DirectPostJWT_NoEncryptionKey(t *testing.T) {
 	w := generateTestWallet(t)
 
 	vpResult := &VPTokenMapResult{
-		TokenMap: map[string]string{"q1": "dummy-token"},
+		TokenMap: map[string][]string{"q1": {"dummy-token"}},
 	}
 
 	// response_mode=direct_post.jwt but no encryption key in request object
@@ -761,7 +971,7 @@ func TestEncryptResponse_UsesAlgFromJWK(t *testing.T) {
 		RequestObject: reqObj,
 	}
 
-	jweStr, _, err := w.EncryptResponse(map[string]any{"test": "value"}, "", "state", "", params)
+	jweStr, _, err := w.EncryptResponse(map[string]any{"test": "value"}, nil, "", "state", "", params)
 	if err != nil {
 		t.Fatalf("EncryptResponse error: %v", err)
 	}
@@ -803,7 +1013,7 @@ func TestEncryptResponse_ErrorWhenJWKMissingAlg(t *testing.T) {
 		RequestObject: reqObj,
 	}
 
-	_, _, err := w.EncryptResponse(map[string]any{"test": "value"}, "", "state", "", params)
+	_, _, err := w.EncryptResponse(map[string]any{"test": "value"}, nil, "", "state", "", params)
 	if err == nil {
 		t.Fatal("expected error when JWK is missing 'alg' field")
 	}
@@ -812,27 +1022,11 @@ func TestEncryptResponse_ErrorWhenJWKMissingAlg(t *testing.T) {
 	}
 }
 
-func TestCollectArrayDigests_NonArray(t *testing.T) {
-	digests := make(map[string]bool)
-	collectArrayDigests("not an array", digests)
-	if len(digests) != 0 {
-		t.Error("expected empty digests for non-array")
-	}
-}
-
-func TestCollectArrayDigests_EmptyArray(t *testing.T) {
-	digests := make(map[string]bool)
-	collectArrayDigests([]any{}, digests)
-	if len(digests) != 0 {
-		t.Error("expected empty digests for empty array")
-	}
-}
-
 func TestVPTokenMapResult_VPToken(t *testing.T) {
 	r := &VPTokenMapResult{
-		TokenMap: map[string]string{
-			"pid": "token1",
-			"mdl": "token2",
+		TokenMap: map[string][]string{
+			"pid": {"token1"},
+			"mdl": {"token2"},
 		},
 	}
 	vp := r.VPToken()
@@ -849,7 +1043,7 @@ func TestVPTokenMapResult_VPToken(t *testing.T) {
 
 func TestVPTokenMapResult_VPToken_Empty(t *testing.T) {
 	r := &VPTokenMapResult{
-		TokenMap: map[string]string{},
+		TokenMap: map[string][]string{},
 	}
 	vp := r.VPToken()
 	if len(vp) != 0 {
@@ -859,7 +1053,7 @@ func TestVPTokenMapResult_VPToken_Empty(t *testing.T) {
 
 func TestVPTokenMapResult_QueryIDs(t *testing.T) {
 	r := &VPTokenMapResult{
-		TokenMap: map[string]string{"pid": "t1", "mdl": "t2"},
+		TokenMap: map[string][]string{"pid": {"t1"}, "mdl": {"t2"}},
 	}
 	ids := r.QueryIDs()
 	if len(ids) != 2 {
@@ -877,7 +1071,7 @@ func TestVPTokenMapResult_QueryIDs(t *testing.T) {
 
 func TestVPTokenMapResult_QueryIDs_Empty(t *testing.T) {
 	r := &VPTokenMapResult{
-		TokenMap: map[string]string{},
+		TokenMap: map[string][]string{},
 	}
 	ids := r.QueryIDs()
 	if len(ids) != 0 {
@@ -932,3 +1126,156 @@ func TestEncryptJWE_A128CBCHS256(t *testing.T) {
 		t.Errorf("expected 16-byte tag, got %d bytes", len(tagBytes))
 	}
 }
+
+func TestCreateVPToken_MDoc_DeviceAuth(t *testing.T) {
+	readerKey, _ := mock.GenerateKey()
+	reqObj := &oid4vc.RequestObjectJWT{Payload: map[string]any{
+		"client_metadata": map[string]any{
+			"jwks": map[string]any{"keys": []any{testEncJWK(t, &readerKey.PublicKey)}},
+		},
+	}}
+
+	macOnly := &oid4vc.RequestObjectJWT{Payload: map[string]any{
+		"client_metadata": map[string]any{
+			"jwks": map[string]any{"keys": []any{testEncJWK(t, &readerKey.PublicKey)}},
+			"vp_formats_supported": map[string]any{
+				"mso_mdoc": map[string]any{"deviceauth_alg_values": []any{float64(5)}},
+			},
+		},
+	}}
+
+	tests := []struct {
+		name   string
+		mode   DeviceAuthMode
+		reqObj *oid4vc.RequestObjectJWT
+		want   string
+	}{
+		{"signature", DeviceAuthSignature, reqObj, "deviceSignature"},
+		{"mac", DeviceAuthMAC, reqObj, "deviceMac"},
+		{"mac without reader key", DeviceAuthMAC, nil, "deviceSignature"},
+		{"verifier accepts only mac", DeviceAuthSignature, macOnly, "deviceMac"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := generateTestWalletWithPID(t)
+			w.DeviceAuth = tt.mode
+			var cred StoredCredential
+			for _, c := range w.GetCredentials() {
+				if c.Format == "mso_mdoc" {
+					cred = c
+				}
+			}
+
+			params := PresentationParams{
+				Nonce:         "n",
+				ClientID:      "https://verifier.example",
+				ResponseURI:   "https://verifier.example/response",
+				RequestObject: tt.reqObj,
+			}
+			result, err := w.CreateVPToken(CredentialMatch{
+				QueryID:      "pid_mdoc",
+				CredentialID: cred.ID,
+				Format:       cred.Format,
+				SelectedKeys: []string{cred.DocType + ":given_name"},
+			}, params)
+			if err != nil {
+				t.Fatalf("CreateVPToken error: %v", err)
+			}
+
+			doc, err := mdoc.Parse(result.Token)
+			if err != nil {
+				t.Fatalf("parsing DeviceResponse: %v", err)
+			}
+			if method := doc.DeviceSigned.Method(); method != tt.want {
+				t.Fatalf("device authentication = %q, want %q", method, tt.want)
+			}
+
+			transcript, err := buildSessionTranscriptOID4VP(params.ClientID, params.Nonce, extractJWKThumbprint(tt.reqObj), params.ResponseURI)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r := mdoc.VerifyDeviceAuth(doc, transcript, readerKey); !r.Valid {
+				t.Errorf("device authentication does not verify: %v", r.Errors)
+			}
+			other, _ := buildSessionTranscriptOID4VP(params.ClientID, "other-nonce", extractJWKThumbprint(tt.reqObj), params.ResponseURI)
+			if r := mdoc.VerifyDeviceAuth(doc, other, readerKey); r.Valid {
+				t.Error("device authentication verifies for another session transcript")
+			}
+		})
+	}
+}
+
+func TestCreateVPToken_HolderKeyAlgorithms(t *testing.T) {
+	for _, alg := range []keys.Algorithm{keys.ES384, keys.EdDSA, keys.PS256} {
+		t.Run(string(alg), func(t *testing.T) {
+			holderKey, err := keys.GenerateKey(alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			issuerKey, err := keys.GenerateKey(alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := New(holderKey, issuerKey, false)
+			w.Alg = alg
+			if err := w.GenerateDefaultCredentials(nil, ""); err != nil {
+				t.Fatalf("generating PID credentials: %v", err)
+			}
+
+			params := PresentationParams{
+				Nonce:       "n",
+				ClientID:    "https://verifier.example",
+				ResponseURI: "https://verifier.example/response",
+			}
+			for _, cred := range w.GetCredentials() {
+				selected := []string{"given_name"}
+				if cred.Format == "mso_mdoc" {
+					selected = []string{cred.DocType + ":given_name"}
+				}
+				result, err := w.CreateVPToken(CredentialMatch{
+					QueryID:      "pid",
+					CredentialID: cred.ID,
+					Format:       cred.Format,
+					SelectedKeys: selected,
+				}, params)
+				if err != nil {
+					t.Fatalf("CreateVPToken(%s) error: %v", cred.Format, err)
+				}
+
+				switch cred.Format {
+				case "dc+sd-jwt":
+					parsed, err := sdjwt.Parse(result.Token)
+					if err != nil {
+						t.Fatalf("parsing VP token: %v", err)
+					}
+					if r := sdjwt.Verify(parsed, issuerKey.Public()); !r.SignatureValid || r.Algorithm != string(alg) {
+						t.Errorf("issuer signature: valid=%v alg=%s, want a valid %s signature", r.SignatureValid, r.Algorithm, alg)
+					}
+					kb := parsed.KeyBindingJWT
+					if kb == nil || kb.Header["alg"] != string(alg) {
+						t.Fatalf("expected a %s KB-JWT, got %v", alg, kb)
+					}
+					parts := strings.Split(kb.Raw, ".")
+					if err := keys.VerifyJWS(holderKey.Public(), alg, []byte(parts[0]+"."+parts[1]), kb.Signature); err != nil {
+						t.Errorf("KB-JWT signature: %v", err)
+					}
+				case "mso_mdoc":
+					doc, err := mdoc.Parse(result.Token)
+					if err != nil {
+						t.Fatalf("parsing DeviceResponse: %v", err)
+					}
+					if r := mdoc.Verify(doc, issuerKey.Public()); !r.SignatureValid {
+						t.Errorf("IssuerAuth signature: %v", r.Errors)
+					}
+					transcript, err := buildSessionTranscriptOID4VP(params.ClientID, params.Nonce, nil, params.ResponseURI)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if r := mdoc.VerifyDeviceAuth(doc, transcript, nil); !r.Valid {
+						t.Errorf("deviceSignature: %v", r.Errors)
+					}
+				}
+			}
+		})
+	}
+}
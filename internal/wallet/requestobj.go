@@ -29,17 +29,26 @@ import (
 	"time"
 
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 )
 
 // BuildWalletMetadata builds the wallet_metadata JSON object per OID4VP 1.0 §10.
+// The alg_values_supported are the algorithms of the holder key.
 func BuildWalletMetadata(w *Wallet) map[string]any {
+	algs := []string{string(keys.ES256)}
+	if w.HolderKey != nil {
+		algs = algs[:0]
+		for _, alg := range w.holderAlgs(w.HolderKey.Public()) {
+			algs = append(algs, string(alg))
+		}
+	}
 	meta := map[string]any{
 		"vp_formats_supported": map[string]any{
 			"dc+sd-jwt": map[string]any{
-				"alg_values_supported": []string{"ES256"},
+				"alg_values_supported": algs,
 			},
 			"mso_mdoc": map[string]any{
-				"alg_values_supported": []string{"ES256"},
+				"alg_values_supported": algs,
 			},
 		},
 		"request_object_signing_alg_values_supported": []string{"ES256"},
@@ -203,47 +212,57 @@ func isJWE(s string) bool {
 // DecryptRequestObjectJWE decrypts a JWE-encrypted request object using the wallet's
 // EC private key via ECDH-ES key agreement. Returns the decrypted JWT string.
 func DecryptRequestObjectJWE(jwe string, key *ecdsa.PrivateKey) (string, error) {
+	plaintext, err := DecryptJWE(jwe, key)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(plaintext)), nil
+}
+
+// DecryptJWE decrypts an ECDH-ES compact JWE (A128GCM or A256GCM) addressed
+// to key and returns the plaintext.
+func DecryptJWE(jwe string, key *ecdsa.PrivateKey) ([]byte, error) {
 	parts := strings.Split(jwe, ".")
 	if len(parts) != 5 {
-		return "", fmt.Errorf("invalid JWE: expected 5 parts, got %d", len(parts))
+		return nil, fmt.Errorf("invalid JWE: expected 5 parts, got %d", len(parts))
 	}
 
 	// Parse protected header
 	headerBytes, err := format.DecodeBase64URL(parts[0])
 	if err != nil {
-		return "", fmt.Errorf("decoding JWE header: %w", err)
+		return nil, fmt.Errorf("decoding JWE header: %w", err)
 	}
 	var header map[string]any
 	if err := json.Unmarshal(headerBytes, &header); err != nil {
-		return "", fmt.Errorf("parsing JWE header: %w", err)
+		return nil, fmt.Errorf("parsing JWE header: %w", err)
 	}
 
 	enc, _ := header["enc"].(string)
 	if enc == "" {
-		return "", fmt.Errorf("missing enc in JWE header")
+		return nil, fmt.Errorf("missing enc in JWE header")
 	}
 
 	// Parse ephemeral public key from header
 	epkMap, ok := header["epk"].(map[string]any)
 	if !ok {
-		return "", fmt.Errorf("missing epk in JWE header")
+		return nil, fmt.Errorf("missing epk in JWE header")
 	}
 
 	epkPub, err := parseECPublicKeyFromEPK(epkMap)
 	if err != nil {
-		return "", fmt.Errorf("parsing epk: %w", err)
+		return nil, fmt.Errorf("parsing epk: %w", err)
 	}
 
 	// Convert our ECDSA private key to ECDH
 	ecdhPriv, err := key.ECDH()
 	if err != nil {
-		return "", fmt.Errorf("converting private key to ECDH: %w", err)
+		return nil, fmt.Errorf("converting private key to ECDH: %w", err)
 	}
 
 	// ECDH key agreement
 	z, err := ecdhPriv.ECDH(epkPub)
 	if err != nil {
-		return "", fmt.Errorf("ECDH key agreement: %w", err)
+		return nil, fmt.Errorf("ECDH key agreement: %w", err)
 	}
 
 	// Decode apu/apv from header
@@ -258,22 +277,22 @@ func DecryptRequestObjectJWE(jwe string, key *ecdsa.PrivateKey) (string, error)
 	// Derive CEK via Concat KDF (reuse the wallet's existing concatKDF)
 	keyBitLen, err := encKeyBitLen(enc)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	cek := concatKDF(z, enc, apu, apv, keyBitLen)
 
 	// Decrypt
 	ivBytes, err := format.DecodeBase64URL(parts[2])
 	if err != nil {
-		return "", fmt.Errorf("decoding IV: %w", err)
+		return nil, fmt.Errorf("decoding IV: %w", err)
 	}
 	ciphertext, err := format.DecodeBase64URL(parts[3])
 	if err != nil {
-		return "", fmt.Errorf("decoding ciphertext: %w", err)
+		return nil, fmt.Errorf("decoding ciphertext: %w", err)
 	}
 	tag, err := format.DecodeBase64URL(parts[4])
 	if err != nil {
-		return "", fmt.Errorf("decoding tag: %w", err)
+		return nil, fmt.Errorf("decoding tag: %w", err)
 	}
 
 	var plaintext []byte
@@ -281,13 +300,13 @@ func DecryptRequestObjectJWE(jwe string, key *ecdsa.PrivateKey) (string, error)
 	case "A128GCM", "A256GCM":
 		plaintext, err = decryptAESGCM(cek, ivBytes, ciphertext, tag, []byte(parts[0]))
 	default:
-		return "", fmt.Errorf("unsupported enc algorithm for request object: %s", enc)
+		return nil, fmt.Errorf("unsupported enc algorithm: %s", enc)
 	}
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return strings.TrimSpace(string(plaintext)), nil
+	return plaintext, nil
 }
 
 // parseECPublicKeyFromEPK parses an EC public key from a JWK map (epk field).
@@ -25,54 +25,19 @@ import (
 	"strings"
 )
 
-// SubmitDirectPost submits a VP token and optional id_token via direct_post to the response URI.
-func SubmitDirectPost(responseURI, state string, vpToken any, idToken string) (*DirectPostResult, error) {
+// SubmitDirectPost submits a VP token, the presentation_submission of Presentation Exchange
+// responses, and optional id_token via direct_post to the response URI.
+func SubmitDirectPost(responseURI, state string, vpToken any, submission map[string]any, idToken string) (*DirectPostResult, error) {
 	form := url.Values{}
 	if state != "" {
 		form.Set("state", state)
 	}
 
-	if vpToken != nil {
-		tokenJSON, err := json.Marshal(vpToken)
-		if err != nil {
-			return nil, fmt.Errorf("marshaling vp_token: %w", err)
-		}
-		form.Set("vp_token", string(tokenJSON))
-	}
-	if idToken != "" {
-		form.Set("id_token", idToken)
-	}
-
-	resp, err := http.PostForm(responseURI, form)
-	if err != nil {
-		return nil, fmt.Errorf("posting to response_uri: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("reading response: %w", err)
-	}
-
-	result := &DirectPostResult{
-		StatusCode: resp.StatusCode,
-		Body:       string(body),
-	}
-
-	// Try to parse redirect_uri from response
-	var respJSON map[string]any
-	if err := json.Unmarshal(body, &respJSON); err == nil {
-		if redirectURI, ok := respJSON["redirect_uri"].(string); ok {
-			result.RedirectURI = redirectURI
-		}
-	}
-
-	// Also check Location header
-	if loc := resp.Header.Get("Location"); loc != "" {
-		result.RedirectURI = loc
+	if err := setResponseTokens(form, vpToken, submission, idToken); err != nil {
+		return nil, err
 	}
 
-	return result, nil
+	return postResponseForm(responseURI, form, nil)
 }
 
 // DirectPostResult represents the result of a direct_post submission.
@@ -89,17 +54,28 @@ func SubmitDirectPostJWT(responseURI string, responseJWT string, cek []byte) (*D
 	form := url.Values{}
 	form.Set("response", responseJWT)
 
+	header := http.Header{}
+	if len(cek) > 0 {
+		cekB64 := base64.RawURLEncoding.EncodeToString(cek)
+		header.Set("X-Debug-JWE-CEK", cekB64)
+		log.Printf("[VP] JWE content encryption key for proxy debugging: %s", cekB64)
+	}
+
+	return postResponseForm(responseURI, form, header)
+}
+
+// postResponseForm posts the form parameters of an authorization response to
+// the verifier's response_uri. The verifier's reply may carry a redirect_uri
+// in a JSON body or a Location header.
+func postResponseForm(responseURI string, form url.Values, header http.Header) (*DirectPostResult, error) {
 	req, err := http.NewRequest("POST", responseURI, strings.NewReader(form.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("creating request: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	if len(cek) > 0 {
-		cekB64 := base64.RawURLEncoding.EncodeToString(cek)
-		req.Header.Set("X-Debug-JWE-CEK", cekB64)
-		log.Printf("[VP] JWE content encryption key for proxy debugging: %s", cekB64)
+	for k, vs := range header {
+		req.Header[k] = vs
 	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
@@ -130,19 +106,12 @@ func SubmitDirectPostJWT(responseURI string, responseJWT string, cek []byte) (*D
 	return result, nil
 }
 
-// BuildFragmentRedirect constructs a redirect URL with vp_token, optional id_token, and state as
-// fragment parameters per OID4VP 1.0 fragment response mode.
-func BuildFragmentRedirect(redirectURI, state string, vpToken any, idToken string) (string, error) {
+// BuildFragmentRedirect constructs a redirect URL with vp_token, optional presentation_submission
+// and id_token, and state as fragment parameters per OID4VP 1.0 fragment response mode.
+func BuildFragmentRedirect(redirectURI, state string, vpToken any, submission map[string]any, idToken string) (string, error) {
 	fragment := url.Values{}
-	if vpToken != nil {
-		tokenJSON, err := json.Marshal(vpToken)
-		if err != nil {
-			return "", fmt.Errorf("marshaling vp_token: %w", err)
-		}
-		fragment.Set("vp_token", string(tokenJSON))
-	}
-	if idToken != "" {
-		fragment.Set("id_token", idToken)
+	if err := setResponseTokens(fragment, vpToken, submission, idToken); err != nil {
+		return "", err
 	}
 	if state != "" {
 		fragment.Set("state", state)
@@ -151,6 +120,34 @@ func BuildFragmentRedirect(redirectURI, state string, vpToken any, idToken strin
 	return redirectURI + "#" + fragment.Encode(), nil
 }
 
+// setResponseTokens sets the vp_token, presentation_submission and id_token
+// response parameters. A vp_token that is a single presentation string, as in
+// Presentation Exchange responses, is sent as is; other values as JSON.
+func setResponseTokens(values url.Values, vpToken any, submission map[string]any, idToken string) error {
+	switch token := vpToken.(type) {
+	case nil:
+	case string:
+		values.Set("vp_token", token)
+	default:
+		tokenJSON, err := json.Marshal(vpToken)
+		if err != nil {
+			return fmt.Errorf("marshaling vp_token: %w", err)
+		}
+		values.Set("vp_token", string(tokenJSON))
+	}
+	if submission != nil {
+		submissionJSON, err := json.Marshal(submission)
+		if err != nil {
+			return fmt.Errorf("marshaling presentation_submission: %w", err)
+		}
+		values.Set("presentation_submission", string(submissionJSON))
+	}
+	if idToken != "" {
+		values.Set("id_token", idToken)
+	}
+	return nil
+}
+
 // FormatDirectPostResult formats a direct post result for terminal output.
 func FormatDirectPostResult(result *DirectPostResult) string {
 	var sb strings.Builder
@@ -0,0 +1,123 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/jsonutil"
+)
+
+// OID4VP error response codes (OID4VP 1.0 Section 8.5, RFC 6749 Section
+// 4.1.2.1).
+const (
+	ErrorInvalidRequest          = "invalid_request"
+	ErrorInvalidClient           = "invalid_client"
+	ErrorInvalidScope            = "invalid_scope"
+	ErrorAccessDenied            = "access_denied"
+	ErrorVPFormatsNotSupported   = "vp_formats_not_supported"
+	ErrorInvalidRequestURIMethod = "invalid_request_uri_method"
+	ErrorInvalidTransactionData  = "invalid_transaction_data"
+	ErrorWalletUnavailable       = "wallet_unavailable"
+	ErrorServerError             = "server_error"
+)
+
+// walletFormats are the credential formats the wallet can present.
+var walletFormats = []string{"dc+sd-jwt", "mso_mdoc", "jwt_vc_json"}
+
+// ErrorCode returns the OID4VP error code for a request validation error:
+// the code of a *RequestValidationError, or invalid_request.
+func ErrorCode(err error) string {
+	var verr *RequestValidationError
+	if errors.As(err, &verr) {
+		return verr.Code
+	}
+	return ErrorInvalidRequest
+}
+
+// NoMatchErrorCode returns the error code for a request no stored credential
+// matches: vp_formats_not_supported if the DCQL query asks only for formats
+// the wallet does not support, access_denied otherwise.
+func NoMatchErrorCode(dcqlQuery map[string]any) string {
+	queries := jsonutil.GetArray(dcqlQuery, "credentials")
+	if len(queries) == 0 {
+		return ErrorAccessDenied
+	}
+	for _, q := range queries {
+		cq, _ := q.(map[string]any)
+		for _, f := range walletFormats {
+			if jsonutil.GetString(cq, "format") == f {
+				return ErrorAccessDenied
+			}
+		}
+	}
+	return ErrorVPFormatsNotSupported
+}
+
+// SubmitErrorResponse sends an OID4VP error response with state to the
+// verifier in the request's response mode: posted to the response_uri for
+// direct_post, encrypted to the client_metadata key for direct_post.jwt (in
+// the clear if the request has no key), or as fragment of the redirect_uri.
+func (w *Wallet) SubmitErrorResponse(code, description, state, responseURI string, params PresentationParams) (*DirectPostResult, error) {
+	if responseURI == "" {
+		return nil, fmt.Errorf("request has no response_uri or redirect_uri for the error response")
+	}
+	log.Printf("[VP] Sending error response %s to %s", code, responseURI)
+
+	values := url.Values{}
+	values.Set("error", code)
+	if description != "" {
+		values.Set("error_description", description)
+	}
+	if state != "" {
+		values.Set("state", state)
+	}
+
+	switch params.ResponseMode {
+	case "direct_post.jwt":
+		if !HasEncryptionKey(params.RequestObject) {
+			log.Printf("[VP] No encryption key in client_metadata.jwks, sending the error response unencrypted")
+			return postResponseForm(responseURI, values, nil)
+		}
+		payload := map[string]any{}
+		for k := range values {
+			payload[k] = values.Get(k)
+		}
+		jwe, cek, err := encryptResponsePayload(payload, "", params)
+		if err != nil {
+			return nil, fmt.Errorf("encrypting error response: %w", err)
+		}
+		return SubmitDirectPostJWT(responseURI, jwe, cek)
+
+	case "fragment":
+		redirectURI := params.RedirectURI
+		if redirectURI == "" {
+			redirectURI = responseURI
+		}
+		redirectURL := redirectURI + "#" + values.Encode()
+		log.Printf("[VP] Fragment response mode: redirect to %s", format.Truncate(redirectURL, 120))
+		return &DirectPostResult{
+			StatusCode:  302,
+			RedirectURI: redirectURL,
+		}, nil
+
+	default:
+		return postResponseForm(responseURI, values, nil)
+	}
+}
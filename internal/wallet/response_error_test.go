@@ -0,0 +1,265 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
+	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
+)
+
+// errorVerifier records the form of the error responses it receives and
+// replies with a redirect_uri.
+func errorVerifier(t *testing.T) (*httptest.Server, chan url.Values) {
+	t.Helper()
+	received := make(chan url.Values, 1)
+	verifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parsing form: %v", err)
+		}
+		received <- r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"redirect_uri":"https://verifier.example/denied"}`))
+	}))
+	t.Cleanup(verifier.Close)
+	return verifier, received
+}
+
+func TestSubmitErrorResponse_DirectPost(t *testing.T) {
+	w := generateTestWallet(t)
+	verifier, received := errorVerifier(t)
+
+	result, err := w.SubmitErrorResponse(ErrorAccessDenied, "denied", "state-1", verifier.URL, PresentationParams{ResponseMode: "direct_post"})
+	if err != nil {
+		t.Fatalf("SubmitErrorResponse: %v", err)
+	}
+	if result.StatusCode != http.StatusOK || result.RedirectURI != "https://verifier.example/denied" {
+		t.Errorf("unexpected result %+v", result)
+	}
+	form := <-received
+	if form.Get("error") != "access_denied" || form.Get("error_description") != "denied" || form.Get("state") != "state-1" {
+		t.Errorf("unexpected form %v", form)
+	}
+	if form.Get("vp_token") != "" {
+		t.Error("error response must not contain a vp_token")
+	}
+}
+
+func TestSubmitErrorResponse_DirectPostJWT(t *testing.T) {
+	w := generateTestWallet(t)
+	verifier, received := errorVerifier(t)
+	key, _ := mock.GenerateKey()
+
+	params := PresentationParams{
+		ResponseMode: "direct_post.jwt",
+		RequestObject: &oid4vc.RequestObjectJWT{Payload: map[string]any{
+			"client_metadata": map[string]any{
+				"jwks": map[string]any{"keys": []any{testEncJWK(t, &key.PublicKey)}},
+			},
+		}},
+	}
+	if _, err := w.SubmitErrorResponse(ErrorInvalidClient, "client_id not verified", "state-1", verifier.URL, params); err != nil {
+		t.Fatalf("SubmitErrorResponse: %v", err)
+	}
+
+	form := <-received
+	if form.Get("error") != "" {
+		t.Fatalf("expected the error only inside the encrypted response, got form %v", form)
+	}
+	plaintext, err := DecryptJWE(form.Get("response"), key)
+	if err != nil {
+		t.Fatalf("decrypting response: %v", err)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload["error"] != "invalid_client" || payload["state"] != "state-1" {
+		t.Errorf("unexpected payload %v", payload)
+	}
+}
+
+func TestSubmitErrorResponse_Fragment(t *testing.T) {
+	w := generateTestWallet(t)
+
+	result, err := w.SubmitErrorResponse(ErrorAccessDenied, "", "state-1", "https://verifier.example/cb", PresentationParams{
+		ResponseMode: "fragment",
+		RedirectURI:  "https://verifier.example/cb",
+	})
+	if err != nil {
+		t.Fatalf("SubmitErrorResponse: %v", err)
+	}
+	if result.StatusCode != http.StatusFound || result.RedirectURI != "https://verifier.example/cb#error=access_denied&state=state-1" {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestSubmitErrorResponse_NoResponseURI(t *testing.T) {
+	w := generateTestWallet(t)
+	if _, err := w.SubmitErrorResponse(ErrorAccessDenied, "", "s", "", PresentationParams{}); err == nil {
+		t.Error("expected an error without response_uri")
+	}
+}
+
+func TestNoMatchErrorCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		formats []string
+		want    string
+	}{
+		{"supported format", []string{"dc+sd-jwt"}, ErrorAccessDenied},
+		{"one supported format", []string{"ldp_vc", "mso_mdoc"}, ErrorAccessDenied},
+		{"unsupported formats", []string{"ldp_vc", "ac_vp"}, ErrorVPFormatsNotSupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var credentials []any
+			for _, f := range tt.formats {
+				credentials = append(credentials, map[string]any{"id": f, "format": f})
+			}
+			if got := NoMatchErrorCode(map[string]any{"credentials": credentials}); got != tt.want {
+				t.Errorf("NoMatchErrorCode = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	if got := ErrorCode(&RequestValidationError{Code: ErrorInvalidClient}); got != ErrorInvalidClient {
+		t.Errorf("ErrorCode = %s, want invalid_client", got)
+	}
+	if got := ErrorCode(errors.New("draft request")); got != ErrorInvalidRequest {
+		t.Errorf("ErrorCode = %s, want invalid_request", got)
+	}
+}
+
+func TestConsentFlow_DenySendsAccessDenied(t *testing.T) {
+	srv := newTestServer(t, false)
+	verifier, received := errorVerifier(t)
+
+	params := errorResponseParams(verifier.URL, pidDCQLQuery())
+	resultCh := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		w := httptest.NewRecorder()
+		srv.mux.ServeHTTP(w, httptest.NewRequest("GET", "/authorize?"+params.Encode(), nil))
+		resultCh <- w
+	}()
+
+	var reqID string
+	for i := 0; i < 100 && reqID == ""; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if pending := srv.wallet.GetPendingRequests(); len(pending) > 0 {
+			reqID = pending[0].ID
+		}
+	}
+	if reqID == "" {
+		t.Fatal("no pending consent request found")
+	}
+
+	denyRec := serverRequest(t, srv, "POST", "/api/requests/"+reqID+"/deny", "")
+	deny := decodeJSON(t, denyRec)
+	if deny["status"] != "denied" || deny["redirect_uri"] != "https://verifier.example/denied" {
+		t.Errorf("expected the verifier's redirect_uri from deny, got %v", deny)
+	}
+
+	form := <-received
+	if form.Get("error") != "access_denied" || form.Get("state") != "state-1" {
+		t.Errorf("unexpected error response %v", form)
+	}
+	result := decodeJSON(t, <-resultCh)
+	if result["status"] != "denied" || result["response"] == nil {
+		t.Errorf("expected denied with the verifier's reply, got %v", result)
+	}
+}
+
+func TestAuthorize_NoMatchSendsError(t *testing.T) {
+	srv := newTestServer(t, true)
+	verifier, received := errorVerifier(t)
+
+	dcqlQuery := map[string]any{
+		"credentials": []any{
+			map[string]any{"id": "vc", "format": "ldp_vc"},
+		},
+	}
+	rec := serverRequest(t, srv, "GET", "/authorize?"+errorResponseParams(verifier.URL, dcqlQuery).Encode(), "")
+	result := decodeJSON(t, rec)
+	if result["status"] != "no_match" {
+		t.Fatalf("expected no_match, got %v", result)
+	}
+
+	form := <-received
+	if form.Get("error") != "vp_formats_not_supported" || form.Get("state") != "state-1" {
+		t.Errorf("unexpected error response %v", form)
+	}
+}
+
+func TestAuthorize_StrictValidationSendsInvalidClient(t *testing.T) {
+	srv := newStrictTestServer(t, true)
+	verifier, received := errorVerifier(t)
+
+	params := errorResponseParams(verifier.URL, pidDCQLQuery())
+	params.Set("client_id", "x509_san_dns:verifier.example")
+	rec := serverRequest(t, srv, "GET", "/authorize?"+params.Encode(), "")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+	result := decodeJSON(t, rec)
+	if result["error"] != "invalid_client" {
+		t.Errorf("expected invalid_client, got %v", result["error"])
+	}
+
+	form := <-received
+	if form.Get("error") != "invalid_client" || !strings.Contains(form.Get("error_description"), "validation failed") {
+		t.Errorf("unexpected error response %v", form)
+	}
+}
+
+func TestNextErrorOverride_SentToVerifier(t *testing.T) {
+	srv := newTestServer(t, true)
+	verifier, received := errorVerifier(t)
+
+	serverRequest(t, srv, "POST", "/api/next-error", `{"error":"wallet_unavailable","error_description":"testing"}`)
+	rec := serverRequest(t, srv, "GET", "/authorize?"+errorResponseParams(verifier.URL, pidDCQLQuery()).Encode(), "")
+	result := decodeJSON(t, rec)
+	if result["status"] != "error" || result["response"] == nil {
+		t.Errorf("expected the override with the verifier's reply, got %v", result)
+	}
+
+	form := <-received
+	if form.Get("error") != "wallet_unavailable" || form.Get("error_description") != "testing" || form.Get("state") != "state-1" {
+		t.Errorf("unexpected error response %v", form)
+	}
+}
+
+func errorResponseParams(responseURI string, dcqlQuery map[string]any) url.Values {
+	dcqlJSON, _ := json.Marshal(dcqlQuery)
+	return url.Values{
+		"client_id":     {"https://verifier.example"},
+		"response_type": {"vp_token"},
+		"response_mode": {"direct_post"},
+		"nonce":         {"nonce"},
+		"state":         {"state-1"},
+		"response_uri":  {responseURI},
+		"dcql_query":    {string(dcqlJSON)},
+	}
+}
@@ -81,7 +81,7 @@ func TestBuildFragmentRedirect(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := BuildFragmentRedirect(tt.redirectURI, tt.state, tt.vpToken, "")
+			got, err := BuildFragmentRedirect(tt.redirectURI, tt.state, tt.vpToken, nil, "")
 			if err != nil {
 				t.Fatalf("BuildFragmentRedirect() error: %v", err)
 			}
@@ -107,7 +107,7 @@ func TestSubmitDirectPost_Success(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	result, err := SubmitDirectPost(ts.URL, "state123", map[string]string{"pid": "token1"}, "")
+	result, err := SubmitDirectPost(ts.URL, "state123", map[string]string{"pid": "token1"}, nil, "")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -135,7 +135,7 @@ func TestSubmitDirectPost_WithIDToken(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	result, err := SubmitDirectPost(ts.URL, "s1", map[string]string{"pid": "tok"}, "eyJ.test.token")
+	result, err := SubmitDirectPost(ts.URL, "s1", map[string]string{"pid": "tok"}, nil, "eyJ.test.token")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -152,7 +152,7 @@ func TestSubmitDirectPost_LocationHeader(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	result, err := SubmitDirectPost(ts.URL, "state1", map[string]string{"pid": "tok"}, "")
+	result, err := SubmitDirectPost(ts.URL, "state1", map[string]string{"pid": "tok"}, nil, "")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -176,7 +176,7 @@ func TestSubmitDirectPost_NoVPToken(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	result, err := SubmitDirectPost(ts.URL, "onlystate", nil, "")
+	result, err := SubmitDirectPost(ts.URL, "onlystate", nil, nil, "")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -230,7 +230,7 @@ func TestSubmitDirectPostJWT_WithCEK(t *testing.T) {
 }
 
 func TestBuildFragmentRedirect_WithIDTokenAndVPToken(t *testing.T) {
-	got, err := BuildFragmentRedirect("https://verifier.example/callback", "s1", map[string]string{"pid": "tok1"}, "eyJ.id.token")
+	got, err := BuildFragmentRedirect("https://verifier.example/callback", "s1", map[string]string{"pid": "tok1"}, nil, "eyJ.id.token")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -246,7 +246,7 @@ func TestBuildFragmentRedirect_WithIDTokenAndVPToken(t *testing.T) {
 }
 
 func TestBuildFragmentRedirect_NilVPToken(t *testing.T) {
-	got, err := BuildFragmentRedirect("https://verifier.example/callback", "s1", nil, "eyJ.id.token")
+	got, err := BuildFragmentRedirect("https://verifier.example/callback", "s1", nil, nil, "eyJ.id.token")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -24,6 +24,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/dominikschlosser/oid4vc-dev/internal/config"
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
 	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
 	"github.com/dominikschlosser/oid4vc-dev/internal/statuslist"
@@ -39,6 +40,7 @@ type Server struct {
 	logFunc          func(format string, args ...any)
 	httpSrv          *http.Server
 	parseOpts        oid4vc.ParseOptions
+	stopPolling      chan struct{}
 }
 
 // NewServer creates a new wallet HTTP server.
@@ -47,6 +49,11 @@ func NewServer(w *Wallet, port int, onSave func()) *Server {
 	s := &Server{wallet: w, port: port, onSave: onSave}
 	s.mux = http.NewServeMux()
 	s.setupRoutes()
+	// Route OID4VCI authorization prompts to the web UI unless the caller
+	// installed its own handler (e.g. the CLI opening a browser).
+	if w.OnAuthorizationURL == nil {
+		w.OnAuthorizationURL = s.promptAuthorization
+	}
 	// Set up ParseOptions with wallet-aware request_uri fetcher.
 	// The logFunc is captured lazily so it works even if SetLogger is called after NewServer.
 	s.parseOpts = oid4vc.ParseOptions{
@@ -65,13 +72,25 @@ func (s *Server) setupRoutes() {
 	// API: feed authorization request URIs
 	s.mux.HandleFunc("POST /api/presentations", s.handlePresentationAPI)
 
+	// API: Digital Credentials API requests (dc_api, dc_api.jwt)
+	s.mux.HandleFunc("POST /api/dc-api", s.handleDCAPI)
+
 	// API: credential offers
 	s.mux.HandleFunc("POST /api/offers", s.handleOfferAPI)
 
+	// OID4VCI authorization code flow redirect_uri
+	s.mux.HandleFunc("GET /callback", s.handleAuthorizationCallback)
+
 	// API: credential management
 	s.mux.HandleFunc("GET /api/credentials", s.handleListCredentials)
 	s.mux.HandleFunc("POST /api/credentials", s.handleImportCredential)
 	s.mux.HandleFunc("DELETE /api/credentials/{id}", s.handleDeleteCredential)
+	s.mux.HandleFunc("POST /api/credentials/{id}/notification", s.handleSendNotification)
+	s.mux.HandleFunc("POST /api/credentials/{id}/refresh", s.handleRefreshCredential)
+
+	// API: deferred issuances
+	s.mux.HandleFunc("GET /api/pending", s.handleListPendingIssuances)
+	s.mux.HandleFunc("POST /api/pending/{id}/retry", s.handleRetryPendingIssuance)
 
 	// API: consent requests
 	s.mux.HandleFunc("GET /api/requests", s.handleListRequests)
@@ -104,6 +123,7 @@ func (s *Server) setupRoutes() {
 
 // ListenAndServe starts the wallet server.
 func (s *Server) ListenAndServe() error {
+	s.setRedirectURI(fmt.Sprintf("http://localhost:%d", s.port))
 	s.httpSrv = &http.Server{
 		Addr:         fmt.Sprintf(":%d", s.port),
 		Handler:      s.mux,
@@ -111,6 +131,7 @@ func (s *Server) ListenAndServe() error {
 		WriteTimeout: 60 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	}
+	s.startIssuancePolling()
 	return s.httpSrv.ListenAndServe()
 }
 
@@ -121,6 +142,7 @@ func (s *Server) ListenAndServeBackground() (string, error) {
 		return "", err
 	}
 	addr := fmt.Sprintf("http://localhost:%d", ln.Addr().(*net.TCPAddr).Port)
+	s.setRedirectURI(addr)
 	s.httpSrv = &http.Server{
 		Handler:      s.mux,
 		ReadTimeout:  30 * time.Second,
@@ -131,6 +153,16 @@ func (s *Server) ListenAndServeBackground() (string, error) {
 	return addr, nil
 }
 
+// setRedirectURI points the wallet's OID4VCI redirect_uri at this server's
+// /callback endpoint unless one was configured explicitly.
+func (s *Server) setRedirectURI(addr string) {
+	s.wallet.mu.Lock()
+	defer s.wallet.mu.Unlock()
+	if s.wallet.IssuanceRedirectURI == "" {
+		s.wallet.IssuanceRedirectURI = addr + "/callback"
+	}
+}
+
 // SetOnConsentRequest sets a callback invoked when a new consent request is created.
 func (s *Server) SetOnConsentRequest(fn func(req *ConsentRequest)) {
 	s.onConsentRequest = fn
@@ -149,6 +181,10 @@ func (s *Server) log(format string, args ...any) {
 
 // Shutdown gracefully shuts down the server.
 func (s *Server) Shutdown() {
+	if s.stopPolling != nil {
+		close(s.stopPolling)
+		s.stopPolling = nil
+	}
 	if s.httpSrv != nil {
 		s.httpSrv.Close()
 	}
@@ -160,13 +196,13 @@ func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
 	var err error
 
 	if r.Method == "GET" {
-		authReq, err = parseAuthParams(r.URL.Query(), s.parseOpts, s.wallet.ValidationMode)
+		authReq, err = parseAuthParams(r.URL.Query(), s.parseOpts)
 	} else {
 		if parseErr := r.ParseForm(); parseErr != nil {
 			http.Error(w, "invalid form data", http.StatusBadRequest)
 			return
 		}
-		authReq, err = parseAuthParams(r.Form, s.parseOpts, s.wallet.ValidationMode)
+		authReq, err = parseAuthParams(r.Form, s.parseOpts)
 	}
 
 	if err != nil {
@@ -217,11 +253,26 @@ func (s *Server) handlePresentationAPI(w http.ResponseWriter, r *http.Request) {
 		s.log("  Request URI Method: %s", parsed.RequestURIMethod)
 	}
 
+	authReq := &AuthorizationRequestParams{
+		ClientID:        parsed.ClientID,
+		ResponseType:    parsed.ResponseType,
+		ResponseMode:    parsed.ResponseMode,
+		Nonce:           parsed.Nonce,
+		State:           parsed.State,
+		RedirectURI:     parsed.RedirectURI,
+		ResponseURI:     parsed.ResponseURI,
+		DCQLQuery:       parsed.DCQLQuery,
+		TransactionData: parsed.TransactionData,
+		VerifierInfo:    parsed.VerifierInfo,
+		Legacy:          parsed.Legacy,
+		RequestObject:   parsed.RequestObject,
+	}
+
 	parsedResponseURI := parsed.ResponseURI
 	if parsedResponseURI == "" {
 		parsedResponseURI = parsed.RedirectURI
 	}
-	findings, err := ValidatePresentationRequest(s.wallet.ValidationMode, parsed.ClientID, parsed.RequestObject, parsedResponseURI)
+	findings, err := ValidatePresentationRequest(s.wallet.ValidationMode, parsed.ClientID, parsed.RequestObject, parsedResponseURI, parsed.DCQLQuery, parsed.TransactionData, parsed.VerifierInfo, s.wallet.TrustAnchors, s.wallet.RegistrarCAs)
 	if err != nil {
 		s.log("  ERROR: %v", err)
 		s.wallet.AddLog("presentation", err.Error(), false)
@@ -229,7 +280,9 @@ func (s *Server) handlePresentationAPI(w http.ResponseWriter, r *http.Request) {
 			Message: "Authorization request validation failed",
 			Detail:  err.Error(),
 		})
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		writeJSON(w, http.StatusBadRequest, withErrorResponse(map[string]any{
+			"error": err.Error(),
+		}, s.sendErrorResponse(authReq, ErrorCode(err), err.Error())))
 		return
 	}
 	for _, finding := range findings {
@@ -237,16 +290,54 @@ func (s *Server) handlePresentationAPI(w http.ResponseWriter, r *http.Request) {
 		s.wallet.AddLog("presentation", fmt.Sprintf("request validation warning: %s", finding), false)
 	}
 
-	authReq := &AuthorizationRequestParams{
-		ClientID:      parsed.ClientID,
-		ResponseType:  parsed.ResponseType,
-		ResponseMode:  parsed.ResponseMode,
-		Nonce:         parsed.Nonce,
-		State:         parsed.State,
-		RedirectURI:   parsed.RedirectURI,
-		ResponseURI:   parsed.ResponseURI,
-		DCQLQuery:     parsed.DCQLQuery,
-		RequestObject: parsed.RequestObject,
+	s.handleAuthFlow(w, authReq)
+}
+
+// handleDCAPI processes an OID4VP request as a browser would pass it to the
+// wallet through the Digital Credentials API and returns the response to the
+// caller instead of posting it to the verifier.
+func (s *Server) handleDCAPI(w http.ResponseWriter, r *http.Request) {
+	var body DCAPIRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	s.log("Received DC API request")
+	s.log("  Origin:        %s", body.Origin)
+	s.log("  Protocol:      %s", body.Protocol)
+
+	authReq, err := ParseDCAPIRequest(body, s.wallet.TrustAnchors)
+	if err != nil {
+		s.log("  ERROR: %v", err)
+		s.wallet.AddLog("presentation", fmt.Sprintf("Failed to parse DC API request: %v", err), false)
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error":             "invalid_request",
+			"error_description": err.Error(),
+		})
+		return
+	}
+	s.log("  Client ID:     %s", authReq.ClientID)
+	s.log("  Response Mode: %s", authReq.ResponseMode)
+
+	findings := ValidateDCAPIRequest(authReq)
+	if s.wallet.ValidationMode == ValidationModeStrict && len(findings) > 0 {
+		msg := "DC API request validation failed: " + strings.Join(findings, "; ")
+		s.log("  ERROR: %s", msg)
+		s.wallet.AddLog("presentation", msg, false)
+		s.wallet.NotifyError(WalletError{
+			Message: "DC API request validation failed",
+			Detail:  strings.Join(findings, "; "),
+		})
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error":             "invalid_request",
+			"error_description": msg,
+		})
+		return
+	}
+	for _, finding := range findings {
+		s.log("  WARNING: %s", finding)
+		s.wallet.AddLog("presentation", fmt.Sprintf("request validation warning: %s", finding), false)
 	}
 
 	s.handleAuthFlow(w, authReq)
@@ -273,6 +364,10 @@ func (s *Server) handleOfferAPI(w http.ResponseWriter, r *http.Request) {
 		s.wallet.mu.Unlock()
 	}
 
+	// The authorization code flow waits for the user to log in at the issuer,
+	// which can take longer than the server's default write timeout.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(config.ConsentTimeout + 30*time.Second))
+
 	result, err := s.wallet.ProcessCredentialOffer(body.URI)
 	if err != nil {
 		s.log("  ERROR: %v", err)
@@ -281,12 +376,157 @@ func (s *Server) handleOfferAPI(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.log("  Received:      %s credential from %s", result.Format, result.Issuer)
-	s.wallet.AddLog("issuance", fmt.Sprintf("Received %s credential from %s", result.Format, result.Issuer), true)
+	if result.PendingID != "" {
+		s.log("  Deferred:      issuance pending at %s (%s)", result.Issuer, result.PendingID)
+		s.wallet.AddLog("issuance", fmt.Sprintf("Issuance deferred by %s", result.Issuer), true)
+	} else {
+		s.log("  Received:      %s credential from %s", result.Format, result.Issuer)
+		s.wallet.AddLog("issuance", fmt.Sprintf("Received %s credential from %s", result.Format, result.Issuer), true)
+	}
 	s.triggerSave()
 	writeJSON(w, http.StatusOK, result)
 }
 
+// handleListPendingIssuances returns deferred issuances awaiting the issuer.
+func (s *Server) handleListPendingIssuances(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.wallet.GetPendingIssuances())
+}
+
+// handleRetryPendingIssuance polls the deferred credential endpoint now.
+func (s *Server) handleRetryPendingIssuance(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := s.wallet.getPendingIssuance(id); !ok {
+		http.Error(w, "pending issuance not found", http.StatusNotFound)
+		return
+	}
+	result, err := s.wallet.RetryPendingIssuance(id)
+	s.triggerSave()
+	if err != nil {
+		s.wallet.AddLog("issuance", fmt.Sprintf("Deferred issuance failed: %v", err), false)
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	s.logDeferredResult(result)
+	writeJSON(w, http.StatusOK, result)
+}
+
+// startIssuancePolling polls due deferred issuances and, separately,
+// refreshes expiring credentials (if AutoRefresh is set) in the background
+// until the server is shut down.
+func (s *Server) startIssuancePolling() {
+	s.stopPolling = make(chan struct{})
+	stop := s.stopPolling
+	go s.refreshExpiringCredentials(stop)
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				results := s.wallet.PollDueIssuances()
+				for _, result := range results {
+					if result.Error != "" {
+						s.log("Deferred issuance %s failed: %s", result.PendingID, result.Error)
+						continue
+					}
+					s.logDeferredResult(result)
+				}
+				if len(results) > 0 {
+					s.triggerSave()
+				}
+			}
+		}
+	}()
+}
+
+// refreshExpiringCredentials refreshes expiring credentials until stop is
+// closed. It runs apart from the deferred issuance polling so slow issuers do
+// not hold up either.
+func (s *Server) refreshExpiringCredentials(stop chan struct{}) {
+	ticker := time.NewTicker(autoRefreshCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			refreshed := s.wallet.RefreshExpiringCredentials()
+			for _, result := range refreshed {
+				s.logRefreshResult(result.CredentialID, result)
+			}
+			if len(refreshed) > 0 {
+				s.triggerSave()
+			}
+		}
+	}
+}
+
+// logDeferredResult logs the outcome of a successful deferred credential poll.
+func (s *Server) logDeferredResult(result *IssuanceResult) {
+	if result.PendingID != "" {
+		s.log("Deferred issuance %s still pending at %s", result.PendingID, result.Issuer)
+		return
+	}
+	s.log("Received deferred %s credential from %s", result.Format, result.Issuer)
+	s.wallet.AddLog("issuance", fmt.Sprintf("Received deferred %s credential from %s", result.Format, result.Issuer), true)
+}
+
+// logRefreshResult logs the outcome of a credential refresh.
+func (s *Server) logRefreshResult(id string, result *IssuanceResult) {
+	switch {
+	case result.Error != "":
+		s.log("Refresh of credential %s failed: %s", id, result.Error)
+		s.wallet.AddLog("issuance", fmt.Sprintf("Refresh of credential %s failed: %s", id, result.Error), false)
+	case result.PendingID != "":
+		s.log("Refresh of credential %s deferred by %s (pending ID: %s)", id, result.Issuer, result.PendingID)
+	default:
+		s.log("Refreshed %s credential %s from %s", result.Format, id, result.Issuer)
+		s.wallet.AddLog("issuance", fmt.Sprintf("Refreshed %s credential %s from %s", result.Format, id, result.Issuer), true)
+	}
+}
+
+// promptAuthorization is the default OID4VCI authorization handler for the
+// server: it pushes the authorization URL to connected web UIs.
+func (s *Server) promptAuthorization(authURL string) error {
+	s.log("  Authorization required: %s", authURL)
+	if s.wallet.NotifyAuthorization(authURL) == 0 {
+		s.log("  No web UI connected — open the URL above in a browser to continue")
+	}
+	return nil
+}
+
+// handleAuthorizationCallback receives the authorization response at the
+// wallet's redirect_uri and resumes the waiting OID4VCI flow.
+func (s *Server) handleAuthorizationCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	state := q.Get("state")
+	cb := AuthorizationCallback{
+		Code:             q.Get("code"),
+		Error:            q.Get("error"),
+		ErrorDescription: q.Get("error_description"),
+	}
+
+	s.log("Received authorization callback")
+	if cb.Error != "" {
+		s.log("  Error: %s %s", cb.Error, cb.ErrorDescription)
+	}
+
+	if !s.wallet.CompleteAuthorization(state, cb) {
+		s.log("  ERROR: no pending authorization for state %q", state)
+		http.Error(w, "unknown or expired authorization state", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if cb.Error != "" {
+		fmt.Fprint(w, "<!DOCTYPE html><html><body><p>Authorization failed. You can close this window.</p></body></html>")
+		return
+	}
+	fmt.Fprint(w, "<!DOCTYPE html><html><body><p>Authorization complete. You can close this window.</p></body></html>")
+}
+
 // handleListCredentials returns all stored credentials.
 func (s *Server) handleListCredentials(w http.ResponseWriter, r *http.Request) {
 	data, err := s.wallet.CredentialsJSON()
@@ -325,7 +565,7 @@ func (s *Server) handleImportCredential(w http.ResponseWriter, r *http.Request)
 // handleDeleteCredential removes a credential by ID.
 func (s *Server) handleDeleteCredential(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
-	if !s.wallet.RemoveCredential(id) {
+	if !s.wallet.DeleteCredential(id) {
 		http.Error(w, "credential not found", http.StatusNotFound)
 		return
 	}
@@ -333,6 +573,52 @@ func (s *Server) handleDeleteCredential(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// handleSendNotification sends a notification event for a credential to
+// the issuer, e.g. to test issuers with events the wallet would not send.
+func (s *Server) handleSendNotification(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := s.wallet.GetCredential(id); !ok {
+		http.Error(w, "credential not found", http.StatusNotFound)
+		return
+	}
+
+	var body struct {
+		Event       string `json:"event"`
+		Description string `json:"event_description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Event == "" {
+		http.Error(w, "invalid JSON body (event is required)", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.wallet.SendNotification(id, body.Event, body.Description); err != nil {
+		s.wallet.AddLog("notification", fmt.Sprintf("Notification %s failed: %v", body.Event, err), false)
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	s.wallet.AddLog("notification", fmt.Sprintf("Sent %s for credential %s", body.Event, id), true)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRefreshCredential fetches a fresh copy of a credential from its
+// issuer and replaces the stored one.
+func (s *Server) handleRefreshCredential(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := s.wallet.GetCredential(id); !ok {
+		http.Error(w, "credential not found", http.StatusNotFound)
+		return
+	}
+	result, err := s.wallet.RefreshCredential(id)
+	s.triggerSave()
+	if err != nil {
+		s.logRefreshResult(id, &IssuanceResult{Error: err.Error()})
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	s.logRefreshResult(id, result)
+	writeJSON(w, http.StatusOK, result)
+}
+
 // handleListRequests returns all pending consent requests.
 func (s *Server) handleListRequests(w http.ResponseWriter, r *http.Request) {
 	requests := s.wallet.GetPendingRequests()
@@ -361,6 +647,8 @@ func (s *Server) handleRequestStream(w http.ResponseWriter, r *http.Request) {
 	defer reqUnsub()
 	errCh, errUnsub := s.wallet.SubscribeErrors()
 	defer errUnsub()
+	authCh, authUnsub := s.wallet.SubscribeAuthorizations()
+	defer authUnsub()
 
 	for {
 		select {
@@ -378,6 +666,13 @@ func (s *Server) handleRequestStream(w http.ResponseWriter, r *http.Request) {
 			}
 			fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
 			flusher.Flush()
+		case authURL := <-authCh:
+			data, err := json.Marshal(map[string]string{"authorization_url": authURL})
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: authorization\ndata: %s\n\n", data)
+			flusher.Flush()
 		case <-r.Context().Done():
 			return
 		}
@@ -399,6 +694,7 @@ func (s *Server) handleApproveRequest(w http.ResponseWriter, r *http.Request) {
 
 	var body struct {
 		SelectedClaims map[string][]string `json:"selected_claims"`
+		SelectedPaths  map[string][][]any  `json:"selected_paths"`
 	}
 	if r.Body != nil {
 		_ = json.NewDecoder(r.Body).Decode(&body)
@@ -407,6 +703,7 @@ func (s *Server) handleApproveRequest(w http.ResponseWriter, r *http.Request) {
 	req.ResultCh <- ConsentResult{
 		Approved:       true,
 		SelectedClaims: body.SelectedClaims,
+		SelectedPaths:  body.SelectedPaths,
 	}
 
 	// Wait for the VP submission to complete so we can return the result to the UI
@@ -441,7 +738,17 @@ func (s *Server) handleDenyRequest(w http.ResponseWriter, r *http.Request) {
 
 	req.ResultCh <- ConsentResult{Approved: false}
 
-	writeJSON(w, http.StatusOK, map[string]string{"status": "denied"})
+	// Wait for the error response to the verifier so the UI can follow its redirect
+	select {
+	case submission := <-req.SubmissionCh:
+		writeJSON(w, http.StatusOK, map[string]any{
+			"status":       "denied",
+			"redirect_uri": submission.RedirectURI,
+			"status_code":  submission.StatusCode,
+		})
+	case <-time.After(30 * time.Second):
+		writeJSON(w, http.StatusOK, map[string]string{"status": "denied"})
+	}
 }
 
 // handleLog returns the activity log.
@@ -540,7 +847,7 @@ func (s *Server) handleSetPreferredFormat(w http.ResponseWriter, r *http.Request
 	writeJSON(w, http.StatusOK, map[string]string{"format": body.Format})
 }
 
-func mapKeys(m map[string]string) []string {
+func mapKeys[V any](m map[string]V) []string {
 	ks := make([]string, 0, len(m))
 	for k := range m {
 		ks = append(ks, k)
@@ -17,7 +17,6 @@ package wallet
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"net/url"
 	"strings"
@@ -31,15 +30,20 @@ import (
 
 // AuthorizationRequestParams holds the extracted fields from an authorization request.
 type AuthorizationRequestParams struct {
-	ClientID      string
-	ResponseType  string
-	ResponseMode  string
-	Nonce         string
-	State         string
-	RedirectURI   string
-	ResponseURI   string
-	DCQLQuery     map[string]any
-	RequestObject *oid4vc.RequestObjectJWT
+	ClientID        string
+	ResponseType    string
+	ResponseMode    string
+	Nonce           string
+	State           string
+	RedirectURI     string
+	ResponseURI     string
+	DCQLQuery       map[string]any
+	TransactionData []string
+	VerifierInfo    []map[string]any
+	Legacy          oid4vc.LegacyParams // parameters of pre-1.0 drafts, used with --draft
+	RequestObject   *oid4vc.RequestObjectJWT
+	Origin          string // set for Digital Credentials API requests
+	Protocol        string // DC API protocol identifier
 }
 
 // handleAuthFlow is the core OID4VP flow handler.
@@ -48,11 +52,11 @@ func (s *Server) handleAuthFlow(w http.ResponseWriter, authReq *AuthorizationReq
 	if override := s.wallet.ConsumeNextError(); override != nil {
 		s.log("  Next-error override consumed: %s", override.Error)
 		s.wallet.AddLog("presentation", fmt.Sprintf("Returned error override: %s", override.Error), false)
-		writeJSON(w, http.StatusOK, map[string]any{
+		writeJSON(w, http.StatusOK, withErrorResponse(map[string]any{
 			"status":            "error",
 			"error":             override.Error,
 			"error_description": override.ErrorDescription,
-		})
+		}, s.sendErrorResponse(authReq, override.Error, override.ErrorDescription)))
 		return
 	}
 
@@ -60,7 +64,29 @@ func (s *Server) handleAuthFlow(w http.ResponseWriter, authReq *AuthorizationReq
 	if responseURI == "" {
 		responseURI = authReq.RedirectURI
 	}
-	findings, err := ValidatePresentationRequest(s.wallet.ValidationMode, authReq.ClientID, authReq.RequestObject, responseURI)
+	clientID := authReq.ClientID
+	var draftFindings []string
+	if s.wallet.Draft != 0 {
+		var err error
+		clientID, draftFindings, err = s.wallet.ResolveDraftRequest(authReq.ClientID, &authReq.Legacy, authReq.RequestObject)
+		if err != nil {
+			s.log("  ERROR: %v", err)
+			s.wallet.AddLog("presentation", err.Error(), false)
+			s.wallet.NotifyError(WalletError{
+				Message: "Draft authorization request could not be resolved",
+				Detail:  err.Error(),
+			})
+			writeJSON(w, http.StatusBadRequest, withErrorResponse(map[string]any{
+				"error":             ErrorInvalidRequest,
+				"error_description": err.Error(),
+			}, s.sendErrorResponse(authReq, ErrorInvalidRequest, err.Error())))
+			return
+		}
+	} else if authReq.DCQLQuery == nil && !authReq.Legacy.IsZero() {
+		s.log("  Request uses pre-1.0 draft parameters (presentation_definition, client_id_scheme, ...), which need --draft")
+	}
+	findings, err := ValidatePresentationRequest(s.wallet.ValidationMode, clientID, authReq.RequestObject, responseURI, authReq.DCQLQuery, authReq.TransactionData, authReq.VerifierInfo, s.wallet.TrustAnchors, s.wallet.RegistrarCAs)
+	findings = append(draftFindings, findings...)
 	if err != nil {
 		s.log("  ERROR: %v", err)
 		s.wallet.AddLog("presentation", err.Error(), false)
@@ -68,10 +94,11 @@ func (s *Server) handleAuthFlow(w http.ResponseWriter, authReq *AuthorizationReq
 			Message: "Authorization request validation failed",
 			Detail:  err.Error(),
 		})
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error":             "invalid_request",
+		code := ErrorCode(err)
+		writeJSON(w, http.StatusBadRequest, withErrorResponse(map[string]any{
+			"error":             code,
 			"error_description": err.Error(),
-		})
+		}, s.sendErrorResponse(authReq, code, err.Error())))
 		return
 	}
 	for _, finding := range findings {
@@ -90,10 +117,11 @@ func (s *Server) handleAuthFlow(w http.ResponseWriter, authReq *AuthorizationReq
 				Message: "HAIP 1.0 compliance check failed",
 				Detail:  strings.Join(violations, "; "),
 			})
-			writeJSON(w, http.StatusBadRequest, map[string]any{
-				"error":             "invalid_request",
-				"error_description": "HAIP 1.0 compliance check failed: " + strings.Join(violations, "; "),
-			})
+			description := "HAIP 1.0 compliance check failed: " + strings.Join(violations, "; ")
+			writeJSON(w, http.StatusBadRequest, withErrorResponse(map[string]any{
+				"error":             ErrorInvalidRequest,
+				"error_description": description,
+			}, s.sendErrorResponse(authReq, ErrorInvalidRequest, description)))
 			return
 		}
 	}
@@ -104,11 +132,30 @@ func (s *Server) handleAuthFlow(w http.ResponseWriter, authReq *AuthorizationReq
 			s.log("  DCQL Query:    %s", string(dcqlJSON))
 		}
 	}
+	transactionData := DecodeTransactionData(authReq.TransactionData)
+	for _, td := range transactionData {
+		s.log("  Transaction:   %s for %v", td.Type, td.CredentialIDs)
+	}
+	verifierInfo := ParseVerifierInfo(authReq.VerifierInfo, authReq.RequestObject, authReq.DCQLQuery, s.wallet.RegistrarCAs)
+	if verifierInfo != nil && verifierInfo.Name != "" {
+		s.log("  Registered as: %s (registrar %s)", verifierInfo.Name, verifierInfo.Registrar)
+	}
+	if verifierInfo != nil {
+		for _, reason := range verifierInfo.Unverified {
+			s.log("  Unverified:    %s", reason)
+		}
+	}
 
-	// Evaluate DCQL query
+	// Evaluate DCQL query, or the Presentation Exchange definition of drafts
 	var matches []CredentialMatch
+	pd := s.wallet.DraftPresentationDefinition(authReq.DCQLQuery, authReq.Legacy)
 	if authReq.DCQLQuery != nil {
-		matches = s.wallet.EvaluateDCQL(authReq.DCQLQuery)
+		matches = s.wallet.EvaluateDCQLForRequest(authReq.DCQLQuery, authReq.RequestObject)
+	} else if pd != nil {
+		if pdJSON, err := json.Marshal(pd); err == nil {
+			s.log("  Presentation Definition: %s", string(pdJSON))
+		}
+		matches = s.wallet.EvaluatePresentationDefinitionForRequest(pd, authReq.RequestObject)
 	}
 
 	s.log("  Matched:       %d credential(s)", len(matches))
@@ -126,34 +173,40 @@ func (s *Server) handleAuthFlow(w http.ResponseWriter, authReq *AuthorizationReq
 		if s.onConsentRequest != nil {
 			s.onConsentRequest(nil)
 		}
-		writeJSON(w, http.StatusOK, map[string]any{
+		writeJSON(w, http.StatusOK, withErrorResponse(map[string]any{
 			"status": "no_match",
 			"error":  "no matching credentials found",
-		})
+		}, s.sendErrorResponse(authReq, s.wallet.UnmatchedErrorCode(authReq.DCQLQuery, pd, authReq.RequestObject), "no matching credentials found")))
 		return
 	}
 
 	// Auto-accept mode: skip consent
 	if s.wallet.AutoAccept {
 		s.log("  Mode:          auto-accept")
-		s.autoAcceptPresentation(w, authReq, matches)
+		s.autoAcceptPresentation(w, authReq, matches, transactionData, verifierInfo)
 		return
 	}
 
 	// Interactive mode: create consent request and wait
 	s.log("  Mode:          interactive — waiting for consent...")
 	consentReq := &ConsentRequest{
-		ID:           uuid.New().String(),
-		Type:         "presentation",
-		MatchedCreds: matches,
-		Status:       "pending",
-		ResultCh:     make(chan ConsentResult, 1),
-		SubmissionCh: make(chan SubmissionResult, 1),
-		CreatedAt:    time.Now(),
-		ClientID:     authReq.ClientID,
-		Nonce:        authReq.Nonce,
-		ResponseURI:  authReq.ResponseURI,
-		DCQLQuery:    authReq.DCQLQuery,
+		ID:              uuid.New().String(),
+		Type:            "presentation",
+		MatchedCreds:    matches,
+		Status:          "pending",
+		ResultCh:        make(chan ConsentResult, 1),
+		SubmissionCh:    make(chan SubmissionResult, 1),
+		CreatedAt:       time.Now(),
+		ClientID:        authReq.ClientID,
+		Nonce:           authReq.Nonce,
+		ResponseURI:     authReq.ResponseURI,
+		DCQLQuery:       authReq.DCQLQuery,
+		TransactionData: transactionData,
+		VerifierInfo:    verifierInfo,
+		Warnings:        s.wallet.InstanceWarnings(matches),
+	}
+	for _, warning := range consentReq.Warnings {
+		s.log("  WARNING:       %s", warning)
 	}
 
 	s.wallet.CreateConsentRequest(consentReq)
@@ -168,22 +221,19 @@ func (s *Server) handleAuthFlow(w http.ResponseWriter, authReq *AuthorizationReq
 		if !result.Approved {
 			s.log("  Consent:       denied")
 			s.wallet.AddLog("presentation", fmt.Sprintf("Denied presentation to %s", authReq.ClientID), false)
-			consentReq.SubmissionCh <- SubmissionResult{Error: "denied"}
-			writeJSON(w, http.StatusOK, map[string]string{"status": "denied"})
+			response := s.sendErrorResponse(authReq, ErrorAccessDenied, "the user denied the presentation")
+			consentReq.SubmissionCh <- errorSubmissionResult("denied", response)
+			writeJSON(w, http.StatusOK, withErrorResponse(map[string]any{"status": "denied"}, response))
 			return
 		}
 
 		s.log("  Consent:       approved")
 
 		// Apply user's claim selections if provided
-		if result.SelectedClaims != nil {
-			for i, m := range matches {
-				if selectedKeys, ok := result.SelectedClaims[m.CredentialID]; ok {
-					matches[i].SelectedKeys = selectedKeys
-					cred, _ := s.wallet.GetCredential(m.CredentialID)
-					matches[i].Claims = filterClaims(cred.Claims, selectedKeys)
-					s.log("    - %s: disclosing %v", m.CredentialID[:8], selectedKeys)
-				}
+		if result.SelectedPaths != nil || result.SelectedClaims != nil {
+			s.wallet.ApplyConsent(matches, result)
+			for _, m := range matches {
+				s.log("    - %s: disclosing %v", m.CredentialID[:8], m.SelectedPaths)
 			}
 		}
 
@@ -192,29 +242,54 @@ func (s *Server) handleAuthFlow(w http.ResponseWriter, authReq *AuthorizationReq
 	case <-time.After(5 * time.Minute):
 		consentReq.Status = "denied"
 		s.wallet.AddLog("presentation", "Consent timeout", false)
-		consentReq.SubmissionCh <- SubmissionResult{Error: "consent timeout"}
-		writeJSON(w, http.StatusRequestTimeout, map[string]string{"error": "consent timeout"})
+		response := s.sendErrorResponse(authReq, ErrorAccessDenied, "consent timeout")
+		consentReq.SubmissionCh <- errorSubmissionResult("consent timeout", response)
+		writeJSON(w, http.StatusRequestTimeout, withErrorResponse(map[string]any{"error": "consent timeout"}, response))
 	}
 }
 
 // autoAcceptPresentation handles auto-accept mode.
-func (s *Server) autoAcceptPresentation(w http.ResponseWriter, authReq *AuthorizationRequestParams, matches []CredentialMatch) {
+func (s *Server) autoAcceptPresentation(w http.ResponseWriter, authReq *AuthorizationRequestParams, matches []CredentialMatch, transactionData []TransactionData, verifierInfo *VerifierInfo) {
 	dim := color.New(color.Faint)
 	green := color.New(color.FgGreen)
 	yellow := color.New(color.FgYellow)
 
 	dim.Println("───────────────────────────────────────")
 	yellow.Printf("  Verifier: %s\n", authReq.ClientID)
+	printVerifierInfo(verifierInfo)
 	for _, m := range matches {
 		fmt.Printf("  Credential: %s (%s)\n", m.Format, credTypeLabel(m))
 		fmt.Printf("  Disclosing: %v\n", m.SelectedKeys)
 	}
+	for _, td := range transactionData {
+		fmt.Printf("  Transaction: %s\n", td.Type)
+	}
 
 	s.submitPresentation(w, authReq, matches)
 	green.Printf("  Auto-accepted\n")
 	dim.Println("───────────────────────────────────────")
 }
 
+// printVerifierInfo prints what the registration and access certificates say
+// about the verifier.
+func printVerifierInfo(info *VerifierInfo) {
+	if info == nil {
+		return
+	}
+	if info.Name != "" {
+		fmt.Printf("  Registered: %s (registrar %s)\n", info.Name, info.Registrar)
+	}
+	for _, use := range info.IntendedUse {
+		fmt.Printf("  Purpose: %s\n", use)
+	}
+	for _, reason := range info.Unverified {
+		fmt.Printf("  Unverified: %s\n", reason)
+	}
+	if info.AccessCertificate != nil {
+		fmt.Printf("  Access certificate: %s\n", info.AccessCertificate.Subject)
+	}
+}
+
 // submitPresentationWithNotify creates VP tokens, submits them, and notifies via the submission channel.
 func (s *Server) submitPresentationWithNotify(w http.ResponseWriter, authReq *AuthorizationRequestParams, matches []CredentialMatch, submissionCh chan SubmissionResult) {
 	result := s.submitPresentation(w, authReq, matches)
@@ -230,34 +305,56 @@ func (s *Server) submitPresentation(w http.ResponseWriter, authReq *Authorizatio
 		responseURI = authReq.RedirectURI
 	}
 
-	s.log("  Submitting VP token to %s", responseURI)
+	if authReq.Origin != "" {
+		s.log("  Returning VP token to %s (%s)", authReq.Origin, authReq.ResponseMode)
+	} else {
+		s.log("  Submitting VP token to %s", responseURI)
+	}
 
 	var err error
 	// Create VP tokens
 	params := PresentationParams{
-		Nonce:         authReq.Nonce,
-		ClientID:      authReq.ClientID,
-		ResponseURI:   responseURI,
-		RedirectURI:   authReq.RedirectURI,
-		ResponseMode:  authReq.ResponseMode,
-		RequestObject: authReq.RequestObject,
+		Nonce:           authReq.Nonce,
+		ClientID:        authReq.ClientID,
+		ResponseURI:     responseURI,
+		RedirectURI:     authReq.RedirectURI,
+		ResponseMode:    authReq.ResponseMode,
+		RequestObject:   authReq.RequestObject,
+		TransactionData: DecodeTransactionData(authReq.TransactionData),
+		Origin:          authReq.Origin,
+
+		PresentationDefinition: s.wallet.DraftPresentationDefinition(authReq.DCQLQuery, authReq.Legacy),
 	}
 	var vpResult *VPTokenMapResult
+	var warnings []string
 	if ResponseTypeContains(authReq.ResponseType, "vp_token") || authReq.ResponseType == "" {
 		vpResult, err = s.wallet.CreateVPTokenMap(matches, params)
 		if err != nil {
 			s.log("  ERROR: VP token creation failed: %v", err)
 			s.wallet.AddLog("presentation", fmt.Sprintf("VP token creation failed: %v", err), false)
+			if code := ErrorCode(err); code == ErrorVPFormatsNotSupported {
+				writeJSON(w, http.StatusBadRequest, withErrorResponse(map[string]any{
+					"error":             code,
+					"error_description": err.Error(),
+				}, s.sendErrorResponse(authReq, code, err.Error())))
+				return SubmissionResult{Error: err.Error()}
+			}
 			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 			return SubmissionResult{Error: err.Error()}
 		}
 		s.log("  VP tokens:     %d created", len(vpResult.TokenMap))
+		warnings = vpResult.Warnings
+		for _, warning := range warnings {
+			s.log("  WARNING:       %s", warning)
+		}
+		// Persist the credential instances marked as used.
+		s.triggerSave()
 	}
 
 	// Create self-issued id_token if requested
 	var idToken string
 	if ResponseTypeContains(authReq.ResponseType, "id_token") {
-		idToken, err = s.wallet.CreateSelfIssuedIDToken(authReq.Nonce, authReq.ClientID)
+		idToken, err = s.wallet.CreateSelfIssuedIDToken(authReq.Nonce, params.Audience(), SubjectSyntaxType(authReq.RequestObject))
 		if err != nil {
 			s.log("  ERROR: id_token creation failed: %v", err)
 			s.wallet.AddLog("presentation", fmt.Sprintf("id_token creation failed: %v", err), false)
@@ -267,6 +364,27 @@ func (s *Server) submitPresentation(w http.ResponseWriter, authReq *Authorizatio
 		s.log("  id_token:      created (SIOPv2)")
 	}
 
+	// DC API: the response goes back to the caller instead of the verifier
+	if authReq.Origin != "" {
+		data, err := s.wallet.BuildDCAPIResponse(vpResult, idToken, params)
+		if err != nil {
+			s.log("  ERROR: DC API response failed: %v", err)
+			s.wallet.AddLog("presentation", fmt.Sprintf("DC API response failed: %v", err), false)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return SubmissionResult{Error: err.Error()}
+		}
+		s.wallet.AddLog("presentation", fmt.Sprintf("Presented to %s via the DC API (%s)", authReq.Origin, authReq.ResponseMode), true)
+		response := map[string]any{
+			"protocol": authReq.Protocol,
+			"data":     data,
+		}
+		if len(warnings) > 0 {
+			response["warnings"] = warnings
+		}
+		writeJSON(w, http.StatusOK, response)
+		return SubmissionResult{StatusCode: http.StatusOK, Warnings: warnings}
+	}
+
 	// Submit to verifier (encrypts if direct_post.jwt with encryption key)
 	result, err := s.wallet.SubmitPresentation(vpResult, idToken, authReq.State, responseURI, params)
 	if err != nil {
@@ -286,15 +404,20 @@ func (s *Server) submitPresentation(w http.ResponseWriter, authReq *Authorizatio
 
 	s.wallet.AddLog("presentation", fmt.Sprintf("Presented to %s: %s", authReq.ClientID, FormatDirectPostResult(result)), true)
 
-	writeJSON(w, http.StatusOK, map[string]any{
+	response := map[string]any{
 		"status":        "submitted",
 		"response":      result,
 		"vp_token_keys": vpResult.QueryIDs(),
-	})
+	}
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	writeJSON(w, http.StatusOK, response)
 
 	return SubmissionResult{
 		RedirectURI: result.RedirectURI,
 		StatusCode:  result.StatusCode,
+		Warnings:    warnings,
 		Error: func() string {
 			if result.StatusCode >= 400 {
 				return result.Body
@@ -304,8 +427,65 @@ func (s *Server) submitPresentation(w http.ResponseWriter, authReq *Authorizatio
 	}
 }
 
+// sendErrorResponse sends an OID4VP error response to the verifier of a
+// request and returns the verifier's reply. It returns nil for DC API
+// requests, whose errors go back to the calling page, for requests without a
+// response_uri or redirect_uri, and if the verifier cannot be reached.
+func (s *Server) sendErrorResponse(authReq *AuthorizationRequestParams, code, description string) *DirectPostResult {
+	responseURI := authReq.ResponseURI
+	if responseURI == "" {
+		responseURI = authReq.RedirectURI
+	}
+	if authReq.Origin != "" || responseURI == "" {
+		return nil
+	}
+
+	s.log("  Sending error: %s to %s", code, responseURI)
+	params := PresentationParams{
+		Nonce:         authReq.Nonce,
+		ClientID:      authReq.ClientID,
+		ResponseURI:   responseURI,
+		RedirectURI:   authReq.RedirectURI,
+		ResponseMode:  authReq.ResponseMode,
+		RequestObject: authReq.RequestObject,
+	}
+	result, err := s.wallet.SubmitErrorResponse(code, description, authReq.State, responseURI, params)
+	if err != nil {
+		s.log("  ERROR: Error response failed: %v", err)
+		s.wallet.AddLog("presentation", fmt.Sprintf("Sending %s to %s failed: %v", code, authReq.ClientID, err), false)
+		return nil
+	}
+
+	s.log("  Response:      HTTP %d", result.StatusCode)
+	if result.RedirectURI != "" {
+		s.log("  Redirect:      %s", result.RedirectURI)
+	}
+	s.wallet.AddLog("presentation", fmt.Sprintf("Sent %s to %s: %s", code, authReq.ClientID, FormatDirectPostResult(result)), false)
+	return result
+}
+
+// withErrorResponse adds the verifier's reply to an error response, if one
+// was sent, to a handler's JSON body.
+func withErrorResponse(body map[string]any, response *DirectPostResult) map[string]any {
+	if response != nil {
+		body["response"] = response
+	}
+	return body
+}
+
+// errorSubmissionResult is the SubmissionResult of a request that ended in
+// an error response, with the redirect the verifier replied with.
+func errorSubmissionResult(reason string, response *DirectPostResult) SubmissionResult {
+	result := SubmissionResult{Error: reason}
+	if response != nil {
+		result.RedirectURI = response.RedirectURI
+		result.StatusCode = response.StatusCode
+	}
+	return result
+}
+
 // parseAuthParams extracts authorization request params from URL values.
-func parseAuthParams(values map[string][]string, opts oid4vc.ParseOptions, mode ValidationMode) (*AuthorizationRequestParams, error) {
+func parseAuthParams(values map[string][]string, opts oid4vc.ParseOptions) (*AuthorizationRequestParams, error) {
 	get := func(key string) string {
 		if vs, ok := values[key]; ok && len(vs) > 0 {
 			return vs[0]
@@ -323,11 +503,25 @@ func parseAuthParams(values map[string][]string, opts oid4vc.ParseOptions, mode
 		ResponseURI:  get("response_uri"),
 	}
 
+	// Parse transaction_data if present (OID4VP 1.0 §5.1)
 	if td := get("transaction_data"); td != "" {
-		if mode == ValidationModeStrict {
-			return nil, fmt.Errorf("transaction_data is not supported by this wallet")
+		var entries []string
+		if err := json.Unmarshal([]byte(td), &entries); err != nil {
+			return nil, fmt.Errorf("parsing transaction_data: %w", err)
+		}
+		if len(entries) == 0 {
+			return nil, fmt.Errorf("transaction_data must be a non-empty array")
+		}
+		params.TransactionData = entries
+	}
+
+	// Parse verifier_info if present (OID4VP 1.0 §5.1)
+	if vi := get("verifier_info"); vi != "" {
+		var entries []map[string]any
+		if err := json.Unmarshal([]byte(vi), &entries); err != nil {
+			return nil, fmt.Errorf("parsing verifier_info: %w", err)
 		}
-		log.Printf("[Wallet] WARNING: request contains transaction_data which is not processed (OID4VP §7.2)")
+		params.VerifierInfo = entries
 	}
 
 	// Parse dcql_query if present
@@ -339,6 +533,18 @@ func parseAuthParams(values map[string][]string, opts oid4vc.ParseOptions, mode
 		params.DCQLQuery = query
 	}
 
+	// Parameters of pre-1.0 drafts
+	if pd := get("presentation_definition"); pd != "" {
+		var definition map[string]any
+		if err := json.Unmarshal([]byte(pd), &definition); err != nil {
+			return nil, fmt.Errorf("parsing presentation_definition: %w", err)
+		}
+		params.Legacy.PresentationDefinition = definition
+	}
+	params.Legacy.PresentationDefinitionURI = get("presentation_definition_uri")
+	params.Legacy.ClientIDScheme = get("client_id_scheme")
+	params.Legacy.ClientMetadataURI = get("client_metadata_uri")
+
 	// If request_uri is present, build a synthetic openid4vp:// URI with all
 	// params so the parser can handle request_uri_method and fetch the JWT.
 	if requestURI := get("request_uri"); requestURI != "" {
@@ -362,6 +568,9 @@ func parseAuthParams(values map[string][]string, opts oid4vc.ParseOptions, mode
 		params.RedirectURI = parsed.RedirectURI
 		params.ResponseMode = parsed.ResponseMode
 		params.DCQLQuery = parsed.DCQLQuery
+		params.TransactionData = parsed.TransactionData
+		params.VerifierInfo = parsed.VerifierInfo
+		params.Legacy = parsed.Legacy
 		params.RequestObject = parsed.RequestObject
 	}
 
@@ -379,6 +588,9 @@ func parseAuthParams(values map[string][]string, opts oid4vc.ParseOptions, mode
 		params.RedirectURI = parsed.RedirectURI
 		params.ResponseMode = parsed.ResponseMode
 		params.DCQLQuery = parsed.DCQLQuery
+		params.TransactionData = parsed.TransactionData
+		params.VerifierInfo = parsed.VerifierInfo
+		params.Legacy = parsed.Legacy
 		params.RequestObject = parsed.RequestObject
 	}
 
@@ -16,6 +16,7 @@ package wallet
 
 import (
 	"crypto/ecdsa"
+	"crypto/x509"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -27,6 +28,7 @@ import (
 
 	"github.com/dominikschlosser/oid4vc-dev/internal/format"
 	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
+	"github.com/dominikschlosser/oid4vc-dev/internal/sdjwt"
 	"github.com/dominikschlosser/oid4vc-dev/internal/trustlist"
 )
 
@@ -318,6 +320,8 @@ func TestPresentationAPI_InvalidURI(t *testing.T) {
 
 func TestPresentationFlow_AutoAccept(t *testing.T) {
 	srv := newTestServer(t, true)
+	saves := 0
+	srv.onSave = func() { saves++ }
 
 	// Create a mock verifier that receives the VP token
 	var receivedBody string
@@ -366,6 +370,9 @@ func TestPresentationFlow_AutoAccept(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
 	}
+	if saves == 0 {
+		t.Error("expected the wallet to be saved after the presentation")
+	}
 
 	result := decodeJSON(t, w)
 	if result["status"] != "submitted" {
@@ -710,6 +717,176 @@ func TestConsentFlow_ApproveAndDeny(t *testing.T) {
 	}
 }
 
+func TestConsentFlow_TransactionData(t *testing.T) {
+	srv := newTestServer(t, false)
+
+	vpTokenCh := make(chan string, 1)
+	verifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		vpTokenCh <- r.FormValue("vp_token")
+		w.Write([]byte(`{}`))
+	}))
+	defer verifier.Close()
+
+	dcqlJSON, _ := json.Marshal(map[string]any{
+		"credentials": []any{
+			map[string]any{
+				"id":     "pid",
+				"format": "dc+sd-jwt",
+				"meta":   map[string]any{"vct_values": []any{mock.DefaultPIDVCT}},
+				"claims": []any{map[string]any{"path": []any{"given_name"}}},
+			},
+		},
+	})
+	payment := paymentTransactionData(t, "pid")
+	params := url.Values{
+		"client_id":        {"https://verifier.example"},
+		"response_type":    {"vp_token"},
+		"response_mode":    {"direct_post"},
+		"nonce":            {"nonce"},
+		"response_uri":     {verifier.URL},
+		"dcql_query":       {string(dcqlJSON)},
+		"transaction_data": {`["` + payment + `"]`},
+	}
+
+	resultCh := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		w := httptest.NewRecorder()
+		srv.mux.ServeHTTP(w, httptest.NewRequest("GET", "/authorize?"+params.Encode(), nil))
+		resultCh <- w
+	}()
+
+	var consent *ConsentRequest
+	for i := 0; i < 100 && consent == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if pending := srv.wallet.GetPendingRequests(); len(pending) > 0 {
+			consent = pending[0]
+		}
+	}
+	if consent == nil {
+		t.Fatal("no pending consent request found")
+	}
+	if len(consent.TransactionData) != 1 || consent.TransactionData[0].Type != "urn:eudi:sca:payment:1" {
+		t.Fatalf("expected the decoded transaction data on the consent request, got %+v", consent.TransactionData)
+	}
+
+	approveRec := httptest.NewRecorder()
+	srv.mux.ServeHTTP(approveRec, httptest.NewRequest("POST", "/api/requests/"+consent.ID+"/approve", strings.NewReader(`{}`)))
+	if approveRec.Code != http.StatusOK {
+		t.Fatalf("approve failed: %d %s", approveRec.Code, approveRec.Body.String())
+	}
+	if w := <-resultCh; w.Code != http.StatusOK {
+		t.Fatalf("authorize expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var vpToken map[string][]string
+	if err := json.Unmarshal([]byte(<-vpTokenCh), &vpToken); err != nil {
+		t.Fatalf("decoding vp_token: %v", err)
+	}
+	parsed, err := sdjwt.Parse(vpToken["pid"][0])
+	if err != nil {
+		t.Fatalf("parsing presentation: %v", err)
+	}
+	if hashes, _ := parsed.KeyBindingJWT.Payload["transaction_data_hashes"].([]any); len(hashes) != 1 {
+		t.Errorf("expected one transaction data hash in the KB-JWT, got %v", parsed.KeyBindingJWT.Payload)
+	}
+}
+
+// verifierInfoParams returns a request for the PID's given_name and birthdate
+// with a registration certificate that entitles only given_name, and the
+// registrar CA that issued it.
+func verifierInfoParams(t *testing.T) (url.Values, *x509.Certificate) {
+	t.Helper()
+	dcqlJSON, _ := json.Marshal(map[string]any{
+		"credentials": []any{
+			map[string]any{
+				"id":     "pid",
+				"format": "dc+sd-jwt",
+				"meta":   map[string]any{"vct_values": []any{mock.DefaultPIDVCT}},
+				"claims": []any{
+					map[string]any{"path": []any{"given_name"}},
+					map[string]any{"path": []any{"birthdate"}},
+				},
+			},
+		},
+	})
+	registration, ca := signedRegistrationCertificate(t, map[string]any{
+		"iss":     "https://registrar.example",
+		"name":    "Example Shop",
+		"purpose": "Age verification",
+		"credentials": []any{map[string]any{
+			"format": "dc+sd-jwt",
+			"meta":   map[string]any{"vct_values": []any{mock.DefaultPIDVCT}},
+			"claims": []any{map[string]any{"path": []any{"given_name"}}},
+		}},
+	})
+	verifierInfoJSON, _ := json.Marshal([]any{map[string]any{
+		"format": "registration_cert",
+		"data":   registration,
+	}})
+	return url.Values{
+		"client_id":     {"https://verifier.example"},
+		"response_type": {"vp_token"},
+		"nonce":         {"nonce"},
+		"response_uri":  {"https://verifier.example/cb"},
+		"dcql_query":    {string(dcqlJSON)},
+		"verifier_info": {string(verifierInfoJSON)},
+	}, ca
+}
+
+func TestAuthorize_StrictRejectsOverasking(t *testing.T) {
+	srv := newStrictTestServer(t, true)
+	params, ca := verifierInfoParams(t)
+	srv.wallet.RegistrarCAs = []*x509.Certificate{ca}
+	w := serverRequest(t, srv, "GET", "/authorize?"+params.Encode(), "")
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "does not entitle") {
+		t.Fatalf("expected an entitlement error, got %s", w.Body.String())
+	}
+}
+
+func TestConsentFlow_VerifierInfo(t *testing.T) {
+	srv := newTestServer(t, false)
+	params, ca := verifierInfoParams(t)
+	srv.wallet.RegistrarCAs = []*x509.Certificate{ca}
+
+	resultCh := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		w := httptest.NewRecorder()
+		srv.mux.ServeHTTP(w, httptest.NewRequest("GET", "/authorize?"+params.Encode(), nil))
+		resultCh <- w
+	}()
+
+	var consent *ConsentRequest
+	for i := 0; i < 100 && consent == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if pending := srv.wallet.GetPendingRequests(); len(pending) > 0 {
+			consent = pending[0]
+		}
+	}
+	if consent == nil {
+		t.Fatal("no pending consent request found")
+	}
+	info := consent.VerifierInfo
+	if info == nil || info.Name != "Example Shop" || info.Registrar != "https://registrar.example" {
+		t.Fatalf("expected the registration certificate on the consent request, got %+v", info)
+	}
+	if len(info.IntendedUse) != 1 || info.IntendedUse[0] != "Age verification" {
+		t.Errorf("intended use = %v", info.IntendedUse)
+	}
+	if len(info.Overasked) != 1 || !strings.Contains(info.Overasked[0], "birthdate") {
+		t.Errorf("expected birthdate to be flagged, got %v", info.Overasked)
+	}
+
+	srv.mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/requests/"+consent.ID+"/deny", nil))
+	if w := <-resultCh; w.Code != http.StatusOK {
+		t.Fatalf("authorize expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
 func TestConsentFlow_Deny(t *testing.T) {
 	srv := newTestServer(t, false)
 
@@ -896,6 +1073,63 @@ func TestOfferAPI_InvalidJSON(t *testing.T) {
 	}
 }
 
+// --- Authorization Callback Tests ---
+
+func TestAuthorizationCallback_UnknownState(t *testing.T) {
+	srv := newTestServer(t, false)
+
+	w := serverRequest(t, srv, "GET", "/callback?code=abc&state=unknown", "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown state, got %d", w.Code)
+	}
+}
+
+func TestAuthorizationCallback_DeliversCode(t *testing.T) {
+	srv := newTestServer(t, false)
+	ch := srv.wallet.registerAuthorization("state-1")
+
+	w := serverRequest(t, srv, "GET", "/callback?code=abc&state=state-1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	select {
+	case cb := <-ch:
+		if cb.Code != "abc" {
+			t.Errorf("expected code abc, got %q", cb.Code)
+		}
+	default:
+		t.Fatal("expected callback to be delivered to the pending flow")
+	}
+
+	// The state is single-use
+	w = serverRequest(t, srv, "GET", "/callback?code=abc&state=state-1", "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 on state replay, got %d", w.Code)
+	}
+}
+
+func TestNewServer_InstallsAuthorizationPrompt(t *testing.T) {
+	srv := newTestServer(t, false)
+	if srv.wallet.OnAuthorizationURL == nil {
+		t.Fatal("expected NewServer to install a default authorization handler")
+	}
+
+	ch, unsub := srv.wallet.SubscribeAuthorizations()
+	defer unsub()
+	if err := srv.wallet.OnAuthorizationURL("https://as.example/authorize?x=1"); err != nil {
+		t.Fatalf("authorization handler: %v", err)
+	}
+	select {
+	case got := <-ch:
+		if got != "https://as.example/authorize?x=1" {
+			t.Errorf("unexpected authorization URL %q", got)
+		}
+	default:
+		t.Fatal("expected authorization URL to be broadcast to subscribers")
+	}
+}
+
 // --- OnConsentRequest Callback Tests ---
 
 func TestOnConsentRequest_CalledOnInteractiveFlow(t *testing.T) {
@@ -1231,6 +1465,128 @@ func TestPresentationFlow_RequestURIMethodPost_Encrypted(t *testing.T) {
 	}
 }
 
+func TestDCAPIFlow_Unsigned(t *testing.T) {
+	srv := newStrictTestServer(t, true)
+	saves := 0
+	srv.onSave = func() { saves++ }
+	body, _ := json.Marshal(DCAPIRequest{
+		Origin:   "https://verifier.example",
+		Protocol: DCAPIProtocolUnsigned,
+		Data: map[string]any{
+			"response_type":   "vp_token",
+			"response_mode":   "dc_api",
+			"nonce":           "dc-nonce",
+			"client_metadata": map[string]any{"vp_formats_supported": map[string]any{"dc+sd-jwt": map[string]any{}}},
+			"dcql_query": map[string]any{"credentials": []any{map[string]any{
+				"id":     "pid",
+				"format": "dc+sd-jwt",
+				"meta":   map[string]any{"vct_values": []any{mock.DefaultPIDVCT}},
+				"claims": []any{map[string]any{"path": []any{"given_name"}}},
+			}}},
+		},
+	})
+
+	w := serverRequest(t, srv, "POST", "/api/dc-api", string(body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if saves == 0 {
+		t.Error("expected the wallet to be saved after the presentation")
+	}
+	result := decodeJSON(t, w)
+	if result["protocol"] != DCAPIProtocolUnsigned {
+		t.Errorf("protocol = %v", result["protocol"])
+	}
+	data, _ := result["data"].(map[string]any)
+	vpToken, _ := data["vp_token"].(map[string]any)
+	presentations, _ := vpToken["pid"].([]any)
+	if len(presentations) != 1 {
+		t.Fatalf("expected one pid presentation, got %v", data)
+	}
+
+	// The KB-JWT audience is the origin, not a client_id.
+	sdJWT, _ := presentations[0].(string)
+	kbJWT := sdJWT[strings.LastIndex(sdJWT, "~")+1:]
+	_, kbPayload, _, err := format.ParseJWTParts(kbJWT)
+	if err != nil {
+		t.Fatalf("parsing KB-JWT: %v", err)
+	}
+	if kbPayload["aud"] != "origin:https://verifier.example" || kbPayload["nonce"] != "dc-nonce" {
+		t.Errorf("unexpected KB-JWT payload %v", kbPayload)
+	}
+}
+
+func TestDCAPIFlow_EncryptedMDoc(t *testing.T) {
+	srv := newTestServer(t, true)
+	encKey, _ := mock.GenerateKey()
+	body, _ := json.Marshal(DCAPIRequest{
+		Origin:   "https://verifier.example",
+		Protocol: DCAPIProtocolUnsigned,
+		Data: map[string]any{
+			"response_type": "vp_token",
+			"response_mode": "dc_api.jwt",
+			"nonce":         "dc-nonce",
+			"client_metadata": map[string]any{
+				"jwks": map[string]any{"keys": []any{testEncJWK(t, &encKey.PublicKey)}},
+			},
+			"dcql_query": map[string]any{"credentials": []any{map[string]any{
+				"id":     "pid_mdoc",
+				"format": "mso_mdoc",
+				"meta":   map[string]any{"doctype_value": "eu.europa.ec.eudi.pid.1"},
+				"claims": []any{map[string]any{"path": []any{"eu.europa.ec.eudi.pid.1", "given_name"}}},
+			}}},
+		},
+	})
+
+	w := serverRequest(t, srv, "POST", "/api/dc-api", string(body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	data, _ := decodeJSON(t, w)["data"].(map[string]any)
+	jwe, _ := data["response"].(string)
+	if jwe == "" {
+		t.Fatalf("expected an encrypted response, got %v", data)
+	}
+	plaintext, err := DecryptJWE(jwe, encKey)
+	if err != nil {
+		t.Fatalf("DecryptJWE: %v", err)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		t.Fatalf("parsing response payload: %v", err)
+	}
+	if _, hasState := payload["state"]; hasState {
+		t.Error("DC API responses must not carry state")
+	}
+	vpToken, _ := payload["vp_token"].(map[string]any)
+	if presentations, _ := vpToken["pid_mdoc"].([]any); len(presentations) != 1 {
+		t.Errorf("expected one mDoc presentation, got %v", payload)
+	}
+}
+
+func TestDCAPIFlow_StrictRejectsOriginMismatch(t *testing.T) {
+	srv := newStrictTestServer(t, true)
+	body, _ := json.Marshal(DCAPIRequest{
+		Origin:   "https://attacker.example",
+		Protocol: DCAPIProtocolSigned,
+		Data: map[string]any{"request": makeTestJWT(map[string]any{"alg": "ES256", "typ": "oauth-authz-req+jwt"}, map[string]any{
+			"client_id":        "https://verifier.example",
+			"response_type":    "vp_token",
+			"response_mode":    "dc_api",
+			"nonce":            "dc-nonce",
+			"expected_origins": []any{"https://verifier.example"},
+		})},
+	})
+
+	w := serverRequest(t, srv, "POST", "/api/dc-api", string(body))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "expected_origins") {
+		t.Errorf("expected an expected_origins error, got %s", w.Body.String())
+	}
+}
+
 // --- Helper ---
 
 func generateSDJWTForTest(t *testing.T, srv *Server) string {
@@ -1247,3 +1603,217 @@ func generateSDJWTForTest(t *testing.T, srv *Server) string {
 	}
 	return result
 }
+
+// --- Deferred Issuance Tests ---
+
+// testPresentationDefinition requests the SD-JWT PID's given_name and, with
+// mdoc set, the mDoc PID's family_name.
+func testPresentationDefinition(mdoc bool) map[string]any {
+	descriptors := []any{map[string]any{
+		"id":     "pid-sd-jwt",
+		"format": map[string]any{"vc+sd-jwt": map[string]any{"sd-jwt_alg_values": []any{"ES256"}}},
+		"constraints": map[string]any{
+			"limit_disclosure": "required",
+			"fields": []any{
+				map[string]any{"path": []any{"$.vct"}, "filter": map[string]any{"type": "string", "const": mock.DefaultPIDVCT}},
+				map[string]any{"path": []any{"$.credentialSubject.given_name", "$.given_name"}},
+			},
+		},
+	}}
+	if mdoc {
+		descriptors = append(descriptors, map[string]any{
+			"id":     "eu.europa.ec.eudi.pid.1",
+			"format": map[string]any{"mso_mdoc": map[string]any{"alg": []any{"ES256"}}},
+			"constraints": map[string]any{
+				"fields": []any{
+					map[string]any{"path": []any{"$['eu.europa.ec.eudi.pid.1']['family_name']"}, "intent_to_retain": false},
+				},
+			},
+		})
+	}
+	return map[string]any{"id": "pid-request", "input_descriptors": descriptors}
+}
+
+func TestDraftFlow_PresentationExchange(t *testing.T) {
+	srv := newTestServer(t, true)
+	srv.wallet.Draft = 20
+
+	var received url.Values
+	verifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		received = r.PostForm
+		w.Write([]byte(`{}`))
+	}))
+	defer verifier.Close()
+
+	pdJSON, _ := json.Marshal(testPresentationDefinition(true))
+	params := url.Values{
+		"client_id":               {verifier.URL},
+		"client_id_scheme":        {"redirect_uri"},
+		"response_type":           {"vp_token"},
+		"response_mode":           {"direct_post"},
+		"nonce":                   {"draft-nonce"},
+		"state":                   {"draft-state"},
+		"response_uri":            {verifier.URL},
+		"presentation_definition": {string(pdJSON)},
+	}
+	w := serverRequest(t, srv, "GET", "/authorize?"+params.Encode(), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if result := decodeJSON(t, w); result["status"] != "submitted" {
+		t.Fatalf("expected status 'submitted', got %v", result)
+	}
+
+	var vpToken []string
+	if err := json.Unmarshal([]byte(received.Get("vp_token")), &vpToken); err != nil || len(vpToken) != 2 {
+		t.Fatalf("expected a vp_token array of two presentations, got %q", received.Get("vp_token"))
+	}
+	if !strings.Contains(vpToken[0], "~") {
+		t.Errorf("expected an SD-JWT presentation first, got %q", vpToken[0])
+	}
+
+	var submission struct {
+		ID            string `json:"id"`
+		DefinitionID  string `json:"definition_id"`
+		DescriptorMap []struct {
+			ID     string `json:"id"`
+			Format string `json:"format"`
+			Path   string `json:"path"`
+		} `json:"descriptor_map"`
+	}
+	if err := json.Unmarshal([]byte(received.Get("presentation_submission")), &submission); err != nil {
+		t.Fatalf("parsing presentation_submission: %v", err)
+	}
+	if submission.ID == "" || submission.DefinitionID != "pid-request" || len(submission.DescriptorMap) != 2 {
+		t.Fatalf("unexpected presentation_submission %+v", submission)
+	}
+	want := []struct{ id, format, path string }{
+		{"pid-sd-jwt", "vc+sd-jwt", "$[0]"},
+		{"eu.europa.ec.eudi.pid.1", "mso_mdoc", "$[1]"},
+	}
+	for i, d := range submission.DescriptorMap {
+		if d.ID != want[i].id || d.Format != want[i].format || d.Path != want[i].path {
+			t.Errorf("descriptor_map[%d] = %+v, want %+v", i, d, want[i])
+		}
+	}
+	if received.Get("state") != "draft-state" {
+		t.Errorf("state = %q", received.Get("state"))
+	}
+}
+
+func TestDraftFlow_SinglePresentationIsNotJSON(t *testing.T) {
+	srv := newTestServer(t, true)
+	srv.wallet.Draft = 23
+
+	var received url.Values
+	verifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		received = r.PostForm
+		w.Write([]byte(`{}`))
+	}))
+	defer verifier.Close()
+
+	pdJSON, _ := json.Marshal(testPresentationDefinition(false))
+	params := url.Values{
+		"client_id":               {"redirect_uri:" + verifier.URL},
+		"response_type":           {"vp_token"},
+		"response_mode":           {"direct_post"},
+		"nonce":                   {"draft-nonce"},
+		"response_uri":            {verifier.URL},
+		"presentation_definition": {string(pdJSON)},
+	}
+	w := serverRequest(t, srv, "GET", "/authorize?"+params.Encode(), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	vpToken := received.Get("vp_token")
+	if strings.HasPrefix(vpToken, `"`) || strings.Count(vpToken, "~") < 2 {
+		t.Fatalf("expected the SD-JWT presentation as vp_token, got %q", vpToken)
+	}
+	if !strings.Contains(received.Get("presentation_submission"), `"path":"$"`) {
+		t.Errorf("expected descriptor_map path $, got %s", received.Get("presentation_submission"))
+	}
+}
+
+func TestDraftFlow_PresentationDefinitionNeedsDraftMode(t *testing.T) {
+	srv := newTestServer(t, true)
+	pdJSON, _ := json.Marshal(testPresentationDefinition(false))
+	params := url.Values{
+		"client_id":               {"https://verifier.example"},
+		"response_type":           {"vp_token"},
+		"nonce":                   {"n"},
+		"response_uri":            {"https://verifier.example/cb"},
+		"presentation_definition": {string(pdJSON)},
+	}
+	w := serverRequest(t, srv, "GET", "/authorize?"+params.Encode(), "")
+	if result := decodeJSON(t, w); result["status"] != "no_match" {
+		t.Errorf("expected no_match without --draft, got %v", result)
+	}
+}
+
+func TestListPendingIssuances(t *testing.T) {
+	srv := newTestServer(t, false)
+	srv.wallet.PendingIssuances = []PendingIssuance{{ID: "p1", TransactionID: "tx-1", Issuer: "https://issuer.example"}}
+
+	w := serverRequest(t, srv, "GET", "/api/pending", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	var pending []PendingIssuance
+	if err := json.Unmarshal(w.Body.Bytes(), &pending); err != nil {
+		t.Fatalf("parsing response: %v", err)
+	}
+	if len(pending) != 1 || pending[0].TransactionID != "tx-1" {
+		t.Errorf("unexpected pending issuances: %+v", pending)
+	}
+}
+
+func TestRetryPendingIssuance_NotFound(t *testing.T) {
+	srv := newTestServer(t, false)
+
+	w := serverRequest(t, srv, "POST", "/api/pending/unknown/retry", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestSendNotificationAPI(t *testing.T) {
+	srv := newTestServer(t, false)
+	creds := srv.wallet.GetCredentials()
+	if len(creds) == 0 {
+		t.Fatal("expected test credentials")
+	}
+
+	w := serverRequest(t, srv, "POST", "/api/credentials/unknown/notification", `{"event":"credential_accepted"}`)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown credential: expected 404, got %d", w.Code)
+	}
+	w = serverRequest(t, srv, "POST", "/api/credentials/"+creds[0].ID+"/notification", `{}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("missing event: expected 400, got %d", w.Code)
+	}
+	w = serverRequest(t, srv, "POST", "/api/credentials/"+creds[0].ID+"/notification", `{"event":"credential_accepted"}`)
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("credential without notification_id: expected 502, got %d", w.Code)
+	}
+}
+
+func TestRefreshCredentialAPI(t *testing.T) {
+	srv := newTestServer(t, false)
+	creds := srv.wallet.GetCredentials()
+	if len(creds) == 0 {
+		t.Fatal("expected test credentials")
+	}
+
+	w := serverRequest(t, srv, "POST", "/api/credentials/unknown/refresh", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown credential: expected 404, got %d", w.Code)
+	}
+	w = serverRequest(t, srv, "POST", "/api/credentials/"+creds[0].ID+"/refresh", "")
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "no issuance context") {
+		t.Errorf("credential without issuance context: expected 502, got %d: %s", w.Code, w.Body.String())
+	}
+}
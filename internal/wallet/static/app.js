@@ -30,6 +30,8 @@
   const importTextarea = document.getElementById('import-textarea');
   const consentOverlay = document.getElementById('consent-overlay');
   const consentDialog = document.getElementById('consent-dialog');
+  const pendingSection = document.getElementById('pending-section');
+  const pendingContainer = document.getElementById('pending');
 
   // Load credentials
   async function loadCredentials() {
@@ -60,26 +62,133 @@
       const formatClass = cred.format === 'dc+sd-jwt' ? 'format-sdjwt' : cred.format === 'jwt_vc_json' ? 'format-jwt' : 'format-mdoc';
       const formatLabel = cred.format === 'dc+sd-jwt' ? 'SD-JWT' : cred.format === 'jwt_vc_json' ? 'JWT VC' : 'mDoc';
       const typeLabel = cred.vct || cred.doctype || cred.format;
+      const display = cred.display || {};
 
       const claimKeys = Object.keys(cred.claims || {}).slice(0, 6);
-      const claimTags = claimKeys.map(k => '<span class="claim-tag">' + escHtml(k) + '</span>').join('');
+      const claimTags = claimKeys.map(k => '<span class="claim-tag">' + escHtml(claimLabel(display, k)) + '</span>').join('');
       const moreCount = Object.keys(cred.claims || {}).length - claimKeys.length;
       const moreTag = moreCount > 0 ? '<span class="claim-tag">+' + moreCount + ' more</span>' : '';
+      const instanceTag = cred.instances ? '<span class="instance-count' + (cred.unused_instances === 0 ? ' instances-exhausted' : '') + '">' + cred.unused_instances + '/' + cred.instances + ' unused' + (cred.unused_instances === 0 ? ' (exhausted)' : '') + '</span>' : '';
+
+      // Issuer display data: rendered like a wallet would, with problems in
+      // the issuer metadata listed below the claims.
+      let issuerLine = '';
+      if (display.issuer_name || display.signed_metadata) {
+        const signed = display.signed_metadata === 'self-signed' ? '<span class="signed-badge" title="signed_metadata signature is valid, but its key is not checked against a trust anchor">self-signed</span>' : '';
+        issuerLine = '<div class="credential-issuer">' + imageHTML(display.issuer_logo_uri, '', 'issuer-logo') +
+          escHtml(display.issuer_name || '') + signed + '</div>';
+      }
+      const subtitle = display.name ? '<div class="credential-subtitle">' + escHtml(typeLabel) + '</div>' : '';
+      const description = display.description ? '<div class="credential-description">' + escHtml(display.description) + '</div>' : '';
+      const issues = (display.issues || []).map(i => '<div class="metadata-issue">' + escHtml(i) + '</div>').join('');
+      const expiry = cred.expires_at ? '<span class="claim-tag">expires ' + escHtml(new Date(cred.expires_at).toLocaleString()) + '</span>' : '';
+      const refreshBtn = cred.refreshable ? '<button class="btn btn-sm" data-refresh="' + cred.id + '">Refresh</button>' : '';
+      if (display.background_color) card.style.background = display.background_color;
+      if (display.background_image && isSafeImageURI(display.background_image)) {
+        card.style.backgroundImage = 'url("' + encodeURI(display.background_image) + '")';
+        card.style.backgroundSize = 'cover';
+      }
+      if (display.text_color) card.style.color = display.text_color;
+      if (display.background_color || display.text_color) card.classList.add('issuer-styled');
 
       card.innerHTML = '<span class="format-badge ' + formatClass + '">' + formatLabel + '</span>' +
+        imageHTML(display.logo_uri, display.logo_alt_text || display.name || '', 'credential-logo') +
         '<div class="credential-info">' +
-          '<div class="credential-type">' + escHtml(typeLabel) + '</div>' +
-          '<div class="credential-claims">' + claimTags + moreTag + '</div>' +
+          issuerLine +
+          '<div class="credential-type">' + escHtml(display.name || typeLabel) + instanceTag + '</div>' +
+          subtitle + description +
+          '<div class="credential-claims">' + claimTags + moreTag + expiry + '</div>' +
+          issues +
         '</div>' +
         '<div class="credential-actions">' +
+          refreshBtn +
           '<button class="btn btn-danger btn-sm" data-delete="' + cred.id + '">Delete</button>' +
         '</div>';
 
       card.querySelector('[data-delete]').addEventListener('click', () => deleteCredential(cred.id));
+      if (cred.refreshable) {
+        card.querySelector('[data-refresh]').addEventListener('click', () => refreshCredential(cred.id));
+      }
       credContainer.appendChild(card);
     });
   }
 
+  // Load deferred issuances; refreshed while any are pending since the
+  // server polls the issuer in the background.
+  let pendingTimer = null;
+  async function loadPendingIssuances() {
+    try {
+      const resp = await fetch('/api/pending');
+      const pending = await resp.json() || [];
+      renderPendingIssuances(pending);
+      clearTimeout(pendingTimer);
+      if (pending.length > 0) {
+        pendingTimer = setTimeout(async () => {
+          await loadPendingIssuances();
+          await loadCredentials();
+        }, 5000);
+      }
+    } catch (e) {
+      console.error('Failed to load pending issuances:', e);
+    }
+  }
+
+  function renderPendingIssuances(pending) {
+    pendingContainer.innerHTML = '';
+    pendingSection.style.display = pending.length > 0 ? '' : 'none';
+    pending.forEach(p => {
+      const card = document.createElement('div');
+      card.className = 'credential-card';
+      const next = new Date(p.next_attempt).toLocaleTimeString();
+      const lastError = p.last_error ? '<span class="claim-tag">' + escHtml(p.last_error) + '</span>' : '';
+      card.innerHTML = '<span class="format-badge format-jwt">Pending</span>' +
+        '<div class="credential-info">' +
+          '<div class="credential-type">' + escHtml(p.issuer) + '</div>' +
+          '<div class="credential-claims">' +
+            '<span class="claim-tag">transaction ' + escHtml(p.transaction_id) + '</span>' +
+            '<span class="claim-tag">' + p.attempts + ' attempts</span>' +
+            '<span class="claim-tag">next poll ' + escHtml(next) + '</span>' +
+            lastError +
+          '</div>' +
+        '</div>' +
+        '<div class="credential-actions">' +
+          '<button class="btn btn-sm" data-retry="' + escHtml(p.id) + '">Retry</button>' +
+        '</div>';
+      card.querySelector('[data-retry]').addEventListener('click', () => retryPendingIssuance(p.id));
+      pendingContainer.appendChild(card);
+    });
+  }
+
+  async function retryPendingIssuance(id) {
+    try {
+      const resp = await fetch('/api/pending/' + id + '/retry', { method: 'POST' });
+      const result = await resp.json();
+      if (result.error) {
+        alert('Retry failed: ' + result.error);
+      }
+      await loadPendingIssuances();
+      await loadCredentials();
+      await loadLog();
+    } catch (e) {
+      alert('Retry failed: ' + e.message);
+    }
+  }
+
+  async function refreshCredential(id) {
+    try {
+      const resp = await fetch('/api/credentials/' + id + '/refresh', { method: 'POST' });
+      const result = await resp.json();
+      if (result.error) {
+        showErrorDialog('Refresh failed', result.error);
+      }
+      await loadPendingIssuances();
+      await loadCredentials();
+      await loadLog();
+    } catch (e) {
+      showErrorDialog('Refresh failed', e.message);
+    }
+  }
+
   async function deleteCredential(id) {
     try {
       await fetch('/api/credentials/' + id, { method: 'DELETE' });
@@ -109,14 +218,17 @@
       });
 
       const result = await resp.json();
+      closeAuthorizationDialog();
       if (result.error) {
         alert('Error: ' + result.error);
       } else {
         offerInput.value = '';
         await loadCredentials();
+        await loadPendingIssuances();
         await loadLog();
       }
     } catch (e) {
+      closeAuthorizationDialog();
       alert('Request failed: ' + e.message);
     } finally {
       processBtn.disabled = false;
@@ -232,6 +344,14 @@
         console.error('SSE error parse error:', e);
       }
     });
+    es.addEventListener('authorization', (event) => {
+      try {
+        const data = JSON.parse(event.data);
+        showAuthorizationDialog(data.authorization_url);
+      } catch (e) {
+        console.error('SSE authorization parse error:', e);
+      }
+    });
     es.onerror = () => {
       es.close();
       setTimeout(connectSSE, 3000);
@@ -259,9 +379,35 @@
     });
   }
 
+  // OID4VCI authorization code flow: the issuer wants the user to log in.
+  let authDialogOpen = false;
+
+  function showAuthorizationDialog(url) {
+    authDialogOpen = true;
+    consentOverlay.classList.add('active');
+
+    consentDialog.innerHTML = '<div class="consent-title">Authorization Required</div>' +
+      '<div class="consent-verifier">The issuer requires you to log in and authorize the credential request. ' +
+        'The wallet continues automatically once the issuer redirects back.</div>' +
+      '<pre class="error-detail">' + escHtml(url) + '</pre>' +
+      '<div class="consent-buttons">' +
+        '<button class="btn" id="auth-dismiss">Close</button>' +
+        '<a class="btn btn-primary" id="auth-open" target="_blank" rel="noopener">Open Authorization Page</a>' +
+      '</div>';
+
+    document.getElementById('auth-open').href = url;
+    document.getElementById('auth-dismiss').addEventListener('click', closeAuthorizationDialog);
+  }
+
+  function closeAuthorizationDialog() {
+    if (!authDialogOpen) return;
+    authDialogOpen = false;
+    consentOverlay.classList.remove('active');
+  }
+
   function showSubmissionResult(result) {
-    // Only redirect on success — never redirect on error
-    if (result.redirect_uri && !result.error) {
+    // Only redirect on success without warnings — never redirect on error
+    if (result.redirect_uri && !result.error && !(result.warnings || []).length) {
       window.location.href = result.redirect_uri;
       return;
     }
@@ -283,13 +429,21 @@
       } catch (e) { /* keep as-is */ }
       html += '<pre class="error-detail">' + escHtml(errorBody) + '</pre>';
     }
+    (result.warnings || []).forEach(warning => {
+      html += '<div class="consent-warning">' + escHtml(warning) + '</div>';
+    });
 
+    const redirect = isSuccess && result.redirect_uri;
     html += '<div class="consent-buttons">' +
-      '<button class="btn btn-primary" id="result-dismiss">Dismiss</button>' +
+      '<button class="btn btn-primary" id="result-dismiss">' + (redirect ? 'Continue' : 'Dismiss') + '</button>' +
     '</div>';
 
     consentDialog.innerHTML = html;
     document.getElementById('result-dismiss').addEventListener('click', () => {
+      if (redirect) {
+        window.location.href = result.redirect_uri;
+        return;
+      }
       consentOverlay.classList.remove('active');
       loadLog();
     });
@@ -301,25 +455,112 @@
     let html = '<div class="consent-title">Presentation Request</div>' +
       '<div class="consent-verifier">Verifier: ' + escHtml(req.client_id) + '</div>';
 
+    // What the registration certificate (verifier_info) and the access
+    // certificate say about the verifier, registration certificates that could
+    // not be verified, and claims it is not registered for.
+    const vi = req.verifier_info;
+    if (vi) {
+      const rows = [];
+      if (vi.name) rows.push(['Registered as', vi.name]);
+      if (vi.registrar) rows.push(['Registrar', vi.registrar]);
+      (vi.intended_use || []).forEach(use => rows.push(['Intended use', use]));
+      if (vi.privacy_policy) rows.push(['Privacy policy', vi.privacy_policy]);
+      (vi.entitlements || []).forEach(e => rows.push(['Entitlement', e]));
+      if (vi.access_certificate) {
+        rows.push(['Access certificate', vi.access_certificate.subject]);
+        rows.push(['Issued by', vi.access_certificate.issuer]);
+      }
+      const flagged = (vi.overasked || []).length || (vi.unverified || []).length;
+      html += '<div class="consent-credential consent-verifier-info' + (flagged ? ' consent-overasked' : '') + '">' +
+        '<div class="consent-credential-header">' +
+          '<span class="badge badge-count">verifier</span>' +
+          '<span style="font-size:12px;font-weight:600;">' + escHtml(vi.name || req.client_id) + '</span>' +
+        '</div>' +
+        '<div class="consent-claims">';
+      rows.forEach(([label, value]) => {
+        html += '<div class="consent-claim">' +
+          '<span class="consent-claim-name">' + escHtml(label) + '</span>' +
+          '<span class="consent-claim-value">' + escHtml(value) + '</span>' +
+        '</div>';
+      });
+      (vi.unverified || []).forEach(u => {
+        html += '<div class="consent-claim consent-overasked-claim">' +
+          '<span class="badge badge-overasked">unverified</span>' +
+          '<span class="consent-claim-value">' + escHtml(u) + '</span>' +
+        '</div>';
+      });
+      (vi.overasked || []).forEach(o => {
+        html += '<div class="consent-claim consent-overasked-claim">' +
+          '<span class="badge badge-overasked">not entitled</span>' +
+          '<span class="consent-claim-value">' + escHtml(o.replace(/^verifier_info: /, '')) + '</span>' +
+        '</div>';
+      });
+      html += '</div></div>';
+    }
+
+    // Warnings about the presentation, e.g. batch instances that are all used
+    // and would be presented again.
+    (req.warnings || []).forEach(warning => {
+      html += '<div class="consent-warning">' + escHtml(warning) + '</div>';
+    });
+
+    // Transaction data the presentations will be bound to, e.g. a payment
+    // or a signature authorization.
+    (req.transaction_data || []).forEach(td => {
+      html += '<div class="consent-credential consent-transaction">' +
+        '<div class="consent-credential-header">' +
+          '<span class="badge badge-retain">transaction</span>' +
+          '<span style="font-size:12px;font-weight:600;">' + escHtml(td.type || '(no type)') + '</span>' +
+        '</div>' +
+        '<div class="consent-claims">';
+      Object.keys(td.content || {}).forEach(key => {
+        if (key === 'type') return;
+        const v = td.content[key];
+        html += '<div class="consent-claim">' +
+          '<span class="consent-claim-name">' + escHtml(key) + '</span>' +
+          '<span class="consent-claim-value">' + escHtml(typeof v === 'object' ? JSON.stringify(v) : String(v)) + '</span>' +
+        '</div>';
+      });
+      html += '</div></div>';
+    });
+
     if (req.matched_credentials && req.matched_credentials.length > 0) {
       req.matched_credentials.forEach((mc, idx) => {
         const formatClass = mc.format === 'dc+sd-jwt' ? 'format-sdjwt' : mc.format === 'jwt_vc_json' ? 'format-jwt' : 'format-mdoc';
         const formatLabel = mc.format === 'dc+sd-jwt' ? 'SD-JWT' : mc.format === 'jwt_vc_json' ? 'JWT VC' : 'mDoc';
-        const typeLabel = mc.vct || mc.doctype || mc.format;
+        const stored = credentials.find(c => c.id === mc.credential_id) || {};
+        const display = stored.display || {};
+        const typeLabel = display.name || mc.vct || mc.doctype || mc.format;
 
         html += '<div class="consent-credential">' +
           '<div class="consent-credential-header">' +
             '<span class="format-badge ' + formatClass + '">' + formatLabel + '</span>' +
+            imageHTML(display.logo_uri, display.logo_alt_text || '', 'credential-logo') +
             '<span style="font-size:12px;font-weight:600;">' + escHtml(typeLabel) + '</span>' +
+            (mc.without_holder_binding && mc.format === 'dc+sd-jwt' ? '<span class="badge badge-count" title="The verifier does not require holder binding; no KB-JWT is sent">no holder binding</span>' : '') +
           '</div>' +
           '<div class="consent-claims">';
 
-        const claims = mc.claims || {};
-        Object.keys(claims).forEach(key => {
-          const val = typeof claims[key] === 'object' ? JSON.stringify(claims[key]) : String(claims[key]);
+        // One checkbox per requested claims path, so nested members and
+        // array elements can be deselected individually.
+        const claims = stored.claims || mc.claims || {};
+        const paths = mc.selected_paths || Object.keys(mc.claims || {}).map(key => {
+          const i = key.lastIndexOf(':');
+          return mc.format === 'mso_mdoc' && i >= 0 ? [key.slice(0, i), key.slice(i + 1)] : [key];
+        });
+        const retained = (mc.retained_paths || []).map(p => JSON.stringify(p));
+        paths.forEach(path => {
+          const key = pathKey(mc.format, path);
+          const retain = retained.includes(JSON.stringify(path))
+            ? '<span class="badge badge-retain" title="The verifier intends to retain this claim (intent_to_retain)">retained</span>'
+            : '';
+          const val = pathValues(mc.format, claims, path)
+            .map(v => typeof v === 'object' ? JSON.stringify(v) : String(v))
+            .join(', ');
           html += '<label class="consent-claim">' +
-            '<input type="checkbox" checked data-cred="' + mc.credential_id + '" data-claim="' + escHtml(key) + '">' +
-            '<span class="consent-claim-name">' + escHtml(key) + '</span>' +
+            '<input type="checkbox" checked data-cred="' + mc.credential_id + '" data-path="' + escAttr(JSON.stringify(path)) + '">' +
+            '<span class="consent-claim-name" title="' + escAttr(key) + '">' + escHtml(claimLabel(display, key)) + '</span>' +
+            retain +
             '<span class="consent-claim-value">' + escHtml(val) + '</span>' +
           '</label>';
         });
@@ -336,14 +577,13 @@
     consentDialog.innerHTML = html;
 
     document.getElementById('consent-approve').addEventListener('click', async () => {
-      // Gather selected claims
+      // Gather selected claims paths
       const selected = {};
       consentDialog.querySelectorAll('input[type="checkbox"]').forEach(cb => {
+        const credId = cb.dataset.cred;
+        if (!selected[credId]) selected[credId] = [];
         if (cb.checked) {
-          const credId = cb.dataset.cred;
-          const claim = cb.dataset.claim;
-          if (!selected[credId]) selected[credId] = [];
-          selected[credId].push(claim);
+          selected[credId].push(JSON.parse(cb.dataset.path));
         }
       });
 
@@ -357,7 +597,7 @@
         const resp = await fetch('/api/requests/' + req.id + '/approve', {
           method: 'POST',
           headers: { 'Content-Type': 'application/json' },
-          body: JSON.stringify({ selected_claims: selected })
+          body: JSON.stringify({ selected_paths: selected })
         });
         const result = await resp.json();
         showSubmissionResult(result);
@@ -369,7 +609,13 @@
 
     document.getElementById('consent-deny').addEventListener('click', async () => {
       try {
-        await fetch('/api/requests/' + req.id + '/deny', { method: 'POST' });
+        const resp = await fetch('/api/requests/' + req.id + '/deny', { method: 'POST' });
+        const result = await resp.json();
+        // Follow the verifier's redirect after the access_denied error response
+        if (result.redirect_uri) {
+          window.location.href = result.redirect_uri;
+          return;
+        }
       } catch (e) {
         console.error('Deny failed:', e);
       }
@@ -384,8 +630,60 @@
     return div.innerHTML;
   }
 
+  function escAttr(s) {
+    return escHtml(s).replace(/"/g, '&quot;');
+  }
+
+  // claimLabel returns the issuer's label for a claim key, or the key itself.
+  function claimLabel(display, key) {
+    return (display.claim_labels && display.claim_labels[key]) || key;
+  }
+
+  // pathKey turns a claims path pointer into its claim_labels key:
+  // "namespace:element" for mDoc, otherwise the elements joined with "."
+  // and "*" for array wildcards.
+  function pathKey(format, path) {
+    const elems = path.map(e => e === null ? '*' : String(e));
+    if (format === 'mso_mdoc' && elems.length === 2) return elems[0] + ':' + elems[1];
+    return elems.join('.');
+  }
+
+  // pathValues returns the claim values a claims path pointer selects.
+  function pathValues(format, claims, path) {
+    let selected = [claims[path[0]]];
+    let rest = path.slice(1);
+    if (format === 'mso_mdoc') {
+      selected = [claims[path[0] + ':' + path[1]]];
+      rest = path.slice(2);
+    }
+    rest.forEach(elem => {
+      const next = [];
+      selected.forEach(v => {
+        if (elem === null) {
+          if (Array.isArray(v)) next.push(...v);
+        } else if (typeof elem === 'number') {
+          if (Array.isArray(v) && elem < v.length) next.push(v[elem]);
+        } else if (v && typeof v === 'object' && !Array.isArray(v) && elem in v) {
+          next.push(v[elem]);
+        }
+      });
+      selected = next;
+    });
+    return selected.filter(v => v !== undefined);
+  }
+
+  function isSafeImageURI(uri) {
+    return typeof uri === 'string' && (uri.startsWith('https://') || uri.startsWith('data:image/'));
+  }
+
+  function imageHTML(uri, alt, cls) {
+    if (!isSafeImageURI(uri)) return '';
+    return '<img class="' + cls + '" src="' + escAttr(uri) + '" alt="' + escAttr(alt) + '">';
+  }
+
   // Initialize
   loadCredentials();
+  loadPendingIssuances();
   loadLog();
   loadPendingRequests();
   connectSSE();
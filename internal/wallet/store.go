@@ -15,6 +15,7 @@
 package wallet
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/x509"
 	"encoding/json"
@@ -22,18 +23,21 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
-	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 )
 
 // WalletStore handles file-based persistence for the wallet.
 type WalletStore struct {
 	Dir string
+	Alg keys.Algorithm // algorithm of the holder and issuer keys; ES256 if empty
 }
 
 // walletJSON is the on-disk format of wallet.json.
 type walletJSON struct {
 	Credentials       []StoredCredential     `json:"credentials"`
+	PendingIssuances  []PendingIssuance      `json:"pending_issuances,omitempty"`
 	StatusEntries     map[string]StatusEntry `json:"status_entries,omitempty"`
 	StatusListCounter int                    `json:"status_list_counter,omitempty"`
 	Port              int                    `json:"port,omitempty"`
@@ -68,12 +72,39 @@ func (s *WalletStore) walletPath() string {
 
 // holderKeyPath returns the path to the holder private key.
 func (s *WalletStore) holderKeyPath() string {
-	return filepath.Join(s.Dir, "holder.pem")
+	return s.keyPath("holder")
 }
 
 // issuerKeyPath returns the path to the issuer private key.
 func (s *WalletStore) issuerKeyPath() string {
-	return filepath.Join(s.Dir, "issuer.pem")
+	return s.keyPath("issuer")
+}
+
+// keyPath returns the path to the holder or issuer key of the store's
+// algorithm. ES256 keys keep the plain file names, the others get a suffix;
+// RS256 and PS256 share one RSA key.
+func (s *WalletStore) keyPath(name string) string {
+	switch s.Alg {
+	case "", keys.ES256:
+		return filepath.Join(s.Dir, name+".pem")
+	case keys.RS256, keys.PS256:
+		return filepath.Join(s.Dir, name+"-rsa.pem")
+	default:
+		return filepath.Join(s.Dir, name+"-"+strings.ToLower(string(s.Alg))+".pem")
+	}
+}
+
+// algorithm returns the store's algorithm, ES256 if unset.
+func (s *WalletStore) algorithm() keys.Algorithm {
+	if s.Alg == "" {
+		return keys.ES256
+	}
+	return s.Alg
+}
+
+// dpopKeyPath returns the path to the DPoP private key.
+func (s *WalletStore) dpopKeyPath() string {
+	return filepath.Join(s.Dir, "dpop.pem")
 }
 
 // LoadOrCreate loads the wallet from disk, or creates a new empty wallet if none exists.
@@ -89,6 +120,20 @@ func (s *WalletStore) LoadOrCreate() (*Wallet, error) {
 	}
 
 	w := New(holderKey, issuerKey, false)
+	w.Alg = s.algorithm()
+	w.OtherHolderKeys = s.loadOtherHolderKeys()
+
+	// The DPoP key is persisted so DPoP-bound tokens of pending deferred
+	// issuances remain usable after a restart.
+	dpopKey, err := s.loadOrGenerateKey(s.dpopKeyPath(), "DPoP", keys.ES256)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := dpopKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("DPoP key: not an EC key")
+	}
+	w.DPoPKey = ecKey
 
 	data, err := os.ReadFile(s.walletPath())
 	if err != nil {
@@ -104,6 +149,7 @@ func (s *WalletStore) LoadOrCreate() (*Wallet, error) {
 	}
 
 	w.Credentials = wj.Credentials
+	w.PendingIssuances = wj.PendingIssuances
 	w.StatusEntries = wj.StatusEntries
 	w.StatusListCounter = wj.StatusListCounter
 
@@ -124,12 +170,14 @@ func (s *WalletStore) Save(w *Wallet) error {
 	}
 
 	creds := w.GetCredentials()
+	pending := w.GetPendingIssuances()
 	w.mu.RLock()
 	statusEntries := w.StatusEntries
 	statusListCounter := w.StatusListCounter
 	w.mu.RUnlock()
 	wj := walletJSON{
 		Credentials:       creds,
+		PendingIssuances:  pending,
 		StatusEntries:     statusEntries,
 		StatusListCounter: statusListCounter,
 	}
@@ -142,18 +190,19 @@ func (s *WalletStore) Save(w *Wallet) error {
 	return os.WriteFile(s.walletPath(), data, 0600)
 }
 
-// LoadOrCreateKeys loads holder and issuer keys from PEM files, generating them if they don't exist.
-func (s *WalletStore) LoadOrCreateKeys() (*ecdsa.PrivateKey, *ecdsa.PrivateKey, error) {
+// LoadOrCreateKeys loads holder and issuer keys from PEM files, generating
+// them for the store's algorithm if they don't exist.
+func (s *WalletStore) LoadOrCreateKeys() (crypto.Signer, crypto.Signer, error) {
 	if err := s.ensureDir(); err != nil {
 		return nil, nil, fmt.Errorf("creating wallet directory: %w", err)
 	}
 
-	holderKey, err := s.loadOrGenerateKey(s.holderKeyPath(), "holder")
+	holderKey, err := s.loadOrGenerateKey(s.holderKeyPath(), "holder", s.algorithm())
 	if err != nil {
 		return nil, nil, err
 	}
 
-	issuerKey, err := s.loadOrGenerateKey(s.issuerKeyPath(), "issuer")
+	issuerKey, err := s.loadOrGenerateKey(s.issuerKeyPath(), "issuer", s.algorithm())
 	if err != nil {
 		return nil, nil, err
 	}
@@ -161,8 +210,34 @@ func (s *WalletStore) LoadOrCreateKeys() (*ecdsa.PrivateKey, *ecdsa.PrivateKey,
 	return holderKey, issuerKey, nil
 }
 
-// loadOrGenerateKey loads a PEM key from path, or generates and saves a new one.
-func (s *WalletStore) loadOrGenerateKey(path, label string) (*ecdsa.PrivateKey, error) {
+// loadOtherHolderKeys loads the holder keys of the other algorithms that
+// exist on disk, so credentials bound to them can still be presented.
+func (s *WalletStore) loadOtherHolderKeys() []crypto.Signer {
+	seen := map[string]bool{s.holderKeyPath(): true}
+	var out []crypto.Signer
+	for _, alg := range keys.Algorithms {
+		path := (&WalletStore{Dir: s.Dir, Alg: alg}).holderKeyPath()
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		key, err := parsePEMKey(data, "holder")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			continue
+		}
+		out = append(out, key)
+	}
+	return out
+}
+
+// loadOrGenerateKey loads a PEM key from path, or generates a key for alg
+// and saves it.
+func (s *WalletStore) loadOrGenerateKey(path, label string, alg keys.Algorithm) (crypto.Signer, error) {
 	data, err := os.ReadFile(path)
 	if err == nil {
 		return parsePEMKey(data, label)
@@ -173,7 +248,7 @@ func (s *WalletStore) loadOrGenerateKey(path, label string) (*ecdsa.PrivateKey,
 	}
 
 	// Generate new key
-	key, err := mock.GenerateKey()
+	key, err := keys.GenerateKey(alg)
 	if err != nil {
 		return nil, fmt.Errorf("generating %s key: %w", label, err)
 	}
@@ -186,8 +261,8 @@ func (s *WalletStore) loadOrGenerateKey(path, label string) (*ecdsa.PrivateKey,
 	return key, nil
 }
 
-// parsePEMKey parses an EC private key from PEM data.
-func parsePEMKey(data []byte, label string) (*ecdsa.PrivateKey, error) {
+// parsePEMKey parses an EC, Ed25519 or RSA private key from PEM data.
+func parsePEMKey(data []byte, label string) (crypto.Signer, error) {
 	block, _ := pem.Decode(data)
 	if block == nil {
 		return nil, fmt.Errorf("%s key: no PEM block found", label)
@@ -196,10 +271,11 @@ func parsePEMKey(data []byte, label string) (*ecdsa.PrivateKey, error) {
 	// Try PKCS#8 first
 	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
 	if err == nil {
-		if ecKey, ok := key.(*ecdsa.PrivateKey); ok {
-			return ecKey, nil
+		signer, ok := key.(crypto.Signer)
+		if !ok || len(keys.KeyAlgorithms(signer.Public())) == 0 {
+			return nil, fmt.Errorf("%s key: unsupported key type %T", label, key)
 		}
-		return nil, fmt.Errorf("%s key: not an EC key", label)
+		return signer, nil
 	}
 
 	// Try EC key
@@ -210,17 +286,29 @@ func parsePEMKey(data []byte, label string) (*ecdsa.PrivateKey, error) {
 	return ecKey, nil
 }
 
-// saveKeyPEM saves an EC private key as a PEM file.
-func saveKeyPEM(path string, key *ecdsa.PrivateKey) error {
-	der, err := x509.MarshalECPrivateKey(key)
+// saveKeyPEM saves a private key as a PEM file.
+func saveKeyPEM(path string, key crypto.Signer) error {
+	data, err := encodeKeyPEM(key)
 	if err != nil {
-		return fmt.Errorf("marshaling key: %w", err)
+		return err
 	}
+	return os.WriteFile(path, data, 0600)
+}
 
-	block := &pem.Block{
-		Type:  "EC PRIVATE KEY",
-		Bytes: der,
+// encodeKeyPEM encodes an EC private key as an "EC PRIVATE KEY" PEM block and
+// other keys as PKCS#8 "PRIVATE KEY" blocks.
+func encodeKeyPEM(key crypto.Signer) ([]byte, error) {
+	if ecKey, ok := key.(*ecdsa.PrivateKey); ok {
+		der, err := x509.MarshalECPrivateKey(ecKey)
+		if err != nil {
+			return nil, fmt.Errorf("marshaling key: %w", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
 	}
 
-	return os.WriteFile(path, pem.EncodeToMemory(block), 0600)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
 }
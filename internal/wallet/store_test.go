@@ -15,12 +15,16 @@
 package wallet
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
 )
 
@@ -100,6 +104,67 @@ func TestWalletStore_SaveAndLoad(t *testing.T) {
 	}
 }
 
+func TestWalletStore_SaveAndLoad_CredentialInstances(t *testing.T) {
+	dir := t.TempDir()
+	store := NewWalletStore(dir)
+
+	w, err := store.LoadOrCreate()
+	if err != nil {
+		t.Fatalf("LoadOrCreate: %v", err)
+	}
+
+	var raws []string
+	var holderKeys []crypto.Signer
+	for i := 0; i < 2; i++ {
+		holderKey, _ := mock.GenerateKey()
+		raw, err := mock.GenerateSDJWT(mock.SDJWTConfig{
+			Issuer:    "https://test.example",
+			VCT:       "TestCred",
+			ExpiresIn: 24 * time.Hour,
+			Claims:    map[string]any{"name": "Test"},
+			Key:       w.IssuerKey,
+			HolderKey: &holderKey.PublicKey,
+		})
+		if err != nil {
+			t.Fatalf("generating SD-JWT: %v", err)
+		}
+		raws = append(raws, raw)
+		holderKeys = append(holderKeys, holderKey)
+	}
+	imported, err := w.ImportCredentialBatch(raws, holderKeys)
+	if err != nil {
+		t.Fatalf("ImportCredentialBatch: %v", err)
+	}
+	sel, err := w.selectInstance(imported.ID)
+	if err != nil {
+		t.Fatalf("selectInstance: %v", err)
+	}
+	w.markInstanceUsed(imported.ID, sel.index)
+
+	if err := store.Save(w); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	w2, err := store.LoadOrCreate()
+	if err != nil {
+		t.Fatalf("LoadOrCreate after save: %v", err)
+	}
+
+	cred, ok := w2.GetCredential(imported.ID)
+	if !ok {
+		t.Fatal("expected credential after reload")
+	}
+	if len(cred.Instances) != 2 || cred.UnusedInstances() != 1 {
+		t.Fatalf("expected 2 instances with 1 unused, got %d (%d unused)", len(cred.Instances), cred.UnusedInstances())
+	}
+	sel, err = w2.selectInstance(imported.ID)
+	if err != nil {
+		t.Fatalf("selectInstance after reload: %v", err)
+	}
+	if !holderKeys[1].(*ecdsa.PrivateKey).Equal(sel.key) {
+		t.Error("expected second instance to be bound to its own holder key")
+	}
+}
+
 func TestWalletStore_KeyPersistence(t *testing.T) {
 	dir := t.TempDir()
 	store := NewWalletStore(dir)
@@ -115,12 +180,85 @@ func TestWalletStore_KeyPersistence(t *testing.T) {
 		t.Fatalf("LoadOrCreate second time: %v", err)
 	}
 
-	if !w1.HolderKey.Equal(w2.HolderKey) {
+	if !w1.HolderKey.(*ecdsa.PrivateKey).Equal(w2.HolderKey) {
 		t.Error("expected same holder key across loads")
 	}
-	if !w1.IssuerKey.Equal(w2.IssuerKey) {
+	if !w1.IssuerKey.(*ecdsa.PrivateKey).Equal(w2.IssuerKey) {
 		t.Error("expected same issuer key across loads")
 	}
+	if w1.DPoPKey == nil || !w1.DPoPKey.Equal(w2.DPoPKey) {
+		t.Error("expected same DPoP key across loads")
+	}
+	if w1.DPoPKey.Equal(w1.HolderKey) {
+		t.Error("expected DPoP key to differ from holder key")
+	}
+}
+
+func TestWalletStore_AlgorithmKeys(t *testing.T) {
+	dir := t.TempDir()
+	store := NewWalletStore(dir)
+	w1, err := store.LoadOrCreate()
+	if err != nil {
+		t.Fatalf("LoadOrCreate: %v", err)
+	}
+	if err := w1.GenerateDefaultCredentials(nil, ""); err != nil {
+		t.Fatalf("GenerateDefaultCredentials: %v", err)
+	}
+	if err := store.Save(w1); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	edStore := &WalletStore{Dir: dir, Alg: keys.EdDSA}
+	w2, err := edStore.LoadOrCreate()
+	if err != nil {
+		t.Fatalf("LoadOrCreate with EdDSA: %v", err)
+	}
+	if _, ok := w2.HolderKey.(ed25519.PrivateKey); !ok {
+		t.Fatalf("expected an Ed25519 holder key, got %T", w2.HolderKey)
+	}
+	if _, ok := w2.IssuerKey.(ed25519.PrivateKey); !ok {
+		t.Fatalf("expected an Ed25519 issuer key, got %T", w2.IssuerKey)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "holder-eddsa.pem")); err != nil {
+		t.Errorf("expected holder-eddsa.pem: %v", err)
+	}
+	if w2.DPoPKey == nil || !w2.DPoPKey.Equal(w1.DPoPKey) {
+		t.Error("expected the DPoP key to be shared across algorithms")
+	}
+
+	// Credentials bound to the ES256 holder key stay presentable.
+	if len(w2.OtherHolderKeys) != 1 || !w1.HolderKey.(*ecdsa.PrivateKey).Equal(w2.OtherHolderKeys[0]) {
+		t.Fatalf("expected the ES256 holder key in OtherHolderKeys, got %d keys", len(w2.OtherHolderKeys))
+	}
+	for _, cred := range w2.GetCredentials() {
+		sel, err := w2.selectInstance(cred.ID)
+		if err != nil {
+			t.Fatalf("selectInstance: %v", err)
+		}
+		if !w1.HolderKey.(*ecdsa.PrivateKey).Equal(sel.key) {
+			t.Errorf("%s credential: expected the ES256 holder key, got %T", cred.Format, sel.key)
+		}
+	}
+}
+
+func TestWalletStore_KeyPathPerAlgorithm(t *testing.T) {
+	tests := []struct {
+		alg  keys.Algorithm
+		want string
+	}{
+		{"", "/tmp/test-wallet/holder.pem"},
+		{keys.ES256, "/tmp/test-wallet/holder.pem"},
+		{keys.ES384, "/tmp/test-wallet/holder-es384.pem"},
+		{keys.EdDSA, "/tmp/test-wallet/holder-eddsa.pem"},
+		{keys.RS256, "/tmp/test-wallet/holder-rsa.pem"},
+		{keys.PS256, "/tmp/test-wallet/holder-rsa.pem"},
+	}
+	for _, tt := range tests {
+		store := &WalletStore{Dir: "/tmp/test-wallet", Alg: tt.alg}
+		if got := store.holderKeyPath(); got != tt.want {
+			t.Errorf("holderKeyPath() with %q = %s, want %s", tt.alg, got, tt.want)
+		}
+	}
 }
 
 func TestNewWalletStore_DefaultDir(t *testing.T) {
@@ -141,6 +279,9 @@ func TestWalletStore_PathHelpers(t *testing.T) {
 	if store.issuerKeyPath() != "/tmp/test-wallet/issuer.pem" {
 		t.Errorf("wrong issuer key path: %s", store.issuerKeyPath())
 	}
+	if store.dpopKeyPath() != "/tmp/test-wallet/dpop.pem" {
+		t.Errorf("wrong DPoP key path: %s", store.dpopKeyPath())
+	}
 }
 
 func TestDefaultWalletDir(t *testing.T) {
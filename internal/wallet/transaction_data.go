@@ -0,0 +1,145 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+)
+
+// transactionDataHashAlg is the only hash algorithm the wallet uses for
+// transaction_data_hashes, and the default when a request names none.
+const transactionDataHashAlg = "sha-256"
+
+// TransactionData is a decoded transaction_data entry of an authorization
+// request (OID4VP 1.0 Section 5.1).
+type TransactionData struct {
+	Raw           string         `json:"raw"` // base64url-encoded entry as received; presentations bind its hash
+	Type          string         `json:"type"`
+	CredentialIDs []string       `json:"credential_ids"`
+	Content       map[string]any `json:"content"` // the whole decoded object
+}
+
+// DecodeTransactionData decodes the transaction_data entries of a request.
+// Entries that are not a base64url-encoded JSON object are skipped;
+// ValidateTransactionData reports them.
+func DecodeTransactionData(entries []string) []TransactionData {
+	var result []TransactionData
+	for _, raw := range entries {
+		obj, err := decodeTransactionDataEntry(raw)
+		if err != nil {
+			continue
+		}
+		td := TransactionData{Raw: raw, Content: obj}
+		td.Type, _ = obj["type"].(string)
+		ids, _ := obj["credential_ids"].([]any)
+		for _, id := range ids {
+			if s, ok := id.(string); ok {
+				td.CredentialIDs = append(td.CredentialIDs, s)
+			}
+		}
+		result = append(result, td)
+	}
+	return result
+}
+
+func decodeTransactionDataEntry(raw string) (map[string]any, error) {
+	data, err := format.DecodeBase64URL(raw)
+	if err != nil {
+		return nil, fmt.Errorf("not base64url-encoded: %w", err)
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("not a JSON object: %w", err)
+	}
+	return obj, nil
+}
+
+// ValidateTransactionData checks each transaction_data entry and returns
+// human-readable findings. Every entry needs a type and credential_ids that
+// reference credential queries of the DCQL query which require holder
+// binding, since the hashes are bound into the holder's signature. If the
+// request names hash algorithms, sha-256 has to be one of them.
+func ValidateTransactionData(entries []string, dcqlQuery map[string]any) []string {
+	queries := make(map[string]map[string]any)
+	credentials, _ := dcqlQuery["credentials"].([]any)
+	for _, c := range credentials {
+		if cq, ok := c.(map[string]any); ok {
+			if id, ok := cq["id"].(string); ok {
+				queries[id] = cq
+			}
+		}
+	}
+
+	var findings []string
+	for i, raw := range entries {
+		label := fmt.Sprintf("transaction_data[%d]", i)
+		obj, err := decodeTransactionDataEntry(raw)
+		if err != nil {
+			findings = append(findings, fmt.Sprintf("%s is invalid: %v", label, err))
+			continue
+		}
+
+		if t, ok := obj["type"].(string); !ok || t == "" {
+			findings = append(findings, label+": type is required")
+		}
+
+		ids, ok := obj["credential_ids"].([]any)
+		if !ok || len(ids) == 0 {
+			findings = append(findings, label+": credential_ids must be a non-empty array")
+		}
+		for _, v := range ids {
+			id, ok := v.(string)
+			if !ok {
+				findings = append(findings, fmt.Sprintf("%s: credential_ids contains non-string value %v", label, v))
+				continue
+			}
+			cq, found := queries[id]
+			if !found {
+				findings = append(findings, fmt.Sprintf("%s: credential_ids references unknown credential query %q", label, id))
+				continue
+			}
+			if binding, ok := cq["require_cryptographic_holder_binding"].(bool); ok && !binding {
+				findings = append(findings, fmt.Sprintf("%s: credential query %q does not require holder binding, so the transaction data cannot be bound", label, id))
+			}
+		}
+
+		if v, present := obj["transaction_data_hashes_alg"]; present {
+			algs, _ := v.([]any)
+			if !slices.Contains(algs, any(transactionDataHashAlg)) {
+				findings = append(findings, fmt.Sprintf("%s: transaction_data_hashes_alg %v does not include %s, the only supported algorithm", label, v, transactionDataHashAlg))
+			}
+		}
+	}
+	return findings
+}
+
+// transactionDataHashes returns the SHA-256 hashes of the transaction data
+// entries, as received, that a presentation for the credential query queryID
+// has to bind, in request order.
+func transactionDataHashes(transactionData []TransactionData, queryID string) [][]byte {
+	var hashes [][]byte
+	for _, td := range transactionData {
+		if slices.Contains(td.CredentialIDs, queryID) {
+			sum := sha256.Sum256([]byte(td.Raw))
+			hashes = append(hashes, sum[:])
+		}
+	}
+	return hashes
+}
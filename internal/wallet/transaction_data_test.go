@@ -0,0 +1,222 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/sdjwt"
+)
+
+// encodeTransactionData encodes a transaction_data entry as a verifier would.
+func encodeTransactionData(t *testing.T, obj map[string]any) string {
+	t.Helper()
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return format.EncodeBase64URL(data)
+}
+
+func paymentTransactionData(t *testing.T, credentialIDs ...any) string {
+	t.Helper()
+	return encodeTransactionData(t, map[string]any{
+		"type":           "urn:eudi:sca:payment:1",
+		"credential_ids": credentialIDs,
+		"payload": map[string]any{
+			"payee":  "Merchant GmbH",
+			"amount": "42.00",
+		},
+	})
+}
+
+func TestValidateTransactionData(t *testing.T) {
+	query := map[string]any{
+		"credentials": []any{
+			map[string]any{"id": "pid", "format": "dc+sd-jwt"},
+			map[string]any{"id": "unbound", "format": "dc+sd-jwt", "require_cryptographic_holder_binding": false},
+		},
+	}
+	tests := []struct {
+		name  string
+		entry map[string]any
+		want  string
+	}{
+		{"valid", map[string]any{"type": "payment", "credential_ids": []any{"pid"}}, ""},
+		{"supported hash alg", map[string]any{"type": "payment", "credential_ids": []any{"pid"}, "transaction_data_hashes_alg": []any{"sha-512", "sha-256"}}, ""},
+		{"missing type", map[string]any{"credential_ids": []any{"pid"}}, "transaction_data[0]: type is required"},
+		{"missing credential_ids", map[string]any{"type": "payment"}, "transaction_data[0]: credential_ids must be a non-empty array"},
+		{"unknown credential query", map[string]any{"type": "payment", "credential_ids": []any{"mdl"}}, `transaction_data[0]: credential_ids references unknown credential query "mdl"`},
+		{"no holder binding", map[string]any{"type": "payment", "credential_ids": []any{"unbound"}}, `transaction_data[0]: credential query "unbound" does not require holder binding, so the transaction data cannot be bound`},
+		{"unsupported hash alg", map[string]any{"type": "payment", "credential_ids": []any{"pid"}, "transaction_data_hashes_alg": []any{"sha-512"}}, "transaction_data[0]: transaction_data_hashes_alg [sha-512] does not include sha-256, the only supported algorithm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := ValidateTransactionData([]string{encodeTransactionData(t, tt.entry)}, query)
+			if got := strings.Join(findings, "; "); got != tt.want {
+				t.Errorf("findings = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	findings := ValidateTransactionData([]string{"not-json"}, query)
+	if len(findings) != 1 || !strings.HasPrefix(findings[0], "transaction_data[0] is invalid") {
+		t.Errorf("expected an undecodable entry to be reported, got %v", findings)
+	}
+}
+
+func TestDecodeTransactionData(t *testing.T) {
+	raw := paymentTransactionData(t, "pid")
+	got := DecodeTransactionData([]string{"%%%", raw})
+	if len(got) != 1 {
+		t.Fatalf("expected the undecodable entry to be skipped, got %d entries", len(got))
+	}
+	if got[0].Raw != raw || got[0].Type != "urn:eudi:sca:payment:1" || !reflect.DeepEqual(got[0].CredentialIDs, []string{"pid"}) {
+		t.Errorf("unexpected transaction data: %+v", got[0])
+	}
+	if payload, _ := got[0].Content["payload"].(map[string]any); payload["payee"] != "Merchant GmbH" {
+		t.Errorf("expected the decoded content, got %v", got[0].Content)
+	}
+}
+
+func TestCreateVPToken_SDJWT_TransactionData(t *testing.T) {
+	w := generateTestWalletWithPID(t)
+	cred := pidSDJWT(t, w)
+	payment := paymentTransactionData(t, "pid")
+	other := paymentTransactionData(t, "mdl")
+
+	result, err := w.CreateVPToken(CredentialMatch{
+		QueryID:       "pid",
+		CredentialID:  cred.ID,
+		Format:        cred.Format,
+		SelectedPaths: [][]any{{"given_name"}},
+	}, PresentationParams{
+		Nonce:           "n",
+		ClientID:        "client",
+		ResponseURI:     "response",
+		TransactionData: DecodeTransactionData([]string{payment, other}),
+	})
+	if err != nil {
+		t.Fatalf("CreateVPToken error: %v", err)
+	}
+	parsed, err := sdjwt.Parse(result.Token)
+	if err != nil {
+		t.Fatalf("parsing VP token: %v", err)
+	}
+	if parsed.KeyBindingJWT == nil {
+		t.Fatal("expected a KB-JWT")
+	}
+
+	sum := sha256.Sum256([]byte(payment))
+	want := []any{format.EncodeBase64URL(sum[:])}
+	if got := parsed.KeyBindingJWT.Payload["transaction_data_hashes"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("transaction_data_hashes = %v, want %v", got, want)
+	}
+	if alg := parsed.KeyBindingJWT.Payload["transaction_data_hashes_alg"]; alg != "sha-256" {
+		t.Errorf("transaction_data_hashes_alg = %v, want sha-256", alg)
+	}
+}
+
+func TestCreateVPToken_MDoc_TransactionData(t *testing.T) {
+	w := generateTestWalletWithPID(t)
+	var cred StoredCredential
+	for _, c := range w.GetCredentials() {
+		if c.Format == "mso_mdoc" {
+			cred = c
+		}
+	}
+	payment := paymentTransactionData(t, "pid_mdoc")
+
+	result, err := w.CreateVPToken(CredentialMatch{
+		QueryID:      "pid_mdoc",
+		CredentialID: cred.ID,
+		Format:       cred.Format,
+		SelectedKeys: []string{cred.DocType + ":given_name"},
+	}, PresentationParams{
+		Nonce:           "n",
+		ClientID:        "client",
+		ResponseURI:     "response",
+		TransactionData: DecodeTransactionData([]string{payment}),
+	})
+	if err != nil {
+		t.Fatalf("CreateVPToken error: %v", err)
+	}
+
+	raw, err := format.DecodeBase64URL(result.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var response struct {
+		Documents []struct {
+			DeviceSigned struct {
+				NameSpaces cbor.RawMessage            `cbor:"nameSpaces"`
+				DeviceAuth map[string]cbor.RawMessage `cbor:"deviceAuth"`
+			} `cbor:"deviceSigned"`
+		} `cbor:"documents"`
+	}
+	if err := cbor.Unmarshal(raw, &response); err != nil {
+		t.Fatalf("decoding DeviceResponse: %v", err)
+	}
+	deviceSigned := response.Documents[0].DeviceSigned
+
+	var tag cbor.Tag
+	if err := cbor.Unmarshal(deviceSigned.NameSpaces, &tag); err != nil || tag.Number != 24 {
+		t.Fatalf("expected DeviceNameSpacesBytes tagged 24, got %v (%v)", tag.Number, err)
+	}
+	nsBytes, _ := tag.Content.([]byte)
+	var nameSpaces map[string]map[string]any
+	if err := cbor.Unmarshal(nsBytes, &nameSpaces); err != nil {
+		t.Fatalf("decoding DeviceNameSpaces: %v", err)
+	}
+	items := nameSpaces[cred.DocType]
+	sum := sha256.Sum256([]byte(payment))
+	if hashes, _ := items["transaction_data_hashes"].([]any); len(hashes) != 1 || !bytes.Equal(toBytes(hashes[0]), sum[:]) {
+		t.Errorf("transaction_data_hashes = %v, want [%x]", items["transaction_data_hashes"], sum)
+	}
+	if items["transaction_data_hashes_alg"] != "sha-256" {
+		t.Errorf("transaction_data_hashes_alg = %v, want sha-256", items["transaction_data_hashes_alg"])
+	}
+
+	// DeviceAuth signs the same DeviceNameSpacesBytes.
+	var msg cose.Sign1Message
+	if err := msg.UnmarshalCBOR(deviceSigned.DeviceAuth["deviceSignature"]); err != nil {
+		t.Fatalf("decoding deviceSignature: %v", err)
+	}
+	var payloadTag cbor.Tag
+	if err := cbor.Unmarshal(msg.Payload, &payloadTag); err != nil {
+		t.Fatal(err)
+	}
+	var deviceAuthentication []cbor.RawMessage
+	if err := cbor.Unmarshal(payloadTag.Content.([]byte), &deviceAuthentication); err != nil {
+		t.Fatal(err)
+	}
+	if len(deviceAuthentication) != 4 || !bytes.Equal(deviceAuthentication[3], deviceSigned.NameSpaces) {
+		t.Error("DeviceAuthentication does not contain the device-signed namespaces")
+	}
+}
+
+func toBytes(v any) []byte {
+	b, _ := v.([]byte)
+	return b
+}
@@ -15,22 +15,18 @@
 package wallet
 
 import (
-	"crypto/ecdsa"
-	"crypto/rand"
-	"crypto/sha256"
+	"crypto"
 	"crypto/x509"
 	"encoding/base64"
-	"encoding/json"
-	"fmt"
 	"time"
 
-	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
 )
 
 // GenerateTrustListJWT generates an ETSI TS 119 602 trust list JWT
 // containing the CA certificate as the trust anchor. The trust list is
-// signed with the provided signing key.
-func GenerateTrustListJWT(signingKey *ecdsa.PrivateKey, caCert *x509.Certificate) (string, error) {
+// signed with the provided signing key and its default algorithm.
+func GenerateTrustListJWT(signingKey crypto.Signer, caCert *x509.Certificate) (string, error) {
 	certB64 := base64.StdEncoding.EncodeToString(caCert.Raw)
 
 	// Build ETSI trust list payload
@@ -69,41 +65,14 @@ func GenerateTrustListJWT(signingKey *ecdsa.PrivateKey, caCert *x509.Certificate
 		},
 	}
 
-	// Build JWT header
-	header := map[string]any{
-		"alg": "ES256",
-		"typ": "JWT",
-	}
-
-	headerJSON, err := json.Marshal(header)
+	alg, err := keys.AlgorithmFor(signingKey.Public(), "")
 	if err != nil {
-		return "", fmt.Errorf("marshaling header: %w", err)
+		return "", err
 	}
-	payloadJSON, err := json.Marshal(payload)
-	if err != nil {
-		return "", fmt.Errorf("marshaling payload: %w", err)
-	}
-
-	headerB64 := format.EncodeBase64URL(headerJSON)
-	payloadB64 := format.EncodeBase64URL(payloadJSON)
-
-	// Sign with ECDSA (JWS r||s format)
-	sigInput := headerB64 + "." + payloadB64
-	h := sha256.Sum256([]byte(sigInput))
-
-	r, s, err := ecdsa.Sign(rand.Reader, signingKey, h[:])
-	if err != nil {
-		return "", fmt.Errorf("signing: %w", err)
+	header := map[string]any{
+		"alg": string(alg),
+		"typ": "JWT",
 	}
 
-	keySize := (signingKey.Curve.Params().BitSize + 7) / 8
-	rBytes := r.Bytes()
-	sBytes := s.Bytes()
-	sig := make([]byte, 2*keySize)
-	copy(sig[keySize-len(rBytes):keySize], rBytes)
-	copy(sig[2*keySize-len(sBytes):], sBytes)
-
-	sigB64 := format.EncodeBase64URL(sig)
-
-	return headerB64 + "." + payloadB64 + "." + sigB64, nil
+	return signJWT(header, payload, signingKey)
 }
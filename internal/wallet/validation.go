@@ -15,29 +15,70 @@
 package wallet
 
 import (
-	"fmt"
+	"crypto/x509"
 	"strings"
 
 	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
 )
 
-// ValidatePresentationRequest evaluates client_id, request-object metadata, and signature checks.
-// In debug mode findings are returned as warnings; in strict mode any finding is fatal.
-func ValidatePresentationRequest(mode ValidationMode, clientID string, reqObj *oid4vc.RequestObjectJWT, responseURI string) ([]string, error) {
-	var findings []string
+// RequestValidationError is the strict mode error of ValidatePresentationRequest,
+// with the OID4VP error code the wallet responds with.
+type RequestValidationError struct {
+	Code     string // invalid_client, invalid_transaction_data, vp_formats_not_supported, or invalid_request
+	Findings []string
+}
+
+func (e *RequestValidationError) Error() string {
+	return "authorization request validation failed: " + strings.Join(e.Findings, "; ")
+}
 
-	if finding := VerifyClientID(clientID, reqObj, responseURI); finding != "" {
-		findings = append(findings, finding)
+// ValidatePresentationRequest evaluates client_id, request-object metadata, signature, DCQL
+// query, transaction data, and vp_formats_supported checks. In debug mode findings are returned as warnings; in strict mode any
+// finding is fatal, and the error is a *RequestValidationError. trustAnchors are the OpenID Federation
+// trust anchors for openid_federation: client IDs. Once the trust chain and the Request Object
+// signature of such a client ID verify, the federation's metadata replaces client_metadata.
+// registrarCAs are the trust anchors of verifier_info registration certificates.
+func ValidatePresentationRequest(mode ValidationMode, clientID string, reqObj *oid4vc.RequestObjectJWT, responseURI string, dcqlQuery map[string]any, transactionData []string, verifierInfo []map[string]any, trustAnchors []string, registrarCAs []*x509.Certificate) ([]string, error) {
+	var clientFindings []string
+	fed, clientIDFinding := VerifyClientID(clientID, reqObj, responseURI, trustAnchors)
+	if clientIDFinding != "" {
+		clientFindings = append(clientFindings, clientIDFinding)
 	}
 	if finding := ValidateRequestObject(clientID, reqObj); finding != "" {
-		findings = append(findings, finding)
+		clientFindings = append(clientFindings, finding)
 	}
-	if finding := VerifyRequestObjectSignature(reqObj); finding != "" {
-		findings = append(findings, finding)
+	signatureFinding := VerifyRequestObjectSignature(reqObj, fed)
+	if signatureFinding != "" {
+		clientFindings = append(clientFindings, signatureFinding)
 	}
+	if strings.HasPrefix(clientID, "openid_federation:") && reqObj != nil {
+		if fed != nil && signatureFinding == "" {
+			ApplyFederationMetadata(reqObj, fed)
+		} else {
+			clientFindings = append(clientFindings, "openid_federation: client_metadata is not vouched for by a trust chain; using the Request Object's own")
+		}
+	}
+	dcqlFindings := ValidateDCQLQuery(dcqlQuery)
+	txFindings := ValidateTransactionData(transactionData, dcqlQuery)
+	verifierInfoFindings := ValidateVerifierInfo(verifierInfo, dcqlQuery, registrarCAs)
+	vpFormatsFindings := ValidateVPFormats(reqObj)
+
+	var findings []string
+	findings = append(findings, clientFindings...)
+	findings = append(findings, dcqlFindings...)
+	findings = append(findings, txFindings...)
+	findings = append(findings, verifierInfoFindings...)
+	findings = append(findings, vpFormatsFindings...)
 
 	if mode == ValidationModeStrict && len(findings) > 0 {
-		return nil, fmt.Errorf("authorization request validation failed: %s", strings.Join(findings, "; "))
+		code := ErrorInvalidRequest
+		switch {
+		case len(clientFindings) > 0:
+			code = ErrorInvalidClient
+		case len(txFindings) == len(findings):
+			code = ErrorInvalidTransactionData
+		}
+		return nil, &RequestValidationError{Code: code, Findings: findings}
 	}
 
 	return findings, nil
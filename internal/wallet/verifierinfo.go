@@ -0,0 +1,412 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/jsonutil"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
+	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
+)
+
+// registrationCertificateFormat is the verifier_info format of relying party
+// registration certificates. Entries of other formats whose data is a JWT of
+// one of registrationCertificateTypes are recognized as well.
+const registrationCertificateFormat = "registration_cert"
+
+var registrationCertificateTypes = []string{"rc-rp+jwt", "rc-wrp+jwt"}
+
+// VerifierInfo is what the verifier_info attestations and the access
+// certificate of a request say about the verifier, as shown on the consent
+// screen. The registration attributes come only from registration
+// certificates whose x5c chain leads to a registrar trust anchor; Unverified
+// lists why the others were ignored.
+type VerifierInfo struct {
+	Name              string             `json:"name,omitempty"`
+	Registrar         string             `json:"registrar,omitempty"` // issuer of the registration certificate
+	IntendedUse       []string           `json:"intended_use,omitempty"`
+	PrivacyPolicy     string             `json:"privacy_policy,omitempty"`
+	Entitlements      []string           `json:"entitlements,omitempty"`
+	Credentials       []map[string]any   `json:"credentials,omitempty"` // registered credential queries (DCQL syntax)
+	AccessCertificate *AccessCertificate `json:"access_certificate,omitempty"`
+	Formats           []string           `json:"formats,omitempty"`    // formats of the verifier_info entries
+	Overasked         []string           `json:"overasked,omitempty"`  // requested claims the registration does not entitle
+	Unverified        []string           `json:"unverified,omitempty"` // registration certificates ignored as unverified, with the reason
+}
+
+// AccessCertificate holds the attributes of the relying party access
+// certificate, the leaf of the request object's x5c chain.
+type AccessCertificate struct {
+	Subject      string `json:"subject"`
+	Organization string `json:"organization,omitempty"`
+	Issuer       string `json:"issuer"`
+}
+
+// registrationCertificate is a decoded registration certificate with the
+// credential queries its verifier_info entry applies to (all if empty).
+// unverified is why it is not trusted, empty once its signature and x5c chain
+// verify against a registrar trust anchor.
+type registrationCertificate struct {
+	payload       map[string]any
+	credentialIDs []string
+	unverified    string
+}
+
+// ParseVerifierInfo collects the registration certificates of the
+// verifier_info entries and the access certificate of the request object for
+// the consent screen, and the requested claims the registration does not
+// entitle. Only registration certificates trusted via registrarCAs are used.
+// Returns nil if the request has neither.
+func ParseVerifierInfo(entries []map[string]any, reqObj *oid4vc.RequestObjectJWT, dcqlQuery map[string]any, registrarCAs []*x509.Certificate) *VerifierInfo {
+	info := &VerifierInfo{}
+	if certs, _ := extractCertChain(reqObj); len(certs) > 0 {
+		info.AccessCertificate = &AccessCertificate{
+			Subject:      certs[0].Subject.String(),
+			Organization: strings.Join(certs[0].Subject.Organization, ", "),
+			Issuer:       certs[0].Issuer.String(),
+		}
+	}
+	if len(entries) == 0 && info.AccessCertificate == nil {
+		return nil
+	}
+
+	for _, entry := range entries {
+		info.Formats = append(info.Formats, jsonutil.GetString(entry, "format"))
+	}
+	rcs, _ := registrationCertificates(entries, registrarCAs)
+	for _, rc := range rcs {
+		if rc.unverified != "" {
+			info.Unverified = append(info.Unverified, rc.unverified)
+			continue
+		}
+		if info.Name == "" {
+			info.Name = jsonutil.GetString(rc.payload, "name")
+		}
+		if info.Registrar == "" {
+			info.Registrar = jsonutil.GetString(rc.payload, "iss")
+		}
+		if info.PrivacyPolicy == "" {
+			info.PrivacyPolicy = jsonutil.GetString(rc.payload, "privacy_policy")
+		}
+		info.IntendedUse = append(info.IntendedUse, localizedValues(rc.payload["purpose"])...)
+		info.Entitlements = append(info.Entitlements, stringValues(rc.payload["entitlements"])...)
+		for _, c := range jsonutil.GetArray(rc.payload, "credentials") {
+			if cred, ok := c.(map[string]any); ok {
+				info.Credentials = append(info.Credentials, cred)
+			}
+		}
+		info.Overasked = append(info.Overasked, checkEntitlements(dcqlQuery, rc)...)
+	}
+	return info
+}
+
+// ValidateVerifierInfo checks the verifier_info entries of a request and
+// returns human-readable findings: every entry needs a format and data, and
+// its credential_ids must reference credential queries of the DCQL query.
+// Registration certificates must be decodable, unexpired, validly signed by
+// the leaf of their x5c chain, and that chain must lead to one of
+// registrarCAs. Every requested claim must be one the verifier is registered
+// for by a trusted registration certificate.
+func ValidateVerifierInfo(entries []map[string]any, dcqlQuery map[string]any, registrarCAs []*x509.Certificate) []string {
+	var findings []string
+	queryIDs := dcqlQueryIDs(dcqlQuery)
+	for i, entry := range entries {
+		label := fmt.Sprintf("verifier_info[%d]", i)
+		if jsonutil.GetString(entry, "format") == "" {
+			findings = append(findings, label+": format is required")
+		}
+		if entry["data"] == nil {
+			findings = append(findings, label+": data is required")
+		}
+		for _, id := range stringValues(entry["credential_ids"]) {
+			if !queryIDs[id] {
+				findings = append(findings, fmt.Sprintf("%s: credential_ids references unknown credential query %q", label, id))
+			}
+		}
+	}
+
+	rcs, rcFindings := registrationCertificates(entries, registrarCAs)
+	findings = append(findings, rcFindings...)
+	for _, rc := range rcs {
+		if rc.unverified == "" {
+			findings = append(findings, checkEntitlements(dcqlQuery, rc)...)
+		}
+	}
+	return findings
+}
+
+// registrationCertificates decodes the registration certificates among the
+// verifier_info entries, with findings for those that cannot be used or
+// trusted. JSON object certificates are unsigned and never trusted.
+func registrationCertificates(entries []map[string]any, registrarCAs []*x509.Certificate) ([]registrationCertificate, []string) {
+	var rcs []registrationCertificate
+	var findings []string
+	for i, entry := range entries {
+		label := fmt.Sprintf("verifier_info[%d]", i)
+		isRC := jsonutil.GetString(entry, "format") == registrationCertificateFormat
+
+		var payload map[string]any
+		var unverified string
+		switch data := entry["data"].(type) {
+		case map[string]any:
+			if !isRC {
+				continue
+			}
+			unverified = "it is not signed, so its registration is self-asserted"
+			payload = data
+		case string:
+			header, p, _, err := format.ParseJWTParts(data)
+			if err != nil {
+				if isRC {
+					findings = append(findings, fmt.Sprintf("%s: registration certificate is not a JWT: %v", label, err))
+				}
+				continue
+			}
+			if !isRC && !slices.Contains(registrationCertificateTypes, jsonutil.GetString(header, "typ")) {
+				continue
+			}
+			unverified = verifyRegistrationCertificate(data, header, registrarCAs)
+			payload = p
+		default:
+			continue
+		}
+
+		if unverified != "" {
+			unverified = fmt.Sprintf("%s: registration certificate is unverified: %s", label, unverified)
+			findings = append(findings, unverified)
+		}
+		if exp, ok := jsonutil.GetFloat64(payload, "exp"); ok && time.Unix(int64(exp), 0).Before(time.Now()) {
+			findings = append(findings, fmt.Sprintf("%s: registration certificate expired at %s", label, time.Unix(int64(exp), 0).UTC().Format(time.RFC3339)))
+		}
+		rcs = append(rcs, registrationCertificate{
+			payload:       payload,
+			credentialIDs: stringValues(entry["credential_ids"]),
+			unverified:    unverified,
+		})
+	}
+	return rcs, findings
+}
+
+// verifyRegistrationCertificate checks the signature of a registration
+// certificate JWT with the leaf of its x5c chain, and the chain against the
+// registrar trust anchors. Without x5c, the registrar's key is unknown.
+func verifyRegistrationCertificate(raw string, header map[string]any, registrarCAs []*x509.Certificate) string {
+	x5c := jsonutil.GetArray(header, "x5c")
+	if len(x5c) == 0 {
+		return "it has no x5c chain, so its registrar cannot be identified"
+	}
+	var certs []*x509.Certificate
+	for i, c := range x5c {
+		b64, _ := c.(string)
+		der, err := format.DecodeBase64Std(b64)
+		if err != nil {
+			return fmt.Sprintf("failed to decode x5c[%d]: %v", i, err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Sprintf("failed to parse x5c[%d]: %v", i, err)
+		}
+		certs = append(certs, cert)
+	}
+
+	parts := strings.Split(raw, ".")
+	sig, err := format.DecodeBase64URL(parts[2])
+	if err != nil {
+		return fmt.Sprintf("failed to decode signature: %v", err)
+	}
+	if err := keys.VerifyJWS(certs[0].PublicKey, keys.Algorithm(jsonutil.GetString(header, "alg")), []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return fmt.Sprintf("signature verification failed: %v", err)
+	}
+
+	if len(registrarCAs) == 0 {
+		return "no registrar trust anchors are configured to validate its x5c chain (--registrar-ca)"
+	}
+	roots := x509.NewCertPool()
+	for _, ca := range registrarCAs {
+		roots.AddCert(ca)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Sprintf("x5c chain does not lead to a registrar trust anchor: %v", err)
+	}
+	return ""
+}
+
+// checkEntitlements returns a finding for every credential query and claim of
+// the DCQL query that the credentials of a registration certificate do not
+// entitle the verifier to request. A registered credential entitles requests
+// of the same format and type (vct_values, doctype_value), and its claims
+// paths cover the claims below them; without claims, it covers all claims.
+// Registration certificates without credentials are not checked.
+func checkEntitlements(dcqlQuery map[string]any, rc registrationCertificate) []string {
+	registered := jsonutil.GetArray(rc.payload, "credentials")
+	if len(registered) == 0 {
+		return nil
+	}
+
+	var findings []string
+	for _, c := range jsonutil.GetArray(dcqlQuery, "credentials") {
+		cq, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		id := jsonutil.GetString(cq, "id")
+		if len(rc.credentialIDs) > 0 && !slices.Contains(rc.credentialIDs, id) {
+			continue
+		}
+
+		var covering []map[string]any
+		for _, r := range registered {
+			if rcq, ok := r.(map[string]any); ok && registrationCovers(rcq, cq) {
+				covering = append(covering, rcq)
+			}
+		}
+		if len(covering) == 0 {
+			findings = append(findings, fmt.Sprintf("verifier_info: credential query %q requests %s, which the registration certificate does not entitle", id, dcqlTypeLabel(cq)))
+			continue
+		}
+
+		claims := jsonutil.GetArray(cq, "claims")
+		if len(claims) == 0 {
+			if !slices.ContainsFunc(covering, func(rcq map[string]any) bool { return len(jsonutil.GetArray(rcq, "claims")) == 0 }) {
+				findings = append(findings, fmt.Sprintf("verifier_info: credential query %q requests all claims, but the registration certificate only entitles some", id))
+			}
+			continue
+		}
+		for _, cl := range claims {
+			claim, _ := cl.(map[string]any)
+			path := jsonutil.GetArray(claim, "path")
+			if !slices.ContainsFunc(covering, func(rcq map[string]any) bool { return registeredClaimsCover(rcq, path) }) {
+				pathJSON, _ := json.Marshal(path)
+				findings = append(findings, fmt.Sprintf("verifier_info: credential query %q requests claim %s, which the registration certificate does not entitle", id, pathJSON))
+			}
+		}
+	}
+	return findings
+}
+
+// registrationCovers reports whether a registered credential query covers the
+// format and credential type of a requested one.
+func registrationCovers(registered, requested map[string]any) bool {
+	if jsonutil.GetString(registered, "format") != jsonutil.GetString(requested, "format") {
+		return false
+	}
+	regMeta := jsonutil.GetMap(registered, "meta")
+	reqMeta := jsonutil.GetMap(requested, "meta")
+	if doctype := jsonutil.GetString(regMeta, "doctype_value"); doctype != "" && doctype != jsonutil.GetString(reqMeta, "doctype_value") {
+		return false
+	}
+	if vcts := stringValues(regMeta["vct_values"]); len(vcts) > 0 {
+		requestedVCTs := stringValues(reqMeta["vct_values"])
+		if len(requestedVCTs) == 0 {
+			return false
+		}
+		for _, vct := range requestedVCTs {
+			if !slices.Contains(vcts, vct) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// registeredClaimsCover reports whether a claims path pointer lies within one
+// of the claims of a registered credential query. null in a registered path
+// covers every array element.
+func registeredClaimsCover(registered map[string]any, path []any) bool {
+	claims := jsonutil.GetArray(registered, "claims")
+	if len(claims) == 0 {
+		return true
+	}
+	for _, c := range claims {
+		claim, _ := c.(map[string]any)
+		regPath := jsonutil.GetArray(claim, "path")
+		if len(regPath) == 0 || len(regPath) > len(path) {
+			continue
+		}
+		within := true
+		for i, elem := range regPath {
+			if elem != nil && elem != path[i] {
+				within = false
+				break
+			}
+		}
+		if within {
+			return true
+		}
+	}
+	return false
+}
+
+// dcqlTypeLabel describes the credential type a DCQL credential query asks for.
+func dcqlTypeLabel(cq map[string]any) string {
+	meta := jsonutil.GetMap(cq, "meta")
+	if doctype := jsonutil.GetString(meta, "doctype_value"); doctype != "" {
+		return doctype
+	}
+	if vcts := stringValues(meta["vct_values"]); len(vcts) > 0 {
+		return strings.Join(vcts, ", ")
+	}
+	return jsonutil.GetString(cq, "format")
+}
+
+// dcqlQueryIDs returns the ids of the credential queries of a DCQL query.
+func dcqlQueryIDs(dcqlQuery map[string]any) map[string]bool {
+	ids := make(map[string]bool)
+	for _, c := range jsonutil.GetArray(dcqlQuery, "credentials") {
+		if cq, ok := c.(map[string]any); ok {
+			ids[jsonutil.GetString(cq, "id")] = true
+		}
+	}
+	return ids
+}
+
+// localizedValues returns the texts of a localized value: a string or an
+// array of {"lang", "value"} objects.
+func localizedValues(v any) []string {
+	if s, ok := v.(string); ok {
+		return []string{s}
+	}
+	arr, _ := v.([]any)
+	var values []string
+	for _, e := range arr {
+		obj, ok := e.(map[string]any)
+		if !ok {
+			continue
+		}
+		value := jsonutil.GetString(obj, "value")
+		if lang := jsonutil.GetString(obj, "lang"); lang != "" && value != "" {
+			value += " (" + lang + ")"
+		}
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,257 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
+)
+
+// testRegistrationCertificate returns a registration certificate payload that
+// entitles the verifier to the SD-JWT PID's given_name and family_name and to
+// the whole address.
+func testRegistrationCertificate() map[string]any {
+	return map[string]any{
+		"iss":            "https://registrar.example",
+		"sub":            "verifier.example",
+		"name":           "Example Bank",
+		"purpose":        []any{map[string]any{"lang": "en", "value": "Account opening"}},
+		"privacy_policy": "https://verifier.example/privacy",
+		"entitlements":   []any{"https://uri.etsi.org/19475/Entitlement/Service_Provider"},
+		"credentials": []any{
+			map[string]any{
+				"format": "dc+sd-jwt",
+				"meta":   map[string]any{"vct_values": []any{mock.DefaultPIDVCT}},
+				"claims": []any{
+					map[string]any{"path": []any{"given_name"}},
+					map[string]any{"path": []any{"family_name"}},
+					map[string]any{"path": []any{"address"}},
+				},
+			},
+		},
+	}
+}
+
+func pidQueryWithClaims(paths ...[]any) map[string]any {
+	claims := make([]any, len(paths))
+	for i, p := range paths {
+		claims[i] = map[string]any{"path": p}
+	}
+	return map[string]any{"credentials": []any{map[string]any{
+		"id":     "pid",
+		"format": "dc+sd-jwt",
+		"meta":   map[string]any{"vct_values": []any{mock.DefaultPIDVCT}},
+		"claims": claims,
+	}}}
+}
+
+// signedRegistrationCertificate signs a registration certificate payload with
+// a key certified by a new registrar CA, and returns it with the CA.
+func signedRegistrationCertificate(t *testing.T, payload map[string]any) (string, *x509.Certificate) {
+	t.Helper()
+	caKey, _ := mock.GenerateKey()
+	ca, err := mock.GenerateCACert(caKey)
+	if err != nil {
+		t.Fatalf("GenerateCACert: %v", err)
+	}
+	key, _ := mock.GenerateKey()
+	leaf, err := mock.GenerateNamedLeafCert(caKey, ca, &key.PublicKey, "Registrar")
+	if err != nil {
+		t.Fatalf("GenerateNamedLeafCert: %v", err)
+	}
+	raw, err := signJWT(map[string]any{"alg": "ES256", "typ": "rc-wrp+jwt", "x5c": []any{base64.StdEncoding.EncodeToString(leaf.Raw)}}, payload, key)
+	if err != nil {
+		t.Fatalf("signJWT: %v", err)
+	}
+	return raw, ca
+}
+
+func TestValidateVerifierInfo_Entitlements(t *testing.T) {
+	raw, ca := signedRegistrationCertificate(t, testRegistrationCertificate())
+	entries := []map[string]any{{"format": "registration_cert", "data": raw}}
+
+	tests := []struct {
+		name  string
+		query map[string]any
+		want  []string
+	}{
+		{"entitled claims", pidQueryWithClaims([]any{"given_name"}, []any{"address", "locality"}), nil},
+		{"over-asking", pidQueryWithClaims([]any{"given_name"}, []any{"birthdate"}), []string{`requests claim ["birthdate"]`}},
+		{"all claims", pidQueryWithClaims(), []string{"requests all claims"}},
+		{"unregistered credential", map[string]any{"credentials": []any{map[string]any{
+			"id":     "mdl",
+			"format": "mso_mdoc",
+			"meta":   map[string]any{"doctype_value": "org.iso.18013.5.1.mDL"},
+		}}}, []string{`"mdl" requests org.iso.18013.5.1.mDL`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := ValidateVerifierInfo(entries, tt.query, []*x509.Certificate{ca})
+			if len(findings) != len(tt.want) {
+				t.Fatalf("expected %d findings, got %v", len(tt.want), findings)
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(findings[i], want) {
+					t.Errorf("finding %q does not contain %q", findings[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateVerifierInfo_Entries(t *testing.T) {
+	expired := testRegistrationCertificate()
+	expired["exp"] = float64(time.Now().Add(-time.Hour).Unix())
+	expiredRaw, ca := signedRegistrationCertificate(t, expired)
+	withoutCredentials := testRegistrationCertificate()
+	delete(withoutCredentials, "credentials")
+	withoutCredentialsRaw, ca2 := signedRegistrationCertificate(t, withoutCredentials)
+	key, _ := mock.GenerateKey()
+	noX5C, err := signJWT(map[string]any{"alg": "ES256", "typ": "rc-wrp+jwt"}, testRegistrationCertificate(), key)
+	if err != nil {
+		t.Fatalf("signJWT: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		entries []map[string]any
+		want    string
+	}{
+		{"missing format and data", []map[string]any{{}}, "format is required"},
+		{"unknown credential id", []map[string]any{{"format": "x", "data": "y", "credential_ids": []any{"nope"}}}, `unknown credential query "nope"`},
+		{"not a JWT", []map[string]any{{"format": "registration_cert", "data": "not-a-jwt"}}, "not a JWT"},
+		{"unsigned", []map[string]any{{"format": "registration_cert", "data": testRegistrationCertificate()}}, "not signed"},
+		{"no x5c", []map[string]any{{"format": "registration_cert", "data": noX5C}}, "no x5c chain"},
+		{"expired", []map[string]any{{"format": "registration_cert", "data": expiredRaw}}, "expired"},
+		{"no credentials registered", []map[string]any{{"format": "registration_cert", "data": withoutCredentialsRaw}}, ""},
+		{"other format ignored", []map[string]any{{"format": "policy", "data": map[string]any{"credentials": []any{}}}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := ValidateVerifierInfo(tt.entries, pidQueryWithClaims([]any{"birthdate"}), []*x509.Certificate{ca, ca2})
+			if tt.want == "" {
+				if len(findings) != 0 {
+					t.Errorf("expected no findings, got %v", findings)
+				}
+				return
+			}
+			if len(findings) == 0 || !strings.Contains(findings[0], tt.want) {
+				t.Errorf("expected a finding containing %q, got %v", tt.want, findings)
+			}
+		})
+	}
+}
+
+func TestValidateVerifierInfo_CredentialIDs(t *testing.T) {
+	query := pidQueryWithClaims([]any{"birthdate"})
+	query["credentials"] = append(query["credentials"].([]any), map[string]any{
+		"id":     "mdl",
+		"format": "mso_mdoc",
+		"meta":   map[string]any{"doctype_value": "org.iso.18013.5.1.mDL"},
+	})
+	raw, ca := signedRegistrationCertificate(t, testRegistrationCertificate())
+	entries := []map[string]any{{"format": "registration_cert", "data": raw, "credential_ids": []any{"mdl"}}}
+
+	findings := ValidateVerifierInfo(entries, query, []*x509.Certificate{ca})
+	if len(findings) != 1 || !strings.Contains(findings[0], `"mdl"`) {
+		t.Errorf("expected only the mdl query to be checked, got %v", findings)
+	}
+}
+
+func TestValidateVerifierInfo_SignedRegistrationCertificate(t *testing.T) {
+	raw, ca := signedRegistrationCertificate(t, testRegistrationCertificate())
+	_, otherCA := signedRegistrationCertificate(t, testRegistrationCertificate())
+
+	// Recognized by its typ, whatever the entry's format.
+	entries := []map[string]any{{"format": "jwt", "data": raw}}
+	query := pidQueryWithClaims([]any{"birthdate"})
+	findings := ValidateVerifierInfo(entries, query, []*x509.Certificate{ca})
+	if len(findings) != 1 || !strings.Contains(findings[0], "birthdate") {
+		t.Fatalf("expected the over-asking finding only, got %v", findings)
+	}
+
+	tests := []struct {
+		name         string
+		data         string
+		registrarCAs []*x509.Certificate
+		want         string
+	}{
+		{"no registrar trust anchors", raw, nil, "--registrar-ca"},
+		{"other registrar", raw, []*x509.Certificate{otherCA}, "does not lead to a registrar trust anchor"},
+		{"tampered signature", raw[:strings.LastIndex(raw, ".")] + ".AAAA", []*x509.Certificate{ca}, "signature verification failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Untrusted certificates are not checked for over-asking.
+			findings := ValidateVerifierInfo([]map[string]any{{"format": "jwt", "data": tt.data}}, query, tt.registrarCAs)
+			if len(findings) != 1 || !strings.Contains(findings[0], "unverified") || !strings.Contains(findings[0], tt.want) {
+				t.Errorf("expected one unverified finding containing %q, got %v", tt.want, findings)
+			}
+		})
+	}
+}
+
+func TestParseVerifierInfo(t *testing.T) {
+	certB64, _ := testCertDER([]string{"verifier.example"})
+	raw, ca := signedRegistrationCertificate(t, testRegistrationCertificate())
+	entries := []map[string]any{{"format": "registration_cert", "data": raw}}
+
+	info := ParseVerifierInfo(entries, reqObjWithX5C(certB64), pidQueryWithClaims([]any{"birthdate"}), []*x509.Certificate{ca})
+	if info == nil {
+		t.Fatal("expected verifier info")
+	}
+	if info.Name != "Example Bank" || info.Registrar != "https://registrar.example" || info.PrivacyPolicy != "https://verifier.example/privacy" {
+		t.Errorf("unexpected registration attributes: %+v", info)
+	}
+	if len(info.IntendedUse) != 1 || info.IntendedUse[0] != "Account opening (en)" {
+		t.Errorf("intended use = %v", info.IntendedUse)
+	}
+	if len(info.Credentials) != 1 || len(info.Entitlements) != 1 {
+		t.Errorf("expected one registered credential and entitlement, got %+v", info)
+	}
+	if info.AccessCertificate == nil || info.AccessCertificate.Subject != "CN=test" {
+		t.Errorf("access certificate = %+v", info.AccessCertificate)
+	}
+	if len(info.Overasked) != 1 {
+		t.Errorf("expected birthdate to be over-asked, got %v", info.Overasked)
+	}
+	if len(info.Unverified) != 0 {
+		t.Errorf("expected no unverified certificates, got %v", info.Unverified)
+	}
+
+	if ParseVerifierInfo(nil, nil, nil, nil) != nil {
+		t.Error("expected nil without verifier_info and access certificate")
+	}
+}
+
+func TestParseVerifierInfo_Unverified(t *testing.T) {
+	entries := []map[string]any{{"format": "registration_cert", "data": testRegistrationCertificate()}}
+
+	info := ParseVerifierInfo(entries, nil, pidQueryWithClaims([]any{"birthdate"}), nil)
+	if info == nil {
+		t.Fatal("expected verifier info")
+	}
+	if info.Name != "" || info.Registrar != "" || len(info.Entitlements) != 0 || len(info.Overasked) != 0 {
+		t.Errorf("expected no registration attributes from an unsigned certificate, got %+v", info)
+	}
+	if len(info.Unverified) != 1 || !strings.Contains(info.Unverified[0], "not signed") {
+		t.Errorf("unverified = %v", info.Unverified)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/format"
+	"github.com/dominikschlosser/oid4vc-dev/internal/jsonutil"
+	"github.com/dominikschlosser/oid4vc-dev/internal/keys"
+	"github.com/dominikschlosser/oid4vc-dev/internal/mdoc"
+	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
+)
+
+// VPFormatsSupported returns the client_metadata.vp_formats_supported of a
+// request object (OID4VP 1.0 Section 11.1), or nil if it has none.
+func VPFormatsSupported(reqObj *oid4vc.RequestObjectJWT) map[string]any {
+	if reqObj == nil {
+		return nil
+	}
+	return jsonutil.GetMap(jsonutil.GetMap(reqObj.Payload, "client_metadata"), "vp_formats_supported")
+}
+
+// ValidateVPFormats reports a request object whose client_metadata does not
+// declare vp_formats_supported, which OID4VP 1.0 Section 5.1 requires.
+func ValidateVPFormats(reqObj *oid4vc.RequestObjectJWT) []string {
+	if reqObj == nil || VPFormatsSupported(reqObj) != nil {
+		return nil
+	}
+	return []string{"client_metadata has no vp_formats_supported, formats and algorithms are not negotiated"}
+}
+
+// vpFormatMismatch returns why the verifier's vp_formats_supported rules out
+// presenting a credential, or "" if it does not (OID4VP 1.0 Appendix B): the
+// format is not listed, the verifier does not accept the issuer's signature
+// algorithm, or none of the algorithms the wallet can bind the presentation
+// to the holder with. Parameters the verifier omits do not restrict.
+func (w *Wallet) vpFormatMismatch(cred StoredCredential, holderBinding bool, reqObj *oid4vc.RequestObjectJWT) string {
+	formats := VPFormatsSupported(reqObj)
+	if formats == nil {
+		return ""
+	}
+	meta, ok := formats[cred.Format].(map[string]any)
+	if !ok {
+		return fmt.Sprintf("format %s not in vp_formats_supported", cred.Format)
+	}
+
+	holderKey := credentialHolderKey(cred)
+	if holderKey == nil && w.HolderKey != nil {
+		holderKey = w.HolderKey.Public()
+	}
+	switch cred.Format {
+	case "dc+sd-jwt":
+		issuerJWT, _, _ := strings.Cut(cred.Raw, "~")
+		if alg := jwtAlg(issuerJWT); !algAllowed(meta, "sd-jwt_alg_values", alg) {
+			return fmt.Sprintf("issuer algorithm %s not in sd-jwt_alg_values", alg)
+		}
+		if algs := w.holderAlgs(holderKey); holderBinding && negotiateKBJWTAlg(meta, algs) == "" {
+			return fmt.Sprintf("none of the KB-JWT algorithms %v in kb-jwt_alg_values", algs)
+		}
+	case "jwt_vc_json":
+		if alg := jwtAlg(cred.Raw); !algAllowed(meta, "alg_values", alg) {
+			return fmt.Sprintf("issuer algorithm %s not in alg_values", alg)
+		}
+	case "mso_mdoc":
+		if alg, ok := mdocIssuerAuthAlg(cred.Raw); ok && !coseAlgAllowed(meta, "issuerauth_alg_values", alg) {
+			return fmt.Sprintf("issuerAuth algorithm %d not in issuerauth_alg_values", alg)
+		}
+		if w.negotiateDeviceAuth(meta, reqObj, holderKey) == "" {
+			return "no device authentication algorithm in deviceauth_alg_values"
+		}
+	}
+	return ""
+}
+
+// vpFormatsNotSupported returns the error for a presentation the verifier's
+// vp_formats_supported rules out. Its ErrorCode is vp_formats_not_supported.
+func vpFormatsNotSupported(finding string) error {
+	return &RequestValidationError{Code: ErrorVPFormatsNotSupported, Findings: []string{finding}}
+}
+
+// negotiateKBJWTAlg returns the first of the holder key algorithms algs the
+// verifier accepts for KB-JWTs, or "".
+func negotiateKBJWTAlg(meta map[string]any, algs []keys.Algorithm) keys.Algorithm {
+	for _, alg := range algs {
+		if algAllowed(meta, "kb-jwt_alg_values", string(alg)) {
+			return alg
+		}
+	}
+	return ""
+}
+
+// negotiateDeviceAuth returns the mDoc device authentication method for a
+// verifier's mso_mdoc metadata and the holder key: the configured method if
+// deviceauth_alg_values accepts it, else the other one, or "" if neither.
+// deviceMac needs a reader key in the request and a P-256 holder key.
+func (w *Wallet) negotiateDeviceAuth(meta map[string]any, reqObj *oid4vc.RequestObjectJWT, holderKey crypto.PublicKey) DeviceAuthMode {
+	modes := []DeviceAuthMode{DeviceAuthSignature, DeviceAuthMAC}
+	if w.DeviceAuth == DeviceAuthMAC {
+		slices.Reverse(modes)
+	}
+	for _, mode := range modes {
+		switch mode {
+		case DeviceAuthMAC:
+			if _, err := mdocReaderKey(reqObj); err != nil {
+				continue
+			}
+			if ecKey, ok := holderKey.(*ecdsa.PublicKey); !ok || ecKey.Curve != elliptic.P256() {
+				continue
+			}
+			if coseAlgAllowed(meta, "deviceauth_alg_values", mdoc.COSEAlgHMAC256) {
+				return mode
+			}
+		case DeviceAuthSignature:
+			if w.deviceSignatureAlg(meta, holderKey) != "" {
+				return mode
+			}
+		}
+	}
+	return ""
+}
+
+// deviceSignatureAlg returns the first algorithm of the holder key the
+// verifier's deviceauth_alg_values accepts for deviceSignature, or "".
+func (w *Wallet) deviceSignatureAlg(meta map[string]any, holderKey crypto.PublicKey) keys.Algorithm {
+	for _, alg := range w.holderAlgs(holderKey) {
+		if id, ok := keys.COSEAlgorithm(alg); ok && coseAlgAllowed(meta, "deviceauth_alg_values", int64(id)) {
+			return alg
+		}
+	}
+	return ""
+}
+
+// UnmatchedErrorCode returns the error code for a request no stored
+// credential matches: vp_formats_not_supported if the requested formats are
+// not supported, or if credentials would match but vp_formats_supported of
+// reqObj rules them out, access_denied otherwise.
+func (w *Wallet) UnmatchedErrorCode(dcqlQuery, pd map[string]any, reqObj *oid4vc.RequestObjectJWT) string {
+	code := NoMatchErrorCode(dcqlQuery)
+	if code != ErrorAccessDenied || VPFormatsSupported(reqObj) == nil {
+		return code
+	}
+	switch {
+	case dcqlQuery != nil && len(w.EvaluateDCQL(dcqlQuery)) > 0:
+		return ErrorVPFormatsNotSupported
+	case pd != nil && len(w.EvaluatePresentationDefinition(pd)) > 0:
+		return ErrorVPFormatsNotSupported
+	}
+	return code
+}
+
+// algAllowed reports whether the JWS algorithm alg is in the string array
+// key of meta. A missing array allows any algorithm.
+func algAllowed(meta map[string]any, key, alg string) bool {
+	if _, ok := meta[key].([]any); !ok {
+		return true
+	}
+	return slices.Contains(stringValues(meta[key]), alg)
+}
+
+// coseAlgAllowed reports whether the COSE algorithm alg is in the integer
+// array key of meta. A missing array allows any algorithm.
+func coseAlgAllowed(meta map[string]any, key string, alg int64) bool {
+	values, ok := meta[key].([]any)
+	if !ok {
+		return true
+	}
+	return slices.ContainsFunc(values, func(v any) bool {
+		n, ok := integerValue(v)
+		return ok && int64(n) == alg
+	})
+}
+
+// jwtAlg returns the alg header parameter of a compact JWS.
+func jwtAlg(raw string) string {
+	header, _, _, err := format.ParseJWTParts(raw)
+	if err != nil {
+		return ""
+	}
+	return jsonutil.GetString(header, "alg")
+}
+
+// mdocIssuerAuthAlg returns the COSE algorithm of an mDoc's issuerAuth.
+func mdocIssuerAuthAlg(raw string) (int64, bool) {
+	doc, err := mdoc.Parse(raw)
+	if err != nil || doc.IssuerAuth == nil {
+		return 0, false
+	}
+	return doc.IssuerAuth.Algorithm()
+}
@@ -0,0 +1,164 @@
+// Copyright 2026 Dominik Schlosser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wallet
+
+import (
+	"testing"
+
+	"github.com/dominikschlosser/oid4vc-dev/internal/mock"
+	"github.com/dominikschlosser/oid4vc-dev/internal/oid4vc"
+)
+
+// vpFormatsRequest returns a request object whose client_metadata declares
+// formats as vp_formats_supported, and keys as jwks if given.
+func vpFormatsRequest(formats map[string]any, keys ...any) *oid4vc.RequestObjectJWT {
+	meta := map[string]any{"vp_formats_supported": formats}
+	if len(keys) > 0 {
+		meta["jwks"] = map[string]any{"keys": keys}
+	}
+	return &oid4vc.RequestObjectJWT{Payload: map[string]any{"client_metadata": meta}}
+}
+
+func TestEvaluateDCQLForRequest_VPFormats(t *testing.T) {
+	readerKey, _ := mock.GenerateKey()
+	readerJWK := testEncJWK(t, &readerKey.PublicKey)
+
+	tests := []struct {
+		name   string
+		reqObj *oid4vc.RequestObjectJWT
+		want   string // format of the match, "" for none
+	}{
+		{"no request object", nil, "dc+sd-jwt"},
+		{"no restrictions", vpFormatsRequest(map[string]any{"dc+sd-jwt": map[string]any{}, "mso_mdoc": map[string]any{}}), "dc+sd-jwt"},
+		{"only mdoc", vpFormatsRequest(map[string]any{"mso_mdoc": map[string]any{}}), "mso_mdoc"},
+		{"sd-jwt issuer alg", vpFormatsRequest(map[string]any{
+			"dc+sd-jwt": map[string]any{"sd-jwt_alg_values": []any{"ES384"}},
+			"mso_mdoc":  map[string]any{"issuerauth_alg_values": []any{float64(-7)}},
+		}), "mso_mdoc"},
+		{"kb-jwt alg", vpFormatsRequest(map[string]any{
+			"dc+sd-jwt": map[string]any{"sd-jwt_alg_values": []any{"ES256"}, "kb-jwt_alg_values": []any{"EdDSA"}},
+		}), ""},
+		{"issuerauth alg", vpFormatsRequest(map[string]any{
+			"mso_mdoc": map[string]any{"issuerauth_alg_values": []any{float64(-35)}},
+		}), ""},
+		{"deviceMac without reader key", vpFormatsRequest(map[string]any{
+			"mso_mdoc": map[string]any{"deviceauth_alg_values": []any{float64(5)}},
+		}), ""},
+		{"deviceMac with reader key", vpFormatsRequest(map[string]any{
+			"mso_mdoc": map[string]any{"deviceauth_alg_values": []any{float64(5)}},
+		}, readerJWK), "mso_mdoc"},
+		{"unsupported format", vpFormatsRequest(map[string]any{"ldp_vc": map[string]any{}}), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := generateTestWalletWithPID(t)
+			matches := w.EvaluateDCQLForRequest(bothFormatDCQLQuery(), tt.reqObj)
+			if tt.want == "" {
+				if len(matches) != 0 {
+					t.Fatalf("expected no match, got %+v", matches)
+				}
+				return
+			}
+			if len(matches) != 1 || matches[0].Format != tt.want {
+				t.Fatalf("expected one %s match, got %+v", tt.want, matches)
+			}
+		})
+	}
+}
+
+func TestEvaluatePresentationDefinitionForRequest_VPFormats(t *testing.T) {
+	w := generateTestWalletWithPID(t)
+	pd := map[string]any{
+		"id":                "pd",
+		"input_descriptors": []any{map[string]any{"id": "eu.europa.ec.eudi.pid.1"}},
+	}
+	if matches := w.EvaluatePresentationDefinitionForRequest(pd, vpFormatsRequest(map[string]any{"mso_mdoc": map[string]any{}})); len(matches) != 1 {
+		t.Errorf("expected the mDoc to match, got %+v", matches)
+	}
+	if matches := w.EvaluatePresentationDefinitionForRequest(pd, vpFormatsRequest(map[string]any{"jwt_vc_json": map[string]any{}})); len(matches) != 0 {
+		t.Errorf("expected no match, got %+v", matches)
+	}
+}
+
+func TestUnmatchedErrorCode(t *testing.T) {
+	w := generateTestWalletWithPID(t)
+	sdjwtOnly := vpFormatsRequest(map[string]any{"dc+sd-jwt": map[string]any{"sd-jwt_alg_values": []any{"ES512"}}})
+	noPID := map[string]any{"credentials": []any{map[string]any{
+		"id":     "other",
+		"format": "dc+sd-jwt",
+		"meta":   map[string]any{"vct_values": []any{"urn:example:other"}},
+	}}}
+	ldp := map[string]any{"credentials": []any{map[string]any{"id": "ldp", "format": "ldp_vc"}}}
+
+	tests := []struct {
+		name   string
+		query  map[string]any
+		reqObj *oid4vc.RequestObjectJWT
+		want   string
+	}{
+		{"ruled out by vp_formats_supported", pidDCQLQuery(), sdjwtOnly, ErrorVPFormatsNotSupported},
+		{"no credential", noPID, sdjwtOnly, ErrorAccessDenied},
+		{"no metadata", noPID, nil, ErrorAccessDenied},
+		{"unsupported format", ldp, nil, ErrorVPFormatsNotSupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := w.UnmatchedErrorCode(tt.query, nil, tt.reqObj); code != tt.want {
+				t.Errorf("UnmatchedErrorCode = %q, want %q", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateVPToken_VPFormatsNotSupported(t *testing.T) {
+	w := generateTestWalletWithPID(t)
+	var sdCred StoredCredential
+	for _, c := range w.GetCredentials() {
+		if c.Format == "dc+sd-jwt" {
+			sdCred = c
+		}
+	}
+	match := CredentialMatch{QueryID: "pid", CredentialID: sdCred.ID, Format: "dc+sd-jwt", SelectedKeys: []string{"given_name"}}
+	reqObj := vpFormatsRequest(map[string]any{"dc+sd-jwt": map[string]any{"kb-jwt_alg_values": []any{"EdDSA"}}})
+
+	_, err := w.CreateVPToken(match, PresentationParams{Nonce: "n", ClientID: "client", RequestObject: reqObj})
+	if code := ErrorCode(err); code != ErrorVPFormatsNotSupported {
+		t.Errorf("CreateVPToken error %v has code %q, want %q", err, code, ErrorVPFormatsNotSupported)
+	}
+
+	_, err = w.createKBJWT(w.HolderKey, "n", "client", "sd-hash", nil, reqObj)
+	if code := ErrorCode(err); code != ErrorVPFormatsNotSupported {
+		t.Errorf("createKBJWT error %v has code %q, want %q", err, code, ErrorVPFormatsNotSupported)
+	}
+	if _, err := w.createKBJWT(w.HolderKey, "n", "client", "sd-hash", nil, vpFormatsRequest(map[string]any{"mso_mdoc": map[string]any{}})); err != nil {
+		t.Errorf("expected a KB-JWT without kb-jwt_alg_values, got %v", err)
+	}
+}
+
+func TestValidateVPFormats(t *testing.T) {
+	if findings := ValidateVPFormats(nil); len(findings) != 0 {
+		t.Errorf("unexpected findings without a request object: %v", findings)
+	}
+	if findings := ValidateVPFormats(vpFormatsRequest(map[string]any{"dc+sd-jwt": map[string]any{}})); len(findings) != 0 {
+		t.Errorf("unexpected findings: %v", findings)
+	}
+	reqObj := &oid4vc.RequestObjectJWT{Payload: map[string]any{"client_metadata": map[string]any{}}}
+	if findings := ValidateVPFormats(reqObj); len(findings) != 1 {
+		t.Errorf("expected a finding for missing vp_formats_supported, got %v", findings)
+	}
+	if _, err := ValidatePresentationRequest(ValidationModeStrict, "redirect_uri:https://verifier.example/cb", reqObj, "https://verifier.example/cb", nil, nil, nil, nil, nil); err == nil {
+		t.Error("expected strict mode to reject a request without vp_formats_supported")
+	}
+}
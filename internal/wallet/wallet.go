@@ -16,11 +16,14 @@
 package wallet
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"log"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -45,6 +48,35 @@ const (
 	SessionTranscriptOID4VP SessionTranscriptMode = "oid4vp"
 )
 
+// DeviceAuthMode controls how mDoc presentations authenticate the device key
+// (ISO 18013-5 Section 9.1.3).
+type DeviceAuthMode string
+
+const (
+	// DeviceAuthSignature signs the DeviceAuthentication with the holder key
+	// (deviceSignature, COSE_Sign1).
+	DeviceAuthSignature DeviceAuthMode = "signature"
+
+	// DeviceAuthMAC MACs the DeviceAuthentication with a key derived through
+	// ECDH between the holder key and the reader key of client_metadata.jwks
+	// (deviceMac, COSE_Mac0). Requests without a reader key get a
+	// deviceSignature.
+	DeviceAuthMAC DeviceAuthMode = "mac"
+)
+
+// ParseDeviceAuthMode parses a device authentication mode string. An empty
+// value means signature.
+func ParseDeviceAuthMode(raw string) (DeviceAuthMode, error) {
+	switch DeviceAuthMode(strings.ToLower(strings.TrimSpace(raw))) {
+	case "", DeviceAuthSignature:
+		return DeviceAuthSignature, nil
+	case DeviceAuthMAC:
+		return DeviceAuthMAC, nil
+	default:
+		return "", fmt.Errorf("invalid device auth mode %q (expected 'signature' or 'mac')", raw)
+	}
+}
+
 // StatusEntry tracks the status list index and current status for a credential.
 type StatusEntry struct {
 	Index  int `json:"index"`
@@ -59,23 +91,43 @@ type NextErrorOverride struct {
 
 // Wallet holds credentials, keys, and manages presentation consent flows.
 type Wallet struct {
-	HolderKey               *ecdsa.PrivateKey
-	IssuerKey               *ecdsa.PrivateKey
+	HolderKey               crypto.Signer
+	IssuerKey               crypto.Signer
+	Alg                     keys.Algorithm  `json:"-"` // signing algorithm of the holder and issuer keys; RS256 or PS256 for RSA keys
+	OtherHolderKeys         []crypto.Signer `json:"-"` // holder keys of other algorithms, for credentials bound to them
 	CAKey                   *ecdsa.PrivateKey
 	CertChain               []*x509.Certificate // [leaf, CA] certificate chain
 	AutoAccept              bool
 	SessionTranscript       SessionTranscriptMode // "oid4vp" (default) or "iso"
+	DeviceAuth              DeviceAuthMode        `json:"-"` // mDoc device authentication: "signature" (default) or "mac"
 	PreferredFormat         string                // "" (no preference), "dc+sd-jwt", or "mso_mdoc"
 	RequireEncryptedRequest bool                  // when true, sends encryption keys in wallet_metadata
 	RequestEncryptionKey    *ecdsa.PrivateKey     // key for decrypting encrypted request objects
 	RequireHAIP             bool                  // when true, enforce HAIP 1.0 compliance checks
 	ValidationMode          ValidationMode        `json:"-"`
 	Credentials             []StoredCredential
+	PendingIssuances        []PendingIssuance      // deferred issuances awaiting the issuer
 	StatusEntries           map[string]StatusEntry // credential ID → status entry
 	StatusListCounter       int                    // next available status list index
 	BaseURL                 string                 // base URL for status list endpoint
 	Requests                map[string]*ConsentRequest
-	TxCode                  string `json:"-"` // one-shot tx_code for OID4VCI token request
+	TxCode                  string                     `json:"-"` // one-shot tx_code for OID4VCI token request
+	IssuanceClientID        string                     // OAuth client_id for the OID4VCI authorization code flow
+	IssuanceRedirectURI     string                     // redirect_uri served by the wallet's /callback listener
+	OnAuthorizationURL      func(authURL string) error `json:"-"` // sends the user to the authorization endpoint
+	DPoPKey                 *ecdsa.PrivateKey          // key for DPoP proofs (RFC 9449), separate from the holder key
+	DPoPMode                DPoPMode                   `json:"-"` // "auto" (default), "force", or "off"
+	ClientAttestation       ClientAttestationConfig    `json:"-"` // OAuth Client Attestation at the token and PAR endpoints
+	WalletProvider          *WalletProvider            `json:"-"` // mock wallet provider, created on first use
+	InstanceKey             *ecdsa.PrivateKey          // wallet instance key bound in client attestations
+	KeyAttestation          KeyAttestationConfig       `json:"-"` // key_storage/user_authentication claimed in key attestations
+	ProofType               string                     `json:"-"` // OID4VCI proof type: "jwt", "attestation", or "di_vp" ("" = chosen from proof_types_supported)
+	CredentialEncryption    CredentialEncryptionMode   `json:"-"` // "auto" (default), "force", or "off"
+	Locale                  string                     `json:"-"` // preferred locale for issuer display data ("" = the issuer's first entry)
+	AutoRefresh             time.Duration              `json:"-"` // refresh OID4VCI credentials this long before they expire (0 = off)
+	TrustAnchors            []string                   `json:"-"` // OpenID Federation trust anchors: files or URLs of entity configurations or {entity_id, jwks}
+	RegistrarCAs            []*x509.Certificate        `json:"-"` // trust anchors of verifier_info registration certificates
+	Draft                   int                        `json:"-"` // OID4VP draft of the draft compatibility mode (MinDraft–MaxDraft, 0 = OID4VP 1.0)
 	Log                     []LogEntry
 	mu                      sync.RWMutex
 	nextError               *NextErrorOverride
@@ -84,6 +136,9 @@ type Wallet struct {
 	errSubscribers          map[int64]chan WalletError
 	errSubID                int64
 	lastError               *WalletError
+	authSubscribers         map[int64]chan string
+	authSubID               int64
+	pendingAuthorizations   map[string]chan AuthorizationCallback
 }
 
 // WalletError is an error event that can be displayed in the UI.
@@ -94,54 +149,75 @@ type WalletError struct {
 
 // StoredCredential is a credential stored in the wallet.
 type StoredCredential struct {
-	ID          string                             `json:"id"`
-	Format      string                             `json:"format"`        // "dc+sd-jwt", "mso_mdoc", or "jwt_vc_json"
-	Raw         string                             `json:"raw"`           // original credential string
-	Claims      map[string]any                     `json:"claims"`        // decoded claims for display/matching
-	VCT         string                             `json:"vct,omitempty"` // SD-JWT vct
-	DocType     string                             `json:"doctype,omitempty"`
-	Disclosures []sdjwt.Disclosure                 `json:"-"`
-	NameSpaces  map[string][]mdoc.IssuerSignedItem `json:"-"`
+	ID           string                             `json:"id"`
+	Format       string                             `json:"format"`        // "dc+sd-jwt", "mso_mdoc", or "jwt_vc_json"
+	Raw          string                             `json:"raw"`           // original credential string
+	Claims       map[string]any                     `json:"claims"`        // decoded claims for display/matching
+	VCT          string                             `json:"vct,omitempty"` // SD-JWT vct
+	DocType      string                             `json:"doctype,omitempty"`
+	Instances    []CredentialInstance               `json:"instances,omitempty"`    // batch-issued copies; Raw mirrors the first
+	Display      *CredentialDisplay                 `json:"display,omitempty"`      // issuer display data from the issuer metadata
+	Notification *CredentialNotification            `json:"notification,omitempty"` // set if the issuer sent a notification_id
+	Issuance     *IssuanceContext                   `json:"issuance,omitempty"`     // set for credentials issued via OID4VCI
+	Disclosures  []sdjwt.Disclosure                 `json:"-"`
+	NameSpaces   map[string][]mdoc.IssuerSignedItem `json:"-"`
+}
+
+// CredentialInstance is one batch-issued copy of a credential. Each instance is
+// bound to its own holder key and is presented at most once before the wallet
+// starts reusing instances.
+type CredentialInstance struct {
+	Raw       string `json:"raw"`
+	HolderKey string `json:"holder_key"` // PEM-encoded private key
+	Used      bool   `json:"used,omitempty"`
 }
 
 // ConsentRequest represents a pending presentation or issuance consent.
 type ConsentRequest struct {
-	ID           string                       `json:"id"`
-	Type         string                       `json:"type"` // "presentation" or "issuance"
-	AuthRequest  *oid4vc.AuthorizationRequest `json:"-"`
-	MatchedCreds []CredentialMatch            `json:"matched_credentials"`
-	Status       string                       `json:"status"` // "pending", "approved", "denied"
-	ResultCh     chan ConsentResult           `json:"-"`
-	SubmissionCh chan SubmissionResult        `json:"-"` // result of VP submission after approval
-	CreatedAt    time.Time                    `json:"created_at"`
-	ClientID     string                       `json:"client_id"`
-	Nonce        string                       `json:"nonce,omitempty"`
-	ResponseURI  string                       `json:"response_uri,omitempty"`
-	DCQLQuery    map[string]any               `json:"dcql_query,omitempty"`
+	ID              string                       `json:"id"`
+	Type            string                       `json:"type"` // "presentation" or "issuance"
+	AuthRequest     *oid4vc.AuthorizationRequest `json:"-"`
+	MatchedCreds    []CredentialMatch            `json:"matched_credentials"`
+	Status          string                       `json:"status"` // "pending", "approved", "denied"
+	ResultCh        chan ConsentResult           `json:"-"`
+	SubmissionCh    chan SubmissionResult        `json:"-"` // result of VP submission after approval
+	CreatedAt       time.Time                    `json:"created_at"`
+	ClientID        string                       `json:"client_id"`
+	Nonce           string                       `json:"nonce,omitempty"`
+	ResponseURI     string                       `json:"response_uri,omitempty"`
+	DCQLQuery       map[string]any               `json:"dcql_query,omitempty"`
+	TransactionData []TransactionData            `json:"transaction_data,omitempty"`
+	VerifierInfo    *VerifierInfo                `json:"verifier_info,omitempty"`
+	Warnings        []string                     `json:"warnings,omitempty"` // e.g. matched credentials whose batch instances are all used
 }
 
 // CredentialMatch links a credential to a DCQL query credential ID.
 type CredentialMatch struct {
-	QueryID      string         `json:"query_id"`
-	CredentialID string         `json:"credential_id"`
-	Format       string         `json:"format"`
-	VCT          string         `json:"vct,omitempty"`
-	DocType      string         `json:"doctype,omitempty"`
-	Claims       map[string]any `json:"claims"`
-	SelectedKeys []string       `json:"selected_keys"` // claim names to disclose
+	QueryID              string         `json:"query_id"`
+	CredentialID         string         `json:"credential_id"`
+	Format               string         `json:"format"`
+	VCT                  string         `json:"vct,omitempty"`
+	DocType              string         `json:"doctype,omitempty"`
+	Claims               map[string]any `json:"claims"`                           // claims the presentation discloses
+	SelectedKeys         []string       `json:"selected_keys"`                    // top-level claim names to disclose
+	SelectedPaths        [][]any        `json:"selected_paths,omitempty"`         // claims path pointers to disclose
+	RetainedPaths        [][]any        `json:"retained_paths,omitempty"`         // mDoc claims the verifier intends to retain
+	WithoutHolderBinding bool           `json:"without_holder_binding,omitempty"` // require_cryptographic_holder_binding: false
 }
 
 // ConsentResult is returned by the consent flow.
 type ConsentResult struct {
 	Approved       bool
 	SelectedClaims map[string][]string // credential ID → claim names
+	SelectedPaths  map[string][][]any  // credential ID → claims path pointers
 }
 
 // SubmissionResult is the outcome of VP token submission after consent approval.
 type SubmissionResult struct {
-	RedirectURI string `json:"redirect_uri,omitempty"`
-	Error       string `json:"error,omitempty"`
-	StatusCode  int    `json:"status_code,omitempty"`
+	RedirectURI string   `json:"redirect_uri,omitempty"`
+	Error       string   `json:"error,omitempty"`
+	StatusCode  int      `json:"status_code,omitempty"`
+	Warnings    []string `json:"warnings,omitempty"` // reused batch instances
 }
 
 // LogEntry records a wallet action.
@@ -154,14 +230,20 @@ type LogEntry struct {
 
 // New creates a new wallet with the given options.
 // It generates a CA key and certificate chain (CA → leaf) for realistic x5c chains.
-func New(holderKey, issuerKey *ecdsa.PrivateKey, autoAccept bool) *Wallet {
+func New(holderKey, issuerKey crypto.Signer, autoAccept bool) *Wallet {
 	w := &Wallet{
 		HolderKey:      holderKey,
 		IssuerKey:      issuerKey,
+		Alg:            keys.ES256,
 		AutoAccept:     autoAccept,
 		ValidationMode: ValidationModeDebug,
-		Requests:       make(map[string]*ConsentRequest),
-		subscribers:    make(map[int64]chan *ConsentRequest),
+		DPoPMode:       DPoPModeAuto,
+		ClientAttestation: ClientAttestationConfig{
+			Mode: ClientAttestationAuto,
+		},
+		CredentialEncryption: CredentialEncryptionAuto,
+		Requests:             make(map[string]*ConsentRequest),
+		subscribers:          make(map[int64]chan *ConsentRequest),
 	}
 
 	// Generate CA key and certificate chain
@@ -177,7 +259,7 @@ func New(holderKey, issuerKey *ecdsa.PrivateKey, autoAccept bool) *Wallet {
 		return w
 	}
 
-	leafCert, err := mock.GenerateLeafCert(caKey, caCert, &issuerKey.PublicKey)
+	leafCert, err := mock.GenerateLeafCert(caKey, caCert, issuerKey.Public())
 	if err != nil {
 		log.Printf("[Wallet] Warning: failed to generate leaf cert: %v", err)
 		return w
@@ -221,10 +303,11 @@ func (w *Wallet) GenerateDefaultCredentials(claimOverrides map[string]any, vct s
 	w.removeByType("mso_mdoc", "", "eu.europa.ec.eudi.pid.1")
 
 	// Generate SD-JWT PID
-	var holderPubKey *ecdsa.PublicKey
+	var holderPubKey crypto.PublicKey
 	if w.HolderKey != nil {
-		holderPubKey = &w.HolderKey.PublicKey
+		holderPubKey = w.HolderKey.Public()
 	}
+	issuerAlg := w.signingAlg(issuerKey)
 
 	sdConfig := mock.SDJWTConfig{
 		Issuer:    "https://issuer.example",
@@ -232,6 +315,7 @@ func (w *Wallet) GenerateDefaultCredentials(claimOverrides map[string]any, vct s
 		ExpiresIn: 30 * 24 * time.Hour,
 		Claims:    sdClaims,
 		Key:       issuerKey,
+		Alg:       issuerAlg,
 		HolderKey: holderPubKey,
 		CertChain: w.CertChain,
 	}
@@ -263,6 +347,7 @@ func (w *Wallet) GenerateDefaultCredentials(claimOverrides map[string]any, vct s
 		Namespace: "eu.europa.ec.eudi.pid.1",
 		Claims:    mdocClaims,
 		Key:       issuerKey,
+		Alg:       issuerAlg,
 		HolderKey: holderPubKey,
 		ExpiresIn: 30 * 24 * time.Hour,
 		CertChain: w.CertChain,
@@ -325,6 +410,9 @@ func (w *Wallet) GetCredentials() []StoredCredential {
 	defer w.mu.RUnlock()
 	out := make([]StoredCredential, len(w.Credentials))
 	copy(out, w.Credentials)
+	for i := range out {
+		out[i].Instances = append([]CredentialInstance(nil), out[i].Instances...)
+	}
 	return out
 }
 
@@ -334,6 +422,7 @@ func (w *Wallet) GetCredential(id string) (StoredCredential, bool) {
 	defer w.mu.RUnlock()
 	for _, c := range w.Credentials {
 		if c.ID == id {
+			c.Instances = append([]CredentialInstance(nil), c.Instances...)
 			return c, true
 		}
 	}
@@ -362,16 +451,31 @@ func (w *Wallet) GetLog() []LogEntry {
 }
 
 // LoadKeyFromFile loads a private key from a file path.
-func LoadKeyFromFile(path string) (*ecdsa.PrivateKey, error) {
-	privKey, err := keys.LoadPrivateKey(path)
-	if err != nil {
-		return nil, err
-	}
-	ecKey, ok := privKey.(*ecdsa.PrivateKey)
-	if !ok {
-		return nil, fmt.Errorf("key must be an EC private key (P-256)")
+func LoadKeyFromFile(path string) (crypto.Signer, error) {
+	return keys.LoadSigner(path)
+}
+
+// signingAlg returns the algorithm to sign with key: the wallet's Alg if the
+// key supports it, otherwise the key's default algorithm.
+func (w *Wallet) signingAlg(key crypto.Signer) keys.Algorithm {
+	alg, _ := keys.AlgorithmFor(key.Public(), w.Alg)
+	return alg
+}
+
+// holderAlg returns the algorithm of the wallet's holder key, which batch
+// holder keys are generated for.
+func (w *Wallet) holderAlg() keys.Algorithm {
+	return w.signingAlg(w.HolderKey)
+}
+
+// holderAlgs returns the algorithms a holder key can sign with, the wallet's
+// Alg first.
+func (w *Wallet) holderAlgs(pub crypto.PublicKey) []keys.Algorithm {
+	algs := keys.KeyAlgorithms(pub)
+	if i := slices.Index(algs, w.Alg); i > 0 {
+		algs = append([]keys.Algorithm{w.Alg}, slices.Delete(algs, i, i+1)...)
 	}
-	return ecKey, nil
+	return algs
 }
 
 // CredentialSummary returns a JSON-serializable summary of a credential.
@@ -387,6 +491,23 @@ func CredentialSummary(c StoredCredential) map[string]any {
 	if c.DocType != "" {
 		summary["doctype"] = c.DocType
 	}
+	if len(c.Instances) > 0 {
+		summary["instances"] = len(c.Instances)
+		summary["unused_instances"] = c.UnusedInstances()
+	}
+	if c.Display != nil {
+		summary["display"] = c.Display
+	}
+	if c.Notification != nil {
+		summary["notification_id"] = c.Notification.ID
+	}
+	if c.Issuance != nil {
+		summary["issuer"] = c.Issuance.Issuer
+		summary["refreshable"] = c.Issuance.Refreshable()
+		if !c.Issuance.CredentialExpiresAt.IsZero() {
+			summary["expires_at"] = c.Issuance.CredentialExpiresAt
+		}
+	}
 	return summary
 }
 
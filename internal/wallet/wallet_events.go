@@ -134,6 +134,54 @@ func (w *Wallet) NotifyError(err WalletError) {
 	}
 }
 
+// SubscribeAuthorizations returns a channel for authorization endpoint URLs
+// the user must visit, and an unsubscribe function.
+func (w *Wallet) SubscribeAuthorizations() (<-chan string, func()) {
+	ch := make(chan string, 16)
+	w.mu.Lock()
+	w.authSubID++
+	id := w.authSubID
+	if w.authSubscribers == nil {
+		w.authSubscribers = make(map[int64]chan string)
+	}
+	w.authSubscribers[id] = ch
+	w.mu.Unlock()
+
+	return ch, func() {
+		w.mu.Lock()
+		delete(w.authSubscribers, id)
+		w.mu.Unlock()
+		for {
+			select {
+			case <-ch:
+			default:
+				return
+			}
+		}
+	}
+}
+
+// NotifyAuthorization sends an authorization endpoint URL to all subscribers.
+// It returns the number of subscribers that received it.
+func (w *Wallet) NotifyAuthorization(authURL string) int {
+	w.mu.RLock()
+	subs := make([]chan string, 0, len(w.authSubscribers))
+	for _, ch := range w.authSubscribers {
+		subs = append(subs, ch)
+	}
+	w.mu.RUnlock()
+
+	delivered := 0
+	for _, ch := range subs {
+		select {
+		case ch <- authURL:
+			delivered++
+		default:
+		}
+	}
+	return delivered
+}
+
 // PopLastError returns and clears the last error, if any.
 func (w *Wallet) PopLastError() *WalletError {
 	w.mu.Lock()